@@ -0,0 +1,75 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// As makes a binding available under further types, usually interfaces
+// that its result implements. Each target is a pointer to one of the
+// types, such as new(PoemStorage):
+//
+//	c.Provide(NewSQLStorage, di.WithLifetime(di.Singleton),
+//		di.As(new(PoemStorage), new(Lister), new(HealthChecker)))
+//
+// Resolving any of the types returns the value of the original binding,
+// so a singleton is constructed once, no matter under which type it is
+// requested first. For transient bindings, each resolution still builds a
+// new value. The binding stays available under its own result type, and
+// aliases share its name if it has one.
+//
+// An alias replaces an earlier binding of its type, as a registration
+// would. Registration panics if the result type cannot be assigned to one
+// of the targets, and As cannot be combined with Group.
+func As(targets ...interface{}) Option {
+	return func(b *binding) {
+		for _, t := range targets {
+			rt := reflect.TypeOf(t)
+			if rt == nil || rt.Kind() != reflect.Ptr {
+				panic(fmt.Sprintf("di: As: target must be a pointer such as new(PoemStorage), got %T", t))
+			}
+			b.aliases = append(b.aliases, rt.Elem())
+		}
+	}
+}
+
+// aliasBindings returns the bindings that b's aliases add, given the key of
+// b itself.
+func aliasBindings(k key, b *binding) map[key]*binding {
+	if len(b.aliases) == 0 {
+		return nil
+	}
+	if b.group {
+		panic("di: As cannot be combined with Group")
+	}
+	bs := map[key]*binding{}
+	for _, t := range b.aliases {
+		if !k.typ.AssignableTo(t) {
+			panic(fmt.Sprintf("di: As: %v cannot be used as %v", k.typ, t))
+		}
+		target := k
+		bs[key{typ: t, name: k.name}] = &binding{
+			provider: b.provider,
+			location: b.location,
+			module:   b.module,
+			lifetime: b.lifetime,
+			override: b.override,
+			alias:    &target,
+		}
+	}
+	return bs
+}
+
+// resolveAlias resolves the binding that alias b stands for and converts
+// its value to the alias type of k.
+func (c *Container) resolveAlias(ctx context.Context, path resolution, k key, b *binding) (reflect.Value, error) {
+	path = append(path[:len(path):len(path)], k)
+	v, err := c.resolve(ctx, path, *b.alias)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("%v: %w", k, err)
+	}
+	alias := reflect.New(k.typ).Elem()
+	alias.Set(v)
+	return alias, nil
+}
@@ -0,0 +1,96 @@
+package di_test
+
+import (
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type namer interface {
+	Name() string
+}
+
+func (*poetSpeaker) Name() string { return "poet" }
+
+func TestAsSingletonIsBuiltOnce(t *testing.T) {
+	for _, first := range []string{"concrete", "speaker", "namer"} {
+		t.Run(first+" first", func(t *testing.T) {
+			c := di.New()
+			built := 0
+			c.Provide(func() *poetSpeaker { built++; return &poetSpeaker{} },
+				di.WithLifetime(di.Singleton), di.As(new(speaker), new(namer)))
+
+			var s speaker
+			var n namer
+			var p *poetSpeaker
+			resolve := map[string]func(){
+				"concrete": func() { p = di.MustResolve[*poetSpeaker](c) },
+				"speaker":  func() { s = di.MustResolve[speaker](c) },
+				"namer":    func() { n = di.MustResolve[namer](c) },
+			}
+			resolve[first]()
+			for _, r := range resolve {
+				r()
+			}
+			if built != 1 {
+				t.Errorf("built %d times, want once", built)
+			}
+			if s != speaker(p) || n != namer(p) {
+				t.Error("the aliases resolved other instances")
+			}
+		})
+	}
+}
+
+func TestAsTransient(t *testing.T) {
+	c := di.New()
+	c.Provide(func() *poetSpeaker { return &poetSpeaker{} }, di.As(new(speaker)))
+	if di.MustResolve[speaker](c) == di.MustResolve[speaker](c) {
+		t.Error("a transient alias returned the same value twice")
+	}
+}
+
+func TestAsNamed(t *testing.T) {
+	c := di.New()
+	c.Provide(func() *poetSpeaker { return &poetSpeaker{} }, di.Named("p"),
+		di.WithLifetime(di.Singleton), di.As(new(speaker)))
+	s, err := di.Resolve[speaker](c, di.Named("p"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != speaker(di.MustResolve[*poetSpeaker](c, di.Named("p"))) {
+		t.Error("the named alias resolved another instance")
+	}
+	if _, err := di.Resolve[speaker](c); err == nil {
+		t.Error("the alias of a named binding is also unnamed")
+	}
+}
+
+func TestAsReplacesEarlierBinding(t *testing.T) {
+	c := di.New()
+	c.Register(func() speaker { return speakerProxy{} })
+	c.Provide(func() *poetSpeaker { return &poetSpeaker{} }, di.As(new(speaker)))
+	if _, ok := di.MustResolve[speaker](c).(*poetSpeaker); !ok {
+		t.Error("the alias did not replace the earlier binding")
+	}
+}
+
+func TestAsRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []di.Option
+	}{
+		{"not a pointer", []di.Option{di.As(speakerProxy{})}},
+		{"nil", []di.Option{di.As(nil)}},
+		{"not assignable", []di.Option{di.As(new(*thing))}},
+		{"group", []di.Option{di.As(new(speaker)), di.Group()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if msg := panics(func() {
+				di.New().Provide(func() *poetSpeaker { return &poetSpeaker{} }, tc.opts...)
+			}); msg == "" {
+				t.Error("Provide accepted it")
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package di
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"text/tabwriter"
+)
+
+// A BindingInfo describes a binding of a container, for tools and for tests
+// that check the wiring:
+//
+//	for _, b := range c.Bindings() {
+//		if b.Type == reflect.TypeOf((*PoemStorage)(nil)).Elem() && b.Lifetime != di.Singleton {
+//			t.Errorf("%v is %v, want a singleton", b.Type, b.Lifetime)
+//		}
+//	}
+type BindingInfo struct {
+	Type     reflect.Type // The type the binding is resolved by, often an interface.
+	Name     string       // The name of the binding, if it is named.
+	Lifetime Lifetime
+	Module   string         // Path of the module that installed the binding, if any.
+	Params   []reflect.Type // Parameters of the provider.
+	Provider string         // Source location of the provider.
+
+	// ParamNames are the names of the bindings injected into Params, as
+	// set with ParamNames, or nil if all of them are unnamed.
+	ParamNames []string
+
+	// Concrete is the type of the values that the binding yields. For
+	// bindings of interface type, it is the dynamic type of the last value
+	// the provider returned, after decorators, and nil until the provider
+	// has been called.
+	Concrete reflect.Type
+
+	Group bool         // Whether the binding is a member of the group of its type.
+	Alias reflect.Type // For bindings created with As: the type of the aliased binding.
+}
+
+// BindingList is the result of Container.Bindings.
+type BindingList []BindingInfo
+
+// Bindings returns the bindings that were registered in c, including group
+// members, sorted by type and name. For a scope, it returns only the scope's
+// own bindings.
+func (c *Container) Bindings() BindingList {
+	c.mu.RLock()
+	var bs BindingList
+	for k, b := range c.bindings {
+		bs = append(bs, b.info(k))
+	}
+	for gk, members := range c.groups {
+		for _, b := range members {
+			bs = append(bs, b.info(gk))
+		}
+	}
+	c.mu.RUnlock()
+	sort.SliceStable(bs, func(i, j int) bool {
+		ki, kj := key{typ: bs[i].Type, name: bs[i].Name}.String(), key{typ: bs[j].Type, name: bs[j].Name}.String()
+		if ki != kj {
+			return ki < kj
+		}
+		return !bs[i].Group && bs[j].Group
+	})
+	return bs
+}
+
+// info describes b, which is bound to k.
+func (b *binding) info(k key) BindingInfo {
+	bi := BindingInfo{
+		Type:     k.typ,
+		Name:     k.name,
+		Lifetime: b.lifetime,
+		Module:   b.module,
+		Params:   append([]reflect.Type(nil), b.params...),
+		Provider: b.location,
+		Group:    b.group,
+	}
+	if len(b.paramNames) > 0 {
+		bi.ParamNames = append([]string(nil), b.paramNames...)
+	}
+	if b.alias != nil {
+		bi.Alias = b.alias.typ
+	}
+	bi.Concrete = k.typ
+	if k.typ.Kind() == reflect.Interface {
+		b.mu.Lock()
+		bi.Concrete = b.concrete
+		b.mu.Unlock()
+	}
+	return bi
+}
+
+// String returns the binding in one line, as in
+//
+//	main.PoemStorage "napkin" (singleton) = *main.Napkin from main.go:241
+func (b BindingInfo) String() string {
+	s := fmt.Sprintf("%v (%v)", key{typ: b.Type, name: b.Name}, b.Lifetime)
+	switch {
+	case b.Alias != nil:
+		s += fmt.Sprintf(" = alias of %v", b.Alias)
+	case b.Concrete != nil && b.Concrete != b.Type:
+		s += fmt.Sprintf(" = %v", b.Concrete)
+	}
+	if b.Group {
+		s += " in group"
+	}
+	return s + " from " + b.Provider
+}
+
+// WriteTo writes the bindings as a table.
+func (l BindingList) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "BINDING\tLIFETIME\tCONCRETE\tMODULE\tPROVIDER")
+	for _, b := range l {
+		binding := key{typ: b.Type, name: b.Name}.String()
+		if b.Group {
+			binding += " (group)"
+		}
+		concrete := "?"
+		switch {
+		case b.Alias != nil:
+			concrete = "alias of " + b.Alias.String()
+		case b.Concrete != nil:
+			concrete = b.Concrete.String()
+		}
+		module := b.Module
+		if module == "" {
+			module = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%s\t%s\t%s\n", binding, b.Lifetime, concrete, module, b.Provider)
+	}
+	err := tw.Flush()
+	return cw.n, err
+}
+
+// String returns the table that WriteTo writes.
+func (l BindingList) String() string {
+	var buf bytes.Buffer
+	l.WriteTo(&buf)
+	return buf.String()
+}
+
+// String returns a table of c's bindings, as written by BindingList.WriteTo.
+func (c *Container) String() string {
+	return c.Bindings().String()
+}
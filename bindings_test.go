@@ -0,0 +1,104 @@
+package di_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+func TestBindings(t *testing.T) {
+	c := di.New()
+	c.Install(di.Module("storage", di.Provide(func() *poetSpeaker { return &poetSpeaker{} },
+		di.WithLifetime(di.Singleton), di.As(new(speaker)))))
+	c.Register(func() string { return "b" }, di.Group())
+	c.Register(func() string { return "a" })
+	c.Provide(func(string, int) *store { return &store{} }, di.ParamNames("", "n"))
+
+	var got []string
+	for _, b := range c.Bindings() {
+		got = append(got, b.Type.String())
+	}
+	want := []string{"*di_test.poetSpeaker", "*di_test.store", "di.Lifecycle", "di_test.speaker", "string", "string"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	bs := c.Bindings()
+	if b := bs[0]; b.Module != "storage" || b.Lifetime != di.Singleton || b.Concrete != b.Type {
+		t.Errorf("singleton: got %+v", b)
+	}
+	if b := bs[1]; !reflect.DeepEqual(b.ParamNames, []string{"", "n"}) || len(b.Params) != 2 || !strings.Contains(b.Provider, "bindings_test.go:") {
+		t.Errorf("constructor: got %+v", b)
+	}
+	if b := bs[3]; b.Alias != reflect.TypeOf(&poetSpeaker{}) {
+		t.Errorf("alias: got %+v", b)
+	}
+	if bs[4].Group || !bs[5].Group {
+		t.Error("the group member does not come after the binding of its type")
+	}
+}
+
+// For interfaces, Concrete is known once the provider has run.
+func TestBindingsConcrete(t *testing.T) {
+	c := di.New()
+	c.Register(func() speaker { return &poetSpeaker{} })
+	concrete := func() reflect.Type {
+		for _, b := range c.Bindings() {
+			if b.Type.String() == "di_test.speaker" {
+				return b.Concrete
+			}
+		}
+		return nil
+	}
+	if got := concrete(); got != nil {
+		t.Errorf("before resolution: got %v", got)
+	}
+	di.MustResolve[speaker](c)
+	if got := concrete(); got != reflect.TypeOf(&poetSpeaker{}) {
+		t.Errorf("after resolution: got %v", got)
+	}
+}
+
+func TestBindingsOfScope(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "root" })
+	s := c.NewScope()
+	s.Register(func() int { return 1 })
+	for _, b := range s.Bindings() {
+		if b.Type.String() == "string" {
+			t.Error("the scope lists its parent's bindings")
+		}
+	}
+}
+
+func TestBindingsString(t *testing.T) {
+	c := di.New()
+	c.Install(di.Module("storage", di.Provide(func() speaker { return &poetSpeaker{} }, di.Named("p"))))
+	c.Register(func() string { return "b" }, di.Group())
+	di.MustResolve[speaker](c, di.Named("p"))
+
+	table := c.String()
+	lines := strings.Split(strings.TrimSuffix(table, "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines:\n%s", len(lines), table)
+	}
+	if !strings.HasPrefix(lines[0], "BINDING") {
+		t.Errorf("header: %q", lines[0])
+	}
+	for _, want := range []string{
+		`di_test.speaker (named "p")  transient  *di_test.poetSpeaker  storage  `,
+		`string (group)`,
+	} {
+		if !strings.Contains(table, want) {
+			t.Errorf("table does not contain %q:\n%s", want, table)
+		}
+	}
+
+	for _, b := range c.Bindings() {
+		if b.Group && !strings.Contains(b.String(), "string (transient) in group from ") {
+			t.Errorf("String: %q", b.String())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package di
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Disposable is implemented by values that release resources when the
+// container is done with them, like io.Closer, but need a context to do so,
+// for example to flush a buffer with a deadline.
+//
+// The container tracks every value it constructs that is Disposable or an
+// io.Closer, and Dispose and Close release them in reverse construction
+// order, so that a value is closed before the values it was constructed
+// from:
+//
+//	c.Provide(OpenDB)          // func OpenDB(cfg Config) (*sql.DB, error)
+//	c.Provide(NewSQLStorage)   // func NewSQLStorage(db *sql.DB) *SQLStorage, an io.Closer
+//	defer c.Close()            // Closes the storage, then the database.
+//
+// Values belong to the container that constructs them: singletons to the
+// container that holds their binding, scoped and transient values to the
+// scope they are resolved in, so disposing a scope releases the values of
+// the request. Transient values resolved from the root stay tracked until
+// the root is closed.
+//
+// As with Initializable, the container releases what a provider
+// constructs, before decorators wrap it, and not values that a provider
+// returns from its arguments. A value is released once, no matter how
+// often its provider returned it. If Init fails, the value is released
+// right away.
+type Disposable interface {
+	Dispose(ctx context.Context) error
+}
+
+// closers keeps the values that a container releases when it is disposed.
+type closers struct {
+	mu      sync.Mutex
+	release []func(ctx context.Context) error
+	seen    map[uintptr]bool // Pointers of the values in release.
+}
+
+// track adds v to the values to release if it is Disposable or an
+// io.Closer, and was not added before.
+func (cs *closers) track(v reflect.Value) {
+	release := releaser(v)
+	if release == nil {
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if p := concrete(v); p.Kind() == reflect.Ptr {
+		if cs.seen[p.Pointer()] {
+			return
+		}
+		if cs.seen == nil {
+			cs.seen = map[uintptr]bool{}
+		}
+		cs.seen[p.Pointer()] = true
+	}
+	cs.release = append(cs.release, release)
+}
+
+// releaser returns the function that releases v, or nil if there is none.
+func releaser(v reflect.Value) func(ctx context.Context) error {
+	if isNil(v) {
+		return nil
+	}
+	switch r := v.Interface().(type) {
+	case Disposable:
+		return r.Dispose
+	case io.Closer:
+		return func(context.Context) error { return r.Close() }
+	}
+	return nil
+}
+
+// releaseAll releases the tracked values in reverse order and forgets
+// them. It returns the first error.
+func (cs *closers) releaseAll(ctx context.Context) error {
+	cs.mu.Lock()
+	release := cs.release
+	cs.release, cs.seen = nil, nil
+	cs.mu.Unlock()
+	var first error
+	for i := len(release) - 1; i >= 0; i-- {
+		if err := release[i](ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close disposes the container with a background context, so that
+//
+//	defer c.Close()
+//
+// releases everything the container constructed. See Dispose.
+func (c *Container) Close() error {
+	return c.Dispose(context.Background())
+}
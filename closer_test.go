@@ -0,0 +1,84 @@
+package di_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+// A resource records when it is closed.
+type resource struct {
+	name   string
+	closed *[]string
+	err    error
+}
+
+func (r *resource) Close() error {
+	*r.closed = append(*r.closed, r.name)
+	return r.err
+}
+
+type db struct{ *resource }
+type store struct{ *resource }
+
+// A disposable records when it is disposed.
+type disposable struct{ *resource }
+
+func (d *disposable) Dispose(ctx context.Context) error { return d.Close() }
+
+func TestCloseInReverseConstructionOrder(t *testing.T) {
+	var closed []string
+	c := di.New()
+	c.RegisterSingleton(func() *db { return &db{&resource{name: "db", closed: &closed}} })
+	c.Provide(func(*db) *store { return &store{&resource{name: "store", closed: &closed}} }, di.WithLifetime(di.Singleton))
+	di.MustResolve[*store](c)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"store", "db"}; !reflect.DeepEqual(closed, want) {
+		t.Errorf("closed %q, want %q", closed, want)
+	}
+	if err := c.Close(); err != nil || len(closed) != 2 {
+		t.Errorf("second close: %v, closed %q", err, closed)
+	}
+}
+
+func TestCloseReleasesOnceAndReturnsFirstError(t *testing.T) {
+	var closed []string
+	first, second := errors.New("first"), errors.New("second")
+	c := di.New()
+	c.RegisterSingleton(func() *db { return &db{&resource{name: "db", closed: &closed, err: second}} })
+	c.Provide(func(*db) *disposable { return &disposable{&resource{name: "disposable", closed: &closed, err: first}} },
+		di.WithLifetime(di.Singleton))
+	di.MustResolve[*disposable](c)
+	di.MustResolve[*disposable](c)
+	if err := c.Close(); !errors.Is(err, first) {
+		t.Errorf("got %v, want %v", err, first)
+	}
+	if want := []string{"disposable", "db"}; !reflect.DeepEqual(closed, want) {
+		t.Errorf("closed %q, want %q", closed, want)
+	}
+}
+
+func TestScopeReleasesItsOwnValues(t *testing.T) {
+	var closed []string
+	c := di.New()
+	c.RegisterSingleton(func() *db { return &db{&resource{name: "db", closed: &closed}} })
+	c.RegisterScoped(func() *store { return &store{&resource{name: "store", closed: &closed}} })
+	s := c.NewScope()
+	di.MustResolve[*db](s)
+	di.MustResolve[*store](s)
+	if err := s.Dispose(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"store"}; !reflect.DeepEqual(closed, want) {
+		t.Errorf("scope closed %q, want %q", closed, want)
+	}
+	c.Close()
+	if want := []string{"store", "db"}; !reflect.DeepEqual(closed, want) {
+		t.Errorf("closed %q, want %q", closed, want)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// api prints the exported API of packages, one feature per line, in a stable
+// order:
+//
+//	di api github.com/appliedgo/di > api.txt
+//
+// The output is the input for apidiff. Generate it for a released version,
+// generate it again for the working tree, and let apidiff compare the two.
+func api(args []string) error {
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	dir := flags.String("C", ".", "resolve packages from the module in `dir`")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: di api [-C dir] <import path>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("need at least one package")
+	}
+
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	var features []string
+	for _, path := range flags.Args() {
+		pkg, err := imp.ImportFrom(path, *dir, 0)
+		if err != nil {
+			return err
+		}
+		features = append(features, apiFeatures(pkg)...)
+	}
+	sort.Strings(features)
+	for _, f := range features {
+		fmt.Println(f)
+	}
+	return nil
+}
+
+// apidiff compares two API files written by api. Removed or changed features
+// break callers and make apidiff fail. Added features are listed, too, but
+// are compatible, except for new methods of existing interfaces, which break
+// every implementation outside the package.
+//
+//	di apidiff old.txt new.txt
+func apidiff(args []string) error {
+	flags := flag.NewFlagSet("apidiff", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: di apidiff <old api file> <new api file>")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("need two API files")
+	}
+	old, err := readFeatures(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	cur, err := readFeatures(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	breaking := 0
+	for _, f := range sortedKeys(old) {
+		if !cur[f] {
+			fmt.Println("-", f)
+			breaking++
+		}
+	}
+	for _, f := range sortedKeys(cur) {
+		if old[f] {
+			continue
+		}
+		if iface, ok := interfaceOf(f); ok && old[iface] {
+			fmt.Println("-", f, "(new interface method)")
+			breaking++
+			continue
+		}
+		fmt.Println("+", f)
+	}
+	if breaking > 0 {
+		return fmt.Errorf("%d breaking change(s)", breaking)
+	}
+	return nil
+}
+
+// apiFeatures lists the exported API of pkg, in the format
+// "pkg <path>, <feature>".
+func apiFeatures(pkg *types.Package) []string {
+	qualifier := types.RelativeTo(pkg)
+	prefix := "pkg " + pkg.Path() + ", "
+	var features []string
+	add := func(format string, args ...interface{}) {
+		features = append(features, prefix+fmt.Sprintf(format, args...))
+	}
+
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		switch obj := obj.(type) {
+		case *types.Const:
+			add("const %s %s", name, types.TypeString(obj.Type(), qualifier))
+		case *types.Var:
+			add("var %s %s", name, types.TypeString(obj.Type(), qualifier))
+		case *types.Func:
+			add("func %s%s", name, signature(obj.Type().(*types.Signature), qualifier))
+		case *types.TypeName:
+			features = append(features, typeFeatures(prefix, obj, qualifier)...)
+		}
+	}
+	return features
+}
+
+// typeFeatures lists a named type, its exported fields or interface methods,
+// and its exported methods.
+func typeFeatures(prefix string, obj *types.TypeName, qualifier types.Qualifier) []string {
+	name := obj.Name()
+	var features []string
+	add := func(format string, args ...interface{}) {
+		features = append(features, prefix+fmt.Sprintf(format, args...))
+	}
+
+	switch u := obj.Type().Underlying().(type) {
+	case *types.Struct:
+		add("type %s struct", name)
+		for i := 0; i < u.NumFields(); i++ {
+			if f := u.Field(i); f.Exported() {
+				add("type %s struct, %s %s", name, f.Name(), types.TypeString(f.Type(), qualifier))
+			}
+		}
+	case *types.Interface:
+		add("type %s interface", name)
+		for i := 0; i < u.NumMethods(); i++ {
+			if m := u.Method(i); m.Exported() {
+				add("type %s interface, %s%s", name, m.Name(), signature(m.Type().(*types.Signature), qualifier))
+			}
+		}
+	default:
+		add("type %s %s", name, types.TypeString(u, qualifier))
+	}
+
+	if types.IsInterface(obj.Type()) {
+		return features
+	}
+	// Methods declared on the type or its pointer. Methods promoted from
+	// embedded fields belong to the embedded type and are listed there.
+	for _, t := range []types.Type{obj.Type(), types.NewPointer(obj.Type())} {
+		methods := types.NewMethodSet(t)
+		for i := 0; i < methods.Len(); i++ {
+			m := methods.At(i).Obj()
+			sig := m.Type().(*types.Signature)
+			if !m.Exported() || !types.Identical(sig.Recv().Type(), t) {
+				continue
+			}
+			add("method (%s) %s%s", types.TypeString(t, qualifier), m.Name(), signature(sig, qualifier))
+		}
+	}
+	return features
+}
+
+// signature formats sig without parameter names, so that renaming a
+// parameter does not show up as an API change.
+func signature(sig *types.Signature, qualifier types.Qualifier) string {
+	var b strings.Builder
+	if tparams := sig.TypeParams(); tparams.Len() > 0 {
+		b.WriteString("[")
+		for i := 0; i < tparams.Len(); i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			tp := tparams.At(i)
+			b.WriteString(tp.Obj().Name() + " " + types.TypeString(tp.Constraint(), qualifier))
+		}
+		b.WriteString("]")
+	}
+	b.WriteString(tuple(sig.Params(), sig.Variadic(), qualifier))
+	switch res := sig.Results(); res.Len() {
+	case 0:
+	case 1:
+		b.WriteString(" " + types.TypeString(res.At(0).Type(), qualifier))
+	default:
+		b.WriteString(" " + tuple(res, false, qualifier))
+	}
+	return b.String()
+}
+
+// tuple formats the types of a parameter or result list in parentheses.
+func tuple(t *types.Tuple, variadic bool, qualifier types.Qualifier) string {
+	parts := make([]string, t.Len())
+	for i := range parts {
+		typ := t.At(i).Type()
+		if variadic && i == len(parts)-1 {
+			parts[i] = "..." + types.TypeString(typ.(*types.Slice).Elem(), qualifier)
+			continue
+		}
+		parts[i] = types.TypeString(typ, qualifier)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// interfaceOf returns the feature of the interface type that the API
+// feature f is a method of, if it is one. A method of an interface that is
+// new itself breaks no implementation.
+func interfaceOf(f string) (string, bool) {
+	i := strings.Index(f, " interface, ")
+	if i < 0 || !strings.Contains(f[:i], ", type ") {
+		return "", false
+	}
+	return f[:i] + " interface", true
+}
+
+func readFeatures(name string) (map[string]bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return scanFeatures(f)
+}
+
+func scanFeatures(r io.Reader) (map[string]bool, error) {
+	features := map[string]bool{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			features[line] = true
+		}
+	}
+	return features, s.Err()
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIDiff(t *testing.T) {
+	const p = "pkg example.com/poems, "
+	for _, tt := range []struct {
+		name     string
+		old, new []string
+		want     []string // The lines that apidiff prints.
+		breaking string   // The error, if any.
+	}{
+		{
+			name: "unchanged",
+			old:  []string{p + "func Open(string) error", p + "type Poem struct"},
+			new:  []string{p + "type Poem struct", p + "func Open(string) error"},
+		},
+		{
+			name: "added",
+			old:  []string{p + "type Poem struct"},
+			new:  []string{p + "type Poem struct", p + "type Poem struct, Title string", p + "method (*Poem) Len() int"},
+			want: []string{"+ " + p + "method (*Poem) Len() int", "+ " + p + "type Poem struct, Title string"},
+		},
+		{
+			name:     "removed",
+			old:      []string{p + "func Open(string) error", p + "const Version untyped string"},
+			new:      []string{p + "func Open(string) error"},
+			want:     []string{"- " + p + "const Version untyped string"},
+			breaking: "1 breaking change(s)",
+		},
+		{
+			name:     "changed",
+			old:      []string{p + "func Open(string) error"},
+			new:      []string{p + "func Open(string, ...Option) error"},
+			want:     []string{"- " + p + "func Open(string) error", "+ " + p + "func Open(string, ...Option) error"},
+			breaking: "1 breaking change(s)",
+		},
+		{
+			name: "new interface method",
+			old:  []string{p + "type Storage interface", p + "type Storage interface, Load(string) []byte"},
+			new: []string{p + "type Storage interface", p + "type Storage interface, Load(string) []byte",
+				p + "type Storage interface, Save(string, []byte)"},
+			want:     []string{"- " + p + "type Storage interface, Save(string, []byte) (new interface method)"},
+			breaking: "1 breaking change(s)",
+		},
+		{
+			name: "new interface",
+			old:  nil,
+			new:  []string{p + "type Storage interface", p + "type Storage interface, Load(string) []byte"},
+			want: []string{"+ " + p + "type Storage interface", "+ " + p + "type Storage interface, Load(string) []byte"},
+		},
+		{
+			name:     "several",
+			old:      []string{p + "func Open(string) error", p + "var Default *Store", p + "type Storage interface"},
+			new:      []string{p + "type Storage interface", p + "type Storage interface, Load(string) []byte"},
+			want:     []string{"- " + p + "func Open(string) error", "- " + p + "var Default *Store", "- " + p + "type Storage interface, Load(string) []byte (new interface method)"},
+			breaking: "3 breaking change(s)",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			old, cur := filepath.Join(dir, "old.txt"), filepath.Join(dir, "new.txt")
+			os.WriteFile(old, []byte(strings.Join(tt.old, "\n")+"\n\n"), 0o644)
+			os.WriteFile(cur, []byte(strings.Join(tt.new, "\n")), 0o644)
+			out, err := stdout(t, func() error { return apidiff([]string{old, cur}) })
+			want := ""
+			for _, line := range tt.want {
+				want += line + "\n"
+			}
+			if out != want {
+				t.Errorf("got\n%swant\n%s", out, want)
+			}
+			if (err == nil) != (tt.breaking == "") || err != nil && err.Error() != tt.breaking {
+				t.Errorf("got error %v, want %q", err, tt.breaking)
+			}
+		})
+	}
+}
+
+func TestAPIArguments(t *testing.T) {
+	if err := api(nil); err == nil {
+		t.Error("api without packages succeeded")
+	}
+	if err := apidiff([]string{"old.txt"}); err == nil {
+		t.Error("apidiff with one file succeeded")
+	}
+	if err := apidiff([]string{"testdata/missing.txt", "testdata/missing.txt"}); !os.IsNotExist(err) {
+		t.Errorf("apidiff of a missing file: got %v", err)
+	}
+}
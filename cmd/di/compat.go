@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// compat checks that a concrete type implements an interface, with both
+// types loaded from source as they resolve in the current module. When the
+// consumer that declares the interface and the provider that implements it
+// live in different modules, running compat in the application module checks
+// exactly the versions that go.mod selects.
+//
+//	di compat example.com/poems.PoemStorage '*example.com/notebook.Notebook'
+//
+// Unlike a failing build, compat lists every missing or mismatched method at
+// once.
+func compat(args []string) error {
+	flags := flag.NewFlagSet("compat", flag.ContinueOnError)
+	dir := flags.String("C", ".", "resolve packages from the module in `dir`")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: di compat [-C dir] <pkg>.<Interface> [*]<pkg>.<Type>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("need an interface and an implementation")
+	}
+
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	ifaceType, err := lookupType(imp, *dir, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	iface, ok := ifaceType.Underlying().(*types.Interface)
+	if !ok {
+		return fmt.Errorf("%s is not an interface", flags.Arg(0))
+	}
+	impl, err := lookupType(imp, *dir, flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	problems := mismatches(impl, iface)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s does not implement %s", impl, ifaceType)
+	}
+	fmt.Printf("%s implements %s\n", impl, ifaceType)
+	return nil
+}
+
+// lookupType finds the type named by spec, which has the form
+// "import/path.Name", optionally prefixed with "*" for the pointer type.
+func lookupType(imp types.ImporterFrom, dir, spec string) (types.Type, error) {
+	name := strings.TrimPrefix(spec, "*")
+	dot := strings.LastIndex(name, ".")
+	if dot <= strings.LastIndex(name, "/") {
+		return nil, fmt.Errorf("%q: want <import path>.<type name>", spec)
+	}
+	pkg, err := imp.ImportFrom(name[:dot], dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := pkg.Scope().Lookup(name[dot+1:]).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("%s: no type %s in package", spec, name[dot+1:])
+	}
+	t := obj.Type()
+	if strings.HasPrefix(spec, "*") {
+		t = types.NewPointer(t)
+	}
+	return t, nil
+}
+
+// mismatches describes every method of iface that t is missing or has with a
+// different signature.
+func mismatches(t types.Type, iface *types.Interface) []string {
+	var problems []string
+	for i := 0; i < iface.NumMethods(); i++ {
+		want := iface.Method(i)
+		obj, _, _ := types.LookupFieldOrMethod(t, false, want.Pkg(), want.Name())
+		got, ok := obj.(*types.Func)
+		switch {
+		case !ok:
+			if ptr, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, want.Pkg(), want.Name()); ptr != nil {
+				problems = append(problems, fmt.Sprintf("%s: method has a pointer receiver", want.Name()))
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("%s: missing, want %s", want.Name(), want.Type()))
+		case !types.Identical(got.Type(), want.Type()):
+			problems = append(problems, fmt.Sprintf("%s: have %s, want %s", want.Name(), got.Type(), want.Type()))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const compatPkg = "github.com/appliedgo/di/cmd/di/testdata/compat"
+
+// stdout calls fn and returns what it writes to standard output.
+func stdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "stdout")
+	err := stdoutTo(func([]string) error { return fn() })([]string{name})
+	out, rerr := os.ReadFile(name)
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	return string(out), err
+}
+
+func TestMismatches(t *testing.T) {
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	store, err := lookupType(imp, ".", compatPkg+".Store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		impl string
+		want []string
+	}{
+		{impl: "*" + compatPkg + ".Files"},
+		{impl: compatPkg + ".Memory"},
+		{impl: "*" + compatPkg + ".Memory"},
+		{impl: compatPkg + ".Embedded"},
+		{impl: compatPkg + ".Files", want: []string{
+			"Load: method has a pointer receiver",
+			"Save: method has a pointer receiver",
+		}},
+		{impl: compatPkg + ".Drifted", want: []string{
+			"Load: missing, want func(ctx context.Context, name string) ([]byte, error)",
+			"Save: have func(string, []byte) error, want func(ctx context.Context, name string, data []byte) error",
+		}},
+	} {
+		impl, err := lookupType(imp, ".", tt.impl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mismatches(impl, store.Underlying().(*types.Interface)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.impl, got, tt.want)
+		}
+	}
+}
+
+func TestCompat(t *testing.T) {
+	out, err := stdout(t, func() error { return compat([]string{compatPkg + ".Store", "*" + compatPkg + ".Files"}) })
+	if want := "*" + compatPkg + ".Files implements " + compatPkg + ".Store\n"; err != nil || out != want {
+		t.Errorf("got %q, %v, want %q", out, err, want)
+	}
+
+	out, err = stdout(t, func() error { return compat([]string{compatPkg + ".Store", compatPkg + ".Drifted"}) })
+	if err == nil || !strings.Contains(err.Error(), "does not implement") {
+		t.Errorf("got %v, want an error", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 {
+		t.Errorf("got %q, want every mismatch on a line", out)
+	}
+}
+
+func TestCompatArguments(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string // Part of the error.
+	}{
+		{[]string{compatPkg + ".Store"}, "need an interface and an implementation"},
+		{[]string{compatPkg + ".Files", compatPkg + ".Memory"}, "is not an interface"},
+		{[]string{compatPkg + ".Store", compatPkg + ".Nothing"}, "no type Nothing"},
+		{[]string{"Store", compatPkg + ".Files"}, "want <import path>.<type name>"},
+		{[]string{"example.com/missing.Store", compatPkg + ".Files"}, "example.com/missing"},
+	} {
+		err := compat(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %v, want an error with %q", tt.args, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+)
+
+// contract generates the skeleton of a contract test for an interface: a
+// function that runs a table of behaviors against any implementation, so
+// that every implementation is held to the same expectations.
+//
+//	di contract -o storage_contract_test.go example.com/poems.PoemStorage
+//
+// The table has one entry per method and one for each pair of methods that
+// look like they store and retrieve values, such as Save and Load. Each entry
+// skips the test until its body is written; the generated file is a starting
+// point to edit, not to regenerate.
+func contract(args []string) error {
+	flags := flag.NewFlagSet("contract", flag.ContinueOnError)
+	dir := flags.String("C", ".", "resolve packages from the module in `dir`")
+	pkg := flags.String("pkg", "", "package `name` of the generated file (default: the interface's package)")
+	pkgPath := flags.String("pkgpath", "", "import `path` of the generated file's package (default: the interface's package)")
+	out := flags.String("o", "", "write to `file` instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: di contract [flags] <pkg>.<Interface>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("need an interface")
+	}
+
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	t, err := lookupType(imp, *dir, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return fmt.Errorf("%s is not an interface", flags.Arg(0))
+	}
+	iface, ok := named.Underlying().(*types.Interface)
+	if !ok {
+		return fmt.Errorf("%s is not an interface", flags.Arg(0))
+	}
+	if *pkg == "" {
+		*pkg = named.Obj().Pkg().Name()
+	}
+	if *pkgPath == "" {
+		*pkgPath = named.Obj().Pkg().Path()
+	}
+
+	g := &frozenGen{pkgPath: *pkgPath, imports: map[string]string{}}
+	code, err := g.contract(*pkg, named, iface)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(code)
+		return err
+	}
+	return os.WriteFile(*out, code, 0o644)
+}
+
+// storing and retrieving list method names that suggest a round trip
+// through an implementation's state.
+var (
+	storing    = []string{"Save", "Put", "Set", "Store", "Write", "Add"}
+	retrieving = []string{"Load", "Get", "Read", "Fetch", "Lookup"}
+)
+
+// contract generates the contract test for iface, which is named by named.
+func (g *frozenGen) contract(pkg string, named *types.Named, iface *types.Interface) ([]byte, error) {
+	name := named.Obj().Name()
+	typ := g.expr(typeExpr(named))
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "// %sContract checks that an implementation of %s behaves as its\n", name, name)
+	fmt.Fprintf(&body, "// consumers expect. Call it from the tests of every implementation:\n//\n")
+	fmt.Fprintf(&body, "//\tfunc TestMy%s(t *testing.T) {\n", name)
+	fmt.Fprintf(&body, "//\t\t%sContract(t, func() %s { return NewMy%s() })\n//\t}\n//\n", name, typ, name)
+	fmt.Fprintf(&body, "// newImpl must return a fresh, empty instance on every call, as each\n")
+	fmt.Fprintf(&body, "// behavior runs against its own instance.\n")
+	fmt.Fprintf(&body, "func %sContract(t *testing.T, newImpl func() %s) {\n", name, typ)
+	fmt.Fprintf(&body, "\tbehaviors := []struct {\n\t\tname string\n\t\trun  func(t *testing.T, impl %s)\n\t}{\n", typ)
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		// The comment names packages without importing them.
+		sig := signature(m.Type().(*types.Signature), g.packageName)
+		behavior(&body, typ, m.Name(), fmt.Sprintf("%s%s", m.Name(), sig),
+			fmt.Sprintf("describe what %s does", m.Name()))
+	}
+	for _, pair := range roundTrips(iface) {
+		behavior(&body, typ, pair[0]+"Then"+pair[1], "",
+			fmt.Sprintf("check that %s returns what %s stored", pair[1], pair[0]))
+	}
+	fmt.Fprintf(&body, "\t}\n")
+	fmt.Fprintf(&body, "\tfor _, b := range behaviors {\n")
+	fmt.Fprintf(&body, "\t\tb := b\n")
+	fmt.Fprintf(&body, "\t\tt.Run(b.name, func(t *testing.T) { b.run(t, newImpl()) })\n")
+	fmt.Fprintf(&body, "\t}\n}\n")
+
+	header := fmt.Sprintf("// Contract test skeleton for %s, generated by \"di contract\".\n// Fill in the behaviors; do not regenerate this file.", name)
+	return g.source(header, pkg, body.Bytes(), "testing")
+}
+
+// packageName qualifies names in comments: by package name, and not at all
+// in the generated file's package.
+func (g *frozenGen) packageName(p *types.Package) string {
+	if p.Path() == g.pkgPath {
+		return ""
+	}
+	return p.Name()
+}
+
+// behavior writes one entry of the behavior table.
+func behavior(w *bytes.Buffer, typ, name, comment, todo string) {
+	fmt.Fprintf(w, "\t\t{%q, func(t *testing.T, impl %s) {\n", name, typ)
+	if comment != "" {
+		fmt.Fprintf(w, "\t\t\t// %s\n", comment)
+	}
+	fmt.Fprintf(w, "\t\t\tt.Skip(%q)\n", "TODO: "+todo)
+	fmt.Fprintf(w, "\t\t}},\n")
+}
+
+// roundTrips returns the pairs of methods of iface that store and retrieve
+// values of the same type under the same key type.
+func roundTrips(iface *types.Interface) [][2]string {
+	var pairs [][2]string
+	for i := 0; i < iface.NumMethods(); i++ {
+		store := iface.Method(i)
+		if !hasPrefix(store.Name(), storing) {
+			continue
+		}
+		for j := 0; j < iface.NumMethods(); j++ {
+			load := iface.Method(j)
+			if hasPrefix(load.Name(), retrieving) && complements(store.Type().(*types.Signature), load.Type().(*types.Signature)) {
+				pairs = append(pairs, [2]string{store.Name(), load.Name()})
+			}
+		}
+	}
+	return pairs
+}
+
+// complements reports whether load takes the leading parameters of store
+// and returns, first, the type of store's last parameter, as Load(string)
+// []byte does for Save(string, []byte).
+func complements(store, load *types.Signature) bool {
+	n := store.Params().Len()
+	if n == 0 || load.Params().Len() != n-1 || load.Results().Len() == 0 {
+		return false
+	}
+	for i := 0; i < n-1; i++ {
+		if !types.Identical(store.Params().At(i).Type(), load.Params().At(i).Type()) {
+			return false
+		}
+	}
+	return types.Identical(store.Params().At(n-1).Type(), load.Results().At(0).Type())
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"go/importer"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The skeleton compiles in a test package of its own.
+func TestContractCompiles(t *testing.T) {
+	typeCheck(t, "testdata/contract/cache_contract.go.golden", "contract_test")
+}
+
+func TestRoundTrips(t *testing.T) {
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	for _, tt := range []struct {
+		iface string
+		want  [][2]string
+	}{
+		{"github.com/appliedgo/di/cmd/di/testdata/contract.Cache", [][2]string{{"Put", "Lookup"}, {"Set", "Get"}}},
+		{"github.com/appliedgo/di/cmd/di/testdata/mock/poems.PoemStorage", [][2]string{{"Save", "Load"}}},
+		{"github.com/appliedgo/di/cmd/di/testdata/mock.Store", nil}, // Put takes variadic values.
+	} {
+		typ, err := lookupType(imp, ".", tt.iface)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := roundTrips(typ.Underlying().(*types.Interface)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.iface, got, tt.want)
+		}
+	}
+}
+
+func TestContractArguments(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string // Part of the error.
+	}{
+		{nil, "need an interface"},
+		{[]string{"github.com/appliedgo/di/cmd/di/testdata/compat.Files"}, "is not an interface"},
+		{[]string{"*github.com/appliedgo/di/cmd/di/testdata/contract.Cache"}, "is not an interface"},
+	} {
+		err := contract(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %v, want an error with %q", tt.args, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/appliedgo/di"
+)
+
+// diPath is the import path of package di, whose registration calls digen
+// looks for.
+const diPath = "github.com/appliedgo/di"
+
+// digen generates explicit wiring code from the registrations in the source
+// of a package, so the application can keep its registration code and still
+// avoid reflection at run time:
+//
+//	di digen ./cmd/poems
+//
+// digen finds every call of Container.Register, RegisterSingleton,
+// RegisterScoped, RegisterTransient and Provide, of the generic Register, and of the module
+// function Provide, and reads the providers' types and the Named,
+// WithLifetime, As and ParamNames options. Calls of Value become providers
+// of their value if it is a constant. As in a container, the last registration of a type
+// wins. The output has the same form as that of "di freeze", but function
+// literals that refer only to package-level names are copied into the
+// generated code instead of becoming provider fields.
+//
+// With -check, digen compares the generated code with the existing output
+// file and fails if they differ, which keeps generated files and golden files
+// from going stale.
+func digen(args []string) error {
+	flags := flag.NewFlagSet("digen", flag.ContinueOnError)
+	pkgPath := flags.String("pkgpath", "main", "import `path` of the package")
+	typeName := flags.String("type", "Wired", "`name` of the generated struct type")
+	out := flags.String("o", "wire_gen.go", "write to `file` in the package directory, or to standard output for -")
+	check := flags.Bool("check", false, "compare with the output file instead of writing it")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: di digen [flags] [dir]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	dir := "."
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		dir = flags.Arg(0)
+	default:
+		flags.Usage()
+		return errors.New("need at most one package directory")
+	}
+	outFile := *out
+	if outFile != "-" && !filepath.IsAbs(outFile) {
+		outFile = filepath.Join(dir, outFile)
+	}
+
+	pkg, m, err := declarations(dir, *pkgPath, filepath.Base(outFile))
+	if err != nil {
+		return err
+	}
+	g := &frozenGen{
+		tool:    "di digen",
+		origin:  "as declared by\n// the registrations in package " + pkg,
+		pkgPath: *pkgPath,
+		imports: map[string]string{},
+	}
+	code, err := g.generate(pkg, *typeName, m)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *check:
+		old, err := os.ReadFile(outFile)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(old, code) {
+			return fmt.Errorf("%s is out of date; run di digen", outFile)
+		}
+		return nil
+	case outFile == "-":
+		_, err = os.Stdout.Write(code)
+		return err
+	}
+	return os.WriteFile(outFile, code, 0o644)
+}
+
+// declarations type-checks the package in dir, except for the file named
+// skip, and returns the package name and a manifest of its registrations.
+//
+// The skipped file is the generated output, which is replaced anyway. As
+// the rest of the package may refer to it, type errors are ignored unless
+// they leave a registration's types unknown.
+func declarations(dir, pkgPath, skip string) (string, di.Manifest, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return "", di.Manifest{}, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		if name == skip {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return "", di.Manifest{}, err
+		}
+		files = append(files, f)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", di.Manifest{}, err
+	}
+	var typeErrs []error
+	conf := types.Config{
+		Importer: dirImporter{importer.ForCompiler(fset, "source", nil).(types.ImporterFrom), abs},
+		Error:    func(err error) { typeErrs = append(typeErrs, err) },
+	}
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	pkg, _ := conf.Check(pkgPath, fset, files, info)
+
+	s := &scanner{fset: fset, info: info, pkg: pkg, bindings: map[string]di.ManifestBinding{}}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok && s.err == nil {
+				s.call(call)
+			}
+			return s.err == nil
+		})
+	}
+	if s.err != nil {
+		if len(typeErrs) > 0 {
+			return "", di.Manifest{}, fmt.Errorf("%v (after type error: %v)", s.err, typeErrs[0])
+		}
+		return "", di.Manifest{}, s.err
+	}
+
+	var m di.Manifest
+	for _, b := range s.bindings {
+		m.Bindings = append(m.Bindings, b)
+	}
+	sort.Slice(m.Bindings, func(i, j int) bool {
+		a, b := m.Bindings[i], m.Bindings[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+	return bp.Name, m, nil
+}
+
+// dirImporter resolves imports as seen from a directory, so that the
+// package's module decides which versions are loaded.
+type dirImporter struct {
+	imp types.ImporterFrom
+	dir string
+}
+
+func (d dirImporter) Import(path string) (*types.Package, error) {
+	return d.imp.ImportFrom(path, d.dir, 0)
+}
+
+// A scanner collects the registrations of a type-checked package.
+type scanner struct {
+	fset     *token.FileSet
+	info     *types.Info
+	pkg      *types.Package
+	bindings map[string]di.ManifestBinding // By type and name.
+	err      error
+}
+
+// call records the registration that call makes, if it is one.
+func (s *scanner) call(call *ast.CallExpr) {
+	fn := s.callee(call.Fun)
+	if fn == nil || fn.Pkg() == nil || fn.Pkg().Path() != diPath {
+		return
+	}
+	method := fn.Type().(*types.Signature).Recv() != nil
+	args := call.Args
+	lifetime := di.Transient
+	switch {
+	case method && (fn.Name() == "Register" || fn.Name() == "Provide"):
+	case method && fn.Name() == "RegisterSingleton":
+		lifetime = di.Singleton
+	case method && fn.Name() == "RegisterScoped":
+		lifetime = di.Scoped
+	case method && fn.Name() == "RegisterTransient":
+	case !method && fn.Name() == "Register":
+		args = args[1:] // The container.
+	case !method && fn.Name() == "Provide":
+	case !method && fn.Name() == "Value":
+		s.value(call)
+		return
+	case method && fn.Name() == "Decorate":
+		s.fail(call, "decorators are not supported")
+		return
+	default:
+		return
+	}
+	if call.Ellipsis.IsValid() {
+		s.fail(call, "cannot evaluate options passed with ...")
+		return
+	}
+
+	provider := ast.Unparen(args[0])
+	sig, ok := s.info.TypeOf(provider).(*types.Signature)
+	if !ok || sig.Results().Len() == 0 || sig.Results().Len() > 2 || !valid(sig) {
+		s.fail(provider, "cannot determine the type of the provider")
+		return
+	}
+	b := di.ManifestBinding{
+		Type:     typeExpr(sig.Results().At(0).Type()),
+		Result:   typeExpr(sig.Results().At(0).Type()),
+		Provider: s.providerExpr(provider),
+		Location: s.location(provider),
+		Fallible: sig.Results().Len() == 2,
+		Variadic: sig.Variadic(),
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		b.Params = append(b.Params, typeExpr(sig.Params().At(i).Type()))
+	}
+	o := options{lifetime: lifetime}
+	for _, opt := range args[1:] {
+		if !s.option(opt, &o) {
+			return
+		}
+	}
+	if len(o.paramNames) > len(b.Params) {
+		s.fail(call, fmt.Sprintf("%d parameter names for %d parameters", len(o.paramNames), len(b.Params)))
+		return
+	}
+	for _, name := range o.paramNames {
+		if name != "" {
+			b.ParamNames = o.paramNames
+			break
+		}
+	}
+	b.Name, b.Lifetime = o.name, o.lifetime.String()
+	s.bindings[b.Type+"\x00"+b.Name] = b
+	for _, t := range o.aliases {
+		alias := di.ManifestBinding{
+			Type:     typeExpr(t),
+			Name:     b.Name,
+			Lifetime: b.Lifetime,
+			Result:   b.Type,
+			Location: b.Location,
+			Alias:    b.Type,
+		}
+		s.bindings[alias.Type+"\x00"+alias.Name] = alias
+	}
+}
+
+// value records the binding that a call of Value makes. The value must be a
+// boolean, string or integer constant, which the provider returns.
+func (s *scanner) value(call *ast.CallExpr) {
+	key := s.info.Types[call.Args[1]].Value
+	if key == nil || key.Kind() != constant.String {
+		s.fail(call.Args[1], "value key must be a constant")
+		return
+	}
+	tv := s.info.Types[call.Args[2]]
+	if tv.Value == nil || (tv.Value.Kind() != constant.Bool && tv.Value.Kind() != constant.String && tv.Value.Kind() != constant.Int) {
+		s.fail(call.Args[2], "value must be a boolean, string or integer constant")
+		return
+	}
+	t := typeExpr(tv.Type)
+	b := di.ManifestBinding{
+		Type:     t,
+		Name:     constant.StringVal(key),
+		Lifetime: di.Singleton.String(),
+		Result:   t,
+		Provider: "func() " + t + " { return " + tv.Value.ExactString() + " }",
+		Location: s.location(call),
+	}
+	s.bindings[b.Type+"\x00"+b.Name] = b
+}
+
+// options are the evaluated options of a registration.
+type options struct {
+	name       string
+	lifetime   di.Lifetime
+	aliases    []types.Type
+	paramNames []string
+}
+
+// callee returns the function or method that fun refers to, or nil.
+func (s *scanner) callee(fun ast.Expr) *types.Func {
+	fun = ast.Unparen(fun)
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+	var id *ast.Ident
+	switch f := fun.(type) {
+	case *ast.Ident:
+		id = f
+	case *ast.SelectorExpr:
+		id = f.Sel
+	default:
+		return nil
+	}
+	fn, _ := s.info.Uses[id].(*types.Func)
+	if fn != nil {
+		fn = fn.Origin()
+	}
+	return fn
+}
+
+// option applies a Named, WithLifetime or As option to o. Budget options
+// have no meaning for generated code and are skipped. option reports false
+// and records an error for options it cannot evaluate.
+func (s *scanner) option(opt ast.Expr, o *options) bool {
+	call, ok := ast.Unparen(opt).(*ast.CallExpr)
+	var fn *types.Func
+	if ok {
+		fn = s.callee(call.Fun)
+	}
+	if fn == nil || fn.Pkg() == nil || fn.Pkg().Path() != diPath {
+		s.fail(opt, "cannot evaluate option")
+		return false
+	}
+	switch fn.Name() {
+	case "Named":
+		v := s.info.Types[call.Args[0]].Value
+		if v == nil || v.Kind() != constant.String {
+			s.fail(opt, "binding name must be a constant")
+			return false
+		}
+		o.name = constant.StringVal(v)
+	case "WithLifetime":
+		v := s.info.Types[call.Args[0]].Value
+		if v == nil || v.Kind() != constant.Int {
+			s.fail(opt, "lifetime must be a constant")
+			return false
+		}
+		n, _ := constant.Int64Val(v)
+		o.lifetime = di.Lifetime(n)
+	case "As":
+		for _, arg := range call.Args {
+			ptr, ok := s.info.TypeOf(arg).(*types.Pointer)
+			if !ok {
+				s.fail(arg, "alias target must be a pointer")
+				return false
+			}
+			o.aliases = append(o.aliases, ptr.Elem())
+		}
+	case "ParamNames":
+		for _, arg := range call.Args {
+			v := s.info.Types[arg].Value
+			if v == nil || v.Kind() != constant.String {
+				s.fail(arg, "parameter names must be constants")
+				return false
+			}
+			o.paramNames = append(o.paramNames, constant.StringVal(v))
+		}
+	case "Group":
+		s.fail(opt, "group bindings are not supported")
+		return false
+	case "InjectFields", "InjectUnexportedFields":
+		s.fail(opt, "field injection is not supported")
+		return false
+	case "MaxInstances", "MaxConcurrent", "AllowNil":
+	default:
+		s.fail(opt, "cannot evaluate option "+fn.Name())
+		return false
+	}
+	return true
+}
+
+// providerExpr returns the provider as a manifest expression: the qualified
+// name of a package-level function, or the source of a function literal
+// that refers only to package-level names. For anything else, it returns "".
+func (s *scanner) providerExpr(provider ast.Expr) string {
+	switch p := provider.(type) {
+	case *ast.Ident, *ast.SelectorExpr:
+		var id *ast.Ident
+		if sel, ok := p.(*ast.SelectorExpr); ok {
+			id = sel.Sel
+		} else {
+			id = p.(*ast.Ident)
+		}
+		fn, ok := s.info.Uses[id].(*types.Func)
+		if !ok || fn.Type().(*types.Signature).Recv() != nil || fn.Parent() != fn.Pkg().Scope() {
+			return ""
+		}
+		return "{{" + fn.Pkg().Path() + "}}." + fn.Name()
+	case *ast.FuncLit:
+		return s.literalExpr(p)
+	}
+	return ""
+}
+
+// literalExpr returns the source of lit with package qualifiers replaced by
+// placeholders, or "" if lit captures local variables.
+func (s *scanner) literalExpr(lit *ast.FuncLit) string {
+	src, err := os.ReadFile(s.fset.File(lit.Pos()).Name())
+	if err != nil {
+		return ""
+	}
+	base := s.fset.File(lit.Pos()).Base()
+	type edit struct {
+		from, to int
+		text     string
+	}
+	var edits []edit
+	local := false
+	ast.Inspect(lit, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				if pn, ok := s.info.Uses[x].(*types.PkgName); ok {
+					edits = append(edits, edit{int(x.Pos()) - base, int(sel.Sel.Pos()) - base, "{{" + pn.Imported().Path() + "}}."})
+					return false
+				}
+			}
+		}
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := s.info.Uses[id]
+		if obj == nil || obj.Parent() == nil || obj.Parent() == types.Universe || obj.Parent() == s.pkg.Scope() {
+			return true
+		}
+		if obj.Pos() < lit.Pos() || obj.Pos() >= lit.End() {
+			local = true
+		}
+		return true
+	})
+	if local {
+		return ""
+	}
+
+	var b strings.Builder
+	pos := int(lit.Pos()) - base
+	for _, e := range edits {
+		b.Write(src[pos:e.from])
+		b.WriteString(e.text)
+		pos = e.to
+	}
+	b.Write(src[pos : int(lit.End())-base])
+	return b.String()
+}
+
+// location returns the position of n relative to the package directory, so
+// that generated files do not depend on where the package is checked out.
+func (s *scanner) location(n ast.Node) string {
+	p := s.fset.Position(n.Pos())
+	return fmt.Sprintf("%s:%d", filepath.Base(p.Filename), p.Line)
+}
+
+func (s *scanner) fail(n ast.Node, msg string) {
+	s.err = fmt.Errorf("%s: %s", s.fset.Position(n.Pos()), msg)
+}
+
+// valid reports whether the parameter and result types of sig are known.
+func valid(sig *types.Signature) bool {
+	for _, tup := range []*types.Tuple{sig.Params(), sig.Results()} {
+		for i := 0; i < tup.Len(); i++ {
+			if tup.At(i).Type() == types.Typ[types.Invalid] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// typeExpr writes t as a manifest expression.
+func typeExpr(t types.Type) string {
+	return types.TypeString(t, placeholder)
+}
+
+// placeholder qualifies names with the placeholders of manifest
+// expressions.
+func placeholder(p *types.Package) string {
+	return "{{" + p.Path() + "}}"
+}
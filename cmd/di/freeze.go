@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/appliedgo/di"
+)
+
+// freeze generates explicit wiring code from a container manifest. The
+// application writes the manifest of its fully configured container, for
+// example behind a flag:
+//
+//	c.Manifest().WriteTo(f)
+//
+// and freeze turns it into a struct with one method per binding, each calling
+// the binding's constructor with the results of the methods for its
+// parameters:
+//
+//	di freeze -o wire_frozen.go manifest.json
+//
+// Singletons are constructed once. Providers that have no name, such as
+// function literals, cannot be called from generated code; for those, the
+// struct gets an exported field of the provider's function type that the
+// application sets before use.
+func freeze(args []string) error {
+	flags := flag.NewFlagSet("freeze", flag.ContinueOnError)
+	pkg := flags.String("pkg", "main", "package `name` of the generated file")
+	pkgPath := flags.String("pkgpath", "main", "import `path` of the generated file's package")
+	typeName := flags.String("type", "Frozen", "`name` of the generated struct type")
+	out := flags.String("o", "", "write to `file` instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: di freeze [flags] <manifest.json>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("need a manifest file")
+	}
+
+	var m di.Manifest
+	data, err := readInput(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(0), err)
+	}
+
+	g := &frozenGen{
+		tool:    "di freeze",
+		origin:  "as recorded in a\n// di container manifest",
+		pkgPath: *pkgPath,
+		imports: map[string]string{},
+	}
+	code, err := g.generate(*pkg, *typeName, m)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(code)
+		return err
+	}
+	return os.WriteFile(*out, code, 0o644)
+}
+
+// readInput reads the named file, or standard input for "-".
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// frozenGen generates the code for one manifest.
+type frozenGen struct {
+	tool    string // Command named in the "Code generated" header.
+	origin  string // Where the bindings come from, for the type's doc comment.
+	pkgPath string
+	imports map[string]string // Import path to package name.
+}
+
+// qualifierRE matches the placeholders of manifest expressions.
+var qualifierRE = regexp.MustCompile(`\{\{([^}]+)\}\}\.`)
+
+// expr turns a manifest expression into Go code for the generated package,
+// recording the imports it needs.
+func (g *frozenGen) expr(e string) string {
+	return qualifierRE.ReplaceAllStringFunc(e, func(q string) string {
+		p := qualifierRE.FindStringSubmatch(q)[1]
+		if p == g.pkgPath {
+			return ""
+		}
+		return g.importName(p) + "."
+	})
+}
+
+// importName returns the package name to use for import path p.
+func (g *frozenGen) importName(p string) string {
+	if name, ok := g.imports[p]; ok {
+		return name
+	}
+	base := identifier(path.Base(p), false)
+	name := base
+	for i := 2; g.taken(name); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.imports[p] = name
+	return name
+}
+
+func (g *frozenGen) taken(name string) bool {
+	for _, n := range g.imports {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// A frozenBinding is a manifest binding with the names used in the code.
+type frozenBinding struct {
+	di.ManifestBinding
+	method string // Accessor method.
+	field  string // Cache field of singletons.
+}
+
+func (g *frozenGen) generate(pkg, typeName string, m di.Manifest) ([]byte, error) {
+	bindings := make([]*frozenBinding, len(m.Bindings))
+	byKey := map[string]*frozenBinding{}
+	byName := map[string]*frozenBinding{} // By type and name, for aliases.
+	methods := map[string]bool{}
+	for i, mb := range m.Bindings {
+		if len(mb.Fields) > 0 {
+			return nil, fmt.Errorf("binding %s (%s): field injection is not supported", mb.Type, mb.Location)
+		}
+		if mb.Fallible {
+			return nil, fmt.Errorf("binding %s (%s): providers that return an error are not supported", mb.Type, mb.Location)
+		}
+		b := &frozenBinding{ManifestBinding: mb}
+		base := identifier(qualifierRE.ReplaceAllString(mb.Type, ""), true)
+		if mb.Name != "" {
+			base += identifier(mb.Name, true)
+		}
+		b.method = base
+		for n := 2; methods[b.method]; n++ {
+			b.method = fmt.Sprintf("%s%d", base, n)
+		}
+		methods[b.method] = true
+		b.field = identifier(b.method, false)
+		bindings[i] = b
+		if mb.Name == "" {
+			byKey[mb.Type] = b
+		}
+		byName[mb.Type+"\x00"+mb.Name] = b
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "// %s wires the application with plain function calls, %s.\n", typeName, g.origin)
+	fmt.Fprintf(&body, "// Use a pointer to a zero %s.\n", typeName)
+	fmt.Fprintf(&body, "type %s struct {\n", typeName)
+	for _, b := range bindings {
+		if b.Provider == "" && b.Alias == "" {
+			fmt.Fprintf(&body, "\t// %sProvider must be set before use. It replaces the provider at\n\t// %s.\n", b.method, b.Location)
+			params := g.exprs(b.Params)
+			if b.Variadic {
+				// The slice type of the last parameter becomes ...T.
+				last := g.expr(b.Params[len(b.Params)-1])
+				params = strings.TrimSuffix(params, last) + "..." + strings.TrimPrefix(last, "[]")
+			}
+			fmt.Fprintf(&body, "\t%sProvider func(%s) %s\n", b.method, params, g.expr(b.Result))
+		}
+	}
+	for _, b := range bindings {
+		if b.Lifetime == di.Singleton.String() && b.Alias == "" {
+			fmt.Fprintf(&body, "\n\t%sOnce sync.Once\n\t%s %s\n", b.field, b.field, g.expr(b.Type))
+		}
+	}
+	fmt.Fprintf(&body, "}\n")
+
+	for _, b := range bindings {
+		if b.Alias != "" {
+			target, ok := byName[b.Alias+"\x00"+b.Name]
+			if !ok {
+				return nil, fmt.Errorf("binding %s (%s): no binding for alias target %s", b.Type, b.Location, b.Alias)
+			}
+			fmt.Fprintf(&body, "\n// %s returns the %s binding of %s as %s.\n", b.method, b.Lifetime, g.expr(b.Alias), g.expr(b.Type))
+			fmt.Fprintf(&body, "func (f *%s) %s() %s {\n\treturn f.%s()\n}\n", typeName, b.method, g.expr(b.Type), target.method)
+			continue
+		}
+		args := make([]string, 0, len(b.Params))
+		for i, p := range b.Params {
+			if p == "{{context}}.Context" {
+				// There is no ResolveCtx to pass a context down.
+				args = append(args, g.importName("context")+".Background()")
+				continue
+			}
+			dep, ok := byKey[p]
+			if i < len(b.ParamNames) && b.ParamNames[i] != "" {
+				dep, ok = byName[p+"\x00"+b.ParamNames[i]]
+				p = fmt.Sprintf("%s (named %q)", p, b.ParamNames[i])
+			}
+			variadic := b.Variadic && i == len(b.Params)-1
+			switch {
+			case !ok && variadic:
+				// The manifest has no groups, so without a binding for the
+				// slice, the constructor gets no variadic arguments.
+			case !ok:
+				return nil, fmt.Errorf("binding %s (%s): no binding for parameter %s", b.Type, b.Location, p)
+			case variadic:
+				args = append(args, "f."+dep.method+"()...")
+			default:
+				args = append(args, "f."+dep.method+"()")
+			}
+		}
+		call := g.expr(b.Provider)
+		if b.Provider == "" {
+			call = "f." + b.method + "Provider"
+		}
+		call += "(" + strings.Join(args, ", ") + ")"
+
+		fmt.Fprintf(&body, "\n// %s returns the %s binding of %s.\n", b.method, b.Lifetime, g.expr(b.Type))
+		fmt.Fprintf(&body, "func (f *%s) %s() %s {\n", typeName, b.method, g.expr(b.Type))
+		if b.Lifetime == di.Singleton.String() {
+			fmt.Fprintf(&body, "\tf.%sOnce.Do(func() {\n\t\tf.%s = %s\n\t})\n\treturn f.%s\n", b.field, b.field, call, b.field)
+		} else {
+			fmt.Fprintf(&body, "\treturn %s\n", call)
+		}
+		fmt.Fprintf(&body, "}\n")
+	}
+
+	var imports []string
+	if strings.Contains(body.String(), "sync.Once") {
+		imports = append(imports, "sync")
+	}
+	header := fmt.Sprintf("// Code generated by %q; DO NOT EDIT.", g.tool)
+	return g.source(header, pkg, body.Bytes(), imports...)
+}
+
+// source assembles and formats a Go file from a header comment, the package
+// clause, the imports that the generated expressions need plus extra, and
+// body.
+func (g *frozenGen) source(header, pkg string, body []byte, extra ...string) ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s\n\npackage %s\n\n", header, pkg)
+	paths := make([]string, 0, len(g.imports))
+	for p := range g.imports {
+		paths = append(paths, p)
+	}
+	paths = append(paths, extra...)
+	// Standard library imports first, as goimports would have it.
+	sort.Slice(paths, func(i, j int) bool {
+		si, sj := isStd(paths[i]), isStd(paths[j])
+		if si != sj {
+			return si
+		}
+		return paths[i] < paths[j]
+	})
+	if len(paths) > 0 {
+		fmt.Fprintf(&out, "import (\n")
+		for i, p := range paths {
+			if i > 0 && isStd(paths[i-1]) && !isStd(p) {
+				fmt.Fprintf(&out, "\n")
+			}
+			if name, ok := g.imports[p]; ok && name != path.Base(p) {
+				fmt.Fprintf(&out, "\t%s %q\n", name, p)
+				continue
+			}
+			fmt.Fprintf(&out, "\t%q\n", p)
+		}
+		fmt.Fprintf(&out, ")\n\n")
+	}
+	out.Write(body)
+	return format.Source(out.Bytes())
+}
+
+// isStd reports whether the import path p belongs to the standard library.
+func isStd(p string) bool {
+	return !strings.Contains(strings.SplitN(p, "/", 2)[0], ".")
+}
+
+// exprs converts a list of manifest expressions.
+func (g *frozenGen) exprs(es []string) string {
+	converted := make([]string, len(es))
+	for i, e := range es {
+		converted[i] = g.expr(e)
+	}
+	return strings.Join(converted, ", ")
+}
+
+// identifier turns s into a Go identifier by dropping everything but letters
+// and digits and capitalizing word starts. exported selects the case of the
+// first letter.
+func identifier(s string, exported bool) string {
+	var b strings.Builder
+	upper := exported
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() > 0 || exported
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			if exported {
+				b.WriteRune('X')
+			} else {
+				b.WriteRune('x')
+			}
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+		} else if b.Len() == 0 {
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+		upper = false
+	}
+	if b.Len() == 0 {
+		return "x"
+	}
+	return b.String()
+}
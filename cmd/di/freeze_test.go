@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+// The golden file of freeze is code that compiles against the constructors
+// that its manifest names.
+func TestFrozenCompiles(t *testing.T) {
+	typeCheck(t, "testdata/freeze/wire_frozen.go.golden", "main")
+}
+
+func TestFreezeErrors(t *testing.T) {
+	const p = "{{example.com/poems}}."
+	binding := func(typ string, params ...string) di.ManifestBinding {
+		return di.ManifestBinding{Type: typ, Lifetime: "transient", Params: params, Result: typ, Provider: p + "New", Location: "poems.go:1"}
+	}
+	for _, tt := range []struct {
+		name     string
+		bindings []di.ManifestBinding
+		want     string // Part of the error.
+	}{
+		{
+			name: "field injection",
+			bindings: []di.ManifestBinding{func() di.ManifestBinding {
+				b := binding(p + "Server")
+				b.Fields = []di.ManifestField{{Name: "Log"}}
+				return b
+			}()},
+			want: "field injection is not supported",
+		},
+		{
+			name:     "provider with an error",
+			bindings: []di.ManifestBinding{func() di.ManifestBinding { b := binding(p + "Server"); b.Fallible = true; return b }()},
+			want:     "providers that return an error are not supported",
+		},
+		{
+			name:     "missing parameter",
+			bindings: []di.ManifestBinding{binding(p+"Server", p+"Config")},
+			want:     "no binding for parameter " + p + "Config",
+		},
+		{
+			name: "missing named parameter",
+			bindings: []di.ManifestBinding{binding(p + "Config"), func() di.ManifestBinding {
+				b := binding(p+"Server", p+"Config")
+				b.ParamNames = []string{"backup"}
+				return b
+			}()},
+			want: `(named "backup")`,
+		},
+		{
+			name:     "missing alias target",
+			bindings: []di.ManifestBinding{{Type: p + "Storage", Lifetime: "singleton", Result: "*" + p + "Files", Alias: "*" + p + "Files"}},
+			want:     "no binding for alias target",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := filepath.Join(t.TempDir(), "manifest.json")
+			data, _ := json.Marshal(di.Manifest{Bindings: tt.bindings})
+			os.WriteFile(manifest, data, 0o644)
+			err := freeze([]string{"-o", filepath.Join(t.TempDir(), "out.go"), manifest})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+
+	bad := filepath.Join(t.TempDir(), "manifest.json")
+	os.WriteFile(bad, []byte("{"), 0o644)
+	if err := freeze([]string{bad}); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("bad JSON: got %v, want an error that names the file", err)
+	}
+	if err := freeze(nil); err == nil {
+		t.Error("freeze without a manifest succeeded")
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	for _, tt := range []struct {
+		in       string
+		exported bool
+		want     string
+	}{
+		{"*Files", true, "Files"},
+		{"[]Handler", true, "Handler"},
+		{"map[string]int", true, "MapStringInt"},
+		{"read-only", false, "readOnly"},
+		{"Files", false, "files"},
+		{"2fa", true, "X2fa"},
+		{"***", false, "x"},
+	} {
+		if got := identifier(tt.in, tt.exported); got != tt.want {
+			t.Errorf("identifier(%q, %t) = %q, want %q", tt.in, tt.exported, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the generated code")
+
+// goldenTests run a generator with the output file appended to args, and
+// compare what it writes with the golden file.
+var goldenTests = []struct {
+	name   string
+	run    func(args []string) error
+	args   func(out string) []string
+	golden string
+}{
+	{
+		name:   "digen",
+		run:    digen,
+		args:   func(out string) []string { return []string{"-o", out, "testdata/digen"} },
+		golden: "testdata/digen/wire_gen.go.golden",
+	},
+	{
+		name: "api",
+		run:  stdoutTo(api),
+		args: func(out string) []string {
+			return []string{out, "github.com/appliedgo/di/cmd/di/testdata/api"}
+		},
+		golden: "testdata/api/api.txt.golden",
+	},
+	{
+		name:   "freeze",
+		run:    freeze,
+		args:   func(out string) []string { return []string{"-o", out, "testdata/freeze/manifest.json"} },
+		golden: "testdata/freeze/wire_frozen.go.golden",
+	},
+	{
+		name: "contract/PoemStorage",
+		run:  contract,
+		args: func(out string) []string {
+			return []string{"-o", out, "github.com/appliedgo/di/cmd/di/testdata/mock/poems.PoemStorage"}
+		},
+		golden: "testdata/contract/poemstorage_contract.go.golden",
+	},
+	{
+		name: "contract/Cache",
+		run:  contract,
+		args: func(out string) []string {
+			return []string{"-o", out, "-pkg", "contract_test", "-pkgpath", "github.com/appliedgo/di/cmd/di/testdata/contract_test",
+				"github.com/appliedgo/di/cmd/di/testdata/contract.Cache"}
+		},
+		golden: "testdata/contract/cache_contract.go.golden",
+	},
+	{
+		name: "mock/Store",
+		run:  mock,
+		args: func(out string) []string {
+			return []string{"-o", out, "github.com/appliedgo/di/cmd/di/testdata/mock.Store"}
+		},
+		golden: "testdata/mock/store.go.golden",
+	},
+	{
+		name: "mock/PoemStorage",
+		run:  mock,
+		args: func(out string) []string {
+			return []string{"-o", out, "github.com/appliedgo/di/cmd/di/testdata/mock/poems.PoemStorage"}
+		},
+		golden: "testdata/mock/poemstorage.go.golden",
+	},
+}
+
+// stdoutTo adapts a command that writes to standard output: its first
+// argument is the file that receives the output.
+func stdoutTo(run func(args []string) error) func(args []string) error {
+	return func(args []string) error {
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		saved := os.Stdout
+		os.Stdout = f
+		defer func() { os.Stdout = saved }()
+		return run(args[1:])
+	}
+}
+
+func TestGolden(t *testing.T) {
+	for _, tt := range goldenTests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), filepath.Base(tt.golden))
+			if err := tt.run(tt.args(out)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *update {
+				if err := os.WriteFile(tt.golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(tt.golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s is out of date; run go test -run TestGolden -update\n%s", tt.golden, lineDiff(want, got))
+			}
+		})
+	}
+}
+
+// lineDiff describes the first line in which got differs from want.
+func lineDiff(want, got []byte) string {
+	w, g := bytes.Split(want, []byte("\n")), bytes.Split(got, []byte("\n"))
+	for i := 0; i < len(w) || i < len(g); i++ {
+		var wl, gl []byte
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if !bytes.Equal(wl, gl) {
+			return fmt.Sprintf("line %d:\n\twant: %s\n\tgot:  %s", i+1, wl, gl)
+		}
+	}
+	return ""
+}
+
+// typeCheck checks that the generated code in the golden file compiles as
+// the package pkg.
+func typeCheck(t *testing.T, golden, pkg string) {
+	t.Helper()
+	src, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filepath.Base(golden), src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(pkg, fset, []*ast.File{f}, nil); err != nil {
+		t.Error(err)
+	}
+}
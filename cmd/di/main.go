@@ -0,0 +1,70 @@
+// Command di contains tools that support applications built with package di.
+//
+// Usage:
+//
+//	di <command> [arguments]
+//
+// The commands are:
+//
+//	api       print the exported API of packages
+//	apidiff   compare two API files and report breaking changes
+//	compat    check that an implementation satisfies a consumer's interface
+//	contract  generate a contract test skeleton for an interface
+//	digen     generate reflection-free wiring code from registrations in source
+//	freeze    generate reflection-free wiring code from a container manifest
+//	mock      generate a configurable mock of an interface
+//	trace     print a container construction trace as a tree
+//
+// Run "di <command> -h" for the arguments of a command.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// A command is a subcommand of di. It returns an error to make di exit with
+// a non-zero status.
+type command struct {
+	name  string
+	short string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"api", "print the exported API of packages", api},
+	{"apidiff", "compare two API files and report breaking changes", apidiff},
+	{"compat", "check that an implementation satisfies a consumer's interface", compat},
+	{"contract", "generate a contract test skeleton for an interface", contract},
+	{"digen", "generate reflection-free wiring code from registrations in source", digen},
+	{"freeze", "generate reflection-free wiring code from a container manifest", freeze},
+	{"mock", "generate a configurable mock of an interface", mock},
+	{"trace", "print a container construction trace as a tree", trace},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "di %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "di: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: di <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.short)
+	}
+}
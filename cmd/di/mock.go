@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+)
+
+// mock generates a configurable mock of an interface, for tests that
+// replace a dependency with a double:
+//
+//	di mock -o mock_storage_test.go example.com/poems.PoemStorage
+//
+// The mock records every call. What a method does is up to its Func field,
+// such as LoadFunc for Load, or, for canned results, its Returns method,
+// such as LoadReturns. Methods without either return zero values. The mock
+// can be put into a container in place of the real implementation:
+//
+//	m := &MockPoemStorage{}
+//	m.LoadReturns([]byte("A poem from a notebook mockup."))
+//	di.OverrideValue[PoemStorage](c, m)
+//
+// With -check, mock compares the generated code with the output file and
+// fails if they differ.
+func mock(args []string) error {
+	flags := flag.NewFlagSet("mock", flag.ContinueOnError)
+	dir := flags.String("C", ".", "resolve packages from the module in `dir`")
+	pkg := flags.String("pkg", "", "package `name` of the generated file (default: the interface's package)")
+	pkgPath := flags.String("pkgpath", "", "import `path` of the generated file's package (default: the interface's package)")
+	typeName := flags.String("type", "", "`name` of the mock type (default: Mock followed by the interface's name)")
+	out := flags.String("o", "", "write to `file` instead of standard output")
+	check := flags.Bool("check", false, "compare with the output file instead of writing it")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: di mock [flags] <pkg>.<Interface>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("need an interface")
+	}
+
+	imp := importer.ForCompiler(token.NewFileSet(), "source", nil).(types.ImporterFrom)
+	t, err := lookupType(imp, *dir, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return fmt.Errorf("%s is not an interface", flags.Arg(0))
+	}
+	iface, ok := named.Underlying().(*types.Interface)
+	if !ok {
+		return fmt.Errorf("%s is not an interface", flags.Arg(0))
+	}
+	if named.TypeParams().Len() > 0 {
+		return fmt.Errorf("%s: generic interfaces are not supported", flags.Arg(0))
+	}
+	if *pkg == "" {
+		*pkg = named.Obj().Pkg().Name()
+	}
+	if *pkgPath == "" {
+		*pkgPath = named.Obj().Pkg().Path()
+	}
+	if *typeName == "" {
+		*typeName = "Mock" + named.Obj().Name()
+	}
+
+	g := &frozenGen{pkgPath: *pkgPath, imports: map[string]string{}}
+	code, err := g.mock(*pkg, *typeName, named, iface)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *check:
+		old, err := os.ReadFile(*out)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(old, code) {
+			return fmt.Errorf("%s is out of date; run di mock", *out)
+		}
+		return nil
+	case *out == "":
+		_, err = os.Stdout.Write(code)
+		return err
+	}
+	return os.WriteFile(*out, code, 0o644)
+}
+
+// A mockParam is a parameter of a mocked method.
+type mockParam struct {
+	name  string // Name of the parameter in the generated method.
+	field string // Name of the field that records it.
+	typ   string // Type of the field; variadic parameters are slices.
+}
+
+// mock generates the mock type typeName for iface, which is named by named.
+func (g *frozenGen) mock(pkg, typeName string, named *types.Named, iface *types.Interface) ([]byte, error) {
+	name := named.Obj().Name()
+	ifaceType := g.expr(typeExpr(named))
+
+	var methods []*types.Func
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		if !m.Exported() && m.Pkg().Path() != g.pkgPath {
+			return nil, fmt.Errorf("%s: unexported method %s cannot be implemented outside of package %s", name, m.Name(), m.Pkg().Path())
+		}
+		methods = append(methods, m)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "// %s is a mock of %s. Every call is recorded, and can be\n", typeName, name)
+	fmt.Fprintf(&body, "// inspected with the method's Calls method. Set a method's Func field to\n")
+	fmt.Fprintf(&body, "// control what it does, or call its Returns method for canned results;\n")
+	fmt.Fprintf(&body, "// methods without either return zero values. Set Func fields before the\n")
+	fmt.Fprintf(&body, "// mock is used; the other methods are safe for concurrent use.\n")
+	fmt.Fprintf(&body, "type %s struct {\n", typeName)
+	for _, m := range methods {
+		sig := m.Type().(*types.Signature)
+		fmt.Fprintf(&body, "\t%sFunc func%s\n", m.Name(), g.expr(signature(sig, placeholder)))
+	}
+	fmt.Fprintf(&body, "\n\tmu sync.Mutex\n")
+	for _, m := range methods {
+		fmt.Fprintf(&body, "\t%sCalls []%s%sCall\n", identifier(m.Name(), false), typeName, m.Name())
+	}
+	fmt.Fprintf(&body, "}\n\n")
+	fmt.Fprintf(&body, "var _ %s = (*%s)(nil)\n", ifaceType, typeName)
+
+	for _, m := range methods {
+		sig := m.Type().(*types.Signature)
+		params := g.mockParams(sig)
+		callType := typeName + m.Name() + "Call"
+		calls := identifier(m.Name(), false) + "Calls"
+
+		fmt.Fprintf(&body, "\n// %s records a call of %s.\n", callType, m.Name())
+		fmt.Fprintf(&body, "type %s struct {\n", callType)
+		for _, p := range params {
+			fmt.Fprintf(&body, "\t%s %s\n", p.field, p.typ)
+		}
+		fmt.Fprintf(&body, "}\n")
+
+		// The method itself. Named results make zero values easy to return.
+		var decl, args, fields []string
+		for i, p := range params {
+			typ := p.typ
+			arg := p.name
+			if sig.Variadic() && i == len(params)-1 {
+				typ = "..." + strings.TrimPrefix(typ, "[]")
+				arg += "..."
+			}
+			decl = append(decl, p.name+" "+typ)
+			args = append(args, arg)
+			fields = append(fields, p.field+": "+p.name)
+		}
+		var results []string
+		for i := 0; i < sig.Results().Len(); i++ {
+			results = append(results, fmt.Sprintf("r%d %s", i, g.expr(typeExpr(sig.Results().At(i).Type()))))
+		}
+		resultList := ""
+		if len(results) > 0 {
+			resultList = " (" + strings.Join(results, ", ") + ")"
+		}
+		fmt.Fprintf(&body, "\n// %s records the call and calls %sFunc.\n", m.Name(), m.Name())
+		fmt.Fprintf(&body, "func (m *%s) %s(%s)%s {\n", typeName, m.Name(), strings.Join(decl, ", "), resultList)
+		fmt.Fprintf(&body, "\tm.mu.Lock()\n")
+		fmt.Fprintf(&body, "\tm.%s = append(m.%s, %s{%s})\n", calls, calls, callType, strings.Join(fields, ", "))
+		fmt.Fprintf(&body, "\tfn := m.%sFunc\n", m.Name())
+		fmt.Fprintf(&body, "\tm.mu.Unlock()\n")
+		if len(results) > 0 {
+			fmt.Fprintf(&body, "\tif fn == nil {\n\t\treturn\n\t}\n")
+			fmt.Fprintf(&body, "\treturn fn(%s)\n", strings.Join(args, ", "))
+		} else {
+			fmt.Fprintf(&body, "\tif fn != nil {\n\t\tfn(%s)\n\t}\n", strings.Join(args, ", "))
+		}
+		fmt.Fprintf(&body, "}\n")
+
+		// Canned results.
+		if len(results) > 0 {
+			var names []string
+			for i := range results {
+				names = append(names, fmt.Sprintf("r%d", i))
+			}
+			fmt.Fprintf(&body, "\n// %sReturns makes %s return the given results.\n", m.Name(), m.Name())
+			fmt.Fprintf(&body, "func (m *%s) %sReturns(%s) {\n", typeName, m.Name(), strings.Join(results, ", "))
+			fmt.Fprintf(&body, "\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n")
+			fmt.Fprintf(&body, "\tm.%sFunc = func%s {\n\t\treturn %s\n\t}\n", m.Name(), g.expr(signature(sig, placeholder)), strings.Join(names, ", "))
+			fmt.Fprintf(&body, "}\n")
+		}
+
+		fmt.Fprintf(&body, "\n// %sCalls returns the calls of %s so far.\n", m.Name(), m.Name())
+		fmt.Fprintf(&body, "func (m *%s) %sCalls() []%s {\n", typeName, m.Name(), callType)
+		fmt.Fprintf(&body, "\tm.mu.Lock()\n\tdefer m.mu.Unlock()\n")
+		fmt.Fprintf(&body, "\treturn append([]%s(nil), m.%s...)\n", callType, calls)
+		fmt.Fprintf(&body, "}\n")
+	}
+
+	header := `// Code generated by "di mock"; DO NOT EDIT.`
+	return g.source(header, pkg, body.Bytes(), "sync")
+}
+
+// mockParams names the parameters of sig. Parameters keep their names from
+// the interface where they have one that does not clash with the generated
+// code; the others are numbered.
+func (g *frozenGen) mockParams(sig *types.Signature) []mockParam {
+	params := make([]mockParam, sig.Params().Len())
+	taken := map[string]bool{"m": true, "fn": true}
+	for i := 0; i < sig.Results().Len(); i++ {
+		taken[fmt.Sprintf("r%d", i)] = true
+	}
+	fields := map[string]bool{}
+	for i := range params {
+		v := sig.Params().At(i)
+		name := v.Name()
+		if name == "" || name == "_" || taken[name] || token.IsKeyword(name) {
+			name = fmt.Sprintf("p%d", i)
+		}
+		taken[name] = true
+		field := identifier(name, true)
+		if fields[field] {
+			field = fmt.Sprintf("P%d", i)
+		}
+		fields[field] = true
+		params[i] = mockParam{name: name, field: field, typ: g.expr(typeExpr(v.Type()))}
+	}
+	return params
+}
@@ -0,0 +1,54 @@
+// Package api has a bit of every kind of declaration, for the golden file
+// of "di api".
+package api
+
+import (
+	"context"
+	"io"
+)
+
+// Version is a constant.
+const Version = "1.0"
+
+// Default is a variable.
+var Default = &Store{}
+
+// ErrMissing is an error.
+var ErrMissing = io.EOF
+
+// Store is a struct with exported and unexported fields and methods on the
+// value and the pointer.
+type Store struct {
+	Name  string
+	Limit int
+	io.Closer
+
+	items map[string][]byte
+}
+
+func (s Store) Len() int                                            { return len(s.items) }
+func (s *Store) Get(ctx context.Context, key string) ([]byte, bool) { return nil, false }
+func (s *Store) Put(key string, values ...[]byte) error             { return nil }
+func (s *Store) reset()                                             {}
+
+// Getter is an interface.
+type Getter interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	unexported()
+}
+
+// Key is a defined type with a method.
+type Key string
+
+func (k Key) String() string { return string(k) }
+
+// Open is a function.
+func Open(name string, opts ...Option) (*Store, error) { return nil, nil }
+
+// Option is a function type.
+type Option func(*Store)
+
+// Map is a generic function.
+func Map[T any, U comparable](in []T, fn func(T) U) []U { return nil }
+
+func helper() {}
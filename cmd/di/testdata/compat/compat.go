@@ -0,0 +1,32 @@
+// Package compat has an interface and implementations of it for the tests
+// of "di compat".
+package compat
+
+import "context"
+
+// Store is the consumer's interface.
+type Store interface {
+	Save(ctx context.Context, name string, data []byte) error
+	Load(ctx context.Context, name string) ([]byte, error)
+}
+
+// Files implements Store with pointer receivers.
+type Files struct{}
+
+func (*Files) Save(context.Context, string, []byte) error   { return nil }
+func (*Files) Load(context.Context, string) ([]byte, error) { return nil, nil }
+
+// Memory implements Store with value receivers.
+type Memory struct{}
+
+func (Memory) Save(context.Context, string, []byte) error   { return nil }
+func (Memory) Load(context.Context, string) ([]byte, error) { return nil, nil }
+
+// Drifted is an implementation that drifted from Store: Save lost its
+// context, and Load is gone.
+type Drifted struct{}
+
+func (Drifted) Save(string, []byte) error { return nil }
+
+// Embedded implements Store through the Files it embeds.
+type Embedded struct{ *Files }
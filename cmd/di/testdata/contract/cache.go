@@ -0,0 +1,16 @@
+// Package contract has an interface for the golden file of "di contract".
+package contract
+
+import "context"
+
+// Cache has two pairs of methods that store and retrieve, and methods that
+// look like they do but do not match.
+type Cache interface {
+	Set(ctx context.Context, key string, value []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(key string, n int)
+	Lookup(key string) (int, bool)
+	Fetch(ctx context.Context, key string) string // Set stores []byte.
+	Add(n int)                                    // Nothing to retrieve by.
+	Len() int
+}
@@ -0,0 +1,59 @@
+// Package main is the input of the golden test for "di digen", which
+// compares the generator's output with wire_gen.go.golden:
+//
+//	go test ./cmd/di -run TestGolden
+//
+// If the differences are intended, regenerate the golden file with
+// -update.
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/appliedgo/di"
+)
+
+type Greeter interface{ Greet() string }
+
+type english struct{ name string }
+
+func (e english) Greet() string { return "Hello, " + e.name }
+
+func NewGreeter(name string) Greeter { return english{name} }
+
+type Banner struct{ Text string }
+
+func NewBanner(g Greeter) *Banner { return &Banner{strings.ToUpper(g.Greet())} }
+
+func (b *Banner) String() string { return b.Text }
+
+type Config struct{ Name string }
+
+type Letter struct{ Body string }
+
+func NewLetter(g Greeter, closing string) *Letter { return &Letter{g.Greet() + "\n" + closing} }
+
+func main() {
+	c := di.New()
+	di.Register(c, func() string { return strings.TrimSpace(" world ") })
+	c.Provide(NewGreeter, di.WithLifetime(di.Singleton))
+	c.RegisterSingleton(func() Greeter { return english{"formal world"} }, di.Named("formal"))
+
+	// Replaced by the provider below, as in the container.
+	c.Provide(func(g Greeter) *Banner { return &Banner{g.Greet()} })
+	c.Provide(NewBanner, di.MaxInstances(3), di.As(new(fmt.Stringer)))
+
+	// Both parameters are named bindings.
+	di.Value(c, "closing", "Yours truly")
+	c.Provide(NewLetter, di.ParamNames("formal", "closing"))
+
+	cfg := Config{Name: "local"}
+	c.Register(func() *Config { return &cfg })
+
+	if err := c.Install(di.Module("log", di.Provide(log.Default))); err != nil {
+		log.Fatal(err)
+	}
+	log.Println(di.MustResolve[*Banner](c).Text)
+}
@@ -0,0 +1,34 @@
+// Package freeze has the constructors of the manifest.json that the golden
+// file of "di freeze" is generated from.
+package freeze
+
+import "context"
+
+type Config struct{ Dir string }
+
+func NewConfig() Config { return Config{Dir: "poems"} }
+
+type Storage interface {
+	Load(name string) []byte
+}
+
+type Files struct{ dir string }
+
+func NewFiles(cfg Config) *Files         { return &Files{dir: cfg.Dir} }
+func (f *Files) Load(name string) []byte { return nil }
+
+type Logger struct{}
+
+func NewLogger(ctx context.Context) *Logger { return &Logger{} }
+
+type Handler interface{}
+
+type Server struct {
+	storage  Storage
+	backup   *Files
+	handlers []Handler
+}
+
+func NewServer(s Storage, backup *Files, l *Logger, hs ...Handler) *Server {
+	return &Server{storage: s, backup: backup, handlers: hs}
+}
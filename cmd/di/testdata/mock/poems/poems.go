@@ -0,0 +1,12 @@
+// Package main has the interface of the example as it was when "di mock"
+// came along, for the golden file poemstorage.go.golden.
+package main
+
+// PoemStorage is the storage of poems.
+type PoemStorage interface {
+	Type() string        // Return a string describing the storage type.
+	Load(string) []byte  // Load a poem by name.
+	Save(string, []byte) // Save a poem by name.
+}
+
+func main() {}
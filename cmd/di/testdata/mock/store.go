@@ -0,0 +1,17 @@
+// Package mock has interfaces for the golden files of "di mock".
+package mock
+
+import (
+	"context"
+	"io"
+)
+
+// Store exercises what mocks must handle: parameter names that clash with
+// the generated code, variadic parameters, several results, and types from
+// other packages.
+type Store interface {
+	io.Closer
+	Get(ctx context.Context, m string) ([]byte, bool, error)
+	Put(ctx context.Context, key string, values ...[]byte) error
+	Watch(_ context.Context, fn func(string), r0 int) <-chan struct{}
+}
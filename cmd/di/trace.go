@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/appliedgo/di"
+)
+
+// trace prints a construction trace, written by a container after TraceTo,
+// as a tree: every value the container built, with the values built for it
+// indented below, the types that went in and came out, and how long it
+// took. Constructions that began but never finished, typically because the
+// program crashed inside a provider, are marked as such.
+//
+//	di trace startup.jsonl
+func trace(args []string) error {
+	flags := flag.NewFlagSet("trace", flag.ContinueOnError)
+	failed := flags.Bool("failed", false, "show only failed or unfinished constructions and their consumers")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: di trace [-failed] <trace file>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("need a trace file")
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	events, err := di.ReadTrace(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(0), err)
+	}
+
+	for _, n := range buildTraceTree(events) {
+		printTraceNode(n, 0, *failed)
+	}
+	return nil
+}
+
+// A traceNode is one resolution in the trace, with the resolutions of its
+// dependencies as children.
+type traceNode struct {
+	binding  string
+	provider string
+	args     []string
+	end      *di.TraceEvent // nil if the construction never finished.
+	reused   bool
+	children []*traceNode
+}
+
+// buildTraceTree replays the events in order. "begin" opens a node at its
+// depth, "done" and "fail" close it, "reuse" and a "fail" without "begin"
+// (no provider registered) are leaves.
+func buildTraceTree(events []di.TraceEvent) []*traceNode {
+	var roots []*traceNode
+	var open []*traceNode // Open constructions, indexed by depth.
+	add := func(depth int, n *traceNode) {
+		if depth == 0 || depth > len(open) {
+			roots = append(roots, n)
+			return
+		}
+		parent := open[depth-1]
+		parent.children = append(parent.children, n)
+	}
+	for i := range events {
+		e := &events[i]
+		switch e.Kind {
+		case "begin":
+			n := &traceNode{binding: e.Binding, provider: e.Provider}
+			add(e.Depth, n)
+			open = append(open[:min(e.Depth, len(open))], n)
+		case "call":
+			if e.Depth < len(open) {
+				open[e.Depth].args = e.Args
+			}
+		case "done", "fail":
+			if e.Depth < len(open) && open[e.Depth].binding == e.Binding && open[e.Depth].end == nil {
+				open[e.Depth].end = e
+				open = open[:e.Depth]
+				continue
+			}
+			add(e.Depth, &traceNode{binding: e.Binding, end: e})
+		case "reuse":
+			add(e.Depth, &traceNode{binding: e.Binding, provider: e.Provider, reused: true})
+		}
+	}
+	return roots
+}
+
+// printTraceNode prints n and its children. With failedOnly, it skips
+// subtrees without failures.
+func printTraceNode(n *traceNode, indent int, failedOnly bool) {
+	if failedOnly && !n.hasFailure() {
+		return
+	}
+	prefix := strings.Repeat("  ", indent)
+	switch {
+	case n.reused:
+		fmt.Printf("%s= %s (reused singleton)\n", prefix, n.binding)
+	case n.end == nil:
+		fmt.Printf("%s! %s [%s] never finished%s\n", prefix, n.binding, n.provider, formatArgs(n.args))
+	case n.end.Kind == "fail":
+		fmt.Printf("%s! %s failed: %s\n", prefix, n.binding, n.end.Error)
+	default:
+		fmt.Printf("%s+ %s [%s]%s -> %s in %v\n", prefix, n.binding, n.provider, formatArgs(n.args), n.end.Result, n.end.Duration)
+	}
+	for _, c := range n.children {
+		printTraceNode(c, indent+1, failedOnly)
+	}
+}
+
+func (n *traceNode) hasFailure() bool {
+	if !n.reused && (n.end == nil || n.end.Kind == "fail") {
+		return true
+	}
+	for _, c := range n.children {
+		if c.hasFailure() {
+			return true
+		}
+	}
+	return false
+}
+
+func formatArgs(args []string) string {
+	if args == nil {
+		return ""
+	}
+	return " (" + strings.Join(args, ", ") + ")"
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
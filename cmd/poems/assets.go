@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Static assets
+//
+// The pages of the web UI have a style sheet. Browsers should cache it for
+// as long as it does not change, and fetch it at once when it does. So the
+// pages do not link to "style.css" but to a name with a hash of the
+// contents, such as "style.1c3f9a2b7e4d.css": a new version gets a new
+// name, and the old name can be cached forever.
+//
+// Nothing of this is specific to poems. `AssetsModule` bundles it as a
+// module that any program with a web UI can install: the embedded files,
+// the `Assets` handler, the function `asset` for templates, and a
+// `CachePolicy` for each profile. The program routes "/static/" to the
+// `Assets`, and templates link to `{{asset "style.css"}}`.
+
+// `AssetsModule` serves the files embedded from `static/`.
+var AssetsModule = di.Module("assets",
+	di.Provide(embeddedAssets, di.Named("assets")),
+	di.Provide(NewAssets, di.ParamNames("assets"), di.WithLifetime(di.Singleton)),
+	di.Provide(func(a *Assets) template.FuncMap { return a.Funcs() }, di.Group(), di.Named("templates.funcs")),
+	di.Profile("dev", di.Provide(func() CachePolicy { return Revalidate{} })),
+	di.Profile("prod", di.Provide(func() CachePolicy { return Immutable{MaxAge: 365 * 24 * time.Hour} })),
+)
+
+//go:embed static
+var static embed.FS
+
+// `embeddedAssets` returns the assets embedded in the program.
+func embeddedAssets() fs.FS {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // The directory is embedded, so this cannot fail.
+	}
+	return sub
+}
+
+// A `CachePolicy` decides how long browsers may cache an asset.
+type CachePolicy interface {
+	// `CacheControl` returns the Cache-Control header for an asset that
+	// was requested by its hashed name, or by its plain name.
+	CacheControl(hashed bool) string
+}
+
+// `Revalidate` makes browsers ask for every asset again, so that edits
+// show up on the next reload.
+type Revalidate struct{}
+
+func (Revalidate) CacheControl(bool) string { return "no-cache" }
+
+// `Immutable` lets browsers keep assets with hashed names for `MaxAge`
+// without asking. Plain names are revalidated, as their contents change.
+type Immutable struct {
+	MaxAge time.Duration
+}
+
+func (p Immutable) CacheControl(hashed bool) string {
+	if !hashed {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d, immutable", int(p.MaxAge.Seconds()))
+}
+
+// `Assets` serves the files of a file system under "/static/", by their
+// plain names and by their hashed names.
+type Assets struct {
+	policy CachePolicy
+	hashed map[string]string // Hashed names by plain name.
+	files  map[string]*asset // Assets by plain and hashed name.
+}
+
+// An `asset` is the contents of a file and its hash.
+type asset struct {
+	contents []byte
+	hash     string
+}
+
+// `assetPrefix` is the path under which `Assets` serves.
+const assetPrefix = "/static/"
+
+// `NewAssets` reads and hashes the files of `files`, and serves them with
+// the Cache-Control headers of `policy`.
+func NewAssets(files fs.FS, policy CachePolicy) (*Assets, error) {
+	a := &Assets{
+		policy: policy,
+		hashed: map[string]string{},
+		files:  map[string]*asset{},
+	}
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		contents, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(contents)
+		f := &asset{contents: contents, hash: hex.EncodeToString(sum[:6])}
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + f.hash + ext
+		a.hashed[name] = hashed
+		a.files[name] = f
+		a.files[hashed] = f
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("assets: %w", err)
+	}
+	return a, nil
+}
+
+// `Path` returns the path of the hashed name of the asset `name`. It fails
+// for assets that do not exist, so that templates with broken links do
+// not render.
+func (a *Assets) Path(name string) (string, error) {
+	hashed, ok := a.hashed[name]
+	if !ok {
+		return "", fmt.Errorf("assets: %q does not exist", name)
+	}
+	return assetPrefix + hashed, nil
+}
+
+// `Funcs` returns the function `asset`, which is `Path` for templates.
+func (a *Assets) Funcs() template.FuncMap {
+	return template.FuncMap{"asset": a.Path}
+}
+
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, assetPrefix)
+	f, ok := a.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	_, plain := a.hashed[name]
+	h := w.Header()
+	h.Set("Cache-Control", a.policy.CacheControl(!plain))
+	h.Set("ETag", `"`+f.hash+`"`)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(f.contents))
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ### Backups
+//
+// An `Archiver` writes all poems of a storage into one archive, and
+// restores them from it. It only needs `List` and `Load`, so it works with
+// every storage that can list its poems, and an archive from one storage
+// restores into any other.
+//
+// The archive is a gzipped tar file. Each poem is the file "poems/<name>",
+// with the name escaped as in a URL path, and the last file is
+// "MANIFEST.json", which lists every poem with its size and checksum:
+//
+//	go run ./cmd/poems -backup poems.tar.gz
+//	go run ./cmd/poems -restore poems.tar.gz
+//
+// Both work on the file storage. On a server, the job "backup" writes an
+// archive to the directory "jobs.backupdir" every "jobs.backup", on the
+// leader only; see `jobs.go`.
+//
+// Restoring saves every poem of the archive, over the poems of the same
+// name, and leaves the other poems alone. It checks the whole archive
+// against the manifest before it saves the first poem, so a damaged or
+// truncated archive changes nothing. For that, it holds the poems in
+// memory.
+
+// `Manifest` describes the poems of an archive.
+type Manifest struct {
+	Version int             `json:"version"`
+	Created time.Time       `json:"created"`
+	Storage string          `json:"storage"` // The type of the storage that was backed up.
+	Poems   []ManifestEntry `json:"poems"`
+}
+
+// A `ManifestEntry` describes one poem of an archive.
+type ManifestEntry struct {
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	Checksum string `json:"checksum"` // As `sum` computes it.
+}
+
+const (
+	manifestVersion = 1
+	manifestFile    = "MANIFEST.json"
+	archivePoems    = "poems/"
+)
+
+// `Archiver` backs up and restores the poems of a storage.
+type Archiver struct {
+	storage PoemStorage
+	now     func() time.Time
+}
+
+// `NewArchiver` backs up and restores the poems of `ps`.
+func NewArchiver(ps PoemStorage) *Archiver {
+	return &Archiver{storage: ps, now: time.Now}
+}
+
+// `Backup` writes an archive of all poems to `w`. Poems that are deleted
+// while it lists them are left out.
+func (a *Archiver) Backup(ctx context.Context, w io.Writer) error {
+	lister, ok := a.storage.(Lister)
+	if !ok {
+		return fmt.Errorf("backup %s: %w", a.storage.Type(), ErrNotListable)
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	m := Manifest{Version: manifestVersion, Created: a.now().UTC(), Storage: a.storage.Type(), Poems: []ManifestEntry{}}
+	var after Cursor
+	for {
+		names, next, err := lister.List(ctx, after, 0)
+		if err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("backup: %w", err)
+			}
+			contents, err := a.storage.Load(ctx, name)
+			if errors.Is(err, ErrNoPoem) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("backup: %w", err)
+			}
+			if err := writeTarFile(tw, archivePoems+url.PathEscape(name), contents, m.Created); err != nil {
+				return fmt.Errorf("backup %q: %w", name, err)
+			}
+			m.Poems = append(m.Poems, ManifestEntry{Name: name, Size: len(contents), Checksum: sum(contents)})
+		}
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, manifestFile, data, m.Created); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modified time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0o644,
+		ModTime:  modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// `ErrBadArchive` is returned for archives that do not match their
+// manifest.
+var ErrBadArchive = errors.New("bad archive")
+
+// `Restore` saves the poems of the archive in `r`, and returns its
+// manifest. If the archive does not match its manifest, it saves none and
+// returns an error that matches `ErrBadArchive`.
+func (a *Archiver) Restore(ctx context.Context, r io.Reader) (Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("restore: %w: %v", ErrBadArchive, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	poems := map[string][]byte{}
+	var m *Manifest
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, fmt.Errorf("restore: %w: %v", ErrBadArchive, err)
+		}
+		if h.Typeflag == tar.TypeDir {
+			continue // Archives that were packed again by hand have them.
+		}
+		if m != nil {
+			return Manifest{}, fmt.Errorf("restore: %w: %s after the manifest", ErrBadArchive, h.Name)
+		}
+		if h.Size > maxDecompressed {
+			return Manifest{}, fmt.Errorf("restore: %w: %s has %d bytes", ErrBadArchive, h.Name, h.Size)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("restore: %w: %v", ErrBadArchive, err)
+		}
+		if h.Name == manifestFile {
+			m = &Manifest{}
+			if err := json.Unmarshal(data, m); err != nil {
+				return Manifest{}, fmt.Errorf("restore: %w: manifest: %v", ErrBadArchive, err)
+			}
+			continue
+		}
+		escaped := strings.TrimPrefix(h.Name, archivePoems)
+		name, err := url.PathUnescape(escaped)
+		if escaped == h.Name || err != nil {
+			return Manifest{}, fmt.Errorf("restore: %w: unexpected file %s", ErrBadArchive, h.Name)
+		}
+		poems[name] = data
+	}
+	if m == nil {
+		return Manifest{}, fmt.Errorf("restore: %w: no manifest", ErrBadArchive)
+	}
+	if m.Version != manifestVersion {
+		return Manifest{}, fmt.Errorf("restore: %w: manifest version %d", ErrBadArchive, m.Version)
+	}
+	if err := m.check(poems); err != nil {
+		return Manifest{}, fmt.Errorf("restore: %w: %v", ErrBadArchive, err)
+	}
+	for _, entry := range m.Poems {
+		if err := ctx.Err(); err != nil {
+			return Manifest{}, fmt.Errorf("restore: %w", err)
+		}
+		if err := a.storage.Save(ctx, entry.Name, poems[entry.Name]); err != nil {
+			return Manifest{}, fmt.Errorf("restore: %w", err)
+		}
+	}
+	return *m, nil
+}
+
+// `check` checks that `poems` are exactly the poems of the manifest.
+func (m *Manifest) check(poems map[string][]byte) error {
+	if len(m.Poems) != len(poems) {
+		return fmt.Errorf("%d poems, manifest lists %d", len(poems), len(m.Poems))
+	}
+	seen := map[string]bool{}
+	for _, entry := range m.Poems {
+		if seen[entry.Name] {
+			return fmt.Errorf("poem %q is listed twice", entry.Name)
+		}
+		seen[entry.Name] = true
+		contents, ok := poems[entry.Name]
+		if !ok {
+			return fmt.Errorf("poem %q is missing", entry.Name)
+		}
+		if len(contents) != entry.Size || sum(contents) != entry.Checksum {
+			return fmt.Errorf("poem %q does not match its checksum", entry.Name)
+		}
+	}
+	return nil
+}
+
+// #### The backup job
+
+// `BackupJob` backs up `ps` into the directory `dir` every `every`. Each
+// archive is named after the time of the backup, and is written under a
+// temporary name first, so that the directory never has half an archive
+// under a final name.
+func BackupJob(ps PoemStorage, dir string, every time.Duration, l *log.Logger) Job {
+	a := NewArchiver(ps)
+	return Job{
+		Name:  "backup",
+		Every: every,
+		Run: func(ctx context.Context) error {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+			path := filepath.Join(dir, "poems-"+a.now().UTC().Format("20060102T150405Z")+".tar.gz")
+			if err := backupFile(ctx, a, path); err != nil {
+				return err
+			}
+			l.Printf("backup: wrote %s", path)
+			return nil
+		},
+	}
+}
+
+// `backupFile` writes a backup to the file `path`, through a temporary
+// file that it renames when the backup is complete.
+func backupFile(ctx context.Context, a *Archiver, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // Fails once renamed.
+	err = a.Backup(ctx, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// `restoreFile` restores a backup from the file `path`.
+func restoreFile(ctx context.Context, a *Archiver, path string) (Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer f.Close()
+	return a.Restore(ctx, f)
+}
+
+// `backupOrRestore` does what `-backup` or `-restore` ask for.
+func backupOrRestore(a *Archiver, backup, restore string) error {
+	if backup != "" && restore != "" {
+		return errors.New("-backup and -restore do not go together")
+	}
+	ctx := context.Background()
+	if backup != "" {
+		return backupFile(ctx, a, backup)
+	}
+	m, err := restoreFile(ctx, a, restore)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d poems from a backup of a %s of %s\n", len(m.Poems), m.Storage, m.Created.Format(time.RFC3339))
+	return nil
+}
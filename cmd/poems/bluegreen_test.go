@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+)
+
+// #### Conformance
+//
+// `checkBlueGreen` saves random poems to a split between two keyed
+// backends, changes the split, and checks that every poem still loads.
+// `TestLaws` runs it once.
+func checkBlueGreen(ctx context.Context, r *rand.Rand) error {
+	var keyed []backend
+	for _, b := range backends {
+		if b.keyed {
+			keyed = append(keyed, b)
+		}
+	}
+	b := keyed[r.Intn(len(keyed))]
+	bg := NewBlueGreen(b.new(), b.new(), r.Intn(101))
+	poems := map[string]string{}
+	for i := 0; i < 50; i++ {
+		name, contents := fmt.Sprintf("poem %d", i), fmt.Sprintf("verse %d", r.Int())
+		if err := bg.Save(ctx, name, []byte(contents)); err != nil {
+			return err
+		}
+		poems[name] = contents
+	}
+	from := bg.Percent()
+	bg.SetPercent(r.Intn(101))
+	for name, contents := range poems {
+		if got, err := bg.Load(ctx, name); err != nil || string(got) != contents {
+			return fmt.Errorf("%s from %d%% to %d%% green: %q loads as %q, %v, want %q", b.name, from, bg.Percent(), name, got, err, contents)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ### Deleting many poems at once
+//
+// Sometimes a whole batch of poems has to go: the drafts of an abandoned
+// collection, or everything a tenant of a shared storage ever wrote. Poem
+// names are namespaced by convention, as in "alice/Ode to Go", so a batch is
+// all names with a common prefix.
+//
+// Deleting in bulk is easy to get catastrophically wrong, so it takes two
+// steps. `Plan` counts what would go and returns a `DeletePlan` with a
+// confirmation phrase. `Execute` only deletes if it gets the phrase back,
+// which a CLI asks the user to type. An empty prefix, which matches every
+// poem, is refused unless the plan comes from `PlanEverything`. Every
+// attempt, successful or not, is reported to an `Auditor`.
+
+// A `BulkDeleter` is a storage that can delete poems by name prefix.
+type BulkDeleter interface {
+	CountPrefix(prefix string) int
+	DeleteAll(prefix string) int // Returns the number of poems deleted.
+}
+
+// A `DeletePlan` describes a bulk deletion that has not happened yet.
+type DeletePlan struct {
+	Prefix       string
+	Count        int    // Poems that matched when the plan was made.
+	Confirmation string // The phrase that `Execute` expects.
+	op           string
+	everything   bool
+}
+
+var (
+	// `ErrUnconfirmed` is returned by `Execute` for a wrong confirmation.
+	ErrUnconfirmed = errors.New("bulk delete not confirmed")
+	// `ErrEverything` is returned by `Plan` for an empty prefix.
+	ErrEverything = errors.New("empty prefix would delete every poem; use PlanEverything")
+)
+
+// An `AuditEvent` records a bulk deletion or an attempt at one.
+type AuditEvent struct {
+	Time    time.Time
+	Op      string // "delete-all" or "purge".
+	Prefix  string
+	Planned int
+	Deleted int
+	Err     error // Why nothing was deleted, if so.
+}
+
+// An `Auditor` receives audit events.
+type Auditor interface {
+	Audit(e AuditEvent)
+}
+
+// `LogAuditor` writes audit events to a logger.
+type LogAuditor struct {
+	Log *log.Logger
+}
+
+func (a LogAuditor) Audit(e AuditEvent) {
+	if e.Err != nil {
+		a.Log.Printf("%s %q: refused: %v", e.Op, e.Prefix, e.Err)
+		return
+	}
+	a.Log.Printf("%s %q: deleted %d of %d planned poems", e.Op, e.Prefix, e.Deleted, e.Planned)
+}
+
+// A `Purger` deletes poems from a storage in bulk.
+type Purger struct {
+	storage BulkDeleter
+	audit   Auditor
+}
+
+// `NewPurger` returns a purger for `bd` that reports to `a`.
+func NewPurger(bd BulkDeleter, a Auditor) *Purger {
+	return &Purger{
+		storage: bd,
+		audit:   a,
+	}
+}
+
+// `Plan` prepares the deletion of all poems whose names start with
+// `prefix`.
+func (p *Purger) Plan(prefix string) (DeletePlan, error) {
+	if prefix == "" {
+		p.audit.Audit(AuditEvent{Time: time.Now(), Op: "delete-all", Err: ErrEverything})
+		return DeletePlan{}, ErrEverything
+	}
+	return p.plan("delete-all", prefix, false), nil
+}
+
+// `PlanEverything` prepares the deletion of all poems.
+func (p *Purger) PlanEverything() DeletePlan {
+	return p.plan("delete-all", "", true)
+}
+
+// `PlanPurge` prepares the deletion of everything that `tenant` wrote, that
+// is, of the poems named "<tenant>/...".
+func (p *Purger) PlanPurge(tenant string) (DeletePlan, error) {
+	if tenant == "" || strings.Contains(tenant, "/") {
+		return DeletePlan{}, fmt.Errorf("invalid tenant %q", tenant)
+	}
+	return p.plan("purge", tenant+"/", false), nil
+}
+
+func (p *Purger) plan(op, prefix string, everything bool) DeletePlan {
+	n := p.storage.CountPrefix(prefix)
+	what := fmt.Sprintf("under %q", prefix)
+	if everything {
+		what = "in the storage"
+	}
+	return DeletePlan{
+		Prefix:       prefix,
+		Count:        n,
+		Confirmation: fmt.Sprintf("delete %d poems %s", n, what),
+		op:           op,
+		everything:   everything,
+	}
+}
+
+// `Execute` carries out `plan` if `confirmation` matches the plan's phrase.
+// If more poems match now than when the plan was made, it refuses, too, as
+// the user did not agree to delete those.
+func (p *Purger) Execute(plan DeletePlan, confirmation string) (int, error) {
+	e := AuditEvent{Time: time.Now(), Op: plan.op, Prefix: plan.Prefix, Planned: plan.Count}
+	switch {
+	case plan.op == "" || plan.Prefix == "" && !plan.everything:
+		// Plans that did not come from the `Purger`, such as the zero plan.
+		e.Op, e.Err = "delete-all", ErrEverything
+	case confirmation != plan.Confirmation:
+		e.Err = ErrUnconfirmed
+	case p.storage.CountPrefix(plan.Prefix) > plan.Count:
+		e.Err = fmt.Errorf("more than the %d planned poems match now; plan again", plan.Count)
+	}
+	if e.Err == nil {
+		e.Deleted = p.storage.DeleteAll(plan.Prefix)
+	}
+	p.audit.Audit(e)
+	return e.Deleted, e.Err
+}
+
+// #### The command line
+//
+// `bulkDelete` plans the deletion that `-delete` or `-purge` ask for, and
+// asks the user to type the plan's confirmation phrase.
+func bulkDelete(p *Purger, prefix, tenant string, yes bool) error {
+	var plan DeletePlan
+	var err error
+	if tenant != "" {
+		plan, err = p.PlanPurge(tenant)
+	} else {
+		plan, err = p.Plan(prefix)
+	}
+	if err != nil {
+		return err
+	}
+	if plan.Count == 0 {
+		fmt.Println("nothing to delete")
+		return nil
+	}
+	confirmation := plan.Confirmation
+	if !yes {
+		fmt.Printf("Type %q to confirm: ", plan.Confirmation)
+		confirmation, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+		confirmation = strings.TrimSpace(confirmation)
+	}
+	n, err := p.Execute(plan, confirmation)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("deleted %d poems\n", n)
+	return nil
+}
+
+// #### The backends
+//
+// The `Notebook` deletes the matching pages.
+
+func (n *Notebook) CountPrefix(prefix string) int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	count := 0
+	for name := range n.poems {
+		if strings.HasPrefix(name, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (n *Notebook) DeleteAll(prefix string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count := 0
+	for name := range n.poems {
+		if strings.HasPrefix(name, prefix) {
+			delete(n.poems, name)
+			delete(n.meta, name)
+			count++
+		}
+	}
+	return count
+}
+
+// The `Napkin` holds one poem, which goes if its name matches.
+
+func (n *Napkin) CountPrefix(prefix string) int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.countPrefix(prefix)
+}
+
+func (n *Napkin) countPrefix(prefix string) int {
+	if len(n.poem) == 0 || !strings.HasPrefix(n.name, prefix) {
+		return 0
+	}
+	return 1
+}
+
+func (n *Napkin) DeleteAll(prefix string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count := n.countPrefix(prefix)
+	if count > 0 {
+		n.name, n.poem, n.meta = "", []byte{}, Metadata{}
+	}
+	return count
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Caches
+//
+// Caching is not particular to poems. A `Cache` keeps values of any type
+// by keys of any type, for a while, and forgets them when it runs out of
+// room. Components that cache depend on the `*Caches` of the container
+// and make a cache of the types that they need with `NewCache`:
+//
+//	cache := NewCache[string, []byte](caches, "storage:s3")
+//
+// The setting "cache.store" selects where caches keep their values:
+// "memory" keeps them in the process, and "redis" in Redis, where all
+// instances share them. The namespace keeps apart caches that share Redis;
+// in memory, every cache is a cache of its own anyway. "cache.size"
+// limits the values of each cache in memory, and Redis evicts by its own
+// policy. Values expire after "cache.ttl" in both.
+//
+// A cache in memory returns the values that it was given, not copies, so
+// callers that change values must clone them. A cache is only ever a
+// shortcut: callers treat errors of `Get` like misses.
+
+// A `Cache` keeps values of type `V` by keys of type `K`.
+type Cache[K comparable, V any] interface {
+	// `Get` returns the value of `key`, and whether the cache had it.
+	Get(ctx context.Context, key K) (V, bool, error)
+	// `Set` keeps `value` for `key`.
+	Set(ctx context.Context, key K, value V) error
+	// `Delete` forgets the value of `key`.
+	Delete(ctx context.Context, key K) error
+	// `Purge` forgets all values.
+	Purge(ctx context.Context) error
+}
+
+// `Caches` makes the caches of the store that the settings select.
+type Caches struct {
+	cfg   CacheConfig
+	redis Redis // Only for the store "redis".
+}
+
+// `NewCaches` makes caches as `cfg` says. It fails for an unknown store,
+// so that a typo in the settings stops the program at the start. Redis
+// is only connected for the store "redis".
+func NewCaches(cfg CacheConfig, redis di.Lazy[Redis]) (*Caches, error) {
+	switch cfg.Store {
+	case "memory":
+		return &Caches{cfg: cfg}, nil
+	case "redis":
+		r, err := redis.Get()
+		if err != nil {
+			return nil, err
+		}
+		return &Caches{cfg: cfg, redis: r}, nil
+	}
+	return nil, fmt.Errorf("unknown cache store %q (want memory or redis)", cfg.Store)
+}
+
+// `NewCache` returns a new cache from `cs` for the values of `namespace`.
+func NewCache[K comparable, V any](cs *Caches, namespace string) Cache[K, V] {
+	if cs.redis != nil {
+		return NewRedisCache[K, V](cs.redis, namespace, cs.cfg.TTL)
+	}
+	return NewMemoryCache[K, V](cs.cfg.Size, cs.cfg.TTL)
+}
+
+// #### In memory
+
+// `MemoryCache` keeps values in memory. When it is full, the value that
+// was used least recently goes.
+type MemoryCache[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[K]*list.Element
+	lru     list.List // Of *cacheEntry[K, V], the most recently used first.
+	stats   CacheStats
+}
+
+// `CacheStats` are the metrics of a `MemoryCache`.
+type CacheStats struct {
+	Hits      int64 // Values found.
+	Misses    int64 // Values not found, or expired.
+	Evictions int64 // Values removed to make room.
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// `NewMemoryCache` keeps up to `size` values for `ttl` each. A `ttl` of 0
+// or less keeps values until they are evicted.
+func NewMemoryCache[K comparable, V any](size int, ttl time.Duration) *MemoryCache[K, V] {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryCache[K, V]{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[K]*list.Element{},
+	}
+}
+
+// `Get` marks the value as used.
+func (c *MemoryCache[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero V
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return zero, false, nil
+	}
+	entry := e.Value.(*cacheEntry[K, V])
+	if c.ttl > 0 && !c.now().Before(entry.expires) {
+		c.remove(e)
+		c.stats.Misses++
+		return zero, false, nil
+	}
+	c.lru.MoveToFront(e)
+	c.stats.Hits++
+	return entry.value, true, nil
+}
+
+// `Set` evicts the least recently used value if the cache is full.
+func (c *MemoryCache[K, V]) Set(ctx context.Context, key K, value V) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry[K, V]{
+		key:     key,
+		value:   value,
+		expires: c.now().Add(c.ttl),
+	})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+	return nil
+}
+
+func (c *MemoryCache[K, V]) Delete(ctx context.Context, key K) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	return nil
+}
+
+func (c *MemoryCache[K, V]) Purge(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[K]*list.Element{}
+	c.lru.Init()
+	return nil
+}
+
+// `Stats` returns a snapshot of the cache metrics.
+func (c *MemoryCache[K, V]) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// `remove` removes an entry. The caller holds `c.mu`.
+func (c *MemoryCache[K, V]) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*cacheEntry[K, V]).key)
+}
+
+// #### In Redis
+
+// `RedisCache` keeps values in Redis, as JSON, under keys that start with
+// "poems:cache:" and the namespace. Keys are formatted with `fmt.Sprint`,
+// so two keys that print the same are the same key.
+type RedisCache[K comparable, V any] struct {
+	redis  Redis
+	prefix string
+	ttl    time.Duration
+}
+
+// `NewRedisCache` keeps the values of `namespace` in `r` for `ttl` each.
+// A `ttl` of 0 or less keeps values until Redis evicts them.
+func NewRedisCache[K comparable, V any](r Redis, namespace string, ttl time.Duration) *RedisCache[K, V] {
+	return &RedisCache[K, V]{redis: r, prefix: "poems:cache:" + namespace + ":", ttl: ttl}
+}
+
+func (c *RedisCache[K, V]) key(key K) string {
+	return c.prefix + fmt.Sprint(key)
+}
+
+func (c *RedisCache[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	var value V
+	reply, err := c.redis.Do(ctx, "GET", c.key(key))
+	if err != nil {
+		return value, false, err
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return value, false, nil
+	}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return value, false, fmt.Errorf("cache %q: %w", c.key(key), err)
+	}
+	return value, true, nil
+}
+
+func (c *RedisCache[K, V]) Set(ctx context.Context, key K, value V) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cache %q: %w", c.key(key), err)
+	}
+	args := []string{"SET", c.key(key), string(data)}
+	if ms := c.ttl.Milliseconds(); ms > 0 {
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err = c.redis.Do(ctx, args...)
+	return err
+}
+
+func (c *RedisCache[K, V]) Delete(ctx context.Context, key K) error {
+	_, err := c.redis.Do(ctx, "DEL", c.key(key))
+	return err
+}
+
+// `Purge` deletes the keys of the namespace that SCAN finds. Values that
+// are set meanwhile may stay.
+func (c *RedisCache[K, V]) Purge(ctx context.Context) error {
+	pattern := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace(c.prefix) + "*"
+	var keys []string
+	scan := "0"
+	for {
+		reply, err := c.redis.Do(ctx, "SCAN", scan, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return err
+		}
+		parts, _ := reply.([]interface{})
+		if len(parts) != 2 {
+			return fmt.Errorf("redis: SCAN replied %v", reply)
+		}
+		page, _ := parts[1].([]interface{})
+		for _, key := range page {
+			if key, ok := key.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		if scan, _ = parts[0].(string); scan == "0" || scan == "" {
+			break
+		}
+	}
+	// Deleting while scanning could make SCAN skip keys.
+	for _, key := range keys {
+		if _, err := c.redis.Do(ctx, "DEL", key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// #### Conformance
+//
+// `checkCache` checks that `c` returns what was set, and forgets it after
+// `Delete` and `Purge`. `TestLaws` runs it once on each kind of cache.
+func checkCache(ctx context.Context, c Cache[string, []byte]) error {
+	get := func(key string, want []byte, wantOK bool) error {
+		got, ok, err := c.Get(ctx, key)
+		if err != nil || ok != wantOK || string(got) != string(want) {
+			return fmt.Errorf("Get(%q) = %q, %v, %v, want %q, %v", key, got, ok, err, want, wantOK)
+		}
+		return nil
+	}
+	for _, key := range []string{"a", "b", "c*"} {
+		if err := get(key, nil, false); err != nil {
+			return err
+		}
+		if err := c.Set(ctx, key, []byte("value of "+key)); err != nil {
+			return err
+		}
+		if err := get(key, []byte("value of "+key), true); err != nil {
+			return err
+		}
+	}
+	if err := c.Delete(ctx, "a"); err != nil {
+		return err
+	}
+	if err := get("a", nil, false); err != nil {
+		return err
+	}
+	if err := get("b", []byte("value of b"), true); err != nil {
+		return err
+	}
+	if err := c.Purge(ctx); err != nil {
+		return err
+	}
+	for _, key := range []string{"b", "c*"} {
+		if err := get(key, nil, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
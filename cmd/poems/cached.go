@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ### Caching
+//
+// A storage across the network, such as the `ObjectStorage` or a remote
+// instance, takes a round trip for every poem, and a poet tends to load the
+// same few poems again and again. A `CachedStorage` keeps the poems that
+// were loaded last close at hand, and loads them from the storage it wraps
+// only when they are not there. `main` layers it onto the bindings that
+// the setting "cache.bindings" lists:
+//
+//	POEMS_CACHE_BINDINGS=s3,remote go run ./cmd/poems
+//
+// The cache is a `Cache` of the store that the setting "cache.store"
+// selects (see `cache.go`), so the poems are cached in memory, or in
+// Redis, where all instances of the program share them. Poems go after
+// "cache.ttl", so that changes that do not pass through the cache, such
+// as those of other instances with a cache in memory, show after that
+// long at most. A save through the cache removes the poem from the cache,
+// and so does `Invalidate`, for programs that learn of changes in other
+// ways.
+//
+// The cache assumes that every name has a poem of its own, which a
+// `Napkin` does not have.
+
+// `CachedStorage` caches the poems of the storage it wraps.
+type CachedStorage struct {
+	storage PoemStorage
+	cache   Cache[string, []byte]
+
+	mu  sync.Mutex
+	gen uint64 // Counts invalidations.
+}
+
+// `NewCachedStorage` wraps `ps` and caches its poems in `cache`.
+func NewCachedStorage(ps PoemStorage, cache Cache[string, []byte]) *CachedStorage {
+	return &CachedStorage{storage: ps, cache: cache}
+}
+
+// `Save` invalidates the poem even if it fails, as the storage may have
+// saved it anyway. If the cache cannot forget the poem, the save fails,
+// as the cache would return the old poem.
+func (s *CachedStorage) Save(ctx context.Context, name string, contents []byte) error {
+	err := s.storage.Save(ctx, name, contents)
+	if ierr := s.Invalidate(ctx, name); err == nil && ierr != nil {
+		err = fmt.Errorf("save %q: %w", name, ierr)
+	}
+	return err
+}
+
+// `Load` returns a copy of the cached poem, so that callers cannot change
+// the cache. Missing poems and errors are not cached.
+func (s *CachedStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	if contents, ok, err := s.cache.Get(ctx, name); err == nil && ok {
+		return clone(contents), nil
+	}
+	s.mu.Lock()
+	gen := s.gen
+	s.mu.Unlock()
+
+	contents, err := s.storage.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A poem that was invalidated while it loaded may be stale, so it is
+	// only cached if nothing was invalidated in the meantime. A failed
+	// `Set` only costs the next load a trip to the storage.
+	if s.gen == gen {
+		s.cache.Set(ctx, name, clone(contents))
+	}
+	return contents, nil
+}
+
+func (s *CachedStorage) Type() string {
+	return s.storage.Type()
+}
+
+// `Invalidate` removes the poem `name` from the cache.
+func (s *CachedStorage) Invalidate(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	return s.cache.Delete(ctx, name)
+}
+
+// `Purge` removes all poems from the cache.
+func (s *CachedStorage) Purge(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	return s.cache.Purge(ctx)
+}
@@ -0,0 +1,21 @@
+package main
+
+// ### Giving up
+//
+// Every call to a storage takes a context, and a caller that cancels it,
+// or lets its deadline pass, gets an error that matches `context.Canceled`
+// or `context.DeadlineExceeded`. The server passes on the context of each
+// request, so a client that hangs up stops the save that it started.
+//
+// A storage checks the context before it starts, so that a cancelled save
+// leaves the poem as it was. Storages that talk to a server also give up
+// while they wait for it: the HTTP client of the `RemoteStorage` and the
+// `ObjectStorage` closes the connection, and a `RedisConn` moves the
+// deadline of its connection to now. Whether a `SQLiteStorage` gives up
+// in the middle of a statement is up to the driver.
+//
+// Decorators pass the context on. Those that handle errors of their
+// storages do not count a context that is done as a failure: a
+// `FallbackStorage` does not fail over, and a `ReplicatedStorage` does not
+// mark the replica as unhealthy, as the next storage would give up just
+// the same.
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// #### Conformance
+//
+// `checkCancellation` checks that a save with a cancelled context fails
+// and leaves the poems in `names` as they were, and that a load with one
+// fails, or returns what `ps` has. A `CachedStorage` answers loads from
+// memory, which costs nothing to finish. `TestLaws` runs it on every
+// stack.
+func checkCancellation(ctx context.Context, ps PoemStorage, names []string) error {
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	for _, name := range names {
+		before, berr := ps.Load(ctx, name)
+		if berr != nil && !errors.Is(berr, ErrNoPoem) {
+			return berr
+		}
+		if err := ps.Save(cancelled, name, []byte("never saved")); !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("cancelled save of %q: got %v, want context.Canceled", name, err)
+		}
+		after, aerr := ps.Load(ctx, name)
+		if errors.Is(aerr, ErrNoPoem) != errors.Is(berr, ErrNoPoem) || !bytes.Equal(after, before) {
+			return fmt.Errorf("cancelled save of %q: loaded %q, %v, want %q, %v", name, after, aerr, before, berr)
+		}
+		got, err := ps.Load(cancelled, name)
+		if errors.Is(err, context.Canceled) {
+			continue
+		}
+		if errors.Is(err, ErrNoPoem) != errors.Is(berr, ErrNoPoem) || !bytes.Equal(got, before) {
+			return fmt.Errorf("cancelled load of %q: got %q, %v, want context.Canceled", name, got, err)
+		}
+	}
+	return nil
+}
+
+// `inFlightTimeout` is how long `checkInFlight` waits for a storage to
+// give up. The storages give up after `inFlightWait`.
+const (
+	inFlightWait    = 50 * time.Millisecond
+	inFlightTimeout = 5 * time.Second
+)
+
+// `checkInFlight` checks that the storages that talk to servers give up
+// while they wait, when the context is cancelled or its deadline passes.
+// Their servers never answer: an HTTP server whose handlers wait until
+// the client goes away, and a Redis server that reads commands but never
+// replies. `TestLaws` runs it once.
+func checkInFlight(ctx context.Context) error {
+	// `release` ends the waiting when the check is over, for the servers
+	// that have not noticed that the client went away.
+	release := make(chan struct{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+			go func() {
+				<-release
+				conn.Close()
+			}()
+		}
+	}()
+	redis := NewRedisConn(RedisConfig{Addr: ln.Addr().String()})
+	defer redis.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	storages := []PoemStorage{
+		NewRemoteStorage(NewRPCClient(srv.URL+"/rpc", srv.Client())),
+		NewObjectStorage(S3Config{Endpoint: srv.URL, Bucket: "poems"}, srv.Client()),
+		NewRedisStorage(redis, 0),
+	}
+	ops := map[string]func(context.Context, PoemStorage) error{
+		"save": func(ctx context.Context, ps PoemStorage) error { return ps.Save(ctx, "poem", []byte("poem")) },
+		"load": func(ctx context.Context, ps PoemStorage) error { _, err := ps.Load(ctx, "poem"); return err },
+	}
+	for i, ps := range storages {
+		for op, fn := range ops {
+			// The deadline passes, or the caller cancels.
+			deadline, cancel := context.WithTimeout(ctx, inFlightWait)
+			err := giveUp(deadline, ps, fn)
+			cancel()
+			if !errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("storage %d: %s past the deadline: got %v, want context.DeadlineExceeded", i, op, err)
+			}
+			cancelled, cancel := context.WithCancel(ctx)
+			timer := time.AfterFunc(inFlightWait, cancel)
+			err = giveUp(cancelled, ps, fn)
+			timer.Stop()
+			cancel()
+			if !errors.Is(err, context.Canceled) {
+				return fmt.Errorf("storage %d: cancelled %s: got %v, want context.Canceled", i, op, err)
+			}
+		}
+	}
+	return nil
+}
+
+// `giveUp` calls `fn` and returns its error, or an error if it does not
+// return within `inFlightTimeout`.
+func giveUp(ctx context.Context, ps PoemStorage, fn func(context.Context, PoemStorage) error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx, ps) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(inFlightTimeout):
+		return fmt.Errorf("still waiting after %v", inFlightTimeout)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/appliedgo/di/fsys"
+)
+
+// A `CatalogStorage` keeps a catalog of the poems saved through it: one
+// metadata file per poem in the `catalog` directory of a file system. It
+// decorates another storage, and the `Codec` it gets injected decides the
+// format of the files. The files are "meta" records of the `Migrator`, so
+// entries written by older versions of `PoemMeta` remain readable.
+type CatalogStorage struct {
+	storage  PoemStorage
+	fs       fsys.FS
+	codec    Codec
+	migrator *Migrator
+	now      func() time.Time
+}
+
+// `NewCatalogStorage` wraps `ps` and writes the catalog to `fs` in the
+// format of `codec`.
+func NewCatalogStorage(ps PoemStorage, fs fsys.FS, codec Codec, m *Migrator) *CatalogStorage {
+	return &CatalogStorage{
+		storage:  ps,
+		fs:       fs,
+		codec:    codec,
+		migrator: m,
+		now:      time.Now,
+	}
+}
+
+// `Save` saves the poem, then records it in the catalog. A catalog that
+// cannot be written must not cost the poet a poem, so failures only leave
+// the catalog entry out of date.
+func (s *CatalogStorage) Save(ctx context.Context, name string, contents []byte) error {
+	if err := s.storage.Save(ctx, name, contents); err != nil {
+		return err
+	}
+	data, err := s.codec.Marshal(PoemMeta{
+		Name:    name,
+		Storage: s.storage.Type(),
+		Size:    len(contents),
+		Saved:   s.now(),
+	})
+	if err != nil {
+		return nil
+	}
+	if s.fs.MkdirAll("catalog", 0o755) != nil {
+		return nil
+	}
+	s.fs.WriteFile(s.path(name), s.migrator.Seal("meta", data), 0o644)
+	return nil
+}
+
+func (s *CatalogStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	return s.storage.Load(ctx, name)
+}
+
+func (s *CatalogStorage) Type() string {
+	return s.storage.Type()
+}
+
+// `Meta` reads the catalog entry of the poem `name`.
+func (s *CatalogStorage) Meta(name string) (PoemMeta, error) {
+	return s.read(s.path(name))
+}
+
+// `Init` verifies the catalog when the container builds a `CatalogStorage`:
+// every entry in the format of the `Codec` must open with the `Migrator`
+// and decode. A catalog that a newer version of the program wrote then
+// fails at startup rather than at the first `Meta`. The decorator in
+// `main` builds its `CatalogStorage` itself, so only the catalog that
+// `main` resolves for reading checks the entries.
+func (s *CatalogStorage) Init(ctx context.Context) error {
+	entries, err := fs.ReadDir(s.fs, "catalog")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if e.IsDir() || path.Ext(e.Name()) != "."+s.codec.Name() {
+			continue
+		}
+		if _, err := s.read("catalog/" + e.Name()); err != nil {
+			return fmt.Errorf("catalog entry %s: %w", e.Name(), err)
+		}
+	}
+	return nil
+}
+
+// `read` reads the catalog entry in the file `name`.
+func (s *CatalogStorage) read(name string) (PoemMeta, error) {
+	var m PoemMeta
+	stored, err := fs.ReadFile(s.fs, name)
+	if err != nil {
+		return m, err
+	}
+	data, err := s.migrator.Open("meta", stored)
+	if err != nil {
+		return m, err
+	}
+	err = s.codec.Unmarshal(data, &m)
+	return m, err
+}
+
+// `path` returns the name of the catalog file of a poem. Poem names may
+// contain slashes, so they are escaped.
+func (s *CatalogStorage) path(name string) string {
+	return "catalog/" + url.PathEscape(name) + "." + s.codec.Name()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// ### Checksums
+//
+// A checksum tells whether a poem has changed without comparing it byte
+// by byte: an HTTP client that has a copy sends its checksum, and if the
+// poem's checksum is still the same, the server need not send the poem
+// again. Storages that can compute checksums without handing out the poem
+// implement `Checksummer`; for all others, `Checksum` loads the poem and
+// hashes it.
+
+// A `Checksummer` is a storage that computes the checksums of its poems.
+type Checksummer interface {
+	// `Checksum` returns the checksum of the poem `name`, which is the
+	// same as `sum` of its contents.
+	Checksum(ctx context.Context, name string) (string, error)
+}
+
+// `Checksum` returns the checksum of the poem `name` in `ps`, natively if
+// `ps` is a `Checksummer`.
+func Checksum(ctx context.Context, ps PoemStorage, name string) (string, error) {
+	if cs, ok := ps.(Checksummer); ok {
+		return cs.Checksum(ctx, name)
+	}
+	contents, err := ps.Load(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return sum(contents), nil
+}
+
+// `sum` returns the SHA-256 hash of `contents` in hex.
+func sum(contents []byte) string {
+	h := sha256.Sum256(contents)
+	return hex.EncodeToString(h[:])
+}
+
+// #### The backends
+//
+// The backends hash the poem in place, without the copy that a decorator
+// on top of them might make when loading it.
+
+func (n *Notebook) Checksum(ctx context.Context, name string) (string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	contents, ok := n.poems[name]
+	if !ok {
+		return "", ErrNoPoem
+	}
+	return sum(contents), nil
+}
+
+func (n *Napkin) Checksum(ctx context.Context, name string) (string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return sum(n.poem), nil
+}
+
+// The `FileStorage` hashes the file as it reads it, so a long poem is not
+// held in memory.
+
+func (s *FileStorage) Checksum(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("checksum %q: %w", name, err)
+	}
+	f, err := s.fs.Open(s.file(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("checksum %q: %w", name, ErrNoPoem)
+	}
+	if err != nil {
+		return "", fmt.Errorf("checksum %q: %w", name, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("checksum %q: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// As with ranges, decorators that pass poems through unchanged pass
+// checksums through.
+
+func (s *LoggingStorage) Checksum(ctx context.Context, name string) (string, error) {
+	return Checksum(ctx, s.storage, name)
+}
+
+func (r *ReadOnly) Checksum(ctx context.Context, name string) (string, error) {
+	return Checksum(ctx, r.storage, name)
+}
+
+func (s *CatalogStorage) Checksum(ctx context.Context, name string) (string, error) {
+	return Checksum(ctx, s.storage, name)
+}
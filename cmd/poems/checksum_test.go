@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// #### Conformance
+//
+// `checkChecksums` checks that the checksums of the poems in `names` match
+// what `ps` loads. `TestLaws` runs it on every stack.
+func checkChecksums(ctx context.Context, ps PoemStorage, names []string) error {
+	for _, name := range names {
+		contents, err := ps.Load(ctx, name)
+		if errors.Is(err, ErrNoPoem) {
+			if _, err := Checksum(ctx, ps, name); !errors.Is(err, ErrNoPoem) {
+				return fmt.Errorf("checksum of missing poem %q: got %v, want ErrNoPoem", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		got, err := Checksum(ctx, ps, name)
+		if want := sum(contents); err != nil || got != want {
+			return fmt.Errorf("checksum of %q: got %s, %v, want %s", name, got, err, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ### Poem metadata and codecs
+//
+// Storages that persist something about a poem besides its contents need a
+// format to write it in. Rather than each storage picking one, they get a
+// `Codec` injected. The format then is a matter of wiring: JSON for humans
+// who peek into the files, protobuf or msgpack for compactness, and anything
+// else that someone writes a `Codec` for.
+
+// `PoemMeta` describes a saved poem.
+type PoemMeta struct {
+	Name    string    `json:"name"`
+	Storage string    `json:"storage"` // The `Type` of the storage that holds the poem.
+	Size    int       `json:"size"`    // Length of the contents in bytes.
+	Saved   time.Time `json:"saved"`
+}
+
+// A `Codec` turns `PoemMeta` into bytes and back.
+type Codec interface {
+	Name() string // A short name, also used as file extension.
+	Marshal(m PoemMeta) ([]byte, error)
+	Unmarshal(data []byte, m *PoemMeta) error
+}
+
+// `codecs` lists the available codecs by name, for the `-codec` flag.
+var codecs = map[string]Codec{
+	"json":     JSONCodec{},
+	"protobuf": ProtobufCodec{},
+	"msgpack":  MsgpackCodec{},
+}
+
+// #### JSON
+
+// `JSONCodec` is the default codec.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string { return "json" }
+
+func (JSONCodec) Marshal(m PoemMeta) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (JSONCodec) Unmarshal(data []byte, m *PoemMeta) error {
+	return json.Unmarshal(data, m)
+}
+
+// #### Protobuf
+//
+// `ProtobufCodec` writes the protobuf wire format of this message:
+//
+//	message PoemMeta {
+//		string name = 1;
+//		string storage = 2;
+//		int64 size = 3;
+//		int64 saved_unix_nano = 4;
+//	}
+//
+// A single message does not justify a dependency on a protobuf library and
+// generated code, so the codec encodes the four fields by hand. Any protobuf
+// implementation reads what it writes.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Name() string { return "protobuf" }
+
+// Wire types of the protobuf encoding.
+const (
+	pbVarint = 0
+	pbBytes  = 2
+)
+
+func (ProtobufCodec) Marshal(m PoemMeta) ([]byte, error) {
+	var b []byte
+	str := func(field uint64, s string) {
+		if s == "" {
+			return
+		}
+		b = appendUvarint(b, field<<3|pbBytes)
+		b = appendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	num := func(field uint64, n int64) {
+		if n == 0 {
+			return
+		}
+		b = appendUvarint(b, field<<3|pbVarint)
+		b = appendUvarint(b, uint64(n))
+	}
+	str(1, m.Name)
+	str(2, m.Storage)
+	num(3, int64(m.Size))
+	if !m.Saved.IsZero() {
+		num(4, m.Saved.UnixNano())
+	}
+	return b, nil
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, m *PoemMeta) error {
+	*m = PoemMeta{}
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("protobuf: bad field tag")
+		}
+		data = data[n:]
+		field, wire := tag>>3, tag&7
+		switch wire {
+		case pbVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("protobuf: field %d: bad varint", field)
+			}
+			data = data[n:]
+			switch field {
+			case 3:
+				m.Size = int(int64(v))
+			case 4:
+				m.Saved = time.Unix(0, int64(v))
+			}
+		case pbBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return fmt.Errorf("protobuf: field %d: bad length", field)
+			}
+			s := string(data[n : n+int(l)])
+			data = data[n+int(l):]
+			switch field {
+			case 1:
+				m.Name = s
+			case 2:
+				m.Storage = s
+			}
+		default:
+			// Fields of other wire types are not part of the message.
+			return fmt.Errorf("protobuf: field %d: unsupported wire type %d", field, wire)
+		}
+	}
+	return nil
+}
+
+// #### Msgpack
+//
+// `MsgpackCodec` writes a msgpack map with the same keys as the JSON
+// encoding, and `saved` as a msgpack timestamp. Like the protobuf codec, it
+// is written by hand for the few types that `PoemMeta` needs.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Name() string { return "msgpack" }
+
+func (MsgpackCodec) Marshal(m PoemMeta) ([]byte, error) {
+	b := []byte{0x84} // fixmap with 4 entries
+	b = mpString(mpString(b, "name"), m.Name)
+	b = mpString(mpString(b, "storage"), m.Storage)
+	b = mpString(b, "size")
+	b = append(b, 0xd3) // int 64
+	b = appendBigEndian(b, uint64(m.Size), 8)
+	b = mpString(b, "saved")
+	b = append(b, 0xc7, 12, 0xff) // ext 8, length 12, timestamp
+	b = appendBigEndian(b, uint64(m.Saved.Nanosecond()), 4)
+	b = appendBigEndian(b, uint64(m.Saved.Unix()), 8)
+	return b, nil
+}
+
+// `appendUvarint` and `appendBigEndian` append integers in the encodings
+// that protobuf and msgpack use.
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendBigEndian(b []byte, v uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+// `mpString` appends s to b as a msgpack string.
+func mpString(b []byte, s string) []byte {
+	switch {
+	case len(s) < 32:
+		b = append(b, 0xa0|byte(len(s)))
+	case len(s) <= math.MaxUint8:
+		b = append(b, 0xd9, byte(len(s)))
+	case len(s) <= math.MaxUint16:
+		b = append(b, 0xda)
+		b = appendBigEndian(b, uint64(len(s)), 2)
+	default:
+		b = append(b, 0xdb)
+		b = appendBigEndian(b, uint64(len(s)), 4)
+	}
+	return append(b, s...)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, m *PoemMeta) error {
+	*m = PoemMeta{}
+	d := mpDecoder{data: data}
+	n := d.mapLen()
+	for i := 0; i < n && d.err == nil; i++ {
+		switch k := d.string(); k {
+		case "name":
+			m.Name = d.string()
+		case "storage":
+			m.Storage = d.string()
+		case "size":
+			m.Size = int(d.int())
+		case "saved":
+			m.Saved = d.timestamp()
+		default:
+			d.fail("unknown key " + k)
+		}
+	}
+	return d.err
+}
+
+// An `mpDecoder` reads the msgpack types that `PoemMeta` is made of. After
+// the first error, all reads return zero values.
+type mpDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *mpDecoder) fail(msg string) {
+	if d.err == nil {
+		d.err = errors.New("msgpack: " + msg)
+	}
+	d.data = nil
+}
+
+// `next` consumes and returns n bytes. At the end of the data, it returns
+// zeros, enough for the fixed-size reads.
+func (d *mpDecoder) next(n int) []byte {
+	if len(d.data) < n {
+		d.fail("unexpected end of data")
+		return make([]byte, 8)
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *mpDecoder) mapLen() int {
+	switch c := d.next(1)[0]; {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f)
+	case c == 0xde:
+		return int(binary.BigEndian.Uint16(d.next(2)))
+	default:
+		d.fail("expected a map")
+		return 0
+	}
+}
+
+func (d *mpDecoder) string() string {
+	var n int
+	switch c := d.next(1)[0]; {
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == 0xd9:
+		n = int(d.next(1)[0])
+	case c == 0xda:
+		n = int(binary.BigEndian.Uint16(d.next(2)))
+	case c == 0xdb:
+		n = int(binary.BigEndian.Uint32(d.next(4)))
+	default:
+		d.fail("expected a string")
+	}
+	return string(d.next(n))
+}
+
+func (d *mpDecoder) int() int64 {
+	switch c := d.next(1)[0]; {
+	case c <= 0x7f:
+		return int64(c)
+	case c >= 0xe0:
+		return int64(int8(c))
+	case c == 0xcc:
+		return int64(d.next(1)[0])
+	case c == 0xcd:
+		return int64(binary.BigEndian.Uint16(d.next(2)))
+	case c == 0xce:
+		return int64(binary.BigEndian.Uint32(d.next(4)))
+	case c == 0xcf, c == 0xd3:
+		return int64(binary.BigEndian.Uint64(d.next(8)))
+	case c == 0xd0:
+		return int64(int8(d.next(1)[0]))
+	case c == 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(d.next(2))))
+	case c == 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(d.next(4))))
+	default:
+		d.fail("expected an integer")
+		return 0
+	}
+}
+
+func (d *mpDecoder) timestamp() time.Time {
+	switch c := d.next(1)[0]; c {
+	case 0xd6: // fixext 4: seconds
+		if d.next(1)[0] == 0xff {
+			return time.Unix(int64(binary.BigEndian.Uint32(d.next(4))), 0)
+		}
+	case 0xd7: // fixext 8: 30 bits of nanoseconds, 34 bits of seconds
+		if d.next(1)[0] == 0xff {
+			v := binary.BigEndian.Uint64(d.next(8))
+			return time.Unix(int64(v&(1<<34-1)), int64(v>>34))
+		}
+	case 0xc7: // ext 8 with 12 bytes: nanoseconds, seconds
+		if d.next(1)[0] == 12 && d.next(1)[0] == 0xff {
+			nsec := binary.BigEndian.Uint32(d.next(4))
+			return time.Unix(int64(binary.BigEndian.Uint64(d.next(8))), int64(nsec))
+		}
+	}
+	d.fail("expected a timestamp")
+	return time.Time{}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ### Compression
+//
+// Poems are text, and text compresses well. A `CompressedStorage`
+// compresses poems before they reach the storage it wraps, and
+// decompresses them on loading. Like the `EncryptedStorage`, it is a
+// decorator, and `main` layers it onto the bindings that the setting
+// "compression.bindings" lists, each with its algorithm:
+//
+//	POEMS_COMPRESSION_BINDINGS=files:gzip,sqlite:gzip go run ./cmd/poems
+//
+// The algorithms are `Compression`s in the group "compressions". The
+// example has gzip from the standard library; zstd, or any other
+// algorithm, is one more group member, and needs no change here.
+//
+// A compressed poem starts with `compressedMagic` and the name of its
+// algorithm, so poems saved with one algorithm still load after the
+// binding switches to another. Poems that do not get smaller are stored
+// under the name "none". Stored poems without the header are returned as
+// they are, so compression can be turned on for a storage that already
+// has poems.
+//
+// On the file storage, the compression goes on top of the encryption, as
+// decorators apply in the order of registration: poems are compressed
+// first, then encrypted. The other way round, the encrypted bytes would
+// not compress.
+
+// A `Compression` is an algorithm of the `CompressedStorage`.
+type Compression interface {
+	// `Name` is the name of the algorithm in stored poems and in the
+	// settings. It must not contain a newline.
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	// `Decompress` must not return more than `maxDecompressed` bytes, so
+	// that a small stored poem cannot exhaust the memory.
+	Decompress(data []byte) ([]byte, error)
+}
+
+// `maxDecompressed` limits the size of a decompressed poem.
+const maxDecompressed = 64 << 20
+
+// `GzipCompression` compresses with gzip at `Level`, as in package
+// `compress/gzip`. The zero value compresses at level 0, which stores.
+type GzipCompression struct {
+	Level int
+}
+
+func (GzipCompression) Name() string { return "gzip" }
+
+func (g GzipCompression) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, g.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompression) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxDecompressed+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxDecompressed {
+		return nil, errors.New("decompressed poem is too large")
+	}
+	return out, nil
+}
+
+// `Compressions` are the algorithms that the container has, by name.
+type Compressions struct {
+	byName map[string]Compression
+}
+
+// `NewCompressions` collects the `available` algorithms. It fails if two
+// have the same name, or if `cfg` assigns an algorithm that does not
+// exist, so that a typo in the settings stops the program at the start.
+func NewCompressions(cfg CompressionConfig, available ...Compression) (*Compressions, error) {
+	cs := &Compressions{byName: map[string]Compression{}}
+	for _, c := range available {
+		if _, dup := cs.byName[c.Name()]; dup || c.Name() == "none" || strings.Contains(c.Name(), "\n") {
+			return nil, fmt.Errorf("compression %q: registered twice, or a reserved name", c.Name())
+		}
+		cs.byName[c.Name()] = c
+	}
+	for _, entry := range cfg.Bindings {
+		binding, algorithm, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("compression binding %q: want binding:algorithm", entry)
+		}
+		if cs.Get(algorithm) == nil {
+			return nil, fmt.Errorf("compression binding %q: no algorithm %q", binding, algorithm)
+		}
+	}
+	return cs, nil
+}
+
+// `Get` returns the algorithm `name`, or nil.
+func (cs *Compressions) Get(name string) Compression {
+	return cs.byName[name]
+}
+
+// `CompressedStorage` compresses the poems of the storage it wraps.
+type CompressedStorage struct {
+	storage    PoemStorage
+	algorithm  Compression
+	algorithms *Compressions
+}
+
+// `NewCompressedStorage` wraps `ps` and compresses with `algorithm`, one
+// of `cs`. It loads poems in every algorithm of `cs`.
+func NewCompressedStorage(ps PoemStorage, algorithm string, cs *Compressions) *CompressedStorage {
+	a := cs.Get(algorithm)
+	if a == nil {
+		panic(fmt.Sprintf("no compression %q", algorithm)) // `NewCompressions` checks the settings.
+	}
+	return &CompressedStorage{
+		storage:    ps,
+		algorithm:  a,
+		algorithms: cs,
+	}
+}
+
+// A compressed poem is `compressedMagic`, the name of the algorithm, a
+// newline, and the compressed contents.
+var compressedMagic = []byte("\xffCMP")
+
+func (s *CompressedStorage) Save(ctx context.Context, name string, contents []byte) error {
+	packed, err := s.algorithm.Compress(contents)
+	if err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	algorithm := s.algorithm.Name()
+	if len(packed) >= len(contents) {
+		algorithm, packed = "none", contents
+	}
+	stored := make([]byte, 0, len(compressedMagic)+len(algorithm)+1+len(packed))
+	stored = append(stored, compressedMagic...)
+	stored = append(stored, algorithm...)
+	stored = append(stored, '\n')
+	return s.storage.Save(ctx, name, append(stored, packed...))
+}
+
+// `Load` loads and decompresses a poem.
+func (s *CompressedStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	stored, err := s.storage.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(stored, compressedMagic) {
+		return stored, nil // Saved before compression.
+	}
+	header, packed, ok := bytes.Cut(stored[len(compressedMagic):], []byte("\n"))
+	if !ok {
+		return nil, fmt.Errorf("load %q: compressed poem without algorithm", name)
+	}
+	if string(header) == "none" {
+		return packed, nil
+	}
+	a := s.algorithms.Get(string(header))
+	if a == nil {
+		return nil, fmt.Errorf("load %q: no compression %q", name, header)
+	}
+	contents, err := a.Decompress(packed)
+	if err != nil {
+		return nil, fmt.Errorf("load %q: %s: %w", name, header, err)
+	}
+	if contents == nil {
+		contents = []byte{}
+	}
+	return contents, nil
+}
+
+func (s *CompressedStorage) Type() string {
+	return s.storage.Type()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Commands and queries
+//
+// A service struct with a method for every use case grows with every use
+// case, and so do the dependencies of everyone who needs one of them. A
+// `Dispatcher` keeps the use cases apart: a use case is a message, such
+// as `ReadPoem`, and a handler that the container provides for the type
+// of the message. Commands change poems and return only an error, and
+// queries return a result but change nothing:
+//
+//	c.Provide(NewWritePoemHandler) // func(...) CommandHandler[WritePoem]
+//	c.Provide(NewReadPoemHandler)  // func(...) QueryHandler[ReadPoem, PoemView]
+//
+//	err := Send(ctx, d, WritePoem{Name: "Haiku", Text: "..."})
+//	p, err := Ask[PoemView](ctx, d, ReadPoem{Name: "Haiku"})
+//
+// The dispatcher resolves the handler for every message, from the scope
+// that `ctx` carries, if any, so a handler may depend on the request, such
+// as on the `*Session`. Outside of requests, it resolves from the
+// container. Callers depend only on the dispatcher and the messages, and
+// a message without a handler is an error of the dispatch, not of the
+// wiring.
+
+// A `CommandHandler` executes commands of type `C`.
+type CommandHandler[C any] interface {
+	Handle(ctx context.Context, cmd C) error
+}
+
+// A `QueryHandler` answers queries of type `Q` with results of type `R`.
+type QueryHandler[Q, R any] interface {
+	Handle(ctx context.Context, q Q) (R, error)
+}
+
+// A `Dispatcher` passes messages to the handlers that the container
+// provides for them.
+type Dispatcher struct {
+	c *di.Container
+}
+
+// `NewDispatcher` resolves handlers from `c`, or from the scope of the
+// context of a dispatch.
+func NewDispatcher(c *di.Container) *Dispatcher {
+	return &Dispatcher{c: c}
+}
+
+// `scope` returns the container to resolve the handlers of `ctx` from.
+func (d *Dispatcher) scope(ctx context.Context) *di.Container {
+	if scope, ok := di.ScopeFromContext(ctx); ok {
+		return scope
+	}
+	return d.c
+}
+
+// `Send` executes `cmd` with its `CommandHandler`.
+func Send[C any](ctx context.Context, d *Dispatcher, cmd C) error {
+	h, err := di.ResolveCtx[CommandHandler[C]](ctx, d.scope(ctx))
+	if err != nil {
+		return fmt.Errorf("dispatch %T: %w", cmd, err)
+	}
+	return h.Handle(ctx, cmd)
+}
+
+// `Ask` answers `q` with its `QueryHandler`. The type of the result comes
+// first, so that the type of the query can be inferred:
+// `Ask[PoemView](ctx, d, ReadPoem{...})`.
+func Ask[R, Q any](ctx context.Context, d *Dispatcher, q Q) (R, error) {
+	h, err := di.ResolveCtx[QueryHandler[Q, R]](ctx, d.scope(ctx))
+	if err != nil {
+		var zero R
+		return zero, fmt.Errorf("dispatch %T: %w", q, err)
+	}
+	return h.Handle(ctx, q)
+}
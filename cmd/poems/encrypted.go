@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ### Encryption
+//
+// Poems on a disk or in a bucket are readable by everyone who can read the
+// disk or the bucket. An `EncryptedStorage` encrypts poems before they
+// reach the storage it wraps, and decrypts them on loading, with AES-GCM.
+// It is a decorator like the `LoggingStorage`, so neither the storage nor
+// the poems know about it. `main` layers it onto the file storage if the
+// setting "encryption.keys" has keys:
+//
+//	POEMS_ENCRYPTION_KEYS=2024:$(head -c32 /dev/urandom | base64) go run ./cmd/poems
+//
+// The keys come from a `KeyProvider`, which the container injects. The
+// example reads them from the settings; a provider that asks a key
+// management service would be a drop-in replacement.
+//
+// Keys can be rotated. Each poem records the ID of the key that encrypted
+// it, so after a new key is added in front of the list, new saves use it,
+// and old poems still decrypt with the old one until they are saved again.
+//
+// The name of a poem is authenticated along with its contents, so a poem
+// that is copied under another name in the storage does not decrypt. Names
+// themselves are not encrypted. Poems that were saved before encryption
+// was turned on do not load either; they must be saved again.
+
+// A `KeyProvider` hands out the keys of an `EncryptedStorage`.
+type KeyProvider interface {
+	// `CurrentKey` returns the key that new poems are encrypted with, and
+	// its ID.
+	CurrentKey() (id string, key []byte, err error)
+	// `Key` returns the key with `id`.
+	Key(id string) ([]byte, error)
+}
+
+// `StaticKeys` is a `KeyProvider` with a fixed list of keys.
+type StaticKeys struct {
+	ids  []string
+	keys map[string][]byte
+}
+
+// `NewStaticKeys` parses the keys of `cfg`, each an ID, a colon, and an
+// AES key of 16, 24, or 32 bytes in base64. The first key is the current
+// one.
+func NewStaticKeys(cfg EncryptionConfig) (*StaticKeys, error) {
+	k := &StaticKeys{keys: map[string][]byte{}}
+	for _, entry := range cfg.Keys {
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("encryption key %q: want id:base64", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("encryption key %q: %d bytes, want 16, 24, or 32", id, n)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("encryption key %q: listed twice", id)
+		}
+		k.ids = append(k.ids, id)
+		k.keys[id] = key
+	}
+	return k, nil
+}
+
+func (k *StaticKeys) CurrentKey() (string, []byte, error) {
+	if len(k.ids) == 0 {
+		return "", nil, errors.New("no encryption keys")
+	}
+	return k.ids[0], k.keys[k.ids[0]], nil
+}
+
+func (k *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("no encryption key %q", id)
+	}
+	return key, nil
+}
+
+// `EncryptedStorage` encrypts the poems of the storage it wraps.
+type EncryptedStorage struct {
+	storage PoemStorage
+	keys    KeyProvider
+}
+
+// `NewEncryptedStorage` wraps `ps` and encrypts with the keys of `keys`.
+func NewEncryptedStorage(ps PoemStorage, keys KeyProvider) *EncryptedStorage {
+	return &EncryptedStorage{
+		storage: ps,
+		keys:    keys,
+	}
+}
+
+// An encrypted poem is `encryptedMagic`, the length of the key ID in one
+// byte, the key ID, the nonce, and the sealed contents.
+var encryptedMagic = []byte("\xffENC1")
+
+// `Save` fails if the poem cannot be encrypted. Saving the poem
+// unencrypted is not an option.
+func (s *EncryptedStorage) Save(ctx context.Context, name string, contents []byte) error {
+	sealed, err := s.seal(name, contents)
+	if err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	return s.storage.Save(ctx, name, sealed)
+}
+
+// `Load` loads and decrypts a poem.
+func (s *EncryptedStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	stored, err := s.storage.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := s.open(name, stored)
+	if err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	return contents, nil
+}
+
+func (s *EncryptedStorage) Type() string {
+	return s.storage.Type()
+}
+
+func (s *EncryptedStorage) seal(name string, contents []byte) ([]byte, error) {
+	id, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(encryptedMagic)+1+len(id)+aead.NonceSize()+len(contents)+aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, byte(len(id)))
+	out = append(out, id...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, contents, []byte(name)), nil
+}
+
+// `errNotEncrypted` is returned for stored poems without the header of an
+// encrypted poem, such as poems saved before encryption was turned on.
+var errNotEncrypted = errors.New("poem is not encrypted")
+
+func (s *EncryptedStorage) open(name string, stored []byte) ([]byte, error) {
+	if !bytes.HasPrefix(stored, encryptedMagic) || len(stored) < len(encryptedMagic)+1 {
+		return nil, errNotEncrypted
+	}
+	rest := stored[len(encryptedMagic):]
+	idLen := int(rest[0])
+	if len(rest) < 1+idLen {
+		return nil, errors.New("encrypted poem is truncated")
+	}
+	key, err := s.keys.Key(string(rest[1 : 1+idLen]))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	rest = rest[1+idLen:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("encrypted poem is truncated")
+	}
+	contents, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+	if contents == nil {
+		contents = []byte{} // An empty poem is not a missing one.
+	}
+	return contents, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ### Poems that expire
+//
+// Some poems are not meant to last: a draft shared for review, a verse for
+// today's newsletter. Storages that can forget a poem after a while
+// implement `Expirer`. Unlike ranges or checksums, expiry cannot be
+// emulated on top of a storage that has no way to delete, so `SaveFor`
+// fails with `ErrNoExpiry` for other storages rather than keeping the poem
+// forever.
+
+// An `Expirer` is a storage that can save poems for a limited time.
+type Expirer interface {
+	// `SaveFor` saves the poem `name`, which expires after `ttl`.
+	SaveFor(ctx context.Context, name string, contents []byte, ttl time.Duration) error
+	// `TTL` returns the time until the poem `name` expires, or 0 if it
+	// does not expire. It returns `ErrNoPoem` if there is no such poem.
+	TTL(ctx context.Context, name string) (time.Duration, error)
+}
+
+// `ErrNoExpiry` is returned for storages that cannot expire poems.
+var ErrNoExpiry = errors.New("storage cannot expire poems")
+
+// `SaveFor` saves the poem `name` in `ps` for `ttl`, if `ps` is an
+// `Expirer`.
+func SaveFor(ctx context.Context, ps PoemStorage, name string, contents []byte, ttl time.Duration) error {
+	if ex, ok := ps.(Expirer); ok {
+		return ex.SaveFor(ctx, name, contents, ttl)
+	}
+	return fmt.Errorf("save %q in %s: %w", name, ps.Type(), ErrNoExpiry)
+}
+
+// `TTL` returns the time until the poem `name` in `ps` expires. Poems in
+// storages that are not `Expirer`s do not expire.
+func TTL(ctx context.Context, ps PoemStorage, name string) (time.Duration, error) {
+	if ex, ok := ps.(Expirer); ok {
+		return ex.TTL(ctx, name)
+	}
+	if _, err := ps.Load(ctx, name); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// #### Conformance
+//
+// `checkExpiry` checks that a poem saved for a while loads, and has a time
+// to live no longer than that, and that a plain save clears it.
+// `TestLaws` runs it on every backend that expires.
+func checkExpiry(ctx context.Context, ex Expirer, ps PoemStorage) error {
+	const name, ttl = "fleeting", time.Hour
+	if err := ex.SaveFor(ctx, name, []byte("gone soon"), ttl); err != nil {
+		return err
+	}
+	if got, err := ps.Load(ctx, name); err != nil || string(got) != "gone soon" {
+		return fmt.Errorf("load %q: got %q, %v", name, got, err)
+	}
+	left, err := ex.TTL(ctx, name)
+	if err != nil || left <= 0 || left > ttl {
+		return fmt.Errorf("TTL of %q: got %v, %v, want up to %v", name, left, err, ttl)
+	}
+	if err := ps.Save(ctx, name, []byte("here to stay")); err != nil {
+		return err
+	}
+	if left, err := ex.TTL(ctx, name); err != nil || left != 0 {
+		return fmt.Errorf("TTL of %q after Save: got %v, %v, want 0", name, left, err)
+	}
+	if _, err := ex.TTL(ctx, "never saved"); !errors.Is(err, ErrNoPoem) {
+		return fmt.Errorf("TTL of a missing poem: got %v, want ErrNoPoem", err)
+	}
+	return nil
+}
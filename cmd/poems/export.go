@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Import and export
+//
+// A backup (see `backup.go`) is for restoring; an export is for reading
+// and for moving poems elsewhere: to another storage, into a document, or
+// to another program. An `Exporter` writes all poems of a storage in one
+// file of a format, and imports such files into a storage. The formats are
+// `Formatter`s in a `FormatRegistry`, which has every member of the group
+// "formatters". A module adds a format by adding a member: `FormatsModule`
+// adds the formats of the example, and a module of another format is
+// installed next to it, without a change to the `Exporter`:
+//
+//	c.Install(ExportModule, FormatsModule, di.Module("csv",
+//		di.Provide(func() Formatter { return CSVFormatter{} }, di.Group(), di.Named("formatters")),
+//	))
+//
+// `-export` and `-import` pick a format by its name:
+//
+//	go run ./cmd/poems -export poems.md -format markdown
+//	go run ./cmd/poems -import poems.md -format markdown
+//
+// Both work on the file storage. An export from one storage imports into
+// any other, so exporting from one binding and importing into another
+// migrates the poems.
+//
+// JSON keeps the metadata of the poems (see `metadata.go`), and the
+// poems that are not text, as base64. Markdown and plain text are for
+// people; they keep names and poems, in any bytes, but no metadata.
+//
+// Like a restore, an import reads the whole file before it saves the
+// first poem, so a file that cannot be read changes nothing. Imported
+// poems replace the poems of the same name.
+
+// An `ExportedPoem` is a poem in an export.
+type ExportedPoem struct {
+	Name     string
+	Contents []byte
+	Meta     Metadata // Zero in formats that do not keep it.
+}
+
+// A `Formatter` writes and reads exports in one format.
+type Formatter interface {
+	// `Name` is the name of the format, such as "json".
+	Name() string
+	// `Format` writes `poems` to `w`.
+	Format(w io.Writer, poems []ExportedPoem) error
+	// `Parse` reads what `Format` wrote. It returns an error that matches
+	// `ErrBadExport` for anything else.
+	Parse(r io.Reader) ([]ExportedPoem, error)
+}
+
+// `ErrBadExport` is returned for exports that a `Formatter` cannot read.
+var ErrBadExport = errors.New("bad export")
+
+// A `FormatRegistry` holds the formats of exports by their names.
+type FormatRegistry struct {
+	formats map[string]Formatter
+}
+
+// `NewFormatRegistry` registers `formatters`. Two formats must not have the
+// same name.
+func NewFormatRegistry(formatters ...Formatter) (*FormatRegistry, error) {
+	r := &FormatRegistry{formats: map[string]Formatter{}}
+	for _, f := range formatters {
+		if _, ok := r.formats[f.Name()]; ok {
+			return nil, fmt.Errorf("format %q is registered twice", f.Name())
+		}
+		r.formats[f.Name()] = f
+	}
+	return r, nil
+}
+
+// `Names` returns the names of the formats, sorted.
+func (r *FormatRegistry) Names() []string {
+	var names []string
+	for name := range r.formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// `Formatter` returns the `Formatter` of `format`.
+func (r *FormatRegistry) Formatter(format string) (Formatter, error) {
+	if f, ok := r.formats[format]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (want one of %s)", format, strings.Join(r.Names(), ", "))
+}
+
+// `FormatsModule` registers the formats of the example.
+var FormatsModule = di.Module("formats",
+	di.Provide(func() Formatter { return JSONFormatter{} }, di.Group(), di.Named("formatters")),
+	di.Provide(func() Formatter { return MarkdownFormatter{} }, di.Group(), di.Named("formatters")),
+	di.Provide(func() Formatter { return TextFormatter{} }, di.Group(), di.Named("formatters")),
+)
+
+// `ExportModule` provides the `Exporter` of the files, with the formats of
+// the group "formatters".
+var ExportModule = di.Module("export",
+	di.Provide(NewFormatRegistry, di.ParamNames("formatters"), di.WithLifetime(di.Singleton)),
+	di.Provide(NewExporter, di.ParamNames("files")),
+)
+
+// `Exporter` exports and imports the poems of a storage.
+type Exporter struct {
+	storage PoemStorage
+	formats *FormatRegistry
+}
+
+// `NewExporter` exports and imports the poems of `ps` in the formats of
+// `formats`.
+func NewExporter(ps PoemStorage, formats *FormatRegistry) *Exporter {
+	return &Exporter{storage: ps, formats: formats}
+}
+
+// `formatter` returns the `Formatter` of `format`.
+func (e *Exporter) formatter(format string) (Formatter, error) {
+	return e.formats.Formatter(format)
+}
+
+// `ExportAll` writes all poems, in the order of their names, to `w` in
+// `format`. Poems that are deleted while it lists them are left out.
+func (e *Exporter) ExportAll(ctx context.Context, w io.Writer, format string) error {
+	f, err := e.formatter(format)
+	if err != nil {
+		return err
+	}
+	names, err := ListAll(ctx, e.storage)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	poems := []ExportedPoem{}
+	for _, name := range names {
+		contents, err := e.storage.Load(ctx, name)
+		if errors.Is(err, ErrNoPoem) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		meta, err := LoadMeta(ctx, e.storage, name)
+		if err != nil && !errors.Is(err, ErrNoPoem) {
+			return fmt.Errorf("export: %w", err)
+		}
+		poems = append(poems, ExportedPoem{Name: name, Contents: contents, Meta: meta})
+	}
+	if err := f.Format(w, poems); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+// `Import` saves the poems of the export in `r`, of `format`, and returns
+// how many it saved. Metadata goes with the poems into storages that keep
+// it.
+func (e *Exporter) Import(ctx context.Context, r io.Reader, format string) (int, error) {
+	f, err := e.formatter(format)
+	if err != nil {
+		return 0, err
+	}
+	poems, err := f.Parse(r)
+	if err != nil {
+		return 0, fmt.Errorf("import: %w", err)
+	}
+	for i, p := range poems {
+		if err := ctx.Err(); err != nil {
+			return i, fmt.Errorf("import: %w", err)
+		}
+		if err := e.storage.Save(ctx, p.Name, p.Contents); err != nil {
+			return i, fmt.Errorf("import: %w", err)
+		}
+		if p.Meta.equal(Metadata{}) {
+			continue
+		}
+		if err := SaveMeta(ctx, e.storage, p.Name, p.Meta); err != nil && !errors.Is(err, ErrNoMetadata) {
+			return i, fmt.Errorf("import: %w", err)
+		}
+	}
+	return len(poems), nil
+}
+
+// #### JSON
+
+// `JSONFormatter` exports poems as a JSON object with a list of poems.
+// Poems that are UTF-8 are strings, "text"; others are base64, "data".
+// Names must be UTF-8.
+type JSONFormatter struct{}
+
+const exportVersion = 1
+
+type jsonExport struct {
+	Version int        `json:"version"`
+	Poems   []jsonPoem `json:"poems"`
+}
+
+type jsonPoem struct {
+	Name string    `json:"name"`
+	Text *string   `json:"text,omitempty"`
+	Data []byte    `json:"data,omitempty"`
+	Meta *Metadata `json:"meta,omitempty"`
+}
+
+func (JSONFormatter) Name() string {
+	return "json"
+}
+
+func (JSONFormatter) Format(w io.Writer, poems []ExportedPoem) error {
+	out := jsonExport{Version: exportVersion, Poems: []jsonPoem{}}
+	for _, p := range poems {
+		if !utf8.ValidString(p.Name) {
+			return fmt.Errorf("name %q is not UTF-8", p.Name)
+		}
+		jp := jsonPoem{Name: p.Name}
+		if utf8.Valid(p.Contents) {
+			text := string(p.Contents)
+			jp.Text = &text
+		} else {
+			jp.Data = p.Contents
+		}
+		if !p.Meta.equal(Metadata{}) {
+			meta := p.Meta
+			jp.Meta = &meta
+		}
+		out.Poems = append(out.Poems, jp)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func (JSONFormatter) Parse(r io.Reader) ([]ExportedPoem, error) {
+	var in jsonExport
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadExport, err)
+	}
+	if in.Version != exportVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrBadExport, in.Version)
+	}
+	poems := []ExportedPoem{}
+	for _, jp := range in.Poems {
+		p := ExportedPoem{Name: jp.Name}
+		switch {
+		case jp.Text != nil && jp.Data == nil:
+			p.Contents = []byte(*jp.Text)
+		case jp.Text == nil && jp.Data != nil:
+			p.Contents = jp.Data
+		default:
+			return nil, fmt.Errorf("%w: poem %q needs either text or data", ErrBadExport, jp.Name)
+		}
+		if jp.Meta != nil {
+			p.Meta = *jp.Meta
+		}
+		poems = append(poems, p)
+	}
+	return poems, nil
+}
+
+// #### Markdown
+//
+// `MarkdownFormatter` exports poems as a Markdown document, with a heading
+// for each poem and the poem in a fenced block, so that renderers keep its
+// lines as they are. The fence has more backticks than any run of them in
+// the poem, which therefore cannot end it early:
+//
+//	# Poems
+//
+//	## My poem
+//
+//	```
+//	Roses are red,
+//	violets are blue.
+//	```
+//
+// Names with line breaks or other control characters, and names that
+// start with a quote, are quoted as in Go.
+type MarkdownFormatter struct{}
+
+func (MarkdownFormatter) Name() string {
+	return "markdown"
+}
+
+func (MarkdownFormatter) Format(w io.Writer, poems []ExportedPoem) error {
+	var buf bytes.Buffer
+	buf.WriteString("# Poems\n")
+	for _, p := range poems {
+		fence := strings.Repeat("`", maxRun(p.Contents, '`')+1)
+		if len(fence) < 3 {
+			fence = "```"
+		}
+		fmt.Fprintf(&buf, "\n## %s\n\n%s\n%s\n%s\n", quoteName(p.Name), fence, p.Contents, fence)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// `Parse` skips what is not a poem, such as the title, so that the
+// document can have words around the poems.
+func (MarkdownFormatter) Parse(r io.Reader) ([]ExportedPoem, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	poems := []ExportedPoem{}
+	for i := 0; i < len(lines); i++ {
+		heading := strings.TrimPrefix(lines[i], "## ")
+		if heading == lines[i] {
+			continue
+		}
+		name, err := unquoteName(heading)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrBadExport, i+1, err)
+		}
+		for i++; i < len(lines) && lines[i] == ""; i++ {
+		}
+		if i == len(lines) || len(lines[i]) < 3 || strings.Trim(lines[i], "`") != "" {
+			return nil, fmt.Errorf("%w: poem %q has no fenced block", ErrBadExport, name)
+		}
+		fence, start := lines[i], i+1
+		for i++; i < len(lines) && lines[i] != fence; i++ {
+		}
+		if i == len(lines) {
+			return nil, fmt.Errorf("%w: the block of poem %q does not end", ErrBadExport, name)
+		}
+		poems = append(poems, ExportedPoem{Name: name, Contents: []byte(strings.Join(lines[start:i], "\n"))})
+	}
+	return poems, nil
+}
+
+// `maxRun` returns the length of the longest run of `c` in `data`.
+func maxRun(data []byte, c byte) int {
+	longest, run := 0, 0
+	for _, b := range data {
+		if b != c {
+			run = 0
+			continue
+		}
+		if run++; run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// #### Plain text
+//
+// `TextFormatter` exports poems as plain text: the name on a line of its
+// own, quoted as in Markdown, a blank line, and the poem. Form feeds on
+// lines of their own separate the poems, as pages. A line of the poem that
+// is a form feed, after any number of ">", gets one more ">", which
+// `Parse` takes away again.
+type TextFormatter struct{}
+
+func (TextFormatter) Name() string {
+	return "text"
+}
+
+func (TextFormatter) Format(w io.Writer, poems []ExportedPoem) error {
+	var buf bytes.Buffer
+	for i, p := range poems {
+		if i > 0 {
+			buf.WriteString("\f\n")
+		}
+		fmt.Fprintf(&buf, "%s\n\n", quoteName(p.Name))
+		for j, line := range strings.Split(string(p.Contents), "\n") {
+			if j > 0 {
+				buf.WriteByte('\n')
+			}
+			if isPageBreak(line) {
+				buf.WriteByte('>')
+			}
+			buf.WriteString(line)
+		}
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (TextFormatter) Parse(r io.Reader) ([]ExportedPoem, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	poems := []ExportedPoem{}
+	if len(data) == 0 {
+		return poems, nil
+	}
+	text := string(data)
+	if !strings.HasSuffix(text, "\n") {
+		return nil, fmt.Errorf("%w: no line break at the end", ErrBadExport)
+	}
+	for _, page := range strings.Split(strings.TrimSuffix(text, "\n"), "\n\f\n") {
+		lines := strings.Split(page, "\n")
+		if len(lines) < 3 || lines[1] != "" {
+			return nil, fmt.Errorf("%w: a poem needs a name, a blank line, and the poem", ErrBadExport)
+		}
+		name, err := unquoteName(lines[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadExport, err)
+		}
+		lines = lines[2:]
+		for j, line := range lines {
+			if strings.HasPrefix(line, ">") && isPageBreak(line[1:]) {
+				lines[j] = line[1:]
+			}
+		}
+		poems = append(poems, ExportedPoem{Name: name, Contents: []byte(strings.Join(lines, "\n"))})
+	}
+	return poems, nil
+}
+
+// `isPageBreak` reports whether `line` is a form feed after any number of
+// ">".
+func isPageBreak(line string) bool {
+	return strings.TrimLeft(line, ">") == "\f"
+}
+
+// `quoteName` returns `name` as it is, unless it would not read back from
+// a line of its own, such as a name with a line break. Those it quotes.
+func quoteName(name string) string {
+	if name == "" || strings.HasPrefix(name, `"`) || !utf8.ValidString(name) ||
+		strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// `unquoteName` reads a name that `quoteName` wrote.
+func unquoteName(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	name, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("name %s: %v", s, err)
+	}
+	return name, nil
+}
+
+// `exportOrImport` does what `-export` or `-import` ask for.
+func exportOrImport(e *Exporter, export, imp, format string) error {
+	if export != "" && imp != "" {
+		return errors.New("-export and -import do not go together")
+	}
+	ctx := context.Background()
+	if export != "" {
+		f, err := os.Create(export)
+		if err != nil {
+			return err
+		}
+		err = e.ExportAll(ctx, f, format)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	f, err := os.Open(imp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := e.Import(ctx, f, format)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d poems from %s\n", n, imp)
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/appliedgo/di"
+)
+
+// #### Conformance
+//
+// `checkExport` exports random poems, with awkward names and contents,
+// from a random keyed backend in every format, and checks that importing
+// the export into another backend brings back every poem, with its
+// metadata where both backends and the format keep it, and that exporting
+// again writes the same. `TestLaws` runs it once.
+func checkExport(ctx context.Context, r *rand.Rand) error {
+	var listing []backend
+	for _, b := range backends {
+		if _, ok := b.new().(Lister); ok && b.keyed {
+			listing = append(listing, b)
+		}
+	}
+	formatters := []Formatter{JSONFormatter{}, MarkdownFormatter{}, TextFormatter{}}
+	formats, err := NewFormatRegistry(formatters...)
+	if err != nil {
+		return err
+	}
+	// Names are UTF-8, as JSON and the `RemoteStorage` require.
+	awkward := []string{"", "\n", "\f", ">\f", "```", "## heading", "\"quoted\"", "line\r\n", "\x00"}
+	for _, f := range formatters {
+		fb, tb := listing[r.Intn(len(listing))], listing[r.Intn(len(listing))]
+		from, to := fb.new(), tb.new()
+		desc := fmt.Sprintf("%s from %s to %s", f.Name(), fb.name, tb.name)
+		want := map[string][]byte{}
+		metas := map[string]Metadata{}
+		for i := r.Intn(6); i > 0; i-- {
+			name := fmt.Sprintf("poem %d%s", r.Intn(10), awkward[r.Intn(len(awkward))])
+			// Not empty, as the `RemoteStorage` has no empty poems.
+			var contents []byte
+			for j := 1 + r.Intn(3); j > 0; j-- {
+				contents = append(contents, append([]string{"\xff"}, awkward...)[r.Intn(len(awkward)+1)]...)
+				contents = append(contents, []string{"\n", "verse", "verse\n"}[r.Intn(3)]...)
+			}
+			if err := from.Save(ctx, name, contents); err != nil {
+				return fmt.Errorf("%s: %w", desc, err)
+			}
+			want[name] = contents
+			meta := Metadata{Author: "Anon", Tags: []string{"exported"}}
+			if err := SaveMeta(ctx, from, name, meta); err == nil {
+				metas[name] = meta
+			} else if !errors.Is(err, ErrNoMetadata) {
+				return fmt.Errorf("%s: %w", desc, err)
+			}
+		}
+		var export bytes.Buffer
+		if err := NewExporter(from, formats).ExportAll(ctx, &export, f.Name()); err != nil {
+			return fmt.Errorf("%s: %w", desc, err)
+		}
+		n, err := NewExporter(to, formats).Import(ctx, bytes.NewReader(export.Bytes()), f.Name())
+		if err != nil || n != len(want) {
+			return fmt.Errorf("%s: imported %d poems, %v, want %d\n%s", desc, n, err, len(want), export.Bytes())
+		}
+		for name, contents := range want {
+			got, err := to.Load(ctx, name)
+			if err != nil || !bytes.Equal(got, contents) {
+				return fmt.Errorf("%s: imported %q as %q, %v, want %q\n%s", desc, name, got, err, contents, export.Bytes())
+			}
+			meta, err := LoadMeta(ctx, to, name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", desc, err)
+			}
+			_, annotates := to.(Annotator)
+			if keeps := f.Name() == "json" && annotates; keeps && !meta.equal(metas[name]) {
+				return fmt.Errorf("%s: imported metadata of %q as %+v, want %+v", desc, name, meta, metas[name])
+			}
+		}
+		var again bytes.Buffer
+		if err := NewExporter(to, formats).ExportAll(ctx, &again, f.Name()); err != nil {
+			return fmt.Errorf("%s: %w", desc, err)
+		}
+		if f.Name() != "json" && !bytes.Equal(again.Bytes(), export.Bytes()) {
+			return fmt.Errorf("%s: export of the import differs:\n%s\nwant:\n%s", desc, again.Bytes(), export.Bytes())
+		}
+		if _, err := f.Parse(strings.NewReader("## poem\nnot a poem")); !errors.Is(err, ErrBadExport) {
+			return fmt.Errorf("%s: parse of garbage: got %v, want ErrBadExport", desc, err)
+		}
+	}
+	return nil
+}
+
+// `checkFormatRegistry` installs a module with a format of its own next to
+// `FormatsModule`, and checks that the registry has it, and that a format
+// of a name that is taken fails. `TestLaws` runs it once.
+func checkFormatRegistry() error {
+	c := di.New()
+	c.Provide(func() PoemStorage { return NewNotebook() }, di.Named("files"))
+	upper := di.Module("upper",
+		di.Provide(func() Formatter { return namedFormatter{JSONFormatter{}, "upper"} }, di.Group(), di.Named("formatters")),
+	)
+	if err := c.Install(ExportModule, FormatsModule, upper); err != nil {
+		return err
+	}
+	e, err := di.Resolve[*Exporter](c)
+	if err != nil {
+		return err
+	}
+	if got, want := strings.Join(e.formats.Names(), ","), "json,markdown,text,upper"; got != want {
+		return fmt.Errorf("formats %s, want %s", got, want)
+	}
+	c = di.New()
+	c.Provide(func() PoemStorage { return NewNotebook() }, di.Named("files"))
+	twice := di.Module("twice",
+		di.Provide(func() Formatter { return namedFormatter{TextFormatter{}, "json"} }, di.Group(), di.Named("formatters")),
+	)
+	if err := c.Install(ExportModule, FormatsModule, twice); err != nil {
+		return err
+	}
+	if _, err := di.Resolve[*Exporter](c); err == nil {
+		return errors.New("two formats named json were registered")
+	}
+	return nil
+}
+
+// A `namedFormatter` is a format under another name.
+type namedFormatter struct {
+	Formatter
+	name string
+}
+
+func (f namedFormatter) Name() string { return f.name }
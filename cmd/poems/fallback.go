@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ### Failover
+//
+// A poet whose notebook is lost writes on a napkin rather than not at all.
+// A `FallbackStorage` tries its storages in order: it saves a poem to the
+// first one that takes it, and loads it from the first one that has it.
+// Every error but `ErrNoPoem` counts as a failure of the storage, unless
+// the caller's context is done: a storage that gave up because the caller
+// did has not failed, and the next storage would give up just the same.
+//
+// Each time a storage fails and the next one is tried, the fallback calls
+// `OnFailover`, so that the poet learns that the notebook is gone before
+// the napkin is full. `main` logs failovers.
+//
+// A poem that was saved to a later storage while an earlier one was down
+// is shadowed by the older copy in the earlier storage once that is back.
+// Failover keeps poems from getting lost, not from getting old.
+
+// `FallbackStorage` saves to and loads from the first storage that works.
+type FallbackStorage struct {
+	storages []PoemStorage
+
+	// `OnFailover`, if set, is called for every storage that fails, before
+	// the next one is tried.
+	OnFailover func(Failover)
+}
+
+// A `Failover` reports that a storage failed, and that the next one is
+// tried.
+type Failover struct {
+	Op   string // "save" or "load".
+	Name string // The name of the poem.
+	From string // The type of the storage that failed.
+	To   string // The type of the storage that is tried next, or "" if there is none.
+	Err  error
+}
+
+// `NewFallbackStorage` returns a storage that tries `storages` in order.
+func NewFallbackStorage(storages ...PoemStorage) *FallbackStorage {
+	return &FallbackStorage{storages: storages}
+}
+
+// `ErrAllFailed` is returned when every storage of a `FallbackStorage`
+// fails.
+var ErrAllFailed = errors.New("all storages failed")
+
+// `Save` saves the poem `name` to the first storage that takes it.
+func (f *FallbackStorage) Save(ctx context.Context, name string, contents []byte) error {
+	var last error
+	for i, ps := range f.storages {
+		last = ps.Save(ctx, name, contents)
+		if last == nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("save %q: %w", name, err)
+		}
+		f.failover("save", name, i, last)
+	}
+	return fmt.Errorf("save %q: %w: %v", name, ErrAllFailed, last)
+}
+
+// `Load` loads the poem `name` from the first storage that has it. It
+// returns `ErrNoPoem` if none has it, unless a storage failed, which may
+// have had it.
+func (f *FallbackStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	var last error
+	for i, ps := range f.storages {
+		contents, err := ps.Load(ctx, name)
+		if errors.Is(err, ErrNoPoem) {
+			continue
+		}
+		if err != nil && ctx.Err() != nil {
+			return nil, fmt.Errorf("load %q: %w", name, ctx.Err())
+		}
+		if err != nil {
+			f.failover("load", name, i, err)
+			last = err
+			continue
+		}
+		return contents, nil
+	}
+	if last != nil {
+		return nil, fmt.Errorf("load %q: %w: %v", name, ErrAllFailed, last)
+	}
+	return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+}
+
+func (f *FallbackStorage) Type() string {
+	types := make([]string, len(f.storages))
+	for i, ps := range f.storages {
+		types[i] = ps.Type()
+	}
+	return "Fallback(" + strings.Join(types, ", ") + ")"
+}
+
+func (f *FallbackStorage) failover(op, name string, i int, err error) {
+	if f.OnFailover == nil {
+		return
+	}
+	e := Failover{Op: op, Name: name, From: f.storages[i].Type(), Err: err}
+	if i+1 < len(f.storages) {
+		e.To = f.storages[i+1].Type()
+	}
+	f.OnFailover(e)
+}
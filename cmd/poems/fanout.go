@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// A `FanOut` storage saves every poem to several backends at once, so a poem
+// written into the notebook also ends up on the napkin, in the cloud, and
+// wherever else a poet keeps copies.
+//
+// The backends come from the container as a group. Each backend is
+// registered with `di.Group()`, and `NewFanOut` asks for all of them
+// through its variadic parameter:
+//
+//	c.RegisterSingleton(func() PoemStorage { return NewNotebook() }, di.Group())
+//	c.RegisterSingleton(func() PoemStorage { return NewNapkin() }, di.Group())
+//	c.Provide(NewFanOut)
+//
+// Being variadic, `NewFanOut` reads just as well when called by hand, as in
+// `NewFanOut(notebook, napkin)`.
+type FanOut struct {
+	backends []PoemStorage
+}
+
+// `NewFanOut` returns a storage that writes to all `backends`.
+func NewFanOut(backends ...PoemStorage) *FanOut {
+	return &FanOut{backends: backends}
+}
+
+// `Save` stops at the first backend that fails. The backends before it
+// keep the poem.
+func (f *FanOut) Save(ctx context.Context, name string, contents []byte) error {
+	for _, b := range f.backends {
+		if err := b.Save(ctx, name, contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// `Load` returns the poem from the first backend that has it. All backends
+// received the same saves, so they should agree anyway.
+func (f *FanOut) Load(ctx context.Context, name string) ([]byte, error) {
+	contents, err := []byte(nil), fmt.Errorf("load %q: %w", name, ErrNoPoem)
+	for _, b := range f.backends {
+		c, berr := b.Load(ctx, name)
+		if errors.Is(berr, ErrNoPoem) {
+			continue
+		}
+		if berr != nil {
+			return nil, berr
+		}
+		if contents, err = c, nil; len(contents) > 0 {
+			break
+		}
+	}
+	return contents, err
+}
+
+func (f *FanOut) Type() string {
+	t := "FanOut("
+	for i, b := range f.backends {
+		if i > 0 {
+			t += ", "
+		}
+		t += b.Type()
+	}
+	return t + ")"
+}
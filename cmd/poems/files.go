@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/appliedgo/di/fsys"
+)
+
+// ### Poems in files
+//
+// The `Notebook` and the `Napkin` forget everything when the program
+// exits. A `FileStorage` keeps each poem in a file of its own, in the
+// directory of the setting "storage.dir":
+//
+//	POEMS_STORAGE_DIR=/var/lib/poems go run ./cmd/poems
+//
+// Without the setting, the example keeps the files in memory, as it does
+// for the catalog.
+//
+// A poem is written to a temporary file first, which then replaces the
+// poem's file in one rename. A crash in the middle of a save leaves either
+// the old poem or the new one, and at worst a temporary file, which the
+// next start removes.
+
+// `FileStorage` keeps poems in the files of a file system.
+type FileStorage struct {
+	fs  fsys.FS
+	seq uint64     // Numbers temporary files, accessed atomically.
+	mu  sync.Mutex // Held while a save numbers its revision; see `history.go`.
+}
+
+// `NewFileStorage` keeps poems in `fs`.
+func NewFileStorage(fs fsys.FS) *FileStorage {
+	return &FileStorage{fs: fs}
+}
+
+// `poemExt`, `metaExt`, and `tempExt` are the extensions of poem files,
+// metadata files, and temporary files, and `historyExt` that of the
+// directories of revisions.
+const (
+	poemExt    = ".poem"
+	metaExt    = ".meta"
+	tempExt    = ".tmp"
+	historyExt = ".history"
+)
+
+// `file` returns the name of the file of the poem `name`. Poem names may
+// contain anything, including slashes, so they are escaped.
+func (s *FileStorage) file(name string) string {
+	return url.PathEscape(name) + poemExt
+}
+
+// `temp` returns a new name for a temporary file that replaces `file`.
+func (s *FileStorage) temp(file string) string {
+	return fmt.Sprintf(".%s.%d%s", file, atomic.AddUint64(&s.seq, 1), tempExt)
+}
+
+// `Init` creates the directory and removes temporary files that an
+// interrupted save left behind.
+func (s *FileStorage) Init(ctx context.Context) error {
+	if err := s.fs.MkdirAll(".", 0o755); err != nil {
+		return fmt.Errorf("file storage: %w", err)
+	}
+	entries, err := fs.ReadDir(s.fs, ".")
+	if err != nil {
+		return fmt.Errorf("file storage: %w", err)
+	}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !e.IsDir() && strings.HasSuffix(e.Name(), tempExt) {
+			if err := s.fs.Remove(e.Name()); err != nil {
+				return fmt.Errorf("file storage: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// `Save` writes a poem atomically, and adds it to the poem's history. If
+// `ctx` is done before the rename, the poem stays as it was.
+func (s *FileStorage) Save(ctx context.Context, name string, contents []byte) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	file := s.file(name)
+	temp := s.temp(file)
+	if err := s.fs.WriteFile(temp, contents, 0o644); err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	if err := s.replace(ctx, name, temp, bytes.NewReader(contents)); err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	return nil
+}
+
+// `replace` replaces the file of the poem `name` with the file `temp`,
+// which holds `contents`, and records it as the next revision. If `ctx`
+// is done, or anything fails, it removes `temp`, and the poem and its
+// history stay as they were.
+func (s *FileStorage) replace(ctx context.Context, name, temp string, contents io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		s.fs.Remove(temp)
+		return err
+	}
+	rev, err := s.record(name, contents)
+	if err != nil {
+		s.fs.Remove(temp)
+		return err
+	}
+	if err := s.fs.Rename(temp, s.file(name)); err != nil {
+		s.fs.Remove(temp)
+		s.fs.Remove(rev)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	contents, err := fs.ReadFile(s.fs, s.file(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	return contents, nil
+}
+
+func (s *FileStorage) Type() string {
+	return "FileStorage"
+}
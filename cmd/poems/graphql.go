@@ -0,0 +1,810 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/appliedgo/di"
+)
+
+// ### GraphQL
+//
+// Clients that want several poems and just some of their fields in one
+// round trip can ask the GraphQL endpoint at "/graphql". It is another
+// delivery mechanism on top of the same inner ring: its resolvers send the
+// messages of the use cases to a `Dispatcher`, which the container
+// injects. The schema:
+//
+//	type Query {
+//		poem(name: String!): Poem
+//		anthology(after: String, first: Int): Anthology!
+//	}
+//
+//	type Mutation {
+//		savePoem(name: String!, text: String!, revision: Int): Poem!
+//	}
+//
+//	type Poem {
+//		name: String!
+//		text: String!
+//		checksum: String!
+//		revision: Int!
+//	}
+//
+//	type Anthology {
+//		poems: [Poem!]!
+//		next: String # The cursor of the next page, null on the last page.
+//	}
+//
+// The endpoint is optional: `GraphQLModule` provides it, and `main`
+// installs the module only if the setting "http.graphql" is true. The
+// router mounts whatever the container has.
+//
+//	curl -d '{"query": "{ anthology(first: 2) { poems { name } next } }"}' localhost:8080/graphql
+//
+// The example implements the part of GraphQL that the schema needs, with
+// no library: queries and mutations, aliases, arguments and variables, and
+// `__typename`. Fragments, directives, and introspection are not supported
+// and reported as errors.
+
+// `GraphQLModule` provides the GraphQL endpoint.
+var GraphQLModule = di.Module("graphql",
+	di.Provide(NewGraphQLHandler),
+)
+
+// A `GraphQLHandler` executes GraphQL requests.
+type GraphQLHandler struct {
+	query, mutation *gqlType
+}
+
+// `NewGraphQLHandler` resolves the schema's fields with the use cases that
+// `d` dispatches to.
+func NewGraphQLHandler(d *Dispatcher) *GraphQLHandler {
+	poem := &gqlType{name: "Poem"}
+	poem.fields = map[string]*gqlField{
+		"name": {nonNull: true, resolve: func(_ context.Context, src interface{}, _ gqlArgs) (interface{}, error) {
+			return src.(PoemView).Name, nil
+		}},
+		"text": {nonNull: true, resolve: func(_ context.Context, src interface{}, _ gqlArgs) (interface{}, error) {
+			return src.(PoemView).Text, nil
+		}},
+		"checksum": {nonNull: true, resolve: func(_ context.Context, src interface{}, _ gqlArgs) (interface{}, error) {
+			return src.(PoemView).Checksum, nil
+		}},
+		"revision": {nonNull: true, resolve: func(_ context.Context, src interface{}, _ gqlArgs) (interface{}, error) {
+			return int(src.(PoemView).Revision), nil
+		}},
+	}
+	anthology := &gqlType{name: "Anthology"}
+	anthology.fields = map[string]*gqlField{
+		"poems": {typ: poem, list: true, nonNull: true, resolve: func(_ context.Context, src interface{}, _ gqlArgs) (interface{}, error) {
+			var poems []interface{}
+			for _, p := range src.(Anthology).Poems {
+				poems = append(poems, p)
+			}
+			return poems, nil
+		}},
+		"next": {resolve: func(_ context.Context, src interface{}, _ gqlArgs) (interface{}, error) {
+			if next := src.(Anthology).Next; next != "" {
+				return string(next), nil
+			}
+			return nil, nil
+		}},
+	}
+	query := &gqlType{name: "Query", fields: map[string]*gqlField{
+		"poem": {typ: poem, args: map[string]string{"name": "String!"}, resolve: func(ctx context.Context, _ interface{}, args gqlArgs) (interface{}, error) {
+			p, err := Ask[PoemView](ctx, d, ReadPoem{Name: args["name"].(string)})
+			if errors.Is(err, ErrNoPoem) {
+				return nil, nil
+			}
+			return p, err
+		}},
+		"anthology": {typ: anthology, nonNull: true, args: map[string]string{"after": "String", "first": "Int"}, resolve: func(ctx context.Context, _ interface{}, args gqlArgs) (interface{}, error) {
+			after, _ := args["after"].(string)
+			first, _ := args["first"].(int)
+			return Ask[Anthology](ctx, d, BrowsePoems{After: Cursor(after), Limit: first})
+		}},
+	}}
+	mutation := &gqlType{name: "Mutation", fields: map[string]*gqlField{
+		"savePoem": {typ: poem, nonNull: true, args: map[string]string{"name": "String!", "text": "String!", "revision": "Int"}, resolve: func(ctx context.Context, _ interface{}, args gqlArgs) (interface{}, error) {
+			cmd := WritePoem{Name: args["name"].(string), Text: args["text"].(string)}
+			// With a revision, the poem is only saved if it is still at it.
+			if rev, ok := args["revision"].(int); ok {
+				if rev < 0 {
+					return nil, errors.New("revision must not be negative")
+				}
+				expected := Revision(rev)
+				cmd.Revision = &expected
+			}
+			return writePoem(ctx, d, cmd)
+		}},
+	}}
+	return &GraphQLHandler{query: query, mutation: mutation}
+}
+
+// A `gqlRequest` is a GraphQL request as clients send it.
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// A `gqlResponse` is the result of a request. Errors that prevent
+// execution leave out `data`; errors of single fields null the field.
+type gqlResponse struct {
+	Data   *gqlMap    `json:"data,omitempty"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// A `gqlError` is an error with the path of the field that caused it.
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req gqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				gqlReply(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "variables: " + err.Error()}}})
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			gqlReply(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: "request: " + err.Error()}}})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	op, err := parseGraphQL(req.Query, req.OperationName)
+	if err != nil {
+		gqlReply(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+	root := h.query
+	if op.kind == "mutation" {
+		if r.Method == http.MethodGet {
+			// GET must be safe, so that caches and crawlers cannot write.
+			gqlReply(w, http.StatusMethodNotAllowed, gqlResponse{Errors: []gqlError{{Message: "mutations require POST"}}})
+			return
+		}
+		root = h.mutation
+	}
+	vars, err := op.variables(req.Variables)
+	if err != nil {
+		gqlReply(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+	e := &gqlExecution{ctx: r.Context(), declared: map[string]bool{}, vars: vars}
+	for _, d := range op.vars {
+		e.declared[d.name] = true
+	}
+	data, _ := e.object(root, nil, op.selection, nil)
+	gqlReply(w, http.StatusOK, gqlResponse{Data: &data, Errors: e.errors})
+}
+
+func gqlReply(w http.ResponseWriter, status int, resp gqlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// #### Execution
+//
+// The schema is a set of `gqlType`s whose fields have resolvers. A
+// resolver gets the context of the request, the value of the object that
+// the field belongs to, and its arguments, and returns the field's value: a string, an int, nil, the Go value of an
+// object, or for lists a `[]interface{}` of these.
+
+// A `gqlType` is an object type.
+type gqlType struct {
+	name   string
+	fields map[string]*gqlField
+}
+
+// A `gqlField` is a field of an object type.
+type gqlField struct {
+	typ     *gqlType          // The object type of the value, nil for strings and ints.
+	list    bool              // Whether the value is a list of `typ`.
+	nonNull bool              // Whether the value must not be null.
+	args    map[string]string // Argument types by name: "String", "Int", with "!" if required.
+	resolve func(ctx context.Context, src interface{}, args gqlArgs) (interface{}, error)
+}
+
+// `gqlArgs` are the arguments of a field, coerced to their types: string
+// for "String", int for "Int". Optional arguments that are not given are
+// missing.
+type gqlArgs map[string]interface{}
+
+// A `gqlExecution` executes one operation and collects its errors.
+type gqlExecution struct {
+	ctx      context.Context
+	declared map[string]bool
+	vars     map[string]interface{}
+	errors   []gqlError
+}
+
+// `object` resolves the selection on the object `src` of type `t`. It
+// reports false if a non-null field became null, which makes the object
+// null, too.
+func (e *gqlExecution) object(t *gqlType, src interface{}, sel []*gqlSelection, path []interface{}) (gqlMap, bool) {
+	m := gqlMap{}
+	for _, s := range sel {
+		p := append(path[:len(path):len(path)], s.key())
+		if s.name == "__typename" {
+			m = append(m, gqlEntry{s.key(), t.name})
+			continue
+		}
+		f, ok := t.fields[s.name]
+		if !ok {
+			e.fail(p, fmt.Errorf("cannot query field %q on type %q", s.name, t.name))
+			return nil, false
+		}
+		v, ok := e.field(f, src, s, p)
+		if !ok {
+			if f.nonNull {
+				return nil, false
+			}
+			v = nil
+		}
+		m = append(m, gqlEntry{s.key(), v})
+	}
+	return m, true
+}
+
+// `field` resolves a field and completes its value. It reports false if
+// the value is null, but must not be.
+func (e *gqlExecution) field(f *gqlField, src interface{}, s *gqlSelection, path []interface{}) (interface{}, bool) {
+	if f.typ == nil && len(s.selection) > 0 {
+		e.fail(path, fmt.Errorf("field %q is a scalar and cannot have a selection", s.name))
+		return nil, false
+	}
+	if f.typ != nil && len(s.selection) == 0 {
+		e.fail(path, fmt.Errorf("field %q of type %q must have a selection", s.name, f.typ.name))
+		return nil, false
+	}
+	args, err := e.args(f, s)
+	if err != nil {
+		e.fail(path, err)
+		return nil, false
+	}
+	v, err := f.resolve(e.ctx, src, args)
+	if err != nil {
+		e.fail(path, err)
+		return nil, false
+	}
+	if v == nil {
+		if f.nonNull {
+			e.fail(path, fmt.Errorf("field %q is null but must not be", s.name))
+			return nil, false
+		}
+		return nil, true
+	}
+	if f.typ == nil {
+		return v, true
+	}
+	if !f.list {
+		m, ok := e.object(f.typ, v, s.selection, path)
+		return m, ok || !f.nonNull
+	}
+	list := []interface{}{}
+	for i, elem := range v.([]interface{}) {
+		// Elements of lists are never null, so a null element nulls the
+		// list.
+		m, ok := e.object(f.typ, elem, s.selection, append(path[:len(path):len(path)], i))
+		if !ok {
+			return nil, false
+		}
+		list = append(list, m)
+	}
+	return list, true
+}
+
+// `args` coerces the arguments of a selection to the types of the field.
+func (e *gqlExecution) args(f *gqlField, s *gqlSelection) (gqlArgs, error) {
+	args := gqlArgs{}
+	for name, v := range s.args {
+		typ, ok := f.args[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown argument %q on field %q", name, s.name)
+		}
+		if ref, ok := v.(gqlVariable); ok {
+			if !e.declared[string(ref)] {
+				return nil, fmt.Errorf("variable $%s is not declared", ref)
+			}
+			if v, ok = e.vars[string(ref)]; !ok {
+				continue // An optional variable that was not given.
+			}
+		}
+		c, err := coerce(v, typ)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %w", name, err)
+		}
+		if c != nil {
+			args[name] = c
+		}
+	}
+	for name, typ := range f.args {
+		if _, ok := args[name]; !ok && strings.HasSuffix(typ, "!") {
+			return nil, fmt.Errorf("field %q needs the argument %q", s.name, name)
+		}
+	}
+	return args, nil
+}
+
+func (e *gqlExecution) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, gqlError{Message: err.Error(), Path: path})
+}
+
+// `coerce` converts a literal or a variable's JSON value to the type
+// `typ`. JSON numbers arrive as float64.
+func coerce(v interface{}, typ string) (interface{}, error) {
+	base := strings.TrimSuffix(typ, "!")
+	switch v := v.(type) {
+	case nil:
+		if base != typ {
+			return nil, fmt.Errorf("expected %s, got null", typ)
+		}
+		return nil, nil
+	case string:
+		if base == "String" {
+			return v, nil
+		}
+	case int:
+		if base == "Int" {
+			return v, nil
+		}
+	case float64:
+		if base == "Int" && v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return nil, fmt.Errorf("expected %s, got %v", typ, v)
+}
+
+// A `gqlMap` is an object of the response. Unlike a Go map, it keeps the
+// fields in the order of the query, as GraphQL requires.
+type gqlMap []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value interface{}
+}
+
+func (m gqlMap) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(e.key)
+		v, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// #### Parsing
+
+// A `gqlOperation` is the operation of a document that a request executes.
+type gqlOperation struct {
+	kind      string // "query" or "mutation".
+	vars      []gqlVarDef
+	selection []*gqlSelection
+}
+
+// A `gqlVarDef` declares a variable of an operation.
+type gqlVarDef struct {
+	name     string
+	required bool
+	def      interface{} // The default value, if any.
+	hasDef   bool
+}
+
+// A `gqlSelection` is a field of a selection set.
+type gqlSelection struct {
+	alias, name string
+	args        map[string]interface{} // Literals, or `gqlVariable`s.
+	selection   []*gqlSelection
+}
+
+// `key` is the name of the field in the response.
+func (s *gqlSelection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// A `gqlVariable` is a reference to a variable in an argument.
+type gqlVariable string
+
+// `variables` checks the values of the operation's variables and applies
+// defaults.
+func (op *gqlOperation) variables(given map[string]interface{}) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, d := range op.vars {
+		v, ok := given[d.name]
+		switch {
+		case ok:
+			vars[d.name] = v
+		case d.hasDef:
+			vars[d.name] = d.def
+		case d.required:
+			return nil, fmt.Errorf("variable $%s is required", d.name)
+		}
+	}
+	return vars, nil
+}
+
+// `parseGraphQL` parses a document and returns the operation `name`, or the
+// only operation if `name` is empty.
+func parseGraphQL(doc, name string) (*gqlOperation, error) {
+	p := &gqlParser{src: doc}
+	p.next()
+	var found *gqlOperation
+	count := 0
+	for p.tok != "" {
+		op, opName, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		count++
+		if name == "" || opName == name {
+			found = op
+		}
+	}
+	switch {
+	case count == 0:
+		return nil, errors.New("the document has no operation")
+	case name == "" && count > 1:
+		return nil, errors.New("the document has several operations; operationName must pick one")
+	case found == nil:
+		return nil, fmt.Errorf("the document has no operation %q", name)
+	}
+	return found, nil
+}
+
+// A `gqlParser` reads a document token by token. `tok` is the current
+// token: a punctuator, a name, a number, a string with its quotes, or ""
+// at the end.
+type gqlParser struct {
+	src  string
+	pos  int
+	tok  string
+	line int
+	err  error
+}
+
+func (p *gqlParser) operation() (*gqlOperation, string, error) {
+	op := &gqlOperation{kind: "query"}
+	var name string
+	if p.tok != "{" {
+		switch p.tok {
+		case "query", "mutation":
+			op.kind = p.tok
+		case "subscription", "fragment":
+			return nil, "", p.errorf("%ss are not supported", p.tok)
+		default:
+			return nil, "", p.errorf("expected an operation, got %q", p.tok)
+		}
+		p.next()
+		if isName(p.tok) {
+			name = p.tok
+			p.next()
+		}
+		if p.tok == "(" {
+			if err := p.varDefs(op); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, "", err
+	}
+	op.selection = sel
+	return op, name, p.err
+}
+
+func (p *gqlParser) varDefs(op *gqlOperation) error {
+	p.next()
+	for p.tok != ")" {
+		if p.tok != "$" {
+			return p.errorf("expected a variable, got %q", p.tok)
+		}
+		p.next()
+		d := gqlVarDef{name: p.tok}
+		if !isName(d.name) {
+			return p.errorf("expected a variable name, got %q", p.tok)
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.varType(); err != nil {
+			return err
+		}
+		if p.tok == "!" {
+			d.required = true
+			p.next()
+		}
+		if p.tok == "=" {
+			p.next()
+			v, err := p.value(true)
+			if err != nil {
+				return err
+			}
+			d.def, d.hasDef = v, true
+		}
+		op.vars = append(op.vars, d)
+	}
+	p.next()
+	return p.err
+}
+
+// `varType` skips the type of a variable, except for a trailing "!".
+// Arguments check the values against the types of the schema.
+func (p *gqlParser) varType() error {
+	if p.tok == "[" {
+		p.next()
+		if err := p.varType(); err != nil {
+			return err
+		}
+		if p.tok == "!" {
+			p.next()
+		}
+		if p.tok != "]" {
+			return p.errorf("expected \"]\", got %q", p.tok)
+		}
+		p.next()
+		return nil
+	}
+	if !isName(p.tok) {
+		return p.errorf("expected a type, got %q", p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlSelection, error) {
+	if p.tok != "{" {
+		return nil, p.errorf("expected \"{\", got %q", p.tok)
+	}
+	p.next()
+	var sel []*gqlSelection
+	for p.tok != "}" {
+		switch {
+		case p.tok == "...":
+			return nil, p.errorf("fragments are not supported")
+		case !isName(p.tok):
+			return nil, p.errorf("expected a field, got %q", p.tok)
+		}
+		s := &gqlSelection{name: p.tok}
+		p.next()
+		if p.tok == ":" {
+			p.next()
+			if !isName(p.tok) {
+				return nil, p.errorf("expected a field after alias %q, got %q", s.name, p.tok)
+			}
+			s.alias, s.name = s.name, p.tok
+			p.next()
+		}
+		if p.tok == "(" {
+			if err := p.arguments(s); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok == "@" {
+			return nil, p.errorf("directives are not supported")
+		}
+		if p.tok == "{" {
+			var err error
+			if s.selection, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		sel = append(sel, s)
+	}
+	p.next()
+	if len(sel) == 0 {
+		return nil, p.errorf("empty selection")
+	}
+	return sel, p.err
+}
+
+func (p *gqlParser) arguments(s *gqlSelection) error {
+	p.next()
+	s.args = map[string]interface{}{}
+	for p.tok != ")" {
+		name := p.tok
+		if !isName(name) {
+			return p.errorf("expected an argument, got %q", p.tok)
+		}
+		if _, dup := s.args[name]; dup {
+			return p.errorf("argument %q given twice", name)
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		v, err := p.value(false)
+		if err != nil {
+			return err
+		}
+		s.args[name] = v
+	}
+	p.next()
+	return p.err
+}
+
+// `value` parses a literal or, unless `constant`, a variable reference.
+// Errors report the line of the value, not of the token after it.
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	var v interface{}
+	switch {
+	case tok == "$" && !constant:
+		p.next()
+		if !isName(p.tok) {
+			return nil, p.errorf("expected a variable name, got %q", p.tok)
+		}
+		v = gqlVariable(p.tok)
+	case tok == "null":
+	case tok == "true" || tok == "false":
+		v = tok == "true"
+	case strings.HasPrefix(tok, `"`):
+		s, err := unquoteGraphQL(tok)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		v = s
+	case tok != "" && (tok[0] == '-' || isDigit(tok[0])):
+		if n, err := strconv.Atoi(tok); err == nil {
+			v = n
+		} else if f, err := strconv.ParseFloat(tok, 64); err == nil {
+			v = f
+		} else {
+			return nil, p.errorf("expected a value, got %q", tok)
+		}
+	case tok == "[" || tok == "{":
+		return nil, p.errorf("list and object values are not supported")
+	default:
+		return nil, p.errorf("expected a value, got %q", tok)
+	}
+	p.next()
+	return v, nil
+}
+
+func (p *gqlParser) expect(tok string) error {
+	p.next()
+	if p.tok != tok {
+		return p.errorf("expected %q, got %q", tok, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func (p *gqlParser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("line %d: %s", p.line+1, fmt.Sprintf(format, args...))
+}
+
+// `next` reads the next token. Commas are insignificant in GraphQL, like
+// white space and comments.
+func (p *gqlParser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			p.tok = p.scan()
+			return
+		}
+	}
+	p.tok = ""
+}
+
+func (p *gqlParser) scan() string {
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		p.pos++
+	case c == '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' && p.src[p.pos] != '\n' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != '"' {
+			p.err = p.errorf("unterminated string")
+			p.pos = len(p.src)
+			return ""
+		}
+		p.pos++
+	case c == '-' || isDigit(c):
+		// Numbers are checked when they are parsed as values.
+		p.pos++
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || strings.IndexByte("+-.eE", p.src[p.pos]) >= 0) {
+			p.pos++
+		}
+	case isNameByte(c, true):
+		for p.pos < len(p.src) && isNameByte(p.src[p.pos], false) {
+			p.pos++
+		}
+	default:
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.err = p.errorf("unexpected character %q", r)
+		p.pos += size
+		return ""
+	}
+	return p.src[start:p.pos]
+}
+
+// `unquoteGraphQL` decodes a string literal. GraphQL strings escape like
+// JSON strings.
+func unquoteGraphQL(tok string) (string, error) {
+	var s string
+	if err := json.Unmarshal([]byte(tok), &s); err != nil {
+		return "", fmt.Errorf("invalid string %s", tok)
+	}
+	return s, nil
+}
+
+func isName(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	for i := 0; i < len(tok); i++ {
+		if !isNameByte(tok[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameByte(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
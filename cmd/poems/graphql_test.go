@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// #### Parser tests
+//
+// `sketch` renders a selection set compactly, for comparing parse results:
+// `alias:name(arg=value){...}`, with the arguments sorted by name.
+func sketch(sel []*gqlSelection) string {
+	var parts []string
+	for _, s := range sel {
+		part := s.name
+		if s.alias != "" {
+			part = s.alias + ":" + part
+		}
+		if len(s.args) > 0 {
+			var args []string
+			for name, v := range s.args {
+				switch v := v.(type) {
+				case gqlVariable:
+					args = append(args, fmt.Sprintf("%s=$%s", name, v))
+				case string:
+					args = append(args, fmt.Sprintf("%s=%q", name, v))
+				case nil:
+					args = append(args, name+"=null")
+				default:
+					args = append(args, fmt.Sprintf("%s=%v", name, v))
+				}
+			}
+			sort.Strings(args)
+			part += "(" + strings.Join(args, ",") + ")"
+		}
+		if s.selection != nil {
+			part += "{" + sketch(s.selection) + "}"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParseGraphQL(t *testing.T) {
+	for _, tc := range []struct {
+		name, doc, op string
+		kind, want    string
+	}{
+		{
+			name: "shorthand query",
+			doc:  `{ poem(name: "ode") { name text } }`,
+			kind: "query",
+			want: `poem(name="ode"){name text}`,
+		},
+		{
+			name: "named query",
+			doc:  `query Front { anthology(first: 2) { poems { name } next } }`,
+			kind: "query",
+			want: `anthology(first=2){poems{name} next}`,
+		},
+		{
+			name: "mutation",
+			doc:  `mutation { savePoem(name: "ode", text: "Oh", revision: 3) { revision } }`,
+			kind: "mutation",
+			want: `savePoem(name="ode",revision=3,text="Oh"){revision}`,
+		},
+		{
+			name: "aliases",
+			doc:  `{ a: poem(name: "a") { name } b: poem(name: "b") { title: name } }`,
+			kind: "query",
+			want: `a:poem(name="a"){name} b:poem(name="b"){title:name}`,
+		},
+		{
+			name: "literals",
+			doc:  `{ f(s: "tab\tand \"quotes\"", i: -12, x: 1.5e3, t: true, n: null) { __typename } }`,
+			kind: "query",
+			want: `f(i=-12,n=null,s="tab\tand \"quotes\"",t=true,x=1500){__typename}`,
+		},
+		{
+			name: "commas and comments",
+			doc:  "# The front page.\n{ anthology(first: 2,,) { poems { name, text }, next } # trailing\n}",
+			kind: "query",
+			want: `anthology(first=2){poems{name text} next}`,
+		},
+		{
+			name: "variables",
+			doc:  `query Q($name: String!, $first: Int = 10) { poem(name: $name) { name } anthology(first: $first) { next } }`,
+			kind: "query",
+			want: `poem(name=$name){name} anthology(first=$first){next}`,
+		},
+		{
+			name: "operation picked by name",
+			doc:  `query A { poem(name: "a") { name } } mutation B { savePoem(name: "b", text: "") { name } }`,
+			op:   "B",
+			kind: "mutation",
+			want: `savePoem(name="b",text=""){name}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			op, err := parseGraphQL(tc.doc, tc.op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op.kind != tc.kind {
+				t.Errorf("kind: got %q, want %q", op.kind, tc.kind)
+			}
+			if got := sketch(op.selection); got != tc.want {
+				t.Errorf("got  %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLVariables(t *testing.T) {
+	op, err := parseGraphQL(`query($name: String!, $first: Int = 10, $after: String, $tags: [String!]!) { anthology { next } }`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []gqlVarDef{
+		{name: "name", required: true},
+		{name: "first", def: 10, hasDef: true},
+		{name: "after"},
+		{name: "tags", required: true},
+	}
+	if !reflect.DeepEqual(op.vars, want) {
+		t.Errorf("definitions: got %+v, want %+v", op.vars, want)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		given map[string]interface{}
+		want  map[string]interface{}
+		err   string
+	}{
+		{
+			name:  "defaults",
+			given: map[string]interface{}{"name": "ode", "tags": nil},
+			want:  map[string]interface{}{"name": "ode", "first": 10, "tags": nil},
+		},
+		{
+			name:  "given values win",
+			given: map[string]interface{}{"name": "ode", "first": 2, "after": "x", "tags": nil, "unused": 1},
+			want:  map[string]interface{}{"name": "ode", "first": 2, "after": "x", "tags": nil},
+		},
+		{
+			name:  "missing required",
+			given: map[string]interface{}{"tags": nil},
+			err:   "variable $name is required",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := op.variables(tc.given)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("got %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, doc, op string
+		want          string
+	}{
+		{"empty", "", "", "the document has no operation"},
+		{"only a comment", "# nothing", "", "the document has no operation"},
+		{"several operations", "{ a } { b }", "", "the document has several operations"},
+		{"unknown operation", "query A { a }", "B", `the document has no operation "B"`},
+		{"fragment spread", "{\n  poem(name: \"a\") {\n    ...Fields\n  }\n}", "", "line 3: fragments are not supported"},
+		{"inline fragment", "{ poem(name: \"a\") { ... on Poem { name } } }", "", "line 1: fragments are not supported"},
+		{"fragment definition", "{ a }\nfragment F on Poem { name }", "", "line 2: fragments are not supported"},
+		{"subscription", "subscription { poems }", "", "line 1: subscriptions are not supported"},
+		{"directive", "{\n  poem @skip(if: true) { name }\n}", "", "line 2: directives are not supported"},
+		{"unknown keyword", "find { a }", "", `line 1: expected an operation, got "find"`},
+		{"unclosed selection", "{\n  poem(name: \"a\") {\n    name\n", "", `line 4: expected a field, got ""`},
+		{"empty selection", "{ poem {} }", "", "line 1: empty selection"},
+		{"missing selection", "query Q", "", `line 1: expected "{", got ""`},
+		{"bad alias", "{ a: 1 }", "", `line 1: expected a field after alias "a", got "1"`},
+		{"missing colon", "{ poem(name \"a\") { name } }", "", `line 1: expected ":", got "\"a\""`},
+		{"duplicate argument", "{ poem(name: \"a\", name: \"b\") { name } }", "", `line 1: argument "name" given twice`},
+		{"bad argument name", "{ poem(1: 2) { name } }", "", `line 1: expected an argument, got "1"`},
+		{"missing value", "{ poem(name: ) { name } }", "", `line 1: expected a value, got ")"`},
+		{"bad number", "{ anthology(first: 1-2) { next } }", "", `line 1: expected a value, got "1-2"`},
+		{"list value", "{ poem(name: [\"a\"]) { name } }", "", "line 1: list and object values are not supported"},
+		{"object value", "{ poem(name: {a: 1}) { name } }", "", "line 1: list and object values are not supported"},
+		{"variable in a default", "query($a: Int = $b) { a }", "", `line 1: expected a value, got "$"`},
+		{"variable without $", "query(a: Int) { a }", "", `line 1: expected a variable, got "a"`},
+		{"bad variable name", "query($1: Int) { a }", "", `line 1: expected a variable name, got "1"`},
+		{"bad variable type", "query($a: 1) { a }", "", `line 1: expected a type, got "1"`},
+		{"unclosed list type", "query($a: [Int) { a }", "", `line 1: expected "]", got ")"`},
+		{"bad variable reference", "{ poem(name: $1) { name } }", "", `line 1: expected a variable name, got "1"`},
+		{"unterminated string", "{\n  poem(name: \"ode) { name }\n}", "", "line 2: unterminated string"},
+		{"string across lines", "{ poem(name: \"o\nde\") { name } }", "", "line 1: unterminated string"},
+		{"bad escape", "{ poem(name: \"\\q\") { name } }", "", "line 1: invalid string"},
+		{"unexpected character", "{\n\n  poem(name: \"a\") { name } ; }", "", `line 3: unexpected character ';'`},
+		{"value before a line break", "{ poem(name: \"\\q\"\n) { name } }", "", "line 1: invalid string"},
+		{"missing value before a line break", "{ poem(name:\n\n) { name } }", "", `line 3: expected a value, got ")"`},
+		{"non-ASCII character", "{ pöem { name } }", "", `line 1: unexpected character 'ö'`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			op, err := parseGraphQL(tc.doc, tc.op)
+			if err == nil {
+				t.Fatalf("got %s, want an error", sketch(op.selection))
+			}
+			if !strings.HasPrefix(err.Error(), tc.want) {
+				t.Errorf("got %q, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// Whatever the document, the parser returns instead of panicking or
+// looping forever.
+func TestParseGraphQLTerminates(t *testing.T) {
+	pieces := []string{"{", "}", "(", ")", "a", ":", "$", "!", "=", "[", "]", "\"", "1", "...", "@", "query", "\n", "#", ";"}
+	for _, p1 := range pieces {
+		for _, p2 := range pieces {
+			for _, p3 := range pieces {
+				for _, doc := range []string{p1 + p2 + p3, "{ a" + p1 + p2 + p3, "query($x: Int" + p1 + p2 + p3} {
+					func() {
+						defer func() {
+							if r := recover(); r != nil {
+								t.Errorf("parseGraphQL(%q) panicked: %v", doc, r)
+							}
+						}()
+						parseGraphQL(doc, "")
+					}()
+				}
+			}
+		}
+	}
+}
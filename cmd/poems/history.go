@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appliedgo/di/fsys"
+)
+
+// ### History
+//
+// A poet who has second thoughts wants the poem back as it was yesterday.
+// Storages that keep every revision of their poems implement `Historian`:
+// each save adds a revision, `History` lists them, and `LoadRevision`
+// loads one. The revisions are numbered as in `revisions.go`, so with a
+// storage that is a `Revisioner`, too, the last revision in the history
+// is the revision of the poem.
+//
+// History cannot be emulated, so `History` and `LoadRevision` fail with
+// `ErrNoHistory` for storages that are not `Historian`s. The decorators
+// that pass poems through unchanged pass history through, too, as they do
+// checksums. Those that change poems would have to change every revision
+// back, and do not keep history. The history of a poem goes when the poem
+// is deleted. Nothing is ever pruned.
+//
+// The `VersionedStorage` of `record.go` is something else: it versions
+// the format of poems, not their contents.
+
+// A `RevisionInfo` describes one revision of a poem.
+type RevisionInfo struct {
+	Revision Revision
+	Size     int64     // The length of the poem in bytes.
+	Saved    time.Time // When the revision was saved, or zero if unknown.
+}
+
+// A `Historian` is a storage that keeps the revisions of its poems.
+type Historian interface {
+	// `History` returns the revisions of the poem `name`, the oldest
+	// first. It returns `ErrNoPoem` if there is no such poem.
+	History(ctx context.Context, name string) ([]RevisionInfo, error)
+	// `LoadRevision` loads the revision `rev` of the poem `name`. It
+	// returns `ErrNoRevision` if the poem has no such revision.
+	LoadRevision(ctx context.Context, name string, rev Revision) ([]byte, error)
+}
+
+var (
+	// `ErrNoHistory` is returned for storages that keep no history.
+	ErrNoHistory = errors.New("storage keeps no history")
+	// `ErrNoRevision` is returned for revisions that a poem does not have.
+	ErrNoRevision = errors.New("no such revision")
+)
+
+// `History` returns the revisions of the poem `name` in `ps`, if `ps` is
+// a `Historian`.
+func History(ctx context.Context, ps PoemStorage, name string) ([]RevisionInfo, error) {
+	if h, ok := ps.(Historian); ok {
+		return h.History(ctx, name)
+	}
+	return nil, fmt.Errorf("history of %q in %s: %w", name, ps.Type(), ErrNoHistory)
+}
+
+// `LoadRevision` loads the revision `rev` of the poem `name` in `ps`, if
+// `ps` is a `Historian`.
+func LoadRevision(ctx context.Context, ps PoemStorage, name string, rev Revision) ([]byte, error) {
+	if h, ok := ps.(Historian); ok {
+		return h.LoadRevision(ctx, name, rev)
+	}
+	return nil, fmt.Errorf("load revision %d of %q in %s: %w", rev, name, ps.Type(), ErrNoHistory)
+}
+
+// #### The backends
+//
+// The `FileStorage` keeps the revisions of a poem in a directory next to
+// the poem's file, with the extension ".history", one file per revision,
+// named by its number. A save writes the revision first, and then the
+// poem, so that a poem is never newer than its history. A save that fails
+// in between takes back the revision. The file storage has no revision
+// numbers of its own; a poem's first revision is 1, and each save adds
+// one, under a lock, so instances that share a directory may number two
+// saves alike. Poems saved before the storage kept history get one at
+// their next save.
+
+// `historyDir` returns the directory of the revisions of the poem `name`.
+func (s *FileStorage) historyDir(name string) string {
+	return strings.TrimSuffix(s.file(name), poemExt) + historyExt
+}
+
+// `revisions` returns the revisions of the poem `name` that the history
+// holds, the oldest first.
+func (s *FileStorage) revisions(name string) ([]RevisionInfo, error) {
+	entries, err := fs.ReadDir(s.fs, s.historyDir(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var revs []RevisionInfo
+	for _, e := range entries {
+		rev, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), poemExt), 10, 64)
+		if e.IsDir() || !strings.HasSuffix(e.Name(), poemExt) || err != nil {
+			continue // Not a revision that `FileStorage` wrote.
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, RevisionInfo{Revision: Revision(rev), Size: info.Size(), Saved: info.ModTime()})
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Revision < revs[j].Revision })
+	return revs, nil
+}
+
+// `record` writes `r` as the next revision of the poem `name`, and
+// returns the name of its file. The caller holds `s.mu`.
+func (s *FileStorage) record(name string, r io.Reader) (string, error) {
+	revs, err := s.revisions(name)
+	if err != nil {
+		return "", err
+	}
+	next := Revision(1)
+	if len(revs) > 0 {
+		next = revs[len(revs)-1].Revision + 1
+	}
+	dir := s.historyDir(name)
+	if err := s.fs.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	file := path.Join(dir, strconv.FormatUint(uint64(next), 10)+poemExt)
+	temp := s.temp(s.file(name))
+	if cfs, ok := s.fs.(fsys.CreateFS); ok {
+		w, err := cfs.Create(temp)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(w, r)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			s.fs.Remove(temp)
+			return "", err
+		}
+	} else {
+		contents, err := io.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		if err := s.fs.WriteFile(temp, contents, 0o644); err != nil {
+			return "", err
+		}
+	}
+	if err := s.fs.Rename(temp, file); err != nil {
+		s.fs.Remove(temp)
+		return "", err
+	}
+	return file, nil
+}
+
+// `forget` removes the history of the poem `name`. The caller holds
+// `s.mu`.
+func (s *FileStorage) forget(name string) error {
+	dir := s.historyDir(name)
+	entries, err := fs.ReadDir(s.fs, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := s.fs.Remove(path.Join(dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := s.fs.Remove(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStorage) History(ctx context.Context, name string) ([]RevisionInfo, error) {
+	exists, err := s.Exists(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("history of %q: %w", name, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("history of %q: %w", name, ErrNoPoem)
+	}
+	revs, err := s.revisions(name)
+	if err != nil {
+		return nil, fmt.Errorf("history of %q: %w", name, err)
+	}
+	return revs, nil
+}
+
+func (s *FileStorage) LoadRevision(ctx context.Context, name string, rev Revision) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("load revision %d of %q: %w", rev, name, err)
+	}
+	file := path.Join(s.historyDir(name), strconv.FormatUint(uint64(rev), 10)+poemExt)
+	contents, err := fs.ReadFile(s.fs, file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("load revision %d of %q: %w", rev, name, ErrNoRevision)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load revision %d of %q: %w", rev, name, err)
+	}
+	return contents, nil
+}
+
+// The `SQLiteStorage` copies each row that a save writes to the table
+// "revisions", in the same transaction, since migration 4. Migration 5
+// copies the poems from before, so that every poem has its current
+// revision in its history, and their time of saving is unknown.
+
+func (s *SQLiteStorage) History(ctx context.Context, name string) ([]RevisionInfo, error) {
+	rows, err := s.db.QueryContext(ctx, sqlHistory, name)
+	if err != nil {
+		return nil, fmt.Errorf("history of %q: %w", name, err)
+	}
+	defer rows.Close()
+	var revs []RevisionInfo
+	for rows.Next() {
+		var rev, size, saved int64
+		if err := rows.Scan(&rev, &size, &saved); err != nil {
+			return nil, fmt.Errorf("history of %q: %w", name, err)
+		}
+		info := RevisionInfo{Revision: Revision(rev), Size: size}
+		if saved != 0 {
+			info.Saved = time.Unix(0, saved)
+		}
+		revs = append(revs, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history of %q: %w", name, err)
+	}
+	if len(revs) == 0 {
+		return nil, fmt.Errorf("history of %q: %w", name, ErrNoPoem)
+	}
+	return revs, nil
+}
+
+func (s *SQLiteStorage) LoadRevision(ctx context.Context, name string, rev Revision) ([]byte, error) {
+	var contents []byte
+	err := s.db.QueryRowContext(ctx, sqlLoadRevision, name, int64(rev)).Scan(&contents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("load revision %d of %q: %w", rev, name, ErrNoRevision)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load revision %d of %q: %w", rev, name, err)
+	}
+	if contents == nil {
+		contents = []byte{}
+	}
+	return contents, nil
+}
+
+// #### The decorators
+
+func (s *LoggingStorage) History(ctx context.Context, name string) ([]RevisionInfo, error) {
+	return History(ctx, s.storage, name)
+}
+
+func (s *LoggingStorage) LoadRevision(ctx context.Context, name string, rev Revision) ([]byte, error) {
+	return LoadRevision(ctx, s.storage, name, rev)
+}
+
+func (r *ReadOnly) History(ctx context.Context, name string) ([]RevisionInfo, error) {
+	return History(ctx, r.storage, name)
+}
+
+func (r *ReadOnly) LoadRevision(ctx context.Context, name string, rev Revision) ([]byte, error) {
+	return LoadRevision(ctx, r.storage, name, rev)
+}
+
+func (s *CatalogStorage) History(ctx context.Context, name string) ([]RevisionInfo, error) {
+	return History(ctx, s.storage, name)
+}
+
+func (s *CatalogStorage) LoadRevision(ctx context.Context, name string, rev Revision) ([]byte, error) {
+	return LoadRevision(ctx, s.storage, name, rev)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// #### Conformance
+//
+// `checkHistory` checks that the history of each poem in `names` is in
+// order, that each revision loads with its size, and that the last one
+// is the poem. If `saved` has the contents of every save of a poem, the
+// history must hold exactly those. Revisions that the history does not
+// list do not load. `TestLaws` runs it on every stack, and on the
+// backends with the saves of the trial.
+func checkHistory(ctx context.Context, ps PoemStorage, names []string, saved map[string][][]byte) error {
+	for _, name := range names {
+		contents, err := ps.Load(ctx, name)
+		revs, herr := History(ctx, ps, name)
+		if errors.Is(herr, ErrNoHistory) {
+			return nil
+		}
+		if errors.Is(err, ErrNoPoem) {
+			if !errors.Is(herr, ErrNoPoem) {
+				return fmt.Errorf("history of missing poem %q: got %v, %v, want ErrNoPoem", name, revs, herr)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if herr != nil {
+			return fmt.Errorf("history of %q: %w", name, herr)
+		}
+		if want, ok := saved[name]; ok && len(revs) != len(want) {
+			return fmt.Errorf("history of %q has %d revisions, want %d", name, len(revs), len(want))
+		}
+		for i, info := range revs {
+			if i > 0 && info.Revision <= revs[i-1].Revision {
+				return fmt.Errorf("history of %q out of order: %v", name, revs)
+			}
+			rc, err := LoadRevision(ctx, ps, name, info.Revision)
+			if err != nil || int64(len(rc)) != info.Size {
+				return fmt.Errorf("revision %d of %q: %d bytes, %v, want %d bytes", info.Revision, name, len(rc), err, info.Size)
+			}
+			if want, ok := saved[name]; ok && string(rc) != string(want[i]) {
+				return fmt.Errorf("revision %d of %q: %q, want %q", info.Revision, name, rc, want[i])
+			}
+			if i == len(revs)-1 && string(rc) != string(contents) {
+				return fmt.Errorf("last revision %d of %q: %q, but the poem is %q", info.Revision, name, rc, contents)
+			}
+		}
+		next := Revision(1)
+		if len(revs) > 0 {
+			next = revs[len(revs)-1].Revision + 1
+		}
+		for _, rev := range []Revision{0, next} {
+			if _, err := LoadRevision(ctx, ps, name, rev); !errors.Is(err, ErrNoRevision) {
+				return fmt.Errorf("revision %d of %q: got %v, want ErrNoRevision", rev, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Switching storage while the program runs
+//
+// A `Poem` gets its storage once, when it is built. Rewiring the container
+// changes the storage of poems built later, but a server that runs for
+// weeks holds on to the ones it built at startup. A `HotStorage` is the
+// indirection that lets those switch, too: it is a `PoemStorage` that
+// forwards every call to the current value of a `di.Hot[PoemStorage]`.
+// After `Container.Replace`, the next call goes to the new storage.
+
+// `HotStorage` forwards to whichever storage is currently bound.
+type HotStorage struct {
+	storage di.Hot[PoemStorage]
+}
+
+// `NewHotStorage` forwards to the storage that `ps` stands for.
+func NewHotStorage(ps di.Hot[PoemStorage]) *HotStorage {
+	return &HotStorage{
+		storage: ps,
+	}
+}
+
+// `Save` and `Load` fail if the storage cannot be resolved. `Replace` only
+// hands off storages that it could construct, so that happens only if the
+// first storage fails. `Type` has no way to report the error, and panics.
+
+func (s *HotStorage) Save(ctx context.Context, name string, contents []byte) error {
+	ps, err := s.storage.Get()
+	if err != nil {
+		return err
+	}
+	return ps.Save(ctx, name, contents)
+}
+
+func (s *HotStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	ps, err := s.storage.Get()
+	if err != nil {
+		return nil, err
+	}
+	return ps.Load(ctx, name)
+}
+
+func (s *HotStorage) Type() string {
+	return s.storage.MustGet().Type()
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Idempotency keys
+//
+// A client that saves a poem and loses the connection before the response
+// arrives does not know whether the poem was saved. If it tries again, the
+// poem may be saved twice: harmless for a favorite, less so for an
+// operation that appends. So clients send an `Idempotency-Key` header with
+// a value that is unique for the operation, and send the same value when
+// they retry. The middleware "idempotency" runs the first request with a
+// key, and answers retries with the response of the first one, marked with
+// `Idempotent-Replayed: true`.
+//
+// Keys belong to tenants, so that two tenants who pick the same key do not
+// see each other's responses. The example has no authentication, so the
+// tenant is the header `X-Tenant`; a real server would take it from the
+// credentials.
+//
+// Where the responses are kept is an `IdempotencyStore`, which the setting
+// "http.idempotency.store" selects: "memory" for a single server, "redis"
+// for several servers behind a load balancer, which must all see the same
+// keys. The store forgets a response after "http.idempotency.ttl".
+//
+// A retry that arrives while the first request still runs gets 409
+// Conflict. A request that reuses a key for a different operation, that
+// is, with a different method, path, or body, gets 422 Unprocessable
+// Entity. Responses with a 5xx status are not kept, so the retry of a
+// request that failed on the server runs again.
+
+// An `IdempotentResponse` is a response that a store keeps for retries.
+type IdempotentResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// An `IdempotencyStore` keeps the responses to requests by key.
+type IdempotencyStore interface {
+	// `Begin` claims `key` for a request with `fingerprint`. For a new key,
+	// it returns nil, and the caller runs the request, then calls `Finish`
+	// or `Abandon`. For a key whose request has finished, it returns the
+	// response. Otherwise, it returns `ErrInFlight`, or `ErrKeyReused` if
+	// the fingerprint differs.
+	Begin(ctx context.Context, key, fingerprint string) (*IdempotentResponse, error)
+
+	// `Finish` keeps the response of the request that claimed `key`.
+	Finish(ctx context.Context, key string, resp *IdempotentResponse) error
+
+	// `Abandon` releases `key`, so that a retry runs the request again.
+	Abandon(ctx context.Context, key string) error
+}
+
+var (
+	// `ErrInFlight` is returned for keys whose request is still running.
+	ErrInFlight = errors.New("a request with this idempotency key is in progress")
+
+	// `ErrKeyReused` is returned for keys of a different request.
+	ErrKeyReused = errors.New("the idempotency key belongs to a different request")
+)
+
+// An `idempotencyEntry` is what the stores keep for a key.
+type idempotencyEntry struct {
+	Fingerprint string              `json:"fingerprint"`
+	Response    *IdempotentResponse `json:"response,omitempty"` // Nil while the request runs.
+}
+
+// `replay` returns the response of the entry for a request with
+// `fingerprint`.
+func (e *idempotencyEntry) replay(fingerprint string) (*IdempotentResponse, error) {
+	switch {
+	case e.Fingerprint != fingerprint:
+		return nil, ErrKeyReused
+	case e.Response == nil:
+		return nil, ErrInFlight
+	}
+	return e.Response, nil
+}
+
+// `NewIdempotencyStore` returns the store that `cfg` selects. Only the
+// Redis store resolves `redis`.
+func NewIdempotencyStore(cfg IdempotencyConfig, redis di.Lazy[Redis]) (IdempotencyStore, error) {
+	switch cfg.Store {
+	case "memory":
+		return NewMemoryIdempotency(cfg.TTL), nil
+	case "redis":
+		r, err := redis.Get()
+		if err != nil {
+			return nil, err
+		}
+		return NewRedisIdempotency(r, cfg.TTL), nil
+	}
+	return nil, fmt.Errorf("unknown idempotency store %q (want memory or redis)", cfg.Store)
+}
+
+// #### The middleware
+
+// `Idempotency` replays responses to retried requests.
+type Idempotency struct {
+	store IdempotencyStore
+}
+
+// `NewIdempotency` keeps responses in `store`.
+func NewIdempotency(store IdempotencyStore) *Idempotency {
+	return &Idempotency{store: store}
+}
+
+func (*Idempotency) Name() string { return "idempotency" }
+
+// `maxIdempotentBody` limits the size of requests with a key, whose body
+// the middleware reads to compare retries with the first request.
+const maxIdempotentBody = 1 << 20
+
+func (m *Idempotency) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxIdempotentBody {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The length of the tenant keeps "a:b" + "c" apart from "a" + "b:c".
+		tenant := r.Header.Get("X-Tenant")
+		key = strconv.Itoa(len(tenant)) + ":" + tenant + ":" + key
+		fp := fingerprint(r, body)
+		ctx := r.Context()
+		resp, err := m.store.Begin(ctx, key, fp)
+		switch {
+		case errors.Is(err, ErrInFlight):
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, ErrKeyReused):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case err != nil:
+			// Without the store, a retry could not be recognized.
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case resp != nil:
+			for k, v := range resp.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(resp.Status)
+			w.Write(resp.Body)
+			return
+		}
+
+		rec := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+		finished := false
+		defer func() {
+			if !finished {
+				m.store.Abandon(ctx, key) // The handler panicked.
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		finished = true
+		if rec.status >= 500 {
+			m.store.Abandon(ctx, key)
+			return
+		}
+		m.store.Finish(ctx, key, &IdempotentResponse{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()})
+	})
+}
+
+// `fingerprint` identifies the operation of a request: its method, its
+// URL, and its body.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// A `responseCapture` passes a response through and keeps a copy.
+type responseCapture struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	c.status = status
+	c.header = c.ResponseWriter.Header().Clone()
+	// A replay gets its own date and its own session cookie.
+	c.header.Del("Date")
+	c.header.Del("Set-Cookie")
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.body.Write(p)
+	return c.ResponseWriter.Write(p)
+}
+
+// #### The stores
+
+// `MemoryIdempotency` keeps responses in memory.
+type MemoryIdempotency struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	swept   time.Time
+}
+
+type memoryEntry struct {
+	idempotencyEntry
+	expires time.Time
+}
+
+// `NewMemoryIdempotency` keeps responses for `ttl`.
+func NewMemoryIdempotency(ttl time.Duration) *MemoryIdempotency {
+	return &MemoryIdempotency{ttl: ttl, entries: map[string]*memoryEntry{}, swept: time.Now()}
+}
+
+func (s *MemoryIdempotency) Begin(_ context.Context, key, fingerprint string) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.swept) > s.ttl {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.swept = now
+	}
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e.replay(fingerprint)
+	}
+	s.entries[key] = &memoryEntry{idempotencyEntry{Fingerprint: fingerprint}, now.Add(s.ttl)}
+	return nil, nil
+}
+
+func (s *MemoryIdempotency) Finish(_ context.Context, key string, resp *IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.Response, e.expires = resp, time.Now().Add(s.ttl)
+	}
+	return nil
+}
+
+func (s *MemoryIdempotency) Abandon(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// `RedisIdempotency` keeps responses in Redis, as JSON under
+// "poems:idempotency:<key>". `SET NX` claims a key atomically, so of two
+// servers that get the same key at once, only one runs the request.
+type RedisIdempotency struct {
+	redis Redis
+	ttl   time.Duration
+}
+
+// `NewRedisIdempotency` keeps responses in `r` for `ttl`.
+func NewRedisIdempotency(r Redis, ttl time.Duration) *RedisIdempotency {
+	return &RedisIdempotency{redis: r, ttl: ttl}
+}
+
+func (s *RedisIdempotency) key(key string) string {
+	return "poems:idempotency:" + key
+}
+
+func (s *RedisIdempotency) Begin(ctx context.Context, key, fingerprint string) (*IdempotentResponse, error) {
+	claim, err := json.Marshal(idempotencyEntry{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+	ttl := strconv.FormatInt(s.ttl.Milliseconds(), 10)
+	// If the entry expires between SET and GET, the second round claims it.
+	for round := 0; round < 2; round++ {
+		reply, err := s.redis.Do(ctx, "SET", s.key(key), string(claim), "NX", "PX", ttl)
+		if err != nil {
+			return nil, err
+		}
+		if reply != nil {
+			return nil, nil // Claimed.
+		}
+		reply, err = s.redis.Do(ctx, "GET", s.key(key))
+		if err != nil {
+			return nil, err
+		}
+		stored, ok := reply.(string)
+		if !ok {
+			continue
+		}
+		var e idempotencyEntry
+		if err := json.Unmarshal([]byte(stored), &e); err != nil {
+			return nil, fmt.Errorf("idempotency key %q: %w", key, err)
+		}
+		return e.replay(fingerprint)
+	}
+	return nil, fmt.Errorf("idempotency key %q: cannot claim", key)
+}
+
+func (s *RedisIdempotency) Finish(ctx context.Context, key string, resp *IdempotentResponse) error {
+	reply, err := s.redis.Do(ctx, "GET", s.key(key))
+	if err != nil {
+		return err
+	}
+	stored, ok := reply.(string)
+	if !ok {
+		return nil // Expired while the request ran.
+	}
+	var e idempotencyEntry
+	if err := json.Unmarshal([]byte(stored), &e); err != nil {
+		return err
+	}
+	e.Response = resp
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.redis.Do(ctx, "SET", s.key(key), string(data), "PX", strconv.FormatInt(s.ttl.Milliseconds(), 10))
+	return err
+}
+
+func (s *RedisIdempotency) Abandon(ctx context.Context, key string) error {
+	_, err := s.redis.Do(ctx, "DEL", s.key(key))
+	return err
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// #### Idempotency tests
+
+// `idempotencyStores` creates fresh stores of each kind that keep
+// responses for `ttl`.
+var idempotencyStores = []struct {
+	name string
+	new  func(ttl time.Duration) IdempotencyStore
+}{
+	{"memory", func(ttl time.Duration) IdempotencyStore { return NewMemoryIdempotency(ttl) }},
+	{"redis", func(ttl time.Duration) IdempotencyStore { return NewRedisIdempotency(newMemRedis(), ttl) }},
+}
+
+func TestIdempotencyStores(t *testing.T) {
+	ctx := context.Background()
+	for _, st := range idempotencyStores {
+		t.Run(st.name, func(t *testing.T) {
+			s := st.new(time.Minute)
+			if resp, err := s.Begin(ctx, "k", "fp"); resp != nil || err != nil {
+				t.Fatalf("new key: got %v, %v", resp, err)
+			}
+			if _, err := s.Begin(ctx, "k", "fp"); !errors.Is(err, ErrInFlight) {
+				t.Errorf("running request: got %v, want %v", err, ErrInFlight)
+			}
+			if _, err := s.Begin(ctx, "k", "other"); !errors.Is(err, ErrKeyReused) {
+				t.Errorf("other request: got %v, want %v", err, ErrKeyReused)
+			}
+
+			want := &IdempotentResponse{Status: 201, Header: http.Header{"X-Poem": {"ode"}}, Body: []byte("saved")}
+			if err := s.Finish(ctx, "k", want); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := s.Begin(ctx, "k", "fp")
+			if err != nil || resp == nil || resp.Status != 201 || string(resp.Body) != "saved" || resp.Header.Get("X-Poem") != "ode" {
+				t.Errorf("finished request: got %+v, %v", resp, err)
+			}
+			if _, err := s.Begin(ctx, "k", "other"); !errors.Is(err, ErrKeyReused) {
+				t.Errorf("other request after finishing: got %v, want %v", err, ErrKeyReused)
+			}
+
+			// An abandoned key can be claimed again.
+			s.Begin(ctx, "abandoned", "fp")
+			if err := s.Abandon(ctx, "abandoned"); err != nil {
+				t.Fatal(err)
+			}
+			if resp, err := s.Begin(ctx, "abandoned", "fp2"); resp != nil || err != nil {
+				t.Errorf("abandoned key: got %v, %v", resp, err)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoresForget(t *testing.T) {
+	ctx := context.Background()
+	for _, st := range idempotencyStores {
+		t.Run(st.name, func(t *testing.T) {
+			s := st.new(20 * time.Millisecond)
+			s.Begin(ctx, "k", "fp")
+			s.Finish(ctx, "k", &IdempotentResponse{Status: 200})
+			time.Sleep(50 * time.Millisecond)
+			if resp, err := s.Begin(ctx, "k", "other"); resp != nil || err != nil {
+				t.Errorf("expired key: got %v, %v", resp, err)
+			}
+		})
+	}
+}
+
+// `idempotentServer` is a handler behind the middleware that counts its
+// calls, and answers with the status in the header "Want-Status".
+type idempotentServer struct {
+	mu    sync.Mutex
+	calls int
+	h     http.Handler
+}
+
+func newIdempotentServer(store IdempotencyStore) *idempotentServer {
+	s := &idempotentServer{}
+	s.h = NewIdempotency(store).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls++
+		n := s.calls
+		s.mu.Unlock()
+		status := http.StatusCreated
+		if r.Header.Get("Want-Status") == "500" {
+			status = http.StatusInternalServerError
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s"})
+		w.Header().Set("X-Call", strings.Repeat("I", n))
+		w.WriteHeader(status)
+		w.Write([]byte("call " + strings.Repeat("I", n)))
+	}))
+	return s
+}
+
+// `do` sends a request and returns the response.
+func (s *idempotentServer) do(method, path, key, tenant, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	if tenant != "" {
+		r.Header.Set("X-Tenant", tenant)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	for _, st := range idempotencyStores {
+		t.Run(st.name, func(t *testing.T) {
+			s := newIdempotentServer(st.new(time.Minute))
+			first := s.do("POST", "/poems/ode", "k1", "", "Oh")
+			retry := s.do("POST", "/poems/ode", "k1", "", "Oh")
+			if s.calls != 1 {
+				t.Errorf("the handler ran %d times, want once", s.calls)
+			}
+			if retry.Code != first.Code || retry.Body.String() != first.Body.String() || retry.Header().Get("X-Call") != "I" {
+				t.Errorf("replay: got %d %q, want %d %q", retry.Code, retry.Body, first.Code, first.Body)
+			}
+			if retry.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+				t.Error("Idempotent-Replayed is not set on the replay only")
+			}
+			if retry.Header().Get("Set-Cookie") != "" {
+				t.Error("the replay has the first response's cookie")
+			}
+
+			for _, tc := range []struct {
+				name, method, path, body string
+				want                     int
+			}{
+				{"other body", "POST", "/poems/ode", "Ah", http.StatusUnprocessableEntity},
+				{"other path", "POST", "/poems/elegy", "Oh", http.StatusUnprocessableEntity},
+				{"other method", "PUT", "/poems/ode", "Oh", http.StatusUnprocessableEntity},
+			} {
+				if rec := s.do(tc.method, tc.path, "k1", "", tc.body); rec.Code != tc.want {
+					t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.want)
+				}
+			}
+
+			// Requests without a key, and safe methods, are not deduplicated.
+			s.do("POST", "/poems/ode", "", "", "Oh")
+			s.do("POST", "/poems/ode", "", "", "Oh")
+			s.do("GET", "/poems/ode", "k1", "", "")
+			if s.calls != 4 {
+				t.Errorf("the handler ran %d times, want 4", s.calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyAbandonsServerErrors(t *testing.T) {
+	for _, st := range idempotencyStores {
+		t.Run(st.name, func(t *testing.T) {
+			s := newIdempotentServer(st.new(time.Minute))
+			if rec := s.do("POST", "/poems/ode", "k", "", "Oh", "Want-Status", "500"); rec.Code != 500 {
+				t.Fatalf("got %d", rec.Code)
+			}
+			rec := s.do("POST", "/poems/ode", "k", "", "Oh")
+			if rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "" || s.calls != 2 {
+				t.Errorf("retry after a 5xx: got %d, %d calls, want the request to run again", rec.Code, s.calls)
+			}
+			if rec := s.do("POST", "/poems/ode", "k", "", "Oh"); rec.Header().Get("Idempotent-Replayed") != "true" {
+				t.Error("the successful retry was not kept")
+			}
+		})
+	}
+}
+
+func TestIdempotencyTenants(t *testing.T) {
+	for _, st := range idempotencyStores {
+		t.Run(st.name, func(t *testing.T) {
+			s := newIdempotentServer(st.new(time.Minute))
+			for _, tenant := range []string{"alice", "bob", ""} {
+				if rec := s.do("POST", "/poems/ode", "k", tenant, "Oh"); rec.Header().Get("Idempotent-Replayed") != "" {
+					t.Errorf("tenant %q got another tenant's response", tenant)
+				}
+			}
+			// Tenant and key are kept apart, whatever their colons.
+			a := s.do("POST", "/poems/ode", "b:c", "a", "x")
+			b := s.do("POST", "/poems/ode", "c", "a:b", "y")
+			if a.Code != http.StatusCreated || b.Code != http.StatusCreated || s.calls != 5 {
+				t.Errorf("got %d and %d with %d calls, want two fresh requests", a.Code, b.Code, s.calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	for _, st := range idempotencyStores {
+		t.Run(st.name, func(t *testing.T) {
+			entered, release := make(chan struct{}), make(chan struct{})
+			h := NewIdempotency(st.new(time.Minute)).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(entered)
+				<-release
+			}))
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				r := httptest.NewRequest("POST", "/poems/ode", strings.NewReader("Oh"))
+				r.Header.Set("Idempotency-Key", "k")
+				h.ServeHTTP(httptest.NewRecorder(), r)
+			}()
+			<-entered
+			r := httptest.NewRequest("POST", "/poems/ode", strings.NewReader("Oh"))
+			r.Header.Set("Idempotency-Key", "k")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			close(release)
+			<-done
+			if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+				t.Errorf("got %d, Retry-After %q, want 409 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestIdempotencyAbandonsPanics(t *testing.T) {
+	store := NewMemoryIdempotency(time.Minute)
+	h := NewIdempotency(store).Wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("broken handler")
+	}))
+	func() {
+		defer func() { recover() }()
+		r := httptest.NewRequest("POST", "/poems/ode", strings.NewReader("Oh"))
+		r.Header.Set("Idempotency-Key", "k")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+	if _, err := store.Begin(context.Background(), "0::k", "any"); err != nil {
+		t.Errorf("the key of a panicking request was kept: %v", err)
+	}
+}
+
+func TestIdempotencyLimits(t *testing.T) {
+	s := newIdempotentServer(NewMemoryIdempotency(time.Minute))
+	if rec := s.do("POST", "/poems/ode", strings.Repeat("k", 256), "", "Oh"); rec.Code != http.StatusBadRequest {
+		t.Errorf("long key: got %d", rec.Code)
+	}
+	if rec := s.do("POST", "/poems/ode", "k", "", strings.Repeat("x", maxIdempotentBody+1)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: got %d", rec.Code)
+	}
+	if s.calls != 0 {
+		t.Errorf("the handler ran %d times", s.calls)
+	}
+}
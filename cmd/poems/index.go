@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/appliedgo/di"
+)
+
+// ### A cycle through an interface
+//
+// An `IndexedStorage` tells an `Index` about every poem it saves, so that
+// poems can be found by their words. When the index drifts, `Rebuild`
+// reads the poems again, and it reads them through the `IndexedStorage`,
+// because that is the storage whose poems it indexes. Each needs the
+// other: a cycle that the container would refuse to build.
+//
+// The index does not need the storage while it is built, only later. So
+// the index gets a `StorageProxy` instead: a `PoemStorage` that resolves
+// the indexed storage on its first call. `di.Proxy` tells the container to
+// inject it where resolving the indexed storage would close the cycle.
+
+// An `Index` knows which poems contain which words. It is safe for
+// concurrent use.
+type Index struct {
+	storage PoemStorage
+
+	mu    sync.RWMutex
+	words map[string]map[string]bool
+	poems map[string][]string // The words of each poem, to forget them.
+}
+
+// `NewIndex` indexes the poems of `ps`.
+func NewIndex(ps PoemStorage) *Index {
+	return &Index{
+		storage: ps,
+		words:   map[string]map[string]bool{},
+		poems:   map[string][]string{},
+	}
+}
+
+// `Add` indexes the words of a poem, instead of those it had before.
+func (i *Index) Add(name string, contents []byte) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remove(name)
+	ws := words(string(contents))
+	for _, w := range ws {
+		if i.words[w] == nil {
+			i.words[w] = map[string]bool{}
+		}
+		i.words[w][name] = true
+	}
+	i.poems[name] = ws
+}
+
+// `Remove` forgets a poem.
+func (i *Index) Remove(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remove(name)
+}
+
+func (i *Index) remove(name string) {
+	for _, w := range i.poems[name] {
+		delete(i.words[w], name)
+		if len(i.words[w]) == 0 {
+			delete(i.words, w)
+		}
+	}
+	delete(i.poems, name)
+}
+
+// `words` splits `text` into the words that the index knows it by:
+// lowercase, and without punctuation around them.
+func words(text string) []string {
+	var ws []string
+	for _, w := range strings.Fields(strings.ToLower(text)) {
+		if w = strings.Trim(w, ".,;:!?\"'"); w != "" {
+			ws = append(ws, w)
+		}
+	}
+	return ws
+}
+
+// `Rebuild` forgets the index and reads the named poems again. It stops at
+// the first poem that cannot be read.
+func (i *Index) Rebuild(ctx context.Context, names ...string) error {
+	i.mu.Lock()
+	i.words = map[string]map[string]bool{}
+	i.poems = map[string][]string{}
+	i.mu.Unlock()
+	for _, name := range names {
+		contents, err := i.storage.Load(ctx, name)
+		if err != nil {
+			return err
+		}
+		i.Add(name, contents)
+	}
+	return nil
+}
+
+// `Lookup` returns the names of the poems that contain `word`, sorted.
+func (i *Index) Lookup(word string) []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	var names []string
+	for name := range i.words[strings.ToLower(word)] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// An `IndexedStorage` saves poems to a storage and adds them to an index.
+type IndexedStorage struct {
+	storage PoemStorage
+	index   *Index
+
+	// Held by `Save` and `Delete`, so that the index sees them in the
+	// order that the storage does.
+	mu sync.Mutex
+}
+
+// `NewIndexedStorage` saves to `ps` and indexes into `idx`.
+func NewIndexedStorage(ps PoemStorage, idx *Index) *IndexedStorage {
+	return &IndexedStorage{
+		storage: ps,
+		index:   idx,
+	}
+}
+
+func (s *IndexedStorage) Save(ctx context.Context, name string, contents []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.storage.Save(ctx, name, contents); err != nil {
+		return err
+	}
+	s.index.Add(name, contents)
+	return nil
+}
+
+func (s *IndexedStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	return s.storage.Load(ctx, name)
+}
+
+func (s *IndexedStorage) Type() string {
+	return "Indexed" + s.storage.Type()
+}
+
+// A `StorageProxy` forwards to a storage that it resolves on first use.
+// Like `HotStorage`, it fails if the storage cannot be resolved.
+type StorageProxy struct {
+	target di.Lazy[PoemStorage]
+}
+
+// `NewStorageProxy` forwards to the storage that `target` stands for.
+func NewStorageProxy(target di.Lazy[PoemStorage]) PoemStorage {
+	return StorageProxy{target: target}
+}
+
+func (p StorageProxy) Save(ctx context.Context, name string, contents []byte) error {
+	ps, err := p.target.Get()
+	if err != nil {
+		return err
+	}
+	return ps.Save(ctx, name, contents)
+}
+
+func (p StorageProxy) Load(ctx context.Context, name string) ([]byte, error) {
+	ps, err := p.target.Get()
+	if err != nil {
+		return nil, err
+	}
+	return ps.Load(ctx, name)
+}
+
+func (p StorageProxy) Type() string {
+	return p.target.MustGet().Type()
+}
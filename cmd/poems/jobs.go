@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Background jobs
+//
+// A server runs some work on a schedule rather than on request. Each piece
+// of work is a `Job`, a member of the group "jobs", and a `Scheduler` runs
+// them all on the instance that the `LeaderElector` elects, so each job
+// runs on exactly one instance at a time. See `leader.go`.
+//
+// The scheduler appends a hook to the container's `di.Lifecycle`: the
+// container starts it with `Start` once the server is wired up, and stops
+// it with `Stop`, which resigns the leadership so that another instance
+// can take over right away rather than after the TTL.
+
+// A `Job` is work that runs every `Every` on the leader.
+type Job struct {
+	Name  string
+	Every time.Duration
+	// `Run` does the work once. Its context is canceled when the
+	// leadership ends.
+	Run func(ctx context.Context) error
+}
+
+// `Scheduler` runs jobs on the leader.
+type Scheduler struct {
+	elector LeaderElector
+	log     *log.Logger
+	jobs    []Job
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// `NewScheduler` schedules `jobs` on the leader that `elector` elects. It
+// starts and stops with `lc`. Jobs that run every 0 or less are left out.
+func NewScheduler(elector LeaderElector, lc di.Lifecycle, l *log.Logger, jobs ...Job) *Scheduler {
+	s := &Scheduler{elector: elector, log: l}
+	for _, job := range jobs {
+		if job.Every > 0 {
+			s.jobs = append(s.jobs, job)
+		}
+	}
+	lc.Append(di.Hook{OnStart: s.start, OnStop: s.stop})
+	return s
+}
+
+// `campaignRetry` is how long the scheduler waits before it campaigns
+// again after a campaign failed.
+const campaignRetry = 5 * time.Second
+
+func (s *Scheduler) start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		for ctx.Err() == nil {
+			s.lead(ctx)
+		}
+	}()
+	return nil
+}
+
+// `stop` waits for the jobs that are running to return, or for `ctx`.
+func (s *Scheduler) stop(ctx context.Context) error {
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stop jobs: %w", ctx.Err())
+	}
+}
+
+// `lead` campaigns, and runs the jobs while it leads.
+func (s *Scheduler) lead(ctx context.Context) {
+	if len(s.jobs) == 0 {
+		<-ctx.Done()
+		return
+	}
+	leading, resign, err := s.elector.Campaign(ctx, "jobs")
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.Println(err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(campaignRetry):
+			}
+		}
+		return
+	}
+	s.log.Println("leading")
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			s.every(leading, job)
+		}(job)
+	}
+	wg.Wait()
+	if err := resign(); err != nil {
+		s.log.Println(err)
+	}
+	s.log.Println("no longer leading")
+}
+
+// `every` runs `job` every `job.Every` until `leading` is done. The first
+// run is one interval after the leadership begins, so that a leader that
+// changes often does not run the job more often.
+func (s *Scheduler) every(leading context.Context, job Job) {
+	t := time.NewTicker(job.Every)
+	defer t.Stop()
+	for {
+		select {
+		case <-leading.Done():
+			return
+		case <-t.C:
+		}
+		start := time.Now()
+		if err := job.Run(leading); err != nil {
+			s.log.Printf("%s: %v", job.Name, err)
+			continue
+		}
+		s.log.Printf("%s: done in %v", job.Name, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// #### Scrubbing
+
+// `ScrubJob` checks that every poem that `ps` lists also loads, and logs
+// those that do not, such as poems whose encryption key is gone or whose
+// file is damaged.
+func ScrubJob(ps PoemStorage, every time.Duration, l *log.Logger) Job {
+	return Job{
+		Name:  "scrub",
+		Every: every,
+		Run: func(ctx context.Context) error {
+			lister, ok := ps.(Lister)
+			if !ok {
+				return fmt.Errorf("scrub %s: %w", ps.Type(), ErrNotListable)
+			}
+			var after Cursor
+			for {
+				names, next, err := lister.List(ctx, after, 0)
+				if err != nil {
+					return fmt.Errorf("scrub: %w", err)
+				}
+				for _, name := range names {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					if _, err := ps.Load(ctx, name); err != nil {
+						l.Printf("scrub: poem %q does not load: %v", name, err)
+					}
+				}
+				if next == "" {
+					return nil
+				}
+				after = next
+			}
+		},
+	}
+}
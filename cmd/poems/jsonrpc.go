@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/appliedgo/di"
+)
+
+// ### JSON-RPC
+//
+// A poet with two machines wants one storage. The JSON-RPC endpoint at
+// "/rpc" offers the storage and the use cases of the server to other
+// programs, and a `RemoteStorage` is a `PoemStorage` that calls it. The
+// program that writes poems does not know that its storage is remote; the
+// container injects a `RemoteStorage` where it would inject a notebook.
+//
+//	POEMS_HTTP_RPC=true go run ./cmd/poems -serve :8080
+//	go run ./cmd/poems -remote http://localhost:8080/rpc
+//
+// The endpoint speaks JSON-RPC 2.0 over HTTP POST, with parameters by name,
+// batches, and notifications. The methods:
+//
+//	storage.save   {name, contents} → null        (contents in base64)
+//	storage.load   {name} → contents, or null
+//	storage.type   → string
+//	storage.list   {after, limit} → {names, next}
+//	poems.read     {name} → {name, text, checksum, revision}
+//	poems.browse   {after, limit} → {poems, next}
+//	poems.write    {name, text, revision} → {name, text, checksum, revision}
+//
+// With a revision, "poems.write" only saves a poem that is still at that
+// revision, and fails with `ErrConflict` otherwise; see `revisions.go`.
+//
+// Like the GraphQL endpoint, it is a module that `main` installs if the
+// setting "http.rpc" is true.
+
+// `RPCModule` provides the JSON-RPC endpoint for the file storage.
+var RPCModule = di.Module("rpc",
+	di.Provide(NewRPCServer, di.ParamNames("files")),
+)
+
+// JSON-RPC error codes. Codes from -32000 to -32099 are for the server's
+// own errors; `rpcErrors` maps them to the errors of the use cases, in
+// both directions.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcNoMethod       = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+var rpcErrors = map[int]error{
+	-32000: ErrNoPoem,
+	-32001: ErrNotListable,
+	-32002: ErrBadCursor,
+	-32003: ErrConflict,
+}
+
+// An `RPCError` is the error of a JSON-RPC response. It matches the
+// sentinel error of its code with `errors.Is`, so that clients can check
+// for `ErrNoPoem` whether the storage is local or not.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc: %s (%d)", e.Message, e.Code)
+}
+
+func (e *RPCError) Unwrap() error {
+	return rpcErrors[e.Code]
+}
+
+// `rpcRequest` and `rpcResponse` are the messages of JSON-RPC 2.0. A
+// request without an ID is a notification, which gets no response.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// An `rpcMethod` decodes its parameters and returns its result. `ctx` is
+// the context of the HTTP request, which ends when the client goes away.
+type rpcMethod func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// An `RPCServer` serves a storage and the use cases.
+type RPCServer struct {
+	methods map[string]rpcMethod
+}
+
+// `NewRPCServer` serves the storage `ps` and the use cases that `d`
+// dispatches to.
+func NewRPCServer(ps PoemStorage, d *Dispatcher) *RPCServer {
+	type name struct {
+		Name string `json:"name"`
+	}
+	type page struct {
+		After Cursor `json:"after"`
+		Limit int    `json:"limit"`
+	}
+	return &RPCServer{methods: map[string]rpcMethod{
+		"storage.save": func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+			var p struct {
+				Name     string `json:"name"`
+				Contents []byte `json:"contents"`
+			}
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			return nil, ps.Save(ctx, p.Name, p.Contents)
+		},
+		"storage.load": func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+			var p name
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			return ps.Load(ctx, p.Name)
+		},
+		"storage.type": func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+			return ps.Type(), nil
+		},
+		"storage.list": func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+			var p page
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			l, ok := ps.(Lister)
+			if !ok {
+				return nil, ErrNotListable
+			}
+			names, next, err := l.List(ctx, p.After, p.Limit)
+			if err != nil {
+				return nil, err
+			}
+			return rpcPage{Names: names, Next: next}, nil
+		},
+		"poems.read": func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+			var p name
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			return Ask[PoemView](ctx, d, ReadPoem{Name: p.Name})
+		},
+		"poems.browse": func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+			var p page
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			return Ask[Anthology](ctx, d, BrowsePoems{After: p.After, Limit: p.Limit})
+		},
+		"poems.write": func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+			var p struct {
+				Name     string    `json:"name"`
+				Text     string    `json:"text"`
+				Revision *Revision `json:"revision"`
+			}
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			return writePoem(ctx, d, WritePoem{Name: p.Name, Text: p.Text, Revision: p.Revision})
+		},
+	}}
+}
+
+// An `rpcPage` is the result of "storage.list".
+type rpcPage struct {
+	Names []string `json:"names"`
+	Next  Cursor   `json:"next,omitempty"`
+}
+
+// `errInvalidParams` marks errors in the parameters of a request.
+var errInvalidParams = errors.New("invalid params")
+
+// `rpcParams` decodes the parameters of a request, which must be an object
+// with known fields, or absent.
+func rpcParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidParams, err)
+	}
+	return nil
+}
+
+func (s *RPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		rpcReply(w, rpcResponse{JSONRPC: "2.0", Error: &RPCError{rpcParseError, "parse error"}, ID: json.RawMessage("null")})
+		return
+	}
+	if body = bytes.TrimSpace(body); len(body) == 0 || body[0] != '[' {
+		if resp, ok := s.call(r.Context(), body); ok {
+			rpcReply(w, resp)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+		rpcReply(w, rpcResponse{JSONRPC: "2.0", Error: &RPCError{rpcInvalidRequest, "invalid request"}, ID: json.RawMessage("null")})
+		return
+	}
+	var resps []rpcResponse
+	for _, msg := range batch {
+		if resp, ok := s.call(r.Context(), msg); ok {
+			resps = append(resps, resp)
+		}
+	}
+	if len(resps) == 0 {
+		w.WriteHeader(http.StatusNoContent) // Only notifications.
+		return
+	}
+	rpcReply(w, resps)
+}
+
+// `call` executes one request, and returns its response unless it is a
+// notification.
+func (s *RPCServer) call(ctx context.Context, msg json.RawMessage) (rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcResponse{JSONRPC: "2.0", Error: &RPCError{rpcInvalidRequest, "invalid request"}, ID: json.RawMessage("null")}, true
+	}
+	resp := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	m, ok := s.methods[req.Method]
+	if !ok {
+		resp.Error = &RPCError{rpcNoMethod, fmt.Sprintf("method %q not found", req.Method)}
+		return resp, req.ID != nil
+	}
+	result, err := m(ctx, req.Params)
+	if err != nil {
+		resp.Error = rpcError(err)
+		return resp, req.ID != nil
+	}
+	if result == nil {
+		result = json.RawMessage("null") // `result` is required on success.
+	}
+	resp.Result = result
+	return resp, req.ID != nil
+}
+
+// `rpcError` turns an error of a method into the error of its response.
+func rpcError(err error) *RPCError {
+	if errors.Is(err, errInvalidParams) {
+		return &RPCError{rpcInvalidParams, err.Error()}
+	}
+	for code, sentinel := range rpcErrors {
+		if errors.Is(err, sentinel) {
+			return &RPCError{code, err.Error()}
+		}
+	}
+	return &RPCError{rpcInternalError, err.Error()}
+}
+
+func rpcReply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// #### The client
+
+// An `RPCClient` calls the methods of a JSON-RPC endpoint.
+type RPCClient struct {
+	url    string
+	client *http.Client
+	id     uint64 // The ID of the last request, accessed atomically.
+}
+
+// `NewRPCClient` calls the endpoint at `url` through `client`.
+func NewRPCClient(url string, client *http.Client) *RPCClient {
+	return &RPCClient{url: url, client: client}
+}
+
+// `Call` calls `method` with `params` and decodes the result into
+// `result`, unless it is nil. Errors of the method are `*RPCError`s.
+// Cancelling `ctx` abandons the request.
+func (c *RPCClient) Call(ctx context.Context, method string, params, result interface{}) error {
+	var raw json.RawMessage
+	if params != nil {
+		var err error
+		if raw, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+	id, _ := json.Marshal(atomic.AddUint64(&c.id, 1))
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Method: method, Params: raw, ID: id})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("rpc %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc %s: %s", method, resp.Status)
+	}
+	var r struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+		ID     json.RawMessage `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("rpc %s: %w", method, err)
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	if !bytes.Equal(r.ID, id) {
+		return fmt.Errorf("rpc %s: response for request %s, want %s", method, r.ID, id)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Result, result)
+}
+
+// A `RemoteStorage` is a `PoemStorage` on a server. Errors of the server's
+// storage, such as `ErrNoPoem`, come back as `*RPCError`s that match them.
+type RemoteStorage struct {
+	client *RPCClient
+}
+
+// `NewRemoteStorage` stores poems through `client`.
+func NewRemoteStorage(client *RPCClient) *RemoteStorage {
+	return &RemoteStorage{client: client}
+}
+
+func (s *RemoteStorage) Save(ctx context.Context, name string, contents []byte) error {
+	params := struct {
+		Name     string `json:"name"`
+		Contents []byte `json:"contents"`
+	}{name, contents}
+	return s.client.Call(ctx, "storage.save", params, nil)
+}
+
+// `Load` takes a null result for a missing poem, which is what servers
+// answered before storages could fail.
+func (s *RemoteStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	var contents []byte
+	if err := s.client.Call(ctx, "storage.load", map[string]string{"name": name}, &contents); err != nil {
+		return nil, err
+	}
+	if contents == nil {
+		return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+	}
+	return contents, nil
+}
+
+func (s *RemoteStorage) Type() string {
+	var t string
+	if err := s.client.Call(context.Background(), "storage.type", nil, &t); err != nil {
+		panic(err)
+	}
+	return "Remote" + t
+}
+
+// `List` makes the `RemoteStorage` a `Lister`. If the server's storage
+// cannot list, the error matches `ErrNotListable`.
+func (s *RemoteStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	var p rpcPage
+	params := struct {
+		After Cursor `json:"after"`
+		Limit int    `json:"limit"`
+	}{after, limit}
+	if err := s.client.Call(ctx, "storage.list", params, &p); err != nil {
+		return nil, "", err
+	}
+	return p.Names, p.Next, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+// #### Endpoint tests
+//
+// `newRPCServer` returns an endpoint for a fresh notebook, with the use
+// cases wired as `main` wires them.
+func newRPCServer(t *testing.T) (*RPCServer, *Notebook) {
+	t.Helper()
+	nb := NewNotebook()
+	c := di.New()
+	c.Provide(func() PoemStorage { return nb }, di.Named("files"))
+	if err := c.Install(UseCasesModule); err != nil {
+		t.Fatal(err)
+	}
+	return NewRPCServer(nb, NewDispatcher(c)), nb
+}
+
+// `rpcPost` posts `body` to `s` and returns the status and the response.
+func rpcPost(s *RPCServer, body string) (int, string) {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+	return rec.Code, strings.TrimSpace(rec.Body.String())
+}
+
+func TestRPCErrorCodes(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		want       string // The error code, or the result.
+	}{
+		{"parse error", `{"jsonrpc": "2.0",`, `"code":-32700`},
+		{"not an object", `"storage.type"`, `"code":-32600`},
+		{"wrong version", `{"jsonrpc": "1.0", "method": "storage.type", "id": 1}`, `"code":-32600`},
+		{"no method", `{"jsonrpc": "2.0", "id": 1}`, `"code":-32600`},
+		{"empty batch", `[]`, `"code":-32600`},
+		{"unknown method", `{"jsonrpc": "2.0", "method": "storage.burn", "id": 1}`, `"code":-32601`},
+		{"unknown parameter", `{"jsonrpc": "2.0", "method": "storage.load", "params": {"nam": "ode"}, "id": 1}`, `"code":-32602`},
+		{"positional parameters", `{"jsonrpc": "2.0", "method": "storage.load", "params": ["ode"], "id": 1}`, `"code":-32602`},
+		{"missing poem", `{"jsonrpc": "2.0", "method": "storage.load", "params": {"name": "ode"}, "id": 1}`, `"code":-32000`},
+		{"missing poem of a use case", `{"jsonrpc": "2.0", "method": "poems.read", "params": {"name": "ode"}, "id": 1}`, `"code":-32000`},
+		{"bad cursor", `{"jsonrpc": "2.0", "method": "poems.browse", "params": {"after": "!"}, "id": 1}`, `"code":-32002`},
+		{"conflict", `{"jsonrpc": "2.0", "method": "poems.write", "params": {"name": "ode", "text": "Oh", "revision": 7}, "id": 1}`, `"code":-32003`},
+		{"success", `{"jsonrpc": "2.0", "method": "storage.type", "id": "x"}`, `{"jsonrpc":"2.0","result":"Notebook","id":"x"}`},
+		{"null result", `{"jsonrpc": "2.0", "method": "storage.save", "params": {"name": "ode", "contents": "T2g="}, "id": 2}`, `{"jsonrpc":"2.0","result":null,"id":2}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newRPCServer(t)
+			status, body := rpcPost(s, tc.body)
+			if status != http.StatusOK {
+				t.Errorf("status: got %d", status)
+			}
+			if !strings.Contains(body, tc.want) {
+				t.Errorf("got %s, want %s", body, tc.want)
+			}
+			if strings.Contains(tc.want, "code") && strings.Contains(body, `"result"`) {
+				t.Errorf("an error response has a result: %s", body)
+			}
+		})
+	}
+}
+
+func TestRPCNotifications(t *testing.T) {
+	s, nb := newRPCServer(t)
+	status, body := rpcPost(s, `{"jsonrpc": "2.0", "method": "storage.save", "params": {"name": "ode", "contents": "T2g="}}`)
+	if status != http.StatusNoContent || body != "" {
+		t.Errorf("got %d %q, want no content", status, body)
+	}
+	if got, err := nb.Load(context.Background(), "ode"); err != nil || string(got) != "Oh" {
+		t.Errorf("the notification was not executed: %q, %v", got, err)
+	}
+	// Failing notifications get no response either.
+	if status, _ := rpcPost(s, `{"jsonrpc": "2.0", "method": "storage.burn"}`); status != http.StatusNoContent {
+		t.Errorf("failing notification: got %d", status)
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	s, _ := newRPCServer(t)
+	status, body := rpcPost(s, `[
+		{"jsonrpc": "2.0", "method": "storage.save", "params": {"name": "ode", "contents": "T2g="}},
+		{"jsonrpc": "2.0", "method": "storage.load", "params": {"name": "ode"}, "id": 1},
+		{"jsonrpc": "2.0", "method": "storage.load", "params": {"name": "elegy"}, "id": 2},
+		42,
+		{"jsonrpc": "2.0", "method": "storage.type", "id": 3}
+	]`)
+	if status != http.StatusOK {
+		t.Fatalf("status: got %d", status)
+	}
+	var resps []struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+		ID     json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(body), &resps); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+	if len(resps) != 4 {
+		t.Fatalf("got %d responses, want one per request that is not a notification: %s", len(resps), body)
+	}
+	for i, want := range []struct {
+		id     string
+		result string
+		code   int
+	}{
+		{id: "1", result: `"T2g="`},
+		{id: "2", code: -32000},
+		{id: "null", code: rpcInvalidRequest},
+		{id: "3", result: `"Notebook"`},
+	} {
+		r := resps[i]
+		if string(r.ID) != want.id {
+			t.Errorf("response %d: id %s, want %s", i, r.ID, want.id)
+		}
+		if want.code != 0 && (r.Error == nil || r.Error.Code != want.code) {
+			t.Errorf("response %d: error %v, want code %d", i, r.Error, want.code)
+		}
+		if want.result != "" && string(r.Result) != want.result {
+			t.Errorf("response %d: result %s, want %s", i, r.Result, want.result)
+		}
+	}
+
+	// A batch of notifications gets no response.
+	status, body = rpcPost(s, `[{"jsonrpc": "2.0", "method": "storage.type"}, {"jsonrpc": "2.0", "method": "storage.type"}]`)
+	if status != http.StatusNoContent || body != "" {
+		t.Errorf("notifications: got %d %q", status, body)
+	}
+}
+
+func TestRPCOnlyPost(t *testing.T) {
+	s, _ := newRPCServer(t)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST" {
+		t.Errorf("got %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+// The client turns error codes back into the errors of the use cases.
+func TestRPCClientErrors(t *testing.T) {
+	s, _ := newRPCServer(t)
+	client := NewRPCClient("http://poems/rpc", &http.Client{Transport: handlerTransport{s}})
+	ctx := context.Background()
+	for _, tc := range []struct {
+		method string
+		params interface{}
+		want   error
+	}{
+		{"poems.read", map[string]string{"name": "ode"}, ErrNoPoem},
+		{"poems.browse", map[string]string{"after": "!"}, ErrBadCursor},
+		{"poems.write", map[string]interface{}{"name": "ode", "text": "Oh", "revision": 7}, ErrConflict},
+	} {
+		err := client.Call(ctx, tc.method, tc.params, nil)
+		var re *RPCError
+		if !errors.As(err, &re) || !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want an *RPCError matching %v", tc.method, err, tc.want)
+		}
+	}
+	var re *RPCError
+	if err := client.Call(ctx, "storage.burn", nil, nil); !errors.As(err, &re) || re.Code != rpcNoMethod || errors.Unwrap(err) != nil {
+		t.Errorf("unknown method: got %v", err)
+	}
+}
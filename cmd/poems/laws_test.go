@@ -0,0 +1,847 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di"
+	"github.com/appliedgo/di/fsys"
+	"github.com/appliedgo/di/lifecycle"
+)
+
+// ### Decorator laws
+//
+// Every decorator in this directory promises to be invisible: a stack of
+// decorators on top of a backend must load exactly what the bare backend would
+// load after the same sequence of calls. `TestLaws` puts that promise to the
+// test with random data. Each trial picks a backend, stacks a random selection of
+// decorators in random order on top of it, and runs random saves and loads
+// against the stack and against an undecorated twin of the backend.
+
+// A `backend` creates fresh storages of one kind.
+type backend struct {
+	name string
+	new  func() PoemStorage
+
+	// `keyed` backends keep poems apart by name. `BlueGreen` only preserves
+	// the semantics of keyed backends: on top of a `Napkin`, it would split
+	// one napkin into two, and a load could see a poem the other napkin
+	// never received.
+	keyed bool
+}
+
+var backends = []backend{
+	{"Notebook", func() PoemStorage { return NewNotebook() }, true},
+	{"Napkin", func() PoemStorage { return NewNapkin() }, false},
+	{"FileStorage", func() PoemStorage { return NewFileStorage(fsys.NewMem()) }, true},
+	{"RemoteStorage", func() PoemStorage {
+		nb := NewNotebook()
+		c := di.New()
+		c.Provide(func() PoemStorage { return nb }, di.Named("files"))
+		if err := c.Install(UseCasesModule); err != nil {
+			panic(err)
+		}
+		server := NewRPCServer(nb, NewDispatcher(c))
+		return NewRemoteStorage(NewRPCClient("http://poems/rpc", &http.Client{Transport: handlerTransport{server}}))
+	}, true},
+	{"SQLiteStorage", func() PoemStorage {
+		s := NewSQLiteStorage(sql.OpenDB(&memSQL{}), NewLocalLocker())
+		if err := s.Init(context.Background()); err != nil {
+			panic(err)
+		}
+		return s
+	}, true},
+	{"RedisStorage", func() PoemStorage { return NewRedisStorage(newMemRedis(), 0) }, true},
+	{"ObjectStorage", func() PoemStorage {
+		client := &http.Client{Transport: handlerTransport{&memS3{bucket: "poems", objects: map[string][]byte{}}}}
+		s := NewObjectStorage(S3Config{Endpoint: "http://s3", Bucket: "poems", Prefix: "laws/"}, client)
+		if err := s.Init(context.Background()); err != nil {
+			panic(err)
+		}
+		return s
+	}, true},
+	{"CopyingNotebook", func() PoemStorage {
+		nb := NewNotebook()
+		nb.CopyOnRead = true
+		return nb
+	}, true},
+}
+
+// `backendOfType` returns the first backend whose storages have the type
+// `t`, so that checks for one kind of storage do not depend on the order of
+// `backends`.
+func backendOfType(t string) backend {
+	for _, b := range backends {
+		if b.new().Type() == t {
+			return b
+		}
+	}
+	panic(fmt.Sprintf("no backend of type %q", t))
+}
+
+// A `handlerTransport` sends requests straight to a handler, so that the
+// `RemoteStorage` can be checked without a network. Like a real transport,
+// it does not send requests whose context is done.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := r.Context().Err(); err != nil {
+		return nil, err
+	}
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, r)
+	return rec.Result(), nil
+}
+
+// `memRedis` is a Redis for the laws. It implements the commands that the
+// `RedisStorage`, the `RedisCache`, the `RedisIdempotency`, and the Redis
+// locks and leases send, and SCANs two keys per call, so that `List` must
+// follow the cursor. Of the scripts, it runs only the two that release and
+// renew a lock. Like a `RedisConn`, it sends no command once the context
+// is done.
+type memRedis struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newMemRedis() *memRedis {
+	return &memRedis{values: map[string]string{}, expires: map[string]time.Time{}}
+}
+
+func (m *memRedis) Do(ctx context.Context, args ...string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, t := range m.expires {
+		if time.Now().After(t) {
+			delete(m.values, key)
+			delete(m.expires, key)
+		}
+	}
+	switch {
+	case args[0] == "SET" && (len(args) == 3 || len(args) == 5 && args[3] == "PX"):
+		m.values[args[1]] = args[2]
+		delete(m.expires, args[1])
+		if len(args) == 5 {
+			ms, err := strconv.ParseInt(args[4], 10, 64)
+			if err != nil || ms <= 0 {
+				return nil, RedisError("ERR invalid expire time in 'set' command")
+			}
+			m.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "OK", nil
+	case args[0] == "SET" && len(args) == 6 && args[3] == "NX" && args[4] == "PX":
+		if _, ok := m.values[args[1]]; ok {
+			return nil, nil
+		}
+		ms, err := strconv.ParseInt(args[5], 10, 64)
+		if err != nil || ms <= 0 {
+			return nil, RedisError("ERR invalid expire time in 'set' command")
+		}
+		m.values[args[1]] = args[2]
+		m.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return "OK", nil
+	case args[0] == "DEL" && len(args) >= 2:
+		n := int64(0)
+		for _, key := range args[1:] {
+			if _, ok := m.values[key]; ok {
+				n++
+			}
+			delete(m.values, key)
+			delete(m.expires, key)
+		}
+		return n, nil
+	case args[0] == "GET" && len(args) == 2:
+		if v, ok := m.values[args[1]]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case args[0] == "STRLEN" && len(args) == 2:
+		return int64(len(m.values[args[1]])), nil
+	case args[0] == "EXISTS" && len(args) == 2:
+		if _, ok := m.values[args[1]]; ok {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case args[0] == "PEXPIRE" && len(args) == 3:
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return nil, RedisError("ERR value is not an integer or out of range")
+		}
+		if _, ok := m.values[args[1]]; !ok {
+			return int64(0), nil
+		}
+		m.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return int64(1), nil
+	case args[0] == "PERSIST" && len(args) == 2:
+		if _, ok := m.expires[args[1]]; !ok {
+			return int64(0), nil
+		}
+		delete(m.expires, args[1])
+		return int64(1), nil
+	case args[0] == "PTTL" && len(args) == 2:
+		if _, ok := m.values[args[1]]; !ok {
+			return int64(-2), nil
+		}
+		if t, ok := m.expires[args[1]]; ok {
+			return time.Until(t).Milliseconds(), nil
+		}
+		return int64(-1), nil
+	case args[0] == "GETRANGE" && len(args) == 4:
+		v := m.values[args[1]]
+		start, err1 := strconv.Atoi(args[2])
+		end, err2 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil || start < 0 || end < 0 {
+			return nil, RedisError("ERR value is not an integer or out of range")
+		}
+		if end >= len(v) {
+			end = len(v) - 1
+		}
+		if start > end {
+			return "", nil
+		}
+		return v[start : end+1], nil
+	case args[0] == "EVAL" && len(args) >= 5 && args[2] == "1" && (args[1] == redisUnlock || args[1] == redisRenew):
+		if v, ok := m.values[args[3]]; !ok || v != args[4] {
+			return int64(0), nil
+		}
+		if args[1] == redisUnlock {
+			delete(m.values, args[3])
+			delete(m.expires, args[3])
+			return int64(1), nil
+		}
+		ms, err := strconv.ParseInt(args[5], 10, 64)
+		if err != nil {
+			return nil, RedisError("ERR value is not an integer or out of range")
+		}
+		m.expires[args[3]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return int64(1), nil
+	case args[0] == "SCAN" && len(args) == 6 && args[2] == "MATCH" && strings.HasSuffix(args[3], "*"):
+		from, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, RedisError("ERR invalid cursor")
+		}
+		var keys []string
+		for key := range m.values {
+			if strings.HasPrefix(key, strings.TrimSuffix(args[3], "*")) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		var page []interface{}
+		for i := from; i < len(keys) && i < from+2; i++ {
+			page = append(page, keys[i])
+		}
+		next := "0"
+		if from+2 < len(keys) {
+			next = strconv.Itoa(from + 2)
+		}
+		return []interface{}{next, page}, nil
+	}
+	return nil, RedisError(fmt.Sprintf("ERR memRedis cannot %q", args))
+}
+
+// `memS3` is an object store for the laws, with one bucket. It lists two
+// keys per page, so that `ObjectStorage` must follow continuation tokens.
+// It checks that requests are signed, but not the signatures.
+type memS3 struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *memS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+	case key == "" && r.Method == http.MethodGet:
+		var keys []string
+		for k := range s.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) && k > r.URL.Query().Get("continuation-token") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var page listResult
+		if len(keys) > 2 {
+			keys = keys[:2]
+			page.IsTruncated, page.NextContinuationToken = true, keys[1]
+		}
+		for _, k := range keys {
+			page.Contents = append(page.Contents, struct {
+				Key string `xml:"Key"`
+			}{k})
+		}
+		xml.NewEncoder(w).Encode(page)
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[key] = body
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(obj))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// #### A database for the laws
+//
+// The example has no SQLite driver, so the laws check the `SQLiteStorage`
+// against `memSQL`: a `database/sql` driver that keeps one table in memory
+// and understands exactly the statements that `SQLiteStorage` sends. It
+// checks the Go side, the scanning, paging, and migrating, but not the
+// SQL itself; with the build tag "sqlite", the laws check that, too. See
+// `sqlite_test.go`. Transactions are not isolated.
+type memSQL struct {
+	mu        sync.Mutex
+	version   int
+	created   bool
+	revisions bool
+	metadata  bool
+	history   bool
+	poems     map[string][]byte
+	revs      map[string]int64
+	metas     map[string]string
+	hist      map[string][]memRevision
+}
+
+// A `memRevision` is a row of the table "revisions" of a `memSQL`.
+type memRevision struct {
+	revision int64
+	contents []byte
+	saved    int64
+}
+
+// `memSQL` is its own connector and driver, so that each storage of the
+// laws gets a database of its own.
+func (db *memSQL) Connect(context.Context) (driver.Conn, error) { return memConn{db}, nil }
+func (db *memSQL) Driver() driver.Driver                        { return db }
+func (db *memSQL) Open(string) (driver.Conn, error)             { return memConn{db}, nil }
+
+type memConn struct{ db *memSQL }
+
+func (c memConn) Prepare(query string) (driver.Stmt, error) { return memStmt{c.db, query}, nil }
+func (c memConn) Close() error                              { return nil }
+func (c memConn) Begin() (driver.Tx, error)                 { return memTx{}, nil }
+
+type memTx struct{}
+
+func (memTx) Commit() error   { return nil }
+func (memTx) Rollback() error { return nil }
+
+type memStmt struct {
+	db    *memSQL
+	query string
+}
+
+func (s memStmt) Close() error  { return nil }
+func (s memStmt) NumInput() int { return -1 }
+
+func (s memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	switch {
+	case s.query == sqliteMigrations[0]:
+		if db.created {
+			return nil, errors.New("table poems already exists")
+		}
+		db.created, db.poems, db.revs, db.metas = true, map[string][]byte{}, map[string]int64{}, map[string]string{}
+		db.hist = map[string][]memRevision{}
+	case s.query == sqliteMigrations[1] && db.created:
+		if db.revisions {
+			return nil, errors.New("duplicate column name: revision")
+		}
+		db.revisions = true
+	case s.query == sqliteMigrations[2] && db.created:
+		if db.metadata {
+			return nil, errors.New("duplicate column name: meta")
+		}
+		db.metadata = true
+	case s.query == sqliteMigrations[3] && db.created:
+		if db.history {
+			return nil, errors.New("table revisions already exists")
+		}
+		db.history = true
+	case s.query == sqliteMigrations[4] && db.history:
+		for name, contents := range db.poems {
+			db.hist[name] = append(db.hist[name], memRevision{db.revs[name], contents, 0})
+		}
+	case s.query == sqlRecord && db.history:
+		name := args[1].(string)
+		if _, ok := db.poems[name]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		db.hist[name] = append(db.hist[name], memRevision{db.revs[name], db.poems[name], args[0].(int64)})
+	case s.query == sqlSave && db.created:
+		db.poems[args[0].(string)] = append([]byte{}, args[1].([]byte)...)
+		db.revs[args[0].(string)]++
+	case s.query == sqlCreate && db.revisions:
+		name := args[0].(string)
+		if _, ok := db.poems[name]; ok {
+			return driver.RowsAffected(0), nil
+		}
+		db.poems[name], db.revs[name] = append([]byte{}, args[1].([]byte)...), 1
+	case s.query == sqlUpdate && db.revisions:
+		name := args[1].(string)
+		if _, ok := db.poems[name]; !ok || db.revs[name] != args[2].(int64) {
+			return driver.RowsAffected(0), nil
+		}
+		db.poems[name] = append([]byte{}, args[0].([]byte)...)
+		db.revs[name]++
+	case s.query == sqlSaveMeta && db.metadata:
+		name := args[1].(string)
+		if _, ok := db.poems[name]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		db.metas[name] = args[0].(string)
+	case strings.HasPrefix(s.query, "PRAGMA user_version = "):
+		version, err := strconv.Atoi(strings.TrimPrefix(s.query, "PRAGMA user_version = "))
+		if err != nil {
+			return nil, err
+		}
+		db.version = version
+	default:
+		return nil, fmt.Errorf("memSQL: cannot execute %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	rows := &memRows{}
+	switch {
+	case s.query == "PRAGMA user_version":
+		rows.values = append(rows.values, int64(db.version))
+	case s.query == sqlLoad && db.created:
+		if contents, ok := db.poems[args[0].(string)]; ok {
+			rows.values = append(rows.values, append([]byte{}, contents...))
+		}
+	case s.query == sqlHistory && db.history:
+		rows.width = 3
+		for _, rev := range db.hist[args[0].(string)] {
+			rows.values = append(rows.values, rev.revision, int64(len(rev.contents)), rev.saved)
+		}
+	case s.query == sqlLoadRevision && db.history:
+		for _, rev := range db.hist[args[0].(string)] {
+			if rev.revision == args[1].(int64) {
+				rows.values = append(rows.values, append([]byte{}, rev.contents...))
+			}
+		}
+	case s.query == sqlLoadMeta && db.metadata:
+		if _, ok := db.poems[args[0].(string)]; ok {
+			rows.values = append(rows.values, db.metas[args[0].(string)])
+		}
+	case s.query == sqlRevision && db.revisions:
+		if _, ok := db.poems[args[0].(string)]; ok {
+			rows.values = append(rows.values, db.revs[args[0].(string)])
+		}
+	case (s.query == sqlList || s.query == sqlHead) && db.created:
+		after, limit := "", args[len(args)-1].(int64)
+		if s.query == sqlList {
+			after = args[0].(string)
+		}
+		var names []string
+		for name := range db.poems {
+			if s.query == sqlHead || name > after {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for i := 0; i < len(names) && int64(i) < limit; i++ {
+			rows.values = append(rows.values, names[i])
+		}
+	default:
+		return nil, fmt.Errorf("memSQL: cannot query %q", s.query)
+	}
+	return rows, nil
+}
+
+// `memRows` are rows of `width` columns, or of one if it is 0, whose
+// values follow each other in `values`.
+type memRows struct {
+	values []driver.Value
+	width  int
+}
+
+func (r *memRows) Columns() []string {
+	if r.width == 0 {
+		return []string{"value"}
+	}
+	return make([]string, r.width)
+}
+
+func (r *memRows) Close() error { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	n := copy(dest, r.values[:len(dest)])
+	r.values = r.values[n:]
+	return nil
+}
+
+// A `layer` wraps a storage in one decorator. `close` flushes the decorator
+// and reports violations of laws that are specific to it.
+type layer struct {
+	name  string
+	wrap  func(ps PoemStorage, b backend) PoemStorage
+	close func() error
+}
+
+// `lawKeys` are the keys of the `EncryptedStorage` in the laws.
+var lawKeys = func() KeyProvider {
+	key := make([]byte, 32)
+	rand.Read(key)
+	keys, err := NewStaticKeys(EncryptionConfig{Keys: []string{"laws:" + base64.StdEncoding.EncodeToString(key)}})
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}()
+
+// `lawCheckOps` bounds the operations of the checks after the random
+// operations of a trial, such as `checkRevisions`.
+const lawCheckOps = 1000
+
+// `lawCompressions` are the algorithms of the `CompressedStorage` in the
+// laws.
+var lawCompressions = func() *Compressions {
+	cs, err := NewCompressions(CompressionConfig{}, GzipCompression{Level: gzip.BestSpeed})
+	if err != nil {
+		panic(err)
+	}
+	return cs
+}()
+
+// `layers` returns one fresh instance of every decorator for a trial of `ops`
+// operations. Shadows run in `component`.
+func layers(r *rand.Rand, ops int, component *lifecycle.Component) []*layer {
+	var shadow *Shadow
+	migrator, err := NewMigrator([]Migration{crlfMigration})
+	if err != nil {
+		panic(err)
+	}
+	return []*layer{
+		{name: "ReadOnly", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			return NewReadOnly(ps)
+		}},
+		{name: "BlueGreen", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			if !b.keyed {
+				return ps
+			}
+			return NewBlueGreen(ps, b.new(), r.Intn(101))
+		}},
+		{name: "FanOut", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			return NewFanOut(ps, b.new())
+		}},
+		{name: "Replicated", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			// Fresh replicas of the same kind, which agree with `ps` as they
+			// get the same saves.
+			cs := []Consistency{ConsistencyOne{}, ConsistencyQuorum{}, ConsistencyAll{}}[r.Intn(3)]
+			return NewReplicatedStorage(cs, ps, b.new(), b.new())
+		}},
+		{name: "Fallback", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			// Nothing fails, so every poem goes to `ps`.
+			return NewFallbackStorage(ps, b.new())
+		}},
+		{name: "Metered", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			m, err := NewMeter(QuotaConfig{Bytes: int64(r.Intn(200)), Thresholds: []int{50, 100}}, LogAlerts{Log: log.New(io.Discard, "", 0)})
+			if err != nil {
+				panic(err)
+			}
+			return NewMeteredStorage(ps, m)
+		}},
+		{name: "Logging", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			return NewLoggingStorage(ps, log.New(io.Discard, "", 0))
+		}},
+		{name: "V1", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			return FromV1(ToV1(ps))
+		}},
+		{name: "Catalog", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			return NewCatalogStorage(ps, fsys.NewMem(), []Codec{JSONCodec{}, ProtobufCodec{}, MsgpackCodec{}}[r.Intn(3)], migrator)
+		}},
+		{name: "Encrypted", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			// The name is part of what is authenticated, so on a storage
+			// that loads one poem under every name, loads of other names
+			// fail.
+			if !b.keyed {
+				return ps
+			}
+			return NewEncryptedStorage(ps, lawKeys)
+		}},
+		{name: "Compressed", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			return NewCompressedStorage(ps, "gzip", lawCompressions)
+		}},
+		{name: "Cached", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			// A small cache, so that poems get evicted, or one in Redis. A
+			// napkin has one poem under every name, which a save under one
+			// name changes for all.
+			if !b.keyed {
+				return ps
+			}
+			ttl := time.Duration(r.Intn(2)) * time.Hour
+			if r.Intn(2) == 0 {
+				return NewCachedStorage(ps, NewRedisCache[string, []byte](newMemRedis(), "laws", ttl))
+			}
+			return NewCachedStorage(ps, NewMemoryCache[string, []byte](1+r.Intn(3), ttl))
+		}},
+		{name: "Sharded", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			// The other shards are fresh backends of the same kind. On a
+			// napkin, every shard would have every poem.
+			if !b.keyed {
+				return ps
+			}
+			shards := []PoemStorage{ps}
+			for i := r.Intn(3); i > 0; i-- {
+				shards = append(shards, b.new())
+			}
+			s, err := NewShardedStorage(shards...)
+			if err != nil {
+				panic(err)
+			}
+			return s
+		}},
+		{name: "Indexed", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			// On a napkin, a save under one name changes the poem of all,
+			// which the index does not know.
+			if !b.keyed {
+				return ps
+			}
+			return NewIndexedStorage(ps, NewIndex(ps))
+		}},
+		{name: "Pipeline", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			// The calls of the trials have no principal, so no "auth".
+			p, err := NewStoragePipeline(StorageConfig{Middleware: []string{"trace", "validate"}},
+				NewTracing(log.New(io.Discard, "", 0)), Validation{})
+			if err != nil {
+				panic(err)
+			}
+			return p.Storage(ps)
+		}},
+		{name: "Versioned", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			return NewVersionedStorage(ps, migrator)
+		}},
+		{name: "Shadow", wrap: func(ps PoemStorage, b backend) PoemStorage {
+			// The candidate is a fresh backend of the same kind, which must
+			// never disagree with the primary. The queue is large enough that
+			// nothing is dropped: it holds the operations of the trial, and
+			// those of the checks that follow.
+			shadow = NewShadow(ps, b.new(), ops+lawCheckOps, component)
+			return shadow
+		}, close: func() error {
+			if shadow == nil {
+				return nil
+			}
+			shadow.Close()
+			if st := shadow.Stats(); st.Divergences > 0 || st.Failed > 0 {
+				return fmt.Errorf("shadow reported %d divergences and %d failures", st.Divergences, st.Failed)
+			}
+			return nil
+		}},
+	}
+}
+
+var (
+	lawTrials = flag.Int("laws", 200, "number of random `trials` of TestLaws per seed")
+	lawSeed   = flag.Int64("seed", 0, "random `seed` of TestLaws, instead of a few fixed ones")
+)
+
+// `TestLaws` runs random trials for each seed, and the checks that run once.
+// The seed makes a failing run reproducible:
+//
+//	go test ./cmd/poems -run TestLaws -seed 42 -laws 1000
+func TestLaws(t *testing.T) {
+	seeds := []int64{1, 2, 3}
+	if *lawSeed != 0 {
+		seeds = []int64{*lawSeed}
+	}
+	for _, seed := range seeds {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			checkLaws(t, *lawTrials, seed)
+		})
+	}
+}
+
+// `checkLaws` runs the checks that run once, and `trials` random trials
+// from `seed`, each in a subtest.
+func checkLaws(t *testing.T, trials int, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	lc := lifecycle.New()
+	defer lc.Shutdown(time.Second)
+	component := lc.Component("laws")
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name  string
+		check func() error
+	}{
+		{"in flight", func() error { return checkInFlight(ctx) }},
+		{"memory cache", func() error { return checkCache(ctx, NewMemoryCache[string, []byte](10, time.Hour)) }},
+		{"redis cache", func() error {
+			return checkCache(ctx, NewRedisCache[string, []byte](newMemRedis(), "laws", time.Hour))
+		}},
+		{"saga", func() error { return checkSaga(ctx, r) }},
+		{"standby", func() error { return checkStandby(ctx, r) }},
+		{"shadow", func() error { return checkShadow(ctx, component) }},
+		{"shadow order", func() error { return checkShadowOrder(ctx, component) }},
+		{"bluegreen", func() error { return checkBlueGreen(ctx, r) }},
+		{"rebalance", func() error { return checkRebalance(ctx, r) }},
+		{"index", func() error { return checkIndex(ctx, r) }},
+		{"export", func() error { return checkExport(ctx, r) }},
+		{"format registry", checkFormatRegistry},
+		{"storage middleware", func() error { return checkStorageMiddleware(ctx, r) }},
+		{"policy", func() error { return checkPolicy(ctx, r) }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.check(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	for trial := 0; trial < trials; trial++ {
+		t.Run(fmt.Sprintf("trial=%d", trial), func(t *testing.T) {
+			b := backends[r.Intn(len(backends))]
+			ops := 1 + r.Intn(20)
+
+			// A random subset of the decorators, in random order.
+			all := layers(r, ops, component)
+			r.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+			stack := all[:r.Intn(len(all)+1)]
+
+			want := b.new()
+			var got PoemStorage = b.new()
+			names := []string{b.name}
+			for _, l := range stack {
+				got = l.wrap(got, b)
+				names = append([]string{l.name}, names...)
+			}
+			desc := "stack " + strings.Join(names, "∘")
+
+			var log []string
+			saved := map[string][][]byte{}
+			for i := 0; i < ops; i++ {
+				// Few names, so that poems get overwritten.
+				name := fmt.Sprintf("poem %d", r.Intn(4))
+				if r.Intn(2) == 0 {
+					contents := make([]byte, r.Intn(64))
+					r.Read(contents)
+					log = append(log, fmt.Sprintf("Save(%q, %d bytes)", name, len(contents)))
+					if err := want.Save(ctx, name, contents); err != nil {
+						t.Fatalf("%s: %v", desc, err)
+					}
+					saved[name] = append(saved[name], contents)
+					if err := got.Save(ctx, name, append([]byte{}, contents...)); err != nil {
+						t.Fatalf("%s: after %s: %v", desc, strings.Join(log, ", "), err)
+					}
+					continue
+				}
+				log = append(log, fmt.Sprintf("Load(%q)", name))
+				w, werr := want.Load(ctx, name)
+				g, gerr := got.Load(ctx, name)
+				if werr != nil && !errors.Is(werr, ErrNoPoem) {
+					t.Fatalf("%s: %v", desc, werr)
+				}
+				if errors.Is(werr, ErrNoPoem) != errors.Is(gerr, ErrNoPoem) || (werr == nil) != (gerr == nil) || !bytes.Equal(w, g) {
+					t.Fatalf("%s: after %s: loaded %q, %v, want %q, %v", desc, strings.Join(log, ", "), g, gerr, w, werr)
+				}
+			}
+			poems := []string{"poem 0", "poem 1", "poem 2", "poem 3"}
+			if err := checkHistory(ctx, want, poems, saved); err != nil {
+				t.Fatalf("%s: history of %s: %v", desc, b.name, err)
+			}
+			if err := checkRanges(ctx, r, got, poems); err != nil {
+				t.Fatalf("%s: %v", desc, err)
+			}
+			if err := checkStreams(ctx, r, got, poems); err != nil {
+				t.Fatalf("%s: %v", desc, err)
+			}
+			if err := checkChecksums(ctx, got, poems); err != nil {
+				t.Fatalf("%s: %v", desc, err)
+			}
+			if l, ok := want.(Lister); ok {
+				if err := checkLister(ctx, r, l, want); err != nil {
+					t.Fatalf("%s: List: %v", desc, err)
+				}
+			}
+			if err := checkRevisions(ctx, got, poems); err != nil {
+				t.Fatalf("%s: %v", desc, err)
+			}
+			if ex, ok := want.(Expirer); ok {
+				if err := checkExpiry(ctx, ex, want); err != nil {
+					t.Fatalf("%s: expiry: %v", desc, err)
+				}
+			}
+			if err := checkCancellation(ctx, got, poems); err != nil {
+				t.Fatalf("%s: %v", desc, err)
+			}
+			if err := checkMeta(ctx, got, poems); err != nil {
+				t.Fatalf("%s: metadata: %v", desc, err)
+			}
+			if err := checkMeta(ctx, want, poems); err != nil {
+				t.Fatalf("%s: metadata of %s: %v", desc, b.name, err)
+			}
+			if err := checkHistory(ctx, got, poems, nil); err != nil {
+				t.Fatalf("%s: history: %v", desc, err)
+			}
+			if err := checkSearch(ctx, r, got, poems); err != nil {
+				t.Fatalf("%s: %v", desc, err)
+			}
+			if d, ok := want.(Deleter); ok {
+				if err := checkDeleter(ctx, d, want, poems); err != nil {
+					t.Fatalf("%s: delete: %v", desc, err)
+				}
+			}
+			for _, l := range stack {
+				if l.close == nil {
+					continue
+				}
+				if err := l.close(); err != nil {
+					t.Fatalf("%s: %s: %v", desc, l.name, err)
+				}
+			}
+		})
+	}
+}
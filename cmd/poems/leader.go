@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Leader election
+//
+// Some work must happen on exactly one of the instances that share
+// storage, and it must keep happening when that instance goes away: a
+// nightly backup that runs on every instance makes as many backups, and
+// one that runs on a fixed instance makes none once it is gone. The
+// instances elect a leader, which does the work until it stops or loses
+// touch with the others, and then another instance takes over.
+//
+// A `LeaderElector` runs the campaigns. Unlike a `Locker`, whose locks are
+// held for a short piece of work, leadership is held for as long as the
+// instance runs. The electors hold it as a lease: the leader renews the
+// lease every third of "jobs.ttl", and an instance that does not renew it
+// in time is no longer the leader. The setting "jobs.leader" selects where
+// the lease lives:
+//
+//   - "local" elects within the process, which is enough for one instance.
+//   - "file" keeps the lease in a file in the directory "jobs.dir".
+//   - "redis" keeps the lease in a key in Redis.
+//   - "etcd" keeps the lease in etcd, at the endpoint "jobs.etcd".
+//
+// A leader that stalls for longer than the TTL, such as in a long garbage
+// collection or on a suspended machine, may briefly overlap with the next
+// one. Jobs that must never overlap check their work against the storage,
+// for example with a `SaveIf`.
+
+// A `LeaderElector` elects one leader among the instances that campaign
+// under the same name.
+type LeaderElector interface {
+	// `Campaign` waits until this instance is the leader of `name`, or
+	// `ctx` is done. It returns a context that is canceled when the
+	// leadership ends, because it was lost or `ctx` is done, and the
+	// function that resigns from it.
+	Campaign(ctx context.Context, name string) (leading context.Context, resign func() error, err error)
+}
+
+// A `Lease` is what a `LeaseElector` holds while it leads. Every campaign
+// has a random token, and the methods only change a lease that holds the
+// token of the caller.
+type Lease interface {
+	// `Acquire` takes the lease `name` for `ttl` if no one holds it.
+	Acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	// `Renew` extends the lease `name` by `ttl` if the caller still holds
+	// it.
+	Renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	// `Release` gives up the lease `name` if the caller still holds it.
+	Release(ctx context.Context, name, token string) error
+}
+
+// `NewLeaderElector` returns the elector that `cfg` selects. Only the Redis
+// elector resolves `redis`.
+func NewLeaderElector(cfg JobsConfig, redis di.Lazy[Redis]) (LeaderElector, error) {
+	if cfg.TTL <= 0 {
+		return nil, errors.New("leader election needs the setting jobs.ttl")
+	}
+	switch cfg.Leader {
+	case "local":
+		return NewLeaseElector(NewLocalLease(), cfg.TTL), nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, errors.New("file leases need the setting jobs.dir")
+		}
+		return NewLeaseElector(NewFileLease(cfg.Dir), cfg.TTL), nil
+	case "redis":
+		r, err := redis.Get()
+		if err != nil {
+			return nil, err
+		}
+		return NewLeaseElector(NewRedisLease(r), cfg.TTL), nil
+	case "etcd":
+		if cfg.Etcd == "" {
+			return nil, errors.New("etcd leases need the setting jobs.etcd")
+		}
+		return NewLeaseElector(NewEtcdLease(cfg.Etcd, http.DefaultClient), cfg.TTL), nil
+	}
+	return nil, fmt.Errorf("unknown leader election %q (want local, file, redis, or etcd)", cfg.Leader)
+}
+
+// `LeaseElector` campaigns for a `Lease`, and renews it while it leads.
+type LeaseElector struct {
+	lease Lease
+	ttl   time.Duration
+}
+
+// `NewLeaseElector` elects with `lease`, which lasts `ttl` unless renewed.
+func NewLeaseElector(lease Lease, ttl time.Duration) *LeaseElector {
+	return &LeaseElector{lease: lease, ttl: ttl}
+}
+
+func (e *LeaseElector) Campaign(ctx context.Context, name string) (context.Context, func() error, error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = waitLock(ctx, name, func() (bool, error) {
+		return e.lease.Acquire(ctx, name, token, e.ttl)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("campaign: %w", err)
+	}
+	leading, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		defer cancel()
+		e.renew(leading, name, token)
+	}()
+	var once sync.Once
+	return leading, func() (err error) {
+		once.Do(func() {
+			cancel()
+			<-renewed
+			err = e.lease.Release(context.Background(), name, token)
+		})
+		return err
+	}, nil
+}
+
+// `renew` renews the lease every third of the TTL until `leading` is done
+// or a renewal fails. Each renewal must finish within a third of the TTL,
+// so that the leader notices a lost lease before another instance can take
+// it.
+func (e *LeaseElector) renew(leading context.Context, name, token string) {
+	every := e.ttl / 3
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-leading.Done():
+			return
+		case <-t.C:
+		}
+		ctx, cancel := context.WithTimeout(leading, every)
+		ok, err := e.lease.Renew(ctx, name, token, e.ttl)
+		cancel()
+		if err != nil || !ok {
+			return
+		}
+	}
+}
+
+// #### Local leases
+
+// `LocalLease` is a lease within the process. It never expires, as the
+// holder cannot go away without the process.
+type LocalLease struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// `NewLocalLease` returns leases for one process.
+func NewLocalLease() *LocalLease {
+	return &LocalLease{tokens: map[string]string{}}
+}
+
+func (l *LocalLease) Acquire(_ context.Context, name, token string, _ time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, held := l.tokens[name]; held {
+		return false, nil
+	}
+	l.tokens[name] = token
+	return true, nil
+}
+
+func (l *LocalLease) Renew(_ context.Context, name, token string, _ time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokens[name] == token, nil
+}
+
+func (l *LocalLease) Release(_ context.Context, name, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens[name] == token {
+		delete(l.tokens, name)
+	}
+	return nil
+}
+
+// #### File leases
+
+// `FileLease` keeps the lease `name` in the file "<name>.leader", like a
+// `FileLocker` keeps its locks. Renewing the lease touches the file, so the
+// lease is abandoned once the file is older than the TTL.
+type FileLease struct {
+	dir string
+}
+
+// `NewFileLease` keeps leases in `dir`.
+func NewFileLease(dir string) *FileLease {
+	return &FileLease{dir: dir}
+}
+
+func (l *FileLease) path(name string) string {
+	return filepath.Join(l.dir, url.PathEscape(name)+".leader")
+}
+
+func (l *FileLease) Acquire(_ context.Context, name, token string, ttl time.Duration) (bool, error) {
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return false, err
+	}
+	path := l.path(name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		breakAbandoned(path, token, ttl)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = f.WriteString(token)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return false, err
+	}
+	return true, nil
+}
+
+// `Renew` checks the token before it touches the file. If the lease is
+// taken over in between, it extends the lease of the new holder, which is
+// harmless, and the next renewal fails.
+func (l *FileLease) Renew(_ context.Context, name, token string, _ time.Duration) (bool, error) {
+	path := l.path(name)
+	held, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && string(held) != token {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *FileLease) Release(_ context.Context, name, token string) error {
+	path := l.path(name)
+	if held, err := os.ReadFile(path); err != nil || string(held) != token {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// #### Redis leases
+
+// `RedisLease` keeps the lease `name` in the key "poems:leader:<name>",
+// which expires after the TTL. Scripts renew and release it only if it
+// holds the token of the caller.
+type RedisLease struct {
+	redis Redis
+}
+
+// `NewRedisLease` keeps leases in `r`.
+func NewRedisLease(r Redis) *RedisLease {
+	return &RedisLease{redis: r}
+}
+
+// `redisRenew` extends a lease if it holds the token.
+const redisRenew = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+
+func (l *RedisLease) Acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	reply, err := l.redis.Do(ctx, "SET", "poems:leader:"+name, token, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return reply != nil, err
+}
+
+func (l *RedisLease) Renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	reply, err := l.redis.Do(ctx, "EVAL", redisRenew, "1", "poems:leader:"+name, token, strconv.FormatInt(ttl.Milliseconds(), 10))
+	n, _ := reply.(int64)
+	return n == 1, err
+}
+
+func (l *RedisLease) Release(ctx context.Context, name, token string) error {
+	_, err := l.redis.Do(ctx, "EVAL", redisUnlock, "1", "poems:leader:"+name, token)
+	return err
+}
+
+// #### etcd leases
+
+// `EtcdLease` keeps the lease `name` in the key "poems/leader/<name>" of
+// etcd, attached to an etcd lease of the TTL. It talks to the JSON gateway
+// of the etcd v3 API, so it needs no client library. A transaction creates
+// the key only if it does not exist, keep-alives renew the etcd lease, and
+// revoking the etcd lease deletes the key. The gateway's authentication is
+// not supported.
+type EtcdLease struct {
+	endpoint string
+	client   *http.Client
+
+	mu  sync.Mutex
+	ids map[string]string // The etcd lease of each token.
+}
+
+// `NewEtcdLease` keeps leases in the etcd at `endpoint`, such as
+// "http://localhost:2379".
+func NewEtcdLease(endpoint string, client *http.Client) *EtcdLease {
+	return &EtcdLease{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   client,
+		ids:      map[string]string{},
+	}
+}
+
+// `EtcdError` is an error response of etcd.
+type EtcdError struct {
+	Status  int
+	Message string
+}
+
+func (e *EtcdError) Error() string {
+	return fmt.Sprintf("etcd: %d %s", e.Status, e.Message)
+}
+
+// `call` posts `req` to the gateway path `path`, and decodes the response
+// into `resp`. The gateway encodes 64-bit integers as strings.
+func (l *EtcdLease) call(ctx context.Context, path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, l.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	res, err := l.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(data))
+		}
+		return &EtcdError{Status: res.StatusCode, Message: e.Message}
+	}
+	return json.Unmarshal(data, resp)
+}
+
+func etcdKey(name string) string {
+	return base64.StdEncoding.EncodeToString([]byte("poems/leader/" + name))
+}
+
+// `etcdTTL` rounds `ttl` up to whole seconds, the unit of etcd leases.
+func etcdTTL(ttl time.Duration) string {
+	return strconv.FormatInt(int64((ttl+time.Second-1)/time.Second), 10)
+}
+
+func (l *EtcdLease) Acquire(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	if err := l.call(ctx, "/v3/lease/grant", map[string]string{"TTL": etcdTTL(ttl)}, &grant); err != nil {
+		return false, err
+	}
+	var txn struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	err := l.call(ctx, "/v3/kv/txn", map[string]interface{}{
+		"compare": []map[string]string{{
+			"key":             etcdKey(name),
+			"target":          "CREATE",
+			"result":          "EQUAL",
+			"create_revision": "0",
+		}},
+		"success": []map[string]interface{}{{
+			"request_put": map[string]string{
+				"key":   etcdKey(name),
+				"value": base64.StdEncoding.EncodeToString([]byte(token)),
+				"lease": grant.ID,
+			},
+		}},
+	}, &txn)
+	if err != nil || !txn.Succeeded {
+		l.revoke(grant.ID)
+		return false, err
+	}
+	l.mu.Lock()
+	l.ids[token] = grant.ID
+	l.mu.Unlock()
+	return true, nil
+}
+
+// `Renew` keeps the etcd lease alive. Once it has expired, etcd has
+// deleted the key, and the keep-alive reports no TTL.
+func (l *EtcdLease) Renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	id, ok := l.ids[token]
+	l.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	var keepAlive struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	if err := l.call(ctx, "/v3/lease/keepalive", map[string]string{"ID": id}, &keepAlive); err != nil {
+		return false, err
+	}
+	left, _ := strconv.ParseInt(keepAlive.Result.TTL, 10, 64)
+	return left > 0, nil
+}
+
+func (l *EtcdLease) Release(ctx context.Context, name, token string) error {
+	l.mu.Lock()
+	id, ok := l.ids[token]
+	delete(l.ids, token)
+	l.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	var revoked struct{}
+	err := l.call(ctx, "/v3/lease/revoke", map[string]string{"ID": id}, &revoked)
+	var e *EtcdError
+	if errors.As(err, &e) && e.Status == http.StatusNotFound {
+		return nil // The lease has expired already.
+	}
+	return err
+}
+
+// `revoke` revokes an etcd lease that holds no key, on a best-effort
+// basis: if it fails, the lease expires anyway.
+func (l *EtcdLease) revoke(id string) {
+	if id == "" {
+		return
+	}
+	var revoked struct{}
+	l.call(context.Background(), "/v3/lease/revoke", map[string]string{"ID": id}, &revoked)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// #### Leader election tests
+
+// `leases` creates a fresh place for leases of each kind, and returns a
+// function that returns the lease of one instance. The instances share
+// the place, as instances share a directory, a Redis, or an etcd.
+var leases = []struct {
+	name    string
+	expires bool // Whether a lease that is not renewed expires.
+	new     func(t *testing.T) func() Lease
+}{
+	{"local", false, func(*testing.T) func() Lease {
+		l := NewLocalLease()
+		return func() Lease { return l }
+	}},
+	{"file", true, func(t *testing.T) func() Lease {
+		dir := t.TempDir()
+		return func() Lease { return NewFileLease(dir) }
+	}},
+	{"redis", true, func(*testing.T) func() Lease {
+		r := newMemRedis()
+		return func() Lease { return NewRedisLease(r) }
+	}},
+	{"etcd", false, func(*testing.T) func() Lease {
+		client := &http.Client{Transport: handlerTransport{newMemEtcd()}}
+		return func() Lease { return NewEtcdLease("http://etcd:2379", client) }
+	}},
+}
+
+// `leads` reports whether `leading` is still going.
+func leads(leading context.Context) bool {
+	return leading.Err() == nil
+}
+
+func TestLeaderHandover(t *testing.T) {
+	for _, ls := range leases {
+		t.Run(ls.name, func(t *testing.T) {
+			lease := ls.new(t)
+			a, b := NewLeaseElector(lease(), 300*time.Millisecond), NewLeaseElector(lease(), 300*time.Millisecond)
+			leadingA, resignA, err := a.Campaign(context.Background(), "jobs")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			type campaign struct {
+				leading context.Context
+				resign  func() error
+				err     error
+			}
+			got := make(chan campaign, 1)
+			go func() {
+				leading, resign, err := b.Campaign(context.Background(), "jobs")
+				got <- campaign{leading, resign, err}
+			}()
+			select {
+			case <-got:
+				t.Fatal("two instances lead at once")
+			case <-time.After(150 * time.Millisecond):
+			}
+
+			if err := resignA(); err != nil {
+				t.Fatal(err)
+			}
+			if leads(leadingA) {
+				t.Error("the leader leads after it resigned")
+			}
+			select {
+			case c := <-got:
+				if c.err != nil {
+					t.Fatal(c.err)
+				}
+				if !leads(c.leading) {
+					t.Error("the new leader does not lead")
+				}
+				if err := c.resign(); err != nil {
+					t.Error(err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no instance took over after the leader resigned")
+			}
+			if err := resignA(); err != nil {
+				t.Errorf("second resign: %v", err)
+			}
+		})
+	}
+}
+
+// `partitionedLease` is a lease whose renewals fail once the instance is
+// cut off from the place of the leases.
+type partitionedLease struct {
+	Lease
+	cut int32
+}
+
+func (l *partitionedLease) Renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	if atomic.LoadInt32(&l.cut) == 1 {
+		return false, context.DeadlineExceeded
+	}
+	return l.Lease.Renew(ctx, name, token, ttl)
+}
+
+func TestLeaderExpires(t *testing.T) {
+	const ttl = 150 * time.Millisecond
+	for _, ls := range leases {
+		if !ls.expires {
+			continue
+		}
+		t.Run(ls.name, func(t *testing.T) {
+			lease := ls.new(t)
+			cutOff := &partitionedLease{Lease: lease()}
+			a, b := NewLeaseElector(cutOff, ttl), NewLeaseElector(lease(), ttl)
+			leadingA, resignA, err := a.Campaign(context.Background(), "jobs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resignA()
+
+			// The leader keeps its lease for longer than the TTL.
+			time.Sleep(2 * ttl)
+			if !leads(leadingA) {
+				t.Fatal("the leader lost a lease that it renewed")
+			}
+
+			atomic.StoreInt32(&cutOff.cut, 1)
+			cut := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			leadingB, resignB, err := b.Campaign(ctx, "jobs")
+			if err != nil {
+				t.Fatalf("no instance took over the expired lease: %v", err)
+			}
+			defer resignB()
+			if waited := time.Since(cut); waited < ttl/2 {
+				t.Errorf("the lease was taken over after %v, before it expired", waited)
+			}
+			// The former leader knew before the lease was taken over.
+			if leads(leadingA) {
+				t.Error("the cut-off leader still leads")
+			}
+			if !leads(leadingB) {
+				t.Error("the new leader does not lead")
+			}
+		})
+	}
+}
+
+func TestLeaderCrashed(t *testing.T) {
+	const ttl = 150 * time.Millisecond
+	for _, ls := range leases {
+		if !ls.expires {
+			continue
+		}
+		t.Run(ls.name, func(t *testing.T) {
+			lease := ls.new(t)
+			// An instance took the lease, and crashed.
+			if ok, err := lease().Acquire(context.Background(), "jobs", "crashed", ttl); !ok || err != nil {
+				t.Fatalf("got %t, %v", ok, err)
+			}
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, resign, err := NewLeaseElector(lease(), ttl).Campaign(ctx, "jobs")
+			if err != nil {
+				t.Fatalf("no instance took over the abandoned lease: %v", err)
+			}
+			defer resign()
+			if waited := time.Since(start); waited < ttl*3/4 {
+				t.Errorf("the lease was taken over after %v, before it expired", waited)
+			}
+		})
+	}
+}
+
+// `jobRuns` records which instances ran a job, and whether two runs
+// overlapped.
+type jobRuns struct {
+	mu       sync.Mutex
+	running  bool
+	overlaps int
+	by       []string
+}
+
+func (r *jobRuns) job(instance string) Job {
+	return Job{Name: "record", Every: 20 * time.Millisecond, Run: func(context.Context) error {
+		r.mu.Lock()
+		if r.running {
+			r.overlaps++
+		}
+		r.running = true
+		r.by = append(r.by, instance)
+		r.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+		return nil
+	}}
+}
+
+// `last` returns the instance that ran the job last, and how often the job
+// ran.
+func (r *jobRuns) last() (string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.by) == 0 {
+		return "", 0
+	}
+	return r.by[len(r.by)-1], len(r.by)
+}
+
+// `waitFor` waits until `instance` has run the job.
+func (r *jobRuns) waitFor(t *testing.T, instance string) {
+	t.Helper()
+	for end := time.Now().Add(2 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if last, _ := r.last(); last == instance {
+			return
+		}
+	}
+	t.Fatalf("%s did not run the job", instance)
+}
+
+func TestSchedulerHandover(t *testing.T) {
+	for _, ls := range leases {
+		t.Run(ls.name, func(t *testing.T) {
+			lease := ls.new(t)
+			runs := &jobRuns{}
+			quiet := log.New(io.Discard, "", 0)
+			instance := func(name string) *di.Container {
+				c := di.New()
+				elector := NewLeaseElector(lease(), 300*time.Millisecond)
+				c.Provide(func(lc di.Lifecycle) *Scheduler {
+					return NewScheduler(elector, lc, quiet, runs.job(name))
+				}, di.WithLifetime(di.Singleton))
+				di.MustResolve[*Scheduler](c)
+				if err := c.Start(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				return c
+			}
+
+			a := instance("a")
+			runs.waitFor(t, "a")
+			b := instance("b")
+			time.Sleep(100 * time.Millisecond)
+			if last, _ := runs.last(); last != "a" {
+				t.Errorf("%s ran the job while a led", last)
+			}
+
+			// Stopping the leader resigns, and the other instance takes
+			// over well before the TTL.
+			if err := a.Stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			stopped := time.Now()
+			runs.waitFor(t, "b")
+			if waited := time.Since(stopped); waited > 250*time.Millisecond {
+				t.Errorf("b took over after %v", waited)
+			}
+			_, before := runs.last()
+			time.Sleep(60 * time.Millisecond)
+			if last, n := runs.last(); last != "b" || n == before {
+				t.Errorf("after the handover: %s ran the job last, %d runs", last, n)
+			}
+			if err := b.Stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if runs.overlaps > 0 {
+				t.Errorf("the job ran on two instances at once %d times", runs.overlaps)
+			}
+		})
+	}
+}
+
+// #### An etcd for the leader election
+
+// `memEtcd` is the JSON gateway of an etcd for the leader election. It
+// implements the requests that an `EtcdLease` sends, and expires its
+// leases by the clock, with their keys.
+type memEtcd struct {
+	mu     sync.Mutex
+	next   int64
+	leases map[string]time.Time     // When each lease expires.
+	ttls   map[string]time.Duration // The TTL of each lease.
+	keys   map[string]string        // The lease that holds each key.
+}
+
+func newMemEtcd() *memEtcd {
+	return &memEtcd{leases: map[string]time.Time{}, ttls: map[string]time.Duration{}, keys: map[string]string{}}
+}
+
+func (e *memEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID      string `json:"ID"`
+		TTL     string `json:"TTL"`
+		Compare []struct {
+			Key string `json:"key"`
+		} `json:"compare"`
+		Success []struct {
+			Put struct {
+				Key   string `json:"key"`
+				Lease string `json:"lease"`
+			} `json:"request_put"`
+		} `json:"success"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"message":"bad request"}`, http.StatusBadRequest)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, t := range e.leases {
+		if time.Now().After(t) {
+			e.revoke(id)
+		}
+	}
+	var resp interface{}
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		secs, _ := strconv.ParseInt(req.TTL, 10, 64)
+		e.next++
+		id := strconv.FormatInt(e.next, 10)
+		e.ttls[id] = time.Duration(secs) * time.Second
+		e.leases[id] = time.Now().Add(e.ttls[id])
+		resp = map[string]string{"ID": id}
+	case "/v3/kv/txn":
+		// The only comparison is that the key was never created.
+		_, exists := e.keys[req.Compare[0].Key]
+		if !exists {
+			e.keys[req.Success[0].Put.Key] = req.Success[0].Put.Lease
+		}
+		resp = map[string]bool{"succeeded": !exists}
+	case "/v3/lease/keepalive":
+		ttl := int64(0)
+		if _, ok := e.leases[req.ID]; ok {
+			e.leases[req.ID] = time.Now().Add(e.ttls[req.ID])
+			ttl = int64(e.ttls[req.ID] / time.Second)
+		}
+		resp = map[string]interface{}{"result": map[string]string{"TTL": strconv.FormatInt(ttl, 10)}}
+	case "/v3/lease/revoke":
+		if _, ok := e.leases[req.ID]; !ok {
+			http.Error(w, `{"message":"etcdserver: requested lease not found"}`, http.StatusNotFound)
+			return
+		}
+		e.revoke(req.ID)
+		resp = struct{}{}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// `revoke` deletes the lease `id` and its keys.
+func (e *memEtcd) revoke(id string) {
+	delete(e.leases, id)
+	delete(e.ttls, id)
+	for key, lease := range e.keys {
+		if lease == id {
+			delete(e.keys, key)
+		}
+	}
+}
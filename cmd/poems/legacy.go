@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ### The first `PoemStorage`
+//
+// The `PoemStorage` of the article could not fail: `Load` returned nil for
+// a poem that was not there, and a storage that failed had no choice but
+// to panic. Storages and callers of that kind still exist, so they get
+// adapters rather than a rewrite:
+//
+//	ps := FromV1(oldStorage) // An old storage where a `PoemStorage` goes.
+//	old := ToV1(ps)          // A `PoemStorage` for old callers.
+//
+// The adapters do not pass on capabilities such as `Lister`, which the
+// first storages did not have. Nor did they take a context: an old storage
+// cannot be interrupted, so `FromV1` only refuses to start calls once the
+// context is done.
+
+// `PoemStorageV1` is the `PoemStorage` of the article.
+type PoemStorageV1 interface {
+	Type() string
+	Load(string) []byte
+	Save(string, []byte)
+}
+
+// `FromV1` turns `ps` into a `PoemStorage`. A poem that `ps` loads as nil
+// is missing, and what `ps` panics with is an error.
+func FromV1(ps PoemStorageV1) PoemStorage {
+	return v1Storage{ps}
+}
+
+type v1Storage struct {
+	storage PoemStorageV1
+}
+
+func (s v1Storage) Save(ctx context.Context, name string, contents []byte) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	return recovered(func() { s.storage.Save(name, contents) })
+}
+
+func (s v1Storage) Load(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	var contents []byte
+	if err := recovered(func() { contents = s.storage.Load(name) }); err != nil {
+		return nil, err
+	}
+	if contents == nil {
+		return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+	}
+	return contents, nil
+}
+
+func (s v1Storage) Type() string {
+	return s.storage.Type()
+}
+
+// `ToV1` turns `ps` into a `PoemStorageV1`. A missing poem loads as nil,
+// and other errors panic.
+func ToV1(ps PoemStorage) PoemStorageV1 {
+	return storageV1{ps}
+}
+
+type storageV1 struct {
+	storage PoemStorage
+}
+
+func (s storageV1) Save(name string, contents []byte) {
+	if err := s.storage.Save(context.Background(), name, contents); err != nil {
+		panic(err)
+	}
+}
+
+func (s storageV1) Load(name string) []byte {
+	contents, err := s.storage.Load(context.Background(), name)
+	if errors.Is(err, ErrNoPoem) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	if contents == nil {
+		return []byte{} // nil would be a missing poem.
+	}
+	return contents
+}
+
+func (s storageV1) Type() string {
+	return s.storage.Type()
+}
+
+// `recovered` calls `fn`, and returns what it panics with as an error.
+func recovered(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	fn()
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Use cases
+//
+// The `PoemHandler` serves a poem in a few lines, but an API that poets
+// write to needs more: reading a poem with its checksum, browsing an
+// anthology page by page, writing a poem. Each of these is a message, and
+// the container provides a handler for it, which a `Dispatcher` finds; see
+// `dispatch.go`. Every delivery mechanism shares them: the GraphQL endpoint
+// of `graphql.go` and the JSON-RPC endpoint of `jsonrpc.go` do not talk to
+// a `PoemStorage`, they send messages. Neither knows about the other, nor
+// which handler answers.
+//
+// `UseCasesModule` provides the handlers for the storage "files". They
+// share one `Revisioner`, as the emulated revisions only count the saves
+// that go through them.
+
+// `UseCasesModule` provides the handlers of the use cases.
+var UseCasesModule = di.Module("usecases",
+	di.Provide(Revisions, di.ParamNames("files"), di.WithLifetime(di.Singleton)),
+	di.Provide(NewReadPoemHandler, di.ParamNames("files"),
+		di.As(new(QueryHandler[ReadPoem, PoemView]))),
+	di.Provide(NewBrowsePoemsHandler, di.ParamNames("files"),
+		di.As(new(QueryHandler[BrowsePoems, Anthology]))),
+	di.Provide(NewWritePoemHandler,
+		di.As(new(CommandHandler[WritePoem]))),
+)
+
+// A `PoemView` is a poem as the use cases return it.
+type PoemView struct {
+	Name     string   `json:"name"`
+	Text     string   `json:"text"`
+	Checksum string   `json:"checksum"`
+	Revision Revision `json:"revision"`
+}
+
+// An `Anthology` is a page of poems, and the cursor of the next page.
+type Anthology struct {
+	Poems []PoemView `json:"poems"`
+	Next  Cursor     `json:"next,omitempty"` // Empty on the last page.
+}
+
+// `ErrNotListable` is returned for storages that cannot list their poems.
+var ErrNotListable = errors.New("storage cannot list its poems")
+
+// #### Reading
+
+// `ReadPoem` asks for the poem `Name`. The answer is a `PoemView`, or
+// `ErrNoPoem`.
+type ReadPoem struct {
+	Name string
+}
+
+// A `ReadPoemHandler` answers `ReadPoem`.
+type ReadPoemHandler struct {
+	storage   PoemStorage
+	revisions Revisioner
+}
+
+// `NewReadPoemHandler` reads poems from `ps`, and their revisions from
+// `rv`.
+func NewReadPoemHandler(ps PoemStorage, rv Revisioner) *ReadPoemHandler {
+	return &ReadPoemHandler{storage: ps, revisions: rv}
+}
+
+func (h *ReadPoemHandler) Handle(ctx context.Context, q ReadPoem) (PoemView, error) {
+	// The revision comes first: if a save slips in between, the view has
+	// the new text at the old revision, and a save with it conflicts, which
+	// is safe. The other way round, it would overwrite the new text.
+	rev, err := h.revisions.Revision(ctx, q.Name)
+	if err != nil {
+		return PoemView{}, fmt.Errorf("read %q: %w", q.Name, err)
+	}
+	contents, err := h.storage.Load(ctx, q.Name)
+	if err != nil {
+		return PoemView{}, fmt.Errorf("read %q: %w", q.Name, err)
+	}
+	return PoemView{Name: q.Name, Text: string(contents), Checksum: sum(contents), Revision: rev}, nil
+}
+
+// `BrowsePoems` asks for up to `Limit` poems after the cursor `After`, as
+// `Lister.List` returns them. The answer is an `Anthology`.
+type BrowsePoems struct {
+	After Cursor
+	Limit int
+}
+
+// A `BrowsePoemsHandler` answers `BrowsePoems`.
+type BrowsePoemsHandler struct {
+	storage PoemStorage
+	read    QueryHandler[ReadPoem, PoemView]
+}
+
+// `NewBrowsePoemsHandler` lists the poems of `ps`, and reads each with
+// `read`.
+func NewBrowsePoemsHandler(ps PoemStorage, read QueryHandler[ReadPoem, PoemView]) *BrowsePoemsHandler {
+	return &BrowsePoemsHandler{storage: ps, read: read}
+}
+
+func (h *BrowsePoemsHandler) Handle(ctx context.Context, q BrowsePoems) (Anthology, error) {
+	lister, ok := h.storage.(Lister)
+	if !ok {
+		return Anthology{}, fmt.Errorf("browse %s: %w", h.storage.Type(), ErrNotListable)
+	}
+	names, next, err := lister.List(ctx, q.After, q.Limit)
+	if err != nil {
+		return Anthology{}, fmt.Errorf("browse: %w", err)
+	}
+	a := Anthology{Next: next}
+	for _, name := range names {
+		p, err := h.read.Handle(ctx, ReadPoem{Name: name})
+		if errors.Is(err, ErrNoPoem) {
+			continue // Deleted since it was listed.
+		}
+		if err != nil {
+			return Anthology{}, err
+		}
+		a.Poems = append(a.Poems, p)
+	}
+	return a, nil
+}
+
+// #### Writing
+
+// `WritePoem` saves the poem `Name`. With a `Revision`, it only saves a
+// poem that is still at it, and fails with a `*ConflictError` otherwise.
+// Without one, it saves the poem whatever its revision.
+type WritePoem struct {
+	Name     string
+	Text     string
+	Revision *Revision
+}
+
+// `maxWriteAttempts` limits how often a `WritePoem` without a revision
+// tries again after a conflict.
+const maxWriteAttempts = 5
+
+// A `WritePoemHandler` executes `WritePoem`.
+type WritePoemHandler struct {
+	revisions Revisioner
+}
+
+// `NewWritePoemHandler` saves poems through `rv`.
+func NewWritePoemHandler(rv Revisioner) *WritePoemHandler {
+	return &WritePoemHandler{revisions: rv}
+}
+
+// `Handle` saves a poem without a revision at the revision that it has.
+// If another save comes in between, it tries again, up to
+// `maxWriteAttempts` times, then returns the `*ConflictError`.
+func (h *WritePoemHandler) Handle(ctx context.Context, cmd WritePoem) error {
+	if cmd.Name == "" {
+		return errors.New("write: a poem needs a name")
+	}
+	if cmd.Revision != nil {
+		return h.saveIf(ctx, cmd, *cmd.Revision)
+	}
+	var err error
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		rev, rerr := h.revisions.Revision(ctx, cmd.Name)
+		if rerr != nil {
+			return fmt.Errorf("write %q: %w", cmd.Name, rerr)
+		}
+		err = h.saveIf(ctx, cmd, rev)
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// `saveIf` saves the poem of `cmd` if it is at revision `expected`.
+func (h *WritePoemHandler) saveIf(ctx context.Context, cmd WritePoem, expected Revision) error {
+	if _, err := h.revisions.SaveIf(ctx, cmd.Name, []byte(cmd.Text), expected); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// `writePoem` sends `cmd`, and returns the poem as stored, which is what
+// the endpoints answer a write with.
+func writePoem(ctx context.Context, d *Dispatcher, cmd WritePoem) (PoemView, error) {
+	if err := Send(ctx, d, cmd); err != nil {
+		return PoemView{}, err
+	}
+	return Ask[PoemView](ctx, d, ReadPoem{Name: cmd.Name})
+}
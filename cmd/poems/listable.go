@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ### Managing poems
+//
+// A poet who tidies up wants to see all poems, check for one, and throw
+// one away. A `ListableStorage` can do all three: it is a `Lister`, which
+// lists its poems page by page (see `paging.go`), a `Deleter`, and an
+// `Exister`. `ListAll` follows the pages to the end, for callers that
+// want every name at once.
+//
+// Each of them is a capability of its own, with a function that works on
+// any storage. `Exists` loads the poem of storages that are not
+// `Exister`s. Deletion cannot be emulated, so `Delete` fails with
+// `ErrNotDeletable` for storages that are not `Deleter`s. That includes
+// the decorators: a decorator that keeps state about poems, such as a
+// cache or an index, would have to forget the poem, too. Like bulk
+// deletion, deleting one poem works on the bare backends.
+
+// A `Deleter` is a storage that can delete poems.
+type Deleter interface {
+	// `Delete` deletes the poem `name`. It returns `ErrNoPoem` if there is
+	// no such poem.
+	Delete(ctx context.Context, name string) error
+}
+
+// An `Exister` is a storage that can tell whether it has a poem without
+// loading it.
+type Exister interface {
+	// `Exists` reports whether `Load` would find the poem `name`.
+	Exists(ctx context.Context, name string) (bool, error)
+}
+
+// A `ListableStorage` is a storage whose poems callers can enumerate and
+// manage.
+type ListableStorage interface {
+	PoemStorage
+	Lister
+	Deleter
+	Exister
+}
+
+// `ErrNotDeletable` is returned for storages that cannot delete poems.
+var ErrNotDeletable = errors.New("storage cannot delete poems")
+
+// `ListAll` returns the names of all poems in `ps`, in ascending order, if
+// `ps` is a `Lister`.
+func ListAll(ctx context.Context, ps PoemStorage) ([]string, error) {
+	l, ok := ps.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("list %s: %w", ps.Type(), ErrNotListable)
+	}
+	var names []string
+	var after Cursor
+	for {
+		page, next, err := l.List(ctx, after, 0)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, page...)
+		if next == "" {
+			return names, nil
+		}
+		after = next
+	}
+}
+
+// `Delete` deletes the poem `name` from `ps`, if `ps` is a `Deleter`.
+func Delete(ctx context.Context, ps PoemStorage, name string) error {
+	if d, ok := ps.(Deleter); ok {
+		return d.Delete(ctx, name)
+	}
+	return fmt.Errorf("delete %q from %s: %w", name, ps.Type(), ErrNotDeletable)
+}
+
+// `Exists` reports whether `ps` has the poem `name`, natively if `ps` is
+// an `Exister`.
+func Exists(ctx context.Context, ps PoemStorage, name string) (bool, error) {
+	if ex, ok := ps.(Exister); ok {
+		return ex.Exists(ctx, name)
+	}
+	_, err := ps.Load(ctx, name)
+	if errors.Is(err, ErrNoPoem) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// #### The backends
+//
+// The `Notebook` tears out the page of the poem.
+
+func (n *Notebook) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.poems[name]; !ok {
+		return fmt.Errorf("delete %q: %w", name, ErrNoPoem)
+	}
+	delete(n.poems, name)
+	delete(n.meta, name)
+	return nil
+}
+
+func (n *Notebook) Exists(ctx context.Context, name string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	_, ok := n.poems[name]
+	return ok, nil
+}
+
+// The `Napkin` lists the name of the poem on it, if there is one, and, as
+// in bulk deletion, a poem goes if its name matches. As the poet reads the
+// napkin for every name, every poem exists, and a deleted one is blank.
+
+func (n *Napkin) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	var names []string
+	if len(n.poem) > 0 {
+		names = append(names, n.name)
+	}
+	return Paginate(names, after, limit)
+}
+
+func (n *Napkin) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.poem) == 0 || name != n.name {
+		return fmt.Errorf("delete %q: %w", name, ErrNoPoem)
+	}
+	n.name, n.poem, n.meta = "", []byte{}, Metadata{}
+	return nil
+}
+
+func (n *Napkin) Exists(ctx context.Context, name string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// The `FileStorage` removes the file of the poem, and then the file of its
+// metadata, if it has one, and its history.
+
+func (s *FileStorage) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("delete %q: %w", name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.fs.Remove(s.file(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete %q: %w", name, ErrNoPoem)
+	}
+	if err != nil {
+		return fmt.Errorf("delete %q: %w", name, err)
+	}
+	if err := s.fs.Remove(s.metaFile(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete metadata of %q: %w", name, err)
+	}
+	if err := s.forget(name); err != nil {
+		return fmt.Errorf("delete history of %q: %w", name, err)
+	}
+	return nil
+}
+
+func (s *FileStorage) Exists(ctx context.Context, name string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	_, err := fs.Stat(s.fs, s.file(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// #### Conformance
+//
+// `checkDeleter` checks that `Exists` agrees with `Load` on the poems in
+// `names`, and that every poem that `ps` lists can be deleted: then it is
+// no longer listed, and loads as missing, or blank on a napkin. Its
+// metadata and history go with it, so a poem of the same name starts
+// without.
+// Deleting a poem that is not there fails with `ErrNoPoem`. `TestLaws`
+// runs it on every backend that deletes, after the other checks, as it
+// deletes the poems.
+func checkDeleter(ctx context.Context, d Deleter, ps PoemStorage, names []string) error {
+	agree := func(name string) error {
+		exists, err := Exists(ctx, ps, name)
+		if err != nil {
+			return err
+		}
+		_, err = ps.Load(ctx, name)
+		if err != nil && !errors.Is(err, ErrNoPoem) {
+			return err
+		}
+		if loads := err == nil; exists != loads {
+			return fmt.Errorf("Exists(%q) = %v, but Load says %v", name, exists, loads)
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := agree(name); err != nil {
+			return err
+		}
+	}
+	listed, err := ListAll(ctx, ps)
+	if errors.Is(err, ErrNotListable) {
+		listed, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range listed {
+		if err := d.Delete(ctx, name); err != nil {
+			return fmt.Errorf("delete listed poem %q: %w", name, err)
+		}
+		if err := agree(name); err != nil {
+			return err
+		}
+		if contents, err := ps.Load(ctx, name); err == nil && len(contents) > 0 {
+			return fmt.Errorf("deleted poem %q loads as %q", name, contents)
+		}
+		if err := ps.Save(ctx, name, []byte("again")); err != nil {
+			return err
+		}
+		if meta, err := LoadMeta(ctx, ps, name); err != nil || !meta.equal(Metadata{}) {
+			return fmt.Errorf("deleted poem %q, saved again: metadata %+v, %v, want none", name, meta, err)
+		}
+		if revs, err := History(ctx, ps, name); !errors.Is(err, ErrNoHistory) && (err != nil || len(revs) != 1) {
+			return fmt.Errorf("deleted poem %q, saved again: history %v, %v, want one revision", name, revs, err)
+		}
+		if err := d.Delete(ctx, name); err != nil {
+			return fmt.Errorf("delete poem %q again: %w", name, err)
+		}
+		if now, err := ListAll(ctx, ps); err != nil || contains(now, name) {
+			return fmt.Errorf("deleted poem %q: listed as %q, %v", name, now, err)
+		}
+	}
+	if err := d.Delete(ctx, "never saved"); !errors.Is(err, ErrNoPoem) {
+		return fmt.Errorf("delete of a missing poem: got %v, want ErrNoPoem", err)
+	}
+	return nil
+}
+
+// `contains` reports whether `names` contains `name`.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Locks
+//
+// Several instances of the example can share a database, a directory, or
+// a Redis. Most of their work does not need to be coordinated, but some
+// must happen once at a time: two instances that start together must not
+// both migrate the schema of the same SQLite database. Such components get
+// a `Locker` injected, and hold a lock of a well-known name while they
+// work.
+//
+// Which `Locker` depends on how the instances are deployed, so the setting
+// "lock.kind" selects it:
+//
+//   - "local" locks within the process, which is enough for one instance.
+//   - "file" locks with files in the directory "lock.dir", for instances
+//     on one machine or on a shared file system.
+//   - "redis" locks with keys in Redis, for instances anywhere.
+//
+// The file and Redis locks are leases: a lock that is held longer than
+// "lock.ttl" counts as abandoned by an instance that crashed, and another
+// instance may take it over. Work under a lock must finish well within
+// the TTL.
+
+// A `Locker` hands out named locks.
+type Locker interface {
+	// `Lock` waits until the lock `name` is free, or `ctx` is done, and
+	// takes it. It returns the function that releases the lock.
+	Lock(ctx context.Context, name string) (unlock func() error, err error)
+}
+
+// `lockPoll` is how often the file and Redis lockers try again to take a
+// lock that is held.
+const lockPoll = 50 * time.Millisecond
+
+// `NewLocker` returns the locker that `cfg` selects. Only the Redis
+// locker resolves `redis`.
+func NewLocker(cfg LockConfig, redis di.Lazy[Redis]) (Locker, error) {
+	switch cfg.Kind {
+	case "local":
+		return NewLocalLocker(), nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, errors.New("file locks need the setting lock.dir")
+		}
+		return NewFileLocker(cfg.Dir, cfg.TTL), nil
+	case "redis":
+		r, err := redis.Get()
+		if err != nil {
+			return nil, err
+		}
+		return NewRedisLocker(r, cfg.TTL), nil
+	}
+	return nil, fmt.Errorf("unknown lock kind %q (want local, file, or redis)", cfg.Kind)
+}
+
+// `waitLock` calls `try` until it takes the lock, fails, or `ctx` is done.
+func waitLock(ctx context.Context, name string, try func() (bool, error)) error {
+	for {
+		ok, err := try()
+		if err != nil {
+			return fmt.Errorf("lock %q: %w", name, err)
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("lock %q: %w", name, ctx.Err())
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+// `lockToken` returns a random token that identifies the holder of a
+// lease, so that an instance whose lease was taken over does not release
+// the lock of the new holder.
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// #### Local locks
+
+// `LocalLocker` locks within the process. A lock is a channel with room
+// for one token: taking the lock sends it, releasing receives it.
+type LocalLocker struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// `NewLocalLocker` returns a locker for one process.
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{locks: map[string]chan struct{}{}}
+}
+
+func (l *LocalLocker) Lock(ctx context.Context, name string) (func() error, error) {
+	l.mu.Lock()
+	lock, ok := l.locks[name]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.locks[name] = lock
+	}
+	l.mu.Unlock()
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("lock %q: %w", name, ctx.Err())
+	}
+	var once sync.Once
+	return func() error {
+		once.Do(func() { <-lock })
+		return nil
+	}, nil
+}
+
+// #### File locks
+
+// `FileLocker` locks with files: the lock `name` is held while the file
+// "<name>.lock" exists in the directory. Creating a file that must not
+// exist is atomic on every file system, unlike the advisory locks of the
+// operating systems, which also do not work on all network file systems.
+// The file holds the token of its holder.
+type FileLocker struct {
+	dir string
+	ttl time.Duration
+}
+
+// `NewFileLocker` locks with files in `dir`. Locks older than `ttl` are
+// abandoned.
+func NewFileLocker(dir string, ttl time.Duration) *FileLocker {
+	return &FileLocker{dir: dir, ttl: ttl}
+}
+
+func (l *FileLocker) Lock(ctx context.Context, name string) (func() error, error) {
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("lock %q: %w", name, err)
+	}
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(l.dir, url.PathEscape(name)+".lock")
+	err = waitLock(ctx, name, func() (bool, error) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			breakAbandoned(path, token, l.ttl)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		_, err = f.WriteString(token)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() (err error) {
+		once.Do(func() {
+			// The lock may have been taken over while it was held.
+			if held, rerr := os.ReadFile(path); rerr != nil || string(held) != token {
+				err = fmt.Errorf("lock %q: lost", name)
+				return
+			}
+			err = os.Remove(path)
+		})
+		return err
+	}, nil
+}
+
+// `breakAbandoned` removes the lock file at `path` if it is older than
+// `ttl`. It renames the file out of the way first. If another instance
+// broke the lock and took it in the meantime, the rename moved the new
+// lock, and `breakAbandoned` links it back, which fails rather than
+// replace a lock that is newer still.
+func breakAbandoned(path, token string, ttl time.Duration) {
+	info, err := os.Stat(path)
+	if err != nil || ttl <= 0 || time.Since(info.ModTime()) < ttl {
+		return
+	}
+	stale := path + "." + token + ".stale"
+	if os.Rename(path, stale) != nil {
+		return
+	}
+	if moved, err := os.Stat(stale); err == nil && !os.SameFile(info, moved) {
+		os.Link(stale, path)
+	}
+	os.Remove(stale)
+}
+
+// #### Redis locks
+
+// `RedisLocker` locks with keys in Redis: the lock `name` is held while
+// the key "poems:lock:<name>" exists. `SET NX PX` takes a lock atomically
+// and with the TTL, and a script releases it only if it still holds the
+// token of the holder.
+type RedisLocker struct {
+	redis Redis
+	ttl   time.Duration
+}
+
+// `NewRedisLocker` locks with keys in `r`, which expire after `ttl`.
+func NewRedisLocker(r Redis, ttl time.Duration) *RedisLocker {
+	return &RedisLocker{redis: r, ttl: ttl}
+}
+
+// `redisUnlock` deletes a lock if it holds the token.
+const redisUnlock = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+
+func (l *RedisLocker) Lock(ctx context.Context, name string) (func() error, error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	key := "poems:lock:" + name
+	ttl := l.ttl.Milliseconds()
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lock %q: Redis locks need a TTL", name)
+	}
+	err = waitLock(ctx, name, func() (bool, error) {
+		reply, err := l.redis.Do(ctx, "SET", key, token, "NX", "PX", strconv.FormatInt(ttl, 10))
+		return reply != nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() (err error) {
+		once.Do(func() {
+			var reply interface{}
+			reply, err = l.redis.Do(context.Background(), "EVAL", redisUnlock, "1", key, token)
+			if n, _ := reply.(int64); err == nil && n == 0 {
+				err = fmt.Errorf("lock %q: lost", name)
+			}
+		})
+		return err
+	}, nil
+}
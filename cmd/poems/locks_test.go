@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// #### Lock tests
+
+// `lockers` creates fresh lockers of each kind, whose leases last `ttl`.
+var lockers = []struct {
+	name  string
+	lease bool // Whether locks are taken over after the TTL.
+	new   func(t *testing.T, ttl time.Duration) Locker
+}{
+	{"local", false, func(*testing.T, time.Duration) Locker { return NewLocalLocker() }},
+	{"file", true, func(t *testing.T, ttl time.Duration) Locker { return NewFileLocker(t.TempDir(), ttl) }},
+	{"redis", true, func(_ *testing.T, ttl time.Duration) Locker { return NewRedisLocker(newMemRedis(), ttl) }},
+}
+
+func TestLockContention(t *testing.T) {
+	for _, lk := range lockers {
+		t.Run(lk.name, func(t *testing.T) {
+			l := lk.new(t, time.Minute)
+			var held, overlaps, done int32
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					unlock, err := l.Lock(context.Background(), "migrate")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if atomic.AddInt32(&held, 1) > 1 {
+						atomic.AddInt32(&overlaps, 1)
+					}
+					time.Sleep(5 * time.Millisecond)
+					atomic.AddInt32(&held, -1)
+					atomic.AddInt32(&done, 1)
+					if err := unlock(); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+			if overlaps != 0 || done != 8 {
+				t.Errorf("%d of 8 holders done, %d while another held the lock, want all, one at a time", done, overlaps)
+			}
+		})
+	}
+}
+
+func TestLockWaits(t *testing.T) {
+	for _, lk := range lockers {
+		t.Run(lk.name, func(t *testing.T) {
+			l := lk.new(t, time.Minute)
+			unlock, err := l.Lock(context.Background(), "migrate")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Other names are free.
+			other, err := l.Lock(context.Background(), "vacuum")
+			if err != nil {
+				t.Fatal(err)
+			}
+			other()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+			defer cancel()
+			if _, err := l.Lock(ctx, "migrate"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("held lock: got %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			// A waiting Lock takes the lock once it is released.
+			got := make(chan error, 1)
+			go func() {
+				unlock, err := l.Lock(context.Background(), "migrate")
+				if err == nil {
+					err = unlock()
+				}
+				got <- err
+			}()
+			time.Sleep(20 * time.Millisecond)
+			if err := unlock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := unlock(); err != nil {
+				t.Errorf("second unlock: %v", err)
+			}
+			select {
+			case err := <-got:
+				if err != nil {
+					t.Error(err)
+				}
+			case <-time.After(time.Second):
+				t.Error("the waiting Lock did not take the released lock")
+			}
+		})
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	for _, lk := range lockers {
+		if !lk.lease {
+			continue
+		}
+		t.Run(lk.name, func(t *testing.T) {
+			l := lk.new(t, 100*time.Millisecond)
+			crashed, err := l.Lock(context.Background(), "migrate")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			start := time.Now()
+			unlock, err := l.Lock(ctx, "migrate")
+			if err != nil {
+				t.Fatalf("the abandoned lock was not taken over: %v", err)
+			}
+			if waited := time.Since(start); waited < 80*time.Millisecond {
+				t.Errorf("the lock was taken over after %v, before its TTL", waited)
+			}
+
+			// The former holder cannot release the new holder's lock.
+			if err := crashed(); err == nil || !strings.Contains(err.Error(), "lost") {
+				t.Errorf("unlock by the former holder: got %v, want the lock lost", err)
+			}
+			ctx2, cancel2 := context.WithTimeout(context.Background(), 30*time.Millisecond)
+			defer cancel2()
+			if _, err := l.Lock(ctx2, "migrate"); err == nil {
+				t.Error("the former holder released the new holder's lock")
+			}
+			if err := unlock(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestNewLocker(t *testing.T) {
+	c := di.New()
+	c.Provide(func() Redis { return newMemRedis() })
+	redis := di.MustResolve[di.Lazy[Redis]](c)
+	for _, tc := range []struct {
+		cfg LockConfig
+		ok  bool
+	}{
+		{LockConfig{Kind: "local"}, true},
+		{LockConfig{Kind: "file", Dir: t.TempDir()}, true},
+		{LockConfig{Kind: "file"}, false},
+		{LockConfig{Kind: "redis", TTL: time.Second}, true},
+		{LockConfig{Kind: "etcd"}, false},
+	} {
+		if _, err := NewLocker(tc.cfg, redis); (err == nil) != tc.ok {
+			t.Errorf("%+v: got %v, want success: %t", tc.cfg, err, tc.ok)
+		}
+	}
+	l, _ := NewLocker(LockConfig{Kind: "redis"}, redis)
+	if _, err := l.Lock(context.Background(), "migrate"); err == nil {
+		t.Error("a Redis lock without a TTL was taken")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// A `LoggingStorage` logs every call before passing it on to the storage it
+// wraps. It is a decorator: a `PoemStorage` that adds behavior to another
+// `PoemStorage`, so neither the storage nor the poems that use it need to
+// change.
+type LoggingStorage struct {
+	storage PoemStorage
+	log     *log.Logger
+}
+
+// `NewLoggingStorage` wraps `ps` and writes to `l`.
+func NewLoggingStorage(ps PoemStorage, l *log.Logger) *LoggingStorage {
+	return &LoggingStorage{
+		storage: ps,
+		log:     l,
+	}
+}
+
+func (s *LoggingStorage) Save(ctx context.Context, name string, contents []byte) error {
+	s.log.Printf("%s: save %q (%d bytes)", s.storage.Type(), name, len(contents))
+	err := s.storage.Save(ctx, name, contents)
+	if err != nil {
+		s.log.Printf("%s: save %q: %v", s.storage.Type(), name, err)
+	}
+	return err
+}
+
+func (s *LoggingStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	contents, err := s.storage.Load(ctx, name)
+	if err != nil {
+		s.log.Printf("%s: load %q: %v", s.storage.Type(), name, err)
+		return nil, err
+	}
+	s.log.Printf("%s: load %q (%d bytes)", s.storage.Type(), name, len(contents))
+	return contents, nil
+}
+
+func (s *LoggingStorage) Type() string {
+	return s.storage.Type()
+}
@@ -0,0 +1,1202 @@
+/*
+<!--
+Copyright (c) 2016 Christoph Berger. Some rights reserved.
+Use of this text is governed by a Creative Commons Attribution Non-Commercial
+Share-Alike License that can be found in the LICENSE.txt file.
+
+The source code contained in this file may import third-party source code
+whose licenses are provided in the respective license files.
+-->
+
++++
+title = "Dependency Injection in a nutshell"
+description = "How to implement the Dependency Rule in Go"
+author = "Christoph Berger"
+email = "chris@appliedgo.net"
+date = "2016-06-23"
+publishdate = "2016-06-23"
+categories = ["Architecture"]
+tags = ["Dependency Injection", "Separation Of Concerns", "Interface"]
+articletypes = ["Tutorial"]
++++
+
+Layered software architectures adhere to the *Dependency Rule:* Source code in a lower-level layer can make use of code in higher-level layers, but never vice versa. Control flow, however, goes in both directions. How is this possible, given that higher-level code must not know anything about the code in lower levels?
+
+<!--more-->
+
+## Software Architecture
+
+Software architecture strives to provide structure to software systems, in order to make them robust, maintainable, extendable, testable, easier to develop, and easier to document.
+
+Many different [architecture patterns](https://en.wikipedia.org/wiki/List_of_software_architecture_styles_and_patterns) have evolved over time, at different abstraction levels and with different levels of complexity. Among these architecture patterns, layered architectures seem to represent a fairly versatile concept that is applicable to a large range of scenarios.
+
+Just to see how such an architecture may look like, let's have a brief look at the *Clean Architecture*, a layered architecture model that summarizes the idea of layering very well.
+
+
+## The Clean Architecture
+
+At the center of any layered software architecture is the separation of concerns. In simple words: The less each software module knows about the other modules, the better.
+
+To achieve this, the modules are organized into layers. Each layer represents a certain level of abstraction. The Clean Architecture model describes them as (at least) four concentric circles, with the innermost circle representing the highest abstraction level.
+
+![The Clean Architecture](cleanarchitecture.png)
+
+(Discussing each layer in detail is outside the scope of this article. I briefly introduced the Clean Architecture here so that the dependency problem that is discussed below becomes clear. You can read more about The Clean Architecture [in this article](http://blog.8thlight.com/uncle-bob/2012/08/13/the-clean-architecture.html). Definitely recommended!)
+
+The central rule of The Clean Architecture is the **Dependency Rule**, which says,
+
+> Source code dependencies can only point inwards.
+
+In other words, the source code of each circle can only access code in an inner circle but never any code in an outer circle.
+
+But what is this good for?
+
+
+## A small example without the Dependency Rule
+
+As a completely made up and utterly pointless scenario, imagine a poet who writes, well, poems. Poems have to be stored somewhere, so the Chief Software Architect of ACME Poem Processing, Inc. comes up with this architecture:
+
+* A top layer (or "inner ring") containing poem documents, and
+* A bottom layer (or "outer ring") containing poem storage entities.
+
+![A two-layer poem architecture](poemarchitecture.png)
+
+(Granted, this is a rather simplified version of a layered architecture but for our scenario, it is just enough.)
+
+A document object obviously needs to access the services of a storage object to store and retrieve its contents (blue arrow). Thus it would seem natural to add a storage service directly to the document.
+
+In our example, our poet surely wants to write the poems into a small notebook, and thus the Lead Programmer creates this document layer:
+
+```go
+type Poem struct {
+	content []byte
+	storage acmeStorageServices.PoemNotebook
+}
+
+func NewPoem() *Poem {
+	return &Poem {
+		storage: acmeStorageServices.NewPoemNotebook(),
+	}
+}
+
+func (p *Poem) Load(title string) {
+	p.content = p.storage.Load(title)
+}
+func (p *Poem) Save(title string) {
+	storage.Save(title, p.content)
+}
+```
+
+Easy enough! But wait--what if our poet decides to write a poem on a napkin? Or on 4x6 index cards? **The document layer would have to be modified and recompiled!** We have created an unwanted dependency on a particular storage type.
+
+How can we remove that dependency?
+
+
+## Abstraction to the rescue
+
+As a first step, we can replace the storage service by an abstraction of that service. Using Go's `interface` type, this becomes really easy.
+
+```go
+type PoemStorage interface {
+	Load(string) []byte
+	Save(string, []byte)
+}
+```
+
+The interface describes only a behavior, and our Poem object can call the interface functions without worring about the object that implements this interface.
+
+Now we can define the Poem struct without any dependency on the storage layer:
+
+```go
+type Poem struct {
+	content []byte
+	storage PoemStorage
+}
+```
+
+Remember, `PoemStorage` is just an interface but we can assign any type to `storage` that satisfies this interface.
+
+![Poem storage interface](poemabstraction.png)
+
+
+## Adding dependency injection
+
+Right now the Poem only talks to an empty abstraction. As the next step, we need a way to connect a real storage object to the Poem.
+
+In other words, we need to *inject a dependency* on a PoemStorage object into the Poem layer.
+
+We can do this, for example, through a constructor:
+
+```go
+func NewPoem(ps PoemStorage) *Poem {
+	return &Poem{
+		storage: ps
+	}
+}
+```
+When called, the constructor receives an actual PoemStorage object, yet the returned Poem still just talks to the abstract PoemStorage interface.
+
+Finally, in `main()` or in some dedicated setup function, we can wire up all higher-level objects with their lower-level dependencies.
+
+```go
+func main() {
+	storage := NewNapkin()
+	poem := NewPoem(storage)  // wired up.
+}
+```
+
+Boom! We have just injected a dependency on a Napkin object into our new Poem object. To point it out again, at no point did the Poem object learn about the Napkin object, yet we just made it use one.
+
+
+HYPE[Clean Poem Architecture with dependency injection](poem.html)
+
+*This is the gist of dependency injection.* There is surely more to it than we were able to go through in this article. The interface/constructor pattern is not the only approach to implementing dependency injection. Still, it is a quite appealing one because it is clear and concise and builds upon just a few basic language constructs.
+
+
+## Verba docent exempla trahunt
+
+*Words teach, examples lead.* With this in mind let me finish this article with a working example.
+
+(Note: The first version of this example left out error handling for brevity's sake. It has since grown into a small application, and it handles errors like one: the storages return them, the container reports what is wrong with the wiring before anything runs, and `main` stops with a message when something fails. Dear inexperienced readers: Do the same. Wherever you can. I am serious about this.)
+
+*/
+
+// ## Imports and globals
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/appliedgo/di"
+	"github.com/appliedgo/di/config"
+	"github.com/appliedgo/di/fsys"
+	"github.com/appliedgo/di/lifecycle"
+)
+
+// ### The "inner ring"
+
+// A `Poem` contains some poetry, the metadata that describes it, and an
+// abstract storage reference.
+type Poem struct {
+	content []byte
+	meta    Metadata
+	storage PoemStorage
+	now     func() time.Time // Dates the saves.
+}
+
+// `PoemStorage` is just an interface that defines the behavior of a poem storage.
+// This is all that `Poem` knows (and needs to know) about storing and retrieving poems.
+// Nothing from the "outer ring" appears here.
+//
+// Storing a poem can fail: files fill disks, and networks drop connections.
+// `Load` and `Save` say so with an error, and `Load` returns an error that
+// matches `ErrNoPoem` if there is no poem of that name. Both take a context,
+// which callers use to give up on slow storages. The first `PoemStorage`
+// could not fail; `legacy.go` adapts storages of that kind.
+type PoemStorage interface {
+	Type() string                                                 // Return a string describing the storage type.
+	Load(ctx context.Context, name string) ([]byte, error)        // Load a poem by name.
+	Save(ctx context.Context, name string, contents []byte) error // Save a poem by name.
+}
+
+// `ErrNoPoem` is returned for poems that a storage does not have.
+var ErrNoPoem = errors.New("no such poem")
+
+// `NewPoem` constructs a `Poem` object. We use this constructor to inject an object
+// that satisfies the `PoemStorage` interface.
+func NewPoem(ps PoemStorage) *Poem {
+	return &Poem{
+		content: []byte("I am a poem from a " + ps.Type() + "."),
+		storage: ps,
+		now:     time.Now,
+	}
+}
+
+// `Save` simply calls `Save` on the interface type. The `Poem` object neither knows
+// nor cares about which actual storage object receives this method call.
+// Cancelling `ctx` gives up on the save.
+//
+// The metadata goes along, dated: a poem that was never saved is created
+// now, and every save updates it. Storages that cannot keep metadata
+// keep the content only; see `metadata.go`.
+func (p *Poem) Save(ctx context.Context, name string) error {
+	if err := p.storage.Save(ctx, name, p.content); err != nil {
+		return err
+	}
+	meta := p.meta.clone()
+	meta.Updated = p.now()
+	if meta.Created.IsZero() {
+		meta.Created = meta.Updated
+	}
+	if err := SaveMeta(ctx, p.storage, name, meta); err != nil && !errors.Is(err, ErrNoMetadata) {
+		return err
+	}
+	p.meta = meta
+	return nil
+}
+
+// `Load` also invokes the injected storage object without knowing it. If
+// the poem cannot be loaded, the `Poem` keeps its content. A poem saved
+// without metadata loads with none.
+func (p *Poem) Load(ctx context.Context, name string) error {
+	content, err := p.storage.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	meta, err := LoadMeta(ctx, p.storage, name)
+	if err != nil {
+		return err
+	}
+	p.content, p.meta = content, meta
+	return nil
+}
+
+// `Author` returns the poet, if the poem names one.
+func (p *Poem) Author() string {
+	return p.meta.Author
+}
+
+// `SetAuthor` names the poet. The next `Save` saves the name.
+func (p *Poem) SetAuthor(author string) {
+	p.meta.Author = author
+}
+
+// `Tags` returns the tags of the poem.
+func (p *Poem) Tags() []string {
+	return append([]string(nil), p.meta.Tags...)
+}
+
+// `SetTags` replaces the tags of the poem. The next `Save` saves them.
+func (p *Poem) SetTags(tags ...string) {
+	p.meta.Tags = append([]string(nil), tags...)
+}
+
+// `Created` returns when the poem was first saved, or the zero time if it
+// was not, or was saved without metadata.
+func (p *Poem) Created() time.Time {
+	return p.meta.Created
+}
+
+// `Updated` returns when the poem was last saved, as `Created` does.
+func (p *Poem) Updated() time.Time {
+	return p.meta.Updated
+}
+
+// `Metadata` returns all metadata of the poem at once.
+func (p *Poem) Metadata() Metadata {
+	return p.meta.clone()
+}
+
+// `String` makes Poem a Stringer, allowing us to drop it anywhere a string would be
+// expected.
+func (p *Poem) String() string {
+	return string(p.content)
+}
+
+// ### The "outer ring"
+
+// #### The notebook
+
+// A `Notebook` is the classic storage device of a poet.
+//
+// Poets on many goroutines may share one notebook, which takes turns with
+// its pages. `Load` hands out the poem the notebook holds, not a copy of
+// it, so a caller that changes the slice changes the poem. A notebook with
+// `CopyOnRead` set keeps poems to itself: it saves a copy of each poem and
+// hands out copies.
+type Notebook struct {
+	mu    sync.RWMutex
+	poems map[string][]byte
+	meta  map[string]Metadata // See `metadata.go`.
+
+	CopyOnRead bool
+}
+
+func NewNotebook() *Notebook {
+	return &Notebook{
+		poems: map[string][]byte{},
+		meta:  map[string]Metadata{},
+	}
+}
+
+// After adding `Save` and `Load`, `Notebook` implicitly satisfies `PoemStorage`.
+// A notebook is never slow, but a poet who has given up does not write.
+func (n *Notebook) Save(ctx context.Context, name string, contents []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.poems[name] = n.copy(contents)
+	return nil
+}
+
+func (n *Notebook) Load(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	contents, ok := n.poems[name]
+	if !ok {
+		return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+	}
+	return n.copy(contents), nil
+}
+
+// `copy` copies a poem if the notebook copies on read.
+func (n *Notebook) copy(contents []byte) []byte {
+	if n.CopyOnRead {
+		return clone(contents)
+	}
+	return contents
+}
+
+// `Type` returns an informal description of the storage type.
+func (n *Notebook) Type() string {
+	return "Notebook"
+}
+
+// A `Napkin` is the emergency storage device of a poet.
+// It can store only one poem. Like a notebook, it can be shared, and with
+// `CopyOnRead` set, it keeps its poem to itself.
+type Napkin struct {
+	mu   sync.RWMutex
+	name string
+	poem []byte
+	meta Metadata
+
+	CopyOnRead bool
+}
+
+func NewNapkin() *Napkin {
+	return &Napkin{
+		poem: []byte{},
+	}
+}
+
+func (n *Napkin) Save(ctx context.Context, name string, contents []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.name, n.poem = name, n.copy(contents)
+	return nil
+}
+
+// A napkin has room for one poem only, and whichever poem is asked for, the
+// poet reads the one that is on it.
+func (n *Napkin) Load(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.copy(n.poem), nil
+}
+
+// `copy` copies the poem if the napkin copies on read.
+func (n *Napkin) copy(contents []byte) []byte {
+	if n.CopyOnRead {
+		return clone(contents)
+	}
+	return contents
+}
+
+func (n *Napkin) Type() string {
+	return "Napkin"
+}
+
+// ### Wiring everything up
+
+// Create and connect objects, then save and load a few poems from different storage objects.
+//
+// Instead of calling the constructors by hand, we let a `di.Container` do the wiring.
+// The container maps each type to a provider function that knows how to build a value
+// of that type.
+func main() {
+	c := di.New()
+
+	// When `main` returns, `Close` releases what the container has built and
+	// holds resources, such as storages with open files: every value that is
+	// an `io.Closer` or a `di.Disposable`, the newest first.
+	defer c.Close()
+
+	// The container holds two storage devices, both as `PoemStorage` but under
+	// different names. As singletons, each is created once and then shared.
+	c.RegisterSingleton(func() PoemStorage { return NewNotebook() }, di.Named("notebook"))
+	c.RegisterSingleton(func() PoemStorage { return NewNapkin() }, di.Named("napkin"))
+
+	// Any `PoemStorage` requested without a name is the notebook.
+	c.Register(func() PoemStorage { return di.MustResolve[PoemStorage](c, di.Named("notebook")) })
+
+	// Every `PoemStorage` that a poem gets is wrapped in a `LoggingStorage` that
+	// reports each call to stderr. `Decorate` layers the wrapper onto the binding,
+	// so neither the notebook nor the poem knows about it.
+	//
+	// Configuration goes through the container, too. `config.Register` loads
+	// the example's `Config` from `poems.yaml`, if there is one, and from
+	// environment variables such as `POEMS_LOG_PREFIX`, and binds every
+	// setting under its key. `di.ParamNames` tells `Provide` which key the
+	// constructor's `string` parameter stands for.
+	cfg, err := config.Register(c, defaultConfig,
+		config.Optional(config.File(os.DirFS("."), "poems.yaml")),
+		config.Env("POEMS"),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	c.Provide(func(prefix string) *log.Logger { return log.New(os.Stderr, prefix, 0) },
+		di.WithLifetime(di.Singleton), di.ParamNames("log.prefix"))
+	c.Decorate(func(ps PoemStorage, l *log.Logger) PoemStorage { return NewLoggingStorage(ps, l) })
+
+	// Decorators apply in the order they are registered, so this one goes
+	// on top of the logging. It seals poems in versioned envelopes, and
+	// upgrades poems in older formats on loading. The upgrades come from
+	// migrations, which are members of a group; `NewMigrator` gets them all
+	// injected as a `[]Migration`. See `record.go`.
+	c.Provide(func() Migration { return crlfMigration }, di.Group())
+	c.Provide(NewMigrator, di.WithLifetime(di.Singleton))
+	c.Decorate(func(ps PoemStorage, m *Migrator) PoemStorage { return NewVersionedStorage(ps, m) })
+
+	// A second decorator catalogs every poem in a file system. The example
+	// keeps the files in memory; a real poet would inject `fsys.Dir`. The
+	// catalog's format depends on the `Codec` that is registered below.
+	c.RegisterSingleton(func() fsys.FS { return fsys.NewMem() })
+	c.Decorate(func(ps PoemStorage, fs fsys.FS, codec Codec, m *Migrator) PoemStorage {
+		return NewCatalogStorage(ps, fs, codec, m)
+	})
+
+	// Poems that should survive the program go to files, in the directory of
+	// the setting "storage.dir". The container calls `Init`, which creates
+	// the directory. See `files.go`.
+	c.Provide(func(cfg StorageConfig) fsys.FS {
+		if cfg.Dir == "" {
+			return fsys.NewMem()
+		}
+		return fsys.Dir(cfg.Dir)
+	}, di.Named("files"))
+	c.Provide(func(fs fsys.FS) PoemStorage { return NewFileStorage(fs) },
+		di.Named("files"), di.ParamNames("files"), di.WithLifetime(di.Singleton))
+
+	// With keys in the setting "encryption.keys", the poems in the files
+	// are encrypted. The decorator goes onto the named binding only, so the
+	// other storages keep their poems as they are. See `encrypted.go`.
+	c.Provide(func(cfg EncryptionConfig) (KeyProvider, error) { return NewStaticKeys(cfg) },
+		di.WithLifetime(di.Singleton))
+	if len(cfg.Encryption.Keys) > 0 {
+		c.Decorate(func(ps PoemStorage, keys KeyProvider) PoemStorage { return NewEncryptedStorage(ps, keys) },
+			di.Named("files"))
+	}
+
+	// The setting "compression.bindings" picks storages that compress their
+	// poems, and the algorithm for each, from the group "compressions".
+	// `NewCompressions` checks the setting. See `compressed.go`.
+	c.Provide(func() Compression { return GzipCompression{Level: gzip.DefaultCompression} },
+		di.Group(), di.Named("compressions"))
+	c.Provide(NewCompressions, di.ParamNames("", "compressions"), di.WithLifetime(di.Singleton))
+	for _, entry := range cfg.Compression.Bindings {
+		binding, algorithm, _ := strings.Cut(entry, ":")
+		c.Decorate(func(ps PoemStorage, cs *Compressions) PoemStorage { return NewCompressedStorage(ps, algorithm, cs) },
+			di.Named(binding))
+	}
+
+	// The file storage reports the usage of each tenant to a `Meter`, which
+	// alerts an `AlertSink` when a tenant nears the setting "quota.bytes".
+	// See `quota.go`.
+	c.Provide(func() AlertSink { return LogAlerts{Log: log.New(os.Stderr, "quota: ", log.LstdFlags)} })
+	c.Provide(NewMeter, di.WithLifetime(di.Singleton))
+	c.Decorate(func(ps PoemStorage, m *Meter) PoemStorage { return NewMeteredStorage(ps, m) }, di.Named("files"))
+
+	// The setting "cache.bindings" picks storages whose poems are cached,
+	// in the store of the setting "cache.store". The cache goes on last, so
+	// that it holds poems as the other decorators return them. See
+	// `cache.go` and `cached.go`.
+	c.Provide(NewCaches, di.WithLifetime(di.Singleton))
+	for _, binding := range cfg.Cache.Bindings {
+		binding := binding
+		c.Decorate(func(ps PoemStorage, cs *Caches) PoemStorage {
+			return NewCachedStorage(ps, NewCache[string, []byte](cs, "storage:"+binding))
+		}, di.Named(binding))
+	}
+
+	// The setting "storage.middleware" picks middleware of the group
+	// "storage.middleware", which sees every call to the storages that
+	// poems get and to the files before the other decorators do. It goes
+	// on last, outside the cache. See `storagemiddleware.go`.
+	c.Provide(func(l *log.Logger) StorageMiddleware { return NewTracing(l) }, di.Group(), di.Named("storage.middleware"))
+	c.Provide(func() StorageMiddleware { return Validation{} }, di.Group(), di.Named("storage.middleware"))
+	c.Provide(func() StorageMiddleware { return Authorization{} }, di.Group(), di.Named("storage.middleware"))
+	c.Provide(NewPolicyEngine, di.WithLifetime(di.Singleton))
+	c.Provide(func(e PolicyEngine, cfg PolicyConfig, l *log.Logger) StorageMiddleware { return NewPolicy(e, cfg, l) }, di.Group(), di.Named("storage.middleware"))
+	c.Provide(NewStoragePipeline, di.ParamNames("", "storage.middleware"), di.WithLifetime(di.Singleton))
+	if len(cfg.Storage.Middleware) > 0 {
+		pipeline := func(ps PoemStorage, p *StoragePipeline) PoemStorage { return p.Storage(ps) }
+		c.Decorate(pipeline)
+		c.Decorate(pipeline, di.Named("files"))
+	}
+
+	// With the setting "storage.readonly", the files reject saves, as
+	// during maintenance, and still serve loads. The guard goes on last, so
+	// that a rejected save reaches no other decorator. See `readonly.go`.
+	if cfg.Storage.ReadOnly {
+		c.Decorate(func(ps PoemStorage) PoemStorage {
+			r := NewReadOnly(ps)
+			r.SetReadOnly(true)
+			return r
+		}, di.Named("files"))
+	}
+
+	// Anthologies are published to the storage "published", and the sagas
+	// that publish them keep their state in the storage "sagas". Both are
+	// directories of the setting "storage.dir", or in memory without it. The
+	// steps come from a module of their own; see `publish.go`.
+	for _, dir := range []string{"published", "sagas"} {
+		dir := dir
+		c.Provide(func(cfg StorageConfig) PoemStorage {
+			if cfg.Dir == "" {
+				return NewFileStorage(fsys.NewMem())
+			}
+			return NewFileStorage(fsys.Dir(filepath.Join(cfg.Dir, dir)))
+		}, di.Named(dir), di.WithLifetime(di.Singleton))
+	}
+	c.Provide(func() Notifier { return LogNotifier{Log: log.New(os.Stderr, "publish: ", log.LstdFlags)} })
+
+	// For reading the catalog, `main` resolves a `CatalogStorage` that
+	// wraps no storage.
+	c.Provide(func(fs fsys.FS, codec Codec, m *Migrator) *CatalogStorage {
+		return NewCatalogStorage(nil, fs, codec, m)
+	})
+
+	// A `Poem` is built by `NewPoem()`. `Provide` looks at the parameters of
+	// `NewPoem()` and injects whatever `PoemStorage` the container currently
+	// provides. No more manual wiring!
+	c.Provide(NewPoem)
+
+	// The HTTP handler gets its storage the same way, and the renderers of
+	// the group "renderers", one per format that it serves; see `server.go`.
+	// The first renderer is the default for clients that accept anything.
+	c.Provide(func() Renderer { return PlainRenderer{} }, di.Group(), di.Named("renderers"))
+	c.Provide(func(t TemplateRenderer) Renderer { return NewHTMLRenderer(t) }, di.Group(), di.Named("renderers"))
+	c.Provide(func() Renderer { return JSONRenderer{} }, di.Group(), di.Named("renderers"))
+	c.Provide(NewPoemHandler, di.ParamNames("", "renderers"))
+
+	// Around the handler goes a pipeline of middleware from the group
+	// "http.middleware". The setting "http.middleware" decides which of them
+	// run, and in which order; see `middleware.go`.
+	c.Provide(func() *log.Logger { return log.New(os.Stderr, "http: ", log.LstdFlags) },
+		di.Named("http"), di.WithLifetime(di.Singleton))
+	c.Provide(func(l *log.Logger) Middleware { return NewRecovery(l) }, di.Group(), di.Named("http.middleware"), di.ParamNames("http"))
+	c.Provide(func(l *log.Logger) Middleware { return NewRequestLog(l) }, di.Group(), di.Named("http.middleware"), di.ParamNames("http"))
+	c.Provide(func(cfg CORSConfig) Middleware { return NewCORS(cfg) }, di.Group(), di.Named("http.middleware"))
+	c.Provide(func() Middleware { return Gzip{} }, di.Group(), di.Named("http.middleware"))
+	c.Provide(func() Middleware { return NewRequestScope(c) }, di.Group(), di.Named("http.middleware"))
+	c.Provide(func(s IdempotencyStore) Middleware { return NewIdempotency(s) }, di.Group(), di.Named("http.middleware"))
+	c.Provide(NewPipeline, di.ParamNames("", "http.middleware"), di.WithLifetime(di.Singleton))
+	c.Provide(NewRouter)
+
+	// Visitors have sessions, which live in the scope of their requests.
+	// The `RequestScope` middleware registers each request in its scope; the
+	// root container only has a placeholder that fails. See `session.go`.
+	c.Provide(NewSessionStore, di.WithLifetime(di.Singleton))
+	c.Provide(func() (*http.Request, error) { return nil, errNoRequest }, di.WithLifetime(di.Scoped))
+	c.Provide(LoadSession, di.WithLifetime(di.Scoped))
+	c.Provide(NewFavoritesHandler)
+
+	// Retried requests with the same `Idempotency-Key` get the response of
+	// the first one, from memory or from Redis. The Redis connection is
+	// lazy, so it is only dialed if the store is "redis". See
+	// `idempotency.go` and `redis.go`.
+	c.Provide(func(cfg RedisConfig) Redis { return NewRedisConn(cfg) }, di.WithLifetime(di.Singleton))
+	c.Provide(NewIdempotencyStore, di.WithLifetime(di.Singleton))
+
+	// Instances that share storage coordinate with the locks of a `Locker`,
+	// which the setting "lock.kind" selects. See `locks.go`.
+	c.Provide(NewLocker, di.WithLifetime(di.Singleton))
+
+	// The server runs the jobs of the group "jobs" in the background, on
+	// one instance at a time, which the `LeaderElector` of the setting
+	// "jobs.leader" elects. The scheduler hooks into the container's
+	// lifecycle. See `jobs.go` and `leader.go`.
+	c.Provide(func() *log.Logger { return log.New(os.Stderr, "jobs: ", log.LstdFlags) },
+		di.Named("jobs"), di.WithLifetime(di.Singleton))
+	c.Provide(NewLeaderElector, di.WithLifetime(di.Singleton))
+	c.Provide(func(ps PoemStorage, cfg JobsConfig, l *log.Logger) Job { return ScrubJob(ps, cfg.Scrub, l) },
+		di.Group(), di.Named("jobs"), di.ParamNames("files", "", "jobs"))
+	c.Provide(NewScheduler, di.ParamNames("", "", "jobs", "jobs"), di.WithLifetime(di.Singleton))
+
+	// An `Archiver` backs up the poems in the files, and restores them. The
+	// leader does so every "jobs.backup" if "jobs.backupdir" is set, and
+	// `-backup` and `-restore` do it once. See `backup.go`.
+	c.Provide(NewArchiver, di.ParamNames("files"))
+	c.Provide(func(ps PoemStorage, cfg JobsConfig, l *log.Logger) Job {
+		if cfg.BackupDir == "" {
+			return Job{Name: "backup"}
+		}
+		return BackupJob(ps, cfg.BackupDir, cfg.Backup, l)
+	}, di.Group(), di.Named("jobs"), di.ParamNames("files", "", "jobs"))
+
+	// With the setting "standby.storage", the leader brings the storage of
+	// that name up to date with the files every "standby.every". The
+	// standby is a binding like the others, such as "sqlite" or "s3". See
+	// `standby.go`.
+	if cfg.Standby.Storage != "" {
+		c.Provide(func(primary, standby PoemStorage, cfg StandbyConfig, l *log.Logger) (Job, error) {
+			if cfg.Storage == "files" {
+				return Job{}, errors.New("the standby of the files cannot be the files")
+			}
+			return StandbyJob(NewStandby(primary, standby), cfg.Every, cfg.Budget, l), nil
+		}, di.Group(), di.Named("jobs"), di.ParamNames("files", cfg.Standby.Storage, "", "jobs"))
+	}
+
+	// An `Exporter` writes the poems in the files in a format of the
+	// `FormatRegistry`, for `-export`, and reads them back, for `-import`.
+	// Each format is a member of the group "formatters", so a module adds
+	// one by being installed. See `export.go`.
+	if err := c.Install(ExportModule, FormatsModule); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Poems worth keeping go to several storages at once. `NewFanOut` takes
+	// `...PoemStorage`, and `Provide` fills the variadic parameter with the
+	// members of the group "copies". See `fanout.go`.
+	c.Provide(func() PoemStorage { return NewNotebook() }, di.Group(), di.Named("copies"))
+	c.Provide(func() PoemStorage { return NewNapkin() }, di.Group(), di.Named("copies"))
+	c.Provide(NewFanOut, di.ParamNames("copies"))
+
+	// Poems that must not get lost go to the replicas of the group
+	// "replicas", and a `Consistency` from the setting
+	// "replication.consistency" decides how many of them must agree. See
+	// `replicated.go`.
+	c.Provide(func(cfg ReplicationConfig) (Consistency, error) {
+		if cs, ok := consistencies[cfg.Consistency]; ok {
+			return cs, nil
+		}
+		return nil, fmt.Errorf("unknown consistency %q (want one, quorum, or all)", cfg.Consistency)
+	})
+	for i := 0; i < 3; i++ {
+		c.Provide(func() PoemStorage { return NewNotebook() }, di.Group(), di.Named("replicas"))
+	}
+	c.Provide(NewReplicatedStorage, di.ParamNames("", "replicas"), di.WithLifetime(di.Singleton))
+
+	// Poems spread over the shards of the group "shards", by the hash of
+	// their names: "sharding.shards" directories of "storage.dir", or
+	// notebooks without it. The binding "sharded" is the `ShardedStorage`,
+	// which `-rebalance` rebalances. See `sharded.go`.
+	for i := 0; i < cfg.Sharding.Shards; i++ {
+		dir := filepath.Join("shards", strconv.Itoa(i))
+		c.Provide(func(cfg StorageConfig) PoemStorage {
+			if cfg.Dir == "" {
+				return NewNotebook()
+			}
+			return NewFileStorage(fsys.Dir(filepath.Join(cfg.Dir, dir)))
+		}, di.Group(), di.Named("shards"))
+	}
+	c.Provide(NewShardedStorage, di.ParamNames("shards"), di.WithLifetime(di.Singleton))
+	c.Provide(func(s *ShardedStorage) PoemStorage { return s }, di.Named("sharded"))
+
+	// With the settings "bluegreen.blue" and "bluegreen.green", the binding
+	// "bluegreen" splits poems between the two storages of those names, and
+	// sends "bluegreen.percent" percent of them to green. See `bluegreen.go`.
+	if cfg.BlueGreen.Blue != "" {
+		c.Provide(func(blue, green PoemStorage, cfg BlueGreenConfig) (*BlueGreen, error) {
+			if cfg.Green == "" {
+				// Without a name, green would be the unnamed storage.
+				return nil, errors.New("a blue/green split needs the setting bluegreen.green")
+			}
+			if cfg.Blue == cfg.Green {
+				return nil, fmt.Errorf("blue and green are both %q", cfg.Blue)
+			}
+			if cfg.Percent < 0 || cfg.Percent > 100 {
+				return nil, fmt.Errorf("bluegreen.percent is %d, want 0 to 100", cfg.Percent)
+			}
+			return NewBlueGreen(blue, green, cfg.Percent), nil
+		}, di.ParamNames(cfg.BlueGreen.Blue, cfg.BlueGreen.Green, ""), di.WithLifetime(di.Singleton))
+		c.Provide(func(b *BlueGreen) PoemStorage { return b }, di.Named("bluegreen"))
+	}
+
+	// With the settings "shadow.primary" and "shadow.candidate", the
+	// binding "shadow" serves poems from the storage of the first name and
+	// mirrors them to the storage of the second one, which it validates.
+	// The storage log reports where the two differ. The mirroring goroutine
+	// stops with the container. See `shadow.go`.
+	if cfg.Shadow.Primary != "" {
+		c.Provide(func(primary, candidate PoemStorage, cfg ShadowConfig, lc di.Lifecycle, l *log.Logger) (*Shadow, error) {
+			if cfg.Primary == cfg.Candidate {
+				return nil, fmt.Errorf("primary and candidate are both %q", cfg.Primary)
+			}
+			if cfg.Queue < 1 {
+				return nil, fmt.Errorf("shadow.queue is %d, want at least 1", cfg.Queue)
+			}
+			component := lifecycle.New().Component("shadow")
+			s := NewShadow(primary, candidate, cfg.Queue, component)
+			s.OnDivergence = func(name string, _, _ []byte) {
+				l.Printf("shadow: %q differs on %q", name, cfg.Candidate)
+			}
+			lc.Append(di.Hook{OnStop: func(context.Context) error {
+				component.Stop()
+				s.Close()
+				return nil
+			}})
+			return s, nil
+		}, di.ParamNames(cfg.Shadow.Primary, cfg.Shadow.Candidate, "", "", ""), di.WithLifetime(di.Singleton))
+		c.Provide(func(s *Shadow) PoemStorage { return s }, di.Named("shadow"))
+	}
+
+	// Poems that must be written somewhere go to the first storage of the
+	// group "fallbacks" that takes them: the files, or else a notebook. The
+	// storage log reports failovers. See `fallback.go`.
+	c.Provide(func(ps PoemStorage) PoemStorage { return ps }, di.Group(), di.Named("fallbacks"), di.ParamNames("files"))
+	c.Provide(func() PoemStorage { return NewNotebook() }, di.Group(), di.Named("fallbacks"))
+	c.Provide(func(l *log.Logger, storages ...PoemStorage) *FallbackStorage {
+		f := NewFallbackStorage(storages...)
+		f.OnFailover = func(e Failover) {
+			l.Printf("%s %q: %s failed, trying %q: %v", e.Op, e.Name, e.From, e.To, e.Err)
+		}
+		return f
+	}, di.ParamNames("", "fallbacks"), di.WithLifetime(di.Singleton))
+
+	// An indexed storage and its index need each other. A proxy breaks the
+	// cycle. See `index.go`.
+	c.Provide(func() PoemStorage { return NewNotebook() }, di.Named("unindexed"), di.WithLifetime(di.Singleton))
+	c.Provide(func(ps PoemStorage, idx *Index) PoemStorage { return NewIndexedStorage(ps, idx) },
+		di.Named("indexed"), di.ParamNames("unindexed"), di.WithLifetime(di.Singleton))
+	c.Provide(NewIndex, di.ParamNames("indexed"), di.WithLifetime(di.Singleton))
+	di.Proxy(c, NewStorageProxy, di.Named("indexed"))
+
+	// Want to see what the container has wired up? Run the example with `-graph`
+	// and feed the output to Graphviz: `go run ./cmd/poems -graph | dot -Tsvg > poems.svg`
+	graph := flag.Bool("graph", false, "print the dependency graph in DOT format and exit")
+
+	// The container is safe for concurrent use, which `go test -race ./...`
+	// checks in the tests of package di. To watch the example's own wiring
+	// under load, `go run -race ./cmd/poems -stress 8` resolves and rewires
+	// from eight goroutines; see `stress.go`.
+	workers := flag.Int("stress", 0, "resolve concurrently from `n` goroutines and exit")
+
+	// Drafts go to a different storage depending on where the example runs.
+	// In development, a napkin is good enough; in production, drafts deserve
+	// the notebook. The profile comes from `-profile` or `$POEMS_PROFILE`.
+	profile := flag.String("profile", envOr("POEMS_PROFILE", "dev"), "wiring `profile`: dev or prod")
+	codecName := flag.String("codec", "json", "`format` of the poem catalog: json, protobuf or msgpack")
+
+	// Poems can go in bulk, too: `-delete prefix` deletes the notebook's poems
+	// whose names start with the prefix, `-purge tenant` those of a tenant.
+	// Both ask for confirmation unless `-yes` is given; see `bulk.go`.
+	deletePrefix := flag.String("delete", "", "delete the notebook's poems whose names start with `prefix`")
+	purge := flag.String("purge", "", "delete the notebook's poems of `tenant`")
+	yes := flag.Bool("yes", false, "do not ask for confirmation of -delete and -purge")
+
+	// `-backup poems.tar.gz` writes all poems in the files to an archive,
+	// and `-restore poems.tar.gz` saves the poems of an archive there.
+	backup := flag.String("backup", "", "back up the poems in the files to the archive `file` and exit")
+	restore := flag.String("restore", "", "restore the poems in the archive `file` to the files and exit")
+	// `-export poems.md -format markdown` writes all poems in the files to
+	// a file, and `-import` reads them back. See `export.go`.
+	export := flag.String("export", "", "export the poems in the files to `file` and exit")
+	imp := flag.String("import", "", "import the poems in `file` into the files and exit")
+	format := flag.String("format", "json", "`format` of -export and -import: json, markdown or text")
+	rebalance := flag.Bool("rebalance", false, "move the poems of the shards to their shards and exit")
+
+	// With `-serve :8080`, the example keeps running and serves its poems,
+	// as in `curl -r 0-9 localhost:8080/poems/My%20second%20poem`.
+	serve := flag.String("serve", "", "serve poems over HTTP on `addr` after writing them")
+	remote := flag.String("remote", "", "also save a poem to the JSON-RPC endpoint at `url`")
+	publish := flag.String("publish", "", "publish the poems in the files as an anthology with this `title`")
+	flag.Parse()
+
+	codec, ok := codecs[*codecName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown codec %q\n", *codecName)
+		os.Exit(2)
+	}
+	c.Register(func() Codec { return codec })
+
+	// The web UI's templates come from the directory of the setting
+	// "http.templates", or from the program itself; see `templates.go`.
+	c.Provide(func(cfg HTTPConfig) fs.FS {
+		if cfg.Templates == "" {
+			return embeddedTemplates()
+		}
+		return os.DirFS(cfg.Templates)
+	}, di.Named("templates"))
+
+	// `di.Profile` wraps definitions that only apply under one profile. Both
+	// profiles bind the drafts storage, but `Install` only sees the active one,
+	// so they do not conflict. In the dev profile, the templates also reload
+	// for every page. The style sheet and other static files come from a
+	// module of their own; see `assets.go`.
+	if *profile != "dev" && *profile != "prod" {
+		fmt.Fprintf(os.Stderr, "unknown profile %q\n", *profile)
+		os.Exit(2)
+	}
+	c.SetProfile(*profile)
+	if err := c.Install(
+		di.Profile("dev",
+			di.Provide(func() PoemStorage { return NewNapkin() }, di.Named("drafts"), di.WithLifetime(di.Singleton)),
+			di.Provide(func(files fs.FS, funcs []template.FuncMap) (TemplateRenderer, error) {
+				return NewHTMLTemplates(files, true, funcs...)
+			}, di.ParamNames("templates", "templates.funcs"), di.WithLifetime(di.Singleton)),
+		),
+		di.Profile("prod",
+			di.Provide(func() PoemStorage { return NewNotebook() }, di.Named("drafts"), di.WithLifetime(di.Singleton)),
+			di.Provide(func(files fs.FS, funcs []template.FuncMap) (TemplateRenderer, error) {
+				return NewHTMLTemplates(files, false, funcs...)
+			}, di.ParamNames("templates", "templates.funcs"), di.WithLifetime(di.Singleton)),
+		),
+		AssetsModule,
+		PublishModule,
+	); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// The GraphQL and JSON-RPC endpoints are other ways into the file
+	// storage. They share the use cases, which they send as messages to a
+	// `Dispatcher`, and each is a module that `main` installs if its
+	// setting asks for it; see `library.go`, `graphql.go`, and
+	// `jsonrpc.go`.
+	c.Provide(func() *Dispatcher { return NewDispatcher(c) }, di.WithLifetime(di.Singleton))
+	endpoints := []di.Definition{UseCasesModule}
+	if cfg.HTTP.GraphQL {
+		endpoints = append(endpoints, GraphQLModule)
+	}
+	if cfg.HTTP.RPC {
+		endpoints = append(endpoints, RPCModule)
+	}
+	if err := c.Install(endpoints...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// If the setting "storage.sqlite" names a database, poems can go there,
+	// too. The container opens the database, the storage migrates its
+	// schema in `Init`, and `Close` closes the database. See `sqlite.go`.
+	if cfg.Storage.SQLite != "" {
+		c.Provide(func(cfg StorageConfig) (*sql.DB, error) { return sql.Open(cfg.Driver, cfg.SQLite) },
+			di.WithLifetime(di.Singleton))
+		c.Provide(func(db *sql.DB, l Locker) PoemStorage { return NewSQLiteStorage(db, l) },
+			di.Named("sqlite"), di.WithLifetime(di.Singleton))
+	}
+
+	// If the setting "storage.s3.bucket" names a bucket, poems can go to an
+	// S3-compatible object store. `Init` checks the bucket; see
+	// `objects.go`.
+	if cfg.Storage.S3.Bucket != "" {
+		c.Provide(func(cfg S3Config) PoemStorage { return NewObjectStorage(cfg, http.DefaultClient) },
+			di.Named("s3"), di.WithLifetime(di.Singleton))
+	}
+
+	// With "storage.redis.enabled", poems can go to Redis, over the same
+	// connection as the idempotency keys. See `redis.go`.
+	if cfg.Storage.Redis.Enabled {
+		c.Provide(func(r Redis, cfg RedisStorageConfig) PoemStorage { return NewRedisStorage(r, cfg.TTL) },
+			di.Named("redis"), di.WithLifetime(di.Singleton))
+	}
+
+	// With `-remote`, a poem goes to the storage of another instance of
+	// the example, which serves it with JSON-RPC.
+	if *remote != "" {
+		c.Provide(func() PoemStorage { return NewRemoteStorage(NewRPCClient(*remote, http.DefaultClient)) },
+			di.Named("remote"), di.WithLifetime(di.Singleton))
+	}
+	if *graph {
+		c.Graph().WriteDOT(os.Stdout)
+		return
+	}
+	if *workers > 0 {
+		if err := stress(*workers, 100); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d workers passed\n", *workers)
+		return
+	}
+
+	if *export != "" || *imp != "" {
+		if err := exportOrImport(di.MustResolve[*Exporter](c), *export, *imp, *format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *rebalance {
+		s, err := di.Resolve[*ShardedStorage](c)
+		if err == nil {
+			err = rebalanceShards(context.Background(), s)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *backup != "" || *restore != "" {
+		if err := backupOrRestore(di.MustResolve[*Archiver](c), *backup, *restore); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Before any poem is written, `Build` checks the wiring as a whole: every
+	// dependency must have a provider, there must be no cycles, and all
+	// singletons must construct without error. It reports all problems at once
+	// rather than one at a time.
+	if err := c.Build(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// First, write a poem into a notebook. `di.MustResolve` is generic, so the
+	// compiler knows that it returns a `*Poem`. The demo does not give up on
+	// slow storages, so its context is never cancelled.
+	ctx := context.Background()
+	poem := di.MustResolve[*Poem](c)
+	exitOn(poem.Save(ctx, "My first poem"))
+
+	// Resolve a new poem object to prove that the notebook storage works.
+	poem = di.MustResolve[*Poem](c)
+	exitOn(poem.Load(ctx, "My first poem"))
+	fmt.Println(poem)
+
+	// Now we do the same with a napkin as storage. Registering a new `PoemStorage`
+	// provider rewires every `Poem` that the container builds from now on.
+	c.Register(func() PoemStorage { return di.MustResolve[PoemStorage](c, di.Named("napkin")) })
+	poem = di.MustResolve[*Poem](c)
+	// Note the poem still just uses `Save` and `Load`. "Notebook? Napkin? I don't care."
+	exitOn(poem.Save(ctx, "My second poem"))
+	poem = di.MustResolve[*Poem](c)
+	exitOn(poem.Load(ctx, "My second poem"))
+	fmt.Println(poem)
+
+	// Finally, a draft. The poem that writes it does not know which profile
+	// is active; only the wiring in `main` does.
+	drafts := di.MustResolve[PoemStorage](c, di.Named("drafts"))
+	draft := NewPoem(drafts)
+	exitOn(draft.Save(ctx, "My draft"))
+	exitOn(draft.Load(ctx, "My draft"))
+	fmt.Println(draft)
+
+	// A poem with a hot-swappable storage starts out on a napkin. When the
+	// poet gets home, `Replace` switches the storage to a notebook, and the
+	// same poem object writes into the notebook from then on.
+	c.Provide(func() PoemStorage { return NewNapkin() }, di.Named("live"), di.WithLifetime(di.Singleton))
+	c.Provide(NewHotStorage, di.ParamNames("live"))
+	live := di.MustResolve[*HotStorage](c)
+	poem = NewPoem(live)
+	exitOn(poem.Save(ctx, "My live poem"))
+	fmt.Println("My live poem is on a", live.Type())
+	if err := c.Replace(func() PoemStorage { return NewNotebook() }, di.Named("live")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	exitOn(poem.Save(ctx, "My live poem"))
+	fmt.Println("My live poem is now in a", live.Type())
+
+	// A fan-out saves a poem into every storage of its group.
+	copies := di.MustResolve[*FanOut](c)
+	exitOn(NewPoem(copies).Save(ctx, "My copied poem"))
+	fmt.Println("My copied poem is in a", copies.Type())
+
+	// A replicated poem survives the loss of a replica.
+	replicated := di.MustResolve[*ReplicatedStorage](c)
+	exitOn(NewPoem(replicated).Save(ctx, "My replicated poem"))
+	fmt.Println("My replicated poem is in a", replicated.Type())
+
+	// A poem with a fallback is written even if the files are not.
+	fallback := di.MustResolve[*FallbackStorage](c)
+	exitOn(NewPoem(fallback).Save(ctx, "My failsafe poem"))
+	fmt.Println("My failsafe poem is in a", fallback.Type())
+
+	// With a blue/green split, a poem goes to one of the two storages.
+	if cfg.BlueGreen.Blue != "" {
+		bg := di.MustResolve[*BlueGreen](c)
+		exitOn(NewPoem(bg).Save(ctx, "My blue-green poem"))
+		fmt.Printf("My blue-green poem is in a %s, %d%% green\n", bg.Type(), bg.Percent())
+	}
+
+	// A poem in a file is still there after the program exits.
+	// Unless the files are read-only.
+	filed := di.MustResolve[PoemStorage](c, di.Named("files"))
+	var ro *ReadOnlyError
+	if err := NewPoem(filed).Save(ctx, "My filed poem"); errors.As(err, &ro) {
+		fmt.Println("My filed poem is not filed:", err)
+	} else {
+		exitOn(err)
+		size, err := PoemSize(ctx, filed, "My filed poem")
+		exitOn(err)
+		fmt.Printf("My filed poem has %d bytes in a %s\n", size, filed.Type())
+	}
+	if cfg.Storage.SQLite != "" {
+		tabled := di.MustResolve[PoemStorage](c, di.Named("sqlite"))
+		exitOn(NewPoem(tabled).Save(ctx, "My tabled poem"))
+		size, err := PoemSize(ctx, tabled, "My tabled poem")
+		exitOn(err)
+		fmt.Printf("My tabled poem has %d bytes in an %s\n", size, tabled.Type())
+	}
+	if cfg.Storage.S3.Bucket != "" {
+		stored := di.MustResolve[PoemStorage](c, di.Named("s3"))
+		exitOn(NewPoem(stored).Save(ctx, "My stored poem"))
+		size, err := PoemSize(ctx, stored, "My stored poem")
+		exitOn(err)
+		fmt.Printf("My stored poem has %d bytes in an %s\n", size, stored.Type())
+	}
+	if cfg.Storage.Redis.Enabled {
+		// A poem in Redis can expire, which only some storages can do. The
+		// poem uses the storage as a `PoemStorage`, and `SaveFor` finds the
+		// capability.
+		fleeting := di.MustResolve[PoemStorage](c, di.Named("redis"))
+		if err := SaveFor(ctx, fleeting, "My fleeting poem", []byte("Here today, gone tomorrow."), 24*time.Hour); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		ttl, _ := TTL(ctx, fleeting, "My fleeting poem")
+		fmt.Printf("My fleeting poem stays in a %s for %v\n", fleeting.Type(), ttl.Round(time.Hour))
+	}
+	if *remote != "" {
+		far := di.MustResolve[PoemStorage](c, di.Named("remote"))
+		exitOn(NewPoem(far).Save(ctx, "My remote poem"))
+		size, err := PoemSize(ctx, far, "My remote poem")
+		exitOn(err)
+		fmt.Printf("My remote poem has %d bytes in a %s\n", size, far.Type())
+	}
+
+	// An indexed storage finds poems by their words.
+	indexed := di.MustResolve[PoemStorage](c, di.Named("indexed"))
+	exitOn(NewPoem(indexed).Save(ctx, "My indexed poem"))
+	index := di.MustResolve[*Index](c)
+	exitOn(index.Rebuild(ctx, "My indexed poem"))
+	fmt.Println("Poems with \"poem\":", index.Lookup("poem"))
+
+	// The catalog remembers where each poem went. The container calls
+	// `Init` on the `CatalogStorage` that it builds, which checks that every
+	// entry can be read before `main` reads any.
+	catalog, err := di.Resolve[*CatalogStorage](c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, name := range []string{"My first poem", "My second poem"} {
+		m, err := catalog.Meta(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		fmt.Printf("%s: %d bytes in a %s\n", m.Name, m.Size, m.Storage)
+	}
+
+	// With `-publish`, the poems in the files go out as an anthology.
+	if *publish != "" {
+		s, err := di.MustResolve[*Publisher](c).Publish(ctx, *publish)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Anthology %q: %s, with %s poems\n", *publish, s.Status, s.Data["poems"])
+	}
+
+	// Bulk deletion works on the bare notebook, as the decorators only
+	// apply to the unnamed `PoemStorage`.
+	if *deletePrefix != "" || *purge != "" {
+		notebook := di.MustResolve[PoemStorage](c, di.Named("notebook")).(BulkDeleter)
+		purger := NewPurger(notebook, LogAuditor{Log: log.New(os.Stderr, "audit: ", log.LstdFlags)})
+		if err := bulkDelete(purger, *deletePrefix, *purge, *yes); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *serve != "" {
+		// `Start` runs the hooks of the components built so far, which
+		// starts the jobs.
+		handler := di.MustResolve[http.Handler](c)
+		di.MustResolve[*Scheduler](c)
+		if err := c.Start(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// On an interrupt, the server finishes its requests, and `Stop`
+		// stops the jobs and resigns the leadership.
+		interrupted := make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+		srv := &http.Server{Addr: *serve, Handler: handler}
+		failed := make(chan error, 1)
+		go func() { failed <- srv.ListenAndServe() }()
+		select {
+		case err := <-failed:
+			fmt.Fprintln(os.Stderr, err)
+			c.Stop(context.Background())
+			os.Exit(1)
+		case <-interrupted:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if err := c.Stop(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// `exitOn` ends the example with `err`, unless it is nil.
+func exitOn(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// `envOr` returns the environment variable `name`, or `def` if it is not set.
+func envOr(name, def string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return def
+}
+
+/* As usual, you can get the code from GitHub. The example lives in the `cmd/poems` directory, next to the `di` package that it uses for wiring.
+
+    git clone https://github.com/appliedgo/di
+	cd di
+	go run ./cmd/poems
+
+The wiring part of this example is available as a small library, too. Import `github.com/appliedgo/di` and use `di.New()` to create a container, `Register` to add providers, and `Resolve` or `MustResolve` to get fully wired values.
+
+## Conclusion
+
+Outside the world of poetry, dependency injection is a useful tool for decoupling logical entities, especially in multi-layered architectures as we have seen above.
+
+Besides its benefits for layered architectures, dependency injection can also help with testing. Instead of reading a poem from a real notebook, a test can read from a notebook mockup that either is easier to set up, or delivers consistent test data, or both.
+
+
+## Further reading
+
+I definitely recommend reading the aforementioned [article about the Clean Architecture](http://blog.8thlight.com/uncle-bob/2012/08/13/the-clean-architecture.html) by [Robert C. Martin, a.k.a. "Uncle Bob"](https://de.wikipedia.org/wiki/Robert_Cecil_Martin).
+
+The excellent article [Applying The Clean Architecture to Go applications](http://manuel.kiessling.net/2012/09/28/applying-the-clean-architecture-to-go-applications/) is a deep dive into implementing DI in Go that builds upon all four layers of the Clean Architecture. This is a great opportunity to see how entities, use cases, interfaces, and frameworks (speaking in Clean Architecture lingo) are utilized to build a (toy) shop system.
+
+Dependency Injection can be seen as one specific form of *loose coupling*, a term referring to interconnecting components without making them too dependent on each other. Another option for loose coupling in Go (besides interfaces) is to use *higher-order functions*. I found a quick and easy intro to this topic in the blog article [Loose Coupling in Go lang](https://blog.8thlight.com/javier-saldana/2015/02/06/loose-coupling-in-go-lang.html).
+*/
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ### Metadata
+//
+// A poem is more than its words: it has an author, it was written at some
+// point and revised at another, and poets tag their poems to find them
+// again. A `Poem` keeps its `Metadata` next to its content, and saves and
+// loads both.
+//
+// Storages that keep metadata with their poems implement `Annotator`.
+// Metadata belongs to a poem: saving it for a poem that is not there fails
+// with `ErrNoPoem`, a plain `Save` of the poem keeps it, and deleting the
+// poem deletes it. Poems saved before there was metadata, or by callers
+// that know nothing of it, load with the zero `Metadata`.
+//
+// Metadata cannot be emulated, so `SaveMeta` fails with `ErrNoMetadata`
+// for storages that are not `Annotator`s, and `LoadMeta` returns the zero
+// `Metadata` for their poems. Decorators that work on one storage pass
+// metadata through, as they pass names. They neither encrypt nor compress
+// it. Decorators over several storages would have to keep their copies of
+// the metadata in agreement, as they do with poems, and do not keep it.
+
+// `Metadata` describes a poem.
+type Metadata struct {
+	Author  string    `json:"author,omitempty"`
+	Created time.Time `json:"created"` // When the poem was first saved.
+	Updated time.Time `json:"updated"` // When the poem was last saved.
+	Tags    []string  `json:"tags,omitempty"`
+}
+
+// An `Annotator` is a storage that keeps metadata with its poems.
+type Annotator interface {
+	// `SaveMeta` replaces the metadata of the poem `name`. It returns
+	// `ErrNoPoem` if there is no such poem.
+	SaveMeta(ctx context.Context, name string, meta Metadata) error
+	// `LoadMeta` returns the metadata of the poem `name`, which is zero
+	// if none was saved. It returns `ErrNoPoem` if there is no such poem.
+	LoadMeta(ctx context.Context, name string) (Metadata, error)
+}
+
+// `ErrNoMetadata` is returned for storages that cannot keep metadata.
+var ErrNoMetadata = errors.New("storage cannot keep metadata")
+
+// `SaveMeta` saves the metadata of the poem `name` in `ps`, if `ps` is an
+// `Annotator`.
+func SaveMeta(ctx context.Context, ps PoemStorage, name string, meta Metadata) error {
+	if a, ok := ps.(Annotator); ok {
+		return a.SaveMeta(ctx, name, meta)
+	}
+	return fmt.Errorf("save metadata of %q in %s: %w", name, ps.Type(), ErrNoMetadata)
+}
+
+// `LoadMeta` returns the metadata of the poem `name` in `ps`. Poems in
+// storages that are not `Annotator`s have none.
+func LoadMeta(ctx context.Context, ps PoemStorage, name string) (Metadata, error) {
+	if a, ok := ps.(Annotator); ok {
+		return a.LoadMeta(ctx, name)
+	}
+	exists, err := Exists(ctx, ps, name)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if !exists {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, ErrNoPoem)
+	}
+	return Metadata{}, nil
+}
+
+// `clone` returns a copy of `m` that shares no tags with it.
+func (m Metadata) clone() Metadata {
+	if m.Tags != nil {
+		m.Tags = append([]string{}, m.Tags...)
+	}
+	return m
+}
+
+// `equal` reports whether `m` and `other` describe a poem alike. Times
+// are equal if they are the same instant.
+func (m Metadata) equal(other Metadata) bool {
+	if m.Author != other.Author || !m.Created.Equal(other.Created) || !m.Updated.Equal(other.Updated) ||
+		len(m.Tags) != len(other.Tags) {
+		return false
+	}
+	for i := range m.Tags {
+		if m.Tags[i] != other.Tags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// The backends other than the notebook and the napkin keep metadata as
+// JSON, which `encodeMeta` and `decodeMeta` write and read. The empty
+// column of a row from before metadata decodes as the zero `Metadata`.
+
+func encodeMeta(meta Metadata) []byte {
+	data, _ := json.Marshal(meta) // Cannot fail for a `Metadata`.
+	return data
+}
+
+func decodeMeta(name string, data []byte) (Metadata, error) {
+	var meta Metadata
+	if len(data) == 0 {
+		return meta, nil
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return Metadata{}, fmt.Errorf("metadata of %q: %w", name, err)
+	}
+	return meta, nil
+}
+
+// #### The backends
+//
+// The `Notebook` notes the metadata of each poem in the margin, and the
+// `Napkin` scribbles it next to its one poem, which is the poem of every
+// name.
+
+func (n *Notebook) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.poems[name]; !ok {
+		return fmt.Errorf("save metadata of %q: %w", name, ErrNoPoem)
+	}
+	n.meta[name] = meta.clone()
+	return nil
+}
+
+func (n *Notebook) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return Metadata{}, err
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if _, ok := n.poems[name]; !ok {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, ErrNoPoem)
+	}
+	return n.meta[name].clone(), nil
+}
+
+func (n *Napkin) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.meta = meta.clone()
+	return nil
+}
+
+func (n *Napkin) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return Metadata{}, err
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.meta.clone(), nil
+}
+
+// The `FileStorage` writes the metadata of a poem to a file next to the
+// poem's file, with the extension ".meta", the way it writes poems. `List`
+// lists poem files only, and `Delete` removes both files.
+
+// `metaFile` returns the name of the metadata file of the poem `name`.
+func (s *FileStorage) metaFile(name string) string {
+	return strings.TrimSuffix(s.file(name), poemExt) + metaExt
+}
+
+func (s *FileStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	exists, err := s.Exists(ctx, name)
+	if err != nil {
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	if !exists {
+		return fmt.Errorf("save metadata of %q: %w", name, ErrNoPoem)
+	}
+	file := s.metaFile(name)
+	temp := s.temp(file)
+	if err := s.fs.WriteFile(temp, encodeMeta(meta), 0o644); err != nil {
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	if err := s.fs.Rename(temp, file); err != nil {
+		s.fs.Remove(temp)
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	return nil
+}
+
+func (s *FileStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	exists, err := s.Exists(ctx, name)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, err)
+	}
+	if !exists {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, ErrNoPoem)
+	}
+	data, err := fs.ReadFile(s.fs, s.metaFile(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Metadata{}, nil
+	}
+	if err != nil {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, err)
+	}
+	return decodeMeta(name, data)
+}
+
+// The `SQLiteStorage` keeps metadata in a column of the poem's row, since
+// migration 3. Rows from before have an empty column.
+
+func (s *SQLiteStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	res, err := s.db.ExecContext(ctx, sqlSaveMeta, string(encodeMeta(meta)), name)
+	if err != nil {
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("save metadata of %q: %w", name, ErrNoPoem)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, sqlLoadMeta, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, ErrNoPoem)
+	}
+	if err != nil {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, err)
+	}
+	return decodeMeta(name, []byte(data))
+}
+
+// The `RedisStorage` keeps metadata under a key of its own, which expires
+// with the poem: `SaveMeta` gives it the time to live of the poem, and
+// every save of the poem gives it the poem's new one.
+
+// `redisMetaPrefix` starts the keys of metadata.
+const redisMetaPrefix = "poems:meta:"
+
+func (s *RedisStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	ttl, err := s.TTL(ctx, name)
+	if err != nil {
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	args := []string{"SET", redisMetaPrefix + name, string(encodeMeta(meta))}
+	if ms := ttl.Milliseconds(); ms > 0 {
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	if _, err := s.redis.Do(ctx, args...); err != nil {
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	return nil
+}
+
+func (s *RedisStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	if _, err := s.Size(ctx, name); err != nil {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, err)
+	}
+	reply, err := s.redis.Do(ctx, "GET", redisMetaPrefix+name)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, err)
+	}
+	data, _ := reply.(string)
+	return decodeMeta(name, []byte(data))
+}
+
+// `expireMeta` gives the metadata of the poem `name` a time to live of
+// `ms` milliseconds, or none if it is 0.
+func (s *RedisStorage) expireMeta(ctx context.Context, name string, ms int64) error {
+	args := []string{"PERSIST", redisMetaPrefix + name}
+	if ms > 0 {
+		args = []string{"PEXPIRE", redisMetaPrefix + name, strconv.FormatInt(ms, 10)}
+	}
+	_, err := s.redis.Do(ctx, args...)
+	return err
+}
+
+// The `ObjectStorage` writes the metadata of a poem to an object next to
+// the poem's, with the extension ".meta".
+
+// `metaKey` returns the object key of the metadata of the poem `name`.
+func (s *ObjectStorage) metaKey(name string) string {
+	return strings.TrimSuffix(s.key(name), poemExt) + metaExt
+}
+
+func (s *ObjectStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	if _, err := s.Size(ctx, name); err != nil {
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	resp, err := s.send(ctx, http.MethodPut, s.metaKey(name), nil, nil, encodeMeta(meta))
+	if err != nil {
+		return fmt.Errorf("save metadata of %q: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *ObjectStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	if _, err := s.Size(ctx, name); err != nil {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, err)
+	}
+	resp, err := s.send(ctx, http.MethodGet, s.metaKey(name), nil, nil, nil)
+	if errors.Is(err, ErrNoPoem) {
+		return Metadata{}, nil
+	}
+	if err != nil {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("load metadata of %q: %w", name, err)
+	}
+	return decodeMeta(name, data)
+}
+
+// #### The decorators
+//
+// The decorators that change poems on their way, or count them, leave
+// their metadata alone. A `ReadOnly` storage rejects new metadata while
+// it is read-only, as it rejects poems.
+
+func (s *LoggingStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	return SaveMeta(ctx, s.storage, name, meta)
+}
+
+func (s *LoggingStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	return LoadMeta(ctx, s.storage, name)
+}
+
+func (r *ReadOnly) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	if r.IsReadOnly() {
+		return &ReadOnlyError{Name: name}
+	}
+	return SaveMeta(ctx, r.storage, name, meta)
+}
+
+func (r *ReadOnly) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	return LoadMeta(ctx, r.storage, name)
+}
+
+func (s *VersionedStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	return SaveMeta(ctx, s.storage, name, meta)
+}
+
+func (s *VersionedStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	return LoadMeta(ctx, s.storage, name)
+}
+
+func (s *CatalogStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	return SaveMeta(ctx, s.storage, name, meta)
+}
+
+func (s *CatalogStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	return LoadMeta(ctx, s.storage, name)
+}
+
+func (s *EncryptedStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	return SaveMeta(ctx, s.storage, name, meta)
+}
+
+func (s *EncryptedStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	return LoadMeta(ctx, s.storage, name)
+}
+
+func (s *CompressedStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	return SaveMeta(ctx, s.storage, name, meta)
+}
+
+func (s *CompressedStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	return LoadMeta(ctx, s.storage, name)
+}
+
+func (s *MeteredStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	return SaveMeta(ctx, s.storage, name, meta)
+}
+
+func (s *MeteredStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	return LoadMeta(ctx, s.storage, name)
+}
+
+func (s *CachedStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	return SaveMeta(ctx, s.storage, name, meta)
+}
+
+func (s *CachedStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	return LoadMeta(ctx, s.storage, name)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// #### Conformance
+//
+// `checkMeta` checks that the metadata of the poems in `names` loads as it
+// was saved, and stays when the poem is saved again, and that poems that
+// are missing have none. Storages that cannot keep metadata must say so
+// with `ErrNoMetadata`. `TestLaws` runs it on every stack. It leaves the
+// poems as they were, with metadata.
+func checkMeta(ctx context.Context, ps PoemStorage, names []string) error {
+	at := time.Date(2016, 6, 23, 12, 0, 0, 0, time.UTC)
+	for i, name := range names {
+		contents, err := ps.Load(ctx, name)
+		if errors.Is(err, ErrNoPoem) {
+			if _, err := LoadMeta(ctx, ps, name); !errors.Is(err, ErrNoPoem) {
+				return fmt.Errorf("metadata of missing poem %q: got %v, want ErrNoPoem", name, err)
+			}
+			if err := SaveMeta(ctx, ps, name, Metadata{Author: "nobody"}); !errors.Is(err, ErrNoPoem) && !errors.Is(err, ErrNoMetadata) {
+				return fmt.Errorf("save metadata of missing poem %q: got %v, want ErrNoPoem", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := LoadMeta(ctx, ps, name); err != nil {
+			return fmt.Errorf("metadata of %q: %w", name, err)
+		}
+		want := Metadata{
+			Author:  fmt.Sprintf("poet %d", i),
+			Created: at,
+			Updated: at.Add(time.Duration(i) * time.Hour),
+			Tags:    []string{"law", name},
+		}
+		err = SaveMeta(ctx, ps, name, want)
+		if errors.Is(err, ErrNoMetadata) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("save metadata of %q: %w", name, err)
+		}
+		if got, err := LoadMeta(ctx, ps, name); err != nil || !got.equal(want) {
+			return fmt.Errorf("metadata of %q: got %+v, %v, want %+v", name, got, err, want)
+		}
+		if err := ps.Save(ctx, name, contents); err != nil {
+			return err
+		}
+		if got, err := LoadMeta(ctx, ps, name); err != nil || !got.equal(want) {
+			return fmt.Errorf("metadata of %q after save: got %+v, %v, want %+v", name, got, err, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Middleware
+//
+// Between the network and the `PoemHandler` sits a pipeline of middleware:
+// handlers that wrap handlers to recover from panics, log requests, answer
+// CORS preflights, or compress responses. None of them knows about poems,
+// and none of them knows about the others.
+//
+// Every middleware is a member of the group "http.middleware". Which of
+// them run, and in which order, is configuration: the setting
+// "http.middleware" lists them by name, outermost first. So
+//
+//	POEMS_HTTP_MIDDLEWARE=recover,log,cors,gzip
+//
+// adds CORS to the default pipeline, without touching the code. A new
+// middleware is a new group member plus an entry in the setting.
+
+// A `Middleware` wraps a handler.
+type Middleware interface {
+	// `Name` is the name under which the setting "http.middleware" lists
+	// the middleware.
+	Name() string
+
+	// `Wrap` returns a handler that does the middleware's work and calls
+	// `next`.
+	Wrap(next http.Handler) http.Handler
+}
+
+// A `Pipeline` is the middleware that the configuration enables, in order.
+type Pipeline struct {
+	middleware []Middleware
+}
+
+// `NewPipeline` picks the middleware that `cfg` lists from `available`.
+// It fails if the setting names middleware that does not exist, or names
+// one twice, as that is more likely a typo than an intent.
+func NewPipeline(cfg HTTPConfig, available ...Middleware) (*Pipeline, error) {
+	middleware, err := pickMiddleware("middleware", cfg.Middleware, available)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{middleware: middleware}, nil
+}
+
+// `pickMiddleware` returns the middleware of `available` that `names`
+// lists, in its order. `kind` starts the errors.
+func pickMiddleware[M interface{ Name() string }](kind string, names []string, available []M) ([]M, error) {
+	byName := map[string]M{}
+	for _, m := range available {
+		if _, dup := byName[m.Name()]; dup {
+			return nil, fmt.Errorf("%s %q: registered twice", kind, m.Name())
+		}
+		byName[m.Name()] = m
+	}
+	var picked []M
+	used := map[string]bool{}
+	for _, name := range names {
+		m, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%s %q: not available", kind, name)
+		}
+		if used[name] {
+			return nil, fmt.Errorf("%s %q: listed twice", kind, name)
+		}
+		used[name] = true
+		picked = append(picked, m)
+	}
+	return picked, nil
+}
+
+// `Wrap` wraps `h` in the pipeline's middleware, the first one outermost.
+func (p *Pipeline) Wrap(h http.Handler) http.Handler {
+	for i := len(p.middleware) - 1; i >= 0; i-- {
+		h = p.middleware[i].Wrap(h)
+	}
+	return h
+}
+
+// `NewRouter` routes requests to the handlers of the example, behind the
+// pipeline. It is the handler that the server runs. Handlers with
+// request-scoped dependencies are resolved for every request; see
+// `session.go`. Optional endpoints are routed if the container has them.
+func NewRouter(poems *PoemHandler, assets *Assets, gql di.Optional[*GraphQLHandler], rpc di.Optional[*RPCServer], meter *Meter, p *Pipeline) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(assetPrefix, assets)
+	if gql.OK {
+		mux.Handle("/graphql", gql.Value)
+	}
+	if rpc.OK {
+		mux.Handle("/rpc", rpc.Value)
+	}
+	mux.Handle("/poems/", poems)
+	mux.Handle("/favorites", PerRequest[*FavoritesHandler]())
+	mux.Handle("/favorites/", PerRequest[*FavoritesHandler]())
+	mux.Handle("/usage", meter)
+	return p.Wrap(mux)
+}
+
+// #### Recovery
+//
+// `Recovery` turns a panicking handler into a 500 Internal Server Error and
+// a log entry with the stack, so that one bad request does not take the
+// connection down with it.
+type Recovery struct {
+	log *log.Logger
+}
+
+// `NewRecovery` logs panics to `l`.
+func NewRecovery(l *log.Logger) *Recovery {
+	return &Recovery{log: l}
+}
+
+func (*Recovery) Name() string { return "recover" }
+
+func (m *Recovery) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err) // The server aborts the response on purpose.
+			}
+			m.log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// #### Request log
+//
+// `RequestLog` logs every request with its status, the size of the
+// response, and how long it took.
+type RequestLog struct {
+	log *log.Logger
+}
+
+// `NewRequestLog` logs requests to `l`.
+func NewRequestLog(l *log.Logger) *RequestLog {
+	return &RequestLog{log: l}
+}
+
+func (*RequestLog) Name() string { return "log" }
+
+func (m *RequestLog) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.log.Printf("%s %s: %d, %d bytes, %v", r.Method, r.URL.Path, rec.status, rec.size, time.Since(start))
+	})
+}
+
+// A `statusRecorder` remembers the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.size += n
+	return n, err
+}
+
+// #### CORS
+//
+// `CORS` lets scripts on the origins of the setting "http.cors.origins"
+// read poems. It answers preflight requests itself, and exposes the
+// headers that ranged and conditional requests need. "*" allows every
+// origin.
+type CORS struct {
+	origins []string
+}
+
+// `NewCORS` allows the origins of `cfg`.
+func NewCORS(cfg CORSConfig) *CORS {
+	return &CORS{origins: cfg.Origins}
+}
+
+func (*CORS) Name() string { return "cors" }
+
+func (m *CORS) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !m.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Expose-Headers", "Accept-Ranges, Content-Range, ETag")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, HEAD")
+			h.Set("Access-Control-Allow-Headers", "Accept, If-None-Match, If-Range, Range")
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *CORS) allows(origin string) bool {
+	for _, o := range m.origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// #### Compression
+//
+// `Gzip` compresses responses for clients that accept gzip. It leaves
+// ranged and HEAD requests alone, as ranges refer to the uncompressed
+// poem, and marks the ETag of compressed responses as weak: the bytes
+// differ from those of the uncompressed response, but the poem is the
+// same, so conditional requests still work.
+type Gzip struct{}
+
+func (Gzip) Name() string { return "gzip" }
+
+func (Gzip) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// `acceptsGzip` reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(accept string) bool {
+	for _, entry := range strings.Split(accept, ",") {
+		params := strings.Split(entry, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), "gzip") {
+			continue
+		}
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if q, err := strconv.ParseFloat(v, 64); strings.EqualFold(k, "q") && err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// A `gzipWriter` compresses the body of a successful response. It decides
+// when the handler writes the header, so that errors and 304 Not Modified
+// responses go out as they are.
+type gzipWriter struct {
+	http.ResponseWriter
+	zw          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if status == http.StatusOK && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.zw = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.zw == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.zw.Write(p)
+}
+
+func (w *gzipWriter) close() {
+	if w.zw != nil {
+		w.zw.Close()
+	}
+}
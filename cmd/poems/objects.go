@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ### Poems in an object store
+//
+// An `ObjectStorage` keeps each poem as an object in a bucket of an
+// S3-compatible object store: Amazon S3, MinIO, Ceph, and others. The
+// settings in "storage.s3" name the endpoint, the bucket, and the
+// credentials:
+//
+//	POEMS_STORAGE_S3_ENDPOINT=http://localhost:9000 \
+//	POEMS_STORAGE_S3_BUCKET=poems \
+//	POEMS_STORAGE_S3_ACCESSKEY=... POEMS_STORAGE_S3_SECRETKEY=... \
+//	go run ./cmd/poems
+//
+// The example needs no SDK for that. It speaks the S3 REST API over
+// `net/http`: PUT, GET, and HEAD on objects, and the list call on the
+// bucket. Requests are signed with AWS Signature Version 4, which all of
+// these stores accept. The bucket is addressed by path,
+// "<endpoint>/<bucket>/<key>", which works without DNS for each bucket.
+//
+// An object's key is the poem's file name in a `FileStorage`, after the
+// setting "storage.s3.prefix", so a bucket can hold more than poems. S3
+// writes objects atomically, so unlike the `FileStorage`, the
+// `ObjectStorage` needs no temporary objects.
+
+// `ObjectStorage` keeps poems in an S3 bucket.
+type ObjectStorage struct {
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time // Dates the signatures.
+}
+
+// `NewObjectStorage` keeps poems in the bucket of `cfg`, and sends
+// requests with `client`.
+func NewObjectStorage(cfg S3Config, client *http.Client) *ObjectStorage {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &ObjectStorage{cfg: cfg, client: client, now: time.Now}
+}
+
+// An `S3Error` is an error response of the object store.
+type S3Error struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// `key` returns the object key of the poem `name`.
+func (s *ObjectStorage) key(name string) string {
+	return s.cfg.Prefix + url.PathEscape(name) + poemExt
+}
+
+// `Init` checks that the bucket exists and that the credentials are
+// good, so that a wrong setting stops the program at the start rather
+// than at the first save.
+func (s *ObjectStorage) Init(ctx context.Context) error {
+	resp, err := s.send(ctx, http.MethodHead, "", nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("bucket %q: %w", s.cfg.Bucket, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// `Save` saves a poem, replacing the poem of the same name.
+func (s *ObjectStorage) Save(ctx context.Context, name string, contents []byte) error {
+	resp, err := s.send(ctx, http.MethodPut, s.key(name), nil, nil, contents)
+	if err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *ObjectStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.send(ctx, http.MethodGet, s.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	defer resp.Body.Close()
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	return contents, nil
+}
+
+func (s *ObjectStorage) Type() string {
+	return "ObjectStorage"
+}
+
+// `listResult` is the part of a ListObjectsV2 response that `keys` reads.
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// `keys` returns the keys of all objects under the prefix. The store
+// returns at most 1000 keys per call, so `keys` follows the continuation
+// tokens.
+func (s *ObjectStorage) keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.cfg.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.send(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: list: %w", err)
+		}
+		for _, c := range page.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// `send` sends a signed request for the object `key`, or for the bucket if
+// `key` is empty. Responses with a status of 300 or more are errors; a 404
+// for an object is `ErrNoPoem`.
+func (s *ObjectStorage) send(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: endpoint: %w", err)
+	}
+	// The path is escaped as the signature expects it, which is stricter
+	// than `net/url`.
+	path := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + s3Escape(s.cfg.Bucket, false)
+	if key != "" {
+		path += "/" + s3Escape(key, true)
+	}
+	if u.Path, err = url.PathUnescape(path); err != nil {
+		return nil, fmt.Errorf("s3: endpoint: %w", err)
+	}
+	u.RawPath = path
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body == nil {
+		req.Body, req.ContentLength = http.NoBody, 0
+	}
+	s.sign(req, body)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		return nil, ErrNoPoem
+	}
+	e := &S3Error{Status: resp.StatusCode}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(e) // HEAD responses have no body.
+	return nil, e
+}
+
+// #### Signatures
+//
+// Signature Version 4 signs a canonical form of the request: the method,
+// the path, the query, some headers, and the hash of the body. The key is
+// derived from the secret key, the date, the region, and the service, so
+// a signature is only good for a day, in one region.
+
+// `sign` adds the headers of Signature Version 4 to `req`.
+func (s *ObjectStorage) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	stamp := now.Format("20060102T150405Z")
+	day := stamp[:8]
+	payload := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	// The host and all x-amz-* headers are signed, and the range, which
+	// changes what a GET returns.
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-amz-") || k == "range" {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonical.String(),
+		signed,
+		payload,
+	}, "\n")
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + sha256Hex([]byte(request))
+
+	key := []byte("AWS4" + s.cfg.SecretKey)
+	for _, part := range []string{day, s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// `s3Escape` escapes every byte but letters, digits, and "-._~", and but
+// "/" if `slash` is true, as the signature requires.
+func s3Escape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// `s3Query` encodes a query in the canonical form of the signature:
+// sorted by name, and escaped with `s3Escape`.
+func s3Query(query url.Values) string {
+	var params []string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ### Listing poems page by page
+//
+// A poet with many poems wants to browse them a page at a time, whatever
+// storage they are in. Storages that can list their poems implement
+// `Lister`, and all of them paginate the same way: by name, in ascending
+// order, continuing after the last name of the previous page.
+//
+// The position between pages is a `Cursor`. Cursors name the last poem
+// returned rather than counting poems, so a cursor stays valid while poems
+// are added and removed: the next page starts after the same name no matter
+// what happened before it. That works equally well for a map in memory, for
+// a directory listing, for SQL (`WHERE name > ? ORDER BY name LIMIT ?`) and
+// for object stores that list keys after a start key.
+
+// A `Lister` is a storage that can list the names of its poems.
+type Lister interface {
+	// `List` returns up to `limit` names that sort after the position of
+	// `after`, in ascending order, and the cursor for the next page. The
+	// empty cursor stands for the start of the list; an empty next cursor
+	// means that there are no more names. A `limit` below 1 means
+	// `DefaultPageSize`.
+	List(ctx context.Context, after Cursor, limit int) (names []string, next Cursor, err error)
+}
+
+// `DefaultPageSize` is the page size for limits below 1.
+const DefaultPageSize = 100
+
+// A `Cursor` marks a position in a list of poems. It is opaque to clients,
+// which get cursors from `List` and pass them back unchanged.
+type Cursor string
+
+// `ErrBadCursor` is returned for cursors that `List` did not produce.
+var ErrBadCursor = errors.New("invalid cursor")
+
+// `cursorVersion` prefixes the contents of a cursor, so that the format
+// can change without misreading cursors that clients still hold.
+const cursorVersion = "1:"
+
+// `NewCursor` returns the cursor that continues after the name `last`.
+func NewCursor(last string) Cursor {
+	return Cursor(base64.RawURLEncoding.EncodeToString([]byte(cursorVersion + last)))
+}
+
+// `After` returns the name that the cursor continues after. For the empty
+// cursor, `ok` is false.
+func (c Cursor) After() (last string, ok bool, err error) {
+	if c == "" {
+		return "", false, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil || !strings.HasPrefix(string(data), cursorVersion) {
+		return "", false, ErrBadCursor
+	}
+	return strings.TrimPrefix(string(data), cursorVersion), true, nil
+}
+
+// `Paginate` implements `List` for storages that can produce all names at
+// once. `names` must be sorted.
+func Paginate(names []string, after Cursor, limit int) ([]string, Cursor, error) {
+	if limit < 1 {
+		limit = DefaultPageSize
+	}
+	start := 0
+	last, ok, err := after.After()
+	if err != nil {
+		return nil, "", err
+	}
+	if ok {
+		// The first name after `last`, whether or not `last` still exists.
+		start = sort.Search(len(names), func(i int) bool { return names[i] > last })
+	}
+	end := start + limit
+	if end >= len(names) {
+		return append([]string{}, names[start:]...), "", nil
+	}
+	page := append([]string{}, names[start:end]...)
+	return page, NewCursor(page[len(page)-1]), nil
+}
+
+// `List` makes the `Notebook` a `Lister`.
+func (n *Notebook) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	names := make([]string, 0, len(n.poems))
+	for name := range n.poems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Paginate(names, after, limit)
+}
+
+// `List` makes the `FileStorage` a `Lister`. Temporary files are not
+// poems.
+func (s *FileStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	entries, err := fs.ReadDir(s.fs, ".")
+	if err != nil {
+		return nil, "", err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), poemExt) {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(e.Name(), poemExt))
+		if err != nil {
+			continue // Not a file that `FileStorage` wrote.
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Paginate(names, after, limit)
+}
+
+// `List` makes the `ObjectStorage` a `Lister`. The store lists keys in
+// the order of their escaped form, which is not the order of the names,
+// so `List` lists them all, as the `FileStorage` does.
+func (s *ObjectStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	keys, err := s.keys(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	var names []string
+	for _, key := range keys {
+		key = strings.TrimPrefix(key, s.cfg.Prefix)
+		if strings.Contains(key, "/") || !strings.HasSuffix(key, poemExt) {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(key, poemExt))
+		if err != nil {
+			continue // Not an object that `ObjectStorage` wrote.
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Paginate(names, after, limit)
+}
+
+// `List` makes the `RedisStorage` a `Lister`. SCAN walks the keys in no
+// order, in as many calls as it takes, so `List` collects them all and
+// sorts them.
+func (s *RedisStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	var names []string
+	scan := "0"
+	for {
+		reply, err := s.redis.Do(ctx, "SCAN", scan, "MATCH", redisPoemPrefix+"*", "COUNT", "1000")
+		if err != nil {
+			return nil, "", err
+		}
+		parts, _ := reply.([]interface{})
+		if len(parts) != 2 {
+			return nil, "", fmt.Errorf("redis: SCAN replied %v", reply)
+		}
+		keys, _ := parts[1].([]interface{})
+		for _, key := range keys {
+			if key, ok := key.(string); ok {
+				names = append(names, strings.TrimPrefix(key, redisPoemPrefix))
+			}
+		}
+		if scan, _ = parts[0].(string); scan == "0" || scan == "" {
+			break
+		}
+	}
+	// SCAN may return a key more than once.
+	sort.Strings(names)
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return Paginate(unique, after, limit)
+}
+
+// The `EncryptedStorage` passes `List` through, as names are not
+// encrypted, so the endpoints of `library.go` can browse an encrypted file
+// storage.
+func (s *EncryptedStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	l, ok := s.storage.(Lister)
+	if !ok {
+		return nil, "", ErrNotListable
+	}
+	return l.List(ctx, after, limit)
+}
+
+// The `CompressedStorage`, the `CachedStorage`, and the `MeteredStorage`
+// pass `List` through, too.
+func (s *CompressedStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	l, ok := s.storage.(Lister)
+	if !ok {
+		return nil, "", ErrNotListable
+	}
+	return l.List(ctx, after, limit)
+}
+
+// `List` makes the `SQLiteStorage` a `Lister`. It asks for one name more
+// than the page holds, to know whether there is a next page.
+func (s *SQLiteStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	if limit < 1 {
+		limit = DefaultPageSize
+	}
+	last, ok, err := after.After()
+	if err != nil {
+		return nil, "", err
+	}
+	var rows *sql.Rows
+	if ok {
+		rows, err = s.db.QueryContext(ctx, sqlList, last, limit+1)
+	} else {
+		// Without a cursor, `name > ''` would leave out a poem named "".
+		rows, err = s.db.QueryContext(ctx, sqlHead, limit+1)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, "", err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(names) <= limit {
+		return names, "", nil
+	}
+	names = names[:limit]
+	return names, NewCursor(names[limit-1]), nil
+}
+
+func (s *CachedStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	l, ok := s.storage.(Lister)
+	if !ok {
+		return nil, "", ErrNotListable
+	}
+	return l.List(ctx, after, limit)
+}
+
+// The `ReplicatedStorage` lists the poems of its first healthy replica
+// that can list them. Saves that went to a majority only may be missing
+// from its list.
+func (s *ReplicatedStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	var first error
+	for _, i := range s.order() {
+		l, ok := s.replicas[i].(Lister)
+		if !ok {
+			continue
+		}
+		var names []string
+		var next Cursor
+		err := s.call(ctx, i, func(PoemStorage) error {
+			var err error
+			names, next, err = l.List(ctx, after, limit)
+			return err
+		})
+		if err == nil {
+			return names, next, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if first == nil {
+		return nil, "", ErrNotListable
+	}
+	return nil, "", first
+}
+
+func (s *MeteredStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	l, ok := s.storage.(Lister)
+	if !ok {
+		return nil, "", ErrNotListable
+	}
+	return l.List(ctx, after, limit)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// #### Conformance
+//
+// `checkLister` holds a `Lister` to the rules of `paging.go`. `ps` is the same
+// storage as a `PoemStorage`, for adding poems while paging. `TestLaws`
+// runs it on every backend that lists.
+func checkLister(ctx context.Context, r *rand.Rand, l Lister, ps PoemStorage) error {
+	all := func() ([]string, error) {
+		var names []string
+		var after Cursor
+		for {
+			page, next, err := l.List(ctx, after, r.Intn(4))
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, page...)
+			if next == "" {
+				return names, nil
+			}
+			if len(page) == 0 {
+				return nil, fmt.Errorf("empty page before the end of the list")
+			}
+			after = next
+		}
+	}
+
+	// Paging through the list yields every name once, in order.
+	before, err := all()
+	if err != nil {
+		return err
+	}
+	if !sort.StringsAreSorted(before) {
+		return fmt.Errorf("names not in order: %q", before)
+	}
+	for i := 1; i < len(before); i++ {
+		if before[i] == before[i-1] {
+			return fmt.Errorf("name %q listed twice", before[i])
+		}
+	}
+
+	// Cursors are stable: poems added while paging do not make the pages
+	// skip or repeat the poems that were there before.
+	var seen []string
+	var after Cursor
+	for added := 0; ; added++ {
+		page, next, err := l.List(ctx, after, 1+r.Intn(3))
+		if err != nil {
+			return err
+		}
+		seen = append(seen, page...)
+		if next == "" {
+			break
+		}
+		for _, name := range []string{fmt.Sprintf("added %d", added), fmt.Sprintf("%s added %d", page[0], added)} {
+			if err := ps.Save(ctx, name, nil); err != nil {
+				return err
+			}
+		}
+		after = next
+	}
+	for _, name := range before {
+		n := 0
+		for _, s := range seen {
+			if s == name {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("name %q listed %d times while poems were added", name, n)
+		}
+	}
+
+	if _, _, err := l.List(ctx, "not a cursor", 1); !errors.Is(err, ErrBadCursor) {
+		return fmt.Errorf("List with a foreign cursor: got %v, want ErrBadCursor", err)
+	}
+	return nil
+}
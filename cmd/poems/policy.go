@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// ### Authorization policies
+//
+// `Authorization` knows one rule: tenants keep to their poems. Which
+// principal may do what with which poems beyond that is a matter of
+// policy, and a `PolicyEngine` decides it. The middleware "policy" asks
+// the engine about every call, and turns away those that it denies.
+//
+// The engine of the example reads its rules from the file of the setting
+// "storage.policy.rules". Each line of the file is a rule: whether it
+// allows or denies, the principals, the kinds of operations, and the names
+// of the poems that it is about. Blank lines and lines that start with "#"
+// are not rules.
+//
+//	# Alice may read and write her poems, and nobody may delete.
+//	allow alice  load,save,exists  alice/*
+//	deny  *      delete            *
+//	# Those who do not say who they are may read the poems of no tenant.
+//	allow -      load              *
+//
+// In principals and names, "*" stands for any run of characters, slashes
+// included. The principal "-" is a call without one, which "*" matches,
+// too. Operations are the kinds of `Operation`, separated by commas, or
+// "*" for all of them. The name of a "list" is empty, which only "*"
+// matches.
+//
+// The first rule that matches a call decides it. If no rule matches, the
+// call goes through, unless the setting "storage.policy.deny" is set:
+//
+//	POEMS_STORAGE_MIDDLEWARE=policy POEMS_STORAGE_POLICY_RULES=poems.rules POEMS_STORAGE_POLICY_DENY=true go run ./cmd/poems
+
+// An `Effect` is what a policy decides about an operation.
+type Effect int
+
+const (
+	Abstain Effect = iota // The policy has no say.
+	Allow
+	Deny
+)
+
+func (e Effect) String() string {
+	switch e {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	}
+	return "abstain"
+}
+
+// A `PolicyEngine` decides whether a principal may do an operation. A call
+// without a principal has the zero `Principal`.
+type PolicyEngine interface {
+	Decide(ctx context.Context, p Principal, op Operation) Effect
+}
+
+// A `Rule` decides the operations whose principal, kind, and name match.
+type Rule struct {
+	Effect    Effect
+	Principal string   // A pattern, or "-" for calls without a principal.
+	Kinds     []string // The kinds of operations, or "*".
+	Name      string   // A pattern.
+}
+
+// `Matches` reports whether the rule is about `op` by `p`.
+func (r Rule) Matches(p Principal, op Operation) bool {
+	if r.Principal == "-" {
+		if p.Name != "" {
+			return false
+		}
+	} else if !matchPattern(r.Principal, p.Name) {
+		return false
+	}
+	kind := false
+	for _, k := range r.Kinds {
+		if k == "*" || k == op.Kind {
+			kind = true
+			break
+		}
+	}
+	return kind && matchPattern(r.Name, op.Name)
+}
+
+// `matchPattern` reports whether `s` matches `pattern`, in which "*"
+// stands for any run of characters.
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
+
+// `Rules` is a `PolicyEngine` whose first matching rule decides.
+type Rules []Rule
+
+func (rs Rules) Decide(ctx context.Context, p Principal, op Operation) Effect {
+	for _, r := range rs {
+		if r.Matches(p, op) {
+			return r.Effect
+		}
+	}
+	return Abstain
+}
+
+// `policyKinds` are the kinds of operations that rules may name.
+var policyKinds = map[string]bool{
+	"*": true, "save": true, "load": true, "delete": true, "exists": true,
+	"list": true, "savemeta": true, "loadmeta": true,
+}
+
+// `ParseRules` reads rules in the format of a rule file.
+func ParseRules(r io.Reader) (Rules, error) {
+	var rules Rules
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: want effect, principal, operations, and name, got %q", line, text)
+		}
+		var rule Rule
+		switch fields[0] {
+		case "allow":
+			rule.Effect = Allow
+		case "deny":
+			rule.Effect = Deny
+		default:
+			return nil, fmt.Errorf("line %d: unknown effect %q", line, fields[0])
+		}
+		rule.Principal, rule.Name = fields[1], fields[3]
+		rule.Kinds = strings.Split(fields[2], ",")
+		for _, k := range rule.Kinds {
+			if !policyKinds[k] {
+				return nil, fmt.Errorf("line %d: unknown operation %q", line, k)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// `LoadRules` reads the rule file `path`.
+func LoadRules(path string) (Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// `NewPolicyEngine` returns the rules of the file that `cfg` names. Without
+// a file, there are no rules.
+func NewPolicyEngine(cfg PolicyConfig) (PolicyEngine, error) {
+	if cfg.Rules == "" {
+		return Rules(nil), nil
+	}
+	return LoadRules(cfg.Rules)
+}
+
+// #### The middleware
+//
+// `Policy` asks its engine about each call, and turns away the calls that
+// the engine denies, and those that it abstains from if it denies by
+// default. It logs what it turns away.
+type Policy struct {
+	engine        PolicyEngine
+	denyByDefault bool
+	log           *log.Logger
+}
+
+// `NewPolicy` enforces the decisions of `engine`, as `cfg` configures.
+func NewPolicy(engine PolicyEngine, cfg PolicyConfig, l *log.Logger) *Policy {
+	return &Policy{engine: engine, denyByDefault: cfg.Deny, log: l}
+}
+
+func (*Policy) Name() string { return "policy" }
+
+func (p *Policy) Wrap(next StorageHandler) StorageHandler {
+	return func(ctx context.Context, op Operation) error {
+		principal, _ := PrincipalOf(ctx)
+		effect := p.engine.Decide(ctx, principal, op)
+		if effect == Deny || effect == Abstain && p.denyByDefault {
+			who := principal.Name
+			if who == "" {
+				who = "nobody"
+			}
+			p.log.Printf("policy: %s may not %s %q (%s)", who, op.Kind, op.Name, effect)
+			return fmt.Errorf("%s %q: %w: %s may not %s by policy", op.Kind, op.Name, ErrUnauthorized, who, op.Kind)
+		}
+		return next(ctx, op)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mrand "math/rand"
+	"strings"
+)
+
+// #### Conformance
+//
+// `checkPolicy` checks a rule file behind the middleware "policy" around
+// a random keyed backend, with and without denying by default: that the
+// first matching rule decides, and that what is turned away never reaches
+// the backend. `TestLaws` runs it once.
+func checkPolicy(ctx context.Context, r *mrand.Rand) error {
+	var keyed []backend
+	for _, b := range backends {
+		if b.keyed {
+			keyed = append(keyed, b)
+		}
+	}
+	b := keyed[r.Intn(len(keyed))]
+	rules, err := ParseRules(strings.NewReader(`
+# Alice keeps her poems, but may not delete them.
+deny  alice  delete                alice/*
+allow alice  *                     alice/*
+allow -      load,exists           public*
+deny  *      save,delete,savemeta  *
+`))
+	if err != nil {
+		return err
+	}
+	alice := WithPrincipal(ctx, Principal{Name: "alice", Tenant: "alice"})
+	bob := WithPrincipal(ctx, Principal{Name: "bob"})
+	for _, deny := range []bool{false, true} {
+		backend := &traceProbe{PoemStorage: b.new()}
+		if err := backend.Save(ctx, "public poem", []byte("verse")); err != nil {
+			return err
+		}
+		cfg := PolicyConfig{Deny: deny}
+		p, err := NewStoragePipeline(StorageConfig{Middleware: []string{"policy"}}, NewPolicy(rules, cfg, log.New(io.Discard, "", 0)))
+		if err != nil {
+			return err
+		}
+		ps := p.Storage(backend)
+		desc := fmt.Sprintf("%s, deny by default %t", b.name, deny)
+
+		for _, c := range []struct {
+			desc  string
+			ctx   context.Context
+			name  string
+			allow bool
+		}{
+			{"alice saves her poem", alice, "alice/poem", true},
+			{"bob saves", bob, "bob/poem", false},
+			{"nobody saves", ctx, "public poem", false},
+		} {
+			calls := len(backend.ids)
+			err := ps.Save(c.ctx, c.name, []byte("verse"))
+			if c.allow && err != nil || !c.allow && !errors.Is(err, ErrUnauthorized) {
+				return fmt.Errorf("%s: %s: got %v", desc, c.desc, err)
+			}
+			if !c.allow && len(backend.ids) != calls {
+				return fmt.Errorf("%s: %s reached the backend", desc, c.desc)
+			}
+		}
+		if err := ps.Delete(alice, "alice/poem"); !errors.Is(err, ErrUnauthorized) {
+			return fmt.Errorf("%s: alice deletes her poem: got %v, want ErrUnauthorized", desc, err)
+		}
+		if _, err := ps.Load(ctx, "public poem"); err != nil {
+			return fmt.Errorf("%s: nobody loads a public poem: %w", desc, err)
+		}
+
+		// No rule is about bob loading, which only the default denies.
+		_, err = ps.Load(bob, "public poem")
+		if deny != errors.Is(err, ErrUnauthorized) {
+			return fmt.Errorf("%s: bob loads a public poem: got %v", desc, err)
+		}
+	}
+	return nil
+}
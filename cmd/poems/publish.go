@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Publishing an anthology
+//
+// With `-publish`, the poems in the files go out as an anthology:
+//
+//	go run ./cmd/poems -publish "Collected poems"
+//
+// Publishing is a saga of three steps; see `saga.go`. "publish.render"
+// renders the poems into a page with the template "anthology.html",
+// "publish.upload" saves the page under the title of the anthology in the
+// storage "published", and "publish.notify" tells the readers through a
+// `Notifier`. `PublishModule` binds each step by its name, so a
+// deployment that uploads elsewhere, or notifies by mail, replaces one
+// binding.
+//
+// The saga keeps its state in the storage "sagas", one run per title. If
+// a run did not finish, publishing the same title resumes it.
+
+// `PublishModule` provides the steps of publishing, and the `Publisher`.
+var PublishModule = di.Module("publish",
+	di.Provide(func(ps PoemStorage, t TemplateRenderer) Step { return NewRenderStep(ps, t) },
+		di.Named("publish.render"), di.ParamNames("files")),
+	di.Provide(func(ps PoemStorage) Step { return NewUploadStep(ps) },
+		di.Named("publish.upload"), di.ParamNames("published")),
+	di.Provide(func(n Notifier) Step { return NewNotifyStep(n) },
+		di.Named("publish.notify")),
+	di.Provide(NewPublisher,
+		di.ParamNames("sagas", "publish.render", "publish.upload", "publish.notify")),
+)
+
+// A `Publisher` publishes anthologies.
+type Publisher struct {
+	saga *Saga
+}
+
+// `NewPublisher` publishes with the steps `render`, `upload`, and
+// `notify`, and keeps the state of each run in `store`.
+func NewPublisher(store PoemStorage, render, upload, notify Step) *Publisher {
+	return &Publisher{saga: NewSaga("publish", store, render, upload, notify)}
+}
+
+// `Publish` publishes the anthology `title`, or resumes an unfinished run
+// that publishes it.
+func (p *Publisher) Publish(ctx context.Context, title string) (*SagaState, error) {
+	id := "anthology " + title
+	s, err := p.saga.Start(ctx, id, map[string]string{"title": title})
+	if errors.Is(err, ErrSagaUnfinished) {
+		return p.saga.Resume(ctx, id)
+	}
+	return s, err
+}
+
+// #### Rendering
+
+// The `RenderStep` renders the poems of a storage into the page of the
+// anthology, which it leaves in the state as "page".
+type RenderStep struct {
+	poems PoemStorage
+	pages TemplateRenderer
+}
+
+// `NewRenderStep` renders the poems of `ps` with `t`.
+func NewRenderStep(ps PoemStorage, t TemplateRenderer) *RenderStep {
+	return &RenderStep{poems: ps, pages: t}
+}
+
+func (r *RenderStep) Name() string { return "render" }
+
+func (r *RenderStep) Do(ctx context.Context, s *SagaState) error {
+	names, err := ListAll(ctx, r.poems)
+	if err != nil {
+		return err
+	}
+	type poem struct{ Name, Text string }
+	page := struct {
+		Title string
+		Poems []poem
+	}{Title: s.Data["title"]}
+	for _, name := range names {
+		text, err := r.poems.Load(ctx, name)
+		if errors.Is(err, ErrNoPoem) {
+			continue // Deleted since it was listed.
+		}
+		if err != nil {
+			return err
+		}
+		page.Poems = append(page.Poems, poem{Name: name, Text: string(text)})
+	}
+	var buf bytes.Buffer
+	if err := r.pages.Render(&buf, "anthology.html", page); err != nil {
+		return err
+	}
+	s.Data["page"] = buf.String()
+	s.Data["poems"] = strconv.Itoa(len(page.Poems))
+	return nil
+}
+
+// The page only exists in the state, so compensating drops it.
+func (r *RenderStep) Compensate(ctx context.Context, s *SagaState) error {
+	delete(s.Data, "page")
+	delete(s.Data, "poems")
+	return nil
+}
+
+// #### Uploading
+
+// The `UploadStep` saves the page under the title of the anthology. It
+// keeps the page that it replaces in the state, for compensation.
+type UploadStep struct {
+	target PoemStorage
+}
+
+// `NewUploadStep` uploads to `ps`.
+func NewUploadStep(ps PoemStorage) *UploadStep {
+	return &UploadStep{target: ps}
+}
+
+func (u *UploadStep) Name() string { return "upload" }
+
+func (u *UploadStep) Do(ctx context.Context, s *SagaState) error {
+	title := s.Data["title"]
+	if _, seen := s.Data["upload.replaced"]; !seen {
+		// A page that is already there is only the previous one if this is
+		// the first attempt, so the state must say so before the upload.
+		previous, err := u.target.Load(ctx, title)
+		switch {
+		case err == nil:
+			s.Data["upload.replaced"], s.Data["upload.previous"] = "true", string(previous)
+		case errors.Is(err, ErrNoPoem):
+			s.Data["upload.replaced"] = "false"
+		default:
+			return err
+		}
+		if err := s.Checkpoint(ctx); err != nil {
+			return err
+		}
+	}
+	return u.target.Save(ctx, title, []byte(s.Data["page"]))
+}
+
+// Compensating puts the previous page back, or deletes the page if there
+// was none.
+func (u *UploadStep) Compensate(ctx context.Context, s *SagaState) error {
+	title := s.Data["title"]
+	switch s.Data["upload.replaced"] {
+	case "true":
+		return u.target.Save(ctx, title, []byte(s.Data["upload.previous"]))
+	case "false":
+		if err := Delete(ctx, u.target, title); err != nil && !errors.Is(err, ErrNoPoem) {
+			return err
+		}
+	}
+	return nil // The upload never got as far as looking.
+}
+
+// #### Notifying
+
+// A `Notice` tells readers about an anthology.
+type Notice struct {
+	Title     string
+	Poems     int
+	Withdrawn bool // The anthology was published, but is not anymore.
+}
+
+// A `Notifier` sends notices to readers.
+type Notifier interface {
+	Notify(ctx context.Context, n Notice) error
+}
+
+// `LogNotifier` writes notices to a logger.
+type LogNotifier struct {
+	Log *log.Logger
+}
+
+func (l LogNotifier) Notify(ctx context.Context, n Notice) error {
+	if n.Withdrawn {
+		l.Log.Printf("anthology %q was withdrawn", n.Title)
+		return nil
+	}
+	l.Log.Printf("anthology %q is out, with %d poems", n.Title, n.Poems)
+	return nil
+}
+
+// The `NotifyStep` tells the readers that the anthology is out.
+type NotifyStep struct {
+	notifier Notifier
+}
+
+// `NewNotifyStep` sends notices to `n`.
+func NewNotifyStep(n Notifier) *NotifyStep {
+	return &NotifyStep{notifier: n}
+}
+
+func (n *NotifyStep) Name() string { return "notify" }
+
+func (n *NotifyStep) Do(ctx context.Context, s *SagaState) error {
+	poems, _ := strconv.Atoi(s.Data["poems"])
+	return n.notifier.Notify(ctx, Notice{Title: s.Data["title"], Poems: poems})
+}
+
+// Compensating withdraws the notice, as a notice that failed may still
+// have reached some readers.
+func (n *NotifyStep) Compensate(ctx context.Context, s *SagaState) error {
+	return n.notifier.Notify(ctx, Notice{Title: s.Data["title"], Withdrawn: true})
+}
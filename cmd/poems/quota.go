@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ### Usage and quotas
+//
+// Tenants share a storage: the poems of a tenant are named
+// "<tenant>/...", as for `-purge`. A `MeteredStorage` measures how many
+// poems and bytes each tenant keeps, and reports the changes to a `Meter`,
+// which the storages it decorates share. `main` layers it onto the file
+// storage, and the server serves the usage as JSON at "/usage".
+//
+// Each tenant may keep "quota.bytes". When a tenant's usage rises above a
+// percentage in "quota.thresholds" of that, or falls below it again, the
+// `Meter` sends a `QuotaAlert` to its `AlertSink`. Alerting is a concern
+// of its own: the example logs alerts, and a sink that pages someone or
+// posts to a chat is a drop-in replacement. Quotas are not enforced; a
+// tenant above 100% can still save. Poems of no tenant are counted, but
+// have no quota.
+//
+// The `MeteredStorage` counts the poems that the storage lists when it is
+// first used, and then follows the saves that pass through it. For a
+// storage that cannot list its poems, it counts the poems that are saved
+// or loaded through it.
+
+// `Usage` is what a tenant keeps in a storage.
+type Usage struct {
+	Poems int   `json:"poems"`
+	Bytes int64 `json:"bytes"`
+}
+
+// A `QuotaAlert` reports that the usage of a tenant crossed a threshold.
+type QuotaAlert struct {
+	Tenant    string
+	Usage     Usage
+	Quota     int64 // In bytes.
+	Threshold int   // In percent of the quota.
+	Above     bool  // Whether the usage rose above the threshold, or fell below it.
+}
+
+// An `AlertSink` receives quota alerts.
+type AlertSink interface {
+	Alert(a QuotaAlert)
+}
+
+// `LogAlerts` writes quota alerts to a logger.
+type LogAlerts struct {
+	Log *log.Logger
+}
+
+func (s LogAlerts) Alert(a QuotaAlert) {
+	dir := "below"
+	if a.Above {
+		dir = "above"
+	}
+	s.Log.Printf("tenant %q is %s %d%% of its quota: %d of %d bytes in %d poems",
+		a.Tenant, dir, a.Threshold, a.Usage.Bytes, a.Quota, a.Usage.Poems)
+}
+
+// `tenantOf` returns the tenant of the poem `name`, or "" for a poem of no
+// tenant.
+func tenantOf(name string) string {
+	tenant, _, ok := strings.Cut(name, "/")
+	if !ok {
+		return ""
+	}
+	return tenant
+}
+
+// A `Meter` adds up the usage of every tenant, and checks it against the
+// quota.
+type Meter struct {
+	quota      int64
+	thresholds []int
+	sink       AlertSink
+
+	mu     sync.Mutex
+	usage  map[string]Usage
+	levels map[string]int // The number of thresholds that each tenant is above.
+}
+
+// `NewMeter` checks usage against `cfg`, and sends alerts to `sink`.
+func NewMeter(cfg QuotaConfig, sink AlertSink) (*Meter, error) {
+	thresholds := append([]int{}, cfg.Thresholds...)
+	sort.Ints(thresholds)
+	for _, t := range thresholds {
+		if t <= 0 {
+			return nil, errors.New("quota thresholds must be positive percentages")
+		}
+	}
+	return &Meter{
+		quota:      cfg.Bytes,
+		thresholds: thresholds,
+		sink:       sink,
+		usage:      map[string]Usage{},
+		levels:     map[string]int{},
+	}, nil
+}
+
+// `Add` changes the usage of `tenant` by `poems` and `bytes`, and alerts if
+// it crosses thresholds. The sink is called after the meter is unlocked,
+// so that a slow sink does not hold up other saves.
+func (m *Meter) Add(tenant string, poems int, bytes int64) {
+	m.mu.Lock()
+	u := m.usage[tenant]
+	u.Poems += poems
+	u.Bytes += bytes
+	if u == (Usage{}) {
+		delete(m.usage, tenant)
+	} else {
+		m.usage[tenant] = u
+	}
+	alerts := m.check(tenant, u)
+	m.mu.Unlock()
+	for _, a := range alerts {
+		m.sink.Alert(a)
+	}
+}
+
+// `check` returns the alerts for the thresholds that `tenant` crossed with
+// the usage `u`. The caller holds `m.mu`.
+func (m *Meter) check(tenant string, u Usage) []QuotaAlert {
+	if m.quota <= 0 || tenant == "" {
+		return nil
+	}
+	level := 0
+	for _, t := range m.thresholds {
+		if u.Bytes*100 > m.quota*int64(t) {
+			level++
+		}
+	}
+	was := m.levels[tenant]
+	if level == 0 {
+		delete(m.levels, tenant)
+	} else {
+		m.levels[tenant] = level
+	}
+	var alerts []QuotaAlert
+	for i := was; i < level; i++ {
+		alerts = append(alerts, QuotaAlert{Tenant: tenant, Usage: u, Quota: m.quota, Threshold: m.thresholds[i], Above: true})
+	}
+	for i := was - 1; i >= level; i-- {
+		alerts = append(alerts, QuotaAlert{Tenant: tenant, Usage: u, Quota: m.quota, Threshold: m.thresholds[i]})
+	}
+	return alerts
+}
+
+// `Usage` returns the usage of every tenant that keeps poems.
+func (m *Meter) Usage() map[string]Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := make(map[string]Usage, len(m.usage))
+	for tenant, u := range m.usage {
+		usage[tenant] = u
+	}
+	return usage
+}
+
+// `ServeHTTP` serves the usage of every tenant, and the quota, as JSON.
+// Poems of no tenant are listed under "".
+func (m *Meter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Quota   int64            `json:"quota,omitempty"`
+		Tenants map[string]Usage `json:"tenants"`
+	}{m.quota, m.Usage()})
+}
+
+// `MeteredStorage` reports the usage of the storage it wraps to a `Meter`.
+type MeteredStorage struct {
+	storage PoemStorage
+	meter   *Meter
+
+	scan  sync.Once
+	mu    sync.Mutex
+	sizes map[string]int64 // The poems that are counted.
+}
+
+// `NewMeteredStorage` wraps `ps` and reports to `m`.
+func NewMeteredStorage(ps PoemStorage, m *Meter) *MeteredStorage {
+	return &MeteredStorage{storage: ps, meter: m, sizes: map[string]int64{}}
+}
+
+func (s *MeteredStorage) Save(ctx context.Context, name string, contents []byte) error {
+	s.scan.Do(s.count)
+	if err := s.storage.Save(ctx, name, contents); err != nil {
+		return err
+	}
+	s.record(name, int64(len(contents)))
+	return nil
+}
+
+func (s *MeteredStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	s.scan.Do(s.count)
+	contents, err := s.storage.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	_, counted := s.sizes[name]
+	s.mu.Unlock()
+	if !counted {
+		s.record(name, int64(len(contents)))
+	}
+	return contents, nil
+}
+
+func (s *MeteredStorage) Type() string {
+	return s.storage.Type()
+}
+
+// `record` sets the size of the poem `name`, and reports the change.
+func (s *MeteredStorage) record(name string, size int64) {
+	s.mu.Lock()
+	old, counted := s.sizes[name]
+	s.sizes[name] = size
+	s.mu.Unlock()
+	poems := 0
+	if !counted {
+		poems = 1
+	}
+	if poems != 0 || size != old {
+		s.meter.Add(tenantOf(name), poems, size-old)
+	}
+}
+
+// `count` counts the poems that the storage lists, if it can. A poem that
+// cannot be sized, such as one that was deleted since it was listed, is
+// not counted. The scan runs once, for whichever call comes first, so it
+// does not take that call's context, which a cancelled call would cut short.
+func (s *MeteredStorage) count() {
+	ctx := context.Background()
+	lister, ok := s.storage.(Lister)
+	if !ok {
+		return
+	}
+	var after Cursor
+	for {
+		names, next, err := lister.List(ctx, after, 0)
+		if err != nil {
+			return
+		}
+		for _, name := range names {
+			if size, err := PoemSize(ctx, s.storage, name); err == nil {
+				s.record(name, size)
+			}
+		}
+		if next == "" {
+			return
+		}
+		after = next
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/appliedgo/di/fsys"
+)
+
+// #### Quota tests
+
+// `alerts` is an `AlertSink` that keeps the alerts.
+type alerts struct {
+	mu   sync.Mutex
+	sent []QuotaAlert
+}
+
+func (a *alerts) Alert(qa QuotaAlert) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sent = append(a.sent, qa)
+}
+
+// `take` returns the alerts sent since the last call, as "+50" for rising
+// above 50% and "-50" for falling below it.
+func (a *alerts) take() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var got []string
+	for _, qa := range a.sent {
+		sign := "-"
+		if qa.Above {
+			sign = "+"
+		}
+		got = append(got, sign+strconv.Itoa(qa.Threshold))
+	}
+	a.sent = nil
+	return got
+}
+
+func TestMeterThresholds(t *testing.T) {
+	sink := &alerts{}
+	// The thresholds need not be in order.
+	m, err := NewMeter(QuotaConfig{Bytes: 1000, Thresholds: []int{90, 50, 100}}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []struct {
+		name  string
+		poems int
+		bytes int64
+		want  []string
+	}{
+		{"below every threshold", 1, 400, nil},
+		{"at a threshold is not above it", 0, 100, nil},
+		{"above 50%", 1, 1, []string{"+50"}},
+		{"still above 50%", 0, 300, nil},
+		{"above two at once, in order", 1, 300, []string{"+90", "+100"}},
+		{"above 100%, which is not enforced", 1, 1000, nil},
+		{"below two at once, in order", -2, -1300, []string{"-100", "-90"}},
+		{"below the last", -2, -800, []string{"-50"}},
+		{"nothing left", 0, -1, nil},
+	} {
+		m.Add("alice", step.poems, step.bytes)
+		if got := sink.take(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got alerts %q, want %q", step.name, got, step.want)
+		}
+	}
+	if u := m.Usage(); len(u) != 0 {
+		t.Errorf("usage of a tenant without poems: %v", u)
+	}
+}
+
+func TestMeterAlertContents(t *testing.T) {
+	sink := &alerts{}
+	m, _ := NewMeter(QuotaConfig{Bytes: 100, Thresholds: []int{80}}, sink)
+	m.Add("alice", 2, 81)
+	want := QuotaAlert{Tenant: "alice", Usage: Usage{Poems: 2, Bytes: 81}, Quota: 100, Threshold: 80, Above: true}
+	if len(sink.sent) != 1 || sink.sent[0] != want {
+		t.Errorf("got %+v, want %+v", sink.sent, want)
+	}
+}
+
+func TestMeterTenants(t *testing.T) {
+	sink := &alerts{}
+	m, _ := NewMeter(QuotaConfig{Bytes: 100, Thresholds: []int{50}}, sink)
+	m.Add("alice", 1, 60)
+	m.Add("bob", 1, 40)
+	m.Add("", 1, 1000) // No tenant, no quota.
+	if len(sink.sent) != 1 || sink.sent[0].Tenant != "alice" {
+		t.Errorf("got %+v, want one alert for alice", sink.sent)
+	}
+	want := map[string]Usage{"alice": {1, 60}, "bob": {1, 40}, "": {1, 1000}}
+	if got := m.Usage(); !reflect.DeepEqual(got, want) {
+		t.Errorf("usage: got %v, want %v", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/usage", nil))
+	var body struct {
+		Quota   int64            `json:"quota"`
+		Tenants map[string]Usage `json:"tenants"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Quota != 100 || !reflect.DeepEqual(body.Tenants, want) {
+		t.Errorf("/usage: got %s, %v", rec.Body, err)
+	}
+}
+
+func TestMeterWithoutQuota(t *testing.T) {
+	sink := &alerts{}
+	m, _ := NewMeter(QuotaConfig{Thresholds: []int{50}}, sink)
+	m.Add("alice", 1, 1<<30)
+	if len(sink.sent) != 0 {
+		t.Errorf("alerts without a quota: %+v", sink.sent)
+	}
+	for _, thresholds := range [][]int{{0}, {50, -10}} {
+		if _, err := NewMeter(QuotaConfig{Bytes: 100, Thresholds: thresholds}, sink); err == nil {
+			t.Errorf("thresholds %v were accepted", thresholds)
+		}
+	}
+}
+
+// `unlisted` hides the `Lister` of a storage.
+type unlisted struct{ PoemStorage }
+
+func TestMeteredStorage(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name       string
+		wrap       func(PoemStorage) PoemStorage
+		afterSave  Usage // Counts the poems saved before only if they are listed.
+		afterLoads Usage // Counts a loaded poem that was not listed.
+	}{
+		{"listed", func(ps PoemStorage) PoemStorage { return ps }, Usage{3, 55}, Usage{3, 55}},
+		{"unlisted", func(ps PoemStorage) PoemStorage { return unlisted{ps} }, Usage{1, 25}, Usage{2, 35}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := NewFileStorage(fsys.NewMem())
+			files.Save(ctx, "alice/ode", make([]byte, 10))
+			files.Save(ctx, "alice/elegy", make([]byte, 20))
+			sink := &alerts{}
+			m, _ := NewMeter(QuotaConfig{Bytes: 100, Thresholds: []int{50, 90}}, sink)
+			ps := NewMeteredStorage(tc.wrap(files), m)
+
+			if err := ps.Save(ctx, "alice/sonnet", make([]byte, 25)); err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Usage()["alice"]; got != tc.afterSave {
+				t.Errorf("after a save: got %v, want %v", got, tc.afterSave)
+			}
+
+			ps.Load(ctx, "alice/ode")
+			ps.Load(ctx, "alice/ode")
+			want := tc.afterLoads
+			if got := m.Usage()["alice"]; got != want {
+				t.Errorf("after loads: got %v, want %v", got, want)
+			}
+
+			// Saving a poem again changes its size, not the number of poems.
+			sink.take()
+			ps.Save(ctx, "alice/sonnet", make([]byte, 90))
+			want.Bytes += 65
+			if got := m.Usage()["alice"]; got != want {
+				t.Errorf("after saving again: got %v, want %v", got, want)
+			}
+			if got := sink.take(); len(got) == 0 || got[len(got)-1] != "+90" {
+				t.Errorf("got alerts %q, want the last one +90", got)
+			}
+			ps.Save(ctx, "alice/sonnet", nil)
+			if got := sink.take(); len(got) == 0 || got[0] != "-90" {
+				t.Errorf("got alerts %q, want the first one -90", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+)
+
+// ### Reading part of a poem
+//
+// Some works are long: an epic, a collected edition. A reader who resumes
+// in the middle, or an HTTP client that asks for a byte range, needs only
+// part of it. Storages that can read part of a poem without loading all of
+// it implement `RangeReader`. For all others, the functions `ReadRange` and
+// `PoemSize` fall back to `Load`, so callers need not care which kind of
+// storage they have.
+//
+// A `Blob` turns a poem into an `io.ReaderAt`, which is what the standard
+// library builds on for partial reads. `Blob.Reader` returns an
+// `io.ReadSeeker`, so `http.ServeContent` can answer Range requests from
+// any storage; see `server.go`.
+
+// A `RangeReader` is a storage that can read part of a poem.
+type RangeReader interface {
+	// `Size` returns the length of the poem `name`.
+	Size(ctx context.Context, name string) (int64, error)
+	// `ReadRange` returns `length` bytes of the poem `name` from offset
+	// `off`, or fewer if the poem ends before.
+	ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error)
+}
+
+// `ReadRange` reads part of the poem `name` from `ps`, natively if `ps` is a
+// `RangeReader`.
+func ReadRange(ctx context.Context, ps PoemStorage, name string, off, length int64) ([]byte, error) {
+	if off < 0 || length < 0 {
+		return nil, fmt.Errorf("read %q: invalid range %d+%d", name, off, length)
+	}
+	if rr, ok := ps.(RangeReader); ok {
+		return rr.ReadRange(ctx, name, off, length)
+	}
+	contents, err := ps.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return sliceRange(contents, off, length), nil
+}
+
+// `PoemSize` returns the length of the poem `name` in `ps`.
+func PoemSize(ctx context.Context, ps PoemStorage, name string) (int64, error) {
+	if rr, ok := ps.(RangeReader); ok {
+		return rr.Size(ctx, name)
+	}
+	contents, err := ps.Load(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(contents)), nil
+}
+
+// `sliceRange` returns a copy of the range of `contents`, clipped to its end.
+func sliceRange(contents []byte, off, length int64) []byte {
+	size := int64(len(contents))
+	if off > size {
+		off = size
+	}
+	if length > size-off {
+		length = size - off
+	}
+	return append([]byte{}, contents[off:off+length]...)
+}
+
+// A `Blob` is a poem that is read in parts.
+type Blob struct {
+	ctx      context.Context
+	storage  PoemStorage
+	name     string
+	size     int64
+	contents []byte // The whole poem, if the storage is no `RangeReader`.
+}
+
+// `OpenBlob` returns the poem `name` in `ps` as a blob. The blob's size is
+// fixed when it is opened. As `io.ReaderAt` has no way to pass a context,
+// the blob reads with `ctx`, so it must not outlive it.
+//
+// A storage that is no `RangeReader` can only load the whole poem, so the
+// blob loads it once, when it is opened, and reads its parts from there.
+// Otherwise, reading a poem in n parts would load it n times.
+func OpenBlob(ctx context.Context, ps PoemStorage, name string) (*Blob, error) {
+	b := &Blob{ctx: ctx, storage: ps, name: name}
+	if _, ok := ps.(RangeReader); ok {
+		size, err := PoemSize(ctx, ps, name)
+		if err != nil {
+			return nil, err
+		}
+		b.size = size
+		return b, nil
+	}
+	contents, err := ps.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return BlobOf(name, contents), nil
+}
+
+// `BlobOf` returns a blob that reads from `contents`, a poem that is
+// already loaded.
+func BlobOf(name string, contents []byte) *Blob {
+	if contents == nil {
+		contents = []byte{}
+	}
+	return &Blob{name: name, size: int64(len(contents)), contents: contents}
+}
+
+// `ReadAt` makes a `Blob` an `io.ReaderAt`.
+func (b *Blob) ReadAt(p []byte, off int64) (int, error) {
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	var n int
+	if b.contents != nil {
+		n = copy(p, b.contents[off:])
+	} else {
+		data, err := ReadRange(b.ctx, b.storage, b.name, off, int64(len(p)))
+		if err != nil {
+			return 0, err
+		}
+		n = copy(p, data)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b *Blob) Size() int64 {
+	return b.size
+}
+
+func (b *Blob) Name() string {
+	return b.name
+}
+
+// `Reader` returns a reader of the whole blob that can seek.
+func (b *Blob) Reader() *io.SectionReader {
+	return io.NewSectionReader(b, 0, b.size)
+}
+
+// #### The backends
+//
+// The `Notebook` and the `Napkin` slice the poem they hold. Like `Load`, the
+// `Napkin` ignores the name.
+
+func (n *Notebook) Size(ctx context.Context, name string) (int64, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	contents, ok := n.poems[name]
+	if !ok {
+		return 0, ErrNoPoem
+	}
+	return int64(len(contents)), nil
+}
+
+func (n *Notebook) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	contents, ok := n.poems[name]
+	if !ok {
+		return nil, ErrNoPoem
+	}
+	return sliceRange(contents, off, length), nil
+}
+
+func (n *Napkin) Size(ctx context.Context, name string) (int64, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return int64(len(n.poem)), nil
+}
+
+func (n *Napkin) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return sliceRange(n.poem, off, length), nil
+}
+
+// The `FileStorage` reads only the range from the file, where the file
+// system allows it.
+
+func (s *FileStorage) Size(ctx context.Context, name string) (int64, error) {
+	info, err := fs.Stat(s.fs, s.file(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrNoPoem
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *FileStorage) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	f, err := s.fs.Open(s.file(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoPoem
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ra, ok := f.(io.ReaderAt)
+	info, err := f.Stat()
+	if !ok || err != nil {
+		contents, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		return sliceRange(contents, off, length), nil
+	}
+	if off > info.Size() {
+		off = info.Size()
+	}
+	if length > info.Size()-off {
+		length = info.Size() - off
+	}
+	buf := make([]byte, length)
+	n, err := ra.ReadAt(buf, off)
+	if err != nil && !(errors.Is(err, io.EOF) && int64(n) == length) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// Decorators that pass poems through unchanged pass ranges through, too.
+// Decorators that transform poems, such as `VersionedStorage`, must not:
+// a range of the stored poem is not the same range of the loaded poem.
+
+func (s *LoggingStorage) Size(ctx context.Context, name string) (int64, error) {
+	return PoemSize(ctx, s.storage, name)
+}
+
+func (s *LoggingStorage) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	data, err := ReadRange(ctx, s.storage, name, off, length)
+	s.log.Printf("%s: read %q at %d (%d bytes)", s.storage.Type(), name, off, len(data))
+	return data, err
+}
+
+func (r *ReadOnly) Size(ctx context.Context, name string) (int64, error) {
+	return PoemSize(ctx, r.storage, name)
+}
+
+func (r *ReadOnly) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	return ReadRange(ctx, r.storage, name, off, length)
+}
+
+func (s *CatalogStorage) Size(ctx context.Context, name string) (int64, error) {
+	return PoemSize(ctx, s.storage, name)
+}
+
+func (s *CatalogStorage) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	return ReadRange(ctx, s.storage, name, off, length)
+}
+
+// The `ObjectStorage` asks the object store for the range, with the header
+// `Range`. A store that ignores the header sends the whole poem, and a
+// range that starts after the end is an error of its own, 416.
+
+func (s *ObjectStorage) Size(ctx context.Context, name string) (int64, error) {
+	resp, err := s.send(ctx, http.MethodHead, s.key(name), nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+func (s *ObjectStorage) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	if length <= 0 {
+		// A range cannot be empty, but the poem must exist.
+		if _, err := s.Size(ctx, name); err != nil {
+			return nil, err
+		}
+		return []byte{}, nil
+	}
+	header := http.Header{"Range": {"bytes=" + strconv.FormatInt(off, 10) + "-" + strconv.FormatInt(off+length-1, 10)}}
+	resp, err := s.send(ctx, http.MethodGet, s.key(name), nil, header, nil)
+	var s3err *S3Error
+	if errors.As(err, &s3err) && s3err.Status == http.StatusRequestedRangeNotSatisfiable {
+		return []byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return sliceRange(contents, off, length), nil
+	}
+	return contents, nil
+}
+
+// The `RedisStorage` reads ranges with GETRANGE, whose end is inclusive.
+// Redis cannot tell an empty poem from a missing one with STRLEN, so a
+// length of 0 asks EXISTS.
+
+func (s *RedisStorage) Size(ctx context.Context, name string) (int64, error) {
+	reply, err := s.redis.Do(ctx, "STRLEN", redisPoemPrefix+name)
+	if err != nil {
+		return 0, err
+	}
+	if size, _ := reply.(int64); size > 0 {
+		return size, nil
+	}
+	reply, err = s.redis.Do(ctx, "EXISTS", redisPoemPrefix+name)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return 0, ErrNoPoem
+	}
+	return 0, nil
+}
+
+func (s *RedisStorage) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	if length <= 0 {
+		if _, err := s.Size(ctx, name); err != nil {
+			return nil, err
+		}
+		return []byte{}, nil
+	}
+	reply, err := s.redis.Do(ctx, "GETRANGE", redisPoemPrefix+name,
+		strconv.FormatInt(off, 10), strconv.FormatInt(off+length-1, 10))
+	if err != nil {
+		return nil, err
+	}
+	contents, _ := reply.(string)
+	if contents == "" {
+		// An empty range, or no poem.
+		if _, err := s.Size(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(contents), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing/iotest"
+)
+
+// #### Conformance
+//
+// `checkRanges` checks that every range of every poem in `names` that `ps`
+// reads is the same range of what `ps` loads, and that a blob of the poem
+// reads the same as `Load`, also over a storage that can only load, which
+// the blob loads once. `TestLaws` runs it on every stack.
+func checkRanges(ctx context.Context, r *rand.Rand, ps PoemStorage, names []string) error {
+	for _, name := range names {
+		contents, err := ps.Load(ctx, name)
+		if errors.Is(err, ErrNoPoem) {
+			if _, err := PoemSize(ctx, ps, name); !errors.Is(err, ErrNoPoem) {
+				return fmt.Errorf("size of missing poem %q: got %v, want ErrNoPoem", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		size, err := PoemSize(ctx, ps, name)
+		if err != nil || size != int64(len(contents)) {
+			return fmt.Errorf("size of %q: got %d, %v, want %d", name, size, err, len(contents))
+		}
+		off, length := int64(r.Intn(len(contents)+2)), int64(r.Intn(len(contents)+2))
+		data, err := ReadRange(ctx, ps, name, off, length)
+		if err != nil {
+			return fmt.Errorf("ReadRange(%q, %d, %d): %w", name, off, length, err)
+		}
+		if want := sliceRange(contents, off, length); !bytes.Equal(data, want) {
+			return fmt.Errorf("ReadRange(%q, %d, %d) = %q, want %q", name, off, length, data, want)
+		}
+		b, err := OpenBlob(ctx, ps, name)
+		if err != nil {
+			return fmt.Errorf("OpenBlob(%q): %w", name, err)
+		}
+		all, err := io.ReadAll(b.Reader())
+		if err != nil || !bytes.Equal(all, contents) {
+			return fmt.Errorf("blob %q = %q, %v, want %q", name, all, err, contents)
+		}
+
+		// A blob of a storage that can only load reads a byte at a time
+		// from one load.
+		probe := &traceProbe{PoemStorage: ps}
+		b, err = OpenBlob(ctx, probe, name)
+		if err != nil {
+			return fmt.Errorf("OpenBlob(%q) without ranges: %w", name, err)
+		}
+		all, err = io.ReadAll(iotest.OneByteReader(b.Reader()))
+		if err != nil || !bytes.Equal(all, contents) {
+			return fmt.Errorf("blob %q without ranges = %q, %v, want %q", name, all, err, contents)
+		}
+		if len(probe.ids) != 1 {
+			return fmt.Errorf("blob %q without ranges: loaded %d times, want once", name, len(probe.ids))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// A `ReadOnlyError` is returned for every mutation while a `ReadOnly` storage
+// is switched to read-only mode.
+type ReadOnlyError struct {
+	Name string // The poem that could not be saved.
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("poem storage is read-only: cannot save %q", e.Name)
+}
+
+// `ReadOnly` guards a `PoemStorage` during maintenance. While read-only mode is
+// on, loads still go through but saves are rejected before they reach the
+// backend.
+type ReadOnly struct {
+	storage  PoemStorage
+	readOnly int32 // accessed atomically
+}
+
+// `NewReadOnly` wraps `ps`. The storage starts out writable.
+func NewReadOnly(ps PoemStorage) *ReadOnly {
+	return &ReadOnly{
+		storage: ps,
+	}
+}
+
+// `SetReadOnly` switches read-only mode on or off. It is safe to call while
+// the storage is in use.
+func (r *ReadOnly) SetReadOnly(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&r.readOnly, v)
+}
+
+// `IsReadOnly` reports whether read-only mode is on.
+func (r *ReadOnly) IsReadOnly() bool {
+	return atomic.LoadInt32(&r.readOnly) == 1
+}
+
+// `Save` saves the poem unless read-only mode is on, in which case it returns
+// a `*ReadOnlyError`.
+func (r *ReadOnly) Save(ctx context.Context, name string, contents []byte) error {
+	if r.IsReadOnly() {
+		return &ReadOnlyError{Name: name}
+	}
+	return r.storage.Save(ctx, name, contents)
+}
+
+func (r *ReadOnly) Load(ctx context.Context, name string) ([]byte, error) {
+	return r.storage.Load(ctx, name)
+}
+
+func (r *ReadOnly) Type() string {
+	return r.storage.Type()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ### Schema evolution
+//
+// Stored data outlives the code that wrote it. When the format of a record
+// changes, records in the old format are still out there, in notebooks and
+// catalogs. Rather than converting them all at once, storages keep a version
+// number with every record and upgrade old records when they are loaded.
+//
+// Each format change comes with a `Migration` that upgrades a record by one
+// version. Migrations are registered in the container as members of a group,
+// so each can live next to the code that changed the format:
+//
+//	c.Provide(func() Migration { return crlfMigration }, di.Group())
+//
+// and a `Migrator` collects them all.
+
+// A `Migration` upgrades one kind of record from version `From` to
+// `From+1`.
+type Migration struct {
+	Record string // The kind of record, such as "poem" or "meta".
+	From   int
+	Up     func(data []byte) ([]byte, error)
+}
+
+// A `Migrator` writes records in their current version and upgrades old
+// records on reading. The current version of a kind of record is the one
+// that its last migration produces, or 1 if there are no migrations.
+type Migrator struct {
+	migrations map[string]map[int]Migration
+	current    map[string]int
+}
+
+// `NewMigrator` checks that the migrations of each kind of record form an
+// unbroken chain from version 0.
+func NewMigrator(ms []Migration) (*Migrator, error) {
+	m := &Migrator{
+		migrations: map[string]map[int]Migration{},
+		current:    map[string]int{},
+	}
+	for _, mg := range ms {
+		if m.migrations[mg.Record] == nil {
+			m.migrations[mg.Record] = map[int]Migration{}
+		}
+		if _, ok := m.migrations[mg.Record][mg.From]; ok {
+			return nil, fmt.Errorf("two migrations of %s records from version %d", mg.Record, mg.From)
+		}
+		m.migrations[mg.Record][mg.From] = mg
+		if mg.From+1 > m.current[mg.Record] {
+			m.current[mg.Record] = mg.From + 1
+		}
+	}
+	for record, current := range m.current {
+		// Version 0 is data from before envelopes, which upgrades to 1
+		// without a migration.
+		for v := 1; v < current; v++ {
+			if _, ok := m.migrations[record][v]; !ok {
+				return nil, fmt.Errorf("no migration of %s records from version %d", record, v)
+			}
+		}
+	}
+	return m, nil
+}
+
+// `Current` returns the version that `Seal` writes for `record`.
+func (m *Migrator) Current(record string) int {
+	if v, ok := m.current[record]; ok {
+		return v
+	}
+	return 1
+}
+
+// The envelope of a record is `envelopeMagic`, the version as a uvarint, and
+// the data. The magic starts with a byte that never starts UTF-8 text, so
+// poems from before envelopes are not mistaken for records.
+var envelopeMagic = []byte("\xffREC")
+
+// `Seal` puts `data` into an envelope of the current version.
+func (m *Migrator) Seal(record string, data []byte) []byte {
+	sealed := append([]byte{}, envelopeMagic...)
+	sealed = appendUvarint(sealed, uint64(m.Current(record)))
+	return append(sealed, data...)
+}
+
+// `Open` takes `stored` out of its envelope and upgrades it to the current
+// version. Data without an envelope is version 0.
+func (m *Migrator) Open(record string, stored []byte) ([]byte, error) {
+	version, data := 0, stored
+	if bytes.HasPrefix(stored, envelopeMagic) {
+		v, n := binary.Uvarint(stored[len(envelopeMagic):])
+		if n <= 0 {
+			return nil, errors.New(record + " record: bad envelope")
+		}
+		version, data = int(v), stored[len(envelopeMagic)+n:]
+	}
+	current := m.Current(record)
+	if version > current {
+		return nil, fmt.Errorf("%s record: version %d is newer than this program's version %d", record, version, current)
+	}
+	if version == 0 {
+		version = 1
+	}
+	for ; version < current; version++ {
+		var err error
+		if data, err = m.migrations[record][version].Up(data); err != nil {
+			return nil, fmt.Errorf("%s record: upgrading from version %d: %w", record, version, err)
+		}
+	}
+	return data, nil
+}
+
+// A `VersionedStorage` stores poems in envelopes, and upgrades poems in old
+// formats when they are loaded.
+type VersionedStorage struct {
+	storage  PoemStorage
+	migrator *Migrator
+}
+
+// `NewVersionedStorage` wraps `ps`.
+func NewVersionedStorage(ps PoemStorage, m *Migrator) *VersionedStorage {
+	return &VersionedStorage{
+		storage:  ps,
+		migrator: m,
+	}
+}
+
+func (s *VersionedStorage) Save(ctx context.Context, name string, contents []byte) error {
+	return s.storage.Save(ctx, name, s.migrator.Seal("poem", contents))
+}
+
+// `Load` fails for poems that cannot be upgraded.
+func (s *VersionedStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	stored, err := s.storage.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := s.migrator.Open("poem", stored)
+	if err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	return contents, nil
+}
+
+func (s *VersionedStorage) Type() string {
+	return s.storage.Type()
+}
+
+// #### The migrations of the example
+//
+// Early versions of the poem editor saved line breaks as "\r\n". Version 2
+// of the poem record uses "\n" throughout.
+var crlfMigration = Migration{
+	Record: "poem",
+	From:   1,
+	Up: func(data []byte) ([]byte, error) {
+		return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), nil
+	},
+}
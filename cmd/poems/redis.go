@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ### Redis
+//
+// Some parts of the example can keep their state in Redis, so that every
+// instance of the server sees it. They depend on `Redis`, an interface
+// with the one method that they need, and the container injects a
+// `RedisConn`, which talks to the server of the setting "redis.addr". The
+// example needs no Redis library for that: the protocol is simple enough
+// to speak directly.
+//
+// A `RedisConn` connects on the first command, not when it is built, so
+// wiring it costs nothing where Redis is not used.
+
+// `Redis` sends commands to a Redis server.
+type Redis interface {
+	// `Do` sends a command, such as "SET", "key", "value", and returns the
+	// reply: a string, an int64, nil, or a `[]interface{}` of replies.
+	// Errors that the server replies with are `RedisError`s.
+	Do(ctx context.Context, args ...string) (interface{}, error)
+}
+
+// A `RedisError` is an error reply of the server.
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+// A `RedisConn` is a connection to a Redis server. It sends one command at
+// a time, and reconnects after network errors.
+type RedisConn struct {
+	cfg  RedisConfig
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// `NewRedisConn` connects to the server of `cfg` on the first command.
+func NewRedisConn(cfg RedisConfig) *RedisConn {
+	return &RedisConn{cfg: cfg}
+}
+
+func (c *RedisConn) Do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.do(ctx, args)
+	var rerr RedisError
+	if err != nil && !errors.As(err, &rerr) {
+		// The connection is in an unknown state.
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+func (c *RedisConn) dial(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	var setup [][]string
+	if c.cfg.Password != "" {
+		setup = append(setup, []string{"AUTH", c.cfg.Password})
+	}
+	if c.cfg.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.cfg.DB)})
+	}
+	for _, cmd := range setup {
+		if _, err := c.do(ctx, cmd); err != nil {
+			conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// `do` sends a command and reads the reply. The caller holds `c.mu`. If
+// `ctx` is cancelled while the command is on its way, `do` moves the
+// deadline of the connection to now, which fails the read or write; `Do`
+// then drops the connection.
+func (c *RedisConn) do(ctx context.Context, args []string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if c.cfg.Timeout > 0 {
+		if d := time.Now().Add(c.cfg.Timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	conn := c.conn
+	conn.SetDeadline(deadline)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	reply, err := c.roundTrip(args)
+	var rerr RedisError
+	if err == nil || errors.As(err, &rerr) {
+		return reply, err
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("redis: %w", ctx.Err())
+	}
+	// The connection may time out a moment before the context does.
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return nil, fmt.Errorf("redis: %w", context.DeadlineExceeded)
+	}
+	return nil, err
+}
+
+// `roundTrip` writes a command and reads the reply.
+func (c *RedisConn) roundTrip(args []string) (interface{}, error) {
+	w := bufio.NewWriter(c.conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	reply, err := readReply(c.r)
+	var rerr RedisError
+	if err != nil && !errors.As(err, &rerr) {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return reply, err
+}
+
+// `readReply` reads a reply in the Redis serialization protocol.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, RedisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err // "$-1" is nil.
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err // "*-1" is nil.
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			// An error inside an array is an element, not a failure.
+			reply, err := readReply(r)
+			var rerr RedisError
+			switch {
+			case errors.As(err, &rerr):
+				replies[i] = rerr
+			case err != nil:
+				return nil, err
+			default:
+				replies[i] = reply
+			}
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("malformed reply %q", line)
+}
+
+// `Close` closes the connection, if there is one.
+func (c *RedisConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// #### Poems in Redis
+//
+// A `RedisStorage` keeps each poem under the key "poems:poem:<name>". It
+// gets the `Redis` injected rather than a connection of its own, so it
+// shares the connection with the other users of Redis, and the laws check
+// it against a fake.
+//
+// Redis forgets keys that have a time to live, so the `RedisStorage` is an
+// `Expirer`; see `expiry.go`. A plain `Save` keeps a poem for the setting
+// "storage.redis.ttl", or forever if that is 0. Redis also reads ranges of
+// a value and lists keys, so the storage is a `RangeReader` and a `Lister`
+// as well.
+
+// `RedisStorage` keeps poems in Redis.
+type RedisStorage struct {
+	redis Redis
+	ttl   time.Duration
+}
+
+// `NewRedisStorage` keeps poems in `r`. Poems that `Save` saves expire
+// after `ttl`, unless it is 0.
+func NewRedisStorage(r Redis, ttl time.Duration) *RedisStorage {
+	return &RedisStorage{redis: r, ttl: ttl}
+}
+
+// `redisPoemPrefix` starts the keys of poems.
+const redisPoemPrefix = "poems:poem:"
+
+// `set` saves a poem, replacing the poem of the same name, and its time
+// to live, which its metadata shares; see `metadata.go`.
+func (s *RedisStorage) set(ctx context.Context, name string, contents []byte, ttl time.Duration) error {
+	args := []string{"SET", redisPoemPrefix + name, string(contents)}
+	var ms int64
+	if ttl > 0 {
+		// Redis rounds down; a TTL below a millisecond would be an error.
+		ms = ttl.Milliseconds()
+		if ms == 0 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	if _, err := s.redis.Do(ctx, args...); err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	if err := s.expireMeta(ctx, name, ms); err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	return nil
+}
+
+func (s *RedisStorage) Save(ctx context.Context, name string, contents []byte) error {
+	return s.set(ctx, name, contents, s.ttl)
+}
+
+// `Load` returns `ErrNoPoem` for poems that have expired, too.
+func (s *RedisStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	reply, err := s.redis.Do(ctx, "GET", redisPoemPrefix+name)
+	if err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	contents, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+	}
+	return []byte(contents), nil
+}
+
+func (s *RedisStorage) Type() string {
+	return "RedisStorage"
+}
+
+// `SaveFor` and `TTL` make the `RedisStorage` an `Expirer`.
+
+func (s *RedisStorage) SaveFor(ctx context.Context, name string, contents []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("save %q: time to live %v is not positive", name, ttl)
+	}
+	return s.set(ctx, name, contents, ttl)
+}
+
+func (s *RedisStorage) TTL(ctx context.Context, name string) (time.Duration, error) {
+	reply, err := s.redis.Do(ctx, "PTTL", redisPoemPrefix+name)
+	if err != nil {
+		return 0, fmt.Errorf("TTL of %q: %w", name, err)
+	}
+	// -2 is a missing key, -1 a key that does not expire.
+	switch ms, _ := reply.(int64); {
+	case ms == -2:
+		return 0, ErrNoPoem
+	case ms < 0:
+		return 0, nil
+	default:
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ### Rendering poems
+//
+// Browsers want HTML, scripts want JSON, and `curl` is happy with plain
+// text. The `PoemHandler` leaves the formats to `Renderer`s, which the
+// container injects as the members of the group named "renderers":
+//
+//	c.Provide(func() Renderer { return JSONRenderer{} }, di.Group(), di.Named("renderers"))
+//
+// For each request, the handler picks the renderer whose media type the
+// client's Accept header prefers. A new format is a new group member; the
+// handler does not change.
+
+// A `Renderer` formats poems in one media type.
+type Renderer interface {
+	// `ContentType` returns the media type with parameters, such as
+	// "text/html; charset=utf-8".
+	ContentType() string
+
+	// `Render` returns the formatted poem. The reader must be able to
+	// seek, so that the handler can serve ranges of it.
+	Render(b *Blob) (io.ReadSeeker, error)
+}
+
+// `PlainRenderer` serves poems as they are. It does not copy the poem, so
+// ranges of it are read from the blob as needed.
+type PlainRenderer struct{}
+
+func (PlainRenderer) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (PlainRenderer) Render(b *Blob) (io.ReadSeeker, error) {
+	return b.Reader(), nil
+}
+
+// `HTMLRenderer` renders a poem as a web page, with the template
+// "poem.html"; see `templates.go`.
+type HTMLRenderer struct {
+	templates TemplateRenderer
+}
+
+// `NewHTMLRenderer` renders poems with `t`.
+func NewHTMLRenderer(t TemplateRenderer) *HTMLRenderer {
+	return &HTMLRenderer{templates: t}
+}
+
+func (*HTMLRenderer) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+func (r *HTMLRenderer) Render(b *Blob) (io.ReadSeeker, error) {
+	contents, err := io.ReadAll(b.Reader())
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = r.templates.Render(&buf, "poem.html", struct{ Name, Poem string }{b.Name(), string(contents)})
+	return bytes.NewReader(buf.Bytes()), err
+}
+
+// `JSONRenderer` renders a poem as a JSON object with its name and text.
+type JSONRenderer struct{}
+
+func (JSONRenderer) ContentType() string {
+	return "application/json"
+}
+
+func (JSONRenderer) Render(b *Blob) (io.ReadSeeker, error) {
+	contents, err := io.ReadAll(b.Reader())
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(struct {
+		Name string `json:"name"`
+		Poem string `json:"poem"`
+	}{b.Name(), string(contents)})
+	return bytes.NewReader(data), err
+}
+
+// #### Negotiation
+//
+// `negotiate` returns the renderer that `accept`, the value of an Accept
+// header, prefers. Every renderer gets the quality of the most specific
+// media range that matches it, so "text/*;q=0.5, text/html" ranks HTML
+// over plain text. Among renderers of the same quality, the first one
+// wins, which makes the order of registration the server's preference. An
+// empty header accepts anything. If no renderer is acceptable,
+// `negotiate` reports false.
+func negotiate(accept string, renderers []Renderer) (Renderer, bool) {
+	types := make([]string, len(renderers))
+	for i, r := range renderers {
+		types[i] = mediaType(r.ContentType())
+	}
+	i := preferred(accept, types)
+	if i < 0 {
+		return nil, false
+	}
+	return renderers[i], true
+}
+
+// `preferred` returns the index of the media type in `types` that `accept`
+// prefers, as `negotiate` picks renderers, or -1 if none is acceptable.
+func preferred(accept string, types []string) int {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+	ranges := parseAccept(accept)
+	best, bestQ := -1, 0.0
+	for i, typ := range types {
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			if s := mr.match(typ); s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// A `mediaRange` is an entry of an Accept header, such as "text/*;q=0.8".
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// `parseAccept` parses an Accept header. Entries that cannot be parsed are
+// skipped.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, entry := range strings.Split(accept, ",") {
+		params := strings.Split(entry, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+		mr := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k, "q") {
+				if q, err := strconv.ParseFloat(v, 64); err == nil && q >= 0 && q <= 1 {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+// `match` returns how specifically the range matches the media type `typ`:
+// 2 for the type itself, 1 for "type/*", 0 for "*/*", and -1 if it does
+// not match.
+func (mr mediaRange) match(typ string) int {
+	t, s, _ := strings.Cut(typ, "/")
+	switch {
+	case mr.typ == t && mr.subtype == s:
+		return 2
+	case mr.typ == t && mr.subtype == "*":
+		return 1
+	case mr.typ == "*" && mr.subtype == "*":
+		return 0
+	}
+	return -1
+}
+
+// `mediaType` returns the media type of a content type, without
+// parameters, in lower case.
+func mediaType(contentType string) string {
+	typ, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(typ))
+}
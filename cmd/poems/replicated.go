@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### Replication
+//
+// A `FanOut` copies poems, but it goes down with the first of its backends
+// that fails. A `ReplicatedStorage` keeps going: it saves every poem to all
+// of its replicas at once, and loads it from the first replica that is
+// healthy. A replica that fails, with any error but `ErrNoPoem`, is
+// unhealthy for `replicaRetry`. During that time, loads ask it only
+// when no healthy replica can answer, and saves still go to it, so that a
+// replica that has recovered has all poems from then on. Poems that it
+// missed while it was down are not copied to it. A replica that gives up
+// because the caller's context is done has not failed, and stays healthy.
+//
+// Like the `FanOut`, the replicas come from the container as the group
+// "replicas". How many of them must take part is up to a `Consistency`,
+// which the setting "replication.consistency" selects:
+//
+//   - "one" saves to one replica at least, and loads from one.
+//   - "quorum" saves to a majority, and loads what a majority agrees on.
+//     As every two majorities share a replica, loads see every save that
+//     succeeded.
+//   - "all" saves to every replica, and loads from one.
+//
+// A save that too few replicas take fails, but the replicas that took it
+// keep the poem.
+
+// A `Consistency` decides how many of `n` replicas must take part in saves
+// and loads.
+type Consistency interface {
+	// `WriteAcks` is the number of replicas that must save a poem.
+	WriteAcks(n int) int
+	// `ReadAcks` is the number of replicas that must agree on a poem.
+	ReadAcks(n int) int
+}
+
+// `ConsistencyOne` needs one replica for saves and for loads.
+type ConsistencyOne struct{}
+
+func (ConsistencyOne) WriteAcks(int) int { return 1 }
+func (ConsistencyOne) ReadAcks(int) int  { return 1 }
+
+// `ConsistencyQuorum` needs a majority of the replicas for saves and for
+// loads.
+type ConsistencyQuorum struct{}
+
+func (ConsistencyQuorum) WriteAcks(n int) int { return n/2 + 1 }
+func (ConsistencyQuorum) ReadAcks(n int) int  { return n/2 + 1 }
+
+// `ConsistencyAll` needs every replica for saves, and one for loads.
+type ConsistencyAll struct{}
+
+func (ConsistencyAll) WriteAcks(n int) int { return n }
+func (ConsistencyAll) ReadAcks(int) int    { return 1 }
+
+// `consistencies` are the consistencies by their names in the settings.
+var consistencies = map[string]Consistency{
+	"one":    ConsistencyOne{},
+	"quorum": ConsistencyQuorum{},
+	"all":    ConsistencyAll{},
+}
+
+// `replicaRetry` is how long a replica that failed counts as unhealthy.
+const replicaRetry = 30 * time.Second
+
+// `ReplicatedStorage` keeps every poem in several replicas.
+type ReplicatedStorage struct {
+	replicas    []PoemStorage
+	consistency Consistency
+	now         func() time.Time
+
+	mu        sync.Mutex
+	downUntil []time.Time // When each replica is healthy again.
+}
+
+// `NewReplicatedStorage` returns a storage that replicates poems to
+// `replicas` with `consistency`.
+func NewReplicatedStorage(consistency Consistency, replicas ...PoemStorage) *ReplicatedStorage {
+	return &ReplicatedStorage{
+		replicas:    replicas,
+		consistency: consistency,
+		now:         time.Now,
+		downUntil:   make([]time.Time, len(replicas)),
+	}
+}
+
+// `Save` saves the poem `name` to all replicas, and fails if fewer than
+// the consistency needs have saved it.
+func (s *ReplicatedStorage) Save(ctx context.Context, name string, contents []byte) error {
+	errs := make([]error, len(s.replicas))
+	var wg sync.WaitGroup
+	for i := range s.replicas {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.call(ctx, i, func(ps PoemStorage) error { return ps.Save(ctx, name, contents) })
+		}(i)
+	}
+	wg.Wait()
+	acks, first := 0, error(nil)
+	for _, err := range errs {
+		if err == nil {
+			acks++
+		} else if first == nil {
+			first = err
+		}
+	}
+	need := s.consistency.WriteAcks(len(s.replicas))
+	if acks < need && ctx.Err() != nil {
+		return fmt.Errorf("save %q: %w", name, ctx.Err())
+	}
+	if acks < need && first == nil {
+		return fmt.Errorf("save %q: %d replicas, want %d", name, len(s.replicas), need)
+	}
+	if acks < need {
+		return fmt.Errorf("save %q: %d of %d replicas saved it, want %d: %w", name, acks, len(s.replicas), need, first)
+	}
+	return nil
+}
+
+// `Load` loads the poem `name` from healthy replicas first, until as many
+// agree as the consistency needs. It returns `ErrNoPoem` if they agree
+// that there is no such poem.
+func (s *ReplicatedStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	need := s.consistency.ReadAcks(len(s.replicas))
+	votes := map[string]int{}
+	var first error
+	for _, i := range s.order() {
+		var contents []byte
+		missing := false
+		err := s.call(ctx, i, func(ps PoemStorage) error {
+			var err error
+			contents, err = ps.Load(ctx, name)
+			if errors.Is(err, ErrNoPoem) {
+				missing = true
+				return nil
+			}
+			return err
+		})
+		if err != nil && ctx.Err() != nil {
+			return nil, fmt.Errorf("load %q: %w", name, ctx.Err())
+		}
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		// A missing poem and an empty one are different answers.
+		vote := "missing"
+		if !missing {
+			vote = sum(contents)
+		}
+		if votes[vote]++; votes[vote] < need {
+			continue
+		}
+		if missing {
+			return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+		}
+		return contents, nil
+	}
+	if first == nil {
+		return nil, fmt.Errorf("load %q: replicas disagree, want %d alike", name, need)
+	}
+	return nil, fmt.Errorf("load %q: too few replicas agree, want %d: %w", name, need, first)
+}
+
+func (s *ReplicatedStorage) Type() string {
+	types := make([]string, len(s.replicas))
+	for i, r := range s.replicas {
+		types[i] = r.Type()
+	}
+	return "Replicated(" + strings.Join(types, ", ") + ")"
+}
+
+// `Healthy` reports which replicas are healthy.
+func (s *ReplicatedStorage) Healthy() []bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	healthy := make([]bool, len(s.replicas))
+	for i, until := range s.downUntil {
+		healthy[i] = !now.Before(until)
+	}
+	return healthy
+}
+
+// `order` returns the indexes of the healthy replicas, then those of the
+// others.
+func (s *ReplicatedStorage) order() []int {
+	var healthy, down []int
+	for i, ok := range s.Healthy() {
+		if ok {
+			healthy = append(healthy, i)
+		} else {
+			down = append(down, i)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// `call` calls `fn` with replica `i`, and records the health of the
+// replica, unless `ctx` is done.
+func (s *ReplicatedStorage) call(ctx context.Context, i int, fn func(PoemStorage) error) error {
+	err := fn(s.replicas[i])
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("replica %d (%s): %w", i, s.replicas[i].Type(), err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.downUntil[i] = s.now().Add(replicaRetry)
+		return fmt.Errorf("replica %d (%s): %w", i, s.replicas[i].Type(), err)
+	}
+	s.downUntil[i] = time.Time{}
+	return nil
+}
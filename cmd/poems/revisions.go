@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ### Revisions
+//
+// Two poets who edit the same poem at once each load it, change it, and
+// save it. The second save wins, and the first poet's change is lost
+// without anyone noticing. Optimistic concurrency control notices: every
+// poem has a revision number, which each save increments, and a poet saves
+// with `SaveIf`, which only saves if the poem is still at the revision that
+// the poet loaded. Otherwise it returns a `*ConflictError`, and the poet
+// loads the poem again and reapplies the change; a `WritePoem` without a
+// revision does that in a loop.
+//
+// Storages that keep revisions with the poems implement `Revisioner`, and
+// compare and save in one step, such as the `SQLiteStorage` in a single
+// UPDATE. For all others, `Revisions` emulates them: it counts the saves
+// that go through it, and compares and saves under a lock. That is only
+// safe while all saves to the storage go through the same emulation, as
+// the saves of the use cases do, and the counts start over when the program
+// does.
+
+// A `Revision` numbers the saves of a poem, starting at 1. Revision 0 is a
+// poem that does not exist, so `SaveIf` with 0 only creates poems.
+type Revision uint64
+
+// A `Revisioner` is a storage that keeps the revisions of its poems.
+type Revisioner interface {
+	// `Revision` returns the revision of the poem `name`, or 0 if there is
+	// no such poem.
+	Revision(ctx context.Context, name string) (Revision, error)
+
+	// `SaveIf` saves the poem `name` if it is at revision `expected`, and
+	// returns the new revision. Otherwise, it returns a `*ConflictError`.
+	SaveIf(ctx context.Context, name string, contents []byte, expected Revision) (Revision, error)
+}
+
+// `ErrConflict` matches every `*ConflictError` with `errors.Is`.
+var ErrConflict = errors.New("revision conflict")
+
+// A `ConflictError` is returned for saves of a poem that has changed since
+// its expected revision.
+type ConflictError struct {
+	Name     string
+	Expected Revision
+	Actual   Revision
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("poem %q is at revision %d, not %d", e.Name, e.Actual, e.Expected)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// `Revisions` returns `ps` if it is a `Revisioner`, or else an emulation
+// on top of it. Callers keep the emulation, which holds the counts.
+func Revisions(ps PoemStorage) Revisioner {
+	if rv, ok := ps.(Revisioner); ok {
+		return rv
+	}
+	return &emulatedRevisions{storage: ps, revisions: map[string]Revision{}}
+}
+
+// `emulatedRevisions` counts the saves of a storage without revisions. A
+// poem that it has not seen saved is at revision 1 if it exists.
+type emulatedRevisions struct {
+	storage   PoemStorage
+	mu        sync.Mutex
+	revisions map[string]Revision
+}
+
+func (e *emulatedRevisions) Revision(ctx context.Context, name string) (Revision, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.revision(ctx, name)
+}
+
+// `revision` returns the revision of `name`. The caller holds `e.mu`.
+func (e *emulatedRevisions) revision(ctx context.Context, name string) (Revision, error) {
+	if rev, ok := e.revisions[name]; ok {
+		return rev, nil
+	}
+	_, err := e.storage.Load(ctx, name)
+	if errors.Is(err, ErrNoPoem) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func (e *emulatedRevisions) SaveIf(ctx context.Context, name string, contents []byte, expected Revision) (Revision, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rev, err := e.revision(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if rev != expected {
+		return 0, &ConflictError{Name: name, Expected: expected, Actual: rev}
+	}
+	if err := e.storage.Save(ctx, name, contents); err != nil {
+		return 0, err
+	}
+	e.revisions[name] = rev + 1
+	return rev + 1, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// #### Conformance
+//
+// `checkRevisions` checks that a save at the current revision of each poem
+// in `names` increments it, and that a save at the old revision then
+// conflicts and leaves the poem alone. `TestLaws` runs it on every stack.
+func checkRevisions(ctx context.Context, ps PoemStorage, names []string) error {
+	rv := Revisions(ps)
+	for _, name := range names {
+		rev, err := rv.Revision(ctx, name)
+		if err != nil {
+			return fmt.Errorf("revision of %q: %w", name, err)
+		}
+		_, err = ps.Load(ctx, name)
+		if err != nil && !errors.Is(err, ErrNoPoem) {
+			return err
+		}
+		if exists := err == nil; exists != (rev != 0) {
+			return fmt.Errorf("revision of %q: got %d for a poem that exists: %v", name, rev, exists)
+		}
+		next, err := rv.SaveIf(ctx, name, []byte("revised"), rev)
+		if err != nil || next != rev+1 {
+			return fmt.Errorf("save %q at revision %d: got %d, %v, want %d", name, rev, next, err, rev+1)
+		}
+		_, err = rv.SaveIf(ctx, name, []byte("stale"), rev)
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) || conflict.Actual != next {
+			return fmt.Errorf("save %q at stale revision %d: got %v, want a conflict at %d", name, rev, err, next)
+		}
+		if got, err := ps.Load(ctx, name); err != nil || string(got) != "revised" {
+			return fmt.Errorf("load %q after a conflict: got %q, %v, want %q", name, got, err, "revised")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ### Sagas
+//
+// Some operations take several steps, each in a system of its own, and no
+// transaction spans them all. Publishing an anthology renders the poems
+// into a page, uploads the page, and tells the readers; see `publish.go`.
+// If the upload fails, the readers must not hear of it, and if telling
+// them fails, the page must come down again.
+//
+// A `Saga` runs such steps in order. Each `Step` knows how to do its part
+// and how to undo it. When a step fails, the saga compensates it and the
+// steps before it, the last one first, and then reports the failure. The
+// failed step is compensated, too, as it may have done part of its work.
+// The steps are injected: the saga knows their order, not what they do.
+//
+// The saga saves its state after every step, as JSON, in a `PoemStorage`.
+// If the program stops in the middle, `Resume` picks up where the saga
+// left off: it does the step again that was running, or goes on
+// compensating. So steps must tolerate being done or compensated twice,
+// and compensating work that was never done. A step passes what later
+// steps and its own compensation need in the `Data` of the state. Before
+// it does something that it cannot tell apart from its own work later,
+// it saves the state with `Checkpoint`.
+//
+// A cancelled context stops a saga without compensating, as the
+// compensation could not run on that context either. The saga stays
+// unfinished, and `Resume` continues it.
+
+// A `Step` is a part of a saga that can be undone.
+type Step interface {
+	// `Name` names the step in the state and in errors.
+	Name() string
+	// `Do` does the work of the step.
+	Do(ctx context.Context, s *SagaState) error
+	// `Compensate` undoes what `Do` did, or any part of it.
+	Compensate(ctx context.Context, s *SagaState) error
+}
+
+// A `SagaStatus` tells how far a saga got.
+type SagaStatus string
+
+const (
+	SagaRunning      SagaStatus = "running"
+	SagaCompleted    SagaStatus = "completed"
+	SagaCompensating SagaStatus = "compensating"
+	SagaCompensated  SagaStatus = "compensated"
+	// A step could not be compensated. Someone has to look at it.
+	SagaFailed SagaStatus = "failed"
+)
+
+// `SagaState` is the state of a run of a saga, as it is saved.
+type SagaState struct {
+	ID     string     `json:"id"`
+	Saga   string     `json:"saga"`
+	Status SagaStatus `json:"status"`
+	// While running, `Next` is the step to do next. While compensating,
+	// the steps before `Next` are left to compensate.
+	Next  int               `json:"next"`
+	Error string            `json:"error,omitempty"` // What made the saga compensate or fail.
+	Data  map[string]string `json:"data"`
+
+	saga *Saga
+}
+
+// `Finished` reports whether the saga has nothing left to do.
+func (s *SagaState) Finished() bool {
+	return s.Status != SagaRunning && s.Status != SagaCompensating
+}
+
+// `Checkpoint` saves the state in the middle of a step.
+func (s *SagaState) Checkpoint(ctx context.Context) error {
+	return s.saga.save(ctx, s)
+}
+
+// `ErrSagaUnfinished` is returned when a saga is started with the ID of a
+// run that has not finished. That run must be resumed instead.
+var ErrSagaUnfinished = errors.New("saga is unfinished")
+
+// A `Saga` runs steps in order, and compensates them if one fails.
+type Saga struct {
+	name  string
+	store PoemStorage
+	steps []Step
+}
+
+// `NewSaga` runs `steps` in order, and saves its state in `store`.
+func NewSaga(name string, store PoemStorage, steps ...Step) *Saga {
+	return &Saga{name: name, store: store, steps: steps}
+}
+
+// `Start` runs the saga as `id` with `data`. A finished run of the same ID
+// is started over. The state is the state at the end, and the error, if
+// any, is the failure of a step or of the saga itself.
+func (g *Saga) Start(ctx context.Context, id string, data map[string]string) (*SagaState, error) {
+	old, err := g.State(ctx, id)
+	switch {
+	case err == nil && !old.Finished():
+		return old, fmt.Errorf("saga %s %q: %w", g.name, id, ErrSagaUnfinished)
+	case err != nil && !errors.Is(err, ErrNoPoem):
+		return nil, err
+	}
+	s := &SagaState{ID: id, Saga: g.name, Status: SagaRunning, Data: map[string]string{}, saga: g}
+	for k, v := range data {
+		s.Data[k] = v
+	}
+	if err := g.save(ctx, s); err != nil {
+		return nil, err
+	}
+	return g.run(ctx, s)
+}
+
+// `Resume` continues the run `id` where it left off. For a finished run,
+// it only returns the state, with the error that the run ended with.
+func (g *Saga) Resume(ctx context.Context, id string) (*SagaState, error) {
+	s, err := g.State(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return g.run(ctx, s)
+}
+
+// `State` loads the state of the run `id`. It returns `ErrNoPoem` if
+// there is no such run.
+func (g *Saga) State(ctx context.Context, id string) (*SagaState, error) {
+	data, err := g.store.Load(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("saga %s %q: %w", g.name, id, err)
+	}
+	s := &SagaState{saga: g}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("saga %s %q: %w", g.name, id, err)
+	}
+	if s.Saga != g.name || s.Next < 0 || s.Next > len(g.steps) {
+		return nil, fmt.Errorf("saga %s %q: state belongs to another saga", g.name, id)
+	}
+	if s.Data == nil {
+		s.Data = map[string]string{}
+	}
+	return s, nil
+}
+
+func (g *Saga) save(ctx context.Context, s *SagaState) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := g.store.Save(ctx, s.ID, data); err != nil {
+		return fmt.Errorf("saga %s %q: save state: %w", g.name, s.ID, err)
+	}
+	return nil
+}
+
+// `run` does the steps from `s.Next` on, and compensates if one fails.
+func (g *Saga) run(ctx context.Context, s *SagaState) (*SagaState, error) {
+	var failure error
+	for s.Status == SagaRunning && s.Next < len(g.steps) {
+		step := g.steps[s.Next]
+		if err := step.Do(ctx, s); err != nil {
+			if ctx.Err() != nil {
+				return s, fmt.Errorf("saga %s %q: %s: %w", g.name, s.ID, step.Name(), err)
+			}
+			failure = fmt.Errorf("%s: %w", step.Name(), err)
+			s.Status, s.Error = SagaCompensating, failure.Error()
+		}
+		s.Next++
+		if err := g.save(ctx, s); err != nil {
+			return s, err
+		}
+	}
+	if s.Status == SagaRunning {
+		s.Status = SagaCompleted
+		if err := g.save(ctx, s); err != nil {
+			return s, err
+		}
+	}
+	for s.Status == SagaCompensating && s.Next > 0 {
+		step := g.steps[s.Next-1]
+		if err := step.Compensate(ctx, s); err != nil {
+			if ctx.Err() != nil {
+				return s, fmt.Errorf("saga %s %q: compensate %s: %w", g.name, s.ID, step.Name(), err)
+			}
+			s.Status = SagaFailed
+			s.Error += fmt.Sprintf("; compensate %s: %v", step.Name(), err)
+		} else {
+			s.Next--
+		}
+		if err := g.save(ctx, s); err != nil {
+			return s, err
+		}
+	}
+	if s.Status == SagaCompensating {
+		s.Status = SagaCompensated
+		if err := g.save(ctx, s); err != nil {
+			return s, err
+		}
+	}
+	if s.Status == SagaCompleted {
+		return s, nil
+	}
+	if failure == nil {
+		// The failure happened in an earlier run; only its text is left.
+		failure = errors.New(s.Error)
+	}
+	return s, fmt.Errorf("saga %s %q %s: %w", g.name, s.ID, s.Status, failure)
+}
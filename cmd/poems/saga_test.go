@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// #### Conformance
+//
+// `checkSaga` runs a saga of steps that record what they do, in a
+// notebook. One of the steps fails, or none, and the run is cancelled
+// after a random number of steps and then resumed. Either way, every step
+// before the failure must have been done, and after a failure, every step
+// up to it compensated, in reverse, with the state saved as it went.
+// `TestLaws` runs it once.
+func checkSaga(ctx context.Context, r *rand.Rand) error {
+	const steps = 4
+	var log []string
+	fail := r.Intn(steps + 1) // `steps` means that no step fails.
+	stop := r.Intn(2 * steps)
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var ss []Step
+	for i := 0; i < steps; i++ {
+		ss = append(ss, &testStep{name: fmt.Sprint(i), fails: i == fail, log: &log, stop: func() {
+			if stop--; stop == 0 {
+				cancel()
+			}
+		}})
+	}
+	store := NewNotebook()
+	g := NewSaga("check", store, ss...)
+	s, err := g.Start(cctx, "run", map[string]string{"seen": ""})
+	if cctx.Err() != nil {
+		if !errors.Is(err, context.Canceled) || s.Finished() {
+			return fmt.Errorf("cancelled saga: got %v, %s", err, s.Status)
+		}
+		if _, err := g.Start(ctx, "run", nil); !errors.Is(err, ErrSagaUnfinished) {
+			return fmt.Errorf("start of an unfinished saga: got %v, want ErrSagaUnfinished", err)
+		}
+		s, err = g.Resume(ctx, "run")
+	}
+	saved, lerr := g.State(ctx, "run")
+	if lerr != nil {
+		return lerr
+	}
+	if saved.Status != s.Status || saved.Next != s.Next || saved.Data["seen"] != s.Data["seen"] {
+		return fmt.Errorf("saved state %+v differs from %+v", saved, s)
+	}
+
+	// The steps may run twice around the cancellation, so only the last
+	// run of each counts.
+	var want []string
+	for i := 0; i < steps && i <= fail; i++ {
+		want = append(want, fmt.Sprintf("do %d", i))
+	}
+	if fail == steps {
+		if err != nil || s.Status != SagaCompleted {
+			return fmt.Errorf("saga without failures: got %v, %s", err, s.Status)
+		}
+	} else {
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("step %d failed", fail)) || s.Status != SagaCompensated {
+			return fmt.Errorf("saga with failing step %d: got %v, %s", fail, err, s.Status)
+		}
+		for i := fail; i >= 0; i-- {
+			want = append(want, fmt.Sprintf("undo %d", i))
+		}
+	}
+	got := dedupe(log)
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		return fmt.Errorf("saga with failing step %d, cancelled at %d: got %q, want %q", fail, stop, got, want)
+	}
+	if s.Data["seen"] != strings.Join(got, ",") {
+		return fmt.Errorf("state data: got %q, want %q", s.Data["seen"], strings.Join(got, ","))
+	}
+	return nil
+}
+
+// A `testStep` logs what it does, in the log and in the state.
+type testStep struct {
+	name  string
+	fails bool
+	log   *[]string
+	stop  func()
+}
+
+func (t *testStep) Name() string { return "step " + t.name }
+
+func (t *testStep) Do(ctx context.Context, s *SagaState) error {
+	return t.record(ctx, s, "do "+t.name)
+}
+
+func (t *testStep) Compensate(ctx context.Context, s *SagaState) error {
+	return t.record(ctx, s, "undo "+t.name)
+}
+
+func (t *testStep) record(ctx context.Context, s *SagaState, what string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	*t.log = append(*t.log, what)
+	s.Data["seen"] = strings.Join(dedupe(*t.log), ",")
+	t.stop()
+	if err := ctx.Err(); err != nil {
+		return err // The work is done, but the saga does not know it.
+	}
+	if t.fails && strings.HasPrefix(what, "do") {
+		return errors.New(t.Name() + " failed")
+	}
+	return nil
+}
+
+// `dedupe` drops entries that repeat the entry before them.
+func dedupe(log []string) []string {
+	var out []string
+	for i, e := range log {
+		if i == 0 || e != log[i-1] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
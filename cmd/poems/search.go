@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ### Search
+//
+// A poet who remembers a line but not the title finds the poem by its
+// words. Storages that can do so implement `Searcher`. The
+// `IndexedStorage` of `index.go` makes any storage one: it keeps the
+// words of every poem that it saves in an `Index` in memory, and forgets
+// them when it deletes the poem. It knows only the poems that pass through
+// it; poems that were there before, or that go away on their own, such as
+// poems that expire, are known once `Rebuild` has read them again.
+//
+// Storages cannot search their poems without reading all of them, so
+// `Search` does not fall back to that: it returns `ErrNoSearch` for
+// storages that are not `Searcher`s.
+
+// A `Searcher` is a storage that finds poems by their words.
+type Searcher interface {
+	// `Search` returns the names of the poems that contain all words of
+	// `query`, sorted. Case and punctuation around words do not matter.
+	// A query without words finds nothing.
+	Search(query string) ([]string, error)
+}
+
+// `ErrNoSearch` is returned for storages that cannot search their poems.
+var ErrNoSearch = errors.New("storage cannot search poems")
+
+// `Search` returns the names of the poems in `ps` that contain all words
+// of `query`, if `ps` is a `Searcher`.
+func Search(ps PoemStorage, query string) ([]string, error) {
+	if s, ok := ps.(Searcher); ok {
+		return s.Search(query)
+	}
+	return nil, fmt.Errorf("search %s: %w", ps.Type(), ErrNoSearch)
+}
+
+// `Search` returns the names of the poems that contain all words of
+// `query`, sorted.
+func (i *Index) Search(query string) []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	ws := words(query)
+	if len(ws) == 0 {
+		return nil
+	}
+	var names []string
+	for name := range i.words[ws[0]] {
+		all := true
+		for _, w := range ws[1:] {
+			if !i.words[w][name] {
+				all = false
+				break
+			}
+		}
+		if all {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// #### The indexed storage
+
+func (s *IndexedStorage) Search(query string) ([]string, error) {
+	return s.index.Search(query), nil
+}
+
+// `Delete` forgets the poem also if the storage has none by its name, so
+// that a poem that went away on its own is not found any longer.
+func (s *IndexedStorage) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := Delete(ctx, s.storage, name)
+	if err == nil || errors.Is(err, ErrNoPoem) {
+		s.index.Remove(name)
+	}
+	return err
+}
+
+func (s *IndexedStorage) Exists(ctx context.Context, name string) (bool, error) {
+	return Exists(ctx, s.storage, name)
+}
+
+func (s *IndexedStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	l, ok := s.storage.(Lister)
+	if !ok {
+		return nil, "", ErrNotListable
+	}
+	return l.List(ctx, after, limit)
+}
+
+// Decorators that pass poems through unchanged pass searches through.
+// Those that change poems on their way, such as the `EncryptedStorage`, do
+// not: their storage has the poems in another form than their callers.
+
+func (s *LoggingStorage) Search(query string) ([]string, error) {
+	return Search(s.storage, query)
+}
+
+func (r *ReadOnly) Search(query string) ([]string, error) {
+	return Search(r.storage, query)
+}
+
+func (s *CatalogStorage) Search(query string) ([]string, error) {
+	return Search(s.storage, query)
+}
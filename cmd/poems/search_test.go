@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// #### Conformance
+//
+// `checkSearch` checks that a `Searcher` finds the poems in `names` as a
+// search through all of them would: for words of a random poem, and for a
+// word that no poem has. Storages that cannot search
+// return `ErrNoSearch`, and are not checked.
+func checkSearch(ctx context.Context, r *rand.Rand, ps PoemStorage, names []string) error {
+	if _, err := Search(ps, ""); errors.Is(err, ErrNoSearch) {
+		return nil
+	}
+	poems := map[string][]string{}
+	for _, name := range names {
+		contents, err := ps.Load(ctx, name)
+		if errors.Is(err, ErrNoPoem) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		poems[name] = words(string(contents))
+	}
+	queries := []string{"", "no-such-word"}
+	for _, ws := range poems {
+		if len(ws) == 0 {
+			continue
+		}
+		q := ws[r.Intn(len(ws))]
+		if r.Intn(2) == 0 {
+			q += " " + ws[r.Intn(len(ws))]
+		}
+		queries = append(queries, q)
+	}
+	for _, q := range queries {
+		got, err := Search(ps, q)
+		if err != nil {
+			return fmt.Errorf("search %q: %w", q, err)
+		}
+		if exp := searchAll(poems, q); strings.Join(got, "\n") != strings.Join(exp, "\n") {
+			return fmt.Errorf("search %q: got %q, want %q", q, got, exp)
+		}
+	}
+	return nil
+}
+
+// `searchAll` returns the names of the `poems` that have all words of
+// `query`, sorted, the slow way.
+func searchAll(poems map[string][]string, query string) []string {
+	ws := words(query)
+	var names []string
+	for name, theirs := range poems {
+		has := map[string]bool{}
+		for _, w := range theirs {
+			has[w] = true
+		}
+		all := len(ws) > 0
+		for _, w := range ws {
+			all = all && has[w]
+		}
+		if all {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// `checkIndex` saves, changes, and deletes poems of a few words through
+// an `IndexedStorage` on a random keyed backend that can delete poems, and
+// checks the searches for every word and pair of words after each step.
+// `TestLaws` runs it once.
+func checkIndex(ctx context.Context, r *rand.Rand) error {
+	var deleting []backend
+	for _, b := range backends {
+		if _, ok := b.new().(Deleter); ok && b.keyed {
+			deleting = append(deleting, b)
+		}
+	}
+	b := deleting[r.Intn(len(deleting))]
+	ps := b.new()
+	s := NewIndexedStorage(ps, NewIndex(ps))
+	vocabulary := []string{"Rose", "rose!", "thorn,", "\"night\"", "Night.", "dew"}
+	poems := map[string][]string{}
+	for step := 0; step < 20; step++ {
+		name := fmt.Sprintf("poem %d", r.Intn(4))
+		if _, ok := poems[name]; ok && r.Intn(3) == 0 {
+			if err := s.Delete(ctx, name); err != nil {
+				return fmt.Errorf("%s: %w", b.name, err)
+			}
+			delete(poems, name)
+		} else {
+			var line []string
+			for i := 1 + r.Intn(3); i > 0; i-- {
+				line = append(line, vocabulary[r.Intn(len(vocabulary))])
+			}
+			contents := strings.Join(line, " ")
+			if err := s.Save(ctx, name, []byte(contents)); err != nil {
+				return fmt.Errorf("%s: %w", b.name, err)
+			}
+			poems[name] = words(contents)
+		}
+		for _, a := range vocabulary {
+			for _, q := range []string{a, a + " " + vocabulary[r.Intn(len(vocabulary))]} {
+				got, err := Search(s, q)
+				if err != nil {
+					return fmt.Errorf("%s: search %q: %w", b.name, q, err)
+				}
+				if exp := searchAll(poems, q); strings.Join(got, "\n") != strings.Join(exp, "\n") {
+					return fmt.Errorf("%s: step %d: search %q: got %q, want %q", b.name, step, q, got, exp)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ### Serving poems over HTTP
+//
+// The delivery layer is the outermost ring: it knows HTTP, and it knows
+// that poems live in a `PoemStorage`, but not which one. The container
+// injects the storage, and the renderers of `render.go`:
+//
+//	c.Provide(NewPoemHandler, di.ParamNames("", "renderers"))
+//
+// `GET /poems/<name>` returns a poem. The handler opens it with `OpenBlob`
+// and serves it through `http.ServeContent`, which answers Range requests
+// by seeking. If the storage is a `RangeReader`, the blob reads just the
+// range from the storage, so a client that asks for the last kilobyte of
+// an epic gets just that, and the storage reads just that.
+//
+// The version of the poem, followed by the subtype of the media type that
+// it is rendered in, is its ETag, as in "5d41…-html". The storage tells
+// the version: the checksum of a `Checksummer`, or the revision of a
+// `Revisioner`, as in "r3-html". Only a storage that is neither is loaded
+// to be hashed, and then the handler serves that one load. With the ETag,
+// `http.ServeContent` answers `If-None-Match` with 304 Not Modified when
+// the client's copy is current, and honors `If-Range`, so a client
+// resumes a download only if the poem has not changed in between.
+//
+// The version and the poem are read in separate calls, and a poem saved
+// in between would be served under the ETag of the other version; a client
+// that resumes would mix the two. So the handler reads the version again
+// when it has rendered the poem, and starts over if it changed, up to
+// `attempts` times before it gives up with 503 Service Unavailable. A blob
+// that reads from the storage as it is served can still change while it
+// is sent, so then the handler reads the version once more after serving.
+// If it changed, it is too late for another status: the handler aborts
+// the response, and the client sees it fail rather than keep a mix.
+
+// A `PoemHandler` serves the poems of a storage.
+type PoemHandler struct {
+	storage   PoemStorage
+	renderers []Renderer
+}
+
+// `NewPoemHandler` serves the poems of `ps` in the formats of `renderers`.
+func NewPoemHandler(ps PoemStorage, renderers []Renderer) *PoemHandler {
+	return &PoemHandler{
+		storage:   ps,
+		renderers: renderers,
+	}
+}
+
+func (h *PoemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/poems/")
+	if name == r.URL.Path || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	renderer, ok := negotiate(r.Header.Get("Accept"), h.renderers)
+	if !ok {
+		var types []string
+		for _, rr := range h.renderers {
+			types = append(types, mediaType(rr.ContentType()))
+		}
+		http.Error(w, "acceptable types: "+strings.Join(types, ", "), http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	var p *snapshot
+	var err error
+	for i := 0; i < attempts; i++ {
+		p, err = h.snapshot(r.Context(), name, renderer)
+		if !errors.Is(err, errChanged) {
+			break
+		}
+	}
+	switch {
+	case errors.Is(err, ErrNoPoem):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, errChanged):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	typ := mediaType(renderer.ContentType())
+	w.Header().Set("ETag", `"`+p.version+"-"+typ[strings.Index(typ, "/")+1:]+`"`)
+	w.Header().Set("Content-Type", renderer.ContentType())
+	http.ServeContent(w, r, name, time.Time{}, p.body)
+	if p.live {
+		if v, _, err := version(r.Context(), h.storage, name); err != nil || v != p.version {
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// `attempts` is how often the handler tries to render a poem that keeps
+// changing.
+const attempts = 3
+
+// `errChanged` reports that a poem was saved while it was being read.
+var errChanged = errors.New("the poem changed while it was read")
+
+// A `snapshot` is a rendered poem and the version that it was rendered
+// from.
+type snapshot struct {
+	version string
+	body    io.ReadSeeker
+	live    bool // Whether the body reads from the storage as it is served.
+}
+
+// `snapshot` renders the poem `name` with `renderer`, or reports
+// `errChanged` if the poem was saved in the meantime.
+func (h *PoemHandler) snapshot(ctx context.Context, name string, renderer Renderer) (*snapshot, error) {
+	v, ok, err := version(ctx, h.storage, name)
+	if err != nil {
+		return nil, err
+	}
+	var b *Blob
+	if ok {
+		b, err = OpenBlob(ctx, h.storage, name)
+	} else {
+		var contents []byte
+		contents, err = h.storage.Load(ctx, name)
+		b, v = BlobOf(name, contents), sum(contents)
+	}
+	if err != nil {
+		return nil, err
+	}
+	body, err := renderer.Render(b)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		now, _, err := version(ctx, h.storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if now != v {
+			return nil, errChanged
+		}
+	}
+	return &snapshot{version: v, body: body, live: b.contents == nil}, nil
+}
+
+// `version` returns what names the contents of the poem `name` in `ps`:
+// the checksum if `ps` is a `Checksummer`, or else the revision if it is a
+// `Revisioner`. It reports false if `ps` is neither.
+func version(ctx context.Context, ps PoemStorage, name string) (string, bool, error) {
+	if cs, ok := ps.(Checksummer); ok {
+		v, err := cs.Checksum(ctx, name)
+		return v, true, err
+	}
+	if rv, ok := ps.(Revisioner); ok {
+		rev, err := rv.Revision(ctx, name)
+		if err == nil && rev == 0 {
+			err = ErrNoPoem
+		}
+		return "r" + strconv.FormatUint(uint64(rev), 10), true, err
+	}
+	return "", false, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// A `servedStorage` is a notebook that counts its loads and records the
+// ranges that it reads. `onSize` runs when a blob is opened, and `onRead`
+// when the blob reads a range.
+type servedStorage struct {
+	*Notebook
+	loads  int
+	ranges [][2]int64
+	onSize func()
+	onRead func()
+}
+
+func (s *servedStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	s.loads++
+	return s.Notebook.Load(ctx, name)
+}
+
+func (s *servedStorage) Size(ctx context.Context, name string) (int64, error) {
+	if s.onSize != nil {
+		s.onSize()
+	}
+	return s.Notebook.Size(ctx, name)
+}
+
+func (s *servedStorage) ReadRange(ctx context.Context, name string, off, length int64) ([]byte, error) {
+	if s.onRead != nil {
+		s.onRead()
+	}
+	s.ranges = append(s.ranges, [2]int64{off, length})
+	return s.Notebook.ReadRange(ctx, name, off, length)
+}
+
+// `serve` sends a GET request for the poem "ode" to a handler of `ps`.
+func serve(ps PoemStorage, accept string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/poems/ode", nil)
+	r.Header.Set("Accept", accept)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	NewPoemHandler(ps, []Renderer{PlainRenderer{}, JSONRenderer{}}).ServeHTTP(rec, r)
+	return rec
+}
+
+func TestServeETag(t *testing.T) {
+	ctx := context.Background()
+	s := &servedStorage{Notebook: NewNotebook()}
+	s.Save(ctx, "ode", []byte("Oh, the poem"))
+	rec := serve(s, "text/plain")
+	if rec.Code != http.StatusOK || rec.Body.String() != "Oh, the poem" {
+		t.Fatalf("got %d %q", rec.Code, rec.Body)
+	}
+	want := `"` + sum([]byte("Oh, the poem")) + `-plain"`
+	if got := rec.Header().Get("ETag"); got != want {
+		t.Errorf("ETag: got %s, want %s", got, want)
+	}
+	if s.loads != 0 {
+		t.Errorf("the handler loaded a poem that the storage hashes and reads in ranges %d times", s.loads)
+	}
+	if rec := serve(s, "text/plain", "If-None-Match", want); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: got %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	if rec := serve(s, "application/json", "If-None-Match", want); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match of another type: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(s, "text/plain", "If-None-Match", `"`+sum([]byte("Oh"))+`-plain"`); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match of another version: got %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// A storage that reads ranges serves a Range request by reading just the
+// range.
+func TestServeRange(t *testing.T) {
+	ctx := context.Background()
+	s := &servedStorage{Notebook: NewNotebook()}
+	s.Save(ctx, "ode", []byte("Oh, the poem"))
+	rec := serve(s, "text/plain", "Range", "bytes=4-6")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "the" {
+		t.Errorf("got %d %q, want %d %q", rec.Code, rec.Body, http.StatusPartialContent, "the")
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes 4-6/12" {
+		t.Errorf("Content-Range: got %q", got)
+	}
+	if s.loads != 0 {
+		t.Errorf("loaded the poem %d times, want no load", s.loads)
+	}
+	for _, r := range s.ranges {
+		if r[0] < 4 || r[0]+r[1] > 7 {
+			t.Errorf("read %d+%d, outside of the range", r[0], r[1])
+		}
+	}
+	if len(s.ranges) == 0 {
+		t.Error("read no range")
+	}
+}
+
+// A storage that can neither hash nor read ranges is loaded once, and the
+// handler hashes and serves that load.
+func TestServeLoadsOnce(t *testing.T) {
+	ctx := context.Background()
+	probe := &traceProbe{PoemStorage: NewNapkin()}
+	probe.Save(ctx, "ode", []byte("Oh, the poem"))
+	probe.ids = nil
+	rec := serve(probe, "text/plain", "Range", "bytes=4-")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "the poem" {
+		t.Errorf("got %d %q", rec.Code, rec.Body)
+	}
+	if want := `"` + sum([]byte("Oh, the poem")) + `-plain"`; rec.Header().Get("ETag") != want {
+		t.Errorf("ETag: got %s, want %s", rec.Header().Get("ETag"), want)
+	}
+	if len(probe.ids) != 1 {
+		t.Errorf("loaded %d times, want once", len(probe.ids))
+	}
+}
+
+// A poem that is saved while it is rendered is rendered again, and one
+// that keeps changing is not served at all.
+func TestServeChangingPoem(t *testing.T) {
+	for _, tc := range []struct {
+		saves int
+		code  int
+	}{
+		{0, http.StatusOK},
+		{1, http.StatusOK},
+		{attempts - 1, http.StatusOK},
+		{attempts, http.StatusServiceUnavailable},
+	} {
+		t.Run(fmt.Sprint(tc.saves, " saves"), func(t *testing.T) {
+			ctx := context.Background()
+			s := &servedStorage{Notebook: NewNotebook()}
+			s.Save(ctx, "ode", []byte("version 0"))
+			saves := 0
+			s.onSize = func() {
+				if saves < tc.saves {
+					saves++
+					s.Save(ctx, "ode", []byte(fmt.Sprint("version ", saves)))
+				}
+			}
+			rec := serve(s, "application/json")
+			if rec.Code != tc.code {
+				t.Fatalf("got %d %q, want %d", rec.Code, rec.Body, tc.code)
+			}
+			if tc.code != http.StatusOK {
+				return
+			}
+			want := fmt.Sprint("version ", tc.saves)
+			if got := rec.Header().Get("ETag"); got != `"`+sum([]byte(want))+`-json"` {
+				t.Errorf("ETag %s does not name %q", got, want)
+			}
+			if got := rec.Body.String(); got != `{"name":"ode","poem":"`+want+`"}` {
+				t.Errorf("got %s, want %q", got, want)
+			}
+		})
+	}
+}
+
+// A poem that is saved while it is sent from the storage aborts the
+// response.
+func TestServeAbortsChangedPoem(t *testing.T) {
+	ctx := context.Background()
+	s := &servedStorage{Notebook: NewNotebook()}
+	s.Save(ctx, "ode", []byte("version 0"))
+	s.onRead = func() { s.Save(ctx, "ode", []byte("version 1")) }
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("got panic %v, want http.ErrAbortHandler", r)
+		}
+	}()
+	serve(s, "text/plain")
+}
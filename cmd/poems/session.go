@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Sessions
+//
+// A web application remembers its visitors between requests: which poems
+// they marked as favorites, for example. It keeps that state in a
+// `Session`, and where the session lives is the business of a
+// `SessionStore`. The `MemorySessions` keep sessions in the server and
+// give the browser only an ID; the `CookieSessions` send the whole session
+// to the browser, signed so that it cannot be tampered with. The setting
+// "http.session.store" picks one.
+//
+// A session belongs to one request, and so does its binding: the
+// `RequestScope` middleware opens a scope for every request, and the
+// container builds a `*Session` once per scope, from the request's
+// cookie. Handlers that need it are resolved from the scope, too, so they
+// get it injected like any other dependency:
+//
+//	c.Provide(LoadSession, di.WithLifetime(di.Scoped))
+//	c.Provide(NewFavoritesHandler) // func(s *Session, store SessionStore, ...) *FavoritesHandler
+//
+// and the router serves them with `PerRequest[*FavoritesHandler]()`.
+
+// A `Session` holds the state of one visitor.
+type Session struct {
+	// `ID` identifies the session in the server. Sessions that live in a
+	// cookie have no ID.
+	ID string
+
+	values map[string]string
+}
+
+// `Get` returns the value of `key`, or "".
+func (s *Session) Get(key string) string {
+	return s.values[key]
+}
+
+// `Set` sets the value of `key`. An empty value deletes the key. The change
+// lasts only if the session is saved before the response is written.
+func (s *Session) Set(key, value string) {
+	if value == "" {
+		delete(s.values, key)
+		return
+	}
+	s.values[key] = value
+}
+
+// A `SessionStore` loads and saves the sessions of requests.
+type SessionStore interface {
+	// `Load` returns the session of the request's cookie, or a new session
+	// if there is none, or it has expired or is invalid.
+	Load(r *http.Request) (*Session, error)
+
+	// `Save` stores the session and sets the cookie. It must be called
+	// before the response's header is written.
+	Save(w http.ResponseWriter, s *Session) error
+}
+
+// `sessionCookie` is the name of the cookie of both stores.
+const sessionCookie = "poems_session"
+
+// `ErrSessionTooLarge` is returned when a session does not fit into a
+// cookie.
+var ErrSessionTooLarge = errors.New("session too large for a cookie")
+
+// `NewSessionStore` returns the store that `cfg` selects.
+func NewSessionStore(cfg SessionConfig) (SessionStore, error) {
+	switch cfg.Store {
+	case "memory":
+		return NewMemorySessions(cfg.MaxAge), nil
+	case "cookie":
+		key := []byte(cfg.Key)
+		if len(key) == 0 {
+			// Without a configured key, cookies do not survive a restart.
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, err
+			}
+		}
+		return NewCookieSessions(key, cfg.MaxAge), nil
+	}
+	return nil, fmt.Errorf("unknown session store %q (want memory or cookie)", cfg.Store)
+}
+
+// `LoadSession` loads the session of the request `r` from `store`.
+func LoadSession(store SessionStore, r *http.Request) (*Session, error) {
+	return store.Load(r)
+}
+
+// `newCookie` returns the session cookie with `value`.
+func newCookie(value string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// #### Sessions in memory
+//
+// `MemorySessions` keeps sessions in a map, and drops those that have not
+// been saved for `maxAge` when it saves another.
+type MemorySessions struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	maxAge   time.Duration
+	now      func() time.Time
+}
+
+type memorySession struct {
+	values map[string]string
+	saved  time.Time
+}
+
+// `NewMemorySessions` returns an empty store whose sessions expire after
+// `maxAge`.
+func NewMemorySessions(maxAge time.Duration) *MemorySessions {
+	return &MemorySessions{
+		sessions: map[string]memorySession{},
+		maxAge:   maxAge,
+		now:      time.Now,
+	}
+}
+
+func (m *MemorySessions) Load(r *http.Request) (*Session, error) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		m.mu.Lock()
+		ms, ok := m.sessions[c.Value]
+		m.mu.Unlock()
+		if ok && m.now().Sub(ms.saved) < m.maxAge {
+			return &Session{ID: c.Value, values: copyValues(ms.values)}, nil
+		}
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Session{ID: hex.EncodeToString(id), values: map[string]string{}}, nil
+}
+
+func (m *MemorySessions) Save(w http.ResponseWriter, s *Session) error {
+	now := m.now()
+	m.mu.Lock()
+	for id, ms := range m.sessions {
+		if now.Sub(ms.saved) >= m.maxAge {
+			delete(m.sessions, id)
+		}
+	}
+	m.sessions[s.ID] = memorySession{values: copyValues(s.values), saved: now}
+	m.mu.Unlock()
+	http.SetCookie(w, newCookie(s.ID, m.maxAge))
+	return nil
+}
+
+// `copyValues` keeps the sessions of concurrent requests apart.
+func copyValues(values map[string]string) map[string]string {
+	c := make(map[string]string, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
+
+// #### Sessions in cookies
+//
+// `CookieSessions` keeps each session in its cookie: the values and the
+// time of saving as JSON, followed by an HMAC-SHA256 signature, both
+// base64-encoded. The server stores nothing, so sessions survive restarts
+// and work across several servers that share the key. A cookie with a bad
+// signature, or one older than `maxAge`, starts a new session.
+type CookieSessions struct {
+	key    []byte
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// `NewCookieSessions` signs cookies with `key`.
+func NewCookieSessions(key []byte, maxAge time.Duration) *CookieSessions {
+	return &CookieSessions{key: key, maxAge: maxAge, now: time.Now}
+}
+
+type cookieSession struct {
+	Values map[string]string `json:"v"`
+	Saved  int64             `json:"t"` // Unix time.
+}
+
+func (cs *CookieSessions) Load(r *http.Request) (*Session, error) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if s, ok := cs.decode(c.Value); ok {
+			return s, nil
+		}
+	}
+	return &Session{values: map[string]string{}}, nil
+}
+
+func (cs *CookieSessions) decode(value string) (*Session, bool) {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(cs.sign(payload))) {
+		return nil, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false
+	}
+	var c cookieSession
+	if json.Unmarshal(data, &c) != nil {
+		return nil, false
+	}
+	if cs.now().Sub(time.Unix(c.Saved, 0)) >= cs.maxAge {
+		return nil, false
+	}
+	if c.Values == nil {
+		c.Values = map[string]string{}
+	}
+	return &Session{values: c.Values}, true
+}
+
+func (cs *CookieSessions) Save(w http.ResponseWriter, s *Session) error {
+	data, err := json.Marshal(cookieSession{Values: s.values, Saved: cs.now().Unix()})
+	if err != nil {
+		return err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	value := payload + "." + cs.sign(payload)
+	if len(value) > 4000 {
+		return ErrSessionTooLarge
+	}
+	http.SetCookie(w, newCookie(value, cs.maxAge))
+	return nil
+}
+
+func (cs *CookieSessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, cs.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// #### One scope per request
+//
+// `RequestScope` is the middleware that gives every request a scope of the
+// container, and registers the request in it, so that scoped bindings such
+// as the `*Session` can depend on the `*http.Request`. The scope travels in
+// the request's context, and is disposed when the request is done.
+type RequestScope struct {
+	c *di.Container
+}
+
+// `NewRequestScope` opens the scopes of requests in `c`.
+func NewRequestScope(c *di.Container) *RequestScope {
+	return &RequestScope{c: c}
+}
+
+func (*RequestScope) Name() string { return "scope" }
+
+func (m *RequestScope) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := m.c.NewScope()
+		defer scope.Dispose(r.Context())
+		r = r.WithContext(di.ContextWithScope(r.Context(), scope))
+		scope.Register(func() *http.Request { return r }, di.WithLifetime(di.Scoped))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// `errNoRequest` is the error of the `*http.Request` binding outside of
+// request scopes.
+var errNoRequest = errors.New("the request is only available in the scope of a request (enable the middleware \"scope\")")
+
+// `PerRequest` serves requests with a handler of type `H` that it resolves
+// from the request's scope, so that each request gets a handler with its
+// own request-scoped dependencies.
+func PerRequest[H http.Handler]() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := di.ScopeFromContext(r.Context())
+		if !ok {
+			http.Error(w, errNoRequest.Error(), http.StatusInternalServerError)
+			return
+		}
+		h, err := di.Resolve[H](scope)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// #### Favorites
+//
+// `FavoritesHandler` keeps a visitor's favorite poems in their session:
+// `POST /favorites/<name>` adds a poem, `DELETE /favorites/<name>` removes
+// it, and `GET /favorites` lists them, one per line, or as the page
+// "favorites.html" for browsers.
+type FavoritesHandler struct {
+	session   *Session
+	store     SessionStore
+	storage   PoemStorage
+	templates TemplateRenderer
+}
+
+// `NewFavoritesHandler` serves the favorites in the session `s`, which it
+// saves to `store`, of poems in `ps`, and renders pages with `t`.
+func NewFavoritesHandler(s *Session, store SessionStore, ps PoemStorage, t TemplateRenderer) *FavoritesHandler {
+	return &FavoritesHandler{
+		session:   s,
+		store:     store,
+		storage:   ps,
+		templates: t,
+	}
+}
+
+func (h *FavoritesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var favorites []string
+	if f := h.session.Get("favorites"); f != "" {
+		favorites = strings.Split(f, "\n")
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/favorites"), "/")
+	switch {
+	case name == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		w.Header().Add("Vary", "Accept")
+		if preferred(r.Header.Get("Accept"), []string{"text/plain", "text/html"}) == 1 {
+			var buf bytes.Buffer
+			if err := h.templates.Render(&buf, "favorites.html", struct{ Favorites []string }{favorites}); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			buf.WriteTo(w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, f := range favorites {
+			fmt.Fprintln(w, f)
+		}
+		return
+	case name == "" || strings.Contains(name, "\n"):
+		http.NotFound(w, r)
+		return
+	case r.Method == http.MethodPost:
+		if _, err := PoemSize(r.Context(), h.storage, name); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		favorites = append(remove(favorites, name), name)
+	case r.Method == http.MethodDelete:
+		favorites = remove(favorites, name)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	h.session.Set("favorites", strings.Join(favorites, "\n"))
+	if err := h.store.Save(w, h.session); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// `remove` returns `list` without `s`.
+func remove(list []string, s string) []string {
+	kept := list[:0]
+	for _, l := range list {
+		if l != s {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,250 @@
+package main
+
+import "time"
+
+// ### Settings
+//
+// The example's settings are a struct, which package `config` fills from a
+// file and the environment. A section such as `LogConfig` can be injected
+// as a whole, and each setting by its key, such as "log.prefix".
+
+// `Config` holds the settings of the example.
+type Config struct {
+	Log         LogConfig         `config:"log"`
+	Storage     StorageConfig     `config:"storage"`
+	HTTP        HTTPConfig        `config:"http"`
+	Redis       RedisConfig       `config:"redis"`
+	Lock        LockConfig        `config:"lock"`
+	Encryption  EncryptionConfig  `config:"encryption"`
+	Compression CompressionConfig `config:"compression"`
+	Jobs        JobsConfig        `config:"jobs"`
+	Cache       CacheConfig       `config:"cache"`
+	Replication ReplicationConfig `config:"replication"`
+	Quota       QuotaConfig       `config:"quota"`
+	Standby     StandbyConfig     `config:"standby"`
+	Sharding    ShardingConfig    `config:"sharding"`
+	BlueGreen   BlueGreenConfig   `config:"bluegreen"`
+	Shadow      ShadowConfig      `config:"shadow"`
+}
+
+// `LogConfig` configures the storage log.
+type LogConfig struct {
+	Prefix string `config:"prefix"`
+}
+
+// `StorageConfig` configures the storages that keep poems beyond the
+// program: the `FileStorage`, the `SQLiteStorage`, the `ObjectStorage`,
+// and the `RedisStorage`.
+type StorageConfig struct {
+	// `Dir` is the directory of the poem files. If it is empty, the files
+	// are kept in memory.
+	Dir string `config:"dir"`
+
+	// `SQLite` is the data source name of the SQLite database, usually a
+	// file name. If it is empty, there is no `SQLiteStorage`. See
+	// `sqlite.go`.
+	SQLite string `config:"sqlite"`
+
+	// `Driver` is the name of the SQLite driver for `database/sql`.
+	Driver string `config:"driver"`
+
+	S3    S3Config           `config:"s3"`
+	Redis RedisStorageConfig `config:"redis"`
+
+	// `ReadOnly` rejects the saves to the files, as during maintenance.
+	// See `readonly.go`.
+	ReadOnly bool `config:"readonly"`
+
+	// `Middleware` lists the storage middleware that runs, outermost
+	// first. See `storagemiddleware.go`.
+	Middleware []string `config:"middleware"`
+
+	Policy PolicyConfig `config:"policy"`
+}
+
+// `PolicyConfig` configures the storage middleware "policy". See
+// `policy.go`.
+type PolicyConfig struct {
+	Rules string `config:"rules"` // The rule file; without one, there are no rules.
+	Deny  bool   `config:"deny"`  // Whether calls that no rule matches are denied.
+}
+
+// `RedisStorageConfig` configures the `RedisStorage`. The connection is
+// configured in `RedisConfig`.
+type RedisStorageConfig struct {
+	Enabled bool          `config:"enabled"`
+	TTL     time.Duration `config:"ttl"` // Poems expire after this long; 0 is never.
+}
+
+// `S3Config` configures the `ObjectStorage`. If `Bucket` is empty, there
+// is none. See `objects.go`.
+type S3Config struct {
+	Endpoint  string `config:"endpoint"` // Such as "https://s3.eu-west-1.amazonaws.com".
+	Region    string `config:"region"`
+	Bucket    string `config:"bucket"`
+	Prefix    string `config:"prefix"` // Starts the keys of the poems.
+	AccessKey string `config:"accesskey"`
+	SecretKey string `config:"secretkey"`
+}
+
+// `HTTPConfig` configures the server of `-serve`.
+type HTTPConfig struct {
+	// `Middleware` names the middleware of the pipeline, outermost first.
+	// Middleware that is not listed does not run. See `middleware.go`.
+	Middleware []string `config:"middleware"`
+
+	// `Templates` is the directory of the web UI's templates. If it is
+	// empty, the UI uses the templates embedded in the program.
+	Templates string `config:"templates"`
+
+	// `GraphQL` enables the GraphQL endpoint. See `graphql.go`.
+	GraphQL bool `config:"graphql"`
+
+	// `RPC` enables the JSON-RPC endpoint. See `jsonrpc.go`.
+	RPC bool `config:"rpc"`
+
+	CORS        CORSConfig        `config:"cors"`
+	Session     SessionConfig     `config:"session"`
+	Idempotency IdempotencyConfig `config:"idempotency"`
+}
+
+// `CORSConfig` configures the CORS middleware.
+type CORSConfig struct {
+	Origins []string `config:"origins"` // "*" allows every origin.
+}
+
+// `SessionConfig` configures the sessions of visitors.
+type SessionConfig struct {
+	Store  string        `config:"store"`  // "memory" or "cookie".
+	Key    string        `config:"key"`    // Signs cookies; random if empty.
+	MaxAge time.Duration `config:"maxage"` // Sessions expire after this long.
+}
+
+// `IdempotencyConfig` configures the idempotency keys of mutating requests.
+// See `idempotency.go`.
+type IdempotencyConfig struct {
+	Store string        `config:"store"` // "memory" or "redis".
+	TTL   time.Duration `config:"ttl"`   // Responses are replayed for this long.
+}
+
+// `RedisConfig` configures the connection to Redis. See `redis.go`.
+type RedisConfig struct {
+	Addr     string        `config:"addr"`
+	Password string        `config:"password"`
+	DB       int           `config:"db"`
+	Timeout  time.Duration `config:"timeout"` // Per command.
+}
+
+// `LockConfig` configures the locks that instances of the example share.
+// See `locks.go`.
+type LockConfig struct {
+	Kind string        `config:"kind"` // "local", "file", or "redis".
+	Dir  string        `config:"dir"`  // The directory of file locks.
+	TTL  time.Duration `config:"ttl"`  // Locks held longer are abandoned.
+}
+
+// `EncryptionConfig` configures the encryption of the file storage. See
+// `encrypted.go`.
+type EncryptionConfig struct {
+	// `Keys` are AES keys, each as "id:base64". The first encrypts new
+	// poems; the others only decrypt. Without keys, poems are not
+	// encrypted.
+	Keys []string `config:"keys"`
+}
+
+// `CompressionConfig` configures which storages compress their poems. See
+// `compressed.go`.
+type CompressionConfig struct {
+	// `Bindings` are the names of `PoemStorage` bindings with an algorithm,
+	// each as "binding:algorithm", such as "files:gzip".
+	Bindings []string `config:"bindings"`
+}
+
+// `JobsConfig` configures the background jobs of the server, and the
+// election of the instance that runs them. See `jobs.go` and `leader.go`.
+type JobsConfig struct {
+	Leader string        `config:"leader"` // "local", "file", "redis", or "etcd".
+	Dir    string        `config:"dir"`    // The directory of file leases.
+	Etcd   string        `config:"etcd"`   // The endpoint of etcd, such as "http://localhost:2379".
+	TTL    time.Duration `config:"ttl"`    // A leader that does not renew its lease this long is replaced.
+
+	// `Scrub` is how often the leader checks that the poems in the files
+	// load; 0 is never.
+	Scrub time.Duration `config:"scrub"`
+
+	// `Backup` is how often the leader backs up the poems in the files
+	// into the directory `BackupDir`. Without a directory, there are no
+	// backups. See `backup.go`.
+	Backup    time.Duration `config:"backup"`
+	BackupDir string        `config:"backupdir"`
+}
+
+// `CacheConfig` configures the caches, and which storages cache their
+// poems. See `cache.go` and `cached.go`.
+type CacheConfig struct {
+	Bindings []string      `config:"bindings"` // Names of `PoemStorage` bindings.
+	Store    string        `config:"store"`    // "memory" or "redis". See `cache.go`.
+	Size     int           `config:"size"`     // The number of values in each cache in memory.
+	TTL      time.Duration `config:"ttl"`      // Values are cached this long; 0 is until evicted.
+}
+
+// `ReplicationConfig` configures the replicated storage. See
+// `replicated.go`.
+type ReplicationConfig struct {
+	Consistency string `config:"consistency"` // "one", "quorum", or "all".
+}
+
+// `QuotaConfig` configures the quota of each tenant. See `quota.go`.
+type QuotaConfig struct {
+	Bytes      int64 `config:"bytes"`      // What each tenant may keep; 0 is no quota.
+	Thresholds []int `config:"thresholds"` // Percentages of the quota that alert.
+}
+
+// `StandbyConfig` configures the warm standby of the files. See
+// `standby.go`.
+type StandbyConfig struct {
+	Storage string        `config:"storage"` // The name of the standby's binding; empty is no standby.
+	Every   time.Duration `config:"every"`   // How often the leader syncs the standby.
+	Budget  time.Duration `config:"budget"`  // How long a sync may take; 0 is as long as it takes.
+}
+
+// `ShardingConfig` configures the shards of the binding "sharded". See
+// `sharded.go`.
+type ShardingConfig struct {
+	Shards int `config:"shards"` // How many shards; new shards go at the end.
+}
+
+// `BlueGreenConfig` configures the binding "bluegreen". See `bluegreen.go`.
+type BlueGreenConfig struct {
+	Blue    string `config:"blue"`    // The name of the established binding; empty is no split.
+	Green   string `config:"green"`   // The name of the binding that is validated.
+	Percent int    `config:"percent"` // The share of poems that goes to green, 0 to 100.
+}
+
+// `ShadowConfig` configures the binding "shadow". See `shadow.go`.
+type ShadowConfig struct {
+	Primary   string `config:"primary"`   // The name of the binding that serves; empty is no shadow.
+	Candidate string `config:"candidate"` // The name of the binding that is validated.
+	Queue     int    `config:"queue"`     // How many operations may wait for the candidate.
+}
+
+// `defaultConfig` applies where neither `poems.yaml` nor the environment
+// has a setting.
+var defaultConfig = Config{
+	Log:     LogConfig{Prefix: "storage: "},
+	Storage: StorageConfig{Driver: "sqlite", S3: S3Config{Region: "us-east-1"}},
+	HTTP: HTTPConfig{
+		Middleware:  []string{"recover", "log", "scope", "gzip", "idempotency"},
+		Session:     SessionConfig{Store: "memory", MaxAge: 24 * time.Hour},
+		Idempotency: IdempotencyConfig{Store: "memory", TTL: 24 * time.Hour},
+	},
+	Redis:       RedisConfig{Addr: "localhost:6379", Timeout: 5 * time.Second},
+	Lock:        LockConfig{Kind: "local", TTL: time.Minute},
+	Jobs:        JobsConfig{Leader: "local", TTL: 15 * time.Second, Scrub: 24 * time.Hour, Backup: 24 * time.Hour},
+	Cache:       CacheConfig{Store: "memory", Size: 1000, TTL: 5 * time.Minute},
+	Replication: ReplicationConfig{Consistency: "quorum"},
+	Quota:       QuotaConfig{Thresholds: []int{80, 100}},
+	Standby:     StandbyConfig{Every: 5 * time.Minute, Budget: time.Minute},
+	Sharding:    ShardingConfig{Shards: 2},
+	Shadow:      ShadowConfig{Queue: 1000},
+}
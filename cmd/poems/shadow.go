@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/appliedgo/di/lifecycle"
+)
+
+// A `Shadow` storage de-risks a storage migration. All calls are served by the
+// primary backend, exactly as before. In addition, every `Save` is mirrored to a
+// candidate backend, and every `Load` is repeated against the candidate and the
+// results are compared.
+//
+// The candidate works in the background and never slows down or affects the
+// primary path. Its results are only counted in `ShadowStats`.
+//
+// A poem whose save the candidate missed, because the queue was full or the
+// save failed there, is stale on the candidate until a later save of it gets
+// through. Its loads are not compared in the meantime, as a difference would
+// say nothing about the candidate.
+//
+// The candidate must see the operations of a poem in the order in which
+// they happened on the primary. A load that returned the old contents but
+// is queued after a concurrent save would count as a divergence that is
+// none. So each call holds a lock of its poem's name from the primary
+// operation until its operation is queued.
+type Shadow struct {
+	primary   PoemStorage
+	candidate PoemStorage
+	ops       chan shadowOp
+	done      chan struct{}
+	closeOnce sync.Once
+	stats     ShadowStats
+	names     *LocalLocker // Orders the calls of each poem; see `locks.go`.
+
+	mu    sync.Mutex
+	seq   uint64            // Numbers the operations.
+	stale map[string]uint64 // The last missed save of each stale poem.
+
+	// `OnDivergence`, if set, is called from the mirroring goroutine whenever
+	// the candidate returns something different from the primary.
+	OnDivergence func(name string, primary, candidate []byte)
+}
+
+// `ShadowStats` are the metrics of a `Shadow` storage.
+type ShadowStats struct {
+	Mirrored    int64 // Saves mirrored to the candidate.
+	Compared    int64 // Loads compared against the candidate.
+	Divergences int64 // Compared loads where the candidate returned different contents.
+	Dropped     int64 // Operations skipped because the mirror queue was full.
+	Failed      int64 // Operations that failed on the candidate.
+	Stale       int64 // Loads not compared, as the candidate missed a save of the poem.
+}
+
+// A `shadowOp` is either a save to mirror or a load to compare.
+type shadowOp struct {
+	save     bool
+	name     string
+	contents []byte
+	missing  bool   // The primary has no poem `name`.
+	seq      uint64 // The number of the operation.
+}
+
+// `NewShadow` starts mirroring to `candidate`. `queue` is the number of
+// operations that may wait for the candidate before new ones are dropped.
+//
+// A single goroutine replays the operations in order, so the candidate sees
+// the same sequence of calls as the primary, and it does not need to be safe
+// for concurrent use. The goroutine belongs to `component` and ends when the
+// component stops.
+func NewShadow(primary, candidate PoemStorage, queue int, component *lifecycle.Component) *Shadow {
+	s := &Shadow{
+		primary:   primary,
+		candidate: candidate,
+		ops:       make(chan shadowOp, queue),
+		done:      make(chan struct{}),
+		stale:     map[string]uint64{},
+		names:     NewLocalLocker(),
+	}
+	component.Go(s.mirror)
+	return s
+}
+
+// Only what succeeds on the primary goes to the candidate. A load of a
+// missing poem is compared, too: the candidate must not have it either.
+
+func (s *Shadow) Save(ctx context.Context, name string, contents []byte) error {
+	unlock, err := s.names.Lock(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := s.primary.Save(ctx, name, contents); err != nil {
+		return err
+	}
+	s.enqueue(shadowOp{save: true, name: name, contents: clone(contents)})
+	return nil
+}
+
+func (s *Shadow) Load(ctx context.Context, name string) ([]byte, error) {
+	unlock, err := s.names.Lock(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	contents, err := s.primary.Load(ctx, name)
+	if err == nil || errors.Is(err, ErrNoPoem) {
+		s.enqueue(shadowOp{name: name, contents: clone(contents), missing: err != nil})
+	}
+	return contents, err
+}
+
+// `Type` reports the primary backend. The candidate is an implementation detail.
+func (s *Shadow) Type() string {
+	return s.primary.Type()
+}
+
+// `Stats` returns a snapshot of the mirroring metrics.
+func (s *Shadow) Stats() ShadowStats {
+	return ShadowStats{
+		Mirrored:    atomic.LoadInt64(&s.stats.Mirrored),
+		Compared:    atomic.LoadInt64(&s.stats.Compared),
+		Divergences: atomic.LoadInt64(&s.stats.Divergences),
+		Dropped:     atomic.LoadInt64(&s.stats.Dropped),
+		Failed:      atomic.LoadInt64(&s.stats.Failed),
+		Stale:       atomic.LoadInt64(&s.stats.Stale),
+	}
+}
+
+// `Close` stops mirroring after all queued operations have been replayed.
+// `Save` and `Load` must not be called after `Close`. If the component has
+// been stopped already, the remaining operations are discarded.
+func (s *Shadow) Close() {
+	s.closeOnce.Do(func() {
+		close(s.ops)
+		<-s.done
+	})
+}
+
+// `enqueue` hands an operation to the mirroring goroutine without ever blocking
+// the caller. A save that is dropped makes its poem stale.
+func (s *Shadow) enqueue(op shadowOp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	op.seq = s.seq
+	select {
+	case s.ops <- op:
+	default:
+		atomic.AddInt64(&s.stats.Dropped, 1)
+		if op.save {
+			s.stale[op.name] = op.seq
+		}
+	}
+}
+
+// `missed` makes the poem of the save `op` stale, and `mirrored` makes it
+// fresh, unless a later save of it was missed.
+func (s *Shadow) missed(op shadowOp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if op.seq > s.stale[op.name] {
+		s.stale[op.name] = op.seq
+	}
+}
+
+func (s *Shadow) mirrored(op shadowOp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.stale[op.name]; ok && last < op.seq {
+		delete(s.stale, op.name)
+	}
+}
+
+// `isStale` reports whether the candidate missed a save of the poem `name`.
+func (s *Shadow) isStale(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.stale[name]
+	return ok
+}
+
+func (s *Shadow) mirror(ctx context.Context) {
+	defer close(s.done)
+	for {
+		var op shadowOp
+		select {
+		case <-ctx.Done():
+			return
+		case o, ok := <-s.ops:
+			if !ok {
+				return
+			}
+			op = o
+		}
+		if op.save {
+			if err := s.candidate.Save(ctx, op.name, op.contents); err != nil {
+				atomic.AddInt64(&s.stats.Failed, 1)
+				s.missed(op)
+				continue
+			}
+			atomic.AddInt64(&s.stats.Mirrored, 1)
+			s.mirrored(op)
+			continue
+		}
+		if s.isStale(op.name) {
+			atomic.AddInt64(&s.stats.Stale, 1)
+			continue
+		}
+		got, err := s.candidate.Load(ctx, op.name)
+		missing := errors.Is(err, ErrNoPoem)
+		if err != nil && !missing {
+			atomic.AddInt64(&s.stats.Failed, 1)
+			continue
+		}
+		atomic.AddInt64(&s.stats.Compared, 1)
+		if missing != op.missing || !bytes.Equal(got, op.contents) {
+			atomic.AddInt64(&s.stats.Divergences, 1)
+			if s.OnDivergence != nil {
+				s.OnDivergence(op.name, op.contents, got)
+			}
+		}
+	}
+}
+
+// `clone` copies a byte slice, so that the caller and the mirroring goroutine
+// never share memory.
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
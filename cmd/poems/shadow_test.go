@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/appliedgo/di/lifecycle"
+)
+
+// #### Conformance
+//
+// `checkShadow` makes the candidate miss a save, by holding it up until the
+// queue overflows, and checks that the loads of the poem are not counted as
+// divergences until a later save of it reaches the candidate. `TestLaws`
+// runs it once, in `component`.
+func checkShadow(ctx context.Context, component *lifecycle.Component) error {
+	candidate := &gatedStorage{PoemStorage: NewNotebook(), entered: make(chan struct{}, 1), gate: make(chan struct{})}
+	s := NewShadow(NewNotebook(), candidate, 2, component)
+	defer s.Close()
+	save := func(contents string) error { return s.Save(ctx, "poem", []byte(contents)) }
+	if err := save("verse 1"); err != nil {
+		return err
+	}
+	<-candidate.entered // The candidate holds up "verse 1"; two more fit the queue.
+	for _, contents := range []string{"verse 2", "verse 3", "verse 4"} {
+		if err := save(contents); err != nil {
+			return err
+		}
+	}
+	close(candidate.gate)
+	for s.Stats().Mirrored < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := s.Load(ctx, "poem"); err != nil {
+		return err
+	}
+	if err := save("verse 5"); err != nil {
+		return err
+	}
+	if _, err := s.Load(ctx, "poem"); err != nil {
+		return err
+	}
+	s.Close()
+	st := s.Stats()
+	if st.Dropped != 1 || st.Stale != 1 || st.Compared != 1 || st.Divergences != 0 {
+		return fmt.Errorf("got %+v, want 1 dropped, 1 stale, and 1 compared load without divergences", st)
+	}
+	return nil
+}
+
+// `checkShadowOrder` saves and loads one poem from several goroutines at
+// once, and checks that the candidate never sees a load out of order with
+// a save, which would count as a divergence. The primary yields after
+// each load, so that a save can slip in before the load is queued.
+func checkShadowOrder(ctx context.Context, component *lifecycle.Component) error {
+	const goroutines, ops = 8, 50
+	s := NewShadow(&yieldingStorage{NewNotebook()}, NewNotebook(), goroutines*ops, component)
+	defer s.Close()
+	if err := s.Save(ctx, "poem", []byte("verse")); err != nil {
+		return err
+	}
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			for i := 0; i < ops; i++ {
+				var err error
+				if g%2 == 0 {
+					err = s.Save(ctx, "poem", []byte(fmt.Sprint("verse ", g, i)))
+				} else {
+					_, err = s.Load(ctx, "poem")
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(g)
+	}
+	for g := 0; g < goroutines; g++ {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	s.Close()
+	if st := s.Stats(); st.Dropped != 0 || st.Divergences != 0 {
+		return fmt.Errorf("got %+v, want no dropped operations and no divergences", st)
+	}
+	return nil
+}
+
+// A `yieldingStorage` lets other goroutines run after each load.
+type yieldingStorage struct {
+	PoemStorage
+}
+
+func (y *yieldingStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	contents, err := y.PoemStorage.Load(ctx, name)
+	runtime.Gosched()
+	return contents, err
+}
+
+// A `gatedStorage` holds up saves until its gate opens, and reports each
+// save that waits.
+type gatedStorage struct {
+	PoemStorage
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (g *gatedStorage) Save(ctx context.Context, name string, contents []byte) error {
+	select {
+	case g.entered <- struct{}{}:
+	default:
+	}
+	<-g.gate
+	return g.PoemStorage.Save(ctx, name, contents)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ### Sharding
+//
+// One storage holds only so many poems. A `ShardedStorage` spreads them
+// over several, its shards, and keeps each poem in one of them, which it
+// picks by the hash of the poem's name. Adding a shard should not move
+// every poem to another, as `hash % n` would, so the shards sit on a ring
+// of hashes, each at `shardPoints` places, and a poem belongs to the shard
+// whose place follows the poem's hash on the ring. A new shard takes over
+// the poems between its places and the places before them, which is about
+// 1/n of them, from all other shards alike.
+//
+// The shards come from the container as the group "shards", in order, and
+// are known on the ring by their position. New shards go at the end; a
+// shard that is taken out of the middle moves the places of all shards
+// after it.
+//
+// When the shards change, the poems of a shard that now belong to another
+// are still where they were. The storage finds them anyway: if the shard
+// of a poem does not have it, `Load` asks the others, which makes loads of
+// missing poems ask every shard. `Rebalance` moves poems to their shards,
+// after which the old shards are no longer asked for them.
+//
+//	go run ./cmd/poems -rebalance
+//
+// rebalances the shards of the setting "sharding.shards", which are
+// directories of "storage.dir".
+
+// `shardPoints` is how many places each shard has on the ring. More
+// places spread poems more evenly.
+const shardPoints = 64
+
+// `ShardedStorage` spreads poems over shards.
+type ShardedStorage struct {
+	shards []PoemStorage
+	ring   []ringPoint // Sorted by hash.
+}
+
+// A `ringPoint` is a place of a shard on the ring.
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// `NewShardedStorage` spreads poems over `shards`, of which there must be
+// at least one.
+func NewShardedStorage(shards ...PoemStorage) (*ShardedStorage, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("sharded storage: no shards")
+	}
+	s := &ShardedStorage{shards: shards}
+	for i := range shards {
+		for p := 0; p < shardPoints; p++ {
+			s.ring = append(s.ring, ringPoint{hash: ringHash(strconv.Itoa(i) + "#" + strconv.Itoa(p)), shard: i})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+	return s, nil
+}
+
+// `ringHash` places `key` on the ring. It must not change, as the places
+// of poems would change with it.
+func ringHash(key string) uint64 {
+	h := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(h[:8])
+}
+
+// `owner` returns the position of the shard of the poem `name`.
+func (s *ShardedStorage) owner(name string) int {
+	h := ringHash(name)
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+	if i == len(s.ring) {
+		i = 0 // Past the last place, the ring starts over.
+	}
+	return s.ring[i].shard
+}
+
+func (s *ShardedStorage) Save(ctx context.Context, name string, contents []byte) error {
+	return s.shards[s.owner(name)].Save(ctx, name, contents)
+}
+
+// `Load` loads the poem from its shard, or, if it is not there, from the
+// first other shard that has it.
+func (s *ShardedStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	owner := s.owner(name)
+	contents, err := s.shards[owner].Load(ctx, name)
+	if !errors.Is(err, ErrNoPoem) {
+		return contents, err
+	}
+	for i, shard := range s.shards {
+		if i == owner {
+			continue
+		}
+		contents, err := shard.Load(ctx, name)
+		if !errors.Is(err, ErrNoPoem) {
+			return contents, err
+		}
+	}
+	return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+}
+
+func (s *ShardedStorage) Type() string {
+	t := "Sharded("
+	for i, shard := range s.shards {
+		if i > 0 {
+			t += ", "
+		}
+		t += shard.Type()
+	}
+	return t + ")"
+}
+
+// `List` lists the poems of all shards, which must all be `Lister`s. A
+// poem that has not been moved yet may be in two shards, and is listed
+// once.
+func (s *ShardedStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	var names []string
+	for _, shard := range s.shards {
+		theirs, err := ListAll(ctx, shard)
+		if err != nil {
+			return nil, "", err
+		}
+		names = append(names, theirs...)
+	}
+	sort.Strings(names)
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return Paginate(unique, after, limit)
+}
+
+// `Delete` deletes the poem from every shard that has it, so that an old
+// copy does not turn up in its place.
+func (s *ShardedStorage) Delete(ctx context.Context, name string) error {
+	deleted := false
+	for _, shard := range s.shards {
+		err := Delete(ctx, shard, name)
+		if errors.Is(err, ErrNoPoem) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		deleted = true
+	}
+	if !deleted {
+		return fmt.Errorf("delete %q: %w", name, ErrNoPoem)
+	}
+	return nil
+}
+
+func (s *ShardedStorage) Exists(ctx context.Context, name string) (bool, error) {
+	owner := s.owner(name)
+	for _, i := range append([]int{owner}, s.others(owner)...) {
+		exists, err := Exists(ctx, s.shards[i], name)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// `others` returns the positions of the shards but `owner`.
+func (s *ShardedStorage) others(owner int) []int {
+	var others []int
+	for i := range s.shards {
+		if i != owner {
+			others = append(others, i)
+		}
+	}
+	return others
+}
+
+// #### Rebalancing
+
+// `RebalanceReport` counts what a rebalance did.
+type RebalanceReport struct {
+	Moved   int // Poems copied to their shard, and deleted from the old one.
+	Dropped int // Old copies of poems whose shard has a newer one.
+	Kept    int // Poems that a shard cannot delete, and keeps as well.
+}
+
+// `Rebalance` moves every poem that is not in its shard to its shard. It
+// copies a poem before it deletes it from the old shard, so a rebalance
+// that stops halfway loses nothing, and can run again. A poem whose shard
+// has it already was saved there after the shards changed; the old copy
+// goes. The shards must be `Lister`s.
+func (s *ShardedStorage) Rebalance(ctx context.Context) (RebalanceReport, error) {
+	var report RebalanceReport
+	for i, shard := range s.shards {
+		names, err := ListAll(ctx, shard)
+		if err != nil {
+			return report, fmt.Errorf("rebalance: %w", err)
+		}
+		for _, name := range names {
+			owner := s.owner(name)
+			if owner == i {
+				continue
+			}
+			moved, err := s.move(ctx, name, shard, s.shards[owner])
+			if err != nil {
+				return report, fmt.Errorf("rebalance %q: %w", name, err)
+			}
+			err = Delete(ctx, shard, name)
+			switch {
+			case errors.Is(err, ErrNotDeletable):
+				report.Kept++
+			case err != nil && !errors.Is(err, ErrNoPoem):
+				return report, fmt.Errorf("rebalance %q: %w", name, err)
+			case moved:
+				report.Moved++
+			default:
+				report.Dropped++
+			}
+		}
+	}
+	return report, nil
+}
+
+// `move` copies the poem `name` from `from` to `to`, unless `to` has it,
+// and reports whether it copied.
+func (s *ShardedStorage) move(ctx context.Context, name string, from, to PoemStorage) (bool, error) {
+	exists, err := Exists(ctx, to, name)
+	if err != nil || exists {
+		return false, err
+	}
+	contents, err := from.Load(ctx, name)
+	if errors.Is(err, ErrNoPoem) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, to.Save(ctx, name, contents)
+}
+
+// `rebalanceShards` rebalances `s` for `-rebalance`, and reports what it did.
+func rebalanceShards(ctx context.Context, s *ShardedStorage) error {
+	report, err := s.Rebalance(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Moved %d poems, dropped %d old copies, kept %d.\n", report.Moved, report.Dropped, report.Kept)
+	return nil
+}
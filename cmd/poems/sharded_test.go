@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// #### Conformance
+//
+// `checkRebalance` saves random poems to a sharded storage, adds a shard,
+// and checks that the poems still load, that only the poems of the new
+// shard move, and that after `Rebalance` every poem is in its shard and
+// nowhere else, and a second rebalance does nothing. `TestLaws` runs it
+// once, on notebooks or file storages.
+func checkRebalance(ctx context.Context, r *rand.Rand) error {
+	b := backendOfType("Notebook")
+	if r.Intn(2) == 0 {
+		b = backendOfType("FileStorage")
+	}
+	n := 1 + r.Intn(4)
+	var shards []PoemStorage
+	for i := 0; i < n+1; i++ {
+		shards = append(shards, b.new())
+	}
+	before, err := NewShardedStorage(shards[:n]...)
+	if err != nil {
+		return err
+	}
+	poems := map[string]string{}
+	for i := 0; i < 50; i++ {
+		name, contents := fmt.Sprintf("poem %d", i), fmt.Sprintf("verse %d", r.Int())
+		if err := before.Save(ctx, name, []byte(contents)); err != nil {
+			return err
+		}
+		poems[name] = contents
+	}
+	after, err := NewShardedStorage(shards...)
+	if err != nil {
+		return err
+	}
+	moving := 0
+	for name, contents := range poems {
+		if got, err := after.Load(ctx, name); err != nil || string(got) != contents {
+			return fmt.Errorf("%s: before rebalancing, %q loads as %q, %v, want %q", b.name, name, got, err, contents)
+		}
+		if o := after.owner(name); o != before.owner(name) {
+			if o != n {
+				return fmt.Errorf("%s: %q moves from shard %d to %d, not to the new shard", b.name, name, before.owner(name), o)
+			}
+			moving++
+		}
+	}
+	report, err := after.Rebalance(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.name, err)
+	}
+	if report.Moved != moving || report.Dropped != 0 || report.Kept != 0 {
+		return fmt.Errorf("%s: rebalance did %+v, want %d moved", b.name, report, moving)
+	}
+	for name, contents := range poems {
+		for i, shard := range shards {
+			got, err := shard.Load(ctx, name)
+			if i == after.owner(name) && (err != nil || string(got) != contents) {
+				return fmt.Errorf("%s: %q in its shard %d: %q, %v, want %q", b.name, name, i, got, err, contents)
+			}
+			if i != after.owner(name) && !errors.Is(err, ErrNoPoem) {
+				return fmt.Errorf("%s: %q is still in shard %d", b.name, name, i)
+			}
+		}
+	}
+	if report, err := after.Rebalance(ctx); err != nil || report != (RebalanceReport{}) {
+		return fmt.Errorf("%s: second rebalance did %+v, %v, want nothing", b.name, report, err)
+	}
+	return nil
+}
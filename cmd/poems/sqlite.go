@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ### Poems in a database
+//
+// A `SQLiteStorage` keeps poems in a table of an SQLite database. It does
+// not open the database; it gets a `*sql.DB` injected, so the container
+// decides which database, and closes it when it is disposed, as a
+// `*sql.DB` is an `io.Closer`.
+//
+// The example does not depend on an SQLite driver. A program that uses the
+// storage imports one, such as
+//
+//	import _ "modernc.org/sqlite"
+//
+// and sets "storage.sqlite" to the database file, and "storage.driver" to
+// the name that the driver registers, if it is not "sqlite":
+//
+//	POEMS_STORAGE_SQLITE=poems.db go run ./cmd/poems
+//
+// The schema migrates itself. SQLite keeps a version number in the
+// database file, `PRAGMA user_version`, which starts at 0. `Init` applies
+// the migrations after that version, each in a transaction along with the
+// new version number, so a new file gets the whole schema, and an old one
+// gets what it lacks. Instances that share the database take turns: `Init`
+// holds the lock "sqlite.migrate" of the injected `Locker`, so the second
+// instance finds the schema migrated. See `locks.go`.
+
+// `sqliteMigrations` are the schema changes, in order. The version of a
+// database is the number of migrations applied to it. Migrations are only
+// ever appended.
+var sqliteMigrations = []string{
+	`CREATE TABLE poems (name TEXT PRIMARY KEY, contents BLOB NOT NULL)`,
+	`ALTER TABLE poems ADD COLUMN revision INTEGER NOT NULL DEFAULT 1`,
+	`ALTER TABLE poems ADD COLUMN meta TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE revisions (name TEXT NOT NULL, revision INTEGER NOT NULL, contents BLOB NOT NULL, saved INTEGER NOT NULL, PRIMARY KEY (name, revision))`,
+	`INSERT INTO revisions (name, revision, contents, saved) SELECT name, revision, contents, 0 FROM poems`,
+}
+
+// The statements of `SQLiteStorage`.
+const (
+	sqlSave     = `INSERT INTO poems (name, contents) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET contents = excluded.contents, revision = poems.revision + 1`
+	sqlLoad     = `SELECT contents FROM poems WHERE name = ?`
+	sqlList     = `SELECT name FROM poems WHERE name > ? ORDER BY name LIMIT ?`
+	sqlHead     = `SELECT name FROM poems ORDER BY name LIMIT ?`
+	sqlRevision = `SELECT revision FROM poems WHERE name = ?`
+	sqlCreate   = `INSERT INTO poems (name, contents) VALUES (?, ?) ON CONFLICT (name) DO NOTHING`
+	sqlUpdate   = `UPDATE poems SET contents = ?, revision = revision + 1 WHERE name = ? AND revision = ?`
+	sqlSaveMeta = `UPDATE poems SET meta = ? WHERE name = ?`
+	sqlLoadMeta = `SELECT meta FROM poems WHERE name = ?`
+
+	sqlRecord       = `INSERT INTO revisions (name, revision, contents, saved) SELECT name, revision, contents, ? FROM poems WHERE name = ?`
+	sqlHistory      = `SELECT revision, length(contents), saved FROM revisions WHERE name = ? ORDER BY revision`
+	sqlLoadRevision = `SELECT contents FROM revisions WHERE name = ? AND revision = ?`
+)
+
+// `SQLiteStorage` keeps poems in an SQLite database.
+type SQLiteStorage struct {
+	db     *sql.DB
+	locker Locker
+	now    func() time.Time // Dates the revisions.
+}
+
+// `NewSQLiteStorage` keeps poems in `db`, and migrates its schema under a
+// lock of `locker`.
+func NewSQLiteStorage(db *sql.DB, locker Locker) *SQLiteStorage {
+	return &SQLiteStorage{db: db, locker: locker, now: time.Now}
+}
+
+// `Init` migrates the schema to the current version.
+func (s *SQLiteStorage) Init(ctx context.Context) (err error) {
+	unlock, err := s.locker.Lock(ctx, "sqlite.migrate")
+	if err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	defer func() {
+		if uerr := unlock(); err == nil && uerr != nil {
+			err = fmt.Errorf("sqlite: %w", uerr)
+		}
+	}()
+	var version int
+	if err := s.db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("sqlite: schema version: %w", err)
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("sqlite: schema version %d is newer than this program (%d)", version, len(sqliteMigrations))
+	}
+	for v := version; v < len(sqliteMigrations); v++ {
+		if err := s.migrate(ctx, v+1); err != nil {
+			return fmt.Errorf("sqlite: migration %d: %w", v+1, err)
+		}
+	}
+	return nil
+}
+
+// `migrate` applies the migration to `version`.
+func (s *SQLiteStorage) migrate(ctx context.Context, version int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, sqliteMigrations[version-1]); err != nil {
+		return err
+	}
+	// PRAGMA does not take parameters.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// `Save` saves a poem, replacing the poem of the same name, and records
+// the new revision; see `history.go`.
+func (s *SQLiteStorage) Save(ctx context.Context, name string, contents []byte) error {
+	if contents == nil {
+		contents = []byte{} // The column is NOT NULL.
+	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqlSave, name, contents); err != nil {
+			return err
+		}
+		return s.record(ctx, tx, name)
+	})
+	if err != nil {
+		return fmt.Errorf("save %q: %w", name, err)
+	}
+	return nil
+}
+
+// `inTx` calls `f` in a transaction, which it commits if `f` succeeds.
+func (s *SQLiteStorage) inTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// `record` copies the row of the poem `name` to its history.
+func (s *SQLiteStorage) record(ctx context.Context, tx *sql.Tx, name string) error {
+	_, err := tx.ExecContext(ctx, sqlRecord, s.now().UnixNano(), name)
+	return err
+}
+
+func (s *SQLiteStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	var contents []byte
+	err := s.db.QueryRowContext(ctx, sqlLoad, name).Scan(&contents)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("load %q: %w", name, ErrNoPoem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load %q: %w", name, err)
+	}
+	if contents == nil {
+		contents = []byte{} // Some drivers scan an empty blob as nil.
+	}
+	return contents, nil
+}
+
+func (s *SQLiteStorage) Type() string {
+	return "SQLiteStorage"
+}
+
+// #### Revisions
+//
+// The `SQLiteStorage` keeps a revision with each poem, since migration 2,
+// and compares it in the statement that saves: a conditional save is an
+// INSERT that does nothing if the poem exists, or an UPDATE of the row at
+// the expected revision. If no row changes, the poem has moved on.
+
+func (s *SQLiteStorage) Revision(ctx context.Context, name string) (Revision, error) {
+	var rev int64
+	err := s.db.QueryRowContext(ctx, sqlRevision, name).Scan(&rev)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("revision of %q: %w", name, err)
+	}
+	return Revision(rev), nil
+}
+
+func (s *SQLiteStorage) SaveIf(ctx context.Context, name string, contents []byte, expected Revision) (Revision, error) {
+	if contents == nil {
+		contents = []byte{}
+	}
+	var n int64
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var res sql.Result
+		var err error
+		if expected == 0 {
+			res, err = tx.ExecContext(ctx, sqlCreate, name, contents)
+		} else {
+			res, err = tx.ExecContext(ctx, sqlUpdate, contents, name, int64(expected))
+		}
+		if err != nil {
+			return err
+		}
+		if n, err = res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		return s.record(ctx, tx, name)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("save %q: %w", name, err)
+	}
+	if n == 0 {
+		actual, err := s.Revision(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		return 0, &ConflictError{Name: name, Expected: expected, Actual: actual}
+	}
+	return expected + 1, nil
+}
@@ -0,0 +1,153 @@
+//go:build sqlite
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// #### The SQL itself
+//
+// `memSQL` takes the statements of the `SQLiteStorage` on trust. With the
+// build tag "sqlite", the laws also check the storage against SQLite, with
+// the driver github.com/mattn/go-sqlite3, which needs cgo, and
+// `TestSQLiteMigrations` migrates real databases:
+//
+//	go test -tags sqlite ./cmd/poems
+
+func init() {
+	backends = append(backends, backend{"SQLiteStorage on SQLite", func() PoemStorage {
+		s := NewSQLiteStorage(openSQLite(), NewLocalLocker())
+		if err := s.Init(context.Background()); err != nil {
+			panic(err)
+		}
+		return s
+	}, true})
+}
+
+// `openSQLite` opens a database in memory. Each connection to ":memory:"
+// has a database of its own, so the pool keeps just one.
+func openSQLite() *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		panic(err)
+	}
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+// `TestSQLiteMigrations` migrates a database from each version of the
+// schema, with a poem that was saved in that version, and checks that the
+// poem is still there, with its revision and its history.
+func TestSQLiteMigrations(t *testing.T) {
+	ctx := context.Background()
+	for version := 0; version <= len(sqliteMigrations); version++ {
+		t.Run(fmt.Sprint("version ", version), func(t *testing.T) {
+			db := openSQLite()
+			defer db.Close()
+			for v := 1; v <= version; v++ {
+				if _, err := db.Exec(sqliteMigrations[v-1]); err != nil {
+					t.Fatalf("migration %d: %v", v, err)
+				}
+			}
+			if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+				t.Fatal(err)
+			}
+			saved := version >= 1 && version < len(sqliteMigrations)
+			if saved {
+				// The statement of the first version; the later ones also
+				// record the revision.
+				if _, err := db.Exec(`INSERT INTO poems (name, contents) VALUES (?, ?)`, "ode", []byte("Oh")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := NewSQLiteStorage(db, NewLocalLocker())
+			for i := 0; i < 2; i++ { // The second Init finds nothing to do.
+				if err := s.Init(ctx); err != nil {
+					t.Fatalf("Init %d: %v", i+1, err)
+				}
+			}
+			var got int
+			if err := db.QueryRow(`PRAGMA user_version`).Scan(&got); err != nil || got != len(sqliteMigrations) {
+				t.Fatalf("version after Init: got %d, %v, want %d", got, err, len(sqliteMigrations))
+			}
+			if !saved {
+				if _, err := s.Load(ctx, "ode"); !errors.Is(err, ErrNoPoem) {
+					t.Errorf("Load of a poem that was never saved: got %v, want ErrNoPoem", err)
+				}
+				return
+			}
+			if contents, err := s.Load(ctx, "ode"); err != nil || string(contents) != "Oh" {
+				t.Errorf("Load: got %q, %v", contents, err)
+			}
+			if rev, err := s.Revision(ctx, "ode"); err != nil || rev != 1 {
+				t.Errorf("Revision: got %d, %v, want 1", rev, err)
+			}
+			if h, err := s.History(ctx, "ode"); err != nil || len(h) != 1 || h[0].Revision != 1 {
+				t.Errorf("History: got %+v, %v, want revision 1", h, err)
+			}
+			if _, err := s.SaveIf(ctx, "ode", []byte("Oh, the poem"), 1); err != nil {
+				t.Errorf("SaveIf after the migration: %v", err)
+			}
+		})
+	}
+}
+
+func TestSQLiteNewerSchema(t *testing.T) {
+	db := openSQLite()
+	defer db.Close()
+	if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, len(sqliteMigrations)+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSQLiteStorage(db, NewLocalLocker()).Init(context.Background()); err == nil {
+		t.Error("Init of a database from a newer program succeeded")
+	}
+}
+
+// `TestSQLiteSaveIf` checks on SQLite that the statements of `SaveIf`
+// change no row when the revision is not the expected one: SQLite, not
+// `memSQL`, reports how many rows an INSERT that does nothing changed.
+func TestSQLiteSaveIf(t *testing.T) {
+	ctx := context.Background()
+	s := NewSQLiteStorage(openSQLite(), NewLocalLocker())
+	if err := s.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range []struct {
+		expected Revision
+		want     Revision // The new revision, or the actual one of the conflict.
+		conflict bool
+	}{
+		{0, 1, false},
+		{0, 1, true},
+		{1, 2, false},
+		{1, 2, true},
+		{3, 2, true},
+		{2, 3, false},
+	} {
+		rev, err := s.SaveIf(ctx, "ode", []byte(fmt.Sprint("verse ", i)), step.expected)
+		var ce *ConflictError
+		switch {
+		case step.conflict && (!errors.As(err, &ce) || ce.Actual != step.want):
+			t.Errorf("step %d: SaveIf at %d: got %v, want a conflict at %d", i, step.expected, err, step.want)
+		case !step.conflict && (err != nil || rev != step.want):
+			t.Errorf("step %d: SaveIf at %d: got %d, %v, want %d", i, step.expected, rev, err, step.want)
+		}
+	}
+	if err := s.Save(ctx, "ode", []byte("the last verse")); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := s.Revision(ctx, "ode"); err != nil || rev != 4 {
+		t.Errorf("Revision after Save: got %d, %v, want 4", rev, err)
+	}
+	if h, err := s.History(ctx, "ode"); err != nil || len(h) != 4 {
+		t.Errorf("History: got %+v, %v, want 4 revisions", h, err)
+	}
+}
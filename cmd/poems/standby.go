@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ### Warm standby
+//
+// A `ReplicatedStorage` writes every poem to all its replicas as it is
+// saved, and waits for them. A warm standby is cheaper: a second storage,
+// perhaps in another region, that a job brings up to date with the files
+// every so often. If the files are lost, the standby has the poems of the
+// last sync, and the program can be pointed at it.
+//
+// `Sync` copies only what has changed. It remembers what it copied: the
+// revision of each poem, if the primary is a `Revisioner`, and its
+// checksum. A poem whose revision has not moved is not even read; one
+// whose checksum is what was copied is not written. Poems that `Sync` has
+// not seen, such as after a restart, are compared with the checksum of the
+// standby's copy. Poems that the primary no longer lists are deleted from
+// the standby, if the standby can delete them and list its poems.
+//
+// Syncs are time-boxed: the job gives each sync the setting
+// "standby.budget", and a sync that runs out of it stops where it is. The
+// next sync goes on from there, and starts over at the first poem once it
+// has passed the last, so that every poem gets its turn even if a sync
+// never gets through all of them. The setting "standby.storage" names the
+// binding of the standby, and "standby.every" how often the leader syncs
+// it. Without a standby, there is no job.
+
+// `Standby` brings a standby storage up to date with a primary.
+type Standby struct {
+	primary, standby PoemStorage
+
+	mu     sync.Mutex // Held by `Sync`, so that syncs do not overlap.
+	copied map[string]copiedPoem
+	resume string // The last poem of a sync that ran out of time.
+}
+
+// A `copiedPoem` is what `Sync` copied of a poem.
+type copiedPoem struct {
+	revision Revision // 0 if the primary is not a `Revisioner`.
+	checksum string
+}
+
+// `SyncReport` counts what a sync did.
+type SyncReport struct {
+	Copied    int // Poems that were new or changed.
+	Unchanged int
+	Deleted   int // Poems that the primary no longer has.
+}
+
+// `NewStandby` keeps `standby` up to date with `primary`.
+func NewStandby(primary, standby PoemStorage) *Standby {
+	return &Standby{primary: primary, standby: standby, copied: map[string]copiedPoem{}}
+}
+
+// `Sync` copies the poems of the primary that have changed since they
+// were last copied, and deletes the poems that the primary no longer
+// lists. When `ctx` is done, it stops, and returns what it did so far
+// along with the error of `ctx`. The next sync goes on from there.
+func (s *Standby) Sync(ctx context.Context) (SyncReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var report SyncReport
+	names, err := ListAll(ctx, s.primary)
+	if err != nil {
+		return report, fmt.Errorf("sync: %w", err)
+	}
+	// The poems after the last poem of the previous sync go first.
+	start := sort.SearchStrings(names, s.resume)
+	if start < len(names) && names[start] == s.resume {
+		start++
+	}
+	order := append(append([]string{}, names[start:]...), names[:start]...)
+	for _, name := range order {
+		if err := ctx.Err(); err != nil {
+			return report, fmt.Errorf("sync: %w", err)
+		}
+		copied, err := s.sync(ctx, name)
+		if err != nil {
+			return report, fmt.Errorf("sync %q: %w", name, err)
+		}
+		if copied {
+			report.Copied++
+		} else {
+			report.Unchanged++
+		}
+		s.resume = name
+	}
+	s.resume = ""
+
+	report.Deleted, err = s.prune(ctx, names)
+	if err != nil {
+		return report, fmt.Errorf("sync: %w", err)
+	}
+	return report, nil
+}
+
+// `sync` copies the poem `name` if it has changed, and reports whether it
+// did. A poem that is deleted meanwhile is left for `prune`.
+func (s *Standby) sync(ctx context.Context, name string) (bool, error) {
+	last, seen := s.copied[name]
+	// The revision comes first, so that a save after it is copied again
+	// by the next sync.
+	var rev Revision
+	if rv, ok := s.primary.(Revisioner); ok {
+		var err error
+		if rev, err = rv.Revision(ctx, name); err != nil {
+			return false, err
+		}
+		if seen && rev != 0 && rev == last.revision {
+			return false, nil
+		}
+	}
+	checksum, err := Checksum(ctx, s.primary, name)
+	if errors.Is(err, ErrNoPoem) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !seen {
+		theirs, err := Checksum(ctx, s.standby, name)
+		if err != nil && !errors.Is(err, ErrNoPoem) {
+			return false, err
+		}
+		last, seen = copiedPoem{checksum: theirs}, err == nil
+	}
+	if seen && checksum == last.checksum {
+		s.copied[name] = copiedPoem{revision: rev, checksum: checksum}
+		return false, nil
+	}
+	contents, err := s.primary.Load(ctx, name)
+	if errors.Is(err, ErrNoPoem) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := s.standby.Save(ctx, name, contents); err != nil {
+		return false, err
+	}
+	s.copied[name] = copiedPoem{revision: rev, checksum: sum(contents)}
+	return true, nil
+}
+
+// `prune` deletes the poems of the standby that are not in `names`, and
+// returns how many it deleted. A standby that cannot list or delete its
+// poems keeps them.
+func (s *Standby) prune(ctx context.Context, names []string) (int, error) {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+	for name := range s.copied {
+		if !keep[name] {
+			delete(s.copied, name)
+		}
+	}
+	theirs, err := ListAll(ctx, s.standby)
+	if errors.Is(err, ErrNotListable) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, name := range theirs {
+		if keep[name] {
+			continue
+		}
+		err := Delete(ctx, s.standby, name)
+		if errors.Is(err, ErrNotDeletable) {
+			return deleted, nil
+		}
+		if err != nil && !errors.Is(err, ErrNoPoem) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// #### The standby job
+
+// `StandbyJob` syncs `s` every `every`, for up to `budget` each time, or
+// without a limit if `budget` is 0.
+func StandbyJob(s *Standby, every, budget time.Duration, l *log.Logger) Job {
+	return Job{
+		Name:  "standby",
+		Every: every,
+		Run: func(ctx context.Context) error {
+			if budget > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, budget)
+				defer cancel()
+			}
+			report, err := s.Sync(ctx)
+			l.Printf("standby: copied %d, unchanged %d, deleted %d", report.Copied, report.Unchanged, report.Deleted)
+			if errors.Is(err, context.DeadlineExceeded) {
+				l.Printf("standby: out of time after %v; the next sync goes on", budget)
+				return nil
+			}
+			return err
+		},
+	}
+}
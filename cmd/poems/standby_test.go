@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// #### Conformance
+//
+// `checkStandby` syncs a standby with a primary of random poems, and
+// checks that the standby then has the poems of the primary, that a sync
+// without changes copies nothing, and that a sync that runs out of time
+// leaves the rest to the next. `TestLaws` runs it once on random keyed
+// backends.
+func checkStandby(ctx context.Context, r *rand.Rand) error {
+	var keyed []backend
+	for _, b := range backends {
+		if b.keyed {
+			keyed = append(keyed, b)
+		}
+	}
+	pb, sb := keyed[r.Intn(len(keyed))], keyed[r.Intn(len(keyed))]
+	primary, standby := pb.new(), sb.new()
+	s := NewStandby(primary, standby)
+	desc := fmt.Sprintf("%s to %s", pb.name, sb.name)
+
+	same := func(want SyncReport) error {
+		got, err := s.Sync(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", desc, err)
+		}
+		if got.Copied != want.Copied || got.Unchanged != want.Unchanged || (got.Deleted != want.Deleted && canPrune(standby)) {
+			return fmt.Errorf("%s: sync did %+v, want %+v", desc, got, want)
+		}
+		names, err := ListAll(ctx, primary)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			mine, err := primary.Load(ctx, name)
+			if err != nil {
+				return err
+			}
+			theirs, err := standby.Load(ctx, name)
+			if err != nil || !bytes.Equal(mine, theirs) {
+				return fmt.Errorf("%s: standby has %q, %v of %q, want %q", desc, theirs, err, name, mine)
+			}
+		}
+		return nil
+	}
+
+	n := 4 + r.Intn(5) // "poem 3" changes last.
+	for i := 0; i < n; i++ {
+		if err := primary.Save(ctx, fmt.Sprintf("poem %d", i), []byte(fmt.Sprintf("verse %d", r.Int()))); err != nil {
+			return err
+		}
+	}
+	if err := same(SyncReport{Copied: n}); err != nil {
+		return err
+	}
+	if err := same(SyncReport{Unchanged: n}); err != nil {
+		return err
+	}
+
+	// A change, a poem that is saved again as it was, and, if the primary
+	// can delete, a deletion.
+	if err := primary.Save(ctx, "poem 0", []byte("changed")); err != nil {
+		return err
+	}
+	contents, err := primary.Load(ctx, "poem 1")
+	if err != nil {
+		return err
+	}
+	if err := primary.Save(ctx, "poem 1", contents); err != nil {
+		return err
+	}
+	want := SyncReport{Copied: 1, Unchanged: n - 1}
+	if err := Delete(ctx, primary, "poem 2"); err == nil {
+		want.Unchanged, want.Deleted = n-2, 1
+	} else if !errors.Is(err, ErrNotDeletable) {
+		return err
+	}
+	if err := same(want); err != nil {
+		return err
+	}
+
+	// A sync that is out of time copies nothing, and the next one copies
+	// everything.
+	if err := primary.Save(ctx, "poem 3", []byte("changed, too")); err != nil {
+		return err
+	}
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.Sync(done); !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%s: sync out of time: got %v, want context.Canceled", desc, err)
+	}
+	return same(SyncReport{Copied: 1, Unchanged: want.Unchanged - 1 + want.Copied})
+}
+
+// `canPrune` reports whether a sync deletes from the standby `ps`.
+func canPrune(ps PoemStorage) bool {
+	_, lists := ps.(Lister)
+	_, deletes := ps.(Deleter)
+	return lists && deletes
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ### Storage middleware
+//
+// What the HTTP middleware of `middleware.go` is to requests, storage
+// middleware is to the calls of a storage: handlers that wrap handlers,
+// and see every call before the decorators and the backend do. They
+// enrich the context of the call, check it, or turn it away, and none of
+// them knows about the others or about the storage.
+//
+// Every storage middleware is a member of the group "storage.middleware",
+// and the setting "storage.middleware" lists those that run, outermost
+// first. They go onto the storages that poems get, and onto the files, as
+// the last decorator, so they see each call first:
+//
+//	POEMS_STORAGE_MIDDLEWARE=trace,validate go run ./cmd/poems
+//
+// The middleware sees an `Operation`: what kind of call it is, and the
+// poem that it is about. Calls that are not saves or loads fall back to
+// saves and loads where the storage cannot do them otherwise, and so pass
+// through the middleware as those.
+
+// An `Operation` is a call to a storage, as middleware sees it.
+type Operation struct {
+	Kind string // "save", "load", "delete", "exists", "list", "savemeta", or "loadmeta".
+	Name string // The poem, or "" for "list".
+	Size int    // The size of the poem, for "save".
+}
+
+// `writes` reports whether `op` changes the storage.
+func (op Operation) writes() bool {
+	return op.Kind == "save" || op.Kind == "delete" || op.Kind == "savemeta"
+}
+
+// A `StorageHandler` carries out an operation. The handler at the end of
+// the pipeline calls the storage.
+type StorageHandler func(ctx context.Context, op Operation) error
+
+// A `StorageMiddleware` wraps a storage handler.
+type StorageMiddleware interface {
+	// `Name` is the name under which the setting "storage.middleware"
+	// lists the middleware.
+	Name() string
+
+	// `Wrap` returns a handler that does the middleware's work and calls
+	// `next`, or returns an error without calling it.
+	Wrap(next StorageHandler) StorageHandler
+}
+
+// A `StoragePipeline` is the storage middleware that the configuration
+// enables, in order.
+type StoragePipeline struct {
+	middleware []StorageMiddleware
+}
+
+// `NewStoragePipeline` picks the middleware that `cfg` lists from
+// `available`, as `NewPipeline` does for HTTP.
+func NewStoragePipeline(cfg StorageConfig, available ...StorageMiddleware) (*StoragePipeline, error) {
+	middleware, err := pickMiddleware("storage middleware", cfg.Middleware, available)
+	if err != nil {
+		return nil, err
+	}
+	return &StoragePipeline{middleware: middleware}, nil
+}
+
+// `Wrap` wraps `h` in the pipeline's middleware, the first one outermost.
+func (p *StoragePipeline) Wrap(h StorageHandler) StorageHandler {
+	for i := len(p.middleware) - 1; i >= 0; i-- {
+		h = p.middleware[i].Wrap(h)
+	}
+	return h
+}
+
+// `Storage` returns `ps` behind the pipeline.
+func (p *StoragePipeline) Storage(ps PoemStorage) *PipelineStorage {
+	return &PipelineStorage{storage: ps, pipeline: p}
+}
+
+// A `PipelineStorage` passes every call through a pipeline of storage
+// middleware before it calls its storage.
+type PipelineStorage struct {
+	storage  PoemStorage
+	pipeline *StoragePipeline
+}
+
+// `do` runs `call` behind the pipeline, with the context that the
+// middleware hands on.
+func (s *PipelineStorage) do(ctx context.Context, op Operation, call func(ctx context.Context) error) error {
+	return s.pipeline.Wrap(func(ctx context.Context, _ Operation) error { return call(ctx) })(ctx, op)
+}
+
+func (s *PipelineStorage) Save(ctx context.Context, name string, contents []byte) error {
+	return s.do(ctx, Operation{Kind: "save", Name: name, Size: len(contents)}, func(ctx context.Context) error {
+		return s.storage.Save(ctx, name, contents)
+	})
+}
+
+func (s *PipelineStorage) Load(ctx context.Context, name string) ([]byte, error) {
+	var contents []byte
+	err := s.do(ctx, Operation{Kind: "load", Name: name}, func(ctx context.Context) error {
+		var err error
+		contents, err = s.storage.Load(ctx, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+func (s *PipelineStorage) Type() string {
+	return s.storage.Type()
+}
+
+func (s *PipelineStorage) Delete(ctx context.Context, name string) error {
+	return s.do(ctx, Operation{Kind: "delete", Name: name}, func(ctx context.Context) error {
+		return Delete(ctx, s.storage, name)
+	})
+}
+
+func (s *PipelineStorage) Exists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := s.do(ctx, Operation{Kind: "exists", Name: name}, func(ctx context.Context) error {
+		var err error
+		exists, err = Exists(ctx, s.storage, name)
+		return err
+	})
+	return exists, err
+}
+
+func (s *PipelineStorage) List(ctx context.Context, after Cursor, limit int) ([]string, Cursor, error) {
+	var names []string
+	var next Cursor
+	err := s.do(ctx, Operation{Kind: "list"}, func(ctx context.Context) error {
+		l, ok := s.storage.(Lister)
+		if !ok {
+			return ErrNotListable
+		}
+		var err error
+		names, next, err = l.List(ctx, after, limit)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return names, next, nil
+}
+
+func (s *PipelineStorage) SaveMeta(ctx context.Context, name string, meta Metadata) error {
+	return s.do(ctx, Operation{Kind: "savemeta", Name: name}, func(ctx context.Context) error {
+		return SaveMeta(ctx, s.storage, name, meta)
+	})
+}
+
+func (s *PipelineStorage) LoadMeta(ctx context.Context, name string) (Metadata, error) {
+	var meta Metadata
+	err := s.do(ctx, Operation{Kind: "loadmeta", Name: name}, func(ctx context.Context) error {
+		var err error
+		meta, err = LoadMeta(ctx, s.storage, name)
+		return err
+	})
+	return meta, err
+}
+
+// #### Tracing
+//
+// `Tracing` gives every call a trace ID, unless its context has one, so
+// that the calls that one call makes further down, such as those of a
+// `FanOut` to its storages, carry the same ID. It logs each call with its
+// ID, how long it took, and how it failed.
+type Tracing struct {
+	log *log.Logger
+}
+
+// `NewTracing` logs to `l`.
+func NewTracing(l *log.Logger) *Tracing {
+	return &Tracing{log: l}
+}
+
+type traceKey struct{}
+
+// `WithTraceID` returns a context that carries the trace ID `id`.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceKey{}, id)
+}
+
+// `TraceID` returns the trace ID of `ctx`, or "" if it has none.
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+// `newTraceID` returns a random trace ID.
+func newTraceID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (*Tracing) Name() string { return "trace" }
+
+func (t *Tracing) Wrap(next StorageHandler) StorageHandler {
+	return func(ctx context.Context, op Operation) error {
+		id := TraceID(ctx)
+		if id == "" {
+			var err error
+			if id, err = newTraceID(); err != nil {
+				return fmt.Errorf("%s %q: %w", op.Kind, op.Name, err)
+			}
+			ctx = WithTraceID(ctx, id)
+		}
+		start := time.Now()
+		err := next(ctx, op)
+		call := op.Kind
+		if op.Name != "" {
+			call += fmt.Sprintf(" %q", op.Name)
+		}
+		if op.Kind == "save" {
+			call += fmt.Sprintf(" (%d bytes)", op.Size)
+		}
+		if err != nil {
+			t.log.Printf("trace %s: %s after %v: %v", id, call, time.Since(start), err)
+		} else {
+			t.log.Printf("trace %s: %s in %v", id, call, time.Since(start))
+		}
+		return err
+	}
+}
+
+// #### Validation
+//
+// `Validation` turns away calls whose context is done, so that they do
+// not reach storages that would not notice, and calls with names that no
+// storage should have: empty ones, names that are not UTF-8, that have
+// control characters, or that are longer than `maxNameLen` bytes.
+type Validation struct{}
+
+// `maxNameLen` is the longest name that `Validation` lets through, in
+// bytes. File systems do not take much longer file names.
+const maxNameLen = 200
+
+// `ErrInvalidName` is returned for names that `Validation` turns away.
+var ErrInvalidName = errors.New("invalid poem name")
+
+func (Validation) Name() string { return "validate" }
+
+func (Validation) Wrap(next StorageHandler) StorageHandler {
+	return func(ctx context.Context, op Operation) error {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s %q: %w", op.Kind, op.Name, err)
+		}
+		if err := validName(op.Name); op.Kind != "list" && err != nil {
+			return fmt.Errorf("%s %q: %w", op.Kind, op.Name, err)
+		}
+		return next(ctx, op)
+	}
+}
+
+// `validName` returns an error that matches `ErrInvalidName` if `name` is
+// not a name that `Validation` lets through.
+func validName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: empty", ErrInvalidName)
+	case len(name) > maxNameLen:
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidName, maxNameLen)
+	case !utf8.ValidString(name):
+		return fmt.Errorf("%w: not UTF-8", ErrInvalidName)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return fmt.Errorf("%w: control characters", ErrInvalidName)
+	}
+	return nil
+}
+
+// #### Authorization
+//
+// `Authorization` keeps the poems of each tenant (see `quota.go`) to
+// those who may have them. Who calls is the `Principal` of the context, which the
+// caller attaches with `WithPrincipal`, such as a server from the session
+// of the request. A principal of a tenant may do anything with the poems
+// of its tenant, and with poems of no tenant; a principal of no tenant may
+// do anything with all poems. Without a principal, calls may read poems of
+// no tenant, and nothing else.
+type Authorization struct{}
+
+// A `Principal` is who calls a storage.
+type Principal struct {
+	Name   string
+	Tenant string // "" for all tenants.
+}
+
+type principalKey struct{}
+
+// `WithPrincipal` returns a context whose calls `p` makes.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// `PrincipalOf` returns the principal of `ctx`, if it has one.
+func PrincipalOf(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// `ErrUnauthorized` is returned for calls that `Authorization` turns away.
+var ErrUnauthorized = errors.New("unauthorized")
+
+func (Authorization) Name() string { return "auth" }
+
+func (Authorization) Wrap(next StorageHandler) StorageHandler {
+	return func(ctx context.Context, op Operation) error {
+		if err := authorize(ctx, op); err != nil {
+			return fmt.Errorf("%s %q: %w", op.Kind, op.Name, err)
+		}
+		return next(ctx, op)
+	}
+}
+
+// `authorize` returns an error that matches `ErrUnauthorized` if the
+// principal of `ctx` may not do `op`.
+func authorize(ctx context.Context, op Operation) error {
+	tenant := tenantOf(op.Name)
+	p, ok := PrincipalOf(ctx)
+	switch {
+	case !ok && (op.writes() || tenant != "" || op.Kind == "list"):
+		return fmt.Errorf("%w: nobody may %s", ErrUnauthorized, op.Kind)
+	case !ok:
+		return nil
+	case p.Tenant != "" && op.Kind == "list":
+		return fmt.Errorf("%w: %s of tenant %q may not list all poems", ErrUnauthorized, p.Name, p.Tenant)
+	case p.Tenant != "" && tenant != "" && tenant != p.Tenant:
+		return fmt.Errorf("%w: %s of tenant %q may not %s poems of tenant %q", ErrUnauthorized, p.Name, p.Tenant, op.Kind, tenant)
+	}
+	return nil
+}
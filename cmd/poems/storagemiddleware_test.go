@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mrand "math/rand"
+	"strings"
+)
+
+// #### Conformance
+//
+// `checkStorageMiddleware` checks a pipeline of all three middleware in a
+// random order around a random keyed backend: that the calls reach the
+// backend with a trace ID, the caller's if it has one, that invalid names and calls that are not allowed never reach it, and that
+// the middleware runs in the order of the setting. `TestLaws` runs it
+// once.
+func checkStorageMiddleware(ctx context.Context, r *mrand.Rand) error {
+	var keyed []backend
+	for _, b := range backends {
+		if b.keyed {
+			keyed = append(keyed, b)
+		}
+	}
+	b := keyed[r.Intn(len(keyed))]
+	backend := &traceProbe{PoemStorage: b.new()}
+	var order []string
+	recorder := func(name string) StorageMiddleware {
+		return probeMiddleware{name: name, order: &order}
+	}
+	names := []string{"trace", "validate", "auth", "first", "second"}
+	r.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+	p, err := NewStoragePipeline(StorageConfig{Middleware: names},
+		NewTracing(log.New(io.Discard, "", 0)), Validation{}, Authorization{}, recorder("first"), recorder("second"))
+	if err != nil {
+		return err
+	}
+	ps := p.Storage(backend)
+	desc := fmt.Sprintf("%s behind %s", b.name, strings.Join(names, ","))
+
+	// The order of the setting.
+	admin := WithPrincipal(ctx, Principal{Name: "admin"})
+	if err := ps.Save(admin, "poem", []byte("verse")); err != nil {
+		return fmt.Errorf("%s: %w", desc, err)
+	}
+	want := "first,second"
+	if strings.Index(strings.Join(names, ","), "first") > strings.Index(strings.Join(names, ","), "second") {
+		want = "second,first"
+	}
+	if got := strings.Join(order, ","); got != want {
+		return fmt.Errorf("%s: middleware ran as %s, want %s", desc, got, want)
+	}
+
+	// Trace IDs: new for a call without one, kept for a call with one.
+	if len(backend.ids) != 1 || backend.ids[0] == "" {
+		return fmt.Errorf("%s: backend saw trace IDs %q, want one", desc, backend.ids)
+	}
+	if _, err := ps.Load(WithTraceID(admin, "given"), "poem"); err != nil {
+		return fmt.Errorf("%s: %w", desc, err)
+	}
+	if got := backend.ids[len(backend.ids)-1]; got != "given" {
+		return fmt.Errorf("%s: backend saw trace ID %q, want %q", desc, got, "given")
+	}
+
+	// What is turned away never reaches the backend.
+	alice := WithPrincipal(ctx, Principal{Name: "alice", Tenant: "alice"})
+	for _, c := range []struct {
+		ctx  context.Context
+		name string
+		want error
+	}{
+		{admin, "", ErrInvalidName},
+		{admin, "poem\n", ErrInvalidName},
+		{admin, strings.Repeat("x", maxNameLen+1), ErrInvalidName},
+		{ctx, "poem", ErrUnauthorized},
+		{alice, "bob/poem", ErrUnauthorized},
+	} {
+		calls := len(backend.ids)
+		if err := ps.Save(c.ctx, c.name, []byte("verse")); !errors.Is(err, c.want) {
+			return fmt.Errorf("%s: save %q: got %v, want %v", desc, c.name, err, c.want)
+		}
+		if len(backend.ids) != calls {
+			return fmt.Errorf("%s: save %q reached the backend", desc, c.name)
+		}
+	}
+	if err := ps.Save(alice, "alice/poem", []byte("verse")); err != nil {
+		return fmt.Errorf("%s: save of alice: %w", desc, err)
+	}
+	if _, err := ps.Load(ctx, "poem"); err != nil {
+		return fmt.Errorf("%s: load of nobody: %w", desc, err)
+	}
+	if _, err := ps.Load(ctx, "alice/poem"); !errors.Is(err, ErrUnauthorized) {
+		return fmt.Errorf("%s: load of alice's poem by nobody: got %v, want ErrUnauthorized", desc, err)
+	}
+	done, cancel := context.WithCancel(admin)
+	cancel()
+	if err := ps.Save(done, "poem", []byte("never saved")); !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%s: cancelled save: got %v, want context.Canceled", desc, err)
+	}
+	return nil
+}
+
+// A `traceProbe` records the trace IDs of the calls that reach a storage.
+type traceProbe struct {
+	PoemStorage
+	ids []string
+}
+
+func (p *traceProbe) Save(ctx context.Context, name string, contents []byte) error {
+	p.ids = append(p.ids, TraceID(ctx))
+	return p.PoemStorage.Save(ctx, name, contents)
+}
+
+func (p *traceProbe) Load(ctx context.Context, name string) ([]byte, error) {
+	p.ids = append(p.ids, TraceID(ctx))
+	return p.PoemStorage.Load(ctx, name)
+}
+
+// A `probeMiddleware` records that it ran.
+type probeMiddleware struct {
+	name  string
+	order *[]string
+}
+
+func (m probeMiddleware) Name() string { return m.name }
+
+func (m probeMiddleware) Wrap(next StorageHandler) StorageHandler {
+	return func(ctx context.Context, op Operation) error {
+		*m.order = append(*m.order, m.name)
+		return next(ctx, op)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+
+	"github.com/appliedgo/di/fsys"
+)
+
+// ### Streaming poems
+//
+// `Save` and `Load` pass a poem as one `[]byte`, which is fine for a haiku
+// and not for a collected edition of a few hundred megabytes. Storages
+// that can read and write a poem bit by bit implement `Streamer`: `Open`
+// returns a reader of the poem, and `Create` a writer that replaces the
+// poem when it is closed. A poem that is being written is not there yet;
+// until `Close`, readers see the old poem, and a writer that fails, or
+// whose context is done, leaves it as it was.
+//
+// For other storages, the functions `Open` and `Create` buffer: `Open`
+// loads the poem, and the writer of `Create` saves it on `Close`. The
+// decorators buffer, too, as they work on whole poems, so only the bare
+// backends stream. The `FileStorage` streams into a temporary file if its
+// file system can (see `fsys.CreateFS`), and the `ObjectStorage` streams
+// what it reads. It buffers what it writes, as requests to the store are
+// signed with the hash of their body.
+
+// A `Streamer` is a storage that can read and write poems as streams.
+type Streamer interface {
+	// `Open` returns a reader of the poem `name`, or `ErrNoPoem`.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// `Create` returns a writer that replaces the poem `name` on `Close`.
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+}
+
+// A `StreamingStorage` is a storage that streams poems.
+type StreamingStorage interface {
+	PoemStorage
+	Streamer
+}
+
+// `Open` returns a reader of the poem `name` in `ps`, which streams if
+// `ps` is a `Streamer`.
+func Open(ctx context.Context, ps PoemStorage, name string) (io.ReadCloser, error) {
+	if st, ok := ps.(Streamer); ok {
+		return st.Open(ctx, name)
+	}
+	contents, err := ps.Load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(contents)), nil
+}
+
+// `Create` returns a writer of the poem `name` in `ps`, which streams if
+// `ps` is a `Streamer`.
+func Create(ctx context.Context, ps PoemStorage, name string) (io.WriteCloser, error) {
+	if st, ok := ps.(Streamer); ok {
+		return st.Create(ctx, name)
+	}
+	return bufferedCreate(ctx, ps, name)
+}
+
+// `bufferedCreate` returns a writer that saves the poem `name` in `ps`
+// when it is closed.
+func bufferedCreate(ctx context.Context, ps PoemStorage, name string) (io.WriteCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("create %q: %w", name, err)
+	}
+	return &bufferedWriter{ctx: ctx, storage: ps, name: name}, nil
+}
+
+// A `bufferedWriter` collects a poem until it is closed.
+type bufferedWriter struct {
+	ctx     context.Context
+	storage PoemStorage
+	name    string
+	buf     bytes.Buffer
+	closed  bool
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("write %q: %w", w.name, fs.ErrClosed)
+	}
+	if err := w.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("write %q: %w", w.name, err)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *bufferedWriter) Close() error {
+	if w.closed {
+		return fmt.Errorf("close %q: %w", w.name, fs.ErrClosed)
+	}
+	w.closed = true
+	// An empty buffer has no bytes at all, which some storages take for
+	// no poem.
+	return w.storage.Save(w.ctx, w.name, append([]byte{}, w.buf.Bytes()...))
+}
+
+// A `ctxReader` stops reading when its context is done.
+type ctxReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// #### The backends
+//
+// The `FileStorage` reads the file of the poem, and writes a temporary
+// file, which replaces the poem's file on `Close`, as in `Save`.
+
+func (s *FileStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("open %q: %w", name, err)
+	}
+	f, err := s.fs.Open(s.file(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("open %q: %w", name, ErrNoPoem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", name, err)
+	}
+	return ctxReader{ctx: ctx, ReadCloser: f}, nil
+}
+
+func (s *FileStorage) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	cfs, ok := s.fs.(fsys.CreateFS)
+	if !ok {
+		return bufferedCreate(ctx, s, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("create %q: %w", name, err)
+	}
+	file := s.file(name)
+	temp := s.temp(file)
+	w, err := cfs.Create(temp)
+	if err != nil {
+		return nil, fmt.Errorf("create %q: %w", name, err)
+	}
+	return &fileWriter{ctx: ctx, storage: s, name: name, file: file, temp: temp, w: w}, nil
+}
+
+// A `fileWriter` writes a poem into a temporary file.
+type fileWriter struct {
+	ctx        context.Context
+	storage    *FileStorage
+	name       string
+	file, temp string
+	w          io.WriteCloser
+	err        error // The first error, after which the poem stays as it was.
+	closed     bool
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		w.err = w.ctx.Err()
+	}
+	if w.closed {
+		return 0, fmt.Errorf("write %q: %w", w.name, fs.ErrClosed)
+	}
+	if w.err != nil {
+		return 0, fmt.Errorf("write %q: %w", w.name, w.err)
+	}
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+		return n, fmt.Errorf("write %q: %w", w.name, err)
+	}
+	return n, nil
+}
+
+func (w *fileWriter) Close() error {
+	if w.closed {
+		return fmt.Errorf("close %q: %w", w.name, fs.ErrClosed)
+	}
+	w.closed = true
+	err := w.w.Close()
+	if err == nil {
+		err = w.err
+	}
+	if err != nil {
+		w.storage.fs.Remove(w.temp)
+		return fmt.Errorf("save %q: %w", w.name, err)
+	}
+	// The revision is a copy of the temporary file.
+	f, err := w.storage.fs.Open(w.temp)
+	if err != nil {
+		w.storage.fs.Remove(w.temp)
+		return fmt.Errorf("save %q: %w", w.name, err)
+	}
+	defer f.Close()
+	if err := w.storage.replace(w.ctx, w.name, w.temp, f); err != nil {
+		return fmt.Errorf("save %q: %w", w.name, err)
+	}
+	return nil
+}
+
+// The `ObjectStorage` returns the body of the response to a GET, which
+// the HTTP client reads as it arrives, and stops reading when the context
+// of the request is done. It buffers what it writes.
+
+func (s *ObjectStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.send(ctx, http.MethodGet, s.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", name, err)
+	}
+	return resp.Body, nil
+}
+
+func (s *ObjectStorage) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return bufferedCreate(ctx, s, name)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+)
+
+// #### Conformance
+//
+// `checkStreams` checks that every poem in `names` reads the same from
+// `Open` as from `Load`, and that writing it with `Create` in random
+// pieces saves the same poem. A writer whose context is done before
+// `Close` must not change the poem, and neither must a writer that has
+// not been closed yet. `TestLaws` runs it on every stack. It leaves the
+// poems as they were.
+func checkStreams(ctx context.Context, r *rand.Rand, ps PoemStorage, names []string) error {
+	for _, name := range names {
+		contents, err := ps.Load(ctx, name)
+		if errors.Is(err, ErrNoPoem) {
+			if _, err := Open(ctx, ps, name); !errors.Is(err, ErrNoPoem) {
+				return fmt.Errorf("open of missing poem %q: got %v, want ErrNoPoem", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rc, err := Open(ctx, ps, name)
+		if err != nil {
+			return fmt.Errorf("open %q: %w", name, err)
+		}
+		read, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(read, contents) {
+			return fmt.Errorf("open %q: read %q, %v, want %q", name, read, err, contents)
+		}
+
+		// A writer that is cancelled before `Close` changes nothing.
+		cctx, cancel := context.WithCancel(ctx)
+		w, err := Create(cctx, ps, name)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("create %q: %w", name, err)
+		}
+		w.Write([]byte("not to be saved"))
+		if now, err := ps.Load(ctx, name); err != nil || !bytes.Equal(now, contents) {
+			cancel()
+			return fmt.Errorf("poem %q while written: %q, %v, want %q", name, now, err, contents)
+		}
+		cancel()
+		if err := w.Close(); !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("close of cancelled writer of %q: got %v, want context.Canceled", name, err)
+		}
+		if now, err := ps.Load(ctx, name); err != nil || !bytes.Equal(now, contents) {
+			return fmt.Errorf("poem %q after cancelled write: %q, %v, want %q", name, now, err, contents)
+		}
+
+		// A writer that writes the poem in pieces saves it whole.
+		w, err = Create(ctx, ps, name)
+		if err != nil {
+			return fmt.Errorf("create %q: %w", name, err)
+		}
+		for rest := contents; len(rest) > 0; {
+			n := 1 + r.Intn(len(rest))
+			if _, err := w.Write(rest[:n]); err != nil {
+				w.Close()
+				return fmt.Errorf("write %q: %w", name, err)
+			}
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("close writer of %q: %w", name, err)
+		}
+		if err := w.Close(); !errors.Is(err, fs.ErrClosed) {
+			return fmt.Errorf("second close of writer of %q: got %v, want fs.ErrClosed", name, err)
+		}
+		if now, err := ps.Load(ctx, name); err != nil || !bytes.Equal(now, contents) {
+			return fmt.Errorf("poem %q after streamed write: %q, %v, want %q", name, now, err, contents)
+		}
+	}
+	return nil
+}
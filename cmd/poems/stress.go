@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/appliedgo/di"
+)
+
+// ### Concurrent wiring
+//
+// A web server resolves poems from many goroutines at once, and may rewire
+// the container while it does. `stress` plays that server: `workers`
+// goroutines resolve poems, scopes and singletons, register providers,
+// and inspect the container, `rounds` times each. By itself, it only
+// checks that every poem loads what it saved. It is a demonstration of the
+// example's wiring under the race detector:
+//
+//	go run -race ./cmd/poems -stress 8
+//
+// The container's own guarantees, such as that a singleton is built once
+// however many goroutines ask for it, are tested in package di.
+//
+// The storages of the poems are fresh napkins and scoped notebooks, so each
+// is used by one goroutine only. One more notebook is shared by all
+// workers, which write and read their own poems in it.
+//
+// Every scope also takes a `lease`, which the scope must close when it is
+// disposed; leases that are still open at the end have leaked.
+func stress(workers, rounds int) error {
+	var open int64
+	c := di.New()
+	c.RegisterScoped(func() *lease {
+		atomic.AddInt64(&open, 1)
+		return &lease{open: &open}
+	})
+	c.RegisterSingleton(func() *log.Logger { return log.New(io.Discard, "", 0) })
+	c.Register(func() PoemStorage { return NewNapkin() })
+	c.Decorate(func(ps PoemStorage, l *log.Logger) PoemStorage { return NewLoggingStorage(ps, l) })
+	c.RegisterScoped(func() *Notebook { return NewNotebook() })
+	c.RegisterSingleton(func() *Notebook {
+		nb := NewNotebook()
+		nb.CopyOnRead = true
+		return nb
+	}, di.Named("shared"))
+	c.Provide(NewPoem)
+	c.Register(func() string { return "edition 0" }, di.Named("edition"))
+	c.SampleUsage(1)
+
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			errs <- worker(c, w, rounds)
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	if n := atomic.LoadInt64(&open); n != 0 {
+		return fmt.Errorf("%d leases leaked", n)
+	}
+	return c.Build()
+}
+
+// A `lease` is a resource of a scope.
+type lease struct {
+	open *int64
+}
+
+func (l *lease) Close() error {
+	atomic.AddInt64(l.open, -1)
+	return nil
+}
+
+// `worker` is one goroutine of `stress`.
+func worker(c *di.Container, w, rounds int) error {
+	ctx := context.Background()
+	for i := 0; i < rounds; i++ {
+		name := fmt.Sprintf("poem %d/%d", w, i)
+
+		poem, err := di.ResolveCtx[*Poem](ctx, c)
+		if err != nil {
+			return err
+		}
+		want := poem.String()
+		if err := poem.Save(ctx, name); err != nil {
+			return err
+		}
+		if err := poem.Load(ctx, name); err != nil {
+			return err
+		}
+		if got := poem.String(); got != want {
+			return fmt.Errorf("worker %d: loaded %q, saved %q", w, got, want)
+		}
+
+		shared := di.MustResolve[*Notebook](c, di.Named("shared"))
+		if err := shared.Save(ctx, name, []byte(want)); err != nil {
+			return err
+		}
+		if got, err := shared.Load(ctx, name); err != nil || string(got) != want {
+			return fmt.Errorf("worker %d: shared notebook loaded %q, %v", w, got, err)
+		}
+
+		scope := c.NewScope()
+		scope.SetEvictionPolicy(di.MaxEntries(1))
+		if _, err := di.Resolve[*lease](scope); err != nil {
+			return err
+		}
+		nb, err := di.Resolve[*Notebook](scope)
+		if err != nil {
+			return err
+		}
+		if err := nb.Save(ctx, name, []byte(want)); err != nil {
+			return err
+		}
+		if again := di.MustResolve[*Notebook](scope); again != nb {
+			return fmt.Errorf("worker %d: scope returned two notebooks", w)
+		}
+		if err := scope.Dispose(ctx); err != nil {
+			return err
+		}
+
+		// Now and then, rewire the storage while the other workers resolve,
+		// and hot-swap a value that they all hold handles of.
+		edition := di.MustResolve[di.Hot[string]](c, di.Named("edition"))
+		if edition.MustGet() == "" {
+			return fmt.Errorf("worker %d: empty edition", w)
+		}
+		if i%10 == 0 {
+			c.Register(func() PoemStorage { return NewNapkin() })
+			if err := di.ReplaceValue(c, fmt.Sprintf("edition %d.%d", w, i), di.Named("edition")); err != nil {
+				return err
+			}
+		}
+		_ = c.Graph()
+		_ = c.Stats()
+		_ = c.Usage()
+	}
+	return nil
+}
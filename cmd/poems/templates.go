@@ -0,0 +1,88 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"io/fs"
+)
+
+// ### Templates
+//
+// The pages of the web UI are `html/template` files in `templates/`. The
+// handlers do not parse them; they get a `TemplateRenderer` injected and
+// ask it for a page by name. Where the templates come from is an `fs.FS`
+// that the container injects as well: the files embedded in the program,
+// or, if the setting "http.templates" names a directory, the files there.
+//
+// In the dev profile, the renderer parses the templates anew for every
+// page, so a designer who edits them sees the change on the next reload:
+//
+//	POEMS_HTTP_TEMPLATES=cmd/poems/templates go run ./cmd/poems -serve :8080
+//
+// Both profiles parse the templates at startup, and fail right there if one
+// of them is broken; the prod profile keeps what it parsed.
+//
+// Templates can call the functions of the group "templates.funcs", such as
+// `asset` from `assets.go`.
+
+// A `TemplateRenderer` renders named pages.
+type TemplateRenderer interface {
+	// `Render` writes the page `name`, such as "poem.html", for `data`.
+	Render(w io.Writer, name string, data interface{}) error
+}
+
+//go:embed templates/*.html
+var embedded embed.FS
+
+// `embeddedTemplates` returns the templates embedded in the program.
+func embeddedTemplates() fs.FS {
+	sub, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		panic(err) // The directory is embedded, so this cannot fail.
+	}
+	return sub
+}
+
+// `HTMLTemplates` renders the `*.html` templates of a file system.
+type HTMLTemplates struct {
+	files  fs.FS
+	reload bool
+	funcs  template.FuncMap
+	tmpl   *template.Template // Unless reload is set.
+}
+
+// `NewHTMLTemplates` renders the templates in `files`, which can call the
+// functions of `funcs`. It parses them now, and with `reload` again for
+// every page.
+func NewHTMLTemplates(files fs.FS, reload bool, funcs ...template.FuncMap) (*HTMLTemplates, error) {
+	t := &HTMLTemplates{files: files, reload: reload, funcs: template.FuncMap{}}
+	for _, fm := range funcs {
+		for name, fn := range fm {
+			t.funcs[name] = fn
+		}
+	}
+	tmpl, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	if !reload {
+		t.tmpl = tmpl
+	}
+	return t, nil
+}
+
+func (t *HTMLTemplates) Render(w io.Writer, name string, data interface{}) error {
+	tmpl := t.tmpl
+	if t.reload {
+		var err error
+		if tmpl, err = t.parse(); err != nil {
+			return err
+		}
+	}
+	return tmpl.ExecuteTemplate(w, name, data)
+}
+
+func (t *HTMLTemplates) parse() (*template.Template, error) {
+	return template.New("").Funcs(t.funcs).ParseFS(t.files, "*.html")
+}
@@ -0,0 +1,177 @@
+package di_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// The tests in this file do little by themselves; they are meant to run
+// under the race detector:
+//
+//	go test -race ./...
+
+// parallel runs fn in n goroutines that start at the same time, and waits
+// for them.
+func parallel(n int, fn func(i int)) {
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			start.Wait()
+			fn(i)
+		}(i)
+	}
+	start.Done()
+	done.Wait()
+}
+
+func TestConcurrentSingletonIsBuiltOnce(t *testing.T) {
+	c := di.New()
+	var built int32
+	c.RegisterSingleton(func() *thing {
+		atomic.AddInt32(&built, 1)
+		time.Sleep(10 * time.Millisecond) // Let the others catch up.
+		return &thing{}
+	})
+	c.Provide(func(th *thing) *store { return &store{} })
+
+	got := make([]*thing, 32)
+	parallel(len(got), func(i int) {
+		if i%2 == 0 {
+			di.MustResolve[*store](c) // Through a dependency.
+		}
+		got[i] = di.MustResolve[*thing](c)
+	})
+	if built != 1 {
+		t.Errorf("singleton built %d times, want once", built)
+	}
+	for i, th := range got {
+		if th != got[0] {
+			t.Fatalf("resolution %d got another singleton", i)
+		}
+	}
+}
+
+func TestConcurrentTransientResolve(t *testing.T) {
+	c := di.New()
+	var cnt int32
+	c.Register(func() *thing { return &thing{id: int(atomic.AddInt32(&cnt, 1))} })
+	ids := make([]int, 32)
+	parallel(len(ids), func(i int) {
+		ids[i] = di.MustResolve[*thing](c).id
+	})
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("two resolutions got the value %d", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestConcurrentScopes(t *testing.T) {
+	c := di.New()
+	var open int32
+	c.RegisterSingleton(func() *counter { return &counter{} })
+	c.Provide(func(lc di.Lifecycle) *thing {
+		atomic.AddInt32(&open, 1)
+		lc.Append(di.Hook{OnStop: func(context.Context) error {
+			atomic.AddInt32(&open, -1)
+			return nil
+		}})
+		return &thing{}
+	}, di.WithLifetime(di.Scoped))
+
+	parallel(16, func(i int) {
+		ctx := context.Background()
+		s := c.NewScope()
+		s.Register(func() string { return "scope" }, di.Named("own"))
+		a := di.MustResolve[*thing](s)
+		if b := di.MustResolve[*thing](s); a != b {
+			t.Error("a scope built its scoped value twice")
+		}
+		di.MustResolve[*counter](s)
+		if err := s.Start(ctx); err != nil {
+			t.Error(err)
+		}
+		if got := di.MustResolve[string](s, di.Named("own")); got != "scope" {
+			t.Errorf("scope binding: got %q", got)
+		}
+		if err := s.Dispose(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+	if open != 0 {
+		t.Errorf("%d scoped values were not stopped", open)
+	}
+	if st := c.Stats(); st.Created != 1 {
+		t.Errorf("root created %d singletons, want 1", st.Created)
+	}
+}
+
+func TestConcurrentReplace(t *testing.T) {
+	c := di.New()
+	c.RegisterSingleton(func() *thing { return &thing{id: 0} })
+	type user struct{ th di.Hot[*thing] }
+	c.Provide(func(th di.Hot[*thing]) *user { return &user{th} })
+	u := di.MustResolve[*user](c)
+
+	const replacements = 50
+	parallel(9, func(i int) {
+		if i == 0 {
+			for id := 1; id <= replacements; id++ {
+				if err := di.ReplaceValue(c, &thing{id: id}); err != nil {
+					t.Error(err)
+				}
+			}
+			return
+		}
+		last := -1
+		for j := 0; j < replacements; j++ {
+			th := u.th.MustGet()
+			if th.id < last {
+				t.Errorf("Hot went back from %d to %d", last, th.id)
+			}
+			last = th.id
+			di.MustResolve[*thing](c)
+		}
+	})
+	if got := u.th.MustGet().id; got != replacements {
+		t.Errorf("after all replacements: got %d, want %d", got, replacements)
+	}
+	if got := di.MustResolve[*thing](c).id; got != replacements {
+		t.Errorf("Resolve after all replacements: got %d, want %d", got, replacements)
+	}
+}
+
+func TestConcurrentRegisterAndInspect(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "base" })
+	parallel(16, func(i int) {
+		switch i % 4 {
+		case 0:
+			c.Register(func() int { return i }, di.Named("n"))
+		case 1:
+			c.Register(func() string { return "member" }, di.Group())
+		case 2:
+			c.Bindings()
+			c.Graph()
+			c.Stats()
+		default:
+			di.MustResolve[string](c)
+		}
+	})
+	if _, err := di.Resolve[int](c, di.Named("n")); err != nil {
+		t.Error(err)
+	}
+	if got := di.MustResolve[[]string](c); len(got) != 4 {
+		t.Errorf("group has %d members, want 4", len(got))
+	}
+}
@@ -0,0 +1,463 @@
+/*
+Package config loads configuration into typed structs and puts it into a
+di.Container, so that constructors get their settings injected like any
+other dependency.
+
+A configuration is a struct whose fields are settings or sections, which
+are structs themselves. Every setting has a key: the dotted path of field
+names, lowercased, or the names given in config tags:
+
+	type Config struct {
+		Storage StorageConfig `config:"storage"`
+	}
+
+	type StorageConfig struct {
+		Dir      string        `config:"dir"`      // Key "storage.dir".
+		Interval time.Duration `config:"interval"` // Key "storage.interval".
+	}
+
+Settings come from sources: files in JSON or YAML, and environment
+variables. Later sources override earlier ones, and the values that the
+struct holds before loading are the defaults:
+
+	cfg, err := config.Register(c, Config{Storage: StorageConfig{Dir: "poems"}},
+		config.Optional(config.File(os.DirFS("/etc"), "poems.yaml")),
+		config.Env("POEMS"), // POEMS_STORAGE_DIR overrides storage.dir.
+	)
+
+Register binds the configuration, each of its sections and each setting, so
+both of these constructors can be wired without further glue:
+
+	c.Provide(NewFileStorage)                            // func(cfg StorageConfig) PoemStorage
+	c.Provide(OpenCatalog, di.ParamNames("storage.dir")) // func(dir string) *Catalog
+*/
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// A Source supplies settings.
+type Source interface {
+	// Settings returns the source's values for keys. Values are strings,
+	// as from YAML and the environment, or what encoding/json decodes into
+	// an interface{}, with numbers as json.Number. A source that has
+	// settings for other keys reports them as errors, as they are likely
+	// typos.
+	Settings(keys []string) (map[string]interface{}, error)
+
+	// String describes the source in error messages.
+	String() string
+}
+
+// Load fills the struct that dst points to from sources, in order. Settings
+// that no source has keep their values. If a source fails, or a value does
+// not fit its setting, Load returns an error and leaves *dst unchanged.
+func Load(dst interface{}, sources ...Source) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load needs a pointer to a struct, got %T", dst)
+	}
+	cfg := reflect.New(v.Elem().Type()).Elem()
+	cfg.Set(v.Elem())
+	settings := fields(cfg.Type(), "", nil)
+	var keys []string
+	for _, s := range settings {
+		if !s.section {
+			keys = append(keys, s.key)
+		}
+	}
+	for _, src := range sources {
+		values, err := src.Settings(keys)
+		if err != nil {
+			return fmt.Errorf("config: %v: %w", src, err)
+		}
+		for _, s := range settings {
+			raw, ok := values[s.key]
+			if !ok || raw == nil || s.section {
+				continue
+			}
+			if err := set(cfg.FieldByIndex(s.index), raw); err != nil {
+				return fmt.Errorf("config: %v: %s: %w", src, s.key, err)
+			}
+		}
+	}
+	v.Elem().Set(cfg)
+	return nil
+}
+
+// Register loads a configuration of type T, starting from defaults, and
+// binds it in c as singletons: the configuration itself, every section as
+// the unnamed binding of its type, and every setting under its key, as in
+// di.Value. If two sections have the same type, neither is bound unnamed,
+// but both are bound under their keys.
+func Register[T any](c *di.Container, defaults T, sources ...Source) (T, error) {
+	cfg := defaults
+	if err := Load(&cfg, sources...); err != nil {
+		return defaults, err
+	}
+	di.Value(c, "", cfg)
+	v := reflect.ValueOf(cfg)
+	settings := fields(v.Type(), "", nil)
+	count := map[reflect.Type]int{}
+	for _, s := range settings {
+		if s.section {
+			count[s.typ]++
+		}
+	}
+	for _, s := range settings {
+		fv := v.FieldByIndex(s.index)
+		bind(c, s.key, fv)
+		if s.section && count[s.typ] == 1 {
+			bind(c, "", fv)
+		}
+	}
+	return cfg, nil
+}
+
+// bind registers v as a singleton named name.
+func bind(c *di.Container, name string, v reflect.Value) {
+	provider := reflect.MakeFunc(reflect.FuncOf(nil, []reflect.Type{v.Type()}, false), func([]reflect.Value) []reflect.Value {
+		return []reflect.Value{v}
+	})
+	c.Register(provider.Interface(), di.Named(name), di.WithLifetime(di.Singleton), di.AllowNil())
+}
+
+// A setting is a field of a configuration struct.
+type setting struct {
+	key     string
+	index   []int
+	typ     reflect.Type
+	section bool // Whether the field is a struct of further settings.
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// fields returns the settings and sections of struct type t, depth first.
+func fields(t reflect.Type, prefix string, index []int) []setting {
+	var settings []setting
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := f.Tag.Lookup("config")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if !ok || name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		s := setting{
+			key:   prefix + name,
+			index: append(index[:len(index):len(index)], i),
+			typ:   f.Type,
+		}
+		if f.Type.Kind() == reflect.Struct && !reflect.PtrTo(f.Type).Implements(textUnmarshalerType) {
+			s.section = true
+			settings = append(settings, s)
+			settings = append(settings, fields(f.Type, s.key+".", s.index)...)
+			continue
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// set stores raw in v, converting it to v's type.
+func set(v reflect.Value, raw interface{}) error {
+	if s, ok := raw.(string); ok && reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("want a duration such as \"1m30s\", got %v", raw)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("want a string, got %v", raw)
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		switch r := raw.(type) {
+		case bool:
+			v.SetBool(r)
+		case string:
+			b, err := parseBool(r)
+			if err != nil {
+				return err
+			}
+			v.SetBool(b)
+		default:
+			return fmt.Errorf("want a boolean, got %v", raw)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := numeral(raw)
+		if err != nil {
+			return err
+		}
+		i, err := strconv.ParseInt(n, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := numeral(raw)
+		if err != nil {
+			return err
+		}
+		u, err := strconv.ParseUint(n, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		n, err := numeral(raw)
+		if err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(n, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []interface{}
+		switch r := raw.(type) {
+		case []interface{}:
+			items = r
+		case string:
+			// A list in an environment variable is comma-separated.
+			for _, item := range strings.Split(r, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		default:
+			return fmt.Errorf("want a list, got %v", raw)
+		}
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := set(s.Index(i), item); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		v.Set(s)
+	default:
+		return fmt.Errorf("settings of type %v are not supported", v.Type())
+	}
+	return nil
+}
+
+// parseBool parses the booleans of strconv.ParseBool and the words that
+// YAML files commonly use for them.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// numeral returns raw as the text of a number.
+func numeral(raw interface{}) (string, error) {
+	switch r := raw.(type) {
+	case json.Number:
+		return string(r), nil
+	case string:
+		return r, nil
+	}
+	return "", fmt.Errorf("want a number, got %v", raw)
+}
+
+// File returns a source that reads the file name from fsys. The format
+// follows from the extension: .json for JSON, and .yaml or .yml for YAML.
+func File(fsys fs.FS, name string) Source {
+	return fileSource{fsys: fsys, name: name}
+}
+
+type fileSource struct {
+	fsys fs.FS
+	name string
+}
+
+func (f fileSource) Settings(keys []string) (map[string]interface{}, error) {
+	var parse func([]byte) (map[string]interface{}, error)
+	switch path.Ext(f.name) {
+	case ".json":
+		parse = parseJSON
+	case ".yaml", ".yml":
+		parse = parseYAML
+	default:
+		return nil, errors.New("unknown format; use .json, .yaml or .yml")
+	}
+	data, err := fs.ReadFile(f.fsys, f.name)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(tree, keys)
+}
+
+func (f fileSource) String() string {
+	return f.name
+}
+
+// JSON returns a source that reads settings from a JSON object.
+func JSON(data []byte) Source {
+	return dataSource{format: "JSON", data: data, parse: parseJSON}
+}
+
+// YAML returns a source that reads settings from a YAML mapping. See
+// parseYAML for the subset of YAML that it understands.
+func YAML(data []byte) Source {
+	return dataSource{format: "YAML", data: data, parse: parseYAML}
+}
+
+type dataSource struct {
+	format string
+	data   []byte
+	parse  func([]byte) (map[string]interface{}, error)
+}
+
+func (d dataSource) Settings(keys []string) (map[string]interface{}, error) {
+	tree, err := d.parse(d.data)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(tree, keys)
+}
+
+func (d dataSource) String() string {
+	return d.format
+}
+
+// flatten turns a tree of nested maps into settings by key, and rejects
+// entries that are neither settings nor sections of keys.
+func flatten(tree map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	known := map[string]bool{}
+	sections := map[string]bool{}
+	for _, k := range keys {
+		known[k] = true
+		parts := strings.Split(k, ".")
+		for i := 1; i < len(parts); i++ {
+			sections[strings.Join(parts[:i], ".")] = true
+		}
+	}
+	values := map[string]interface{}{}
+	var walk func(prefix string, m map[string]interface{}) error
+	walk = func(prefix string, m map[string]interface{}) error {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			k, v := prefix+name, m[name]
+			sub, isMap := v.(map[string]interface{})
+			switch {
+			case known[k] && !isMap:
+				values[k] = v
+			case known[k]:
+				return fmt.Errorf("%q is a setting, not a section of settings", k)
+			case sections[k] && isMap:
+				if err := walk(k+".", sub); err != nil {
+					return err
+				}
+			case sections[k] && v == nil:
+				// An empty section.
+			case sections[k]:
+				return fmt.Errorf("%q is a section of settings, not a setting", k)
+			default:
+				return fmt.Errorf("unknown setting %q", k)
+			}
+		}
+		return nil
+	}
+	return values, walk("", tree)
+}
+
+// Env returns a source that reads settings from environment variables. The
+// variable of a setting is its key in upper case, with dots replaced by
+// underscores, after prefix and an underscore: with prefix "POEMS", the
+// setting "storage.dir" is read from POEMS_STORAGE_DIR. Lists are
+// comma-separated.
+func Env(prefix string) Source {
+	return envSource{prefix: prefix}
+}
+
+type envSource struct {
+	prefix string
+}
+
+func (e envSource) Settings(keys []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(e.variable(k)); ok {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+func (e envSource) variable(key string) string {
+	v := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	if e.prefix == "" {
+		return v
+	}
+	return e.prefix + "_" + v
+}
+
+func (e envSource) String() string {
+	if e.prefix == "" {
+		return "environment"
+	}
+	return "environment " + e.prefix + "_*"
+}
+
+// Optional returns a source that behaves like s, except that it has no
+// settings if s reports fs.ErrNotExist, as for a configuration file that
+// need not exist.
+func Optional(s Source) Source {
+	return optionalSource{s}
+}
+
+type optionalSource struct {
+	Source
+}
+
+func (o optionalSource) Settings(keys []string) (map[string]interface{}, error) {
+	values, err := o.Source.Settings(keys)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return values, err
+}
@@ -0,0 +1,281 @@
+package config_test
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/appliedgo/di"
+	"github.com/appliedgo/di/config"
+)
+
+type Config struct {
+	Name    string
+	Storage StorageConfig `config:"storage"`
+	Backup  StorageConfig `config:"backup"`
+	Server  ServerConfig  `config:"server"`
+	Secret  string        `config:"-"`
+}
+
+type StorageConfig struct {
+	Dir      string        `config:"dir"`
+	Interval time.Duration `config:"interval"`
+}
+
+type ServerConfig struct {
+	Port    uint16   `config:"port"`
+	Debug   bool     `config:"debug"`
+	Ratio   float64  `config:"ratio"`
+	Origins []string `config:"origins"`
+	Retries []int    `config:"retries"`
+	Level   level    `config:"level"`
+}
+
+// A level is a setting that parses itself.
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "info":
+		*l = 1
+	case "debug":
+		*l = 2
+	default:
+		return errors.New("unknown level " + string(text))
+	}
+	return nil
+}
+
+func defaults() Config {
+	return Config{
+		Name:    "poems",
+		Storage: StorageConfig{Dir: "poems", Interval: time.Minute},
+		Server:  ServerConfig{Port: 80},
+		Secret:  "kept",
+	}
+}
+
+func TestSources(t *testing.T) {
+	want := defaults()
+	want.Storage = StorageConfig{Dir: "/var/lib/poems", Interval: 90 * time.Second}
+	want.Server = ServerConfig{Port: 8080, Debug: true, Ratio: 0.5, Origins: []string{"a", "b"}, Retries: []int{1, 2}, Level: 2}
+
+	for _, tc := range []struct {
+		name string
+		src  config.Source
+		env  map[string]string
+	}{
+		{
+			name: "JSON",
+			src: config.JSON([]byte(`{
+				"storage": {"dir": "/var/lib/poems", "interval": "1m30s"},
+				"server": {"port": 8080, "debug": true, "ratio": 0.5, "origins": ["a", "b"], "retries": [1, 2], "level": "debug"}
+			}`)),
+		},
+		{
+			name: "YAML",
+			src: config.YAML([]byte(`
+storage:
+  dir: /var/lib/poems
+  interval: 1m30s
+server:
+  port: 8080
+  debug: yes
+  ratio: 0.5
+  origins: [a, b]
+  retries:
+    - 1
+    - 2
+  level: debug
+`)),
+		},
+		{
+			name: "environment",
+			src:  config.Env("POEMS"),
+			env: map[string]string{
+				"POEMS_STORAGE_DIR":      "/var/lib/poems",
+				"POEMS_STORAGE_INTERVAL": "1m30s",
+				"POEMS_SERVER_PORT":      "8080",
+				"POEMS_SERVER_DEBUG":     "on",
+				"POEMS_SERVER_RATIO":     "0.5",
+				"POEMS_SERVER_ORIGINS":   "a, b,",
+				"POEMS_SERVER_RETRIES":   "1,2",
+				"POEMS_SERVER_LEVEL":     "debug",
+				"POEMS_SECRET":           "not read",
+				"OTHER_STORAGE_DIR":      "not read",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			cfg := defaults()
+			if err := config.Load(&cfg, tc.src); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("got  %+v\nwant %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	t.Setenv("POEMS_STORAGE_DIR", "from env")
+	fsys := fstest.MapFS{
+		"poems.yaml": {Data: []byte("storage:\n  dir: from yaml\n  interval: 1h\nname: from yaml\n")},
+	}
+	cfg := defaults()
+	err := config.Load(&cfg,
+		config.File(fsys, "poems.yaml"),
+		config.JSON([]byte(`{"storage": {"dir": "from json"}}`)),
+		config.Env("POEMS"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Storage.Dir != "from env" || cfg.Storage.Interval != time.Hour || cfg.Name != "from yaml" || cfg.Server.Port != 80 {
+		t.Errorf("got %+v", cfg)
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"unknown setting", `{"storage": {"dri": "x"}}`, `unknown setting "storage.dri"`},
+		{"unknown section", `{"store": {"dir": "x"}}`, `unknown setting "store"`},
+		{"setting as section", `{"storage": {"dir": {"x": 1}}}`, `"storage.dir" is a setting, not a section`},
+		{"section as setting", `{"storage": "x"}`, `"storage" is a section of settings, not a setting`},
+		{"excluded field", `{"secret": "x"}`, `unknown setting "secret"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := defaults()
+			err := config.Load(&cfg, config.JSON([]byte(tc.in)))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want %q", err, tc.want)
+			}
+			if !reflect.DeepEqual(cfg, defaults()) {
+				t.Errorf("a failed Load changed the configuration: %+v", cfg)
+			}
+		})
+	}
+
+	// An empty section and null values are no settings.
+	cfg := defaults()
+	if err := config.Load(&cfg, config.YAML([]byte("storage:\nbackup:\n  dir: ~\n"))); err != nil {
+		t.Errorf("empty section: %v", err)
+	}
+}
+
+func TestBadValues(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"string", `{"name": 1}`, "JSON: name: want a string"},
+		{"duration", `{"storage": {"interval": "soon"}}`, "JSON: storage.interval:"},
+		{"duration as number", `{"storage": {"interval": 60}}`, "want a duration"},
+		{"bool", `{"server": {"debug": "maybe"}}`, "server.debug:"},
+		{"overflow", `{"server": {"port": 70000}}`, "server.port:"},
+		{"negative unsigned", `{"server": {"port": -1}}`, "server.port:"},
+		{"number as list", `{"server": {"origins": 1}}`, "want a list"},
+		{"list item", `{"server": {"retries": [1, "x"]}}`, "server.retries: item 1:"},
+		{"text unmarshaler", `{"server": {"level": "loud"}}`, "unknown level loud"},
+		{"malformed", `{"server": `, "config: JSON:"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := defaults()
+			err := config.Load(&cfg, config.JSON([]byte(tc.in)))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadTarget(t *testing.T) {
+	var n int
+	for _, dst := range []interface{}{nil, Config{}, &n, (*Config)(nil)} {
+		if err := config.Load(dst); err == nil {
+			t.Errorf("Load(%T): no error", dst)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"poems.json": {Data: []byte(`{"name": "json"}`)},
+		"poems.yml":  {Data: []byte("name: yml\n")},
+		"poems.toml": {Data: []byte("name = 'toml'\n")},
+		"bad.yaml":   {Data: []byte("name: [\n")},
+	}
+	for _, tc := range []struct {
+		src  config.Source
+		want string // The name, or the error.
+	}{
+		{config.File(fsys, "poems.json"), "json"},
+		{config.File(fsys, "poems.yml"), "yml"},
+		{config.File(fsys, "poems.toml"), "config: poems.toml: unknown format"},
+		{config.File(fsys, "bad.yaml"), "config: bad.yaml: line 1: name: unterminated sequence"},
+		{config.File(fsys, "missing.yaml"), "config: missing.yaml: open missing.yaml"},
+		{config.Optional(config.File(fsys, "missing.yaml")), "poems"},
+		{config.Optional(config.File(fsys, "bad.yaml")), "config: bad.yaml: line 1"},
+	} {
+		cfg := defaults()
+		err := config.Load(&cfg, tc.src)
+		got := cfg.Name
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.HasPrefix(got, tc.want) {
+			t.Errorf("%v: got %q, want %q", tc.src, got, tc.want)
+		}
+	}
+	_, err := config.File(fsys, "missing.yaml").Settings(nil)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	c := di.New()
+	cfg, err := config.Register(c, defaults(), config.JSON([]byte(`{"server": {"port": 8080}}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := di.MustResolve[Config](c); !reflect.DeepEqual(got, cfg) {
+		t.Errorf("configuration: got %+v", got)
+	}
+	if got := di.MustResolve[ServerConfig](c); got.Port != 8080 {
+		t.Errorf("section: got %+v", got)
+	}
+	if got := di.MustResolve[uint16](c, di.Named("server.port")); got != 8080 {
+		t.Errorf("setting: got %v", got)
+	}
+	if got := di.MustResolve[StorageConfig](c, di.Named("backup")); got.Dir != "" {
+		t.Errorf("named section: got %+v", got)
+	}
+	// Storage and Backup share a type, so neither is the unnamed binding.
+	if _, err := di.Resolve[StorageConfig](c); !errors.Is(err, di.ErrNotRegistered) {
+		t.Errorf("ambiguous section: got %v", err)
+	}
+
+	c.Provide(func(dir string, s ServerConfig) *string { return &dir }, di.ParamNames("storage.dir"))
+	if got := di.MustResolve[*string](c); *got != "poems" {
+		t.Errorf("injected setting: got %q", *got)
+	}
+
+	d := defaults()
+	if got, err := config.Register(di.New(), d, config.JSON([]byte(`{"x": 1}`))); err == nil || !reflect.DeepEqual(got, d) {
+		t.Errorf("failed Register: got %+v, %v, want the defaults and an error", got, err)
+	}
+}
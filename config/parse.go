@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseJSON decodes a JSON object.
+func parseJSON(data []byte) (map[string]interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var tree map[string]interface{}
+	if err := d.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// parseYAML decodes a YAML mapping. It understands the part of YAML that
+// configuration files use: nested block mappings, block and flow sequences
+// of scalars, plain and quoted scalars, and comments. Scalars are returned
+// as strings, and converted to the types of the settings later, so that
+// "yes" can be a string and "8080" a string or a number. Anchors, tags,
+// multi-line scalars and multiple documents are not supported.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	var p yamlParser
+	for n, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(stripComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || n == 0 && trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", n+1)
+		}
+		p.lines = append(p.lines, yamlLine{n: n + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(p.lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	tree, err := p.mapping(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, p.lines[p.i].errorf("unexpected indentation")
+	}
+	return tree, nil
+}
+
+type yamlLine struct {
+	n      int // Line number.
+	indent int
+	text   string // Without indentation and comment.
+}
+
+func (l yamlLine) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", l.n, fmt.Sprintf(format, args...))
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int // The next line.
+}
+
+// mapping parses the entries of a mapping at indent.
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, l.errorf("unexpected indentation")
+		}
+		k, v, ok := splitEntry(l.text)
+		if !ok {
+			return nil, l.errorf("want key: value, got %q", l.text)
+		}
+		key, err := scalar(k)
+		if err != nil {
+			return nil, l.errorf("key: %v", err)
+		}
+		name, ok := key.(string)
+		if !ok || name == "" {
+			return nil, l.errorf("invalid key %q", k)
+		}
+		if _, dup := m[name]; dup {
+			return nil, l.errorf("duplicate key %q", name)
+		}
+		p.i++
+		if v != "" {
+			if m[name], err = scalar(v); err != nil {
+				return nil, l.errorf("%s: %v", name, err)
+			}
+			continue
+		}
+		// A nested block: indented further, or a sequence, which may have
+		// the same indentation as its key.
+		if p.i < len(p.lines) {
+			next := p.lines[p.i]
+			switch {
+			case isItem(next.text) && next.indent >= indent:
+				if m[name], err = p.sequence(next.indent); err != nil {
+					return nil, err
+				}
+				continue
+			case next.indent > indent:
+				if m[name], err = p.mapping(next.indent); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		m[name] = nil
+	}
+	return m, nil
+}
+
+// sequence parses the items of a block sequence at indent.
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	var items []interface{}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent != indent || !isItem(l.text) {
+			break
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(l.text, "-"))
+		if _, _, ok := splitEntry(text); ok || isItem(text) || text == "" {
+			return nil, l.errorf("only scalars are supported in sequences")
+		}
+		item, err := scalar(text)
+		if err != nil {
+			return nil, l.errorf("%v", err)
+		}
+		items = append(items, item)
+		p.i++
+	}
+	return items, nil
+}
+
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitEntry splits "key: value" at the first colon outside of quotes
+// that ends the line or is followed by a space.
+func splitEntry(text string) (key, value string, ok bool) {
+	i := outsideQuotes(text, func(i int) bool {
+		return text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ')
+	})
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+}
+
+// stripComment removes a comment from a line: a # at the start or after a
+// space, outside of quotes.
+func stripComment(text string) string {
+	i := outsideQuotes(text, func(i int) bool {
+		return text[i] == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t')
+	})
+	if i < 0 {
+		return text
+	}
+	return text[:i]
+}
+
+// outsideQuotes returns the index of the first byte of text outside of
+// quoted strings for which match reports true, or -1.
+func outsideQuotes(text string, match func(i int) bool) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote == '"' && c == '\\':
+			i++ // Skip the escaped byte.
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[,", text[i-1]) >= 0):
+			// Quotes start scalars; an apostrophe in a word does not.
+			quote = c
+		case match(i):
+			return i
+		}
+	}
+	return -1
+}
+
+// scalar parses a scalar or a flow sequence of scalars. Null is returned
+// as nil.
+func scalar(text string) (interface{}, error) {
+	switch {
+	case text == "~" || text == "null" || text == "Null" || text == "NULL":
+		return nil, nil
+	case strings.HasPrefix(text, `"`):
+		return strconv.Unquote(text)
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated sequence %s", text)
+		}
+		items := []interface{}{}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		for inner != "" {
+			item, rest := nextFlowItem(inner)
+			v, err := scalar(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			inner = rest
+		}
+		return items, nil
+	case strings.HasPrefix(text, "{"), strings.HasPrefix(text, "|"), strings.HasPrefix(text, ">"),
+		strings.HasPrefix(text, "&"), strings.HasPrefix(text, "*"), strings.HasPrefix(text, "!"):
+		return nil, errors.New("unsupported YAML: " + text)
+	}
+	return text, nil
+}
+
+// nextFlowItem splits the first item off a flow sequence's contents.
+func nextFlowItem(s string) (item, rest string) {
+	i := outsideQuotes(s, func(i int) bool { return s[i] == ',' })
+	if i < 0 {
+		return strings.TrimSpace(s), ""
+	}
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+}
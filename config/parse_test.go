@@ -0,0 +1,167 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	type m = map[string]interface{}
+	type l = []interface{}
+	for _, tc := range []struct {
+		name string
+		in   string
+		want m
+	}{
+		{"empty", "", m{}},
+		{"only comments", "# poems\n\n  # more\n", m{}},
+		{"document start", "---\nname: poems\n", m{"name": "poems"}},
+		{
+			name: "nested mappings",
+			in:   "storage:\n  dir: /var/lib/poems\n  cache:\n    size: 10\nport: 8080\n",
+			want: m{"storage": m{"dir": "/var/lib/poems", "cache": m{"size": "10"}}, "port": "8080"},
+		},
+		{
+			name: "indentation of four",
+			in:   "storage:\n    dir: poems\n    mode: 0600\n",
+			want: m{"storage": m{"dir": "poems", "mode": "0600"}},
+		},
+		{
+			name: "indented document",
+			in:   "  a: 1\n  b: 2\n",
+			want: m{"a": "1", "b": "2"},
+		},
+		{
+			name: "block lists",
+			in:   "backends:\n  - napkin\n  - notebook\ntags:\n- a\n- b\n",
+			want: m{"backends": l{"napkin", "notebook"}, "tags": l{"a", "b"}},
+		},
+		{
+			name: "flow lists",
+			in:   "backends: [napkin, \"note, book\", 'it''s']\nnone: []\n",
+			want: m{"backends": l{"napkin", "note, book", "it's"}, "none": l{}},
+		},
+		{
+			name: "quoted values",
+			in:   "a: \"x: y # z\"\nb: 'single # quoted'\nc: \"tab\\tescape\"\nd: \"\"\n",
+			want: m{"a": "x: y # z", "b": "single # quoted", "c": "tab\tescape", "d": ""},
+		},
+		{
+			name: "quoted keys",
+			in:   "\"storage.dir\": poems\n'port': 80\n",
+			want: m{"storage.dir": "poems", "port": "80"},
+		},
+		{
+			name: "comments",
+			in:   "# head\na: 1 # trailing\nb: x#not a comment\nc: \"#\" # but this is\n",
+			want: m{"a": "1", "b": "x#not a comment", "c": "#"},
+		},
+		{
+			name: "nulls and empty sections",
+			in:   "a: ~\nb: null\nsection:\nc: value\n",
+			want: m{"a": nil, "b": nil, "section": nil, "c": "value"},
+		},
+		{
+			name: "colons in values",
+			in:   "url: http://example.com:8080/poems\ntime: 12:30\n",
+			want: m{"url": "http://example.com:8080/poems", "time": "12:30"},
+		},
+		{
+			name: "apostrophe in a word",
+			in:   "title: it's a poem\n",
+			want: m{"title": "it's a poem"},
+		},
+		{
+			name: "CRLF",
+			in:   "a: 1\r\nb:\r\n  c: 2\r\n",
+			want: m{"a": "1", "b": m{"c": "2"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got  %#v\nwant %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string // The error's prefix.
+	}{
+		{"tab indentation", "a:\n\tb: 1\n", "line 2: tabs"},
+		{"deeper indentation", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"dedent below the document", "  a: 1\nb: 2\n", "line 2: unexpected indentation"},
+		{"not an entry", "a: 1\njust text\n", "line 2: want key: value"},
+		{"duplicate key", "a: 1\nb: 2\na: 3\n", `line 3: duplicate key "a"`},
+		{"empty key", "\"\": 1\n", "line 1: invalid key"},
+		{"null key", "~: 1\n", "line 1: invalid key"},
+		{"unterminated double quote", "a: \"poem\n", "line 1: a:"},
+		{"unterminated single quote", "a: 'poem\n", "line 1: a: unterminated string"},
+		{"unterminated flow list", "a: [1, 2\n", "line 1: a: unterminated sequence"},
+		{"flow mapping", "a: {b: 1}\n", "line 1: a: unsupported YAML"},
+		{"block scalar", "a: |\n  text\n", "line 1: a: unsupported YAML"},
+		{"anchor", "a: &x 1\n", "line 1: a: unsupported YAML"},
+		{"alias", "a: *x\n", "line 1: a: unsupported YAML"},
+		{"tag", "a: !!str 1\n", "line 1: a: unsupported YAML"},
+		{"mapping in a list", "a:\n  - b: 1\n", "line 2: only scalars"},
+		{"nested list", "a:\n  - - 1\n", "line 2: only scalars"},
+		{"empty item", "a:\n  -\n", "line 2: only scalars"},
+		{"item outside of a list", "- 1\n", "line 1: want key: value"},
+		{"bad item", "a:\n  - 'x\n", "line 2: unterminated string"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tc.in))
+			if err == nil {
+				t.Fatalf("got %#v, want an error", got)
+			}
+			if !strings.HasPrefix(err.Error(), tc.want) {
+				t.Errorf("got %q, want it to start with %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// Whatever the input, parseYAML returns an error rather than panicking.
+func TestParseYAMLDoesNotPanic(t *testing.T) {
+	pieces := []string{"a", ":", " ", "  ", "\n", "-", "- ", "'", "\"", "\\", "#", "[", "]", ",", "~", "\t", "b: ", "{"}
+	// Every sequence of three pieces.
+	for _, p1 := range pieces {
+		for _, p2 := range pieces {
+			for _, p3 := range pieces {
+				in := p1 + p2 + p3
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Errorf("parseYAML(%q) panicked: %v", in, r)
+						}
+					}()
+					parseYAML([]byte(in))
+					parseYAML([]byte("x:\n" + in))
+				}()
+			}
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	got, err := parseJSON([]byte(`{"port": 8080, "storage": {"dir": "poems"}, "tags": ["a"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := got["port"].(interface{ String() string }); !ok || n.String() != "8080" {
+		t.Errorf("numbers: got %#v, want a json.Number", got["port"])
+	}
+	for _, in := range []string{``, `[1]`, `{"a": }`, `{"a": 1`, `"text"`} {
+		if _, err := parseJSON([]byte(in)); err == nil {
+			t.Errorf("parseJSON(%q): no error", in)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Container maps types to the providers that construct them.
+type Container struct {
+	mu       sync.RWMutex
+	bindings map[key]*binding
+	hooks    hooks
+	closers  closers
+	faults   map[key]*faultState
+
+	// Scopes share the usage samples and the tracer of their root.
+	usage  *usage
+	tracer *tracer
+
+	// Decorators, by the key of the binding they decorate.
+	decorators map[key][]*decorator
+
+	// Members of groups, by element type and group name.
+	groups map[key][]*binding
+
+	// Instances of singletons and scoped bindings, by binding.
+	instances map[*binding]*instance
+
+	profile string // Active profile; only the root's is used.
+
+	// Bindings replaced by Override, by key; nil for keys that had none.
+	overridden map[key]*binding
+
+	// Current values for Hot handles, by key; see Replace.
+	hot map[key]*hotCell
+
+	// Makers of proxies that break cycles, by key; see Proxy.
+	proxies map[key]proxyMaker
+
+	// Counters of the instance cache, accessed atomically.
+	created, reused, evicted int64
+
+	eviction EvictionPolicy // Policy for the instance cache, if any.
+	disposal time.Duration  // How long Dispose took.
+
+	parent   *Container // For scopes: the container the scope was created from.
+	disposed int32      // Accessed atomically.
+}
+
+// A binding is a registered provider together with its options and the
+// bookkeeping for its budgets.
+type binding struct {
+	provider reflect.Value
+	params   []reflect.Type // Types to resolve as arguments for provider.
+	name     string
+	location string // Source location of provider, for diagnostics.
+	module   string // Path of the module that installed the binding, if any.
+	lifetime Lifetime
+	group    bool // Member of the group of its type rather than the binding.
+
+	paramNames []string // Names of the bindings to inject into params, from ParamNames.
+	variadic   bool     // Whether the last param is variadic.
+
+	aliases []reflect.Type // Further types to bind, from As.
+	alias   *key           // For the bindings of aliases: the aliased binding.
+
+	fieldMode int     // Which tagged fields of the result to inject.
+	fields    []field // The fields to inject, if fieldMode allows any.
+
+	allowNil bool // Whether the provider may return nil.
+	override bool // Whether the binding replaces another one until ResetOverrides.
+
+	maxInstances  int
+	maxConcurrent int
+
+	// The budget counters are guarded by their own lock, as scopes
+	// construct values of bindings that their parent holds.
+	mu           sync.Mutex
+	live         int          // Instances handed out and not yet released.
+	constructing int          // Provider calls currently running.
+	concrete     reflect.Type // Dynamic type of the last value built, for Bindings.
+}
+
+// New returns a container whose only binding is the container's Lifecycle.
+func New() *Container {
+	c := &Container{
+		bindings: map[key]*binding{},
+		usage:    &usage{},
+		tracer:   &tracer{},
+	}
+	c.Register(func() Lifecycle { return &c.hooks })
+	return c
+}
+
+// Register makes provider the source of values of its result type.
+//
+// The provider must be a function without parameters that returns one
+// value, for example func() PoemStorage, or a value and an error, as in
+// func() (PoemStorage, error). The result type is the type the provider is
+// registered for, so to register a concrete type for an interface, declare
+// the interface as the result type. If the provider returns an error,
+// resolution fails with a *ProviderError.
+//
+// A later registration for the same type replaces the earlier one. Register
+// panics if provider is not a valid provider function.
+func (c *Container) Register(provider interface{}, opts ...Option) {
+	t := reflect.TypeOf(provider)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() != 0 || !validResults(t) {
+		panic(fmt.Sprintf("di: Register: provider must be a func() T or func() (T, error), got %T", provider))
+	}
+	c.bind(reflect.ValueOf(provider), opts)
+}
+
+// Provide registers a constructor function. Unlike a provider passed to
+// Register, a constructor may have parameters: whenever its result type is
+// resolved, the container first resolves every parameter type and calls the
+// constructor with the results. With
+//
+//	c.Provide(NewNotebook) // func NewNotebook() *Notebook
+//	c.Provide(func(n *Notebook) PoemStorage { return n })
+//	c.Provide(NewPoem)     // func NewPoem(ps PoemStorage) *Poem
+//
+// resolving a *Poem builds the notebook and injects it into NewPoem.
+//
+// The constructor must return one value, or a value and an error, as Open
+// does in func Open(cfg Config) (*DB, error). Provide panics otherwise.
+// A context.Context parameter is not resolved from a binding; it receives
+// the context passed to ResolveCtx.
+//
+// A variadic parameter is resolved like a slice, so it receives the members
+// of a group:
+//
+//	c.Provide(NewMultiStorage) // func NewMultiStorage(backends ...PoemStorage) *MultiStorage
+//
+// Unlike a slice parameter, it cannot be missing: without members, the
+// constructor is called without variadic arguments.
+func (c *Container) Provide(constructor interface{}, opts ...Option) {
+	t := reflect.TypeOf(constructor)
+	if t == nil || t.Kind() != reflect.Func || !validResults(t) {
+		panic(fmt.Sprintf("di: Provide: constructor must return a value or a value and an error, got %T", constructor))
+	}
+	c.bind(reflect.ValueOf(constructor), opts)
+}
+
+// bind stores a binding for the result type of the provider function fn.
+func (c *Container) bind(fn reflect.Value, opts []Option) {
+	t := fn.Type()
+	b := &binding{provider: fn, location: funcLocation(fn)}
+	for i := 0; i < t.NumIn(); i++ {
+		b.params = append(b.params, t.In(i))
+	}
+	b.variadic = t.IsVariadic()
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.checkParamNames()
+	if b.fieldMode != injectNone {
+		b.fields = tagged(t.Out(0), b.fieldMode)
+	}
+	k := key{typ: t.Out(0), name: b.name}
+	aliases := aliasBindings(k, b)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ak, ab := range aliases {
+		c.replace(ak, ab)
+	}
+	if b.group {
+		if c.groups == nil {
+			c.groups = map[key][]*binding{}
+		}
+		c.groups[k] = append(c.groups[k], b)
+		return
+	}
+	c.replace(k, b)
+}
+
+// Resolve stores a value of the type that target points to in *target.
+// target must be a non-nil pointer. For transient bindings, Resolve calls the
+// registered provider every time; singletons are constructed on the first
+// call and reused afterwards. Parameters of constructors registered with
+// Provide are resolved recursively.
+//
+// If no provider is registered for the type or for one of the parameters,
+// Resolve returns an error that wraps ErrNotRegistered. If the binding has a
+// budget that does not allow another construction, Resolve returns a
+// *LimitError. If providers depend on each other in a cycle, Resolve returns
+// a *CycleError that lists the cycle.
+//
+// Pass Named to resolve a named binding.
+func (c *Container) Resolve(target interface{}, opts ...Option) error {
+	return c.ResolveCtx(context.Background(), target, opts...)
+}
+
+// ResolveCtx is like Resolve, but providers and decorators that take a
+// context.Context parameter receive ctx, so that they can honor the
+// caller's deadline when they open remote storage, or start trace spans
+// under the caller's span:
+//
+//	func OpenCloudStorage(ctx context.Context, cfg Config) (PoemStorage, error)
+//
+// If ctx is done, no further provider is called and ResolveCtx returns
+// ctx.Err(). A singleton sees the context of the resolution that
+// constructs it, so providers should use ctx only during construction and
+// not keep it. Lazy and Factory resolve later, with a background context.
+func (c *Container) ResolveCtx(ctx context.Context, target interface{}, opts ...Option) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("di: Resolve: target must be a non-nil pointer, got %T", target)
+	}
+	result, err := c.resolve(ctx, nil, resolveKey(v.Elem().Type(), opts))
+	if err != nil {
+		return fmt.Errorf("di: resolve: %w", err)
+	}
+	v.Elem().Set(result)
+	return nil
+}
+
+// resolve returns a value for k, honoring the lifetime of its binding.
+// Errors are prefixed with the chain of types that led to the failure, for
+// example "*main.Poem: main.PoemStorage: no provider registered".
+//
+// path holds the bindings that are already being resolved further up the
+// call chain. If k is one of them, resolve returns a *CycleError instead of
+// recursing forever.
+func (c *Container) resolve(ctx context.Context, path resolution, k key) (reflect.Value, error) {
+	if atomic.LoadInt32(&c.disposed) != 0 {
+		return reflect.Value{}, ErrDisposed
+	}
+	if v, ok := c.proxy(ctx, path, k); ok {
+		return v, nil
+	}
+	if err := c.cycle(path, k); err != nil {
+		return reflect.Value{}, err
+	}
+	if len(path) == 0 && c.hasProxies() {
+		var release func()
+		ctx, release = enterProxied(ctx)
+		defer release()
+	}
+	if v, ok, err := c.resolveWrapper(ctx, path, k); ok {
+		return v, err
+	}
+	b, owner, ok := c.lookup(k)
+	if !ok {
+		if v, ok, err := c.resolveGroup(ctx, path, k); ok {
+			return v, err
+		}
+		err := fmt.Errorf("%v: %w", k, ErrNotRegistered)
+		c.tracer.emit(TraceEvent{Depth: len(path), Kind: "fail", Binding: k.String(), Error: err.Error()})
+		return reflect.Value{}, err
+	}
+	return c.instance(ctx, path, k, b, owner)
+}
+
+// instance returns a value of binding b for k, honoring its lifetime.
+// owner is the container that holds b.
+func (c *Container) instance(ctx context.Context, path resolution, k key, b *binding, owner *Container) (reflect.Value, error) {
+	if b.alias != nil {
+		return c.resolveAlias(ctx, path, k, b)
+	}
+	switch b.lifetime {
+	case Singleton:
+		// Singletons belong to the container that holds their binding, and
+		// their dependencies are resolved there, too.
+		return owner.shared(ctx, path, k, b)
+	case Scoped:
+		return c.shared(ctx, path, k, b)
+	}
+	v, err := c.construct(ctx, path, k, b)
+	if err == nil {
+		c.usage.sample(k, true)
+	}
+	return v, err
+}
+
+// An instance is the value of a singleton or scoped binding in one
+// container, and the lock that keeps concurrent first resolutions from
+// constructing it twice.
+type instance struct {
+	mu sync.Mutex
+	v  reflect.Value
+
+	// For ScopeStats and eviction.
+	k             key
+	created, used time.Time
+	uses          int
+	bytes         int64
+}
+
+// shared returns the instance of b in c, constructing it on first use.
+func (c *Container) shared(ctx context.Context, path resolution, k key, b *binding) (reflect.Value, error) {
+	c.mu.RLock()
+	inst, ok := c.instances[b]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if c.instances == nil {
+			c.instances = map[*binding]*instance{}
+		}
+		if inst, ok = c.instances[b]; !ok {
+			inst = &instance{}
+			c.instances[b] = inst
+		}
+		c.mu.Unlock()
+	}
+
+	inst.mu.Lock()
+	if inst.v.IsValid() {
+		inst.used = time.Now()
+		inst.uses++
+		v := inst.v
+		inst.mu.Unlock()
+		atomic.AddInt64(&c.reused, 1)
+		c.usage.sample(k, false)
+		c.tracer.emit(TraceEvent{Depth: len(path), Kind: "reuse", Binding: k.String(), Provider: b.location})
+		return v, nil
+	}
+	v, err := c.construct(ctx, path, k, b)
+	if err != nil {
+		inst.mu.Unlock()
+		return reflect.Value{}, err
+	}
+	inst.v, inst.k = v, k
+	inst.created = time.Now()
+	inst.used, inst.uses = inst.created, 1
+	inst.bytes = sizeOf(v)
+	inst.mu.Unlock()
+	atomic.AddInt64(&c.created, 1)
+	c.mu.RLock()
+	evict := c.eviction != nil
+	c.mu.RUnlock()
+	c.usage.sample(k, true)
+	if evict {
+		c.Evict()
+	}
+	return v, nil
+}
+
+// lookup returns the binding for k and the container that holds it. A
+// scope looks in its own bindings first and then in those of its ancestors.
+func (c *Container) lookup(k key) (*binding, *Container, bool) {
+	for s := c; s != nil; s = s.parent {
+		s.mu.RLock()
+		b, ok := s.bindings[k]
+		s.mu.RUnlock()
+		if ok {
+			return b, s, true
+		}
+	}
+	return nil, nil, false
+}
+
+// construct builds a value for k with the provider of b, and traces the
+// construction if tracing is on.
+func (c *Container) construct(ctx context.Context, path resolution, k key, b *binding) (reflect.Value, error) {
+	if !c.tracer.on() {
+		return c.build(ctx, path, k, b)
+	}
+	start := time.Now()
+	c.tracer.emit(TraceEvent{Depth: len(path), Kind: "begin", Binding: k.String(), Provider: b.location})
+	// If a provider panics, build does not return and the construction
+	// stays open in the trace, which is where the crash happened.
+	v, err := c.build(ctx, path, k, b)
+	e := TraceEvent{Depth: len(path), Kind: "done", Binding: k.String(), Provider: b.location, Duration: time.Since(start)}
+	if err != nil {
+		e.Kind, e.Error = "fail", err.Error()
+	} else {
+		e.Result = dynamicType(v)
+	}
+	c.tracer.emit(e)
+	return v, err
+}
+
+// build resolves the parameters of b's provider and calls it.
+func (c *Container) build(ctx context.Context, path resolution, k key, b *binding) (reflect.Value, error) {
+	err := b.acquire(k)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	// The provider runs without holding the lock, as its parameters are
+	// resolved from the same container.
+	constructed := false
+	defer func() {
+		b.mu.Lock()
+		b.constructing--
+		if b.maxInstances > 0 && !constructed {
+			b.live--
+		}
+		b.mu.Unlock()
+	}()
+
+	depth := len(path)
+	path = append(path[:len(path):len(path)], k)
+	args := make([]reflect.Value, len(b.params))
+	ps := b.paramKeys()
+	for i, p := range ps {
+		if p.typ == contextType {
+			args[i] = reflect.ValueOf(&ctx).Elem()
+			continue
+		}
+		if b.variadic && i == len(ps)-1 && !c.satisfied(p) {
+			args[i] = reflect.Zero(p.typ)
+			continue
+		}
+		arg, err := c.resolve(ctx, path, p)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%v: %w", k, err)
+		}
+		args[i] = arg
+	}
+	if c.tracer.on() {
+		c.tracer.emit(TraceEvent{Depth: depth, Kind: "call", Binding: k.String(), Provider: b.location, Args: dynamicTypes(args)})
+	}
+	if err := ctx.Err(); err != nil {
+		return reflect.Value{}, fmt.Errorf("%v: %w", k, err)
+	}
+	fault := c.strike(k)
+	if fault != nil && fault.Wrap == nil {
+		return applyFault(fault, k, reflect.Value{})
+	}
+	results := call(b.provider, args)
+	if len(results) == 2 && !results[1].IsNil() {
+		return reflect.Value{}, &ProviderError{Type: k.typ, Name: k.name, Provider: b.location, Err: results[1].Interface().(error)}
+	}
+	result := results[0]
+	if fault != nil {
+		if result, err = applyFault(fault, k, result); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	if !b.allowNil && isNil(result) {
+		return reflect.Value{}, &ProviderError{Type: k.typ, Name: k.name, Provider: b.location, Err: ErrNilResult}
+	}
+	if len(b.fields) > 0 {
+		if err := c.injectFields(ctx, path, k, b, result); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	if !forwarded(result, args) {
+		if err := initialize(ctx, k, b, result); err != nil {
+			if release := releaser(result); release != nil {
+				release(ctx)
+			}
+			return reflect.Value{}, err
+		}
+		c.closers.track(result)
+	}
+	if !b.group {
+		if result, err = c.decorate(ctx, path, k, result, b.allowNil); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	if result.Kind() == reflect.Interface && !result.IsNil() {
+		b.mu.Lock()
+		b.concrete = result.Elem().Type()
+		b.mu.Unlock()
+	}
+	constructed = true
+	return result, nil
+}
+
+// call calls fn with args. If fn is variadic, the last argument is the
+// slice of variadic arguments.
+func call(fn reflect.Value, args []reflect.Value) []reflect.Value {
+	if fn.Type().IsVariadic() {
+		return fn.CallSlice(args)
+	}
+	return fn.Call(args)
+}
+
+// MustResolve is like Resolve but panics if the type cannot be resolved.
+// It is meant for wiring code in main, where a missing provider is a
+// programming error.
+func (c *Container) MustResolve(target interface{}, opts ...Option) {
+	if err := c.Resolve(target, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// Release hands an instance obtained from Resolve back to the container and
+// sets *target to the zero value. Release frees a slot in the budget set with
+// MaxInstances; for bindings without that budget, and for singletons and
+// scoped bindings, which stay alive as long as their container or scope, it
+// only clears *target.
+//
+// Pass Named to release an instance of a named binding.
+func (c *Container) Release(target interface{}, opts ...Option) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("di: Release: target must be a non-nil pointer, got %T", target)
+	}
+	t := v.Elem().Type()
+	k := resolveKey(t, opts)
+
+	b, _, ok := c.lookup(k)
+	for ok && b.alias != nil {
+		b, _, ok = c.lookup(*b.alias)
+	}
+	if !ok {
+		return fmt.Errorf("di: release: %v: %w", k, ErrNotRegistered)
+	}
+	if b.lifetime == Transient {
+		b.release()
+	}
+	v.Elem().Set(reflect.Zero(t))
+	return nil
+}
+
+// acquire checks the budgets of b and reserves a construction slot.
+func (b *binding) acquire(k key) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.maxInstances > 0 && b.live >= b.maxInstances {
+		return &LimitError{Type: k.typ, Name: k.name, Limit: "instances", Max: b.maxInstances}
+	}
+	if b.maxConcurrent > 0 && b.constructing >= b.maxConcurrent {
+		return &LimitError{Type: k.typ, Name: k.name, Limit: "concurrent constructions", Max: b.maxConcurrent}
+	}
+	b.constructing++
+	if b.maxInstances > 0 {
+		b.live++
+	}
+	return nil
+}
+
+// release frees the budget slot of an instance of b.
+func (b *binding) release() {
+	b.mu.Lock()
+	if b.maxInstances > 0 && b.live > 0 {
+		b.live--
+	}
+	b.mu.Unlock()
+}
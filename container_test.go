@@ -0,0 +1,249 @@
+package di_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// panics returns the message that fn panics with, or "" if it returns.
+func panics(fn func()) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprint(r)
+		}
+	}()
+	fn()
+	return ""
+}
+
+func TestProviderShapes(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		provider interface{}
+		register bool // Whether Register accepts it.
+		provide  bool // Whether Provide accepts it.
+	}{
+		{"nil", nil, false, false},
+		{"not a func", "a poem", false, false},
+		{"struct value", thing{}, false, false},
+		{"no result", func() {}, false, false},
+		{"three results", func() (int, int, error) { return 0, 0, nil }, false, false},
+		{"second result not an error", func() (int, string) { return 0, "" }, false, false},
+		{"error only", func() error { return nil }, true, true},
+		{"value", func() int { return 0 }, true, true},
+		{"value and error", func() (int, error) { return 0, nil }, true, true},
+		{"parameters", func(string) int { return 0 }, false, true},
+		{"variadic", func(...string) int { return 0 }, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := panics(func() { di.New().Register(tc.provider) })
+			if (msg == "") != tc.register {
+				t.Errorf("Register: panic %q, want accepted: %t", msg, tc.register)
+			}
+			if msg != "" && !strings.HasPrefix(msg, "di: Register:") {
+				t.Errorf("Register: panic %q does not say where", msg)
+			}
+			msg = panics(func() { di.New().Provide(tc.provider) })
+			if (msg == "") != tc.provide {
+				t.Errorf("Provide: panic %q, want accepted: %t", msg, tc.provide)
+			}
+			if msg != "" && !strings.HasPrefix(msg, "di: Provide:") {
+				t.Errorf("Provide: panic %q does not say where", msg)
+			}
+		})
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	c := di.New()
+	c.Register(func() int { return 42 })
+	var n int
+	for _, tc := range []struct {
+		name   string
+		target interface{}
+		ok     bool
+	}{
+		{"nil", nil, false},
+		{"not a pointer", n, false},
+		{"nil pointer", (*int)(nil), false},
+		{"pointer", &n, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := c.Resolve(tc.target)
+			if (err == nil) != tc.ok {
+				t.Errorf("got %v, want success: %t", err, tc.ok)
+			}
+		})
+	}
+	if n != 42 {
+		t.Errorf("resolved %d, want 42", n)
+	}
+}
+
+func TestDuplicateBindings(t *testing.T) {
+	str := func(s string) func() string { return func() string { return s } }
+	for _, tc := range []struct {
+		name    string
+		defs    []di.Definition
+		want    string // The unnamed string after Install, if it succeeds.
+		members int
+		err     bool
+	}{
+		{
+			name: "outside of modules, the last one wins",
+			defs: []di.Definition{di.Provide(str("a")), di.Provide(str("b"))},
+			want: "b",
+		},
+		{
+			name: "two modules conflict",
+			defs: []di.Definition{di.Module("x", di.Provide(str("a"))), di.Module("y", di.Provide(str("b")))},
+			err:  true,
+		},
+		{
+			name: "one module binds twice",
+			defs: []di.Definition{di.Module("x", di.Provide(str("a")), di.Provide(str("b")))},
+			err:  true,
+		},
+		{
+			name: "names keep bindings apart",
+			defs: []di.Definition{di.Module("x", di.Provide(str("a"))), di.Module("y", di.Provide(str("b"), di.Named("b")))},
+			want: "a",
+		},
+		{
+			name:    "group members never conflict",
+			defs:    []di.Definition{di.Module("x", di.Provide(str("a"), di.Group())), di.Module("y", di.Provide(str("b"), di.Group()))},
+			members: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			err := c.Install(tc.defs...)
+			var ce *di.ConflictError
+			if tc.err {
+				if !errors.As(err, &ce) {
+					t.Fatalf("got %v, want a *ConflictError", err)
+				}
+				if _, err := di.Resolve[string](c); !errors.Is(err, di.ErrNotRegistered) {
+					t.Errorf("a conflicting Install installed something: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want != "" {
+				if got := di.MustResolve[string](c); got != tc.want {
+					t.Errorf("got %q, want %q", got, tc.want)
+				}
+			}
+			if tc.members > 0 {
+				if got := di.MustResolve[[]string](c); len(got) != tc.members {
+					t.Errorf("got %d members, want %d", len(got), tc.members)
+				}
+			}
+		})
+	}
+}
+
+func TestConflictAcrossInstalls(t *testing.T) {
+	c := di.New()
+	if err := c.Install(di.Module("storage", di.Provide(func() string { return "a" }))); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Install(di.Module("app", di.Module("cache", di.Provide(func() string { return "b" }))))
+	var ce *di.ConflictError
+	if !errors.As(err, &ce) {
+		t.Fatalf("got %v, want a *ConflictError", err)
+	}
+	if ce.Modules != [2]string{"storage", "app/cache"} {
+		t.Errorf("modules: got %q", ce.Modules)
+	}
+	if got := di.MustResolve[string](c); got != "a" {
+		t.Errorf("got %q, want the first module's binding", got)
+	}
+}
+
+func TestResolveCtxPassesContext(t *testing.T) {
+	c := di.New()
+	var got []interface{}
+	c.Provide(func(ctx context.Context) *thing { got = append(got, ctx.Value(ctxKey{})); return &thing{} })
+	c.Provide(func(ctx context.Context, th *thing) *store { got = append(got, ctx.Value(ctxKey{})); return &store{} })
+	c.Decorate(func(s *store, ctx context.Context) *store { got = append(got, ctx.Value(ctxKey{})); return s })
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "caller")
+	if _, err := di.ResolveCtx[*store](ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != "caller" || got[1] != "caller" || got[2] != "caller" {
+		t.Errorf("got %v, want the caller's context everywhere", got)
+	}
+}
+
+func TestResolveCtxCancellation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		want error
+	}{
+		{
+			name: "canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			want: context.Canceled,
+		},
+		{
+			name: "deadline exceeded",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			},
+			want: context.DeadlineExceeded,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			called := false
+			c.RegisterSingleton(func() *thing { called = true; return &thing{} })
+			ctx, cancel := tc.ctx()
+			defer cancel()
+			if _, err := di.ResolveCtx[*thing](ctx, c); !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+			if called {
+				t.Error("a provider was called with a done context")
+			}
+			// The singleton is constructed by the next resolution.
+			if _, err := di.Resolve[*thing](c); err != nil || !called {
+				t.Errorf("after the cancellation: %v", err)
+			}
+		})
+	}
+}
+
+// A resolution that is canceled halfway calls no further provider.
+func TestResolveCtxCanceledByDependency(t *testing.T) {
+	c := di.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Provide(func() *thing { cancel(); return &thing{} })
+	called := false
+	c.Provide(func(*thing) *store { called = true; return &store{} })
+	if _, err := di.ResolveCtx[*store](ctx, c); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if called {
+		t.Error("the consumer was called after the cancellation")
+	}
+	var s *store
+	if err := c.ResolveCtx(ctx, &s); !errors.Is(err, context.Canceled) {
+		t.Errorf("method: got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,57 @@
+// Package ctxkey provides typed keys for context values.
+//
+// A Key[T] stores and retrieves values of type T without type assertions at
+// the call sites, and every key created with New is distinct from all other
+// keys, even from keys with the same name and type in other packages:
+//
+//	var requestID = ctxkey.New[string]("request ID")
+//
+//	ctx = requestID.WithValue(ctx, "3f2a")
+//	id, ok := requestID.Value(ctx)
+package ctxkey
+
+import (
+	"context"
+	"fmt"
+)
+
+// A Key identifies a context value of type T. Keys are compared by
+// identity, so use the pointer that New returns.
+type Key[T any] struct {
+	name string
+}
+
+// New returns a new key. The name only appears in String and in panic
+// messages.
+func New[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// WithValue returns a copy of ctx in which k is associated with v.
+func (k *Key[T]) WithValue(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, k, v)
+}
+
+// Value returns the value associated with k in ctx, and whether there is
+// one.
+func (k *Key[T]) Value(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k).(T)
+	return v, ok
+}
+
+// MustValue is like Value but panics if ctx has no value for k.
+func (k *Key[T]) MustValue(ctx context.Context) T {
+	v, ok := k.Value(ctx)
+	if !ok {
+		panic(fmt.Sprintf("ctxkey: no %s in context", k))
+	}
+	return v
+}
+
+// String returns the key's name and the type of its values, as in
+// "request ID (string)".
+func (k *Key[T]) String() string {
+	// %T of a *T also works for interface types such as error, and the
+	// leading "*" is dropped again.
+	return fmt.Sprintf("%s (%s)", k.name, fmt.Sprintf("%T", (*T)(nil))[1:])
+}
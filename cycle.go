@@ -0,0 +1,101 @@
+package di
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// ErrCycle is matched by every *CycleError.
+var ErrCycle = errors.New("dependency cycle")
+
+// A CycleError is returned by Resolve when a provider depends, directly or
+// through other providers, on its own result type. Without the check, such a
+// resolution would recurse forever.
+type CycleError struct {
+	// Path lists the bindings of the cycle in resolution order. The first
+	// and the last step are the same binding.
+	Path []CycleStep
+}
+
+// A CycleStep is one binding on the path of a dependency cycle.
+type CycleStep struct {
+	Type     reflect.Type
+	Name     string // The name of the binding, if it is named.
+	Provider string // The source location of the provider, as "file:line", or "group" for a group.
+}
+
+func (e *CycleError) Error() string {
+	steps := make([]string, len(e.Path))
+	for i, s := range e.Path {
+		steps[i] = fmt.Sprintf("%v (%s)", key{typ: s.Type, name: s.Name}, s.Provider)
+	}
+	return fmt.Sprintf("%s: %s", ErrCycle, strings.Join(steps, " -> "))
+}
+
+// Is reports whether target is ErrCycle.
+func (e *CycleError) Is(target error) bool {
+	return target == ErrCycle
+}
+
+// A resolution is the chain of bindings that are being constructed, from the
+// binding the caller asked for down to the one currently resolved.
+type resolution []key
+
+// cycle returns a *CycleError if k is already being resolved, and nil
+// otherwise.
+func (c *Container) cycle(path resolution, k key) error {
+	for i, p := range path {
+		if p != k {
+			continue
+		}
+		e := &CycleError{}
+		steps := append(path[i:len(path):len(path)], k)
+		for j, step := range steps {
+			next := steps[1] // The last step is the first again.
+			if j+1 < len(steps) {
+				next = steps[j+1]
+			}
+			e.Path = append(e.Path, CycleStep{
+				Type:     step.typ,
+				Name:     step.name,
+				Provider: c.location(step, next),
+			})
+		}
+		return e
+	}
+	return nil
+}
+
+// location returns the source location of the provider bound to k. A step
+// of a cycle through a group has no binding of its own: the group itself
+// is "group", and of its members, location returns the one that depends
+// on next, the following step of the cycle.
+func (c *Container) location(k, next key) string {
+	if b, _, ok := c.lookup(k); ok {
+		return b.location
+	}
+	if len(c.members(k)) > 0 {
+		return "group"
+	}
+	for _, m := range c.members(key{typ: reflect.SliceOf(k.typ), name: k.name}) {
+		for _, dep := range c.bindingDependencies(k, m.b, false) {
+			if dep == next {
+				return m.b.location
+			}
+		}
+	}
+	return "unknown"
+}
+
+// funcLocation returns the source location of the function fn as "file:line".
+func funcLocation(fn reflect.Value) string {
+	f := runtime.FuncForPC(fn.Pointer())
+	if f == nil {
+		return "unknown"
+	}
+	file, line := f.FileLine(f.Entry())
+	return fmt.Sprintf("%s:%d", file, line)
+}
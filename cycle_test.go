@@ -0,0 +1,152 @@
+package di_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type (
+	selfish struct{}
+	member  struct{}
+	owner   struct{}
+)
+
+// steps returns the types and names of the cycle in err.
+func steps(t *testing.T, err error) []string {
+	t.Helper()
+	var ce *di.CycleError
+	if !errors.As(err, &ce) {
+		t.Fatalf("got %v, want a *CycleError", err)
+	}
+	if !errors.Is(err, di.ErrCycle) {
+		t.Error("the error does not match ErrCycle")
+	}
+	var ss []string
+	for _, s := range ce.Path {
+		if s.Provider == "" || s.Provider == "unknown" {
+			t.Errorf("step %v has no provider location", s.Type)
+		}
+		if s.Name != "" {
+			ss = append(ss, s.Type.String()+" "+s.Name)
+			continue
+		}
+		ss = append(ss, s.Type.String())
+	}
+	return ss
+}
+
+func TestCycles(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		wire    func(c *di.Container)
+		resolve func(c *di.Container) error
+		want    []string
+	}{
+		{
+			name: "direct",
+			wire: func(c *di.Container) {
+				c.Provide(func(*selfish) *selfish { return &selfish{} })
+			},
+			resolve: func(c *di.Container) error { _, err := di.Resolve[*selfish](c); return err },
+			want:    []string{"*di_test.selfish", "*di_test.selfish"},
+		},
+		{
+			name: "indirect",
+			wire: func(c *di.Container) {
+				c.Provide(func(*cycleB) *cycleA { return &cycleA{} })
+				c.Provide(func(*thing) *cycleB { return &cycleB{} })
+				c.Provide(func(*cycleA) *thing { return &thing{} })
+			},
+			resolve: func(c *di.Container) error { _, err := di.Resolve[*cycleA](c); return err },
+			want:    []string{"*di_test.cycleA", "*di_test.cycleB", "*di_test.thing", "*di_test.cycleA"},
+		},
+		{
+			name: "named",
+			wire: func(c *di.Container) {
+				c.Provide(func(*cycleB) *cycleA { return &cycleA{} }, di.Named("a"), di.ParamNames("b"))
+				c.Provide(func(*cycleA) *cycleB { return &cycleB{} }, di.Named("b"), di.ParamNames("a"))
+				// Unnamed bindings of the same types are not part of it.
+				c.Provide(func() *cycleA { return &cycleA{} })
+			},
+			resolve: func(c *di.Container) error { _, err := di.Resolve[*cycleA](c, di.Named("a")); return err },
+			want:    []string{"*di_test.cycleA a", "*di_test.cycleB b", "*di_test.cycleA a"},
+		},
+		{
+			name: "group",
+			wire: func(c *di.Container) {
+				c.Provide(func([]*member) *owner { return &owner{} })
+				c.Provide(func() *member { return &member{} }, di.Group())
+				c.Provide(func(*owner) *member { return &member{} }, di.Group())
+			},
+			resolve: func(c *di.Container) error { _, err := di.Resolve[*owner](c); return err },
+			want:    []string{"*di_test.owner", "[]*di_test.member", "*di_test.member", "*di_test.owner"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			tc.wire(c)
+			err := tc.resolve(c)
+			if got := steps(t, err); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("path: got %q, want %q", got, tc.want)
+			}
+			if !strings.Contains(err.Error(), " -> ") {
+				t.Errorf("message does not show the path: %v", err)
+			}
+
+			// Build reports the same cycle once, wherever it enters it.
+			var be *di.BuildError
+			if !errors.As(c.Build(), &be) || len(be.Errors) != 1 {
+				t.Fatalf("Build: got %v, want one error", be)
+			}
+			if got := steps(t, be.Errors[0]); len(got) != len(tc.want) {
+				t.Errorf("Build: got path %q, want one as long as %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCycleErrorMessage(t *testing.T) {
+	c := di.New()
+	c.Provide(func(*cycleA) *cycleB { return &cycleB{} }, di.Named("b"))
+	c.Provide(func(b *cycleB) *cycleA { return &cycleA{} }, di.ParamNames("b"))
+	_, err := di.Resolve[*cycleA](c)
+	msg := err.Error()
+	for _, want := range []string{
+		"dependency cycle: *di_test.cycleA (",
+		`/cycle_test.go:`,
+		`) -> *di_test.cycleB (named "b") (`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q does not contain %q", msg, want)
+		}
+	}
+}
+
+func TestGroupCycleNamesTheMember(t *testing.T) {
+	c := di.New()
+	c.Provide(func([]*member) *owner { return &owner{} })
+	c.Provide(func() *member { return &member{} }, di.Group())
+	c.Provide(func(*owner) *member { return &member{} }, di.Group())
+	var want string
+	for _, b := range c.Bindings() {
+		if b.Group && len(b.Params) == 1 {
+			want = b.Provider
+		}
+	}
+
+	_, err := di.Resolve[*owner](c)
+	var ce *di.CycleError
+	if !errors.As(err, &ce) {
+		t.Fatalf("got %v, want a *CycleError", err)
+	}
+	if got := ce.Path[1].Provider; got != "group" {
+		t.Errorf("group step: got provider %q, want %q", got, "group")
+	}
+	if got := ce.Path[2].Provider; got != want {
+		t.Errorf("member step: got provider %q, want the member that needs the owner, %q", got, want)
+	}
+}
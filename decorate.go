@@ -0,0 +1,88 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// A decorator wraps the values of a binding after its provider has built
+// them.
+type decorator struct {
+	fn       reflect.Value
+	params   []reflect.Type // Dependencies after the decorated value.
+	variadic bool           // Whether the last param is variadic.
+	location string
+}
+
+// Decorate layers the decorator fn onto the binding of a type. fn is a
+// function that takes a value of the type and returns a value of the same
+// type, usually a wrapper around the original:
+//
+//	c.Decorate(func(ps PoemStorage) PoemStorage { return NewLoggingStorage(ps) })
+//
+// Consumers of the type receive the decorated value without knowing. Further
+// parameters of the decorator are resolved like those of a constructor, so a
+// decorator can depend on a logger or a metrics registry, or on the members
+// of a group through a variadic parameter.
+//
+// Decorators apply in the order they were added, so the first one wraps the
+// value closest. They belong to the type rather than to the current
+// provider, so they keep applying when the binding is registered anew. For
+// singletons and scoped bindings, the decorated value is the one that is
+// shared. Decorators do not apply to group members. A scope applies its
+// parent's decorators first, then its own.
+//
+// Pass Named to decorate a named binding. Decorate panics if fn is not a
+// function of this form.
+func (c *Container) Decorate(fn interface{}, opts ...Option) {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() == 0 || t.NumOut() != 1 || t.In(0) != t.Out(0) {
+		panic(fmt.Sprintf("di: Decorate: decorator must be a func(T, ...) T, got %T", fn))
+	}
+	d := &decorator{fn: reflect.ValueOf(fn), location: funcLocation(reflect.ValueOf(fn)), variadic: t.IsVariadic()}
+	for i := 1; i < t.NumIn(); i++ {
+		d.params = append(d.params, t.In(i))
+	}
+	k := resolveKey(t.Out(0), opts)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.decorators == nil {
+		c.decorators = map[key][]*decorator{}
+	}
+	c.decorators[k] = append(c.decorators[k], d)
+}
+
+// decorate applies the decorators of k from c's ancestors and c to v.
+// Unless allowNil is set, a decorator must not return nil.
+func (c *Container) decorate(ctx context.Context, path resolution, k key, v reflect.Value, allowNil bool) (reflect.Value, error) {
+	var ds []*decorator
+	for s := c; s != nil; s = s.parent {
+		s.mu.RLock()
+		ds = append(append([]*decorator{}, s.decorators[k]...), ds...)
+		s.mu.RUnlock()
+	}
+	for _, d := range ds {
+		args := []reflect.Value{v}
+		for i, p := range d.params {
+			if p == contextType {
+				args = append(args, reflect.ValueOf(&ctx).Elem())
+				continue
+			}
+			if d.variadic && i == len(d.params)-1 && !c.satisfied(key{typ: p}) {
+				args = append(args, reflect.Zero(p))
+				continue
+			}
+			arg, err := c.resolve(ctx, path, key{typ: p})
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%v: decorator at %s: %w", k, d.location, err)
+			}
+			args = append(args, arg)
+		}
+		v = call(d.fn, args)[0]
+		if !allowNil && isNil(v) {
+			return reflect.Value{}, fmt.Errorf("%v: decorator at %s: %w", k, d.location, ErrNilResult)
+		}
+	}
+	return v, nil
+}
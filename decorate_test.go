@@ -0,0 +1,53 @@
+package di_test
+
+import (
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+func TestDecoratorsApplyInOrder(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "value" })
+	c.Decorate(func(s string) string { return "(" + s + ")" })
+	c.Decorate(func(s string) string { return "[" + s + "]" })
+	if got := di.MustResolve[string](c); got != "[(value)]" {
+		t.Errorf("got %q, want %q", got, "[(value)]")
+	}
+}
+
+func TestDecoratorsOutliveTheProvider(t *testing.T) {
+	c := di.New()
+	c.Decorate(func(s string) string { return "(" + s + ")" })
+	c.Register(func() string { return "first" })
+	c.Register(func() string { return "second" })
+	if got := di.MustResolve[string](c); got != "(second)" {
+		t.Errorf("got %q, want %q", got, "(second)")
+	}
+}
+
+func TestDecoratorDependenciesAndNames(t *testing.T) {
+	c := di.New()
+	c.Register(func() int { return 3 })
+	c.Register(func() string { return "named" }, di.Named("n"))
+	c.Register(func() string { return "unnamed" })
+	c.Decorate(func(s string, n int) string { return s + string(rune('0'+n)) }, di.Named("n"))
+	if got := di.MustResolve[string](c, di.Named("n")); got != "named3" {
+		t.Errorf("named: got %q", got)
+	}
+	if got := di.MustResolve[string](c); got != "unnamed" {
+		t.Errorf("unnamed: got %q, want it undecorated", got)
+	}
+}
+
+func TestDecoratedSingletonIsShared(t *testing.T) {
+	c := di.New()
+	var cnt counter
+	c.RegisterSingleton(cnt.provide)
+	decorations := 0
+	c.Decorate(func(th *thing) *thing { decorations++; return th })
+	a, b := di.MustResolve[*thing](c), di.MustResolve[*thing](c)
+	if a != b || decorations != 1 {
+		t.Errorf("same value: %t, decorated %d times, want once", a == b, decorations)
+	}
+}
@@ -0,0 +1,35 @@
+/*
+Package di is a lightweight dependency injection container.
+
+It grew out of the poem example in cmd/poems, which shows dependency
+injection through plain constructors. Package di takes the wiring part of
+that example and makes it reusable: a Container maps types to provider
+functions and builds values on request.
+
+	c := di.New()
+	c.Register(func() PoemStorage { return NewNotebook() })
+
+	var ps PoemStorage
+	if err := c.Resolve(&ps); err != nil {
+		// No provider for PoemStorage.
+	}
+	poem := NewPoem(ps)
+
+# Concurrency
+
+A Container is safe for concurrent use. The intended order is to register
+all providers at startup, call Build, and then resolve from as many
+goroutines as needed. Resolutions only take read locks on the container,
+so they do not wait for each other, except where a singleton or scoped
+instance is being constructed: the goroutines that need the same instance
+wait for the first one to construct it, and the provider runs only once.
+
+Registering while other goroutines resolve is safe, too. A resolution that
+runs concurrently with Register sees either the old or the new binding,
+but a value whose dependencies are resolved in the meantime may get some
+of them from each. Rewire between units of work, not during them.
+
+The container does not make the values it hands out safe for concurrent
+use. A singleton that many goroutines share must guard its own state.
+*/
+package di
@@ -0,0 +1,70 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrNotRegistered is returned by Resolve if no provider is registered for
+// the requested type.
+var ErrNotRegistered = errors.New("no provider registered")
+
+// ErrLimitExceeded is matched by every *LimitError, so callers can test for
+// any exceeded budget with errors.Is.
+var ErrLimitExceeded = errors.New("resource limit exceeded")
+
+// A LimitError is returned by Resolve when constructing another value would
+// exceed a budget set with MaxInstances or MaxConcurrent.
+type LimitError struct {
+	Type  reflect.Type // The type that was requested.
+	Name  string       // The name of the binding, if it is named.
+	Limit string       // "instances" or "concurrent constructions".
+	Max   int          // The configured limit.
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s: at most %d %s allowed", key{typ: e.Type, name: e.Name}, ErrLimitExceeded, e.Max, e.Limit)
+}
+
+// Is reports whether target is ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// ErrNilResult is returned by Resolve, wrapped in a *ProviderError, when a
+// provider returns nil without the AllowNil option. A decorator that returns
+// nil fails the same way.
+var ErrNilResult = errors.New("returned nil (register with AllowNil if nil is a valid value)")
+
+// A ProviderError is returned by Resolve when a provider of the form
+// func(...) (T, error) returns an error, when a provider returns nil, or
+// when the Init method of an Initializable result fails.
+type ProviderError struct {
+	Type     reflect.Type // The type the provider is bound to.
+	Name     string       // The name of the binding, if it is named.
+	Provider string       // Source location of the provider.
+	Err      error        // The error that the provider returned.
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%v: provider at %s: %v", key{typ: e.Type, name: e.Name}, e.Provider, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// errorType is the reflect.Type of error.
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// contextType is the reflect.Type of context.Context, which providers
+// receive from ResolveCtx instead of from a binding.
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// validResults reports whether the function type t returns a value, or a
+// value and an error.
+func validResults(t reflect.Type) bool {
+	return t.NumOut() == 1 || t.NumOut() == 2 && t.Out(1) == errorType
+}
@@ -0,0 +1,131 @@
+package di
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrInjected is matched by every *FaultError.
+var ErrInjected = errors.New("injected fault")
+
+// A Fault makes a binding misbehave on purpose, so that tests can check how
+// an application copes when a dependency fails to start or breaks later on.
+//
+// The schedule decides which constructions of the binding are affected,
+// counting from the moment the fault is injected: the first After
+// constructions succeed, then every Every-th construction is affected, until
+// Times constructions have been affected. The zero schedule affects every
+// construction.
+//
+// An affected construction either fails with a *FaultError, or, if Wrap is
+// set, succeeds with the value that Wrap returns for the constructed one.
+// Wrap typically returns a decorator whose methods fail, such as a storage
+// whose Save reports errors. Its result must be assignable to the bound
+// type.
+type Fault struct {
+	Err error // The error to fail with; ErrInjected if nil.
+
+	After int // Number of constructions to leave alone.
+	Every int // Affect every n-th construction after that; 0 means every one.
+	Times int // Maximum number of affected constructions; 0 means no limit.
+
+	Wrap func(v interface{}) interface{}
+}
+
+// A FaultError is returned for constructions that fail because of an
+// injected Fault.
+type FaultError struct {
+	Binding string // Type and name of the binding.
+	Err     error
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Binding, e.Err)
+}
+
+func (e *FaultError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInjected.
+func (e *FaultError) Is(target error) bool {
+	return target == ErrInjected
+}
+
+// InjectFault makes constructions of T fail according to f. Pass Named to
+// target a named binding. A new fault for the same binding replaces the
+// previous one. Fault injection is meant for tests; remove all faults with
+// ClearFaults.
+//
+// Existing singletons are not affected, as they are not constructed again.
+// Faults apply to a container and all its scopes.
+func InjectFault[T any](c *Container, f Fault, opts ...Option) {
+	c = c.root()
+	k := resolveKey(typeOf[T](), opts)
+	if f.Err == nil {
+		f.Err = ErrInjected
+	}
+	if f.Every <= 0 {
+		f.Every = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.faults == nil {
+		c.faults = map[key]*faultState{}
+	}
+	c.faults[k] = &faultState{Fault: f}
+}
+
+// ClearFaults removes all faults injected with InjectFault.
+func (c *Container) ClearFaults() {
+	c = c.root()
+	c.mu.Lock()
+	c.faults = nil
+	c.mu.Unlock()
+}
+
+// faultState is an injected fault with its schedule counters.
+type faultState struct {
+	Fault
+	constructions int
+	affected      int
+}
+
+// strike counts a construction of k and returns the fault if it affects
+// this construction, or nil.
+func (c *Container) strike(k key) *Fault {
+	c = c.root()
+	c.mu.RLock()
+	none := len(c.faults) == 0
+	c.mu.RUnlock()
+	if none {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.faults[k]
+	if !ok {
+		return nil
+	}
+	f.constructions++
+	n := f.constructions - f.After
+	if n <= 0 || (n-1)%f.Every != 0 || (f.Times > 0 && f.affected >= f.Times) {
+		return nil
+	}
+	f.affected++
+	fault := f.Fault
+	return &fault
+}
+
+// applyFault fails or wraps the construction of a value v for k.
+func applyFault(f *Fault, k key, v reflect.Value) (reflect.Value, error) {
+	if f.Wrap == nil {
+		return reflect.Value{}, &FaultError{Binding: k.String(), Err: f.Err}
+	}
+	wrapped := reflect.New(k.typ).Elem()
+	if w := f.Wrap(v.Interface()); w != nil {
+		wrapped.Set(reflect.ValueOf(w))
+	}
+	return wrapped, nil
+}
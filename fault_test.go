@@ -0,0 +1,109 @@
+package di_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+// schedule resolves a transient *thing n times with fault f injected, and
+// returns "x" for each failed and "." for each successful resolution.
+func schedule(t *testing.T, f di.Fault, n int) string {
+	t.Helper()
+	c := di.New()
+	c.Register(func() *thing { return &thing{} })
+	di.InjectFault[*thing](c, f)
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		_, err := di.Resolve[*thing](c)
+		switch {
+		case err == nil:
+			b.WriteByte('.')
+		case errors.Is(err, di.ErrInjected):
+			b.WriteByte('x')
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return b.String()
+}
+
+func TestFaultSchedules(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		fault di.Fault
+		want  string
+	}{
+		{"zero", di.Fault{}, "xxxxxxxx"},
+		{"After", di.Fault{After: 3}, "...xxxxx"},
+		{"Every", di.Fault{Every: 3}, "x..x..x."},
+		{"Times", di.Fault{Times: 2}, "xx......"},
+		{"combined", di.Fault{After: 1, Every: 2, Times: 3}, ".x.x.x.."},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := schedule(t, tc.fault, 8); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFaultError(t *testing.T) {
+	c := di.New()
+	c.Register(func() *thing { return &thing{} }, di.Named("n"))
+	c.Provide(func(*thing) *store { return &store{} }, di.ParamNames("n"))
+	di.InjectFault[*thing](c, di.Fault{Err: errBroken}, di.Named("n"))
+
+	_, err := di.Resolve[*store](c)
+	var fe *di.FaultError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got %v, want a *FaultError", err)
+	}
+	if !errors.Is(err, di.ErrInjected) || !errors.Is(err, errBroken) {
+		t.Errorf("%v does not match both ErrInjected and its Err", err)
+	}
+	if fe.Binding != `*di_test.thing (named "n")` {
+		t.Errorf("Binding: got %q", fe.Binding)
+	}
+}
+
+func TestFaultWrap(t *testing.T) {
+	c := di.New()
+	c.Register(func() speaker { return &poetSpeaker{} })
+	di.InjectFault[speaker](c, di.Fault{
+		Times: 1,
+		Wrap: func(v interface{}) interface{} {
+			return speakerProxy{} // Its Speak panics.
+		},
+	})
+	if _, ok := di.MustResolve[speaker](c).(speakerProxy); !ok {
+		t.Error("the first construction was not wrapped")
+	}
+	if _, ok := di.MustResolve[speaker](c).(*poetSpeaker); !ok {
+		t.Error("the second construction was wrapped")
+	}
+}
+
+func TestFaultsAndSingletons(t *testing.T) {
+	c := di.New()
+	c.RegisterSingleton(func() *thing { return &thing{} })
+	built := di.MustResolve[*thing](c)
+	di.InjectFault[*thing](c, di.Fault{})
+	if got, err := di.Resolve[*thing](c); err != nil || got != built {
+		t.Errorf("an existing singleton was affected: %v", err)
+	}
+
+	// Faults apply to scopes, and ClearFaults removes them.
+	c.Provide(func() *small { return &small{} }, di.WithLifetime(di.Scoped))
+	di.InjectFault[*small](c, di.Fault{})
+	s := c.NewScope()
+	if _, err := di.Resolve[*small](s); !errors.Is(err, di.ErrInjected) {
+		t.Errorf("scope: got %v, want %v", err, di.ErrInjected)
+	}
+	c.ClearFaults()
+	if _, err := di.Resolve[*small](s); err != nil {
+		t.Errorf("after ClearFaults: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// InjectFields makes the container fill the tagged fields of the struct
+// that a provider returns a pointer to, after the provider has run:
+//
+//	type Archive struct {
+//		Storage PoemStorage `di:""`
+//		Backup  PoemStorage `di:"napkin"` // The binding named "napkin".
+//	}
+//
+//	c.Provide(func() *Archive { return &Archive{} }, di.InjectFields())
+//
+// The tag value names the binding to inject; an empty value selects the
+// unnamed binding. Fields that the provider has set already are left alone.
+// Constructor parameters remain the better way to declare dependencies;
+// field injection is meant for types whose construction cannot be changed.
+//
+// The provider must return a pointer to a struct. Tagged unexported fields
+// make registration panic unless InjectUnexportedFields is used instead.
+func InjectFields() Option {
+	return func(b *binding) {
+		if b.fieldMode < injectExported {
+			b.fieldMode = injectExported
+		}
+	}
+}
+
+// InjectUnexportedFields is like InjectFields, but also fills tagged
+// unexported fields, for legacy structs whose fields cannot be exported.
+// Writing unexported fields bypasses the type system with package unsafe,
+// so it must be requested per binding. Bindings that use it are marked in
+// the container's Graph and Manifest.
+func InjectUnexportedFields() Option {
+	return func(b *binding) {
+		b.fieldMode = injectUnexported
+	}
+}
+
+// Field injection modes of a binding.
+const (
+	injectNone = iota
+	injectExported
+	injectUnexported
+)
+
+// A field is a struct field that the container injects.
+type field struct {
+	index      int
+	name       string
+	dep        key
+	unexported bool
+}
+
+// tagged returns the fields of the struct that t points to that carry a di
+// tag. It panics if t is not a pointer to a struct, or if a tagged field is
+// unexported and mode does not allow that.
+func tagged(t reflect.Type, mode int) []field {
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("di: field injection needs a provider that returns a pointer to a struct, got %v", t))
+	}
+	var fields []field
+	st := t.Elem()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		name, ok := sf.Tag.Lookup("di")
+		if !ok {
+			continue
+		}
+		if !sf.IsExported() && mode < injectUnexported {
+			panic(fmt.Sprintf("di: field %s of %v is unexported; use InjectUnexportedFields to inject it", sf.Name, st))
+		}
+		fields = append(fields, field{
+			index:      i,
+			name:       sf.Name,
+			dep:        key{typ: sf.Type, name: name},
+			unexported: !sf.IsExported(),
+		})
+	}
+	return fields
+}
+
+// injectFields resolves and sets the fields of b in the struct that v
+// points to.
+func (c *Container) injectFields(ctx context.Context, path resolution, k key, b *binding, v reflect.Value) error {
+	if v.IsNil() {
+		return nil
+	}
+	for _, f := range b.fields {
+		fv := v.Elem().Field(f.index)
+		if !fv.IsZero() {
+			continue
+		}
+		dep, err := c.resolve(ctx, path, f.dep)
+		if err != nil {
+			return fmt.Errorf("%v: field %s: %w", k, f.name, err)
+		}
+		if f.unexported {
+			fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+		}
+		fv.Set(dep)
+	}
+	return nil
+}
+
+// unexportedFields reports whether b injects unexported fields.
+func (b *binding) unexportedFields() bool {
+	for _, f := range b.fields {
+		if f.unexported {
+			return true
+		}
+	}
+	return false
+}
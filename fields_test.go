@@ -0,0 +1,98 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type shelf struct {
+	Storage *thing `di:""`
+	Backup  *thing `di:"backup"`
+	Label   string // Not tagged.
+	Preset  *small `di:""`
+}
+
+type legacyShelf struct {
+	storage *thing `di:""`
+}
+
+func fieldWiring() *di.Container {
+	c := di.New()
+	c.Register(func() *thing { return &thing{id: 1} })
+	c.Register(func() *thing { return &thing{id: 2} }, di.Named("backup"))
+	c.Register(func() *small { return &small{b: [16]byte{1}} })
+	return c
+}
+
+func TestInjectFields(t *testing.T) {
+	c := fieldWiring()
+	preset := &small{}
+	c.Provide(func() *shelf { return &shelf{Label: "kept", Preset: preset} }, di.InjectFields())
+	s, err := di.Resolve[*shelf](c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Storage == nil || s.Storage.id != 1 {
+		t.Errorf("unnamed field: got %+v", s.Storage)
+	}
+	if s.Backup == nil || s.Backup.id != 2 {
+		t.Errorf("named field: got %+v", s.Backup)
+	}
+	if s.Label != "kept" || s.Preset != preset {
+		t.Error("injection overwrote fields that the provider set")
+	}
+}
+
+func TestInjectFieldsWithoutOption(t *testing.T) {
+	c := fieldWiring()
+	c.Provide(func() *shelf { return &shelf{} })
+	if s := di.MustResolve[*shelf](c); s.Storage != nil {
+		t.Error("fields were injected without InjectFields")
+	}
+}
+
+func TestInjectFieldsMissing(t *testing.T) {
+	c := di.New()
+	c.Register(func() *thing { return &thing{} })
+	c.Provide(func() *shelf { return &shelf{} }, di.InjectFields())
+	if _, err := di.Resolve[*shelf](c); !errors.Is(err, di.ErrNotRegistered) {
+		t.Errorf("got %v, want %v", err, di.ErrNotRegistered)
+	}
+}
+
+func TestInjectUnexportedFields(t *testing.T) {
+	if msg := panics(func() {
+		fieldWiring().Provide(func() *legacyShelf { return &legacyShelf{} }, di.InjectFields())
+	}); msg == "" {
+		t.Error("InjectFields accepted an unexported tagged field")
+	}
+
+	c := fieldWiring()
+	c.Provide(func() *legacyShelf { return &legacyShelf{} }, di.InjectUnexportedFields())
+	if s := di.MustResolve[*legacyShelf](c); s.storage == nil || s.storage.id != 1 {
+		t.Errorf("got %+v", s.storage)
+	}
+
+	// The graph marks the binding and shows its field dependency.
+	g := c.Graph()
+	for _, n := range g.Nodes {
+		if n.ID == "*di_test.legacyShelf" && !n.UnexportedFields {
+			t.Error("the graph does not mark the binding as unsafe")
+		}
+	}
+	for _, e := range g.Edges {
+		if e.From == "*di_test.legacyShelf" && (e.To != "*di_test.thing" || e.Kind != "field") {
+			t.Errorf("got edge %+v, want a field edge to *di_test.thing", e)
+		}
+	}
+}
+
+func TestInjectFieldsNeedsAStructPointer(t *testing.T) {
+	if msg := panics(func() {
+		di.New().Provide(func() thing { return thing{} }, di.InjectFields())
+	}); msg == "" {
+		t.Error("InjectFields accepted a struct value")
+	}
+}
@@ -0,0 +1,66 @@
+package fsys
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dir is an FS backed by the operating system's file system, rooted at the
+// directory Dir names.
+type Dir string
+
+// Open opens the named file for reading.
+func (d Dir) Open(name string) (fs.File, error) {
+	return os.DirFS(string(d)).Open(name)
+}
+
+// WriteFile writes data to the named file.
+func (d Dir) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := checkPath("writefile", name); err != nil {
+		return err
+	}
+	return os.WriteFile(d.path(name), data, perm)
+}
+
+// Create creates the named file for writing. Readers see the contents as
+// they are written.
+func (d Dir) Create(name string) (io.WriteCloser, error) {
+	if err := checkPath("create", name); err != nil {
+		return nil, err
+	}
+	return os.Create(d.path(name))
+}
+
+// Rename renames oldname to newname. On most systems, this is atomic.
+func (d Dir) Rename(oldname, newname string) error {
+	if err := checkPath("rename", oldname); err != nil {
+		return err
+	}
+	if err := checkPath("rename", newname); err != nil {
+		return err
+	}
+	return os.Rename(d.path(oldname), d.path(newname))
+}
+
+// Remove removes the named file or empty directory.
+func (d Dir) Remove(name string) error {
+	if err := checkPath("remove", name); err != nil {
+		return err
+	}
+	return os.Remove(d.path(name))
+}
+
+// MkdirAll creates the named directory and any missing parents.
+func (d Dir) MkdirAll(name string, perm fs.FileMode) error {
+	if err := checkPath("mkdir", name); err != nil {
+		return err
+	}
+	return os.MkdirAll(d.path(name), perm)
+}
+
+// path turns a slash-separated name into an operating system path below d.
+func (d Dir) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
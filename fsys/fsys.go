@@ -0,0 +1,59 @@
+/*
+Package fsys defines a writable file system abstraction for components that
+store data in files.
+
+The read side is the standard library's fs.FS, so everything that works with
+an fs.FS works with an FS, too. The write side adds the few operations a file
+based component needs. Components depend on FS and get an implementation
+injected: Dir for real directories, Mem for tests that should neither touch
+the disk nor wait for it.
+
+	c.Register(func() fsys.FS { return fsys.Dir("/var/lib/poems") })
+
+	// In tests:
+	c.Register(func() fsys.FS { return fsys.NewMem() })
+*/
+package fsys
+
+import (
+	"io"
+	"io/fs"
+)
+
+// FS is a file system that can be read as an fs.FS and written to. Names are
+// slash-separated paths as described in fs.ValidPath.
+type FS interface {
+	fs.FS
+
+	// WriteFile writes data to the named file, creating it if necessary
+	// and truncating it otherwise. The parent directory must exist.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+
+	// Rename moves oldname to newname, replacing newname if it exists.
+	Rename(oldname, newname string) error
+
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+
+	// MkdirAll creates the named directory along with any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+}
+
+// CreateFS is an FS that can also write a file as a stream, for contents that
+// are too large to hold in memory at once.
+type CreateFS interface {
+	FS
+
+	// Create creates the named file for writing, truncating it if it
+	// exists. The parent directory must exist. The contents are complete
+	// when Close returns without error.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// checkPath returns an *fs.PathError for names that are not valid fs.FS paths.
+func checkPath(op, name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
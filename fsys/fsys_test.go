@@ -0,0 +1,182 @@
+package fsys_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/appliedgo/di/fsys"
+)
+
+// systems creates a fresh file system of each kind.
+var systems = []struct {
+	name string
+	new  func(t *testing.T) fsys.CreateFS
+}{
+	{"Dir", func(t *testing.T) fsys.CreateFS { return fsys.Dir(t.TempDir()) }},
+	{"Mem", func(*testing.T) fsys.CreateFS { return fsys.NewMem() }},
+}
+
+// read returns the contents of the named file, or the error.
+func read(f fs.FS, name string) string {
+	data, err := fs.ReadFile(f, name)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return string(data)
+}
+
+func TestWriteAndRead(t *testing.T) {
+	for _, sys := range systems {
+		t.Run(sys.name, func(t *testing.T) {
+			f := sys.new(t)
+			if err := f.MkdirAll("poems/old", 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.MkdirAll("poems", 0o755); err != nil {
+				t.Errorf("MkdirAll of an existing directory: %v", err)
+			}
+			if err := f.WriteFile("poems/ode", []byte("Oh"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.WriteFile("poems/ode", []byte("Ah"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if got := read(f, "poems/ode"); got != "Ah" {
+				t.Errorf("after writing again: got %q", got)
+			}
+
+			w, err := f.Create("poems/old/elegy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, "Alas, ")
+			io.WriteString(w, "poor Yorick")
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := read(f, "poems/old/elegy"); got != "Alas, poor Yorick" {
+				t.Errorf("created: got %q", got)
+			}
+
+			if err := fstest.TestFS(f, "poems/ode", "poems/old/elegy"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRenameAndRemove(t *testing.T) {
+	for _, sys := range systems {
+		t.Run(sys.name, func(t *testing.T) {
+			f := sys.new(t)
+			f.MkdirAll("poems", 0o755)
+			f.WriteFile("poems/ode.tmp", []byte("new"), 0o644)
+			f.WriteFile("poems/ode", []byte("old"), 0o644)
+			if err := f.Rename("poems/ode.tmp", "poems/ode"); err != nil {
+				t.Fatal(err)
+			}
+			if got := read(f, "poems/ode"); got != "new" {
+				t.Errorf("Rename did not replace the file: got %q", got)
+			}
+			if _, err := fs.Stat(f, "poems/ode.tmp"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("the old name: got %v, want %v", err, fs.ErrNotExist)
+			}
+			if err := f.Rename("poems/missing", "poems/other"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Rename of a missing file: got %v, want %v", err, fs.ErrNotExist)
+			}
+
+			if err := f.Remove("poems"); err == nil {
+				t.Error("Remove removed a directory that is not empty")
+			}
+			if err := f.Remove("poems/ode"); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Remove("poems/ode"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Remove of a missing file: got %v, want %v", err, fs.ErrNotExist)
+			}
+			if err := f.Remove("poems"); err != nil {
+				t.Errorf("Remove of an empty directory: %v", err)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, sys := range systems {
+		t.Run(sys.name, func(t *testing.T) {
+			f := sys.new(t)
+			if err := f.WriteFile("missing/ode", nil, 0o644); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("WriteFile without the parent: got %v, want %v", err, fs.ErrNotExist)
+			}
+			if _, err := f.Create("missing/ode"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Create without the parent: got %v, want %v", err, fs.ErrNotExist)
+			}
+			f.WriteFile("ode", nil, 0o644)
+			if err := f.MkdirAll("ode", 0o755); err == nil {
+				t.Error("MkdirAll over a file succeeded")
+			}
+
+			for _, op := range []struct {
+				name string
+				call func(name string) error
+			}{
+				{"WriteFile", func(name string) error { return f.WriteFile(name, nil, 0o644) }},
+				{"Create", func(name string) error { _, err := f.Create(name); return err }},
+				{"Rename from", func(name string) error { return f.Rename(name, "ode") }},
+				{"Rename to", func(name string) error { return f.Rename("ode", name) }},
+				{"Remove", func(name string) error { return f.Remove(name) }},
+				{"MkdirAll", func(name string) error { return f.MkdirAll(name, 0o755) }},
+			} {
+				for _, name := range []string{"../ode", "/ode", "poems/", "a/../ode", ""} {
+					var pe *fs.PathError
+					if err := op.call(name); !errors.As(err, &pe) || !errors.Is(err, fs.ErrInvalid) {
+						t.Errorf("%s(%q): got %v, want an *fs.PathError for %v", op.name, name, err, fs.ErrInvalid)
+					}
+				}
+			}
+			if got := read(f, "ode"); got != "" {
+				t.Errorf("an invalid name changed the file: %q", got)
+			}
+		})
+	}
+}
+
+func TestMem(t *testing.T) {
+	m := fsys.NewMem()
+	m.WriteFile("ode", []byte("Oh"), 0o644)
+	f, err := m.Open("ode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.WriteFile("ode", []byte("Ah"), 0o644)
+	if data, _ := io.ReadAll(f); string(data) != "Oh" {
+		t.Errorf("an open file got the new contents: %q", data)
+	}
+
+	// Created files are empty until they are closed.
+	w, _ := m.Create("elegy")
+	io.WriteString(w, "Alas")
+	if got := read(m, "elegy"); got != "" {
+		t.Errorf("before Close: got %q", got)
+	}
+	w.Close()
+	if _, err := io.WriteString(w, "more"); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("Write after Close: got %v, want %v", err, fs.ErrClosed)
+	}
+	if err := w.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("second Close: got %v, want %v", err, fs.ErrClosed)
+	}
+
+	// A directory is implied by the files in it, and cannot be renamed.
+	m.MkdirAll("poems", 0o755)
+	m.WriteFile("poems/sonnet", nil, 0o644)
+	if err := m.WriteFile("poems", nil, 0o644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("WriteFile over a directory: got %v, want %v", err, fs.ErrExist)
+	}
+	if err := m.Rename("poems", "verses"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Rename of a directory: got %v, want %v", err, fs.ErrNotExist)
+	}
+}
@@ -0,0 +1,165 @@
+package fsys
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// Mem is an in-memory FS. It is safe for concurrent use. The zero value is
+// not usable; create a Mem with NewMem.
+type Mem struct {
+	mu    sync.RWMutex
+	files fstest.MapFS
+}
+
+// NewMem returns an empty in-memory file system.
+func NewMem() *Mem {
+	return &Mem{
+		files: fstest.MapFS{},
+	}
+}
+
+// Open opens the named file for reading. The returned file keeps reading the
+// contents it was opened with, even if the file is written to afterwards.
+func (m *Mem) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Open(name)
+}
+
+// WriteFile stores a copy of data under name.
+func (m *Mem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := checkPath("writefile", name); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if dir := path.Dir(name); dir != "." && !m.isDir(dir) {
+		return &fs.PathError{Op: "writefile", Path: name, Err: fs.ErrNotExist}
+	}
+	if f, ok := m.files[name]; ok && f.Mode.IsDir() {
+		return &fs.PathError{Op: "writefile", Path: name, Err: fs.ErrExist}
+	}
+	m.files[name] = &fstest.MapFile{
+		Data:    append([]byte{}, data...),
+		Mode:    perm &^ fs.ModeType,
+		ModTime: time.Now(),
+	}
+	return nil
+}
+
+// Create creates the named file for writing. The file is empty until Close,
+// which writes all contents at once.
+func (m *Mem) Create(name string) (io.WriteCloser, error) {
+	if err := m.WriteFile(name, nil, 0o644); err != nil {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: errors.Unwrap(err)}
+	}
+	return &memWriter{m: m, name: name}, nil
+}
+
+// A memWriter collects the contents of a file until it is closed.
+type memWriter struct {
+	m      *Mem
+	name   string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: fs.ErrClosed}
+	}
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.name, Err: fs.ErrClosed}
+	}
+	w.closed = true
+	return w.m.WriteFile(w.name, w.buf.Bytes(), 0o644)
+}
+
+// Rename renames the file oldname to newname. Directories cannot be renamed.
+func (m *Mem) Rename(oldname, newname string) error {
+	if err := checkPath("rename", oldname); err != nil {
+		return err
+	}
+	if err := checkPath("rename", newname); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[oldname]
+	if !ok || f.Mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	m.files[newname] = f
+	delete(m.files, oldname)
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (m *Mem) Remove(name string) error {
+	if err := checkPath("remove", name); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok && !m.isDir(name) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	prefix := name + "/"
+	for other := range m.files {
+		if strings.HasPrefix(other, prefix) {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+		}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// MkdirAll creates the named directory. Parent directories exist implicitly.
+func (m *Mem) MkdirAll(name string, perm fs.FileMode) error {
+	if err := checkPath("mkdir", name); err != nil {
+		return err
+	}
+	if name == "." {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[name]; ok {
+		if f.Mode.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	m.files[name] = &fstest.MapFile{
+		Mode:    fs.ModeDir | perm&fs.ModePerm,
+		ModTime: time.Now(),
+	}
+	return nil
+}
+
+// isDir reports whether name is an explicit directory or the parent of any
+// file. The caller must hold m.mu.
+func (m *Mem) isDir(name string) bool {
+	if f, ok := m.files[name]; ok {
+		return f.Mode.IsDir()
+	}
+	prefix := name + "/"
+	for other := range m.files {
+		if strings.HasPrefix(other, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package di
+
+import "context"
+
+// Register is the type-safe form of Container.Register. The compiler checks
+// that provider returns a T, so a typo in the provider's result type cannot
+// register it for the wrong type.
+func Register[T any](c *Container, provider func() T, opts ...Option) {
+	c.Register(provider, opts...)
+}
+
+// Resolve is the type-safe form of Container.Resolve. It returns the resolved
+// value instead of filling a pointer, so callers need neither a target
+// variable nor a type assertion:
+//
+//	ps, err := di.Resolve[PoemStorage](c)
+//	archive, err := di.Resolve[PoemStorage](c, di.Named("archive"))
+func Resolve[T any](c *Container, opts ...Option) (T, error) {
+	var v T
+	err := c.Resolve(&v, opts...)
+	return v, err
+}
+
+// ResolveCtx is the type-safe form of Container.ResolveCtx.
+func ResolveCtx[T any](ctx context.Context, c *Container, opts ...Option) (T, error) {
+	var v T
+	err := c.ResolveCtx(ctx, &v, opts...)
+	return v, err
+}
+
+// MustResolve is like Resolve but panics if T cannot be resolved.
+func MustResolve[T any](c *Container, opts ...Option) T {
+	var v T
+	c.MustResolve(&v, opts...)
+	return v
+}
@@ -1,3 +1,5 @@
 module github.com/appliedgo/di
 
-go 1.13
+go 1.18
+
+require github.com/mattn/go-sqlite3 v1.14.17
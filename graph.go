@@ -0,0 +1,232 @@
+package di
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A DependencyGraph is a snapshot of the bindings of a container and the
+// dependencies between them.
+type DependencyGraph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// A GraphNode is a binding, a group member, or a dependency that has no
+// binding.
+type GraphNode struct {
+	ID       string // Unique within the graph: type and name of the binding.
+	Type     reflect.Type
+	Name     string
+	Lifetime Lifetime
+	Module   string
+	Provider string // Source location of the provider.
+	Missing  bool   // No provider is registered; some binding depends on it.
+	Member   int    // Position of a group member in its group, from 1; 0 otherwise.
+
+	// UnexportedFields is set for bindings that inject unexported fields
+	// through package unsafe. See InjectUnexportedFields.
+	UnexportedFields bool
+}
+
+// keys returns the keys of the unnamed bindings of types.
+func keys(types []reflect.Type) []key {
+	ks := make([]key, len(types))
+	for i, t := range types {
+		ks[i] = key{typ: t}
+	}
+	return ks
+}
+
+// A GraphEdge points from a consumer to one of its dependencies.
+type GraphEdge struct {
+	From, To string // Node IDs.
+
+	// Kind is empty for plain dependencies, and "optional", "lazy",
+	// "factory" or "hot" for dependencies injected through Optional, Lazy,
+	// Factory or Hot.
+	// Edges from a consumer of a group to its members are of kind "group",
+	// dependencies of a binding's decorators are of kind "decorator", and
+	// dependencies injected into struct fields are of kind "field", and
+	// aliases created with As point to their binding with kind "alias".
+	Kind string
+}
+
+// memberID returns the node ID of member i of the group of k.
+func memberID(k key, i int) string {
+	return fmt.Sprintf("%v (group member %d)", k, i+1)
+}
+
+// Graph returns the dependency graph of the container's current bindings.
+// The graph is built from provider signatures; no provider is called.
+func (c *Container) Graph() *DependencyGraph {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	g := &DependencyGraph{}
+	consumers := map[string]*binding{}
+	node := func(id string, k key, b *binding, member int) {
+		consumers[id] = b
+		g.Nodes = append(g.Nodes, GraphNode{
+			ID:       id,
+			Type:     k.typ,
+			Name:     k.name,
+			Lifetime: b.lifetime,
+			Module:   b.module,
+			Provider: b.location,
+			Member:   member,
+
+			UnexportedFields: b.unexportedFields(),
+		})
+	}
+	for k, b := range c.bindings {
+		node(k.String(), k, b, 0)
+	}
+	for k, bs := range c.groups {
+		for i, b := range bs {
+			node(memberID(k, i), k, b, i+1)
+		}
+	}
+
+	missing := map[key]bool{}
+	depend := func(id string, deps []key, kind string) {
+		for _, dep := range deps {
+			if dep.typ == contextType {
+				continue // Supplied by ResolveCtx.
+			}
+			kind := kind
+			if dep.typ.Implements(wrapperType) {
+				dep.typ, kind = reflect.Zero(dep.typ).Interface().(wrapper).wrapped()
+			}
+			if _, ok := c.bindings[dep]; !ok && dep.typ.Kind() == reflect.Slice {
+				gk := key{typ: dep.typ.Elem(), name: dep.name}
+				if bs := c.groups[gk]; len(bs) > 0 {
+					if kind == "" {
+						kind = "group"
+					}
+					for i := range bs {
+						g.Edges = append(g.Edges, GraphEdge{From: id, To: memberID(gk, i), Kind: kind})
+					}
+					continue
+				}
+			}
+			if _, ok := c.bindings[dep]; !ok && !missing[dep] {
+				missing[dep] = true
+				g.Nodes = append(g.Nodes, GraphNode{ID: dep.String(), Type: dep.typ, Missing: true})
+			}
+			g.Edges = append(g.Edges, GraphEdge{From: id, To: dep.String(), Kind: kind})
+		}
+	}
+	// A variadic parameter without group members receives no arguments,
+	// so it is no dependency.
+	params := func(ps []key, variadic bool) []key {
+		if !variadic {
+			return ps
+		}
+		last := ps[len(ps)-1]
+		if _, ok := c.bindings[last]; !ok && len(c.groups[key{typ: last.typ.Elem(), name: last.name}]) == 0 {
+			return ps[:len(ps)-1]
+		}
+		return ps
+	}
+	for id, b := range consumers {
+		if b.alias != nil {
+			depend(id, []key{*b.alias}, "alias")
+		}
+		depend(id, params(b.paramKeys(), b.variadic), "")
+		var fields []key
+		for _, f := range b.fields {
+			fields = append(fields, f.dep)
+		}
+		depend(id, fields, "field")
+	}
+	for k, ds := range c.decorators {
+		if _, ok := c.bindings[k]; !ok {
+			continue
+		}
+		for _, d := range ds {
+			depend(k.String(), params(keys(d.params), d.variadic), "decorator")
+		}
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// WriteDOT writes the graph in the DOT language of Graphviz. Each module
+// becomes a cluster; missing dependencies are drawn dashed and red, and
+// optional, lazy and factory dependencies get dashed or dotted edges.
+//
+//	c.Graph().WriteDOT(os.Stdout) // | dot -Tsvg > graph.svg
+func (g *DependencyGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph di {\n\tnode [shape=box, fontname=\"Helvetica\"];\n")
+
+	byModule := map[string][]GraphNode{}
+	for _, n := range g.Nodes {
+		byModule[n.Module] = append(byModule[n.Module], n)
+	}
+	modules := make([]string, 0, len(byModule))
+	for m := range byModule {
+		modules = append(modules, m)
+	}
+	sort.Strings(modules)
+
+	for i, m := range modules {
+		indent := "\t"
+		if m != "" {
+			fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n\t\tlabel=%q;\n", i, m)
+			indent = "\t\t"
+		}
+		for _, n := range byModule[m] {
+			b.WriteString(indent + dotNode(n) + "\n")
+		}
+		if m != "" {
+			b.WriteString("\t}\n")
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := ""
+		switch e.Kind {
+		case "optional":
+			attrs = ` [style=dashed, label="optional"]`
+		case "lazy", "factory", "hot":
+			attrs = fmt.Sprintf(` [style=dotted, label=%q]`, e.Kind)
+		case "group", "decorator", "field", "alias":
+			attrs = fmt.Sprintf(` [label=%q]`, e.Kind)
+		}
+		fmt.Fprintf(&b, "\t%q -> %q%s;\n", e.From, e.To, attrs)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotNode writes the node statement for n.
+func dotNode(n GraphNode) string {
+	label := n.Type.String()
+	if n.Name != "" {
+		label += fmt.Sprintf("\n%q", n.Name)
+	}
+	if n.Missing {
+		return fmt.Sprintf("%q [label=%q, style=dashed, color=red];", n.ID, label+"\n(missing)")
+	}
+	if n.Member > 0 {
+		label += fmt.Sprintf("\ngroup member %d", n.Member)
+	}
+	label += "\n" + n.Lifetime.String()
+	if n.UnexportedFields {
+		label += "\nunsafe: unexported fields"
+		return fmt.Sprintf("%q [label=%q, tooltip=%q, color=orange];", n.ID, label, n.Provider)
+	}
+	return fmt.Sprintf("%q [label=%q, tooltip=%q];", n.ID, label, n.Provider)
+}
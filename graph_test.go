@@ -0,0 +1,114 @@
+package di_test
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+// graphWiring has a dependency of each kind, a module, a missing
+// dependency, and named and unnamed groups.
+func graphWiring() *di.Container {
+	c := di.New()
+	c.Install(di.Module("storage", di.Provide(func(di.Lazy[*small], *cycleA) *thing { return &thing{} }, di.WithLifetime(di.Singleton))))
+	c.Provide(func(di.Optional[*large], []string, ...*small) *store { return &store{} })
+	c.Register(func() string { return "a" }, di.Group())
+	c.Register(func() string { return "b" }, di.Group())
+	c.Register(func() string { return "n" }, di.Group(), di.Named("n"))
+	c.Register(func() *small { return &small{} })
+	c.Decorate(func(s *store, th *thing) *store { return s })
+	return c
+}
+
+func TestGraph(t *testing.T) {
+	g := graphWiring().Graph()
+
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+" -> "+e.To+" "+e.Kind)
+	}
+	want := []string{
+		"*di_test.store -> *di_test.large optional",
+		"*di_test.store -> *di_test.thing decorator",
+		"*di_test.store -> string (group member 1) group",
+		"*di_test.store -> string (group member 2) group",
+		"*di_test.thing -> *di_test.cycleA ",
+		"*di_test.thing -> *di_test.small lazy",
+	}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges:\ngot  %q\nwant %q", edges, want)
+	}
+
+	nodes := map[string]di.GraphNode{}
+	var ids []string
+	for _, n := range g.Nodes {
+		nodes[n.ID] = n
+		ids = append(ids, n.ID)
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("nodes are not sorted: %q", ids)
+	}
+	for _, tc := range []struct {
+		id   string
+		want func(n di.GraphNode) bool
+	}{
+		{"*di_test.cycleA", func(n di.GraphNode) bool { return n.Missing }},
+		{"*di_test.large", func(n di.GraphNode) bool { return n.Missing }},
+		{"*di_test.thing", func(n di.GraphNode) bool {
+			return n.Module == "storage" && n.Lifetime == di.Singleton && strings.Contains(n.Provider, "graph_test.go:")
+		}},
+		{"string (group member 2)", func(n di.GraphNode) bool { return n.Member == 2 && n.Name == "" }},
+		{`string (named "n") (group member 1)`, func(n di.GraphNode) bool { return n.Member == 1 && n.Name == "n" }},
+	} {
+		n, ok := nodes[tc.id]
+		if !ok {
+			t.Errorf("no node %s", tc.id)
+			continue
+		}
+		if !tc.want(n) {
+			t.Errorf("node %s: got %+v", tc.id, n)
+		}
+	}
+}
+
+// Without group members, a variadic parameter is no dependency.
+func TestGraphVariadicWithoutMembers(t *testing.T) {
+	c := di.New()
+	c.Provide(func(...*small) *store { return &store{} })
+	if g := c.Graph(); len(g.Edges) != 0 {
+		t.Errorf("got edges %+v", g.Edges)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var b strings.Builder
+	if err := graphWiring().Graph().WriteDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	dot := b.String()
+	if !strings.HasPrefix(dot, "digraph di {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("not a digraph:\n%s", dot)
+	}
+	for _, want := range []string{
+		`"*di_test.cycleA" [label="*di_test.cycleA\n(missing)", style=dashed, color=red];`,
+		"\tsubgraph cluster_1 {\n\t\tlabel=\"storage\";\n\t\t\"*di_test.thing\" [label=\"*di_test.thing\\nsingleton\", tooltip=",
+		`"*di_test.store" -> "*di_test.large" [style=dashed, label="optional"];`,
+		`"*di_test.thing" -> "*di_test.small" [style=dotted, label="lazy"];`,
+		`"*di_test.store" -> "*di_test.thing" [label="decorator"];`,
+		`"*di_test.thing" -> "*di_test.cycleA";`,
+		`[label="string\n\"n\"\ngroup member 1\ntransient"`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT does not contain %s:\n%s", want, dot)
+		}
+	}
+
+	var again strings.Builder
+	graphWiring().Graph().WriteDOT(&again)
+	if again.String() != dot {
+		t.Error("two graphs of the same wiring differ")
+	}
+}
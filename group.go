@@ -0,0 +1,87 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Group adds a binding to the group of its result type instead of making it
+// the binding of that type. A consumer that depends on a slice of the type
+// receives one value from every member, in registration order:
+//
+//	c.RegisterSingleton(func() PoemStorage { return NewNotebook() }, di.Group())
+//	c.RegisterSingleton(func() PoemStorage { return NewNapkin() }, di.Group())
+//	c.Provide(NewFanOut) // func NewFanOut(all []PoemStorage) *FanOut
+//
+// A variadic parameter, as in func NewFanOut(all ...PoemStorage), receives
+// the members the same way, or no arguments if the group has none.
+//
+// Each member keeps its own lifetime. Combined with Named, the binding joins
+// the group of that name, which Resolve returns for a slice with the same
+// Named option; constructor parameters receive the unnamed group unless
+// ParamNames names another.
+//
+// A binding registered for the slice type itself takes precedence over the
+// group. Resolving a group without members fails with ErrNotRegistered. A
+// scope's group consists of its parent's members followed by its own.
+func Group() Option {
+	return func(b *binding) {
+		b.group = true
+	}
+}
+
+// inGroup reports whether opts contain Group.
+func inGroup(opts []Option) bool {
+	var b binding
+	for _, opt := range opts {
+		opt(&b)
+	}
+	return b.group
+}
+
+// A member is a group member and the container that holds it.
+type member struct {
+	b     *binding
+	owner *Container
+}
+
+// members returns the members of the group that the slice key k stands
+// for, from c's ancestors and c.
+func (c *Container) members(k key) []member {
+	if k.typ.Kind() != reflect.Slice {
+		return nil
+	}
+	gk := key{typ: k.typ.Elem(), name: k.name}
+	var ms []member
+	for s := c; s != nil; s = s.parent {
+		s.mu.RLock()
+		own := make([]member, len(s.groups[gk]))
+		for i, b := range s.groups[gk] {
+			own[i] = member{b: b, owner: s}
+		}
+		s.mu.RUnlock()
+		ms = append(own, ms...)
+	}
+	return ms
+}
+
+// resolveGroup builds the slice for k from the members of its group. It
+// reports false if the group has no members.
+func (c *Container) resolveGroup(ctx context.Context, path resolution, k key) (reflect.Value, bool, error) {
+	ms := c.members(k)
+	if len(ms) == 0 {
+		return reflect.Value{}, false, nil
+	}
+	path = append(path[:len(path):len(path)], k)
+	mk := key{typ: k.typ.Elem(), name: k.name}
+	slice := reflect.MakeSlice(k.typ, len(ms), len(ms))
+	for i, m := range ms {
+		v, err := c.instance(ctx, path, mk, m.b, m.owner)
+		if err != nil {
+			return reflect.Value{}, true, fmt.Errorf("%v: member %d: %w", k, i+1, err)
+		}
+		slice.Index(i).Set(v)
+	}
+	return slice, true, nil
+}
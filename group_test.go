@@ -0,0 +1,118 @@
+package di_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+func TestGroupInRegistrationOrder(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "a" }, di.Group())
+	c.Register(func() string { return "b" }, di.Group())
+	c.Provide(func(all []string) int { return len(all) })
+	c.Provide(func(all ...string) []byte { return []byte(all[0] + all[1]) })
+
+	if got := di.MustResolve[[]string](c); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("group: got %q", got)
+	}
+	if got := di.MustResolve[int](c); got != 2 {
+		t.Errorf("slice parameter: got %d members", got)
+	}
+	if got := di.MustResolve[[]byte](c); string(got) != "ab" {
+		t.Errorf("variadic parameter: got %q", got)
+	}
+}
+
+func TestNamedGroups(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "unnamed" }, di.Group())
+	c.Register(func() string { return "named" }, di.Group(), di.Named("g"))
+	if got := di.MustResolve[[]string](c, di.Named("g")); !reflect.DeepEqual(got, []string{"named"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestScopeGroupFollowsParent(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "parent" }, di.Group())
+	s := c.NewScope()
+	s.Register(func() string { return "scope" }, di.Group())
+	if got := di.MustResolve[[]string](s); !reflect.DeepEqual(got, []string{"parent", "scope"}) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestEmptyGroupIsNotRegistered(t *testing.T) {
+	if _, err := di.Resolve[[]string](di.New()); !errors.Is(err, di.ErrNotRegistered) {
+		t.Errorf("got %v, want ErrNotRegistered", err)
+	}
+}
+
+func TestVariadicParameters(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		members []string
+		slice   bool // Whether to bind the slice type itself.
+		want    []string
+	}{
+		{name: "empty group", want: nil},
+		{name: "one member", members: []string{"a"}, want: []string{"a"}},
+		{name: "members", members: []string{"a", "b", "c"}, want: []string{"a", "b", "c"}},
+		{name: "slice binding", members: []string{"a"}, slice: true, want: []string{"x", "y"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			for _, m := range tc.members {
+				m := m
+				c.Register(func() string { return m }, di.Group())
+			}
+			if tc.slice {
+				c.Register(func() []string { return []string{"x", "y"} })
+			}
+			var got []string
+			called := false
+			c.Provide(func(_ int, all ...string) *store {
+				got, called = all, true
+				return &store{}
+			})
+			c.Register(func() int { return 1 })
+			if _, err := di.Resolve[*store](c); err != nil {
+				t.Fatal(err)
+			}
+			if !called {
+				t.Fatal("the constructor was not called")
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVariadicNamedGroup(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "unnamed" }, di.Group())
+	c.Register(func() string { return "named" }, di.Group(), di.Named("g"))
+	c.Provide(func(all ...string) int { return len(all) })
+	c.Provide(func(all ...string) []byte { return []byte(all[0]) }, di.ParamNames("g"))
+	if got := di.MustResolve[int](c); got != 1 {
+		t.Errorf("unnamed: got %d members, want 1", got)
+	}
+	if got := di.MustResolve[[]byte](c); string(got) != "named" {
+		t.Errorf("named: got %q", got)
+	}
+}
+
+// A variadic member that fails is reported, not dropped.
+func TestVariadicMemberFails(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "a" }, di.Group())
+	c.Register(func() (string, error) { return "", errBroken }, di.Group())
+	c.Provide(func(all ...string) int { return len(all) })
+	if _, err := di.Resolve[int](c); !errors.Is(err, errBroken) {
+		t.Errorf("got %v, want %v", err, errBroken)
+	}
+}
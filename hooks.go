@@ -0,0 +1,140 @@
+package di
+
+import (
+	"context"
+	"sync"
+)
+
+// A Hook is a pair of functions that a provider registers to be called when
+// the container starts and stops. Either function may be nil.
+type Hook struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Lifecycle is available to every provider as a dependency. Providers that
+// own resources, such as open files or database connections, append hooks
+// to it:
+//
+//	func NewFileStorage(lc di.Lifecycle, dir string) *FileStorage {
+//		fs := &FileStorage{dir: dir}
+//		lc.Append(di.Hook{
+//			OnStart: fs.open,
+//			OnStop:  fs.close,
+//		})
+//		return fs
+//	}
+//
+// A provider's dependencies are constructed before the provider runs, so
+// hooks are appended in dependency order. Providers of transient bindings
+// append their hooks on every resolution.
+type Lifecycle interface {
+	Append(Hook)
+}
+
+// hooks keeps the hooks appended through a container's Lifecycle. mu
+// guards the slices; run is held while Start or Stop calls hooks, so that
+// they do not interleave, and hooks can append further hooks.
+type hooks struct {
+	mu      sync.Mutex
+	run     sync.Mutex
+	hooks   []Hook
+	started []bool
+}
+
+func (h *hooks) Append(hook Hook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hook)
+	h.started = append(h.started, false)
+}
+
+// Start runs the OnStart functions of all hooks that have not been started
+// yet, in the order they were appended. If one fails, Start stops the hooks
+// it has started so far, in reverse order, and returns the error.
+//
+// Hooks are appended while providers run, so Start should be called after
+// the application's root objects have been resolved. Calling Start again
+// later starts only hooks that were appended in the meantime. Hooks that
+// an OnStart function appends are started in the same call, after it.
+// Hooks must not call Start or Stop.
+func (c *Container) Start(ctx context.Context) error {
+	h := &c.hooks
+	h.run.Lock()
+	defer h.run.Unlock()
+	var started []int
+	for i := 0; ; i++ {
+		hook, ok := h.pending(i)
+		if !ok {
+			return nil
+		}
+		if h.isStarted(i) {
+			continue
+		}
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				for j := len(started) - 1; j >= 0; j-- {
+					h.stop(ctx, started[j])
+				}
+				return err
+			}
+		}
+		h.mu.Lock()
+		h.started[i] = true
+		h.mu.Unlock()
+		started = append(started, i)
+	}
+}
+
+// Stop runs the OnStop functions of all started hooks in reverse order, so
+// that every component stops before the components it depends on. Stop
+// calls all of them even if some fail, and returns the first error.
+func (c *Container) Stop(ctx context.Context) error {
+	h := &c.hooks
+	h.run.Lock()
+	defer h.run.Unlock()
+	h.mu.Lock()
+	n := len(h.hooks)
+	h.mu.Unlock()
+	var first error
+	for i := n - 1; i >= 0; i-- {
+		if err := h.stop(ctx, i); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// pending returns hook i, if there is one.
+func (h *hooks) pending(i int) (Hook, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i >= len(h.hooks) {
+		return Hook{}, false
+	}
+	return h.hooks[i], true
+}
+
+// isStarted reports whether hook i has been started.
+func (h *hooks) isStarted(i int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.started[i]
+}
+
+// stop runs the OnStop function of hook i if it has been started. The caller
+// must hold h.run, but not h.mu.
+func (h *hooks) stop(ctx context.Context, i int) error {
+	h.mu.Lock()
+	if !h.started[i] {
+		h.mu.Unlock()
+		return nil
+	}
+	h.started[i] = false
+	hook := h.hooks[i]
+	h.mu.Unlock()
+	if hook.OnStop == nil {
+		return nil
+	}
+	return hook.OnStop(ctx)
+}
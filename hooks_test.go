@@ -0,0 +1,89 @@
+package di_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+// A component appends a hook that records starts and stops.
+func component(lc di.Lifecycle, name string, log *[]string) {
+	lc.Append(di.Hook{
+		OnStart: func(context.Context) error { *log = append(*log, "start "+name); return nil },
+		OnStop:  func(context.Context) error { *log = append(*log, "stop "+name); return nil },
+	})
+}
+
+func TestHooksRunInDependencyOrder(t *testing.T) {
+	var log []string
+	c := di.New()
+	c.Provide(func(lc di.Lifecycle) *db { component(lc, "db", &log); return &db{} })
+	c.Provide(func(lc di.Lifecycle, _ *db) *store { component(lc, "store", &log); return &store{} })
+	di.MustResolve[*store](c)
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start db", "start store", "stop store", "stop db"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("got %q, want %q", log, want)
+	}
+}
+
+func TestFailedStartStopsStartedHooks(t *testing.T) {
+	var log []string
+	c := di.New()
+	lc := di.MustResolve[di.Lifecycle](c)
+	component(lc, "first", &log)
+	boom := errors.New("boom")
+	lc.Append(di.Hook{OnStart: func(context.Context) error { return boom }})
+	if err := c.Start(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("got %v, want %v", err, boom)
+	}
+	if want := []string{"start first", "stop first"}; !reflect.DeepEqual(log, want) {
+		t.Errorf("got %q, want %q", log, want)
+	}
+}
+
+func TestHooksAppendHooks(t *testing.T) {
+	var log []string
+	c := di.New()
+	lc := di.MustResolve[di.Lifecycle](c)
+	lc.Append(di.Hook{
+		OnStart: func(context.Context) error {
+			component(lc, "appended on start", &log)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			lc.Append(di.Hook{})
+			return nil
+		},
+	})
+	done := make(chan error, 1)
+	go func() {
+		ctx := context.Background()
+		if err := c.Start(ctx); err != nil {
+			done <- err
+			return
+		}
+		done <- c.Stop(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a hook that appends a hook deadlocked")
+	}
+	if want := []string{"start appended on start", "stop appended on start"}; !reflect.DeepEqual(log, want) {
+		t.Errorf("got %q, want %q", log, want)
+	}
+}
@@ -0,0 +1,170 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Hot is a dependency that can be replaced while the program runs. A
+// constructor that takes a Hot[T] keeps the handle rather than the value,
+// and calls Get whenever it uses the dependency:
+//
+//	type Archive struct {
+//		storage di.Hot[PoemStorage]
+//	}
+//
+//	func (a *Archive) Save(name string, poem []byte) {
+//		a.storage.MustGet().Save(name, poem)
+//	}
+//
+// Get resolves T on first use, and returns the same value until Replace
+// swaps the binding; from then on, every handle for the binding returns
+// the new value. Named applies to T when resolving a Hot.
+type Hot[T any] struct {
+	cell *hotCell
+}
+
+// A hotCell holds the current value of a binding for all of its Hot
+// handles.
+type hotCell struct {
+	mu      sync.RWMutex
+	set     bool
+	value   reflect.Value
+	resolve func() (reflect.Value, error)
+}
+
+// Get returns the current value of the dependency.
+func (h Hot[T]) Get() (T, error) {
+	var v T
+	if h.cell == nil {
+		return v, errNotInjected
+	}
+	rv, err := h.cell.get()
+	if err != nil {
+		return v, err
+	}
+	reflect.ValueOf(&v).Elem().Set(rv)
+	return v, nil
+}
+
+// MustGet is like Get but panics if the dependency cannot be resolved.
+func (h Hot[T]) MustGet() T {
+	v, err := h.Get()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (h *hotCell) get() (reflect.Value, error) {
+	h.mu.RLock()
+	v, set := h.value, h.set
+	h.mu.RUnlock()
+	if set {
+		return v, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.set {
+		v, err := h.resolve()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		h.value, h.set = v, true
+	}
+	return h.value, nil
+}
+
+func (h *hotCell) store(v reflect.Value) {
+	h.mu.Lock()
+	h.value, h.set = v, true
+	h.mu.Unlock()
+}
+
+func (Hot[T]) resolveWrapper(c *Container, _ context.Context, _ resolution, name string) (reflect.Value, error) {
+	k := key{typ: typeOf[T](), name: name}
+	return reflect.ValueOf(Hot[T]{cell: c.hotCell(k)}), nil
+}
+
+func (Hot[T]) wrapped() (reflect.Type, string) {
+	return typeOf[T](), "hot"
+}
+
+// hotCell returns the cell of k, which lives in the container that holds
+// the binding of k, so that Replace on that container reaches the handles
+// of all of its scopes.
+func (c *Container) hotCell(k key) *hotCell {
+	owner := c
+	if _, o, ok := c.lookup(k); ok {
+		owner = o
+	}
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	if cell, ok := owner.hot[k]; ok {
+		return cell
+	}
+	if owner.hot == nil {
+		owner.hot = map[key]*hotCell{}
+	}
+	cell := &hotCell{resolve: func() (reflect.Value, error) {
+		v, err := owner.resolve(context.Background(), nil, k)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("di: resolve: %w", err)
+		}
+		return v, nil
+	}}
+	owner.hot[k] = cell
+	return cell
+}
+
+// Replace swaps the binding of the provider's result type while the
+// program runs. It accepts the same providers and options as Provide, and
+// binds the provider as a singleton. Replace constructs the new value
+// before it hands it off: if construction fails, the previous binding
+// stays in place and Replace returns the error.
+//
+// Once Replace returns, Hot handles for the binding return the new value,
+// and so does Resolve. Values that were resolved before, and calls that
+// are in progress on the previous value, keep the previous value, so it
+// must remain usable until they are done; the container releases it only
+// when it is disposed. Group members cannot be replaced.
+func (c *Container) Replace(provider interface{}, opts ...Option) error {
+	t := reflect.TypeOf(provider)
+	if t == nil || t.Kind() != reflect.Func || !validResults(t) {
+		panic(fmt.Sprintf("di: Replace: provider must return a value or a value and an error, got %T", provider))
+	}
+	if inGroup(opts) {
+		panic("di: Replace: group members cannot be replaced")
+	}
+	k := resolveKey(t.Out(0), opts)
+	c.mu.RLock()
+	prev, had := c.bindings[k]
+	c.mu.RUnlock()
+
+	c.bind(reflect.ValueOf(provider), append(opts, WithLifetime(Singleton)))
+	v, err := c.resolve(context.Background(), nil, k)
+	if err != nil {
+		c.mu.Lock()
+		if had {
+			c.bindings[k] = prev
+		} else {
+			delete(c.bindings, k)
+		}
+		c.mu.Unlock()
+		return fmt.Errorf("di: replace: %w", err)
+	}
+	c.mu.RLock()
+	cell := c.hot[k]
+	c.mu.RUnlock()
+	if cell != nil {
+		cell.store(v)
+	}
+	return nil
+}
+
+// ReplaceValue is like Replace, but binds value itself.
+func ReplaceValue[T any](c *Container, value T, opts ...Option) error {
+	return c.Replace(func() T { return value }, opts...)
+}
@@ -0,0 +1,53 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+func TestReplaceSwapsHotHandles(t *testing.T) {
+	c := di.New()
+	c.RegisterSingleton(func() string { return "old" })
+	h := di.MustResolve[di.Hot[string]](c)
+	if got := h.MustGet(); got != "old" {
+		t.Fatalf("got %q", got)
+	}
+	if err := di.ReplaceValue(c, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.MustGet(); got != "new" {
+		t.Errorf("handle: got %q, want %q", got, "new")
+	}
+	if got := di.MustResolve[string](c); got != "new" {
+		t.Errorf("resolve: got %q, want %q", got, "new")
+	}
+}
+
+func TestReplaceRollsBackOnError(t *testing.T) {
+	c := di.New()
+	c.RegisterSingleton(func() string { return "old" })
+	h := di.MustResolve[di.Hot[string]](c)
+	h.MustGet()
+	boom := errors.New("boom")
+	if err := c.Replace(func() (string, error) { return "", boom }); !errors.Is(err, boom) {
+		t.Fatalf("got %v, want %v", err, boom)
+	}
+	if got := di.MustResolve[string](c); got != "old" {
+		t.Errorf("resolve after a failed replace: got %q, want %q", got, "old")
+	}
+	if got := h.MustGet(); got != "old" {
+		t.Errorf("handle after a failed replace: got %q, want %q", got, "old")
+	}
+}
+
+func TestReplaceRollsBackToNoBinding(t *testing.T) {
+	c := di.New()
+	if err := c.Replace(func() (string, error) { return "", errors.New("boom") }); err == nil {
+		t.Fatal("replace succeeded")
+	}
+	if _, err := di.Resolve[string](c); !errors.Is(err, di.ErrNotRegistered) {
+		t.Errorf("got %v, want ErrNotRegistered", err)
+	}
+}
@@ -0,0 +1,70 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Initializable is implemented by values that need work after construction
+// that their constructor cannot do, because it depends on injected fields,
+// or should not do, because it can fail, such as opening a file or
+// verifying a schema:
+//
+//	func (s *FileStorage) Init(ctx context.Context) error {
+//		return s.verify(ctx)
+//	}
+//
+// The container calls Init once for every value it constructs, after the
+// provider returned and the fields were injected, and before decorators
+// wrap the value. Init receives the context of the resolution. If Init
+// fails, the resolution fails with a *ProviderError that wraps the error,
+// and the value is not stored, so a singleton is tried again on the next
+// resolution; Build reports the error like that of a failing provider.
+//
+// A provider that returns one of its arguments, as in
+// func(n *Notebook) PoemStorage { return n }, hands on a value that was
+// initialized when it was constructed, so Init is not called again.
+// Otherwise, Init runs on every construction, even if the provider returns
+// the same value every time.
+type Initializable interface {
+	Init(ctx context.Context) error
+}
+
+// initialize calls Init on v, the value of the binding b of k, if v is
+// Initializable.
+func initialize(ctx context.Context, k key, b *binding, v reflect.Value) error {
+	if isNil(v) {
+		return nil
+	}
+	in, ok := v.Interface().(Initializable)
+	if !ok {
+		return nil
+	}
+	if err := in.Init(ctx); err != nil {
+		return &ProviderError{Type: k.typ, Name: k.name, Provider: b.location, Err: fmt.Errorf("init: %w", err)}
+	}
+	return nil
+}
+
+// forwarded reports whether the pointer v is one of args.
+func forwarded(v reflect.Value, args []reflect.Value) bool {
+	v = concrete(v)
+	if v.Kind() != reflect.Ptr {
+		return false
+	}
+	for _, arg := range args {
+		if arg = concrete(arg); arg.Type() == v.Type() && arg.Pointer() == v.Pointer() {
+			return true
+		}
+	}
+	return false
+}
+
+// concrete returns the value in the interface v, or v.
+func concrete(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		return v.Elem()
+	}
+	return v
+}
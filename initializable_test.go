@@ -0,0 +1,146 @@
+package di_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type ctxKey struct{}
+
+// A journal records what happens to the values that log to it.
+type journal struct {
+	events []string
+}
+
+func (j *journal) add(e string) { j.events = append(j.events, e) }
+
+type dependency struct {
+	j *journal
+}
+
+func (d *dependency) Init(context.Context) error {
+	d.j.add("init dependency")
+	return nil
+}
+
+// A service has a constructor dependency and an injected field, and
+// fails Init with the error in err.
+type service struct {
+	j   *journal
+	Dep *dependency `di:""`
+	err error
+	ctx interface{}
+}
+
+func (s *service) Init(ctx context.Context) error {
+	if s.Dep == nil {
+		s.j.add("init before fields")
+	}
+	s.ctx = ctx.Value(ctxKey{})
+	s.j.add("init service")
+	return s.err
+}
+
+func initWiring(j *journal, err error, lifetime di.Lifetime) *di.Container {
+	c := di.New()
+	c.RegisterSingleton(func() *journal { return j })
+	c.Provide(func(j *journal) *dependency { j.add("provide dependency"); return &dependency{j: j} })
+	c.Provide(func(j *journal) *service {
+		j.add("provide service")
+		return &service{j: j, err: err}
+	}, di.InjectFields(), di.WithLifetime(lifetime))
+	c.Decorate(func(s *service) *service { s.j.add("decorate service"); return s })
+	return c
+}
+
+func TestInitOrder(t *testing.T) {
+	j := &journal{}
+	c := initWiring(j, nil, di.Transient)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "resolution")
+	s, err := di.ResolveCtx[*service](ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"provide service",
+		"provide dependency",
+		"init dependency",
+		"init service",
+		"decorate service",
+	}
+	if !reflect.DeepEqual(j.events, want) {
+		t.Errorf("got %q, want %q", j.events, want)
+	}
+	if s.ctx != "resolution" {
+		t.Errorf("Init got context value %v, want the resolution's", s.ctx)
+	}
+}
+
+func TestInitError(t *testing.T) {
+	errInit := errors.New("schema mismatch")
+	c := initWiring(&journal{}, errInit, di.Singleton)
+
+	_, err := di.Resolve[*service](c)
+	var pe *di.ProviderError
+	if !errors.Is(err, errInit) || !errors.As(err, &pe) {
+		t.Fatalf("Resolve: got %v, want a *ProviderError wrapping %v", err, errInit)
+	}
+	if pe.Type != reflect.TypeOf(&service{}) {
+		t.Errorf("ProviderError.Type: got %v", pe.Type)
+	}
+	if err := c.Build(); !errors.Is(err, errInit) {
+		t.Errorf("Build: got %v, want %v", err, errInit)
+	}
+	if st := c.Stats(); st.Cached > 1 {
+		t.Errorf("the failed singleton was stored: %+v", st)
+	}
+}
+
+// A singleton whose Init failed is tried again.
+func TestInitRetried(t *testing.T) {
+	c := di.New()
+	fail := true
+	var inits int
+	c.RegisterSingleton(func() *retrying { return &retrying{fail: &fail, inits: &inits} })
+	if _, err := di.Resolve[*retrying](c); err == nil {
+		t.Fatal("Init did not fail")
+	}
+	fail = false
+	if _, err := di.Resolve[*retrying](c); err != nil {
+		t.Fatal(err)
+	}
+	di.MustResolve[*retrying](c)
+	if inits != 2 {
+		t.Errorf("Init ran %d times, want 2", inits)
+	}
+}
+
+type retrying struct {
+	fail  *bool
+	inits *int
+}
+
+func (r *retrying) Init(context.Context) error {
+	*r.inits++
+	if *r.fail {
+		return errBroken
+	}
+	return nil
+}
+
+// A provider that hands on its argument does not initialize it again.
+func TestInitForwarded(t *testing.T) {
+	j := &journal{}
+	c := di.New()
+	c.RegisterSingleton(func() *journal { return j })
+	c.Provide(func(j *journal) *dependency { return &dependency{j: j} })
+	c.Provide(func(d *dependency) di.Initializable { return d })
+	di.MustResolve[di.Initializable](c)
+	if len(j.events) != 1 {
+		t.Errorf("got %q, want one Init", j.events)
+	}
+}
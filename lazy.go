@@ -0,0 +1,113 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Lazy defers the resolution of a dependency until it is first used. A
+// constructor that takes a Lazy[T] does not wait for T to be built, which
+// keeps expensive backends such as database pools or cloud storage clients
+// out of the wiring phase:
+//
+//	func NewArchive(ps di.Lazy[PoemStorage]) *Archive {
+//		return &Archive{storage: ps}
+//	}
+//
+//	func (a *Archive) Save(name string, poem []byte) error {
+//		ps, err := a.storage.Get()
+//		if err != nil {
+//			return err
+//		}
+//		ps.Save(name, poem)
+//		return nil
+//	}
+//
+// The first successful Get resolves T and keeps the result; a failed Get is
+// retried on the next call. Named applies to T when resolving a Lazy.
+type Lazy[T any] struct {
+	state *lazyState[T]
+}
+
+type lazyState[T any] struct {
+	mu      sync.Mutex
+	resolve func() (T, error)
+	done    bool
+	value   T
+}
+
+// Get returns the dependency, resolving it on the first call.
+func (l Lazy[T]) Get() (T, error) {
+	if l.state == nil {
+		var zero T
+		return zero, errNotInjected
+	}
+	l.state.mu.Lock()
+	defer l.state.mu.Unlock()
+	if l.state.done {
+		return l.state.value, nil
+	}
+	v, err := l.state.resolve()
+	if err != nil {
+		return v, err
+	}
+	l.state.value, l.state.done = v, true
+	return v, nil
+}
+
+// MustGet is like Get but panics if the dependency cannot be resolved.
+func (l Lazy[T]) MustGet() T {
+	v, err := l.Get()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (Lazy[T]) resolveWrapper(c *Container, _ context.Context, _ resolution, name string) (reflect.Value, error) {
+	l := Lazy[T]{state: &lazyState[T]{
+		resolve: factory[T](c, name),
+	}}
+	return reflect.ValueOf(l), nil
+}
+
+func (Lazy[T]) wrapped() (reflect.Type, string) {
+	return typeOf[T](), "lazy"
+}
+
+// Factory resolves a fresh dependency on every call. Where Lazy builds its
+// dependency once, a constructor that takes a Factory[T] can ask for new
+// instances of a transient binding whenever it needs one:
+//
+//	func NewPoet(napkins di.Factory[*Napkin]) *Poet
+//
+// For singleton bindings, every call returns the same singleton. Named
+// applies to T when resolving a Factory.
+type Factory[T any] func() (T, error)
+
+func (Factory[T]) resolveWrapper(c *Container, _ context.Context, _ resolution, name string) (reflect.Value, error) {
+	return reflect.ValueOf(Factory[T](factory[T](c, name))), nil
+}
+
+func (Factory[T]) wrapped() (reflect.Type, string) {
+	return typeOf[T](), "factory"
+}
+
+// factory returns a function that resolves T from c.
+//
+// The resolution starts with an empty path: it happens after the
+// constructor that received the Lazy or Factory has returned, so it cannot
+// be part of a cycle through that constructor.
+func factory[T any](c *Container, name string) func() (T, error) {
+	return func() (T, error) {
+		var v T
+		rv, err := c.resolve(context.Background(), nil, key{typ: typeOf[T](), name: name})
+		if err != nil {
+			return v, fmt.Errorf("di: resolve: %w", err)
+		}
+		reflect.ValueOf(&v).Elem().Set(rv)
+		return v, nil
+	}
+}
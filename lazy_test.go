@@ -0,0 +1,116 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type archive struct {
+	th di.Lazy[*thing]
+}
+
+type poet struct {
+	things di.Factory[*thing]
+}
+
+func TestLazyResolvesOnFirstGet(t *testing.T) {
+	c := di.New()
+	var cnt counter
+	c.Register(cnt.provide)
+	c.Provide(func(th di.Lazy[*thing]) *archive { return &archive{th} })
+
+	a := di.MustResolve[*archive](c)
+	if cnt.n != 0 {
+		t.Fatalf("the provider ran %d times before Get", cnt.n)
+	}
+	first := a.th.MustGet()
+	if second := a.th.MustGet(); second != first {
+		t.Error("a second Get resolved the transient binding again")
+	}
+	if cnt.n != 1 {
+		t.Errorf("the provider ran %d times, want once", cnt.n)
+	}
+}
+
+func TestLazyRetriesAfterFailure(t *testing.T) {
+	c := di.New()
+	fail := true
+	c.Register(func() (*thing, error) {
+		if fail {
+			return nil, errBroken
+		}
+		return &thing{id: 1}, nil
+	})
+	c.Provide(func(th di.Lazy[*thing]) *archive { return &archive{th} })
+	a := di.MustResolve[*archive](c)
+
+	if _, err := a.th.Get(); !errors.Is(err, errBroken) {
+		t.Fatalf("got %v, want %v", err, errBroken)
+	}
+	fail = false
+	if th, err := a.th.Get(); err != nil || th.id != 1 {
+		t.Errorf("after the failure: got %v, %v", th, err)
+	}
+}
+
+func TestLazyDoesNotNeedItsDependencyToResolve(t *testing.T) {
+	c := di.New()
+	c.Provide(func(th di.Lazy[*thing]) *archive { return &archive{th} })
+	a, err := di.Resolve[*archive](c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.th.Get(); !errors.Is(err, di.ErrNotRegistered) {
+		t.Errorf("got %v, want %v", err, di.ErrNotRegistered)
+	}
+	var zero di.Lazy[*thing]
+	if _, err := zero.Get(); err == nil {
+		t.Error("the zero Lazy resolved something")
+	}
+}
+
+func TestFactory(t *testing.T) {
+	for _, tc := range []struct {
+		lifetime di.Lifetime
+		same     bool
+	}{
+		{di.Transient, false},
+		{di.Singleton, true},
+	} {
+		t.Run(tc.lifetime.String(), func(t *testing.T) {
+			c := di.New()
+			var cnt counter
+			c.Register(cnt.provide, di.WithLifetime(tc.lifetime))
+			c.Provide(func(f di.Factory[*thing]) *poet { return &poet{f} })
+
+			p := di.MustResolve[*poet](c)
+			a, err := p.things()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := p.things()
+			if (a == b) != tc.same {
+				t.Errorf("two calls returned the same value: %t, want %t", a == b, tc.same)
+			}
+			want := 2
+			if tc.same {
+				want = 1
+			}
+			if cnt.n != want {
+				t.Errorf("the provider ran %d times, want %d", cnt.n, want)
+			}
+		})
+	}
+}
+
+func TestFactoryNamed(t *testing.T) {
+	c := di.New()
+	c.Register(func() *thing { return &thing{id: 1} })
+	c.Register(func() *thing { return &thing{id: 2} }, di.Named("two"))
+	c.Provide(func(f di.Factory[*thing]) *poet { return &poet{f} }, di.ParamNames("two"))
+	if th, err := di.MustResolve[*poet](c).things(); err != nil || th.id != 2 {
+		t.Errorf("got %v, %v, want the named *thing", th, err)
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Package lifecycle keeps track of the goroutines that components start in the
+background.
+
+Instead of a bare go statement, a component starts its goroutines through
+Component.Go. The goroutine receives a context that is canceled when the
+component stops, and the Lifecycle knows how many goroutines of each component
+are still running. Shutdown stops all components and reports every component
+whose goroutines do not exit within the grace period.
+
+Panics in tracked goroutines are recovered and reported to Lifecycle.OnError.
+Component.Supervise additionally restarts failed goroutines according to a
+RestartPolicy, which turns a Lifecycle into a small supervisor for background
+work.
+
+	lc := lifecycle.New()
+	worker := lc.Component("mirror")
+	worker.Go(func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	if err := lc.Shutdown(5 * time.Second); err != nil {
+		log.Println(err) // Goroutines leaked.
+	}
+*/
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Lifecycle owns the components of an application.
+type Lifecycle struct {
+	mu         sync.Mutex
+	components []*Component
+
+	// OnError, if set, receives the failures of all goroutines started
+	// through the components of this Lifecycle: errors returned from
+	// supervised goroutines, and panics as *PanicError. It may be called
+	// from several goroutines at once. Set it before any goroutine starts.
+	// Without OnError, failures are silently dropped.
+	OnError func(component string, err error)
+}
+
+// New returns a Lifecycle without components.
+func New() *Lifecycle {
+	return &Lifecycle{}
+}
+
+// Component creates a new component with the given name. The name only
+// serves to identify the component in a LeakError.
+func (l *Lifecycle) Component(name string) *Component {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Component{
+		lc:     l,
+		name:   name,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	l.mu.Lock()
+	l.components = append(l.components, c)
+	l.mu.Unlock()
+	return c
+}
+
+// Shutdown stops all components and waits up to grace for their goroutines
+// to exit. If some goroutines are still running after that, Shutdown returns
+// a *LeakError that lists them by component.
+func (l *Lifecycle) Shutdown(grace time.Duration) error {
+	l.mu.Lock()
+	components := append([]*Component{}, l.components...)
+	l.mu.Unlock()
+
+	for _, c := range components {
+		c.Stop()
+	}
+
+	// Polling keeps Shutdown itself free of helper goroutines that could
+	// outlive it when a component hangs.
+	deadline := time.Now().Add(grace)
+	for {
+		err := leaks(components)
+		if err == nil || !time.Now().Before(deadline) {
+			return err
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// pollInterval is how often Shutdown checks for exited goroutines.
+const pollInterval = 10 * time.Millisecond
+
+// A Component groups the goroutines of one part of the application, such as
+// a storage backend or a background worker.
+type Component struct {
+	lc      *Lifecycle
+	name    string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running int64 // accessed atomically
+}
+
+// Name returns the name of the component.
+func (c *Component) Name() string {
+	return c.name
+}
+
+// Go runs fn in a new goroutine that is tracked by the component. The context
+// passed to fn is canceled when the component stops; fn should return soon
+// after that.
+//
+// A panic in fn is recovered and reported as a *PanicError to the OnError
+// handler of the Lifecycle, so one failing component cannot take down the
+// whole program. Use Supervise to restart failed goroutines.
+//
+// Calling Go on a stopped component still runs fn, with an already canceled
+// context.
+func (c *Component) Go(fn func(ctx context.Context)) {
+	atomic.AddInt64(&c.running, 1)
+	go func() {
+		defer atomic.AddInt64(&c.running, -1)
+		err := protect(c.ctx, func(ctx context.Context) error {
+			fn(ctx)
+			return nil
+		})
+		if err != nil {
+			c.report(err)
+		}
+	}()
+}
+
+// report passes err to the OnError handler of the Lifecycle.
+func (c *Component) report(err error) {
+	if c.lc.OnError != nil {
+		c.lc.OnError(c.name, err)
+	}
+}
+
+// Stop cancels the context of all goroutines of the component. It does not
+// wait for them to exit.
+func (c *Component) Stop() {
+	c.cancel()
+}
+
+// Running returns the number of goroutines of the component that have not
+// exited yet.
+func (c *Component) Running() int {
+	return int(atomic.LoadInt64(&c.running))
+}
+
+// A LeakError reports the goroutines that did not exit within the grace
+// period of Shutdown.
+type LeakError struct {
+	Running map[string]int // Goroutines still running, by component name.
+}
+
+func (e *LeakError) Error() string {
+	names := make([]string, 0, len(e.Running))
+	for name := range e.Running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s (%d)", name, e.Running[name])
+	}
+	return "lifecycle: goroutines did not exit in time: " + strings.Join(names, ", ")
+}
+
+// leaks returns a *LeakError for all components with running goroutines, or
+// nil if there are none.
+func leaks(components []*Component) error {
+	e := &LeakError{Running: map[string]int{}}
+	for _, c := range components {
+		if n := c.Running(); n > 0 {
+			e.Running[c.name] += n
+		}
+	}
+	if len(e.Running) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,122 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di/lifecycle"
+)
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for end := time.Now().Add(time.Second); time.Now().Before(end); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting until %s", what)
+}
+
+func TestGoCancelsOnStop(t *testing.T) {
+	lc := lifecycle.New()
+	worker, other := lc.Component("worker"), lc.Component("other")
+	stopped := make(chan struct{})
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		worker.Go(func(ctx context.Context) {
+			<-ctx.Done()
+			stopped <- struct{}{}
+		})
+	}
+	other.Go(func(ctx context.Context) { <-release })
+	waitFor(t, "the goroutines run", func() bool { return worker.Running() == 3 })
+
+	worker.Stop()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("Stop did not cancel the goroutines of the component")
+		}
+	}
+	waitFor(t, "the goroutines exit", func() bool { return worker.Running() == 0 })
+	if other.Running() != 1 {
+		t.Errorf("stopping one component stopped another: %d running", other.Running())
+	}
+	close(release)
+	waitFor(t, "the other goroutine exits", func() bool { return other.Running() == 0 })
+}
+
+func TestGoAfterStop(t *testing.T) {
+	lc := lifecycle.New()
+	c := lc.Component("late")
+	c.Stop()
+	ran := make(chan error, 1)
+	c.Go(func(ctx context.Context) { ran <- ctx.Err() })
+	select {
+	case err := <-ran:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got context error %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Go did not run on a stopped component")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	lc := lifecycle.New()
+	a, b := lc.Component("a"), lc.Component("b")
+	// The goroutine of a waits for b to stop: Shutdown must stop every
+	// component before it waits for any.
+	a.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		for b.Running() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+	})
+	b.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+	})
+	if err := lc.Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if a.Running() != 0 || b.Running() != 0 {
+		t.Errorf("running after Shutdown: a %d, b %d", a.Running(), b.Running())
+	}
+	if err := lifecycle.New().Shutdown(0); err != nil {
+		t.Errorf("empty Lifecycle: %v", err)
+	}
+}
+
+func TestShutdownReportsLeaks(t *testing.T) {
+	lc := lifecycle.New()
+	release := make(chan struct{})
+	defer close(release)
+	stuck := lc.Component("mirror")
+	stuck.Go(func(context.Context) { <-release })
+	stuck.Go(func(context.Context) { <-release })
+	lc.Component("mirror").Go(func(context.Context) { <-release })
+	lc.Component("index").Go(func(context.Context) { <-release })
+	lc.Component("clean").Go(func(ctx context.Context) { <-ctx.Done() })
+
+	start := time.Now()
+	err := lc.Shutdown(50 * time.Millisecond)
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("Shutdown returned after %v, before the grace period", waited)
+	}
+	var le *lifecycle.LeakError
+	if !errors.As(err, &le) {
+		t.Fatalf("got %v, want a *LeakError", err)
+	}
+	if want := map[string]int{"mirror": 3, "index": 1}; len(le.Running) != len(want) || le.Running["mirror"] != 3 || le.Running["index"] != 1 {
+		t.Errorf("got %v, want %v", le.Running, want)
+	}
+	if want := "index (1), mirror (3)"; !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("message %q does not end in %q", err, want)
+	}
+}
@@ -0,0 +1,94 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// A PanicError is reported when a goroutine started through a Component
+// panics. The panic does not crash the program; it ends (or, under a restart
+// policy, restarts) only the goroutine that caused it.
+type PanicError struct {
+	Value interface{} // The value passed to panic.
+	Stack []byte      // The stack of the panicking goroutine.
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("lifecycle: goroutine panicked: %v", e.Value)
+}
+
+// A RestartPolicy tells Supervise what to do when a goroutine fails, that is,
+// when it returns an error or panics.
+type RestartPolicy struct {
+	// OnFailure restarts failed goroutines. If false, a failed goroutine
+	// stays down.
+	OnFailure bool
+
+	// Backoff is the delay before the first restart. It doubles with every
+	// consecutive failure, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// NeverRestart leaves failed goroutines down. Their errors are still reported.
+var NeverRestart = RestartPolicy{}
+
+// RestartOnFailure restarts failed goroutines with an exponential backoff
+// between backoff and maxBackoff. A goroutine that ran for at least
+// maxBackoff before failing counts as healthy and restarts after backoff
+// again.
+func RestartOnFailure(backoff, maxBackoff time.Duration) RestartPolicy {
+	return RestartPolicy{
+		OnFailure:  true,
+		Backoff:    backoff,
+		MaxBackoff: maxBackoff,
+	}
+}
+
+// Supervise runs fn in a tracked goroutine like Go, and restarts it according
+// to policy whenever it fails. Every failure is passed to the OnError handler
+// of the Lifecycle. Supervision ends when fn returns nil or when the component
+// stops.
+func (c *Component) Supervise(fn func(ctx context.Context) error, policy RestartPolicy) {
+	c.Go(func(ctx context.Context) {
+		backoff := policy.Backoff
+		for {
+			started := time.Now()
+			err := protect(ctx, fn)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			c.report(err)
+			if !policy.OnFailure {
+				return
+			}
+
+			if time.Since(started) >= policy.MaxBackoff {
+				backoff = policy.Backoff
+			}
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			backoff *= 2
+			if backoff > policy.MaxBackoff {
+				backoff = policy.MaxBackoff
+			}
+		}
+	})
+}
+
+// protect calls fn and turns a panic into a *PanicError.
+func protect(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,144 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di/lifecycle"
+)
+
+// failures collects what a Lifecycle reports to OnError.
+type failures struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (f *failures) report(component string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, err)
+}
+
+func (f *failures) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.errs)
+}
+
+func TestGoRecoversPanics(t *testing.T) {
+	f := &failures{}
+	lc := lifecycle.New()
+	lc.OnError = f.report
+	c := lc.Component("worker")
+	c.Go(func(context.Context) { panic("broken") })
+	waitFor(t, "the panic is reported", func() bool { return f.count() == 1 })
+	var pe *lifecycle.PanicError
+	if !errors.As(f.errs[0], &pe) || pe.Value != "broken" || len(pe.Stack) == 0 {
+		t.Errorf("got %#v, want a *PanicError with the value and a stack", f.errs[0])
+	}
+	waitFor(t, "the goroutine is no longer counted", func() bool { return c.Running() == 0 })
+
+	// Without OnError, panics are dropped.
+	lifecycle.New().Component("quiet").Go(func(context.Context) { panic("dropped") })
+}
+
+var errFlaky = errors.New("flaky")
+
+func TestSupervise(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   lifecycle.RestartPolicy
+		fails    int // How often fn fails before it succeeds.
+		panics   bool
+		runs     int
+		reported int
+	}{
+		{"success", lifecycle.RestartOnFailure(time.Millisecond, 4*time.Millisecond), 0, false, 1, 0},
+		{"never restart", lifecycle.NeverRestart, 3, false, 1, 1},
+		{"restart on errors", lifecycle.RestartOnFailure(time.Millisecond, 4*time.Millisecond), 3, false, 4, 3},
+		{"restart on panics", lifecycle.RestartOnFailure(time.Millisecond, 4*time.Millisecond), 3, true, 4, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &failures{}
+			lc := lifecycle.New()
+			lc.OnError = f.report
+			c := lc.Component("worker")
+			var mu sync.Mutex
+			runs := 0
+			c.Supervise(func(context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				runs++
+				if runs > tc.fails {
+					return nil
+				}
+				if tc.panics {
+					panic(errFlaky)
+				}
+				return errFlaky
+			}, tc.policy)
+			waitFor(t, "supervision ends", func() bool { return c.Running() == 0 })
+			if runs != tc.runs {
+				t.Errorf("ran %d times, want %d", runs, tc.runs)
+			}
+			if f.count() != tc.reported {
+				t.Errorf("reported %d failures, want %d", f.count(), tc.reported)
+			}
+		})
+	}
+}
+
+func TestSuperviseBacksOff(t *testing.T) {
+	lc := lifecycle.New()
+	c := lc.Component("worker")
+	var mu sync.Mutex
+	var starts []time.Time
+	c.Supervise(func(context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		starts = append(starts, time.Now())
+		if len(starts) == 5 {
+			return nil
+		}
+		return errFlaky
+	}, lifecycle.RestartOnFailure(10*time.Millisecond, 30*time.Millisecond))
+	waitFor(t, "supervision ends", func() bool { return c.Running() == 0 })
+	// The delays double from 10ms, up to 30ms.
+	for i, min := range []time.Duration{10, 20, 30, 30} {
+		if d := starts[i+1].Sub(starts[i]); d < min*time.Millisecond {
+			t.Errorf("restart %d after %v, want at least %v", i+1, d, min*time.Millisecond)
+		}
+	}
+	if total := starts[4].Sub(starts[0]); total > 500*time.Millisecond {
+		t.Errorf("four restarts took %v", total)
+	}
+}
+
+// Stopping the component ends supervision, also while it waits to restart.
+func TestSuperviseStops(t *testing.T) {
+	f := &failures{}
+	lc := lifecycle.New()
+	lc.OnError = f.report
+	c := lc.Component("worker")
+	c.Supervise(func(context.Context) error { return errFlaky }, lifecycle.RestartOnFailure(time.Hour, time.Hour))
+	waitFor(t, "the failure is reported", func() bool { return f.count() == 1 })
+	if err := lc.Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// An error after the stop is how a goroutine exits, not a failure.
+	c = lc.Component("canceled")
+	c.Supervise(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, lifecycle.RestartOnFailure(time.Millisecond, time.Millisecond))
+	if err := lc.Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if f.count() != 1 {
+		t.Errorf("reported %d failures, want 1", f.count())
+	}
+}
@@ -0,0 +1,60 @@
+package di
+
+// A Lifetime determines how often a binding's provider is called.
+type Lifetime int
+
+const (
+	// Transient bindings call their provider on every resolution, so each
+	// consumer gets a fresh value. This is the default.
+	Transient Lifetime = iota
+
+	// Singleton bindings call their provider once, on first resolution,
+	// and hand the same value to every consumer after that.
+	Singleton
+
+	// Scoped bindings call their provider once per scope, such as once per
+	// HTTP request, and hand the same value to every consumer in that scope.
+	// See Container.NewScope. Resolved outside of a scope, they behave like
+	// singletons.
+	Scoped
+)
+
+func (l Lifetime) String() string {
+	switch l {
+	case Transient:
+		return "transient"
+	case Singleton:
+		return "singleton"
+	case Scoped:
+		return "scoped"
+	}
+	return "unknown lifetime"
+}
+
+// WithLifetime sets the lifetime of a binding. It is mostly useful with
+// Provide; for providers without parameters, RegisterSingleton and
+// RegisterTransient are shorter.
+func WithLifetime(l Lifetime) Option {
+	return func(b *binding) {
+		b.lifetime = l
+	}
+}
+
+// RegisterSingleton is like Register, but the provider is called only once.
+// All consumers share the value it returns, such as one Notebook that every
+// Poem writes into.
+func (c *Container) RegisterSingleton(provider interface{}, opts ...Option) {
+	c.Register(provider, append(opts, WithLifetime(Singleton))...)
+}
+
+// RegisterScoped is like Register, but the provider is called once per
+// scope, such as one Notebook for each request that a server handles.
+func (c *Container) RegisterScoped(provider interface{}, opts ...Option) {
+	c.Register(provider, append(opts, WithLifetime(Scoped))...)
+}
+
+// RegisterTransient is like Register, but states explicitly that each
+// resolution gets a new value, such as a fresh Napkin for every Poem.
+func (c *Container) RegisterTransient(provider interface{}, opts ...Option) {
+	c.Register(provider, append(opts, WithLifetime(Transient))...)
+}
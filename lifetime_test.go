@@ -0,0 +1,74 @@
+package di_test
+
+import (
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+// A counter counts the values that its provider has built.
+type counter struct {
+	n int
+}
+
+func (c *counter) provide() *thing {
+	c.n++
+	return &thing{id: c.n}
+}
+
+type thing struct {
+	id int
+}
+
+func TestLifetimes(t *testing.T) {
+	for _, tc := range []struct {
+		lifetime di.Lifetime
+		same     bool
+	}{
+		{di.Transient, false},
+		{di.Singleton, true},
+		{di.Scoped, true}, // Outside of a scope, like a singleton.
+	} {
+		t.Run(tc.lifetime.String(), func(t *testing.T) {
+			c := di.New()
+			var cnt counter
+			c.Register(cnt.provide, di.WithLifetime(tc.lifetime))
+			a := di.MustResolve[*thing](c)
+			b := di.MustResolve[*thing](c)
+			if (a == b) != tc.same {
+				t.Errorf("two resolutions returned the same value: %t, want %t", a == b, tc.same)
+			}
+			want := 2
+			if tc.same {
+				want = 1
+			}
+			if cnt.n != want {
+				t.Errorf("provider ran %d times, want %d", cnt.n, want)
+			}
+		})
+	}
+}
+
+func TestRegisterReplacesEarlierRegistration(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "first" })
+	c.Register(func() string { return "second" })
+	if got := di.MustResolve[string](c); got != "second" {
+		t.Errorf("got %q, want %q", got, "second")
+	}
+}
+
+func TestNamedBindingsAreApart(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "unnamed" })
+	c.Register(func() string { return "named" }, di.Named("n"))
+	if got := di.MustResolve[string](c); got != "unnamed" {
+		t.Errorf("unnamed: got %q", got)
+	}
+	if got := di.MustResolve[string](c, di.Named("n")); got != "named" {
+		t.Errorf("named: got %q", got)
+	}
+	if _, err := di.Resolve[string](c, di.Named("other")); err == nil {
+		t.Error("resolved a name without a binding")
+	}
+}
@@ -0,0 +1,206 @@
+package di
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Manifest describes the bindings of a container in a form that can be
+// serialized and processed outside of the running program. "di freeze"
+// reads a manifest and generates equivalent wiring code without reflection.
+//
+// Types and functions in a manifest are written as Go expressions in which
+// every package-qualified name has the form {{import/path}}.Name, for
+// example "*{{github.com/appliedgo/di/cmd/poems}}.Poem". Code generators
+// replace the placeholders with the package names that fit their output.
+type Manifest struct {
+	Bindings []ManifestBinding `json:"bindings"`
+}
+
+// A ManifestBinding describes one binding.
+type ManifestBinding struct {
+	Type     string   `json:"type"`
+	Name     string   `json:"name,omitempty"`
+	Lifetime string   `json:"lifetime"`
+	Module   string   `json:"module,omitempty"`
+	Params   []string `json:"params,omitempty"`
+	Result   string   `json:"result"`
+
+	// ParamNames are the names of the bindings injected into Params, if
+	// the binding names any; see ParamNames. An empty name selects the
+	// unnamed binding.
+	ParamNames []string `json:"paramNames,omitempty"`
+
+	// Provider is the provider function as a qualified name, or empty if
+	// the provider cannot be referred to by name, such as a function
+	// literal or a method value.
+	Provider string `json:"provider,omitempty"`
+
+	// Location is the source location of the provider.
+	Location string `json:"location"`
+
+	// Fallible is set for providers that return an error besides the
+	// value.
+	Fallible bool `json:"fallible,omitempty"`
+
+	// Variadic is set for providers whose last parameter is variadic. Its
+	// entry in Params is the slice type.
+	Variadic bool `json:"variadic,omitempty"`
+
+	// Alias is set for bindings created with As. It is the type of the
+	// aliased binding, which has the same name. Such bindings have no
+	// provider of their own.
+	Alias string `json:"alias,omitempty"`
+
+	// Fields are the struct fields that the container injects into the
+	// provider's result. See InjectFields.
+	Fields []ManifestField `json:"fields,omitempty"`
+}
+
+// A ManifestField describes an injected struct field.
+type ManifestField struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Binding string `json:"binding,omitempty"` // Name of the injected binding.
+
+	// Unexported is set for unexported fields, which the container writes
+	// through package unsafe.
+	Unexported bool `json:"unexported,omitempty"`
+}
+
+// Manifest returns a description of all bindings, sorted by type and name.
+func (c *Container) Manifest() Manifest {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var m Manifest
+	for k, b := range c.bindings {
+		mb := ManifestBinding{
+			Type:     typeExpr(k.typ),
+			Name:     k.name,
+			Lifetime: b.lifetime.String(),
+			Module:   b.module,
+			Result:   typeExpr(b.provider.Type().Out(0)),
+			Provider: funcExpr(b.provider),
+			Location: b.location,
+			Fallible: b.provider.Type().NumOut() == 2,
+			Variadic: b.variadic,
+		}
+		if b.alias != nil {
+			mb.Alias = typeExpr(b.alias.typ)
+			mb.Result = mb.Alias
+			mb.Provider = ""
+		}
+		for _, p := range b.params {
+			mb.Params = append(mb.Params, typeExpr(p))
+		}
+		for _, name := range b.paramNames {
+			if name != "" {
+				mb.ParamNames = append([]string(nil), b.paramNames...)
+				break
+			}
+		}
+		for _, f := range b.fields {
+			mb.Fields = append(mb.Fields, ManifestField{
+				Name:       f.name,
+				Type:       typeExpr(f.dep.typ),
+				Binding:    f.dep.name,
+				Unexported: f.unexported,
+			})
+		}
+		m.Bindings = append(m.Bindings, mb)
+	}
+	sort.Slice(m.Bindings, func(i, j int) bool {
+		a, b := m.Bindings[i], m.Bindings[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+	return m
+}
+
+// WriteTo writes the manifest as indented JSON.
+func (m Manifest) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// typeExpr writes t as a Go type expression with placeholder qualifiers.
+func typeExpr(t reflect.Type) string {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name()
+		}
+		return "{{" + t.PkgPath() + "}}." + t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + typeExpr(t.Elem())
+	case reflect.Slice:
+		return "[]" + typeExpr(t.Elem())
+	case reflect.Array:
+		return "[" + strconv.Itoa(t.Len()) + "]" + typeExpr(t.Elem())
+	case reflect.Map:
+		return "map[" + typeExpr(t.Key()) + "]" + typeExpr(t.Elem())
+	case reflect.Chan:
+		switch t.ChanDir() {
+		case reflect.RecvDir:
+			return "<-chan " + typeExpr(t.Elem())
+		case reflect.SendDir:
+			return "chan<- " + typeExpr(t.Elem())
+		}
+		return "chan " + typeExpr(t.Elem())
+	case reflect.Func:
+		params := make([]string, t.NumIn())
+		for i := range params {
+			params[i] = typeExpr(t.In(i))
+		}
+		if t.IsVariadic() {
+			params[len(params)-1] = "..." + typeExpr(t.In(t.NumIn()-1).Elem())
+		}
+		results := make([]string, t.NumOut())
+		for i := range results {
+			results[i] = typeExpr(t.Out(i))
+		}
+		s := "func(" + strings.Join(params, ", ") + ")"
+		switch len(results) {
+		case 0:
+			return s
+		case 1:
+			return s + " " + results[0]
+		}
+		return s + " (" + strings.Join(results, ", ") + ")"
+	}
+	// Unnamed structs and non-empty interfaces are rare as bindings and are
+	// written as reflect prints them.
+	return t.String()
+}
+
+// funcExpr returns the qualified name of a top-level function, or "" for
+// function literals, method values and generic instantiations.
+func funcExpr(fn reflect.Value) string {
+	f := runtime.FuncForPC(fn.Pointer())
+	if f == nil {
+		return ""
+	}
+	name := f.Name()
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	pkg, fname := name[:slash+1+dot], name[slash+1+dot+1:]
+	if strings.ContainsAny(fname, ".()[]-") {
+		return ""
+	}
+	return "{{" + pkg + "}}." + fname
+}
@@ -0,0 +1,136 @@
+package di
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A Definition describes bindings that can be installed into a container.
+// Definitions are created by Provide and Module.
+type Definition interface {
+	// provisions returns the providers of the definition, recording the
+	// path of modules they were defined in.
+	provisions(module []string) []provision
+}
+
+// A provision is a single provider waiting to be installed, together with
+// the module that defined it.
+type provision struct {
+	fn       reflect.Value
+	opts     []Option
+	module   string
+	profiles []string // Profiles that must be active, from Profile.
+}
+
+func (p provision) provisions(module []string) []provision {
+	p.module = strings.Join(module, "/")
+	return []provision{p}
+}
+
+// key returns the key that the provision will be bound to.
+func (p provision) key() key {
+	return resolveKey(p.fn.Type().Out(0), p.opts)
+}
+
+// Provide defines a constructor for installation with Container.Install. It
+// accepts the same constructors and options as Container.Provide, and panics
+// on invalid constructors, too.
+func Provide(constructor interface{}, opts ...Option) Definition {
+	t := reflect.TypeOf(constructor)
+	if t == nil || t.Kind() != reflect.Func || !validResults(t) {
+		panic(fmt.Sprintf("di: Provide: constructor must return a value or a value and an error, got %T", constructor))
+	}
+	return provision{fn: reflect.ValueOf(constructor), opts: opts}
+}
+
+// A module is a named bundle of definitions.
+type module struct {
+	name string
+	defs []Definition
+}
+
+// Module bundles related definitions under a name, so that they can be
+// shared between applications and installed in one go:
+//
+//	var Storage = di.Module("storage",
+//		di.Provide(NewNotebook),
+//		di.Provide(NewNapkin),
+//	)
+//
+// Modules may contain other modules. Their names then form a path such as
+// "app/storage", which identifies the module in a ConflictError.
+func Module(name string, defs ...Definition) Definition {
+	return module{name: name, defs: defs}
+}
+
+func (m module) provisions(parent []string) []provision {
+	path := append(parent[:len(parent):len(parent)], m.name)
+	var ps []provision
+	for _, d := range m.defs {
+		ps = append(ps, d.provisions(path)...)
+	}
+	return ps
+}
+
+// A ConflictError is returned by Install if two modules bind the same type
+// and name.
+type ConflictError struct {
+	Type    reflect.Type
+	Name    string    // The name of the binding, if it is named.
+	Modules [2]string // The conflicting modules, as module paths.
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("di: %v is bound by both module %q and module %q", key{typ: e.Type, name: e.Name}, e.Modules[0], e.Modules[1])
+}
+
+// Install registers all providers of defs, as Provide would. Providers
+// defined under a profile other than the active one are skipped.
+//
+// Each module owns the bindings it installs. If two modules bind the same
+// type and name, within this call or across calls, Install returns a
+// *ConflictError and installs nothing. Group members never conflict.
+// Bindings registered outside of modules do not take part in conflict
+// detection and are replaced silently, as with Register.
+func (c *Container) Install(defs ...Definition) error {
+	var ps []provision
+	for _, d := range defs {
+		for _, p := range d.provisions(nil) {
+			if c.active(p.profiles) {
+				ps = append(ps, p)
+			}
+		}
+	}
+
+	owners := map[key]string{}
+	c.mu.RLock()
+	for k, b := range c.bindings {
+		if b.module != "" {
+			owners[k] = b.module
+		}
+	}
+	c.mu.RUnlock()
+	for _, p := range ps {
+		if p.module == "" || inGroup(p.opts) {
+			continue
+		}
+		k := p.key()
+		if owner, ok := owners[k]; ok {
+			return &ConflictError{Type: k.typ, Name: k.name, Modules: [2]string{owner, p.module}}
+		}
+		owners[k] = p.module
+	}
+
+	for _, p := range ps {
+		c.bind(p.fn, append(p.opts, inModule(p.module)))
+	}
+	return nil
+}
+
+// inModule records the module that installs a binding.
+func inModule(path string) Option {
+	return func(b *binding) {
+		b.module = path
+	}
+}
@@ -0,0 +1,46 @@
+package di
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Named registers or resolves a binding under a name. Named bindings let a
+// container hold several implementations of the same type side by side:
+//
+//	c.RegisterSingleton(func() PoemStorage { return NewNotebook() }, di.Named("archive"))
+//	c.RegisterSingleton(func() PoemStorage { return NewNapkin() }, di.Named("scratch"))
+//
+//	archive := di.MustResolve[PoemStorage](c, di.Named("archive"))
+//
+// A named binding is separate from the unnamed binding of the same type.
+// Parameters of constructors registered with Provide receive the unnamed
+// binding of their type, unless ParamNames names another.
+func Named(name string) Option {
+	return func(b *binding) {
+		b.name = name
+	}
+}
+
+// A key identifies a binding by its type and, for named bindings, its name.
+type key struct {
+	typ  reflect.Type
+	name string
+}
+
+func (k key) String() string {
+	if k.name == "" {
+		return k.typ.String()
+	}
+	return fmt.Sprintf("%v (named %q)", k.typ, k.name)
+}
+
+// resolveKey returns the key that Resolve and Release look up for type t.
+// They accept the same options as Register, but only Named has an effect.
+func resolveKey(t reflect.Type, opts []Option) key {
+	var b binding
+	for _, opt := range opts {
+		opt(&b)
+	}
+	return key{typ: t, name: b.name}
+}
@@ -0,0 +1,55 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// Optional marks a dependency that a constructor can do without. A
+// constructor that takes an Optional[T] gets the resolved T if a provider
+// for T is registered, and an empty Optional otherwise:
+//
+//	func NewPoem(ps PoemStorage, m di.Optional[Metrics]) *Poem {
+//		p := &Poem{storage: ps}
+//		if m.OK {
+//			p.metrics = m.Value
+//		}
+//		return p
+//	}
+//
+// Only a missing provider for T itself is tolerated. If T is registered but
+// fails to resolve, for example because one of its own dependencies is
+// missing, the error is reported as usual.
+type Optional[T any] struct {
+	Value T
+	OK    bool // Whether Value was resolved.
+}
+
+func (Optional[T]) resolveWrapper(c *Container, ctx context.Context, path resolution, name string) (reflect.Value, error) {
+	var opt Optional[T]
+	k := key{typ: typeOf[T](), name: name}
+	v, err := c.resolve(ctx, path, k)
+	switch {
+	case err == nil:
+		reflect.ValueOf(&opt.Value).Elem().Set(v)
+		opt.OK = true
+	case !c.missing(k, err):
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(opt), nil
+}
+
+func (Optional[T]) wrapped() (reflect.Type, string) {
+	return typeOf[T](), "optional"
+}
+
+// missing reports whether err means that no provider is registered for k
+// itself, as opposed to one of its dependencies.
+func (c *Container) missing(k key, err error) bool {
+	if !errors.Is(err, ErrNotRegistered) {
+		return false
+	}
+	_, _, ok := c.lookup(k)
+	return !ok && len(c.members(k)) == 0
+}
@@ -0,0 +1,103 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type reader struct {
+	th di.Optional[*thing]
+}
+
+func TestOptional(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		wire func(c *di.Container)
+		ok   bool
+	}{
+		{
+			name: "missing",
+			wire: func(c *di.Container) {},
+		},
+		{
+			name: "registered",
+			wire: func(c *di.Container) { c.Register(func() *thing { return &thing{id: 7} }) },
+			ok:   true,
+		},
+		{
+			name: "only under another name",
+			wire: func(c *di.Container) { c.Register(func() *thing { return &thing{} }, di.Named("other")) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			tc.wire(c)
+			c.Provide(func(th di.Optional[*thing]) *reader { return &reader{th} })
+			r, err := di.Resolve[*reader](c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.th.OK != tc.ok {
+				t.Errorf("OK: got %t, want %t", r.th.OK, tc.ok)
+			}
+			if tc.ok && r.th.Value.id != 7 {
+				t.Errorf("Value: got %+v", r.th.Value)
+			}
+			if !tc.ok && r.th.Value != nil {
+				t.Errorf("Value of a missing dependency: got %+v, want nil", r.th.Value)
+			}
+		})
+	}
+}
+
+func TestOptionalNamed(t *testing.T) {
+	c := di.New()
+	c.Register(func() *thing { return &thing{id: 1} }, di.Named("one"))
+	c.Provide(func(th di.Optional[*thing]) *reader { return &reader{th} }, di.ParamNames("one"))
+	if r := di.MustResolve[*reader](c); !r.th.OK || r.th.Value.id != 1 {
+		t.Errorf("got %+v, want the named *thing", r.th)
+	}
+}
+
+// Optional tolerates a missing T, but not a T that fails to build.
+func TestOptionalReportsBrokenDependencies(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		wire   func(c *di.Container)
+		target error
+	}{
+		{
+			name:   "missing dependency of T",
+			wire:   func(c *di.Container) { c.Provide(func(*store) *thing { return &thing{} }) },
+			target: di.ErrNotRegistered,
+		},
+		{
+			name:   "failing provider",
+			wire:   func(c *di.Container) { c.Register(func() (*thing, error) { return nil, errBroken }) },
+			target: errBroken,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			tc.wire(c)
+			c.Provide(func(th di.Optional[*thing]) *reader { return &reader{th} })
+			if _, err := di.Resolve[*reader](c); !errors.Is(err, tc.target) {
+				t.Errorf("got %v, want %v", err, tc.target)
+			}
+		})
+	}
+}
+
+func TestOptionalGroup(t *testing.T) {
+	c := di.New()
+	c.Register(func() *thing { return &thing{id: 1} }, di.Group())
+	c.Register(func() *thing { return &thing{id: 2} }, di.Group())
+	var got di.Optional[[]*thing]
+	c.Provide(func(ths di.Optional[[]*thing]) *reader { got = ths; return &reader{} })
+	di.MustResolve[*reader](c)
+	if !got.OK || len(got.Value) != 2 {
+		t.Errorf("got %+v, want both members", got)
+	}
+}
@@ -0,0 +1,52 @@
+package di
+
+import "reflect"
+
+// An Option configures a binding when it is registered.
+type Option func(*binding)
+
+// MaxInstances limits the number of live instances of a binding to n.
+// An instance counts as live from the moment Resolve starts constructing it
+// until it is handed back through Release. Once the limit is reached, Resolve
+// fails with a *LimitError.
+func MaxInstances(n int) Option {
+	return func(b *binding) {
+		b.maxInstances = n
+	}
+}
+
+// MaxConcurrent limits the number of provider calls that may run at the same
+// time for a binding to n. MaxConcurrent(1) ensures that an expensive or
+// non-reentrant constructor never runs twice in parallel. A Resolve that
+// would exceed the limit fails with a *LimitError instead of waiting.
+func MaxConcurrent(n int) Option {
+	return func(b *binding) {
+		b.maxConcurrent = n
+	}
+}
+
+// AllowNil permits the provider, and the binding's decorators, to return
+// nil. By default, a nil pointer, interface, map, channel or function fails
+// the resolution with a *ProviderError that wraps ErrNilResult, rather than
+// handing the nil to a consumer that panics far away from the provider that
+// returned it. That includes an interface that holds a nil pointer, as in
+//
+//	func() PoemStorage { var n *Notebook; return n }
+//
+// Nil slices are always permitted, as they behave like empty ones.
+func AllowNil() Option {
+	return func(b *binding) {
+		b.allowNil = true
+	}
+}
+
+// isNil reports whether v is nil, or an interface that holds a nil pointer.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return v.IsNil()
+	case reflect.Interface:
+		return v.IsNil() || v.Elem().Kind() == reflect.Ptr && v.Elem().IsNil()
+	}
+	return false
+}
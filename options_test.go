@@ -0,0 +1,251 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+func TestNilResults(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		provider interface{}
+		resolve  func(c *di.Container) error
+		nilOK    bool // Whether nil is fine without AllowNil.
+	}{
+		{
+			name:     "pointer",
+			provider: func() *thing { return nil },
+			resolve:  func(c *di.Container) error { _, err := di.Resolve[*thing](c); return err },
+		},
+		{
+			name:     "interface holding a nil pointer",
+			provider: func() speaker { var ps *poetSpeaker; return ps },
+			resolve:  func(c *di.Container) error { _, err := di.Resolve[speaker](c); return err },
+		},
+		{
+			name:     "map",
+			provider: func() map[string]int { return nil },
+			resolve:  func(c *di.Container) error { _, err := di.Resolve[map[string]int](c); return err },
+		},
+		{
+			name:     "func",
+			provider: func() func() { return nil },
+			resolve:  func(c *di.Container) error { _, err := di.Resolve[func()](c); return err },
+		},
+		{
+			name:     "slice",
+			provider: func() []int { return nil },
+			resolve:  func(c *di.Container) error { _, err := di.Resolve[[]int](c); return err },
+			nilOK:    true,
+		},
+		{
+			name:     "with an error result",
+			provider: func() (*thing, error) { return nil, nil },
+			resolve:  func(c *di.Container) error { _, err := di.Resolve[*thing](c); return err },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			c.Register(tc.provider)
+			err := tc.resolve(c)
+			if tc.nilOK {
+				if err != nil {
+					t.Errorf("got %v, want nil accepted", err)
+				}
+				return
+			}
+			var pe *di.ProviderError
+			if !errors.Is(err, di.ErrNilResult) || !errors.As(err, &pe) {
+				t.Errorf("got %v, want a *ProviderError wrapping %v", err, di.ErrNilResult)
+			}
+
+			c = di.New()
+			c.Register(tc.provider, di.AllowNil())
+			if err := tc.resolve(c); err != nil {
+				t.Errorf("with AllowNil: %v", err)
+			}
+		})
+	}
+}
+
+func TestNilFromDecorator(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		c := di.New()
+		var opts []di.Option
+		if allow {
+			opts = append(opts, di.AllowNil())
+		}
+		c.Register(func() *thing { return &thing{} }, opts...)
+		c.Decorate(func(*thing) *thing { return nil })
+		_, err := di.Resolve[*thing](c)
+		if got := errors.Is(err, di.ErrNilResult); got == allow {
+			t.Errorf("AllowNil %t: got %v", allow, err)
+		}
+	}
+}
+
+// A consumer of a nil dependency gets the error, not the nil.
+func TestNilDependency(t *testing.T) {
+	c := di.New()
+	c.Register(func() *thing { return nil })
+	called := false
+	c.Provide(func(*thing) *store { called = true; return &store{} })
+	if _, err := di.Resolve[*store](c); !errors.Is(err, di.ErrNilResult) {
+		t.Errorf("got %v, want %v", err, di.ErrNilResult)
+	}
+	if called {
+		t.Error("the consumer was called with the nil")
+	}
+}
+
+// limit returns the *LimitError in err, or fails t.
+func limit(t *testing.T, err error) *di.LimitError {
+	t.Helper()
+	var le *di.LimitError
+	if !errors.As(err, &le) || !errors.Is(err, di.ErrLimitExceeded) {
+		t.Fatalf("got %v, want a *LimitError", err)
+	}
+	return le
+}
+
+func TestMaxInstances(t *testing.T) {
+	c := di.New()
+	var cnt counter
+	c.Register(cnt.provide, di.MaxInstances(2))
+
+	a := di.MustResolve[*thing](c)
+	di.MustResolve[*thing](c)
+	_, err := di.Resolve[*thing](c)
+	if le := limit(t, err); le.Limit != "instances" || le.Max != 2 {
+		t.Errorf("got %+v", le)
+	}
+	if cnt.n != 2 {
+		t.Errorf("the provider ran %d times, want 2", cnt.n)
+	}
+
+	if err := c.Release(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a != nil {
+		t.Error("Release did not clear the target")
+	}
+	if _, err := di.Resolve[*thing](c); err != nil {
+		t.Errorf("after Release: %v", err)
+	}
+}
+
+// A construction that fails does not keep its slot.
+func TestMaxInstancesReleasedOnFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		wire func(c *di.Container, fail *bool)
+	}{
+		{
+			name: "provider error",
+			wire: func(c *di.Container, fail *bool) {
+				c.Register(func() (*thing, error) {
+					if *fail {
+						return nil, errBroken
+					}
+					return &thing{}, nil
+				}, di.MaxInstances(1))
+			},
+		},
+		{
+			name: "dependency error",
+			wire: func(c *di.Container, fail *bool) {
+				c.Register(func() (*store, error) {
+					if *fail {
+						return nil, errBroken
+					}
+					return &store{}, nil
+				})
+				c.Provide(func(*store) *thing { return &thing{} }, di.MaxInstances(1))
+			},
+		},
+		{
+			name: "Init error",
+			wire: func(c *di.Container, fail *bool) {
+				var inits int
+				c.Register(func() *retrying { return &retrying{fail: fail, inits: &inits} }, di.MaxInstances(1))
+				c.Provide(func(*retrying) *thing { return &thing{} })
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			fail := true
+			tc.wire(c, &fail)
+			for i := 0; i < 3; i++ {
+				if _, err := di.Resolve[*thing](c); !errors.Is(err, errBroken) {
+					t.Fatalf("attempt %d: got %v, want %v", i, err, errBroken)
+				}
+			}
+			fail = false
+			if _, err := di.Resolve[*thing](c); err != nil {
+				t.Errorf("after the failures: %v", err)
+			}
+		})
+	}
+}
+
+func TestMaxInstancesOfSingletons(t *testing.T) {
+	c := di.New()
+	c.RegisterSingleton(func() *thing { return &thing{} }, di.MaxInstances(1))
+	a := di.MustResolve[*thing](c)
+	if err := c.Release(&a); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := di.Resolve[*thing](c); err != nil || b == nil {
+		t.Errorf("got %v, %v, want the cached singleton", b, err)
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	c := di.New()
+	entered := make(chan struct{})
+	proceed := make(chan struct{})
+	c.Register(func() *thing {
+		entered <- struct{}{}
+		<-proceed
+		return &thing{}
+	}, di.MaxConcurrent(1))
+
+	done := make(chan error)
+	go func() {
+		_, err := di.Resolve[*thing](c)
+		done <- err
+	}()
+	<-entered
+	_, err := di.Resolve[*thing](c)
+	if le := limit(t, err); le.Limit != "concurrent constructions" || le.Max != 1 {
+		t.Errorf("got %+v", le)
+	}
+	close(proceed)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the first construction is done, the next may run.
+	go func() { <-entered }()
+	select {
+	case err := <-resolveAsync[*thing](c):
+		if err != nil {
+			t.Errorf("after the first construction: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the second construction did not finish")
+	}
+}
+
+func resolveAsync[T any](c *di.Container) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		_, err := di.Resolve[T](c)
+		ch <- err
+	}()
+	return ch
+}
@@ -0,0 +1,96 @@
+package di
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// overridesEnabled is set by EnableOverrides. Accessed atomically.
+var overridesEnabled int32
+
+// EnableOverrides allows Override outside of tests, for harnesses that are
+// not built by go test, such as a binary that runs end-to-end checks
+// against fakes.
+func EnableOverrides() {
+	atomic.StoreInt32(&overridesEnabled, 1)
+}
+
+// overridesAllowed reports whether Override may be used: in test binaries,
+// which register the test.v flag, or after EnableOverrides.
+func overridesAllowed() bool {
+	return atomic.LoadInt32(&overridesEnabled) == 1 || flag.Lookup("test.v") != nil
+}
+
+// Override replaces a binding with a test double until ResetOverrides. It
+// accepts the same providers and options as Provide, so a test can swap a
+// single dependency out of the production wiring:
+//
+//	c := app.Wire() // The production container.
+//	fake := NewNapkin()
+//	c.Override(func() PoemStorage { return fake })
+//	defer c.ResetOverrides()
+//
+// Only the binding is replaced: decorators of the type still apply, and
+// singletons that were constructed with the original binding keep it. To
+// keep production code from overriding by accident, Override panics unless
+// it runs in a test binary or EnableOverrides has been called. Group
+// members cannot be overridden.
+func (c *Container) Override(provider interface{}, opts ...Option) {
+	if !overridesAllowed() {
+		panic("di: Override is only available in tests; call EnableOverrides to use it elsewhere")
+	}
+	t := reflect.TypeOf(provider)
+	if t == nil || t.Kind() != reflect.Func || !validResults(t) {
+		panic(fmt.Sprintf("di: Override: provider must return a value or a value and an error, got %T", provider))
+	}
+	if inGroup(opts) {
+		panic("di: Override: group members cannot be overridden")
+	}
+	c.bind(reflect.ValueOf(provider), append(opts, overriding()))
+}
+
+// OverrideValue is like Override, but binds value itself as a singleton.
+// The value may be nil, to test how consumers cope with a missing
+// dependency.
+func OverrideValue[T any](c *Container, value T, opts ...Option) {
+	c.Override(func() T { return value }, append(opts, WithLifetime(Singleton), AllowNil())...)
+}
+
+// ResetOverrides restores the bindings that Override replaced, and removes
+// those it added. Singletons of the restored bindings that were constructed
+// before the override are reused.
+func (c *Container) ResetOverrides() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, b := range c.overridden {
+		if b == nil {
+			delete(c.bindings, k)
+			continue
+		}
+		c.bindings[k] = b
+	}
+	c.overridden = nil
+}
+
+// overriding marks a binding as an override.
+func overriding() Option {
+	return func(b *binding) {
+		b.override = true
+	}
+}
+
+// replace stores b as the binding of k. For overrides, it remembers the
+// binding that was there before the first override. c.mu must be held.
+func (c *Container) replace(k key, b *binding) {
+	if b.override {
+		if _, ok := c.overridden[k]; !ok {
+			if c.overridden == nil {
+				c.overridden = map[key]*binding{}
+			}
+			c.overridden[k] = c.bindings[k]
+		}
+	}
+	c.bindings[k] = b
+}
@@ -0,0 +1,87 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+func TestOverrideAndReset(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "production" })
+	c.Decorate(func(s string) string { return "(" + s + ")" })
+
+	c.Override(func() string { return "double" })
+	if got := di.MustResolve[string](c); got != "(double)" {
+		t.Errorf("overridden: got %q, want the double, decorated", got)
+	}
+	c.Override(func() string { return "another double" })
+	c.ResetOverrides()
+	if got := di.MustResolve[string](c); got != "(production)" {
+		t.Errorf("reset: got %q, want the first binding back", got)
+	}
+}
+
+func TestOverrideAddsABinding(t *testing.T) {
+	c := di.New()
+	c.Override(func() string { return "double" })
+	if got := di.MustResolve[string](c); got != "double" {
+		t.Errorf("got %q", got)
+	}
+	c.ResetOverrides()
+	if _, err := di.Resolve[string](c); !errors.Is(err, di.ErrNotRegistered) {
+		t.Errorf("after the reset: got %v, want %v", err, di.ErrNotRegistered)
+	}
+}
+
+// A singleton that has seen the original binding keeps it through the
+// override, and the original singleton comes back after the reset.
+func TestOverrideAfterSingletonConstruction(t *testing.T) {
+	c := di.New()
+	c.RegisterSingleton(func() *thing { return &thing{id: 1} })
+	type user struct{ th *thing }
+	c.Provide(func(th *thing) *user { return &user{th} }, di.WithLifetime(di.Singleton))
+	u := di.MustResolve[*user](c)
+	original := di.MustResolve[*thing](c)
+
+	di.OverrideValue(c, &thing{id: 2})
+	if got := di.MustResolve[*thing](c).id; got != 2 {
+		t.Errorf("overridden: got %d, want 2", got)
+	}
+	if got := di.MustResolve[*user](c); got != u || got.th != original {
+		t.Error("the cached singleton did not keep the original dependency")
+	}
+
+	c.ResetOverrides()
+	if got := di.MustResolve[*thing](c); got != original {
+		t.Errorf("reset: got %+v, want the original singleton", got)
+	}
+}
+
+func TestOverrideValueNil(t *testing.T) {
+	c := di.New()
+	c.Register(func() *thing { return &thing{} })
+	di.OverrideValue[*thing](c, nil)
+	if got, err := di.Resolve[*thing](c); err != nil || got != nil {
+		t.Errorf("got %v, %v, want nil and no error", got, err)
+	}
+}
+
+func TestOverrideRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		provider interface{}
+		opts     []di.Option
+	}{
+		{"not a func", "double", nil},
+		{"no result", func() {}, nil},
+		{"group member", func() string { return "" }, []di.Option{di.Group()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if msg := panics(func() { di.New().Override(tc.provider, tc.opts...) }); msg == "" {
+				t.Error("Override accepted it")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package di
+
+// SetProfile makes name the active profile of c and of its scopes. It
+// affects later calls to Install only; bindings that are already installed
+// stay in place.
+func (c *Container) SetProfile(name string) {
+	r := c.root()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profile = name
+}
+
+// Profile returns the active profile, or "" if none has been set.
+func (c *Container) Profile() string {
+	r := c.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.profile
+}
+
+// A profiled definition applies only if its profile is active.
+type profiled struct {
+	name string
+	defs []Definition
+}
+
+// Profile returns a definition that installs defs only while the profile
+// called name is active. Profiles select between alternative wirings of the
+// same application, such as a Napkin for development and a durable storage
+// in production, without touching the code that consumes them:
+//
+//	c.SetProfile(os.Getenv("POEMS_PROFILE"))
+//	c.Install(
+//		di.Profile("dev", di.Provide(func() PoemStorage { return NewNapkin() })),
+//		di.Profile("prod", di.Provide(OpenDurableStorage)),
+//	)
+//
+// Install skips the definitions of inactive profiles, so they never
+// conflict with the active ones. Nested profiles must all be active.
+func Profile(name string, defs ...Definition) Definition {
+	return profiled{name: name, defs: defs}
+}
+
+func (p profiled) provisions(module []string) []provision {
+	var ps []provision
+	for _, d := range p.defs {
+		for _, pv := range d.provisions(module) {
+			pv.profiles = append(pv.profiles[:len(pv.profiles):len(pv.profiles)], p.name)
+			ps = append(ps, pv)
+		}
+	}
+	return ps
+}
+
+// A conditional definition applies only if its condition holds.
+type conditional struct {
+	cond bool
+	defs []Definition
+}
+
+// If returns a definition that installs defs only if cond is true, for
+// conditions that are known when the definitions are put together, such as
+// a feature flag.
+func If(cond bool, defs ...Definition) Definition {
+	return conditional{cond: cond, defs: defs}
+}
+
+func (c conditional) provisions(module []string) []provision {
+	if !c.cond {
+		return nil
+	}
+	var ps []provision
+	for _, d := range c.defs {
+		ps = append(ps, d.provisions(module)...)
+	}
+	return ps
+}
+
+// RegisterIf is like Register, but registers provider only if cond is true.
+// An existing binding of the same type stays in place otherwise, so a
+// default can be registered first and overridden conditionally:
+//
+//	c.Register(func() PoemStorage { return NewNotebook() })
+//	c.RegisterIf(*travelling, func() PoemStorage { return NewNapkin() })
+func (c *Container) RegisterIf(cond bool, provider interface{}, opts ...Option) {
+	if cond {
+		c.Register(provider, opts...)
+	}
+}
+
+// active reports whether every profile in profiles is the active profile.
+func (c *Container) active(profiles []string) bool {
+	current := c.Profile()
+	for _, p := range profiles {
+		if p != current {
+			return false
+		}
+	}
+	return true
+}
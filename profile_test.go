@@ -0,0 +1,93 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+func storageDefs() []di.Definition {
+	return []di.Definition{
+		di.Provide(func() int { return 0 }), // In every profile.
+		di.Profile("dev", di.Module("napkin", di.Provide(func() string { return "napkin" }))),
+		di.Profile("prod", di.Module("durable", di.Provide(func() string { return "durable" }))),
+		di.Profile("prod", di.Profile("dev", di.Provide(func() []byte { return nil }))),
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	for _, tc := range []struct {
+		profile string
+		want    string // "" if no string is bound.
+	}{
+		{"dev", "napkin"},
+		{"prod", "durable"},
+		{"", ""},
+		{"test", ""},
+	} {
+		t.Run("profile "+tc.profile, func(t *testing.T) {
+			c := di.New()
+			c.SetProfile(tc.profile)
+			if got := c.Profile(); got != tc.profile {
+				t.Errorf("Profile: got %q", got)
+			}
+			// Both profiles bind a string in a module of their own, which
+			// would conflict if both were installed.
+			if err := c.Install(storageDefs()...); err != nil {
+				t.Fatal(err)
+			}
+			got, err := di.Resolve[string](c)
+			switch {
+			case tc.want == "" && !errors.Is(err, di.ErrNotRegistered):
+				t.Errorf("got %q, %v, want no binding", got, err)
+			case tc.want != "" && got != tc.want:
+				t.Errorf("got %q, %v, want %q", got, err, tc.want)
+			}
+			if _, err := di.Resolve[int](c); err != nil {
+				t.Errorf("the definition outside of profiles: %v", err)
+			}
+			if _, err := di.Resolve[[]byte](c); !errors.Is(err, di.ErrNotRegistered) {
+				t.Errorf("nested profiles that are not all active: got %v", err)
+			}
+		})
+	}
+}
+
+// SetProfile affects later Installs only, and applies to scopes.
+func TestSetProfileAfterInstall(t *testing.T) {
+	c := di.New()
+	c.SetProfile("dev")
+	if err := c.Install(storageDefs()...); err != nil {
+		t.Fatal(err)
+	}
+	s := c.NewScope()
+	s.SetProfile("prod")
+	if got := c.Profile(); got != "prod" {
+		t.Errorf("the scope did not set the root's profile: %q", got)
+	}
+	if got := di.MustResolve[string](s); got != "napkin" {
+		t.Errorf("got %q, want the binding installed under dev", got)
+	}
+}
+
+func TestIf(t *testing.T) {
+	for _, cond := range []bool{false, true} {
+		c := di.New()
+		c.Register(func() string { return "default" })
+		c.RegisterIf(cond, func() string { return "registered" })
+		if err := c.Install(di.If(cond, di.Provide(func() int { return 1 }))); err != nil {
+			t.Fatal(err)
+		}
+		want := "default"
+		if cond {
+			want = "registered"
+		}
+		if got := di.MustResolve[string](c); got != want {
+			t.Errorf("RegisterIf(%t): got %q, want %q", cond, got, want)
+		}
+		if _, err := di.Resolve[int](c); (err == nil) != cond {
+			t.Errorf("If(%t): got %v", cond, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/appliedgo/di/ctxkey"
+)
+
+// Proxy breaks dependency cycles through the interface type T. Where a
+// provider needs T, and constructing T would lead back to a value that is
+// still under construction, the container does not fail with a *CycleError
+// but injects the result of proxy: a value of T that forwards every call
+// to the target, which the Lazy resolves on first use:
+//
+//	type StorageProxy struct{ target di.Lazy[PoemStorage] }
+//
+//	func (p StorageProxy) Load(name string) []byte { return p.target.MustGet().Load(name) }
+//	...
+//
+//	di.Proxy(c, func(target di.Lazy[PoemStorage]) PoemStorage { return StorageProxy{target} })
+//
+// With that, a PoemStorage that needs an *Index, whose constructor needs
+// the PoemStorage, can be built: the index gets the proxy, and by the time
+// it calls the proxy, the storage is done. Go cannot implement interfaces
+// at run time, so the proxy type is written by hand.
+//
+// The proxy is only for calls after construction. Until the call that
+// created it returns (Resolve, Build, or Invoke), the Lazy fails with
+// ErrProxyNotReady, so a constructor in the cycle that calls the proxy
+// gets an error instead of a deadlock. For the cycle to close on the same
+// value, T's binding should be a singleton or scoped; a transient target
+// resolves a new value.
+//
+// Build does not report cycles that a proxy breaks. Pass Named to proxy a
+// named binding. Proxy panics if T is not an interface type.
+func Proxy[T any](c *Container, proxy func(target Lazy[T]) T, opts ...Option) {
+	t := typeOf[T]()
+	if t.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("di: Proxy: %v is not an interface type", t))
+	}
+	k := resolveKey(t, opts)
+	maker := func(c *Container, ready *int32) reflect.Value {
+		resolve := factory[T](c, k.name)
+		l := Lazy[T]{state: &lazyState[T]{resolve: func() (T, error) {
+			if atomic.LoadInt32(ready) == 0 {
+				var zero T
+				return zero, fmt.Errorf("di: resolve: %v: %w", k, ErrProxyNotReady)
+			}
+			return resolve()
+		}}}
+		v := reflect.New(t).Elem()
+		v.Set(reflect.ValueOf(proxy(l)))
+		return v
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.proxies == nil {
+		c.proxies = map[key]proxyMaker{}
+	}
+	c.proxies[k] = maker
+}
+
+// ErrProxyNotReady is returned by the Lazy of a proxy that is used before
+// the call that created the proxy has returned.
+var ErrProxyNotReady = errors.New("proxy used before its target was constructed")
+
+// A proxyMaker returns a proxy that resolves its target from c once ready
+// is set.
+type proxyMaker func(c *Container, ready *int32) reflect.Value
+
+// proxyMaker returns the proxy maker for k from c or its ancestors.
+func (c *Container) proxyMaker(k key) proxyMaker {
+	for s := c; s != nil; s = s.parent {
+		s.mu.RLock()
+		m := s.proxies[k]
+		s.mu.RUnlock()
+		if m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// A proxyFrame is a resolution that started with an empty path. The
+// proxies created during the resolution stay closed until it returns, as
+// by then every value that the proxies might resolve is either built or
+// failed.
+type proxyFrame struct {
+	ready []*int32
+}
+
+var proxyFrameKey = ctxkey.New[*proxyFrame]("di proxy frame")
+
+// hasProxies reports whether c or its ancestors have proxies.
+func (c *Container) hasProxies() bool {
+	for s := c; s != nil; s = s.parent {
+		s.mu.RLock()
+		n := len(s.proxies)
+		s.mu.RUnlock()
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// enterProxied returns ctx with a new frame, and the function that opens
+// the frame's proxies when the resolution returns.
+func enterProxied(ctx context.Context) (context.Context, func()) {
+	f := &proxyFrame{}
+	return proxyFrameKey.WithValue(ctx, f), func() {
+		for _, r := range f.ready {
+			atomic.StoreInt32(r, 1)
+		}
+	}
+}
+
+// proxy returns a proxy for k if k has one and constructing k would lead
+// back to a key of path, and reports whether it did.
+func (c *Container) proxy(ctx context.Context, path resolution, k key) (reflect.Value, bool) {
+	if len(path) == 0 {
+		return reflect.Value{}, false
+	}
+	m := c.proxyMaker(k)
+	if m == nil || !c.reaches(k, path) {
+		return reflect.Value{}, false
+	}
+	ready := new(int32)
+	if f, ok := proxyFrameKey.Value(ctx); ok {
+		f.ready = append(f.ready, ready)
+	} else {
+		atomic.StoreInt32(ready, 1)
+	}
+	return m(c, ready), true
+}
+
+// reaches reports whether constructing k resolves a key of path, either
+// because k is on path or through the dependencies of k.
+func (c *Container) reaches(k key, path resolution) bool {
+	on := map[key]bool{}
+	for _, p := range path {
+		on[p] = true
+	}
+	seen := map[key]bool{}
+	var walk func(k key) bool
+	walk = func(k key) bool {
+		if on[k] {
+			return true
+		}
+		if seen[k] {
+			return false
+		}
+		seen[k] = true
+		for _, dep := range c.dependencies(k, false) {
+			if walk(dep) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(k)
+}
+
+// brokenByProxy reports whether a proxy breaks the cycle that closes at k
+// on path: whichever key of the cycle the resolution enters first, it
+// requests the proxied key as a dependency before the cycle closes.
+func (c *Container) brokenByProxy(path resolution, k key) bool {
+	for i := len(path) - 1; i >= 0; i-- {
+		if c.proxyMaker(path[i]) != nil {
+			return true
+		}
+		if path[i] == k {
+			break
+		}
+	}
+	return false
+}
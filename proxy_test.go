@@ -0,0 +1,117 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type speaker interface {
+	Speak() string
+}
+
+// A speakerProxy forwards to the speaker in its Lazy.
+type speakerProxy struct {
+	target di.Lazy[speaker]
+}
+
+func (p speakerProxy) Speak() string { return p.target.MustGet().Speak() }
+
+// A poetSpeaker needs an index, which needs a speaker: a cycle.
+type poetSpeaker struct {
+	idx *index
+}
+
+func (*poetSpeaker) Speak() string { return "verse" }
+
+type index struct {
+	s   speaker
+	err error // What calling s in the constructor did.
+}
+
+// cyclicSpeakers wires a cycle speaker -> *index -> speaker. If call is
+// true, the index constructor calls its speaker.
+func cyclicSpeakers(call bool) *di.Container {
+	c := di.New()
+	c.Provide(func(idx *index) speaker { return &poetSpeaker{idx: idx} }, di.WithLifetime(di.Singleton))
+	c.Provide(func(s speaker) *index {
+		idx := &index{s: s}
+		if call {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						idx.err, _ = r.(error)
+					}
+				}()
+				s.Speak()
+			}()
+		}
+		return idx
+	})
+	return c
+}
+
+func TestCycleWithoutProxy(t *testing.T) {
+	c := cyclicSpeakers(false)
+	if _, err := di.Resolve[speaker](c); !errors.Is(err, di.ErrCycle) {
+		t.Errorf("got %v, want %v", err, di.ErrCycle)
+	}
+}
+
+func TestProxyBreaksCycle(t *testing.T) {
+	c := cyclicSpeakers(false)
+	di.Proxy(c, func(target di.Lazy[speaker]) speaker { return speakerProxy{target} })
+	if err := c.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	s, err := di.Resolve[speaker](c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := s.(*poetSpeaker)
+	if _, ok := ps.idx.s.(speakerProxy); !ok {
+		t.Fatalf("the index got %T, want the proxy", ps.idx.s)
+	}
+	// The proxy dispatches to the singleton that closed the cycle.
+	if got := ps.idx.s.Speak(); got != "verse" {
+		t.Errorf("Speak through the proxy: got %q", got)
+	}
+	target := ps.idx.s.(speakerProxy).target.MustGet()
+	if target != s {
+		t.Error("the proxy's target is another speaker than the one resolved")
+	}
+}
+
+func TestProxyIsOnlyUsedInCycles(t *testing.T) {
+	c := di.New()
+	c.Register(func() speaker { return &poetSpeaker{} })
+	c.Provide(func(s speaker) *index { return &index{s: s} })
+	di.Proxy(c, func(target di.Lazy[speaker]) speaker { return speakerProxy{target} })
+	if idx := di.MustResolve[*index](c); idx.s == nil {
+		t.Fatal("no speaker")
+	} else if _, ok := idx.s.(speakerProxy); ok {
+		t.Error("the index got a proxy, though there is no cycle")
+	}
+}
+
+func TestProxyNotReadyDuringConstruction(t *testing.T) {
+	c := cyclicSpeakers(true)
+	di.Proxy(c, func(target di.Lazy[speaker]) speaker { return speakerProxy{target} })
+	s, err := di.Resolve[speaker](c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(*poetSpeaker).idx.err; !errors.Is(err, di.ErrProxyNotReady) {
+		t.Errorf("calling the proxy in a constructor: got %v, want %v", err, di.ErrProxyNotReady)
+	}
+}
+
+func TestProxyNeedsAnInterface(t *testing.T) {
+	if msg := panics(func() {
+		di.Proxy(di.New(), func(di.Lazy[*thing]) *thing { return nil })
+	}); msg == "" {
+		t.Error("Proxy accepted a non-interface type")
+	}
+}
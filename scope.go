@@ -0,0 +1,105 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/appliedgo/di/ctxkey"
+)
+
+// ErrDisposed is returned when resolving from a scope that has been
+// disposed.
+var ErrDisposed = errors.New("scope has been disposed")
+
+// NewScope returns a child container for a unit of work such as an HTTP
+// request:
+//
+//	c.RegisterScoped(func() *Notebook { return NewNotebook() })
+//
+//	func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+//		scope := s.c.NewScope()
+//		defer scope.Dispose(r.Context())
+//		poem := di.MustResolve[*Poem](scope) // Gets this request's Notebook.
+//		...
+//	}
+//
+// A scope resolves every binding of its parent, and bindings registered in
+// the scope itself take precedence. Scoped bindings get one instance per
+// scope. Singletons stay shared with the parent and are constructed with
+// the parent's dependencies, so a singleton never holds on to a scoped
+// value. Transient bindings are constructed in the scope.
+//
+// Providers that run in the scope get the scope's Lifecycle, so resources
+// they acquire are tied to the scope. Start and Stop on the scope run only
+// those hooks. Scopes can be nested.
+func (c *Container) NewScope() *Container {
+	s := &Container{
+		bindings: map[key]*binding{},
+		usage:    c.usage,
+		tracer:   c.tracer,
+		parent:   c,
+	}
+	s.Register(func() Lifecycle { return &s.hooks })
+	return s
+}
+
+// Dispose ends a scope. It stops the scope's started hooks in reverse order,
+// as Stop does, releases the Disposable and io.Closer values that the scope
+// constructed, drops the scope's instances and frees their MaxInstances
+// budget. A disposed scope returns ErrDisposed for every resolution. Dispose
+// returns the first error of an OnStop hook or of releasing a value.
+//
+// Disposing the root container works the same way. Disposing a scope does
+// not dispose the scopes created from it.
+func (c *Container) Dispose(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&c.disposed, 0, 1) {
+		return nil
+	}
+	start := time.Now()
+	err := c.Stop(ctx)
+	if rerr := c.closers.releaseAll(ctx); err == nil {
+		err = rerr
+	}
+	c.mu.Lock()
+	instances := c.instances
+	c.instances = nil
+	c.mu.Unlock()
+	for b, inst := range instances {
+		if inst.v.IsValid() {
+			b.release()
+		}
+	}
+	c.mu.Lock()
+	c.disposal = time.Since(start)
+	c.mu.Unlock()
+	return err
+}
+
+// root returns the container that c was created from with New.
+func (c *Container) root() *Container {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+// scopeKey carries a scope in a context.
+var scopeKey = ctxkey.New[*Container]("di scope")
+
+// ContextWithScope returns a copy of ctx that carries scope, so that code
+// further down a request's call chain can resolve from the request's scope:
+//
+//	scope := c.NewScope()
+//	defer scope.Dispose(r.Context())
+//	next.ServeHTTP(w, r.WithContext(di.ContextWithScope(r.Context(), scope)))
+func ContextWithScope(ctx context.Context, scope *Container) context.Context {
+	return scopeKey.WithValue(ctx, scope)
+}
+
+// ScopeFromContext returns the scope carried by ctx, and whether there is
+// one.
+func ScopeFromContext(ctx context.Context) (*Container, bool) {
+	return scopeKey.Value(ctx)
+}
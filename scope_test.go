@@ -0,0 +1,65 @@
+package di_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+func TestScopedValuesPerScope(t *testing.T) {
+	c := di.New()
+	var cnt counter
+	c.RegisterScoped(cnt.provide)
+
+	s1, s2 := c.NewScope(), c.NewScope()
+	a, b := di.MustResolve[*thing](s1), di.MustResolve[*thing](s1)
+	if a != b {
+		t.Error("one scope returned two values")
+	}
+	if di.MustResolve[*thing](s2) == a {
+		t.Error("two scopes shared a value")
+	}
+	if cnt.n != 2 {
+		t.Errorf("provider ran %d times, want 2", cnt.n)
+	}
+}
+
+func TestSingletonsAreSharedWithScopes(t *testing.T) {
+	c := di.New()
+	var cnt counter
+	c.RegisterSingleton(cnt.provide)
+	root := di.MustResolve[*thing](c)
+	if di.MustResolve[*thing](c.NewScope()) != root {
+		t.Error("a scope built its own singleton")
+	}
+}
+
+func TestScopeBindingsTakePrecedence(t *testing.T) {
+	c := di.New()
+	c.Register(func() string { return "root" })
+	s := c.NewScope()
+	s.Register(func() string { return "scope" })
+	if got := di.MustResolve[string](s); got != "scope" {
+		t.Errorf("scope: got %q", got)
+	}
+	if got := di.MustResolve[string](c); got != "root" {
+		t.Errorf("root: got %q", got)
+	}
+}
+
+func TestDisposedScopeFails(t *testing.T) {
+	c := di.New()
+	c.RegisterScoped(new(counter).provide)
+	s := c.NewScope()
+	if err := s.Dispose(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := di.Resolve[*thing](s); !errors.Is(err, di.ErrDisposed) {
+		t.Errorf("got %v, want ErrDisposed", err)
+	}
+	if _, err := di.Resolve[*thing](c); err != nil {
+		t.Errorf("root after disposing a scope: %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package di
+
+import (
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ScopeStats describes the instance cache of a container or scope: the
+// singletons of a root container, or the scoped instances of a scope.
+type ScopeStats struct {
+	Created int   // Instances constructed and cached.
+	Reused  int   // Resolutions served from the cache.
+	Evicted int   // Instances removed by the eviction policy.
+	Cached  int   // Instances in the cache now.
+	Bytes   int64 // Estimated memory held by the cached instances.
+
+	// Disposal is how long Dispose took to stop the hooks and drop the
+	// cache; it is zero until the scope is disposed.
+	Disposal time.Duration
+}
+
+// Stats returns the statistics of c's instance cache. Bytes is an estimate:
+// it adds up the memory reachable from each cached instance when it was
+// constructed, counting shared memory once. It does not follow instances
+// that grow later, as reading them while their owners write to them would
+// be a data race, and it cannot see memory held outside of Go, such as
+// open files.
+func (c *Container) Stats() ScopeStats {
+	entries := c.cacheEntries()
+	st := ScopeStats{
+		Created: int(atomic.LoadInt64(&c.created)),
+		Reused:  int(atomic.LoadInt64(&c.reused)),
+		Evicted: int(atomic.LoadInt64(&c.evicted)),
+		Cached:  len(entries),
+	}
+	c.mu.RLock()
+	st.Disposal = c.disposal
+	c.mu.RUnlock()
+	for _, e := range entries {
+		st.Bytes += e.Bytes
+	}
+	return st
+}
+
+// A CacheEntry describes one cached instance to an EvictionPolicy.
+type CacheEntry struct {
+	Type     reflect.Type // The type of the binding.
+	Name     string       // The name of the binding, if it is named.
+	Created  time.Time
+	LastUsed time.Time
+	Uses     int   // Resolutions of the instance, including the first.
+	Bytes    int64 // Estimated memory held by the instance at construction, as in ScopeStats.
+
+	b *binding
+}
+
+// An EvictionPolicy selects the cached instances that a container drops, so
+// that long-lived scopes such as user sessions do not grow without bound.
+// Evict receives the cached instances, ordered from the least to the most
+// recently used, and returns those to drop.
+//
+// An evicted instance is constructed again when it is next resolved. Values
+// that consumers already hold are not affected, and lifecycle hooks that
+// its provider registered stay registered until the scope is disposed.
+type EvictionPolicy interface {
+	Evict(entries []CacheEntry, now time.Time) []CacheEntry
+}
+
+// EvictionFunc adapts a function to an EvictionPolicy.
+type EvictionFunc func(entries []CacheEntry, now time.Time) []CacheEntry
+
+// Evict calls f.
+func (f EvictionFunc) Evict(entries []CacheEntry, now time.Time) []CacheEntry {
+	return f(entries, now)
+}
+
+// MaxEntries returns a policy that keeps at most n instances, dropping the
+// least recently used ones.
+func MaxEntries(n int) EvictionPolicy {
+	return EvictionFunc(func(entries []CacheEntry, _ time.Time) []CacheEntry {
+		if len(entries) <= n {
+			return nil
+		}
+		return entries[:len(entries)-n]
+	})
+}
+
+// MaxBytes returns a policy that drops the least recently used instances
+// until the estimated size of the cache is at most n bytes.
+func MaxBytes(n int64) EvictionPolicy {
+	return EvictionFunc(func(entries []CacheEntry, _ time.Time) []CacheEntry {
+		var total int64
+		for _, e := range entries {
+			total += e.Bytes
+		}
+		i := 0
+		for ; i < len(entries) && total > n; i++ {
+			total -= entries[i].Bytes
+		}
+		return entries[:i]
+	})
+}
+
+// MaxIdle returns a policy that drops instances that have not been resolved
+// for longer than d. As policies only run when the cache grows, call Evict
+// periodically to drop idle instances of a scope that is no longer used.
+func MaxIdle(d time.Duration) EvictionPolicy {
+	return EvictionFunc(func(entries []CacheEntry, now time.Time) []CacheEntry {
+		i := 0
+		for ; i < len(entries) && now.Sub(entries[i].LastUsed) > d; i++ {
+		}
+		return entries[:i]
+	})
+}
+
+// SetEvictionPolicy makes p the eviction policy of c's instance cache. The
+// policy runs whenever an instance is added to the cache, and on Evict.
+// SetEvictionPolicy(nil) removes the policy. Scopes do not inherit the
+// policy of their parent.
+func (c *Container) SetEvictionPolicy(p EvictionPolicy) {
+	c.mu.Lock()
+	c.eviction = p
+	c.mu.Unlock()
+	c.Evict()
+}
+
+// Evict runs the eviction policy and returns the number of instances it
+// dropped.
+func (c *Container) Evict() int {
+	c.mu.RLock()
+	p := c.eviction
+	c.mu.RUnlock()
+	if p == nil {
+		return 0
+	}
+	entries := c.cacheEntries()
+	evicted := 0
+	for _, e := range p.Evict(entries, time.Now()) {
+		c.mu.Lock()
+		_, ok := c.instances[e.b]
+		delete(c.instances, e.b)
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+		e.b.release()
+		atomic.AddInt64(&c.evicted, 1)
+		evicted++
+		c.tracer.emit(TraceEvent{Kind: "evict", Binding: key{typ: e.Type, name: e.Name}.String(), Provider: e.b.location})
+	}
+	return evicted
+}
+
+// cacheEntries returns the instances that c has cached, from the least to
+// the most recently used. Instances under construction are left out.
+func (c *Container) cacheEntries() []CacheEntry {
+	c.mu.RLock()
+	instances := make(map[*binding]*instance, len(c.instances))
+	for b, inst := range c.instances {
+		instances[b] = inst
+	}
+	c.mu.RUnlock()
+
+	var entries []CacheEntry
+	for b, inst := range instances {
+		// Locking an instance under construction would wait for its
+		// provider, which may be resolving from c right now.
+		if !inst.mu.TryLock() {
+			continue
+		}
+		if inst.v.IsValid() {
+			entries = append(entries, CacheEntry{
+				Type:     inst.k.typ,
+				Name:     inst.k.name,
+				Created:  inst.created,
+				LastUsed: inst.used,
+				Uses:     inst.uses,
+				Bytes:    inst.bytes,
+				b:        b,
+			})
+		}
+		inst.mu.Unlock()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	return entries
+}
+
+// sizeOf estimates the memory held by v: its own size plus the memory
+// reachable from it.
+func sizeOf(v reflect.Value) int64 {
+	s := sizer{seen: map[uintptr]bool{}}
+	return int64(v.Type().Size()) + s.indirect(v)
+}
+
+type sizer struct {
+	seen map[uintptr]bool // Addresses already counted.
+}
+
+// indirect returns the size of the memory that v refers to, not counting
+// v itself.
+func (s sizer) indirect(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || s.seen[v.Pointer()] {
+			return 0
+		}
+		s.seen[v.Pointer()] = true
+		return int64(v.Type().Elem().Size()) + s.indirect(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		e := v.Elem()
+		if e.Kind() == reflect.Ptr {
+			return s.indirect(e)
+		}
+		return int64(e.Type().Size()) + s.indirect(e)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || s.seen[v.Pointer()] {
+			return 0
+		}
+		s.seen[v.Pointer()] = true
+		n := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			n += s.indirect(v.Index(i))
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() || s.seen[v.Pointer()] {
+			return 0
+		}
+		s.seen[v.Pointer()] = true
+		var n int64
+		it := v.MapRange()
+		for it.Next() {
+			k, e := it.Key(), it.Value()
+			n += int64(k.Type().Size()) + s.indirect(k) + int64(e.Type().Size()) + s.indirect(e)
+		}
+		return n
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += s.indirect(v.Field(i))
+		}
+		return n
+	case reflect.Array:
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += s.indirect(v.Index(i))
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package di_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/appliedgo/di"
+)
+
+type (
+	small struct{ b [16]byte }
+	large struct{ b []byte }
+)
+
+// cached registers three singletons with c, and resolves them in the
+// order *thing, *small, *large.
+func cached(c *di.Container) {
+	c.RegisterSingleton(func() *thing { return &thing{} })
+	c.RegisterSingleton(func() *small { return &small{} })
+	c.RegisterSingleton(func() *large { return &large{b: make([]byte, 1<<16)} })
+	di.MustResolve[*thing](c)
+	di.MustResolve[*small](c)
+	di.MustResolve[*large](c)
+}
+
+func TestStats(t *testing.T) {
+	c := di.New()
+	cached(c)
+	di.MustResolve[*thing](c)
+	di.MustResolve[*thing](c)
+	st := c.Stats()
+	if st.Created != 3 || st.Reused != 2 || st.Cached != 3 || st.Evicted != 0 {
+		t.Errorf("got %+v", st)
+	}
+	if st.Bytes < 1<<16 {
+		t.Errorf("Bytes: got %d, want at least the large slice", st.Bytes)
+	}
+	if st.Disposal != 0 {
+		t.Errorf("Disposal before Dispose: %v", st.Disposal)
+	}
+	if err := c.Dispose(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.Stats(); st.Cached != 0 || st.Bytes != 0 {
+		t.Errorf("after Dispose: %+v", st)
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy di.EvictionPolicy
+		kept   []string
+	}{
+		{"MaxEntries", di.MaxEntries(2), []string{"*di_test.small", "*di_test.large"}},
+		{"MaxEntries above the size", di.MaxEntries(5), []string{"*di_test.thing", "*di_test.small", "*di_test.large"}},
+		{"MaxBytes", di.MaxBytes(1 << 10), []string{}},
+		{"MaxBytes above the size", di.MaxBytes(1 << 20), []string{"*di_test.thing", "*di_test.small", "*di_test.large"}},
+		{"MaxIdle", di.MaxIdle(time.Hour), []string{"*di_test.thing", "*di_test.small", "*di_test.large"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			cached(c)
+			c.SetEvictionPolicy(tc.policy)
+			var kept []string
+			c.SetEvictionPolicy(di.EvictionFunc(func(entries []di.CacheEntry, _ time.Time) []di.CacheEntry {
+				kept = []string{}
+				for _, e := range entries {
+					kept = append(kept, e.Type.String())
+				}
+				return nil
+			}))
+			if !reflect.DeepEqual(kept, tc.kept) {
+				t.Errorf("kept %q, want %q", kept, tc.kept)
+			}
+			st := c.Stats()
+			if st.Evicted != 3-len(tc.kept) || st.Cached != len(tc.kept) {
+				t.Errorf("got %+v", st)
+			}
+		})
+	}
+}
+
+// The policy sees the entries from the least to the most recently used.
+func TestEvictionOrderAndUses(t *testing.T) {
+	c := di.New()
+	cached(c)
+	di.MustResolve[*thing](c) // Now the most recently used.
+	var got []di.CacheEntry
+	c.SetEvictionPolicy(di.EvictionFunc(func(entries []di.CacheEntry, _ time.Time) []di.CacheEntry {
+		got = entries
+		return entries[:1]
+	}))
+	if len(got) != 3 {
+		t.Fatalf("got %d entries", len(got))
+	}
+	if got[0].Type != reflect.TypeOf(&small{}) || got[2].Type != reflect.TypeOf(&thing{}) {
+		t.Errorf("order: got %v, %v, %v", got[0].Type, got[1].Type, got[2].Type)
+	}
+	if got[2].Uses != 2 {
+		t.Errorf("Uses: got %d, want 2", got[2].Uses)
+	}
+
+	// The policy runs when the cache grows, and an evicted instance is
+	// constructed again.
+	c.RegisterSingleton(func() *counter { return &counter{} })
+	di.MustResolve[*counter](c)
+	di.MustResolve[*small](c)
+	if st := c.Stats(); st.Evicted != 3 || st.Created != 5 {
+		t.Errorf("got %+v", st)
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	now := time.Now()
+	entries := []di.CacheEntry{
+		{Name: "a", LastUsed: now.Add(-time.Hour)},
+		{Name: "b", LastUsed: now.Add(-time.Minute)},
+		{Name: "c", LastUsed: now.Add(-time.Second)},
+	}
+	got := di.MaxIdle(10*time.Second).Evict(entries, now)
+	if len(got) != 2 || got[0].Name != "a" || got[1].Name != "b" {
+		t.Errorf("got %+v, want a and b", got)
+	}
+	if got := di.MaxIdle(2*time.Hour).Evict(entries, now); len(got) != 0 {
+		t.Errorf("got %+v, want none", got)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	c := di.New()
+	cached(c)
+	var drop bool
+	c.SetEvictionPolicy(di.EvictionFunc(func(entries []di.CacheEntry, _ time.Time) []di.CacheEntry {
+		if !drop {
+			return nil
+		}
+		return entries[:2]
+	}))
+	drop = true
+	if n := c.Evict(); n != 2 {
+		t.Errorf("evicted %d instances, want 2", n)
+	}
+	c.SetEvictionPolicy(nil)
+	if n := c.Evict(); n != 0 {
+		t.Errorf("without a policy, evicted %d", n)
+	}
+}
+
+// A scope has a cache and policy of its own.
+func TestScopeEviction(t *testing.T) {
+	c := di.New()
+	c.SetEvictionPolicy(di.MaxEntries(0))
+	c.Provide(func() *thing { return &thing{} }, di.WithLifetime(di.Scoped))
+	c.Provide(func() *small { return &small{} }, di.WithLifetime(di.Scoped))
+	s := c.NewScope()
+	s.SetEvictionPolicy(di.MaxEntries(1))
+	di.MustResolve[*thing](s)
+	di.MustResolve[*small](s)
+	if st := s.Stats(); st.Created != 2 || st.Cached != 1 || st.Evicted != 1 {
+		t.Errorf("scope: got %+v", st)
+	}
+	if st := c.Stats(); st.Created != 0 {
+		t.Errorf("root: got %+v", st)
+	}
+}
@@ -0,0 +1,127 @@
+package di
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A TraceEvent is one step of the construction of a container's values.
+// Events are written as they happen, one JSON object per line, so that a
+// trace is complete up to the moment a program crashed. "di trace" reads
+// such a trace and prints the construction tree.
+type TraceEvent struct {
+	Seq   int       `json:"seq"`
+	Time  time.Time `json:"time"`
+	Depth int       `json:"depth"` // Nesting level; dependencies are one deeper than their consumer.
+
+	// Kind is one of
+	//	"begin"  construction starts; dependencies are resolved next,
+	//	"call"   the dependencies are ready and the provider is called,
+	//	"done"   the provider returned,
+	//	"fail"   the binding could not be resolved,
+	//	"reuse"  an existing singleton was returned,
+	//	"evict"  an eviction policy dropped a cached instance.
+	Kind string `json:"kind"`
+
+	Binding  string `json:"binding"`            // Type and name of the binding.
+	Provider string `json:"provider,omitempty"` // Source location of the provider.
+
+	// The inputs of a "call" event and the output of a "done" event: the
+	// dynamic types of the arguments passed to the provider and of its
+	// result.
+	Args   []string `json:"args,omitempty"`
+	Result string   `json:"result,omitempty"`
+
+	Duration time.Duration `json:"duration,omitempty"` // Of "done" and "fail" events after a "begin".
+	Error    string        `json:"error,omitempty"`
+}
+
+// TraceTo starts writing a construction trace to w. Every resolution from
+// now on writes events to w, one JSON-encoded TraceEvent per line.
+// TraceTo(nil) stops tracing.
+//
+// Tracing is meant for diagnosing startup problems: enable it, for example
+// behind an environment variable, in the environment where the problem
+// shows, and inspect the trace offline with "di trace".
+func (c *Container) TraceTo(w io.Writer) {
+	c.tracer.mu.Lock()
+	defer c.tracer.mu.Unlock()
+	if w == nil {
+		c.tracer.enc = nil
+		atomic.StoreInt32(&c.tracer.enabled, 0)
+		return
+	}
+	c.tracer.enc = json.NewEncoder(w)
+	atomic.StoreInt32(&c.tracer.enabled, 1)
+}
+
+// ReadTrace decodes a trace written by a container after TraceTo.
+func ReadTrace(r io.Reader) ([]TraceEvent, error) {
+	var events []TraceEvent
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var e TraceEvent
+		if err := dec.Decode(&e); err != nil {
+			return events, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// tracer writes trace events.
+type tracer struct {
+	enabled int32 // Accessed atomically, so that disabled tracing costs no lock.
+	mu      sync.Mutex
+	enc     *json.Encoder
+	seq     int
+}
+
+func (t *tracer) on() bool {
+	return atomic.LoadInt32(&t.enabled) == 1
+}
+
+// emit writes e with the next sequence number. Errors writing the trace are
+// ignored; a broken trace must not break the application.
+func (t *tracer) emit(e TraceEvent) {
+	if !t.on() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.enc == nil {
+		return
+	}
+	t.seq++
+	e.Seq = t.seq
+	e.Time = time.Now()
+	_ = t.enc.Encode(e)
+}
+
+// dynamicTypes returns the types of the values in vs as they appear at run
+// time, looking through interfaces.
+func dynamicTypes(vs []reflect.Value) []string {
+	types := make([]string, len(vs))
+	for i, v := range vs {
+		types[i] = dynamicType(v)
+	}
+	return types
+}
+
+func dynamicType(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<nil>"
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "<nil>"
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprintf("%v", v.Type())
+}
@@ -0,0 +1,126 @@
+package di
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+// usage samples resolutions for the usage report.
+type usage struct {
+	every uint64 // Record one of every n resolutions; 0 disables sampling. Accessed atomically.
+	tick  uint64 // Accessed atomically.
+
+	mu            sync.Mutex
+	resolutions   map[key]uint64
+	constructions map[key]uint64
+}
+
+// SampleUsage turns on usage sampling: from now on, one of every n
+// resolutions is recorded. Sampling costs one atomic operation per
+// resolution, and a short lock for every recorded one, so it can stay on in
+// production. SampleUsage(0) turns sampling off; the samples recorded so far
+// are kept.
+//
+// Usage returns what has been recorded.
+func (c *Container) SampleUsage(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreUint64(&c.usage.every, uint64(n))
+}
+
+// sample records a resolution of k. constructed tells whether the provider
+// was called, as opposed to returning an existing singleton.
+func (u *usage) sample(k key, constructed bool) {
+	every := atomic.LoadUint64(&u.every)
+	if every == 0 || atomic.AddUint64(&u.tick, 1)%every != 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.resolutions == nil {
+		u.resolutions = map[key]uint64{}
+		u.constructions = map[key]uint64{}
+	}
+	u.resolutions[k] += every
+	if constructed {
+		u.constructions[k] += every
+	}
+}
+
+// BindingUsage is the sampled usage of one binding.
+type BindingUsage struct {
+	Type   reflect.Type
+	Name   string // The name of the binding, if it is named.
+	Module string // The module that installed the binding, if any.
+
+	// Estimated counts, extrapolated from the samples.
+	Resolutions   uint64 // Times the binding was resolved, directly or as a dependency.
+	Constructions uint64 // Times its provider was called.
+}
+
+// A UsageReport lists the sampled usage of all bindings of a container, the
+// most frequently resolved first.
+type UsageReport []BindingUsage
+
+// Usage returns the usage recorded since sampling was turned on with
+// SampleUsage. The report includes every current binding; bindings that
+// were never sampled have zero counts and are candidates for dead wiring,
+// the most frequently resolved ones are candidates for optimization.
+func (c *Container) Usage() UsageReport {
+	c.mu.RLock()
+	var report UsageReport
+	for k, b := range c.bindings {
+		report = append(report, BindingUsage{Type: k.typ, Name: k.name, Module: b.module})
+	}
+	c.mu.RUnlock()
+
+	c.usage.mu.Lock()
+	for i, u := range report {
+		k := key{typ: u.Type, name: u.Name}
+		report[i].Resolutions = c.usage.resolutions[k]
+		report[i].Constructions = c.usage.constructions[k]
+	}
+	c.usage.mu.Unlock()
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Resolutions != report[j].Resolutions {
+			return report[i].Resolutions > report[j].Resolutions
+		}
+		return key{typ: report[i].Type, name: report[i].Name}.String() < key{typ: report[j].Type, name: report[j].Name}.String()
+	})
+	return report
+}
+
+// WriteTo writes the report as a table.
+func (r UsageReport) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "BINDING\tMODULE\tRESOLUTIONS\tCONSTRUCTIONS")
+	for _, u := range r {
+		module := u.Module
+		if module == "" {
+			module = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%s\t%d\t%d\n", key{typ: u.Type, name: u.Name}, module, u.Resolutions, u.Constructions)
+	}
+	err := tw.Flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,57 @@
+package di
+
+import "fmt"
+
+// Value registers v as a singleton of type T under the name key. Values
+// bring configuration, such as file paths and bucket names, into the
+// container, so that it reaches constructors the same way services do:
+//
+//	di.Value(c, "notebook.dir", "/var/lib/poems")
+//	di.Value(c, "notebook.mode", fs.FileMode(0o600))
+//	c.Provide(NewFileStorage, di.ParamNames("notebook.dir", "notebook.mode"))
+//
+// where
+//
+//	func NewFileStorage(dir string, mode fs.FileMode) PoemStorage
+//
+// Values of the same type are kept apart by their keys; a value registered
+// under an empty key is the unnamed binding of T. As with any named
+// binding, Resolve finds a value with Named:
+//
+//	dir := di.MustResolve[string](c, di.Named("notebook.dir"))
+func Value[T any](c *Container, key string, v T) {
+	c.Register(func() T { return v }, Named(key), WithLifetime(Singleton), AllowNil())
+}
+
+// ParamNames names the bindings that the container injects into the
+// parameters of a constructor registered with Provide, in the order of the
+// parameters. A parameter whose name is empty, or that comes after the last
+// name, receives the unnamed binding of its type, as it would without
+// ParamNames:
+//
+//	// The storage gets the unnamed Logger and the string named "notebook.dir".
+//	c.Provide(func(l *log.Logger, dir string) PoemStorage { ... }, di.ParamNames("", "notebook.dir"))
+//
+// Registration panics if there are more names than parameters.
+func ParamNames(names ...string) Option {
+	return func(b *binding) {
+		b.paramNames = names
+	}
+}
+
+// paramKeys returns the keys of the bindings that b injects into the
+// parameters of its provider.
+func (b *binding) paramKeys() []key {
+	ks := keys(b.params)
+	for i, name := range b.paramNames {
+		ks[i].name = name
+	}
+	return ks
+}
+
+// checkParamNames panics if b has more parameter names than parameters.
+func (b *binding) checkParamNames() {
+	if len(b.paramNames) > len(b.params) {
+		panic(fmt.Sprintf("di: ParamNames: %d names for %d parameters of %v", len(b.paramNames), len(b.params), b.provider.Type()))
+	}
+}
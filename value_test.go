@@ -0,0 +1,98 @@
+package di_test
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type fileStorage struct {
+	dir  string
+	mode fs.FileMode
+	th   *thing
+}
+
+func TestValue(t *testing.T) {
+	c := di.New()
+	di.Value(c, "notebook.dir", "/var/lib/poems")
+	di.Value(c, "napkin.dir", "/tmp")
+	di.Value(c, "notebook.mode", fs.FileMode(0o600))
+	di.Value(c, "", "unnamed")
+	di.Value[*thing](c, "none", nil)
+
+	for name, want := range map[string]string{"notebook.dir": "/var/lib/poems", "napkin.dir": "/tmp", "": "unnamed"} {
+		if got := di.MustResolve[string](c, di.Named(name)); got != want {
+			t.Errorf("%q: got %q, want %q", name, got, want)
+		}
+	}
+	if got := di.MustResolve[fs.FileMode](c, di.Named("notebook.mode")); got != 0o600 {
+		t.Errorf("mode: got %v", got)
+	}
+	if got, err := di.Resolve[*thing](c, di.Named("none")); err != nil || got != nil {
+		t.Errorf("nil value: got %v, %v", got, err)
+	}
+	for _, b := range c.Bindings() {
+		if b.Type.String() == "string" && b.Lifetime != di.Singleton {
+			t.Errorf("%q is %v, want a singleton", b.Name, b.Lifetime)
+		}
+	}
+}
+
+func TestParamNames(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		names []string
+		want  fileStorage
+	}{
+		{
+			name:  "all named",
+			names: []string{"notebook.dir", "notebook.mode", "special"},
+			want:  fileStorage{dir: "/var/lib/poems", mode: 0o600, th: &thing{id: 2}},
+		},
+		{
+			name:  "empty names are unnamed",
+			names: []string{"", "notebook.mode", ""},
+			want:  fileStorage{dir: "unnamed", mode: 0o600, th: &thing{id: 1}},
+		},
+		{
+			name:  "fewer names than parameters",
+			names: []string{"notebook.dir"},
+			want:  fileStorage{dir: "/var/lib/poems", mode: 0o644, th: &thing{id: 1}},
+		},
+		{
+			name: "no names",
+			want: fileStorage{dir: "unnamed", mode: 0o644, th: &thing{id: 1}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := di.New()
+			di.Value(c, "notebook.dir", "/var/lib/poems")
+			di.Value(c, "notebook.mode", fs.FileMode(0o600))
+			di.Value(c, "", "unnamed")
+			di.Value(c, "", fs.FileMode(0o644))
+			c.Register(func() *thing { return &thing{id: 1} })
+			c.Register(func() *thing { return &thing{id: 2} }, di.Named("special"))
+			c.Provide(func(dir string, mode fs.FileMode, th *thing) *fileStorage {
+				return &fileStorage{dir: dir, mode: mode, th: th}
+			}, di.ParamNames(tc.names...))
+
+			got, err := di.Resolve[*fileStorage](c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tc.want) {
+				t.Errorf("got %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParamNamesTooMany(t *testing.T) {
+	if msg := panics(func() {
+		di.New().Provide(func(string) *thing { return &thing{} }, di.ParamNames("a", "b"))
+	}); msg == "" {
+		t.Error("Provide accepted more names than parameters")
+	}
+}
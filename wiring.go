@@ -0,0 +1,242 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A BuildError lists all problems that Build found.
+type BuildError struct {
+	Errors []error
+}
+
+func (e *BuildError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = "\n\t" + err.Error()
+	}
+	return fmt.Sprintf("di: build: %d errors:%s", len(e.Errors), strings.Join(msgs, ""))
+}
+
+// Unwrap returns the errors, so that errors.Is and errors.As of Go 1.20
+// and later look at each of them.
+func (e *BuildError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether one of the errors matches target, so that errors.Is
+// looks at each of them also before Go 1.20, which does not know Unwrap
+// methods that return several errors.
+func (e *BuildError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target, as Is does for
+// errors.Is.
+func (e *BuildError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Build checks the wiring of the whole container at once, instead of
+// finding problems one Resolve at a time. It reports every binding that
+// depends on a type without provider, every dependency cycle, and, by
+// constructing all singletons, every provider that fails. Errors carry the
+// chain of types that led to them, as Resolve's errors do.
+//
+// Build is meant to run at startup, after all registrations. It returns
+// nil or a *BuildError. Singletons that depend on a broken binding are not
+// constructed, so each problem is reported only once. Transient and scoped
+// bindings are checked but not constructed.
+func (c *Container) Build() error {
+	c.mu.RLock()
+	ks := make([]key, 0, len(c.bindings))
+	for k := range c.bindings {
+		ks = append(ks, k)
+	}
+	c.mu.RUnlock()
+	sort.Slice(ks, func(i, j int) bool { return ks[i].String() < ks[j].String() })
+
+	var errs []error
+	broken := map[key]bool{}
+	for _, k := range ks {
+		for _, dep := range c.dependencies(k, true) {
+			if !c.satisfied(dep) {
+				errs = append(errs, fmt.Errorf("%v: %v: %w", k, dep, ErrNotRegistered))
+				broken[k] = true
+			}
+		}
+	}
+
+	// Report each cycle once, no matter where the search enters it.
+	state := map[key]int{} // 1: on the current path, 2: done.
+	seen := map[string]bool{}
+	var visit func(path resolution, k key)
+	visit = func(path resolution, k key) {
+		switch state[k] {
+		case 1:
+			if c.brokenByProxy(path, k) {
+				return
+			}
+			err := c.cycle(path, k)
+			if id := cycleID(err.(*CycleError)); !seen[id] {
+				seen[id] = true
+				errs = append(errs, err)
+			}
+			for _, step := range path {
+				broken[step] = true
+			}
+			return
+		case 2:
+			return
+		}
+		state[k] = 1
+		next := append(path[:len(path):len(path)], k)
+		for _, dep := range c.dependencies(k, false) {
+			if _, _, ok := c.lookup(dep); ok || len(c.members(dep)) > 0 {
+				visit(next, dep)
+			}
+		}
+		// A group depends on its members, which share the key of the
+		// group's element type.
+		if _, _, ok := c.lookup(k); !ok {
+			mk := key{typ: k.typ.Elem(), name: k.name}
+			for _, m := range c.members(k) {
+				for _, dep := range c.bindingDependencies(mk, m.b, false) {
+					if _, _, ok := c.lookup(dep); ok || len(c.members(dep)) > 0 {
+						visit(append(next, mk), dep)
+					}
+				}
+			}
+		}
+		state[k] = 2
+	}
+	for _, k := range ks {
+		visit(nil, k)
+	}
+
+	// Construct singletons after their dependencies, so that a failing
+	// provider marks its consumers as broken before they are tried.
+	done := map[key]bool{}
+	var construct func(k key)
+	construct = func(k key) {
+		if done[k] {
+			return
+		}
+		done[k] = true
+		for _, dep := range c.dependencies(k, false) {
+			construct(dep)
+			if broken[dep] {
+				broken[k] = true
+			}
+		}
+		b, _, ok := c.lookup(k)
+		if !ok || broken[k] || b.lifetime != Singleton || b.alias != nil {
+			return
+		}
+		if _, err := c.resolve(context.Background(), nil, k); err != nil {
+			errs = append(errs, err)
+			broken[k] = true
+		}
+	}
+	for _, k := range ks {
+		construct(k)
+	}
+
+	if len(errs) > 0 {
+		return &BuildError{Errors: errs}
+	}
+	return nil
+}
+
+// dependencies returns the keys that the binding of k needs resolved when
+// it is constructed: the provider's parameters, the injected fields, the
+// decorators' parameters, and for aliases the aliased binding. Optional
+// dependencies are left out, as they cannot be missing. Lazy and Factory
+// dependencies are resolved only later, outside of the construction, so
+// they are included only if deferred is set.
+func (c *Container) dependencies(k key, deferred bool) []key {
+	b, _, ok := c.lookup(k)
+	if !ok {
+		return nil
+	}
+	return c.bindingDependencies(k, b, deferred)
+}
+
+// bindingDependencies returns the dependencies of binding b of k, as
+// dependencies does. Unlike dependencies, it works for group members,
+// which share the key of their group.
+func (c *Container) bindingDependencies(k key, b *binding, deferred bool) []key {
+	var deps []key
+	add := func(dep key) {
+		if dep.typ == contextType {
+			return
+		}
+		if dep.typ.Implements(wrapperType) {
+			typ, kind := reflect.Zero(dep.typ).Interface().(wrapper).wrapped()
+			if kind == "optional" || !deferred {
+				return
+			}
+			dep.typ = typ
+		}
+		deps = append(deps, dep)
+	}
+	if b.alias != nil {
+		add(*b.alias)
+	}
+	ps := b.paramKeys()
+	for i, p := range ps {
+		if b.variadic && i == len(ps)-1 && !c.satisfied(p) {
+			continue // Receives no arguments.
+		}
+		add(p)
+	}
+	for _, f := range b.fields {
+		add(f.dep)
+	}
+	for s := c; s != nil; s = s.parent {
+		s.mu.RLock()
+		ds := s.decorators[k]
+		s.mu.RUnlock()
+		for _, d := range ds {
+			for i, p := range d.params {
+				if d.variadic && i == len(d.params)-1 && !c.satisfied(key{typ: p}) {
+					continue
+				}
+				add(key{typ: p})
+			}
+		}
+	}
+	return deps
+}
+
+// satisfied reports whether a provider or group exists for k.
+func (c *Container) satisfied(k key) bool {
+	if _, _, ok := c.lookup(k); ok {
+		return true
+	}
+	return len(c.members(k)) > 0
+}
+
+// cycleID identifies a cycle independently of the binding it starts at.
+func cycleID(e *CycleError) string {
+	steps := make([]string, len(e.Path)-1)
+	for i, s := range e.Path[:len(e.Path)-1] {
+		steps[i] = key{typ: s.Type, name: s.Name}.String()
+	}
+	sort.Strings(steps)
+	return strings.Join(steps, "\x00")
+}
@@ -0,0 +1,81 @@
+package di_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/appliedgo/di"
+)
+
+type (
+	cycleA struct{}
+	cycleB struct{}
+	broken struct{}
+)
+
+var errBroken = errors.New("broken")
+
+// brokenWiring returns a container with one of each problem that Build
+// finds: a missing dependency, a cycle, and a failing provider.
+func brokenWiring() *di.Container {
+	c := di.New()
+	c.Provide(func(*thing) *store { return &store{} }) // No *thing.
+	c.Provide(func(*cycleB) *cycleA { return &cycleA{} })
+	c.Provide(func(*cycleA) *cycleB { return &cycleB{} })
+	c.RegisterSingleton(func() (*broken, error) { return nil, errBroken })
+	return c
+}
+
+func TestBuildReportsEveryProblem(t *testing.T) {
+	err := brokenWiring().Build()
+	var be *di.BuildError
+	if !errors.As(err, &be) {
+		t.Fatalf("got %v, want a *BuildError", err)
+	}
+	if len(be.Errors) != 3 {
+		t.Errorf("got %d errors, want 3: %v", len(be.Errors), err)
+	}
+	if err := di.New().Build(); err != nil {
+		t.Errorf("empty container: %v", err)
+	}
+}
+
+func TestBuildErrorMatchesEachError(t *testing.T) {
+	err := brokenWiring().Build()
+	for _, target := range []error{di.ErrNotRegistered, di.ErrCycle, errBroken} {
+		if !errors.Is(err, target) {
+			t.Errorf("errors.Is(err, %v) = false", target)
+		}
+	}
+	if errors.Is(err, di.ErrLimitExceeded) {
+		t.Error("errors.Is matched an error that Build did not report")
+	}
+	var pe *di.ProviderError
+	if !errors.As(err, &pe) || !errors.Is(pe.Err, errBroken) {
+		t.Errorf("errors.As *ProviderError: got %v", pe)
+	}
+	var ce *di.CycleError
+	if !errors.As(err, &ce) || len(ce.Path) != 3 {
+		t.Errorf("errors.As *CycleError: got %v", ce)
+	}
+}
+
+// The methods Is and As make errors.Is and errors.As work on Go versions
+// before 1.20, which ignore Unwrap() []error.
+func TestBuildErrorIsAndAs(t *testing.T) {
+	be := brokenWiring().Build().(*di.BuildError)
+	if !be.Is(di.ErrCycle) || !be.Is(errBroken) {
+		t.Error("Is does not look at each error")
+	}
+	if be.Is(di.ErrDisposed) {
+		t.Error("Is matched an error that Build did not report")
+	}
+	var ce *di.CycleError
+	if !be.As(&ce) {
+		t.Error("As does not look at each error")
+	}
+	var le *di.LimitError
+	if be.As(&le) {
+		t.Error("As matched an error that Build did not report")
+	}
+}
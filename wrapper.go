@@ -0,0 +1,38 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// A wrapper is a type such as Optional[T] or Lazy[T] that is not bound
+// itself but changes how its type argument is resolved. The container
+// recognizes wrappers by this interface.
+type wrapper interface {
+	resolveWrapper(c *Container, ctx context.Context, path resolution, name string) (reflect.Value, error)
+
+	// wrapped returns the type argument and a short description of the
+	// wrapper, such as "lazy".
+	wrapped() (reflect.Type, string)
+}
+
+var wrapperType = reflect.TypeOf((*wrapper)(nil)).Elem()
+
+// errNotInjected is returned by wrappers that were created by hand instead
+// of being injected by a container.
+var errNotInjected = errors.New("di: dependency wrapper was not injected by a container")
+
+// resolveWrapper resolves a wrapper type, or reports false if k is not one.
+func (c *Container) resolveWrapper(ctx context.Context, path resolution, k key) (reflect.Value, bool, error) {
+	if !k.typ.Implements(wrapperType) {
+		return reflect.Value{}, false, nil
+	}
+	v, err := reflect.Zero(k.typ).Interface().(wrapper).resolveWrapper(c, ctx, path, k.name)
+	return v, true, err
+}
+
+// typeOf returns the reflect.Type of T, including interface types.
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}